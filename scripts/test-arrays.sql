@@ -0,0 +1,23 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-arrays.sql
+-- Elements must be converted like scalar values, NULL elements and empty arrays must be kept, and multi-dimensional arrays must be flattened:
+-- SELECT name, uuid_array_column, numeric_array_column, timestamptz_array_column, int_array_column, text_array_column FROM test_arrays ORDER BY id;
+
+DROP TABLE IF EXISTS test_arrays;
+
+CREATE TABLE test_arrays (
+  id SERIAL PRIMARY KEY,
+  name TEXT,
+  uuid_array_column UUID[],
+  numeric_array_column NUMERIC(10, 2)[],
+  timestamptz_array_column TIMESTAMPTZ[],
+  int_array_column INT[][],
+  text_array_column TEXT[]
+);
+
+INSERT INTO test_arrays (name, uuid_array_column, numeric_array_column, timestamptz_array_column, int_array_column, text_array_column) VALUES
+  ('regular', ARRAY['58a7c845-af77-44b2-8664-7ca613d92f04']::uuid[], ARRAY[1.5, -2.25], ARRAY['2024-01-01 12:00:00.123456+00']::timestamptz[], ARRAY[1, 2, 3], ARRAY['one', 'two']),
+  ('null elements', ARRAY['58a7c845-af77-44b2-8664-7ca613d92f04', NULL]::uuid[], ARRAY[1.5, NULL], ARRAY['2024-01-01 07:00:00-05', NULL]::timestamptz[], ARRAY[1, NULL], ARRAY['NULL', NULL, 'a "b"']),
+  ('multi-dimensional', NULL, NULL, NULL, ARRAY[[1, 2], [3, 4]], ARRAY[['a', 'b'], ['c', 'd']]),
+  ('custom bounds', NULL, NULL, NULL, '[0:1]={7,8}', NULL),
+  ('empty', '{}', '{}', '{}', '{}', '{}'),
+  ('null', NULL, NULL, NULL, NULL, NULL);
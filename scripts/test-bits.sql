@@ -0,0 +1,18 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-bits.sql
+-- Sync and check that the values match the Postgres ::text output, including leading zeros, values longer than 64 bits, and NULLs:
+-- SELECT id, flags, mask, masks FROM test_bits ORDER BY id;
+
+DROP TABLE IF EXISTS test_bits;
+
+CREATE TABLE test_bits (
+    id SERIAL PRIMARY KEY,
+    flags BIT(8),
+    mask BIT VARYING,
+    masks BIT VARYING(4)[]
+);
+
+INSERT INTO test_bits (flags, mask, masks) VALUES
+  (B'00001111', B'1', ARRAY[B'1', B'0101']::varbit(4)[]),
+  (B'10000000', B'10011001100110011001100110011001100110011001100110011001100110011001100110011001', '{}'),
+  (B'00000000', B'', NULL),
+  (NULL, NULL, ARRAY[NULL, B'1']::varbit(4)[]);
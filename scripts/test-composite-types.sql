@@ -0,0 +1,23 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-composite-types.sql
+-- Sync and check that composite values are synced as JSON strings:
+-- SELECT id, address_column->>'city' AS city, array_address_column FROM test_composite_types;
+
+DROP TABLE IF EXISTS test_composite_types;
+DROP TYPE IF EXISTS address_type;
+
+CREATE TYPE address_type AS (
+    street TEXT,
+    city TEXT,
+    zip VARCHAR(10)
+);
+
+CREATE TABLE test_composite_types (
+    id SERIAL PRIMARY KEY,
+    address_column address_type,
+    array_address_column address_type[]
+);
+
+INSERT INTO test_composite_types (address_column, array_address_column) VALUES
+  (ROW('5th, Ave', 'New "York"', NULL)::address_type, ARRAY[ROW('Main St', 'NYC', '10001')::address_type, NULL]),
+  (ROW(NULL, NULL, NULL)::address_type, ARRAY[]::address_type[]),
+  (NULL, NULL);
@@ -0,0 +1,18 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-covering-keys.sql
+-- Sync and check that only "id" is synced as the primary key and only "email" as the unique key. "name" and "nickname" are
+-- stored in the indexes, but they aren't part of the keys, e.g. SELECT conname, conkey FROM pg_constraint WHERE contype IN ('p', 'u');
+
+DROP TABLE IF EXISTS test_covering_keys;
+
+CREATE TABLE test_covering_keys (
+  id INT NOT NULL,
+  name TEXT,
+  email TEXT NOT NULL,
+  nickname TEXT,
+  PRIMARY KEY (id) INCLUDE (name),
+  UNIQUE (email) INCLUDE (nickname)
+);
+
+INSERT INTO test_covering_keys (id, name, email, nickname) VALUES
+  (1, 'Alice', 'alice@example.com', NULL),
+  (2, 'Bob', 'bob@example.com', 'bobby');
@@ -0,0 +1,19 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-enums.sql
+-- Sync and check that enum values are synced as strings and enum labels are recorded in the Iceberg table properties:
+-- SELECT * FROM test_enums;
+
+DROP TABLE IF EXISTS test_enums;
+DROP TYPE IF EXISTS mood;
+
+CREATE TYPE mood AS ENUM ('very sad', 'okay', 'très content', '😀');
+
+CREATE TABLE test_enums (
+    id SERIAL PRIMARY KEY,
+    mood_column mood,
+    array_mood_column mood[]
+);
+
+INSERT INTO test_enums (mood_column, array_mood_column) VALUES
+  ('very sad', ARRAY['very sad', 'okay']::mood[]),
+  ('très content', ARRAY['😀']::mood[]),
+  (NULL, NULL);
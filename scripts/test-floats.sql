@@ -0,0 +1,22 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-floats.sql
+-- NaN and infinities must be kept and returned as in PostgreSQL, aggregations must not fail:
+-- SELECT name, float4_column, float8_column, float8_array_column FROM test_floats ORDER BY id;
+-- SELECT SUM(float8_column), AVG(float8_column), MIN(float4_column), MAX(float8_column) FROM test_floats;
+
+DROP TABLE IF EXISTS test_floats;
+
+CREATE TABLE test_floats (
+  id SERIAL PRIMARY KEY,
+  name TEXT,
+  float4_column REAL,
+  float8_column DOUBLE PRECISION,
+  float8_array_column DOUBLE PRECISION[]
+);
+
+INSERT INTO test_floats (name, float4_column, float8_column, float8_array_column) VALUES
+  ('nan', 'NaN', 'NaN', ARRAY['NaN'::float8]),
+  ('infinity', 'Infinity', 'Infinity', ARRAY['Infinity'::float8]),
+  ('-infinity', '-Infinity', '-Infinity', ARRAY['-Infinity'::float8]),
+  ('regular', 3.14, 3.141592653589793, ARRAY['NaN', 'Infinity', '-Infinity', 1.5]::float8[]),
+  ('negative', -1.5, -2.5, ARRAY[-2.5]::float8[]),
+  ('empty', NULL, NULL, NULL);
@@ -0,0 +1,16 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-generated-columns.sql
+-- Sync and check that values in "public"."test_generated_columns" are assigned to the right columns:
+-- SELECT * FROM test_generated_columns;
+
+DROP TABLE IF EXISTS test_generated_columns;
+
+CREATE TABLE test_generated_columns (
+    id INT GENERATED BY DEFAULT AS IDENTITY (START WITH 100 INCREMENT BY -3 MINVALUE -1000),
+    price NUMERIC(10, 2) NOT NULL,
+    price_with_tax NUMERIC(10, 2) GENERATED ALWAYS AS (price * 1.2) STORED,
+    name TEXT NOT NULL
+);
+
+INSERT INTO test_generated_columns (price, name) VALUES
+  (10, 'first'),
+  (20.5, 'second');
@@ -0,0 +1,24 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-infinite-timestamps.sql
+-- Infinite values must be clamped (or synced as NULL with PG_INFINITE_TIMESTAMP_FORMAT=NULL) and BC dates must be kept:
+-- SELECT name, timestamp_column, timestamptz_column, date_column FROM test_infinite_timestamps ORDER BY id;
+
+DROP TABLE IF EXISTS test_infinite_timestamps;
+
+CREATE TABLE test_infinite_timestamps (
+  id SERIAL PRIMARY KEY,
+  name TEXT,
+  timestamp_column TIMESTAMP,
+  timestamp_ms_column TIMESTAMP(3),
+  timestamp_4_column TIMESTAMP(4),
+  timestamptz_column TIMESTAMPTZ,
+  date_column DATE,
+  timestamp_array_column TIMESTAMP[]
+);
+
+INSERT INTO test_infinite_timestamps (name, timestamp_column, timestamp_ms_column, timestamp_4_column, timestamptz_column, date_column, timestamp_array_column) VALUES
+  ('infinity', 'infinity', 'infinity', 'infinity', 'infinity', 'infinity', ARRAY['infinity'::timestamp]),
+  ('-infinity', '-infinity', '-infinity', '-infinity', '-infinity', '-infinity', ARRAY['-infinity'::timestamp]),
+  ('bc', '0044-03-15 12:00:00.123456 BC', '0044-03-15 12:00:00.123 BC', '0044-03-15 12:00:00.1234 BC', '0044-03-15 12:00:00.123456+00 BC', '0044-03-15 BC', ARRAY['0044-03-15 BC'::timestamp]),
+  ('min', '4713-11-24 00:00:00 BC', '4713-11-24 00:00:00 BC', '4713-11-24 00:00:00 BC', '4713-11-24 00:00:00+00 BC', '4713-11-24 BC', NULL),
+  ('large_year', '10000-01-01 00:00:00', '10000-01-01 00:00:00', '10000-01-01 00:00:00.1234', '10000-01-01 00:00:00+00', '5874897-12-31', NULL),
+  ('empty', NULL, NULL, NULL, NULL, NULL, NULL);
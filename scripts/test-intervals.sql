@@ -0,0 +1,20 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-intervals.sql
+-- Sync with --pg-interval-format ISO8601 (or MICROSECONDS) and check that intervals can be compared and aggregated:
+-- SELECT name, duration FROM test_intervals WHERE duration > INTERVAL '1 day' ORDER BY duration;
+-- SELECT SUM(duration) FROM test_intervals;
+
+DROP TABLE IF EXISTS test_intervals;
+
+CREATE TABLE test_intervals (
+    id SERIAL PRIMARY KEY,
+    name TEXT,
+    duration INTERVAL,
+    durations INTERVAL[]
+);
+
+INSERT INTO test_intervals (name, duration, durations) VALUES
+  ('mixed units', '1 year 2 mons 3 days 04:05:06.5', ARRAY['1 day'::interval, '2 hours'::interval]),
+  ('negative', '-1 years -2 mons +3 days -04:05:06.5', NULL),
+  ('microseconds', '0.000001 seconds', '{}'),
+  ('hours over a day', '100 hours', NULL),
+  ('empty', NULL, NULL);
@@ -0,0 +1,30 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-large-objects.sql
+-- Sync with --pg-large-object-columns public.test_large_objects.content_oid --pg-large-object-max-size 1,
+-- the oversized and missing objects must be synced as NULL:
+-- SELECT name, octet_length(content_oid) FROM test_large_objects ORDER BY id;
+
+DO $$
+BEGIN
+  IF to_regclass('test_large_objects') IS NOT NULL THEN
+    PERFORM lo_unlink(content_oid) FROM test_large_objects WHERE EXISTS (
+      SELECT 1 FROM pg_largeobject_metadata WHERE pg_largeobject_metadata.oid = content_oid
+    );
+  END IF;
+END $$;
+DROP TABLE IF EXISTS test_large_objects;
+
+CREATE TABLE test_large_objects (
+  id SERIAL PRIMARY KEY,
+  name TEXT,
+  content_oid OID
+);
+
+INSERT INTO test_large_objects (name, content_oid) VALUES
+  ('small', lo_from_bytea(0, 'hello world'::bytea)),
+  ('empty', lo_from_bytea(0, ''::bytea)),
+  ('binary', lo_from_bytea(0, '\x000102ff'::bytea)),
+  ('oversized', lo_from_bytea(0, convert_to(repeat('x', 1024 * 1024 + 1), 'UTF8'))),
+  ('missing', lo_from_bytea(0, 'deleted'::bytea)),
+  ('null', NULL);
+
+SELECT lo_unlink(content_oid) FROM test_large_objects WHERE name = 'missing';
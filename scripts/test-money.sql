@@ -0,0 +1,21 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-money.sql
+-- Money values must be synced as decimals regardless of lc_monetary:
+-- SELECT name, amount FROM test_money ORDER BY amount;
+
+DROP TABLE IF EXISTS test_money;
+
+SET lc_monetary = 'C';
+
+CREATE TABLE test_money (
+  id SERIAL PRIMARY KEY,
+  name TEXT,
+  amount MONEY,
+  amounts MONEY[]
+);
+
+INSERT INTO test_money (name, amount, amounts) VALUES
+  ('positive', '1234.56', ARRAY['1.00'::money, '-2.50'::money]),
+  ('negative', '-1234.56', NULL),
+  ('max', '92233720368547758.07', '{}'),
+  ('min', '-92233720368547758.08', NULL),
+  ('empty', NULL, NULL);
@@ -0,0 +1,27 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-partition-hierarchies.sql
+-- Sync with --pg-merge-partitions and check that only "public"."test_measurements" is synced with rows from all partitions:
+-- SELECT region, COUNT(*) FROM test_measurements GROUP BY region;
+
+DROP TABLE IF EXISTS test_measurements;
+CREATE SCHEMA IF NOT EXISTS test_archive;
+
+CREATE TABLE test_measurements (
+    id SERIAL,
+    region TEXT NOT NULL,
+    measured_at TIMESTAMP NOT NULL
+) PARTITION BY RANGE (measured_at);
+
+-- Partition in another schema
+CREATE TABLE test_archive.test_measurements_2023 PARTITION OF test_measurements FOR VALUES FROM ('2023-01-01') TO ('2024-01-01');
+CREATE TABLE test_measurements_2024_h1 PARTITION OF test_measurements FOR VALUES FROM ('2024-01-01') TO ('2024-07-01');
+
+-- Sub-partitioned partition
+CREATE TABLE test_measurements_2024_h2 PARTITION OF test_measurements FOR VALUES FROM ('2024-07-01') TO ('2025-01-01') PARTITION BY LIST (region);
+CREATE TABLE test_measurements_2024_h2_eu PARTITION OF test_measurements_2024_h2 FOR VALUES IN ('eu');
+CREATE TABLE test_measurements_2024_h2_us PARTITION OF test_measurements_2024_h2 FOR VALUES IN ('us');
+
+INSERT INTO test_measurements (region, measured_at) VALUES
+  ('eu', '2023-05-01 10:00:00'),
+  ('us', '2024-03-15 12:00:00'),
+  ('eu', '2024-08-01 08:00:00'),
+  ('us', '2024-11-20 14:30:00');
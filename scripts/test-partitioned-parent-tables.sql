@@ -0,0 +1,19 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-partitioned-parent-tables.sql
+-- Sync with --pg-include-partitioned-tables and check that "public"."test_partitioned_table" contains rows from both partitions:
+-- SELECT region, COUNT(*) FROM test_partitioned_table GROUP BY region;
+-- The sync of this table is also covered by TestPartitionedParentTableSync in src/syncer_test.go
+
+DROP TABLE IF EXISTS test_partitioned_table;
+
+CREATE TABLE test_partitioned_table (
+    id SERIAL,
+    region TEXT NOT NULL
+) PARTITION BY LIST (region);
+
+CREATE TABLE test_partitioned_table_eu PARTITION OF test_partitioned_table FOR VALUES IN ('eu');
+CREATE TABLE test_partitioned_table_us PARTITION OF test_partitioned_table FOR VALUES IN ('us');
+
+INSERT INTO test_partitioned_table (region) VALUES
+  ('eu'),
+  ('eu'),
+  ('us');
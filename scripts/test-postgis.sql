@@ -0,0 +1,20 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-postgis.sql
+-- Sync and check that PostGIS values are synced in the configured format (WKT by default):
+-- SELECT * FROM test_postgis;
+
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+DROP TABLE IF EXISTS test_postgis;
+
+CREATE TABLE test_postgis (
+    id SERIAL PRIMARY KEY,
+    name TEXT,
+    geometry_column geometry(Geometry, 4326),
+    unconstrained_geometry_column geometry,
+    geography_column geography(Point)
+);
+
+INSERT INTO test_postgis (name, geometry_column, unconstrained_geometry_column, geography_column) VALUES
+  ('point', ST_GeomFromText('POINT(-71.060316 48.432044)', 4326), ST_GeomFromText('POINT(1 2)'), ST_GeogFromText('POINT(-71.060316 48.432044)')),
+  ('polygon', ST_GeomFromText('POLYGON((0 0, 0 1, 1 1, 1 0, 0 0))', 4326), ST_GeomFromText('POLYGON((0 0, 0 2, 2 2, 2 0, 0 0))'), NULL),
+  ('empty', NULL, NULL, NULL);
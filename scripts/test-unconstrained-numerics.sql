@@ -0,0 +1,22 @@
+-- Usage: psql postgres://127.0.0.1:5432/dbname -P pager=off -v ON_ERROR_STOP=on -f ./scripts/test-unconstrained-numerics.sql
+-- Numeric values without precision must be synced without losing digits (with PG_UNCONSTRAINED_NUMERIC_FORMAT=STRING for the "huge" row):
+-- SELECT name, amount FROM test_unconstrained_numerics ORDER BY id;
+
+DROP TABLE IF EXISTS test_unconstrained_numerics;
+
+CREATE TABLE test_unconstrained_numerics (
+  id SERIAL PRIMARY KEY,
+  name TEXT,
+  amount NUMERIC
+);
+
+INSERT INTO test_unconstrained_numerics (name, amount) VALUES
+  ('simple', 12345.67),
+  ('max_integer_digits', 99999999999999999999.999999999999999999),
+  ('rounded', 0.0000000000000000005),
+  ('scientific', 1.5E+19),
+  ('empty', NULL);
+
+-- Fails the sync with the default DECIMAL format, since it doesn't fit into decimal(38, 18)
+INSERT INTO test_unconstrained_numerics (name, amount) VALUES
+  ('huge', 12345678901234567890123456789012345678901234567890);
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	CATALOG_TYPE_GLUE   = "GLUE"
+	CATALOG_TYPE_HIVE   = "HIVE"
+	CATALOG_TYPE_NESSIE = "NESSIE"
+
+	// Marks catalog databases and tables created by BemiDB with their original Iceberg names, since catalogs lowercase names
+	CATALOG_PARAMETER_BEMIDB_SCHEMA = "bemidb.iceberg_schema"
+	CATALOG_PARAMETER_BEMIDB_TABLE  = "bemidb.iceberg_table"
+
+	CATALOG_PARAMETER_TABLE_TYPE        = "table_type"
+	CATALOG_PARAMETER_METADATA_LOCATION = "metadata_location"
+	CATALOG_TABLE_TYPE_ICEBERG          = "ICEBERG"
+	CATALOG_TABLE_TYPE_EXTERNAL         = "EXTERNAL_TABLE"
+)
+
+var CATALOG_TYPES = []string{CATALOG_TYPE_GLUE, CATALOG_TYPE_HIVE, CATALOG_TYPE_NESSIE}
+
+// Catalogs that lowercase database and table names (see CatalogSchemaTable)
+var LOWERCASING_CATALOG_NAMES = map[string]string{
+	CATALOG_TYPE_GLUE: "Glue",
+	CATALOG_TYPE_HIVE: "Hive Metastore",
+}
+
+// External catalog that Iceberg tables are registered in after they're written, so that other query engines can find them
+type Catalog interface {
+	UpsertTable(schemaTable IcebergSchemaTable, metadataPath string, icebergSchemaFields []IcebergSchemaField) (err error)
+	DeleteTable(schemaTable IcebergSchemaTable) (err error)
+	DeleteSchema(schema string) (err error)
+}
+
+// Catalog that can publish all tables committed during a sync at once, e.g., by committing them to a temporary branch.
+// BeginSync is called before the sync, and either CommitSync after it succeeds or AbortSync after it fails
+type SyncCatalog interface {
+	Catalog
+	BeginSync() (err error)
+	CommitSync() (err error)
+	AbortSync() (err error)
+}
+
+// Returns nil if no catalog is configured
+func NewCatalog(config *Config) Catalog {
+	switch config.CatalogType {
+	case CATALOG_TYPE_GLUE:
+		return NewGlueCatalog(config)
+	case CATALOG_TYPE_HIVE:
+		return NewHiveCatalog(config)
+	case CATALOG_TYPE_NESSIE:
+		return NewNessieCatalog(config)
+	}
+
+	return nil
+}
+
+// Glue and the Hive Metastore lowercase database and table names
+func CatalogSchemaTable(schemaTable IcebergSchemaTable) IcebergSchemaTable {
+	return IcebergSchemaTable{Schema: strings.ToLower(schemaTable.Schema), Table: strings.ToLower(schemaTable.Table)}
+}
+
+// The table location is the table directory that contains the metadata directory
+func CatalogTableLocation(metadataPath string) string {
+	if index := strings.LastIndex(metadataPath, "/metadata/"); index != -1 {
+		return metadataPath[:index]
+	}
+	return metadataPath
+}
+
+// Converts an Iceberg type into a Hive type that Glue and the Hive Metastore use for columns
+func HiveColumnType(icebergType interface{}) string {
+	switch icebergType := icebergType.(type) {
+	case map[string]interface{}:
+		if icebergType["type"] == "list" {
+			return "array<" + HiveColumnType(icebergType["element"]) + ">"
+		}
+	case string:
+		switch {
+		case icebergType == "long":
+			return "bigint"
+		case icebergType == "int", icebergType == "float", icebergType == "double", icebergType == "boolean", icebergType == "string", icebergType == "date", icebergType == "binary":
+			return icebergType
+		case strings.HasPrefix(icebergType, "timestamp"):
+			return "timestamp"
+		case strings.HasPrefix(icebergType, "decimal"):
+			return strings.ReplaceAll(icebergType, " ", "")
+		}
+	}
+
+	// E.g., time, uuid, and fixed
+	return "string"
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/glue"
+	"github.com/aws/aws-sdk-go-v2/service/glue/types"
+)
+
+type GlueClient interface {
+	GetDatabase(ctx context.Context, params *glue.GetDatabaseInput, optFns ...func(*glue.Options)) (*glue.GetDatabaseOutput, error)
+	CreateDatabase(ctx context.Context, params *glue.CreateDatabaseInput, optFns ...func(*glue.Options)) (*glue.CreateDatabaseOutput, error)
+	DeleteDatabase(ctx context.Context, params *glue.DeleteDatabaseInput, optFns ...func(*glue.Options)) (*glue.DeleteDatabaseOutput, error)
+	GetTable(ctx context.Context, params *glue.GetTableInput, optFns ...func(*glue.Options)) (*glue.GetTableOutput, error)
+	GetTables(ctx context.Context, params *glue.GetTablesInput, optFns ...func(*glue.Options)) (*glue.GetTablesOutput, error)
+	CreateTable(ctx context.Context, params *glue.CreateTableInput, optFns ...func(*glue.Options)) (*glue.CreateTableOutput, error)
+	UpdateTable(ctx context.Context, params *glue.UpdateTableInput, optFns ...func(*glue.Options)) (*glue.UpdateTableOutput, error)
+	DeleteTable(ctx context.Context, params *glue.DeleteTableInput, optFns ...func(*glue.Options)) (*glue.DeleteTableOutput, error)
+}
+
+// Registers Iceberg tables in the AWS Glue Data Catalog as Iceberg-format tables with a database per schema,
+// so that Athena and other engines using Glue can query them
+type GlueCatalog struct {
+	glueClient GlueClient
+	config     *Config
+}
+
+func NewGlueCatalog(config *Config) *GlueCatalog {
+	awsCredentials := credentials.NewStaticCredentialsProvider(
+		config.Aws.AccessKeyId,
+		config.Aws.SecretAccessKey,
+		"",
+	)
+
+	loadedAwsConfig, err := awsConfig.LoadDefaultConfig(
+		context.Background(),
+		awsConfig.WithRegion(config.Glue.Region),
+		awsConfig.WithCredentialsProvider(awsCredentials),
+	)
+	PanicIfError(err)
+
+	return &GlueCatalog{
+		glueClient: glue.NewFromConfig(loadedAwsConfig),
+		config:     config,
+	}
+}
+
+// Creates or updates the Glue table to point to the current metadata file. Fails if the Glue table name is already
+// taken by another Iceberg table whose name differs only in case, or by a table that wasn't created by BemiDB
+func (catalog *GlueCatalog) UpsertTable(schemaTable IcebergSchemaTable, metadataPath string, icebergSchemaFields []IcebergSchemaField) (err error) {
+	ctx := context.Background()
+	glueSchemaTable := CatalogSchemaTable(schemaTable)
+
+	err = catalog.createDatabaseIfNotExists(ctx, schemaTable.Schema)
+	if err != nil {
+		return err
+	}
+
+	tableInput := catalog.tableInput(schemaTable, metadataPath, icebergSchemaFields)
+	glueTable, err := catalog.table(ctx, glueSchemaTable)
+	if err != nil {
+		return err
+	}
+
+	if glueTable == nil {
+		LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Creating Glue table", glueSchemaTable.String(), "for", schemaTable.String())
+		_, err = catalog.glueClient.CreateTable(ctx, &glue.CreateTableInput{
+			CatalogId:    catalog.catalogId(),
+			DatabaseName: aws.String(glueSchemaTable.Schema),
+			TableInput:   tableInput,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create Glue table %s: %w", glueSchemaTable.String(), err)
+		}
+		return nil
+	}
+
+	if glueTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE] != schemaTable.String() {
+		return catalog.collisionError(glueSchemaTable, glueTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE], schemaTable)
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Updating Glue table", glueSchemaTable.String(), "for", schemaTable.String())
+	_, err = catalog.glueClient.UpdateTable(ctx, &glue.UpdateTableInput{
+		CatalogId:    catalog.catalogId(),
+		DatabaseName: aws.String(glueSchemaTable.Schema),
+		TableInput:   tableInput,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update Glue table %s: %w", glueSchemaTable.String(), err)
+	}
+	return nil
+}
+
+// Deletes the Glue table unless it doesn't exist or belongs to another table
+func (catalog *GlueCatalog) DeleteTable(schemaTable IcebergSchemaTable) (err error) {
+	ctx := context.Background()
+	glueSchemaTable := CatalogSchemaTable(schemaTable)
+
+	glueTable, err := catalog.table(ctx, glueSchemaTable)
+	if err != nil || glueTable == nil || glueTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE] != schemaTable.String() {
+		return err
+	}
+
+	return catalog.deleteTable(ctx, glueSchemaTable)
+}
+
+// Deletes the Glue tables of the schema, and the Glue database if it was created by BemiDB for the schema and is empty
+func (catalog *GlueCatalog) DeleteSchema(schema string) (err error) {
+	ctx := context.Background()
+	glueDatabaseName := strings.ToLower(schema)
+
+	glueDatabase, err := catalog.database(ctx, glueDatabaseName)
+	if err != nil || glueDatabase == nil {
+		return err
+	}
+
+	remainingTableCount := 0
+	paginator := glue.NewGetTablesPaginator(catalog.glueClient, &glue.GetTablesInput{
+		CatalogId:    catalog.catalogId(),
+		DatabaseName: aws.String(glueDatabaseName),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list Glue tables in %s: %w", glueDatabaseName, err)
+		}
+
+		for _, glueTable := range output.TableList {
+			bemidbTable := glueTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE]
+			if !strings.HasPrefix(bemidbTable, QuoteIdentifier(schema)+".") {
+				remainingTableCount++
+				continue
+			}
+
+			err = catalog.deleteTable(ctx, IcebergSchemaTable{Schema: glueDatabaseName, Table: aws.ToString(glueTable.Name)})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if glueDatabase.Parameters[CATALOG_PARAMETER_BEMIDB_SCHEMA] != schema || remainingTableCount > 0 {
+		return nil
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Deleting Glue database", glueDatabaseName)
+	_, err = catalog.glueClient.DeleteDatabase(ctx, &glue.DeleteDatabaseInput{
+		CatalogId: catalog.catalogId(),
+		Name:      aws.String(glueDatabaseName),
+	})
+	if err != nil && !isGlueEntityNotFound(err) {
+		return fmt.Errorf("failed to delete Glue database %s: %w", glueDatabaseName, err)
+	}
+	return nil
+}
+
+func (catalog *GlueCatalog) createDatabaseIfNotExists(ctx context.Context, schema string) error {
+	glueDatabaseName := strings.ToLower(schema)
+	glueDatabase, err := catalog.database(ctx, glueDatabaseName)
+	if err != nil {
+		return err
+	}
+
+	if glueDatabase != nil {
+		bemidbSchema := glueDatabase.Parameters[CATALOG_PARAMETER_BEMIDB_SCHEMA]
+		if bemidbSchema != "" && bemidbSchema != schema {
+			return fmt.Errorf("Iceberg schemas %s and %s are both mapped to Glue database %s, since Glue lowercases names", QuoteIdentifier(bemidbSchema), QuoteIdentifier(schema), glueDatabaseName)
+		}
+		return nil
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Creating Glue database", glueDatabaseName)
+	_, err = catalog.glueClient.CreateDatabase(ctx, &glue.CreateDatabaseInput{
+		CatalogId: catalog.catalogId(),
+		DatabaseInput: &types.DatabaseInput{
+			Name:        aws.String(glueDatabaseName),
+			Description: aws.String("Iceberg tables of the " + QuoteIdentifier(schema) + " schema synced by BemiDB"),
+			Parameters:  map[string]string{CATALOG_PARAMETER_BEMIDB_SCHEMA: schema},
+		},
+	})
+	var alreadyExistsError *types.AlreadyExistsException
+	if err != nil && !errors.As(err, &alreadyExistsError) {
+		return fmt.Errorf("failed to create Glue database %s: %w", glueDatabaseName, err)
+	}
+	return nil
+}
+
+// Returns nil if the database doesn't exist
+func (catalog *GlueCatalog) database(ctx context.Context, glueDatabaseName string) (*types.Database, error) {
+	output, err := catalog.glueClient.GetDatabase(ctx, &glue.GetDatabaseInput{
+		CatalogId: catalog.catalogId(),
+		Name:      aws.String(glueDatabaseName),
+	})
+	if err != nil {
+		if isGlueEntityNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Glue database %s: %w", glueDatabaseName, err)
+	}
+
+	return output.Database, nil
+}
+
+// Returns nil if the table doesn't exist
+func (catalog *GlueCatalog) table(ctx context.Context, glueSchemaTable IcebergSchemaTable) (*types.Table, error) {
+	output, err := catalog.glueClient.GetTable(ctx, &glue.GetTableInput{
+		CatalogId:    catalog.catalogId(),
+		DatabaseName: aws.String(glueSchemaTable.Schema),
+		Name:         aws.String(glueSchemaTable.Table),
+	})
+	if err != nil {
+		if isGlueEntityNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Glue table %s: %w", glueSchemaTable.String(), err)
+	}
+
+	return output.Table, nil
+}
+
+func (catalog *GlueCatalog) deleteTable(ctx context.Context, glueSchemaTable IcebergSchemaTable) error {
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Deleting Glue table", glueSchemaTable.String())
+	_, err := catalog.glueClient.DeleteTable(ctx, &glue.DeleteTableInput{
+		CatalogId:    catalog.catalogId(),
+		DatabaseName: aws.String(glueSchemaTable.Schema),
+		Name:         aws.String(glueSchemaTable.Table),
+	})
+	if err != nil && !isGlueEntityNotFound(err) {
+		return fmt.Errorf("failed to delete Glue table %s: %w", glueSchemaTable.String(), err)
+	}
+	return nil
+}
+
+func (catalog *GlueCatalog) collisionError(glueSchemaTable IcebergSchemaTable, bemidbTable string, schemaTable IcebergSchemaTable) error {
+	if bemidbTable == "" {
+		return fmt.Errorf("Glue table %s for %s already exists and wasn't created by BemiDB", glueSchemaTable.String(), schemaTable.String())
+	}
+	return fmt.Errorf("Iceberg tables %s and %s are both mapped to Glue table %s, since Glue lowercases names", bemidbTable, schemaTable.String(), glueSchemaTable.String())
+}
+
+func (catalog *GlueCatalog) tableInput(schemaTable IcebergSchemaTable, metadataPath string, icebergSchemaFields []IcebergSchemaField) *types.TableInput {
+	columns := make([]types.Column, len(icebergSchemaFields))
+	for i, icebergSchemaField := range icebergSchemaFields {
+		columns[i] = types.Column{
+			Name: aws.String(strings.ToLower(icebergSchemaField.Name)),
+			Type: aws.String(HiveColumnType(icebergSchemaField.Type)),
+			Parameters: map[string]string{
+				"iceberg.field.id":       IntToString(icebergSchemaField.Id),
+				"iceberg.field.optional": fmt.Sprint(!icebergSchemaField.Required),
+				"iceberg.field.current":  "true",
+			},
+		}
+	}
+
+	return &types.TableInput{
+		Name:      aws.String(CatalogSchemaTable(schemaTable).Table),
+		TableType: aws.String(CATALOG_TABLE_TYPE_EXTERNAL),
+		Parameters: map[string]string{
+			CATALOG_PARAMETER_TABLE_TYPE:        CATALOG_TABLE_TYPE_ICEBERG,
+			CATALOG_PARAMETER_METADATA_LOCATION: metadataPath,
+			CATALOG_PARAMETER_BEMIDB_TABLE:      schemaTable.String(),
+		},
+		StorageDescriptor: &types.StorageDescriptor{
+			Location: aws.String(CatalogTableLocation(metadataPath)),
+			Columns:  columns,
+		},
+	}
+}
+
+func (catalog *GlueCatalog) catalogId() *string {
+	if catalog.config.Glue.CatalogId == "" {
+		return nil
+	}
+	return aws.String(catalog.config.Glue.CatalogId)
+}
+
+func isGlueEntityNotFound(err error) bool {
+	var entityNotFoundError *types.EntityNotFoundException
+	return errors.As(err, &entityNotFoundError)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/glue"
+	"github.com/aws/aws-sdk-go-v2/service/glue/types"
+)
+
+type FakeGlueClient struct {
+	databases map[string]*types.Database
+	tables    map[IcebergSchemaTable]*types.Table
+}
+
+func NewFakeGlueClient() *FakeGlueClient {
+	return &FakeGlueClient{databases: make(map[string]*types.Database), tables: make(map[IcebergSchemaTable]*types.Table)}
+}
+
+func (client *FakeGlueClient) GetDatabase(ctx context.Context, params *glue.GetDatabaseInput, optFns ...func(*glue.Options)) (*glue.GetDatabaseOutput, error) {
+	database, ok := client.databases[*params.Name]
+	if !ok {
+		return nil, &types.EntityNotFoundException{}
+	}
+	return &glue.GetDatabaseOutput{Database: database}, nil
+}
+
+func (client *FakeGlueClient) CreateDatabase(ctx context.Context, params *glue.CreateDatabaseInput, optFns ...func(*glue.Options)) (*glue.CreateDatabaseOutput, error) {
+	client.databases[*params.DatabaseInput.Name] = &types.Database{Name: params.DatabaseInput.Name, Parameters: params.DatabaseInput.Parameters}
+	return &glue.CreateDatabaseOutput{}, nil
+}
+
+func (client *FakeGlueClient) DeleteDatabase(ctx context.Context, params *glue.DeleteDatabaseInput, optFns ...func(*glue.Options)) (*glue.DeleteDatabaseOutput, error) {
+	delete(client.databases, *params.Name)
+	return &glue.DeleteDatabaseOutput{}, nil
+}
+
+func (client *FakeGlueClient) GetTable(ctx context.Context, params *glue.GetTableInput, optFns ...func(*glue.Options)) (*glue.GetTableOutput, error) {
+	table, ok := client.tables[IcebergSchemaTable{Schema: *params.DatabaseName, Table: *params.Name}]
+	if !ok {
+		return nil, &types.EntityNotFoundException{}
+	}
+	return &glue.GetTableOutput{Table: table}, nil
+}
+
+func (client *FakeGlueClient) GetTables(ctx context.Context, params *glue.GetTablesInput, optFns ...func(*glue.Options)) (*glue.GetTablesOutput, error) {
+	output := &glue.GetTablesOutput{}
+	for schemaTable, table := range client.tables {
+		if schemaTable.Schema == *params.DatabaseName {
+			output.TableList = append(output.TableList, *table)
+		}
+	}
+	return output, nil
+}
+
+func (client *FakeGlueClient) CreateTable(ctx context.Context, params *glue.CreateTableInput, optFns ...func(*glue.Options)) (*glue.CreateTableOutput, error) {
+	client.tables[IcebergSchemaTable{Schema: *params.DatabaseName, Table: *params.TableInput.Name}] = client.table(params.DatabaseName, params.TableInput)
+	return &glue.CreateTableOutput{}, nil
+}
+
+func (client *FakeGlueClient) UpdateTable(ctx context.Context, params *glue.UpdateTableInput, optFns ...func(*glue.Options)) (*glue.UpdateTableOutput, error) {
+	client.tables[IcebergSchemaTable{Schema: *params.DatabaseName, Table: *params.TableInput.Name}] = client.table(params.DatabaseName, params.TableInput)
+	return &glue.UpdateTableOutput{}, nil
+}
+
+func (client *FakeGlueClient) DeleteTable(ctx context.Context, params *glue.DeleteTableInput, optFns ...func(*glue.Options)) (*glue.DeleteTableOutput, error) {
+	delete(client.tables, IcebergSchemaTable{Schema: *params.DatabaseName, Table: *params.Name})
+	return &glue.DeleteTableOutput{}, nil
+}
+
+func (client *FakeGlueClient) table(databaseName *string, tableInput *types.TableInput) *types.Table {
+	return &types.Table{
+		DatabaseName:      databaseName,
+		Name:              tableInput.Name,
+		TableType:         tableInput.TableType,
+		Parameters:        tableInput.Parameters,
+		StorageDescriptor: tableInput.StorageDescriptor,
+	}
+}
+
+func TestGlueCatalog(t *testing.T) {
+	icebergSchemaFields := []IcebergSchemaField{
+		{Id: 1, Name: "id", Type: "long", Required: true},
+		{Id: 2, Name: "Name", Type: "string"},
+		{Id: 3, Name: "tags", Type: map[string]interface{}{"type": "list", "element": "string", "element-id": 3, "element-required": false}},
+	}
+	newCatalog := func() (*GlueCatalog, *FakeGlueClient) {
+		glueClient := NewFakeGlueClient()
+		return &GlueCatalog{glueClient: glueClient, config: &Config{LogLevel: LOG_LEVEL_ERROR}}, glueClient
+	}
+
+	t.Run("Creates a database and an Iceberg table", func(t *testing.T) {
+		catalog, glueClient := newCatalog()
+
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "Public", Table: "Users"}, "s3://bucket/iceberg/Public/Users/metadata/v1.metadata.json", icebergSchemaFields)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		database := glueClient.databases["public"]
+		if database == nil || database.Parameters[CATALOG_PARAMETER_BEMIDB_SCHEMA] != "Public" {
+			t.Fatalf("Expected the public database to be created for the Public schema, got %v", database)
+		}
+		table := glueClient.tables[IcebergSchemaTable{Schema: "public", Table: "users"}]
+		if table == nil {
+			t.Fatalf("Expected the public.users table to be created")
+		}
+		if table.Parameters[CATALOG_PARAMETER_TABLE_TYPE] != "ICEBERG" {
+			t.Errorf("Expected the table type to be ICEBERG, got %s", table.Parameters[CATALOG_PARAMETER_TABLE_TYPE])
+		}
+		if table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION] != "s3://bucket/iceberg/Public/Users/metadata/v1.metadata.json" {
+			t.Errorf("Expected the metadata location to be the metadata file, got %s", table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION])
+		}
+		if aws.ToString(table.StorageDescriptor.Location) != "s3://bucket/iceberg/Public/Users" {
+			t.Errorf("Expected the location to be the table directory, got %s", aws.ToString(table.StorageDescriptor.Location))
+		}
+		columns := []string{}
+		for _, column := range table.StorageDescriptor.Columns {
+			columns = append(columns, aws.ToString(column.Name)+" "+aws.ToString(column.Type))
+		}
+		if strings.Join(columns, ", ") != "id bigint, name string, tags array<string>" {
+			t.Errorf("Expected the columns to be 'id bigint, name string, tags array<string>', got '%s'", strings.Join(columns, ", "))
+		}
+		if table.StorageDescriptor.Columns[0].Parameters["iceberg.field.optional"] != "false" {
+			t.Errorf("Expected the id column not to be optional, got %s", table.StorageDescriptor.Columns[0].Parameters["iceberg.field.optional"])
+		}
+	})
+
+	t.Run("Updates the metadata location of an existing table", func(t *testing.T) {
+		catalog, glueClient := newCatalog()
+		schemaTable := IcebergSchemaTable{Schema: "public", Table: "users"}
+
+		err := catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields[:1])
+		PanicIfError(err)
+		err = catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v2.metadata.json", icebergSchemaFields)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		table := glueClient.tables[schemaTable]
+		if table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION] != "s3://bucket/iceberg/public/users/metadata/v2.metadata.json" {
+			t.Errorf("Expected the metadata location to be updated, got %s", table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION])
+		}
+		if len(table.StorageDescriptor.Columns) != 3 {
+			t.Errorf("Expected 3 columns, got %d", len(table.StorageDescriptor.Columns))
+		}
+	})
+
+	t.Run("Returns an error for tables whose names differ only in case", func(t *testing.T) {
+		catalog, _ := newCatalog()
+
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		err = catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "Users"}, "s3://bucket/iceberg/public/Users/metadata/v1.metadata.json", icebergSchemaFields)
+
+		expected := `Iceberg tables "public"."users" and "public"."Users" are both mapped to Glue table "public"."users", since Glue lowercases names`
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %s, got %v", expected, err)
+		}
+	})
+
+	t.Run("Returns an error for schemas whose names differ only in case", func(t *testing.T) {
+		catalog, _ := newCatalog()
+
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		err = catalog.UpsertTable(IcebergSchemaTable{Schema: "Public", Table: "orders"}, "s3://bucket/iceberg/Public/orders/metadata/v1.metadata.json", icebergSchemaFields)
+
+		expected := `Iceberg schemas "public" and "Public" are both mapped to Glue database public, since Glue lowercases names`
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %s, got %v", expected, err)
+		}
+	})
+
+	t.Run("Returns an error for existing tables not created by BemiDB", func(t *testing.T) {
+		catalog, glueClient := newCatalog()
+		glueClient.tables[IcebergSchemaTable{Schema: "public", Table: "users"}] = &types.Table{Name: aws.String("users")}
+
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+
+		expected := `Glue table "public"."users" for "public"."users" already exists and wasn't created by BemiDB`
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %s, got %v", expected, err)
+		}
+	})
+
+	t.Run("Deletes tables", func(t *testing.T) {
+		catalog, glueClient := newCatalog()
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "Users"}, "s3://bucket/iceberg/public/Users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+
+		err = catalog.DeleteTable(IcebergSchemaTable{Schema: "public", Table: "users"})
+		PanicIfError(err)
+		if len(glueClient.tables) != 1 {
+			t.Errorf("Expected the table of another Iceberg table not to be deleted")
+		}
+
+		err = catalog.DeleteTable(IcebergSchemaTable{Schema: "public", Table: "Users"})
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if len(glueClient.tables) != 0 {
+			t.Errorf("Expected the table to be deleted, got %d tables", len(glueClient.tables))
+		}
+
+		err = catalog.DeleteTable(IcebergSchemaTable{Schema: "public", Table: "Users"})
+		if err != nil {
+			t.Errorf("Expected no error for a missing table, got %v", err)
+		}
+	})
+
+	t.Run("Deletes schemas", func(t *testing.T) {
+		catalog, glueClient := newCatalog()
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		err = catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "orders"}, "s3://bucket/iceberg/public/orders/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+
+		err = catalog.DeleteSchema("public")
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if len(glueClient.tables) != 0 || len(glueClient.databases) != 0 {
+			t.Errorf("Expected the tables and the database to be deleted, got %d tables and %d databases", len(glueClient.tables), len(glueClient.databases))
+		}
+
+		err = catalog.DeleteSchema("public")
+		if err != nil {
+			t.Errorf("Expected no error for a missing database, got %v", err)
+		}
+	})
+
+	t.Run("Keeps databases with other tables when deleting schemas", func(t *testing.T) {
+		catalog, glueClient := newCatalog()
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		glueClient.tables[IcebergSchemaTable{Schema: "public", Table: "events"}] = &types.Table{Name: aws.String("events")}
+
+		err = catalog.DeleteSchema("public")
+		PanicIfError(err)
+		if len(glueClient.tables) != 1 || glueClient.databases["public"] == nil {
+			t.Errorf("Expected only the BemiDB table to be deleted, got %d tables and %d databases", len(glueClient.tables), len(glueClient.databases))
+		}
+	})
+}
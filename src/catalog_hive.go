@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/beltran/gohive/hive_metastore"
+	krb5Client "github.com/jcmturner/gokrb5/v8/client"
+)
+
+const (
+	HIVE_METASTORE_TIMEOUT     = 30 * time.Second
+	HIVE_METASTORE_BUFFER_SIZE = 4096
+
+	// Makes the Hive Metastore fail the alter if another writer has changed the metadata location in the meantime
+	HIVE_PARAMETER_EXPECTED_KEY               = "expected_parameter_key"
+	HIVE_PARAMETER_EXPECTED_VALUE             = "expected_parameter_value"
+	HIVE_PARAMETER_PREVIOUS_METADATA_LOCATION = "previous_metadata_location"
+	HIVE_PARAMETER_EXTERNAL                   = "EXTERNAL"
+
+	// Used by Iceberg for tables that aren't readable by Hive itself
+	HIVE_INPUT_FORMAT      = "org.apache.hadoop.mapred.FileInputFormat"
+	HIVE_OUTPUT_FORMAT     = "org.apache.hadoop.mapred.FileOutputFormat"
+	HIVE_SERIALIZATION_LIB = "org.apache.hadoop.hive.serde2.lazy.LazySimpleSerDe"
+	HIVE_TABLE_OWNER       = "bemidb"
+)
+
+type HiveMetastoreClient interface {
+	GetDatabase(ctx context.Context, name string) (*hive_metastore.Database, error)
+	CreateDatabase(ctx context.Context, database *hive_metastore.Database) error
+	DropDatabase(ctx context.Context, name string, deleteData bool, cascade bool) error
+	GetAllTables(ctx context.Context, dbName string) ([]string, error)
+	GetTable(ctx context.Context, dbName string, tableName string) (*hive_metastore.Table, error)
+	GetTableObjectsByName(ctx context.Context, dbName string, tableNames []string) ([]*hive_metastore.Table, error)
+	CreateTable(ctx context.Context, table *hive_metastore.Table) error
+	AlterTableWithEnvironmentContext(ctx context.Context, dbName string, tableName string, newTable *hive_metastore.Table, environmentContext *hive_metastore.EnvironmentContext) error
+	DropTable(ctx context.Context, dbName string, tableName string, deleteData bool) error
+	Close() error
+}
+
+// Registers Iceberg tables in the Hive Metastore as Iceberg-format tables with a database per schema,
+// so that Trino, Spark, and other engines using the Hive Metastore can query them.
+// Connects over Thrift for each operation, authenticating with Kerberos (SASL GSSAPI) if enabled
+type HiveCatalog struct {
+	newClient  func() (HiveMetastoreClient, error)
+	krb5Client *krb5Client.Client // logged in on the first connection
+	config     *Config
+}
+
+type hiveMetastoreConnection struct {
+	*hive_metastore.ThriftHiveMetastoreClient
+	transport thrift.TTransport
+}
+
+func (connection *hiveMetastoreConnection) Close() error {
+	return connection.transport.Close()
+}
+
+func NewHiveCatalog(config *Config) *HiveCatalog {
+	catalog := &HiveCatalog{config: config}
+	catalog.newClient = catalog.connect
+	return catalog
+}
+
+// Creates the table to point to the current metadata file, or alters it if it still points to the metadata file
+// that BemiDB wrote, so that commits by other writers aren't overwritten. Fails if the table name is already taken
+// by another Iceberg table whose name differs only in case, or by a table that wasn't created by BemiDB
+func (catalog *HiveCatalog) UpsertTable(schemaTable IcebergSchemaTable, metadataPath string, icebergSchemaFields []IcebergSchemaField) (err error) {
+	ctx := context.Background()
+	hiveSchemaTable := CatalogSchemaTable(schemaTable)
+
+	client, err := catalog.newClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	err = catalog.createDatabaseIfNotExists(ctx, client, schemaTable.Schema, metadataPath)
+	if err != nil {
+		return err
+	}
+
+	newHiveTable := catalog.hiveTable(schemaTable, metadataPath, icebergSchemaFields)
+	hiveTable, err := catalog.table(ctx, client, hiveSchemaTable)
+	if err != nil {
+		return err
+	}
+
+	if hiveTable == nil {
+		LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Creating Hive Metastore table", hiveSchemaTable.String(), "for", schemaTable.String())
+		err = client.CreateTable(ctx, newHiveTable)
+		if err != nil {
+			return fmt.Errorf("failed to create Hive Metastore table %s: %w", hiveSchemaTable.String(), err)
+		}
+		return nil
+	}
+
+	if hiveTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE] != schemaTable.String() {
+		return catalog.collisionError(hiveSchemaTable, hiveTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE], schemaTable)
+	}
+
+	previousMetadataPath := hiveTable.Parameters[CATALOG_PARAMETER_METADATA_LOCATION]
+	if !catalog.isPreviousMetadataPath(previousMetadataPath, metadataPath) {
+		return fmt.Errorf("Hive Metastore table %s points to %s instead of %s, another writer may have committed to it", hiveSchemaTable.String(), previousMetadataPath, metadataPath)
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Altering Hive Metastore table", hiveSchemaTable.String(), "for", schemaTable.String())
+	newHiveTable.CreateTime = hiveTable.CreateTime
+	newHiveTable.Parameters[HIVE_PARAMETER_PREVIOUS_METADATA_LOCATION] = previousMetadataPath
+	err = client.AlterTableWithEnvironmentContext(ctx, hiveSchemaTable.Schema, hiveSchemaTable.Table, newHiveTable, &hive_metastore.EnvironmentContext{
+		Properties: map[string]string{
+			HIVE_PARAMETER_EXPECTED_KEY:   CATALOG_PARAMETER_METADATA_LOCATION,
+			HIVE_PARAMETER_EXPECTED_VALUE: previousMetadataPath,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to alter Hive Metastore table %s: %w", hiveSchemaTable.String(), err)
+	}
+	return nil
+}
+
+// Each commit writes the next numbered metadata file, so the table points to the same or an earlier version of the table
+func (catalog *HiveCatalog) isPreviousMetadataPath(previousMetadataPath string, metadataPath string) bool {
+	if previousMetadataPath == metadataPath {
+		return true
+	}
+	if previousMetadataPath[:strings.LastIndex(previousMetadataPath, "/")+1] != metadataPath[:strings.LastIndex(metadataPath, "/")+1] {
+		return false
+	}
+	previousVersion, isPreviousNumbered := IcebergMetadataFileVersion(previousMetadataPath)
+	version, isNumbered := IcebergMetadataFileVersion(metadataPath)
+	return isPreviousNumbered && isNumbered && previousVersion < version
+}
+
+// Drops the table without its data unless it doesn't exist or belongs to another table
+func (catalog *HiveCatalog) DeleteTable(schemaTable IcebergSchemaTable) (err error) {
+	ctx := context.Background()
+	hiveSchemaTable := CatalogSchemaTable(schemaTable)
+
+	client, err := catalog.newClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	hiveTable, err := catalog.table(ctx, client, hiveSchemaTable)
+	if err != nil || hiveTable == nil || hiveTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE] != schemaTable.String() {
+		return err
+	}
+
+	return catalog.dropTable(ctx, client, hiveSchemaTable)
+}
+
+// Drops the tables of the schema, and the database if it was created by BemiDB for the schema and is empty
+func (catalog *HiveCatalog) DeleteSchema(schema string) (err error) {
+	ctx := context.Background()
+	hiveDatabaseName := strings.ToLower(schema)
+
+	client, err := catalog.newClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	hiveDatabase, err := catalog.database(ctx, client, hiveDatabaseName)
+	if err != nil || hiveDatabase == nil {
+		return err
+	}
+
+	tableNames, err := client.GetAllTables(ctx, hiveDatabaseName)
+	if err != nil {
+		return fmt.Errorf("failed to list Hive Metastore tables in %s: %w", hiveDatabaseName, err)
+	}
+	hiveTables, err := client.GetTableObjectsByName(ctx, hiveDatabaseName, tableNames)
+	if err != nil {
+		return fmt.Errorf("failed to get Hive Metastore tables in %s: %w", hiveDatabaseName, err)
+	}
+
+	remainingTableCount := 0
+	for _, hiveTable := range hiveTables {
+		bemidbTable := hiveTable.Parameters[CATALOG_PARAMETER_BEMIDB_TABLE]
+		if !strings.HasPrefix(bemidbTable, QuoteIdentifier(schema)+".") {
+			remainingTableCount++
+			continue
+		}
+
+		err = catalog.dropTable(ctx, client, IcebergSchemaTable{Schema: hiveDatabaseName, Table: hiveTable.TableName})
+		if err != nil {
+			return err
+		}
+	}
+
+	if hiveDatabase.Parameters[CATALOG_PARAMETER_BEMIDB_SCHEMA] != schema || remainingTableCount > 0 {
+		return nil
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Dropping Hive Metastore database", hiveDatabaseName)
+	err = client.DropDatabase(ctx, hiveDatabaseName, false, false)
+	if err != nil && !isHiveNoSuchObject(err) {
+		return fmt.Errorf("failed to drop Hive Metastore database %s: %w", hiveDatabaseName, err)
+	}
+	return nil
+}
+
+func (catalog *HiveCatalog) connect() (HiveMetastoreClient, error) {
+	address := net.JoinHostPort(catalog.config.Hive.MetastoreHost, catalog.config.Hive.MetastorePort)
+	socket := thrift.NewTSocketConf(address, &thrift.TConfiguration{
+		ConnectTimeout: HIVE_METASTORE_TIMEOUT,
+		SocketTimeout:  HIVE_METASTORE_TIMEOUT,
+	})
+
+	var transport thrift.TTransport = thrift.NewTBufferedTransport(socket, HIVE_METASTORE_BUFFER_SIZE)
+	if catalog.config.Hive.Kerberos {
+		if catalog.krb5Client == nil {
+			client, err := NewKrb5Client(catalog.config.Hive.KerberosKeytab, catalog.config.Hive.KerberosPrincipal)
+			if err != nil {
+				return nil, err
+			}
+			catalog.krb5Client = client
+		}
+		spn := catalog.config.Hive.KerberosServiceName + "/" + catalog.config.Hive.MetastoreHost
+		transport = NewHiveSaslTransport(transport, catalog.krb5Client, spn)
+	}
+
+	err := transport.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the Hive Metastore at %s: %w", address, err)
+	}
+
+	protocolFactory := thrift.NewTBinaryProtocolFactoryConf(nil)
+	thriftClient := thrift.NewTStandardClient(protocolFactory.GetProtocol(transport), protocolFactory.GetProtocol(transport))
+	return &hiveMetastoreConnection{
+		ThriftHiveMetastoreClient: hive_metastore.NewThriftHiveMetastoreClient(thriftClient),
+		transport:                 transport,
+	}, nil
+}
+
+func (catalog *HiveCatalog) createDatabaseIfNotExists(ctx context.Context, client HiveMetastoreClient, schema string, metadataPath string) error {
+	hiveDatabaseName := strings.ToLower(schema)
+	hiveDatabase, err := catalog.database(ctx, client, hiveDatabaseName)
+	if err != nil {
+		return err
+	}
+
+	if hiveDatabase != nil {
+		bemidbSchema := hiveDatabase.Parameters[CATALOG_PARAMETER_BEMIDB_SCHEMA]
+		if bemidbSchema != "" && bemidbSchema != schema {
+			return fmt.Errorf("Iceberg schemas %s and %s are both mapped to Hive Metastore database %s, since the Hive Metastore lowercases names", QuoteIdentifier(bemidbSchema), QuoteIdentifier(schema), hiveDatabaseName)
+		}
+		return nil
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Creating Hive Metastore database", hiveDatabaseName)
+	err = client.CreateDatabase(ctx, &hive_metastore.Database{
+		Name:        hiveDatabaseName,
+		Description: "Iceberg tables of the " + QuoteIdentifier(schema) + " schema synced by BemiDB",
+		LocationUri: catalog.databaseLocation(metadataPath),
+		Parameters:  map[string]string{CATALOG_PARAMETER_BEMIDB_SCHEMA: schema},
+	})
+	var alreadyExistsError *hive_metastore.AlreadyExistsException
+	if err != nil && !errors.As(err, &alreadyExistsError) {
+		return fmt.Errorf("failed to create Hive Metastore database %s: %w", hiveDatabaseName, err)
+	}
+	return nil
+}
+
+// Returns nil if the database doesn't exist
+func (catalog *HiveCatalog) database(ctx context.Context, client HiveMetastoreClient, hiveDatabaseName string) (*hive_metastore.Database, error) {
+	hiveDatabase, err := client.GetDatabase(ctx, hiveDatabaseName)
+	if err != nil {
+		if isHiveNoSuchObject(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Hive Metastore database %s: %w", hiveDatabaseName, err)
+	}
+
+	return hiveDatabase, nil
+}
+
+// Returns nil if the table doesn't exist
+func (catalog *HiveCatalog) table(ctx context.Context, client HiveMetastoreClient, hiveSchemaTable IcebergSchemaTable) (*hive_metastore.Table, error) {
+	hiveTable, err := client.GetTable(ctx, hiveSchemaTable.Schema, hiveSchemaTable.Table)
+	if err != nil {
+		if isHiveNoSuchObject(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Hive Metastore table %s: %w", hiveSchemaTable.String(), err)
+	}
+
+	return hiveTable, nil
+}
+
+// Keeps the data, since it's deleted from the storage separately
+func (catalog *HiveCatalog) dropTable(ctx context.Context, client HiveMetastoreClient, hiveSchemaTable IcebergSchemaTable) error {
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Dropping Hive Metastore table", hiveSchemaTable.String())
+	err := client.DropTable(ctx, hiveSchemaTable.Schema, hiveSchemaTable.Table, false)
+	if err != nil && !isHiveNoSuchObject(err) {
+		return fmt.Errorf("failed to drop Hive Metastore table %s: %w", hiveSchemaTable.String(), err)
+	}
+	return nil
+}
+
+func (catalog *HiveCatalog) collisionError(hiveSchemaTable IcebergSchemaTable, bemidbTable string, schemaTable IcebergSchemaTable) error {
+	if bemidbTable == "" {
+		return fmt.Errorf("Hive Metastore table %s for %s already exists and wasn't created by BemiDB", hiveSchemaTable.String(), schemaTable.String())
+	}
+	return fmt.Errorf("Iceberg tables %s and %s are both mapped to Hive Metastore table %s, since the Hive Metastore lowercases names", bemidbTable, schemaTable.String(), hiveSchemaTable.String())
+}
+
+func (catalog *HiveCatalog) hiveTable(schemaTable IcebergSchemaTable, metadataPath string, icebergSchemaFields []IcebergSchemaField) *hive_metastore.Table {
+	hiveSchemaTable := CatalogSchemaTable(schemaTable)
+
+	columns := make([]*hive_metastore.FieldSchema, len(icebergSchemaFields))
+	for i, icebergSchemaField := range icebergSchemaFields {
+		columns[i] = &hive_metastore.FieldSchema{
+			Name: strings.ToLower(icebergSchemaField.Name),
+			Type: HiveColumnType(icebergSchemaField.Type),
+		}
+	}
+
+	return &hive_metastore.Table{
+		TableName:  hiveSchemaTable.Table,
+		DbName:     hiveSchemaTable.Schema,
+		Owner:      HIVE_TABLE_OWNER,
+		OwnerType:  hive_metastore.PrincipalType_USER,
+		CreateTime: int32(time.Now().Unix()),
+		TableType:  CATALOG_TABLE_TYPE_EXTERNAL,
+		Parameters: map[string]string{
+			CATALOG_PARAMETER_TABLE_TYPE:        CATALOG_TABLE_TYPE_ICEBERG,
+			CATALOG_PARAMETER_METADATA_LOCATION: metadataPath,
+			CATALOG_PARAMETER_BEMIDB_TABLE:      schemaTable.String(),
+			HIVE_PARAMETER_EXTERNAL:             "TRUE",
+		},
+		Sd: &hive_metastore.StorageDescriptor{
+			Cols:         columns,
+			Location:     CatalogTableLocation(metadataPath),
+			InputFormat:  HIVE_INPUT_FORMAT,
+			OutputFormat: HIVE_OUTPUT_FORMAT,
+			SerdeInfo:    &hive_metastore.SerDeInfo{SerializationLib: HIVE_SERIALIZATION_LIB},
+		},
+	}
+}
+
+// The database location is the schema directory that contains the table directories
+func (catalog *HiveCatalog) databaseLocation(metadataPath string) string {
+	tableLocation := CatalogTableLocation(metadataPath)
+	return tableLocation[:strings.LastIndex(tableLocation, "/")+1]
+}
+
+func isHiveNoSuchObject(err error) bool {
+	var noSuchObjectError *hive_metastore.NoSuchObjectException
+	return errors.As(err, &noSuchObjectError)
+}
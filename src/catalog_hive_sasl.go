@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	krb5Client "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const (
+	HIVE_SASL_STATUS_START    = 1
+	HIVE_SASL_STATUS_OK       = 2
+	HIVE_SASL_STATUS_BAD      = 3
+	HIVE_SASL_STATUS_ERROR    = 4
+	HIVE_SASL_STATUS_COMPLETE = 5
+
+	HIVE_SASL_MECHANISM_GSSAPI     = "GSSAPI"
+	HIVE_SASL_SECURITY_LAYER_NONE  = 1
+	HIVE_SASL_MAX_NEGOTIATION_SIZE = 1024 * 1024
+)
+
+// Thrift transport that authenticates to the Hive Metastore with the SASL GSSAPI mechanism (RFC 4752) using Kerberos tickets,
+// like the Thrift TSaslClientTransport. Negotiates no security layer, so messages are only framed with their length afterwards
+type HiveSaslTransport struct {
+	transport   thrift.TTransport
+	krb5Client  *krb5Client.Client
+	spn         string
+	readBuffer  bytes.Buffer // the rest of the last frame
+	writeBuffer bytes.Buffer
+	open        bool
+}
+
+func NewHiveSaslTransport(transport thrift.TTransport, krb5Client *krb5Client.Client, spn string) *HiveSaslTransport {
+	return &HiveSaslTransport{transport: transport, krb5Client: krb5Client, spn: spn}
+}
+
+func (saslTransport *HiveSaslTransport) Open() error {
+	if !saslTransport.transport.IsOpen() {
+		err := saslTransport.transport.Open()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := saslTransport.negotiate()
+	if err != nil {
+		saslTransport.transport.Close()
+		return fmt.Errorf("kerberos error: couldn't authenticate to the Hive Metastore as %s: %w", saslTransport.spn, err)
+	}
+
+	saslTransport.open = true
+	return nil
+}
+
+func (saslTransport *HiveSaslTransport) IsOpen() bool {
+	return saslTransport.open && saslTransport.transport.IsOpen()
+}
+
+func (saslTransport *HiveSaslTransport) Close() error {
+	saslTransport.open = false
+	return saslTransport.transport.Close()
+}
+
+func (saslTransport *HiveSaslTransport) Read(buffer []byte) (int, error) {
+	if saslTransport.readBuffer.Len() == 0 {
+		err := saslTransport.readFrame()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return saslTransport.readBuffer.Read(buffer)
+}
+
+func (saslTransport *HiveSaslTransport) Write(buffer []byte) (int, error) {
+	return saslTransport.writeBuffer.Write(buffer)
+}
+
+func (saslTransport *HiveSaslTransport) Flush(ctx context.Context) error {
+	frame := binary.BigEndian.AppendUint32(nil, uint32(saslTransport.writeBuffer.Len()))
+	frame = append(frame, saslTransport.writeBuffer.Bytes()...)
+	saslTransport.writeBuffer.Reset()
+
+	_, err := saslTransport.transport.Write(frame)
+	if err != nil {
+		return err
+	}
+	return saslTransport.transport.Flush(ctx)
+}
+
+// The size of the next frame is unknown until it's read
+func (saslTransport *HiveSaslTransport) RemainingBytes() uint64 {
+	return ^uint64(0)
+}
+
+// The server accepts the AP-REQ without mutual authentication, so the session key is used for the wrap tokens.
+// Then it offers the security layers in a wrap token, and the client selects no security layer in its wrap token
+func (saslTransport *HiveSaslTransport) negotiate() error {
+	ticket, sessionKey, err := saslTransport.krb5Client.GetServiceTicket(saslTransport.spn)
+	if err != nil {
+		return err
+	}
+
+	apReqToken, err := spnego.NewKRB5TokenAPREQ(saslTransport.krb5Client, ticket, sessionKey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, []int{})
+	if err != nil {
+		return err
+	}
+	initialResponse, err := apReqToken.Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = saslTransport.sendNegotiationMessage(HIVE_SASL_STATUS_START, []byte(HIVE_SASL_MECHANISM_GSSAPI))
+	if err != nil {
+		return err
+	}
+	err = saslTransport.sendNegotiationMessage(HIVE_SASL_STATUS_OK, initialResponse)
+	if err != nil {
+		return err
+	}
+
+	_, err = saslTransport.receiveNegotiationMessage(HIVE_SASL_STATUS_OK)
+	if err != nil {
+		return err
+	}
+	err = saslTransport.sendNegotiationMessage(HIVE_SASL_STATUS_OK, nil)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := saslTransport.receiveNegotiationMessage(HIVE_SASL_STATUS_OK)
+	if err != nil {
+		return err
+	}
+	response, err := securityLayerResponse(challenge, sessionKey)
+	if err != nil {
+		return err
+	}
+	err = saslTransport.sendNegotiationMessage(HIVE_SASL_STATUS_COMPLETE, response)
+	if err != nil {
+		return err
+	}
+
+	_, err = saslTransport.receiveNegotiationMessage(HIVE_SASL_STATUS_COMPLETE)
+	return err
+}
+
+// Negotiation messages consist of a status byte, a 4-byte payload length, and the payload
+func (saslTransport *HiveSaslTransport) sendNegotiationMessage(status byte, payload []byte) error {
+	message := []byte{status}
+	message = binary.BigEndian.AppendUint32(message, uint32(len(payload)))
+	message = append(message, payload...)
+
+	_, err := saslTransport.transport.Write(message)
+	if err != nil {
+		return err
+	}
+	return saslTransport.transport.Flush(context.Background())
+}
+
+func (saslTransport *HiveSaslTransport) receiveNegotiationMessage(expectedStatus byte) ([]byte, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(saslTransport.transport, header)
+	if err != nil {
+		return nil, err
+	}
+
+	status := header[0]
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > HIVE_SASL_MAX_NEGOTIATION_SIZE {
+		return nil, fmt.Errorf("negotiation message of %d bytes is too large", length)
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(saslTransport.transport, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case expectedStatus:
+		return payload, nil
+	case HIVE_SASL_STATUS_BAD, HIVE_SASL_STATUS_ERROR:
+		return nil, errors.New("the server rejected the authentication: " + string(payload))
+	}
+	return nil, fmt.Errorf("expected negotiation status %d, got %d", expectedStatus, status)
+}
+
+func (saslTransport *HiveSaslTransport) readFrame() error {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(saslTransport.transport, header)
+	if err != nil {
+		return err
+	}
+
+	length := int64(binary.BigEndian.Uint32(header))
+	_, err = io.CopyN(&saslTransport.readBuffer, saslTransport.transport, length)
+	return err
+}
+
+// The server's wrap token contains a bit mask of the supported security layers and the maximum message size
+func securityLayerResponse(challenge []byte, sessionKey types.EncryptionKey) ([]byte, error) {
+	challengeToken := gssapi.WrapToken{}
+	err := challengeToken.Unmarshal(challenge, true)
+	if err != nil {
+		return nil, err
+	}
+	_, err = challengeToken.Verify(sessionKey, keyusage.GSSAPI_ACCEPTOR_SEAL)
+	if err != nil {
+		return nil, err
+	}
+	if len(challengeToken.Payload) != 4 || challengeToken.Payload[0]&HIVE_SASL_SECURITY_LAYER_NONE == 0 {
+		return nil, errors.New("the server requires a security layer, which isn't supported (hadoop.rpc.protection must be \"authentication\")")
+	}
+
+	responseToken, err := gssapi.NewInitiatorWrapToken([]byte{HIVE_SASL_SECURITY_LAYER_NONE, 0, 0, 0}, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return responseToken.Marshal()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+func TestHiveSaslTransport(t *testing.T) {
+	t.Run("Frames messages with their length", func(t *testing.T) {
+		buffer := thrift.NewTMemoryBuffer()
+		saslTransport := NewHiveSaslTransport(buffer, nil, "hive/localhost")
+
+		saslTransport.Write([]byte("get_"))
+		saslTransport.Write([]byte("table"))
+		err := saslTransport.Flush(context.Background())
+		PanicIfError(err)
+
+		if string(buffer.Bytes()) != "\x00\x00\x00\x09get_table" {
+			t.Errorf("Expected the length-prefixed frame, got %q", buffer.Bytes())
+		}
+	})
+
+	t.Run("Reads messages across frames", func(t *testing.T) {
+		buffer := thrift.NewTMemoryBuffer()
+		buffer.Write([]byte("\x00\x00\x00\x03get\x00\x00\x00\x06_table"))
+		saslTransport := NewHiveSaslTransport(buffer, nil, "hive/localhost")
+
+		message := make([]byte, 9)
+		_, err := io.ReadFull(saslTransport, message)
+		PanicIfError(err)
+
+		if string(message) != "get_table" {
+			t.Errorf("Expected get_table, got %q", message)
+		}
+	})
+
+	t.Run("Returns an error if the server rejects the authentication", func(t *testing.T) {
+		buffer := thrift.NewTMemoryBuffer()
+		buffer.Write([]byte("\x03\x00\x00\x00\x0eNo such ticket"))
+		saslTransport := NewHiveSaslTransport(buffer, nil, "hive/localhost")
+
+		_, err := saslTransport.receiveNegotiationMessage(HIVE_SASL_STATUS_OK)
+
+		if err == nil || err.Error() != "the server rejected the authentication: No such ticket" {
+			t.Errorf("Expected the rejection error, got %v", err)
+		}
+	})
+}
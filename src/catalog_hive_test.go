@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/beltran/gohive/hive_metastore"
+)
+
+type FakeHiveMetastoreClient struct {
+	databases map[string]*hive_metastore.Database
+	tables    map[IcebergSchemaTable]*hive_metastore.Table
+	closed    bool
+}
+
+func NewFakeHiveMetastoreClient() *FakeHiveMetastoreClient {
+	return &FakeHiveMetastoreClient{databases: make(map[string]*hive_metastore.Database), tables: make(map[IcebergSchemaTable]*hive_metastore.Table)}
+}
+
+func (client *FakeHiveMetastoreClient) GetDatabase(ctx context.Context, name string) (*hive_metastore.Database, error) {
+	database, ok := client.databases[name]
+	if !ok {
+		return nil, &hive_metastore.NoSuchObjectException{Message: name}
+	}
+	return database, nil
+}
+
+func (client *FakeHiveMetastoreClient) CreateDatabase(ctx context.Context, database *hive_metastore.Database) error {
+	client.databases[database.Name] = database
+	return nil
+}
+
+func (client *FakeHiveMetastoreClient) DropDatabase(ctx context.Context, name string, deleteData bool, cascade bool) error {
+	delete(client.databases, name)
+	return nil
+}
+
+func (client *FakeHiveMetastoreClient) GetAllTables(ctx context.Context, dbName string) ([]string, error) {
+	tableNames := []string{}
+	for schemaTable := range client.tables {
+		if schemaTable.Schema == dbName {
+			tableNames = append(tableNames, schemaTable.Table)
+		}
+	}
+	return tableNames, nil
+}
+
+func (client *FakeHiveMetastoreClient) GetTable(ctx context.Context, dbName string, tableName string) (*hive_metastore.Table, error) {
+	table, ok := client.tables[IcebergSchemaTable{Schema: dbName, Table: tableName}]
+	if !ok {
+		return nil, &hive_metastore.NoSuchObjectException{Message: dbName + "." + tableName}
+	}
+	return table, nil
+}
+
+func (client *FakeHiveMetastoreClient) GetTableObjectsByName(ctx context.Context, dbName string, tableNames []string) ([]*hive_metastore.Table, error) {
+	tables := []*hive_metastore.Table{}
+	for _, tableName := range tableNames {
+		tables = append(tables, client.tables[IcebergSchemaTable{Schema: dbName, Table: tableName}])
+	}
+	return tables, nil
+}
+
+func (client *FakeHiveMetastoreClient) CreateTable(ctx context.Context, table *hive_metastore.Table) error {
+	client.tables[IcebergSchemaTable{Schema: table.DbName, Table: table.TableName}] = table
+	return nil
+}
+
+// Checks the expected parameter value like the Hive Metastore does
+func (client *FakeHiveMetastoreClient) AlterTableWithEnvironmentContext(ctx context.Context, dbName string, tableName string, newTable *hive_metastore.Table, environmentContext *hive_metastore.EnvironmentContext) error {
+	schemaTable := IcebergSchemaTable{Schema: dbName, Table: tableName}
+	expectedKey := environmentContext.Properties[HIVE_PARAMETER_EXPECTED_KEY]
+	if client.tables[schemaTable].Parameters[expectedKey] != environmentContext.Properties[HIVE_PARAMETER_EXPECTED_VALUE] {
+		return &hive_metastore.MetaException{Message: "The table has been modified. The parameter value for key '" + expectedKey + "' is different"}
+	}
+	client.tables[schemaTable] = newTable
+	return nil
+}
+
+func (client *FakeHiveMetastoreClient) DropTable(ctx context.Context, dbName string, tableName string, deleteData bool) error {
+	delete(client.tables, IcebergSchemaTable{Schema: dbName, Table: tableName})
+	return nil
+}
+
+func (client *FakeHiveMetastoreClient) Close() error {
+	client.closed = true
+	return nil
+}
+
+func TestHiveCatalog(t *testing.T) {
+	icebergSchemaFields := []IcebergSchemaField{
+		{Id: 1, Name: "id", Type: "long", Required: true},
+		{Id: 2, Name: "Name", Type: "string"},
+		{Id: 3, Name: "tags", Type: map[string]interface{}{"type": "list", "element": "string", "element-id": 3, "element-required": false}},
+	}
+	newCatalog := func() (*HiveCatalog, *FakeHiveMetastoreClient) {
+		hiveClient := NewFakeHiveMetastoreClient()
+		catalog := &HiveCatalog{config: &Config{LogLevel: LOG_LEVEL_ERROR}}
+		catalog.newClient = func() (HiveMetastoreClient, error) { return hiveClient, nil }
+		return catalog, hiveClient
+	}
+
+	t.Run("Creates a database and an Iceberg table", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "Public", Table: "Users"}, "s3://bucket/iceberg/Public/Users/metadata/v1.metadata.json", icebergSchemaFields)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		database := hiveClient.databases["public"]
+		if database == nil || database.Parameters[CATALOG_PARAMETER_BEMIDB_SCHEMA] != "Public" {
+			t.Fatalf("Expected the public database to be created for the Public schema, got %v", database)
+		}
+		if database.LocationUri != "s3://bucket/iceberg/Public/" {
+			t.Errorf("Expected the database location to be the schema directory, got %s", database.LocationUri)
+		}
+		table := hiveClient.tables[IcebergSchemaTable{Schema: "public", Table: "users"}]
+		if table == nil {
+			t.Fatalf("Expected the public.users table to be created")
+		}
+		if table.TableType != "EXTERNAL_TABLE" || table.Parameters[HIVE_PARAMETER_EXTERNAL] != "TRUE" {
+			t.Errorf("Expected the table to be external, got %s", table.TableType)
+		}
+		if table.Parameters[CATALOG_PARAMETER_TABLE_TYPE] != "ICEBERG" {
+			t.Errorf("Expected the table type to be ICEBERG, got %s", table.Parameters[CATALOG_PARAMETER_TABLE_TYPE])
+		}
+		if table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION] != "s3://bucket/iceberg/Public/Users/metadata/v1.metadata.json" {
+			t.Errorf("Expected the metadata location to be the metadata file, got %s", table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION])
+		}
+		if table.Sd.Location != "s3://bucket/iceberg/Public/Users" {
+			t.Errorf("Expected the location to be the table directory, got %s", table.Sd.Location)
+		}
+		columns := []string{}
+		for _, column := range table.Sd.Cols {
+			columns = append(columns, column.Name+" "+column.Type)
+		}
+		if strings.Join(columns, ", ") != "id bigint, name string, tags array<string>" {
+			t.Errorf("Expected the columns to be 'id bigint, name string, tags array<string>', got '%s'", strings.Join(columns, ", "))
+		}
+		if !hiveClient.closed {
+			t.Errorf("Expected the connection to be closed")
+		}
+	})
+
+	t.Run("Alters the metadata location of an existing table", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+		schemaTable := IcebergSchemaTable{Schema: "public", Table: "users"}
+
+		err := catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields[:1])
+		PanicIfError(err)
+		err = catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v2.metadata.json", icebergSchemaFields)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		table := hiveClient.tables[schemaTable]
+		if table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION] != "s3://bucket/iceberg/public/users/metadata/v2.metadata.json" {
+			t.Errorf("Expected the metadata location to be updated, got %s", table.Parameters[CATALOG_PARAMETER_METADATA_LOCATION])
+		}
+		if table.Parameters[HIVE_PARAMETER_PREVIOUS_METADATA_LOCATION] != "s3://bucket/iceberg/public/users/metadata/v1.metadata.json" {
+			t.Errorf("Expected the previous metadata location to be set, got %s", table.Parameters[HIVE_PARAMETER_PREVIOUS_METADATA_LOCATION])
+		}
+		if len(table.Sd.Cols) != 3 {
+			t.Errorf("Expected the columns to be updated, got %d columns", len(table.Sd.Cols))
+		}
+	})
+
+	t.Run("Returns an error if another writer has committed to the table", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+		schemaTable := IcebergSchemaTable{Schema: "public", Table: "users"}
+		err := catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		hiveClient.tables[schemaTable].Parameters[CATALOG_PARAMETER_METADATA_LOCATION] = "s3://bucket/iceberg/public/users/metadata/00001-abc.metadata.json"
+
+		err = catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+
+		expected := `Hive Metastore table "public"."users" points to s3://bucket/iceberg/public/users/metadata/00001-abc.metadata.json instead of s3://bucket/iceberg/public/users/metadata/v1.metadata.json, another writer may have committed to it`
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %s, got %v", expected, err)
+		}
+		if hiveClient.tables[schemaTable].Parameters[CATALOG_PARAMETER_METADATA_LOCATION] != "s3://bucket/iceberg/public/users/metadata/00001-abc.metadata.json" {
+			t.Errorf("Expected the metadata location of the other writer to be kept, got %s", hiveClient.tables[schemaTable].Parameters[CATALOG_PARAMETER_METADATA_LOCATION])
+		}
+
+		hiveClient.tables[schemaTable].Parameters[CATALOG_PARAMETER_METADATA_LOCATION] = "s3://bucket/iceberg/public/users/metadata/v3.metadata.json"
+
+		err = catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v2.metadata.json", icebergSchemaFields)
+
+		if err == nil || !strings.Contains(err.Error(), "another writer may have committed to it") {
+			t.Errorf("Expected an error about a later metadata version, got %v", err)
+		}
+	})
+
+	t.Run("Returns an error if another writer commits while altering the table", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+		schemaTable := IcebergSchemaTable{Schema: "public", Table: "users"}
+		err := catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		concurrentTable := *hiveClient.tables[schemaTable]
+		concurrentTable.Parameters = map[string]string{
+			CATALOG_PARAMETER_METADATA_LOCATION: "s3://bucket/iceberg/public/users/metadata/00001-abc.metadata.json",
+			CATALOG_PARAMETER_BEMIDB_TABLE:      schemaTable.String(),
+		}
+		catalog.newClient = func() (HiveMetastoreClient, error) {
+			return &ConcurrentlyAlteredHiveMetastoreClient{FakeHiveMetastoreClient: hiveClient, concurrentTable: &concurrentTable}, nil
+		}
+
+		err = catalog.UpsertTable(schemaTable, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+
+		var metaException *hive_metastore.MetaException
+		if !errors.As(err, &metaException) {
+			t.Errorf("Expected the alter to fail, got %v", err)
+		}
+		if hiveClient.tables[schemaTable] != &concurrentTable {
+			t.Errorf("Expected the table of the other writer to be kept")
+		}
+	})
+
+	t.Run("Returns an error if the table name collides with another table", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "Users"}, "s3://bucket/iceberg/public/Users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+
+		err = catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+
+		expected := `Iceberg tables "public"."Users" and "public"."users" are both mapped to Hive Metastore table "public"."users", since the Hive Metastore lowercases names`
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %s, got %v", expected, err)
+		}
+
+		hiveClient.tables[IcebergSchemaTable{Schema: "public", Table: "orders"}] = &hive_metastore.Table{TableName: "orders", DbName: "public"}
+		err = catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "orders"}, "s3://bucket/iceberg/public/orders/metadata/v1.metadata.json", icebergSchemaFields)
+
+		expected = `Hive Metastore table "public"."orders" for "public"."orders" already exists and wasn't created by BemiDB`
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %s, got %v", expected, err)
+		}
+	})
+
+	t.Run("Returns an error if the metastore can't be reached", func(t *testing.T) {
+		catalog, _ := newCatalog()
+		catalog.newClient = func() (HiveMetastoreClient, error) {
+			return nil, errors.New("failed to connect to the Hive Metastore at localhost:9083: connection refused")
+		}
+
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+
+		if err == nil || err.Error() != "failed to connect to the Hive Metastore at localhost:9083: connection refused" {
+			t.Errorf("Expected the connection error, got %v", err)
+		}
+	})
+
+	t.Run("Drops only tables created by BemiDB", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		hiveClient.tables[IcebergSchemaTable{Schema: "public", Table: "orders"}] = &hive_metastore.Table{TableName: "orders", DbName: "public"}
+
+		err = catalog.DeleteTable(IcebergSchemaTable{Schema: "public", Table: "orders"})
+		PanicIfError(err)
+		err = catalog.DeleteTable(IcebergSchemaTable{Schema: "public", Table: "users"})
+		PanicIfError(err)
+
+		if len(hiveClient.tables) != 1 || hiveClient.tables[IcebergSchemaTable{Schema: "public", Table: "orders"}] == nil {
+			t.Errorf("Expected only the BemiDB table to be dropped, got %d tables", len(hiveClient.tables))
+		}
+	})
+
+	t.Run("Drops the tables and the database of a schema", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		err = catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "orders"}, "s3://bucket/iceberg/public/orders/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+
+		err = catalog.DeleteSchema("public")
+		PanicIfError(err)
+
+		if len(hiveClient.tables) != 0 || len(hiveClient.databases) != 0 {
+			t.Errorf("Expected the tables and the database to be dropped, got %d tables and %d databases", len(hiveClient.tables), len(hiveClient.databases))
+		}
+	})
+
+	t.Run("Keeps the database of a schema with other tables", func(t *testing.T) {
+		catalog, hiveClient := newCatalog()
+		err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, "s3://bucket/iceberg/public/users/metadata/v1.metadata.json", icebergSchemaFields)
+		PanicIfError(err)
+		hiveClient.tables[IcebergSchemaTable{Schema: "public", Table: "orders"}] = &hive_metastore.Table{TableName: "orders", DbName: "public"}
+
+		err = catalog.DeleteSchema("public")
+		PanicIfError(err)
+
+		if len(hiveClient.tables) != 1 || hiveClient.databases["public"] == nil {
+			t.Errorf("Expected only the BemiDB table to be dropped, got %d tables and %d databases", len(hiveClient.tables), len(hiveClient.databases))
+		}
+	})
+}
+
+// Simulates another writer committing to the table between reading and altering it
+type ConcurrentlyAlteredHiveMetastoreClient struct {
+	*FakeHiveMetastoreClient
+	concurrentTable *hive_metastore.Table
+}
+
+func (client *ConcurrentlyAlteredHiveMetastoreClient) GetTable(ctx context.Context, dbName string, tableName string) (*hive_metastore.Table, error) {
+	table, err := client.FakeHiveMetastoreClient.GetTable(ctx, dbName, tableName)
+	client.tables[IcebergSchemaTable{Schema: dbName, Table: tableName}] = client.concurrentTable
+	return table, err
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	NESSIE_SYNC_BRANCH_PREFIX     = "bemidb-sync-"
+	NESSIE_METADATA_FILE_PREFIX   = "nessie-"
+	NESSIE_METADATA_FILE_SUFFIX   = ".metadata.json"
+	NESSIE_NO_CURRENT_SNAPSHOT_ID = -1
+)
+
+// Commits Iceberg tables to a Nessie branch with a namespace per schema, so that Spark, Trino, Dremio, and other engines
+// using Nessie can query them. Nessie tracks metadata files by their location, while BemiDB deletes old metadata files and
+// rewrites the current one when expiring snapshots. So each commit points to an immutable copy of the metadata file, named
+// after its current snapshot. During a sync, the tables are committed to a temporary branch that is merged into the configured branch once the sync succeeds
+type NessieCatalog struct {
+	client     *NessieClient
+	storage    Storage
+	config     *Config
+	syncBranch *NessieReference // nil outside syncs
+	syncStart  string           // hash of the configured branch that the sync branch was created from
+	mutex      sync.Mutex       // tables are committed concurrently, each commit moves the branch hash
+}
+
+func NewNessieCatalog(config *Config) *NessieCatalog {
+	return &NessieCatalog{client: NewNessieClient(config), storage: NewStorage(config), config: config}
+}
+
+// Nessie keeps the case of names, so unlike Glue and the Hive Metastore, "Users" and "users" are different tables
+func NessieContentKeyFor(schemaTable IcebergSchemaTable) NessieContentKey {
+	return NessieContentKey{Elements: []string{schemaTable.Schema, schemaTable.Table}}
+}
+
+// The copy of the metadata file in the metadata directory that Nessie commits of the snapshot point to
+func NessieMetadataFilePath(metadataPath string, snapshotId string) string {
+	metadataDirPath := metadataPath[:strings.LastIndex(metadataPath, "/")+1]
+	return metadataDirPath + NESSIE_METADATA_FILE_PREFIX + snapshotId + NESSIE_METADATA_FILE_SUFFIX
+}
+
+func (catalog *NessieCatalog) UpsertTable(schemaTable IcebergSchemaTable, metadataPath string, icebergSchemaFields []IcebergSchemaField) (err error) {
+	metadataContent, err := catalog.storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return err
+	}
+	nessieTable, err := catalog.parseNessieTable(metadataContent)
+	if err != nil {
+		return err
+	}
+
+	nessieTable.MetadataLocation = NessieMetadataFilePath(metadataPath, fmt.Sprint(nessieTable.SnapshotId))
+	err = catalog.storage.WriteIcebergTableFile(nessieTable.MetadataLocation, metadataContent)
+	if err != nil {
+		return err
+	}
+
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+
+	branch, err := catalog.branch()
+	if err != nil {
+		return err
+	}
+
+	key := NessieContentKeyFor(schemaTable)
+	var operations []NessieOperation
+	namespaceKey := NessieContentKey{Elements: []string{schemaTable.Schema}}
+	namespaceExists, err := catalog.client.NamespaceExists(catalog.pathRef(branch), namespaceKey)
+	if err != nil {
+		return err
+	}
+	if !namespaceExists {
+		LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Creating Nessie namespace", QuoteIdentifier(schemaTable.Schema), "on", branch.Name)
+		operations = append(operations, NessieOperation{
+			Type:    NESSIE_OPERATION_PUT,
+			Key:     namespaceKey,
+			Content: NessieNamespace{Type: NESSIE_CONTENT_NAMESPACE, Elements: namespaceKey.Elements},
+		})
+	}
+
+	existingTable, err := catalog.client.Table(catalog.pathRef(branch), key)
+	if err != nil {
+		return err
+	}
+	if existingTable != nil {
+		nessieTable.Id = existingTable.Id
+	}
+	operations = append(operations, NessieOperation{Type: NESSIE_OPERATION_PUT, Key: key, Content: nessieTable})
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Committing Nessie table", schemaTable.String(), "to", branch.Name)
+	return catalog.commit(branch, "Sync "+schemaTable.String(), operations)
+}
+
+// Deletes the table unless it doesn't exist on the branch
+func (catalog *NessieCatalog) DeleteTable(schemaTable IcebergSchemaTable) (err error) {
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+
+	branch, err := catalog.branch()
+	if err != nil {
+		return err
+	}
+
+	key := NessieContentKeyFor(schemaTable)
+	existingTable, err := catalog.client.Table(catalog.pathRef(branch), key)
+	if err != nil || existingTable == nil {
+		return err
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Deleting Nessie table", schemaTable.String(), "from", branch.Name)
+	return catalog.commit(branch, "Delete "+schemaTable.String(), []NessieOperation{{Type: NESSIE_OPERATION_DELETE, Key: key}})
+}
+
+// Deletes the tables of the schema and its namespace in one commit, keeping the namespace if it contains other content
+func (catalog *NessieCatalog) DeleteSchema(schema string) (err error) {
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+
+	branch, err := catalog.branch()
+	if err != nil {
+		return err
+	}
+
+	entries, err := catalog.client.Entries(catalog.pathRef(branch))
+	if err != nil {
+		return err
+	}
+
+	var operations []NessieOperation
+	namespaceExists, hasOtherContent := false, false
+	for _, entry := range entries {
+		elements := entry.Name.Elements
+		switch {
+		case len(elements) == 1 && elements[0] == schema && entry.Type == NESSIE_CONTENT_NAMESPACE:
+			namespaceExists = true
+		case len(elements) == 2 && elements[0] == schema && entry.Type == NESSIE_CONTENT_TABLE:
+			operations = append(operations, NessieOperation{Type: NESSIE_OPERATION_DELETE, Key: entry.Name})
+		case len(elements) > 1 && elements[0] == schema:
+			hasOtherContent = true // e.g., views and nested namespaces that weren't created by BemiDB
+		}
+	}
+	if namespaceExists && !hasOtherContent {
+		operations = append(operations, NessieOperation{Type: NESSIE_OPERATION_DELETE, Key: NessieContentKey{Elements: []string{schema}}})
+	}
+	if len(operations) == 0 {
+		return nil
+	}
+
+	LogComponentDebug(catalog.config, LOG_COMPONENT_ICEBERG, "Deleting Nessie namespace", QuoteIdentifier(schema), "from", branch.Name)
+	return catalog.commit(branch, "Delete "+QuoteIdentifier(schema), operations)
+}
+
+// Creates a temporary branch from the configured branch for the tables committed during the sync
+func (catalog *NessieCatalog) BeginSync() error {
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+
+	target, err := catalog.client.Reference(catalog.config.Nessie.Branch)
+	if err != nil {
+		return err
+	}
+
+	name := NESSIE_SYNC_BRANCH_PREFIX + time.Now().UTC().Format("20060102T150405Z") + "-" + uuid.New().String()[:8]
+	syncBranch, err := catalog.client.CreateBranch(name, target)
+	if err != nil {
+		return err
+	}
+
+	LogComponentInfo(catalog.config, LOG_COMPONENT_SYNCER, "Committing synced tables to Nessie branch", syncBranch.Name, "created from", target.Name)
+	catalog.syncBranch = &syncBranch
+	catalog.syncStart = target.Hash
+	return nil
+}
+
+// Merges the sync branch into the configured branch, so that readers of the configured branch see all synced tables at once
+func (catalog *NessieCatalog) CommitSync() error {
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+
+	if catalog.syncBranch == nil {
+		return nil
+	}
+
+	if catalog.syncBranch.Hash != catalog.syncStart {
+		target, err := catalog.client.Reference(catalog.config.Nessie.Branch)
+		if err != nil {
+			return err
+		}
+		LogComponentInfo(catalog.config, LOG_COMPONENT_SYNCER, "Merging Nessie branch", catalog.syncBranch.Name, "into", target.Name)
+		err = catalog.client.Merge(target, *catalog.syncBranch, "Merge BemiDB sync "+catalog.syncBranch.Name)
+		if err != nil {
+			return fmt.Errorf("failed to merge Nessie branch %s into %s: %w", catalog.syncBranch.Name, target.Name, err)
+		}
+	}
+
+	return catalog.deleteSyncBranch()
+}
+
+// Deletes the sync branch, leaving the configured branch untouched
+func (catalog *NessieCatalog) AbortSync() error {
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+
+	if catalog.syncBranch == nil {
+		return nil
+	}
+
+	LogComponentWarn(catalog.config, LOG_COMPONENT_SYNCER, "Deleting Nessie branch", catalog.syncBranch.Name, "of the failed sync")
+	return catalog.deleteSyncBranch()
+}
+
+func (catalog *NessieCatalog) deleteSyncBranch() error {
+	err := catalog.client.DeleteBranch(*catalog.syncBranch)
+	if err != nil {
+		return fmt.Errorf("failed to delete Nessie branch %s: %w", catalog.syncBranch.Name, err)
+	}
+	catalog.syncBranch = nil
+	catalog.syncStart = ""
+	return nil
+}
+
+// Returns the sync branch during a sync, the configured branch otherwise
+func (catalog *NessieCatalog) branch() (NessieReference, error) {
+	if catalog.syncBranch != nil {
+		return *catalog.syncBranch, nil
+	}
+	return catalog.client.Reference(catalog.config.Nessie.Branch)
+}
+
+func (catalog *NessieCatalog) commit(branch NessieReference, message string, operations []NessieOperation) error {
+	newBranch, err := catalog.client.Commit(branch, message, operations)
+	if err != nil {
+		return fmt.Errorf("failed to commit to Nessie branch %s: %w", branch.Name, err)
+	}
+	if catalog.syncBranch != nil {
+		catalog.syncBranch.Hash = newBranch.Hash
+	}
+	return nil
+}
+
+func (catalog *NessieCatalog) pathRef(branch NessieReference) string {
+	return branch.Name + "@" + branch.Hash
+}
+
+func (catalog *NessieCatalog) parseNessieTable(metadataContent []byte) (NessieTable, error) {
+	var metadataJson struct {
+		CurrentSnapshotId  *json.Number `json:"current-snapshot-id"`
+		CurrentSchemaId    int          `json:"current-schema-id"`
+		DefaultSpecId      int          `json:"default-spec-id"`
+		DefaultSortOrderId int          `json:"default-sort-order-id"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	if err := decoder.Decode(&metadataJson); err != nil {
+		return NessieTable{}, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+
+	nessieTable := NessieTable{
+		Type:        NESSIE_CONTENT_TABLE,
+		SnapshotId:  NESSIE_NO_CURRENT_SNAPSHOT_ID,
+		SchemaId:    metadataJson.CurrentSchemaId,
+		SpecId:      metadataJson.DefaultSpecId,
+		SortOrderId: metadataJson.DefaultSortOrderId,
+	}
+	if metadataJson.CurrentSnapshotId != nil {
+		snapshotId, err := metadataJson.CurrentSnapshotId.Int64()
+		if err != nil {
+			return NessieTable{}, fmt.Errorf("failed to parse snapshot ID: %v", err)
+		}
+		nessieTable.SnapshotId = snapshotId
+	}
+	return nessieTable, nil
+}
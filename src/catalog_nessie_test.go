@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// In-memory Nessie server with the REST API v2 endpoints used by NessieClient. Each commit stores all contents under a new hash
+type FakeNessieServer struct {
+	*httptest.Server
+	branches    map[string]string                            // name -> hash
+	commits     map[string]map[string]map[string]interface{} // hash -> key -> content
+	authTokens  []string
+	mutex       sync.Mutex
+	commitCount int
+}
+
+func NewFakeNessieServer() *FakeNessieServer {
+	server := &FakeNessieServer{
+		branches: map[string]string{"main": "hash-0"},
+		commits:  map[string]map[string]map[string]interface{}{"hash-0": {}},
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+func (server *FakeNessieServer) Content(ref string, key string) map[string]interface{} {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.commits[server.branches[ref]][key]
+}
+
+func (server *FakeNessieServer) handle(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.authTokens = append(server.authTokens, r.Header.Get("Authorization"))
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v2/trees")
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	name, hash, _ := strings.Cut(parts[0], "@")
+	if hash == "" {
+		hash = server.branches[name]
+	}
+	contents, exists := server.commits[hash]
+	if _, isBranch := server.branches[name]; name != "" && (!isBranch || !exists) {
+		http.Error(w, "reference not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && path == "":
+		var from NessieReference
+		json.NewDecoder(r.Body).Decode(&from)
+		server.branches[r.URL.Query().Get("name")] = from.Hash
+		server.writeJson(w, map[string]interface{}{"reference": NessieReference{Type: NESSIE_REFERENCE_BRANCH, Name: r.URL.Query().Get("name"), Hash: from.Hash}})
+
+	case r.Method == http.MethodGet && len(parts) == 1:
+		server.writeJson(w, map[string]interface{}{"reference": NessieReference{Type: NESSIE_REFERENCE_BRANCH, Name: name, Hash: hash}})
+
+	case r.Method == http.MethodDelete && len(parts) == 1:
+		if server.branches[name] != hash {
+			http.Error(w, "hash mismatch", http.StatusConflict)
+			return
+		}
+		delete(server.branches, name)
+
+	case r.Method == http.MethodPost && parts[1] == "history/commit":
+		if server.branches[name] != hash {
+			http.Error(w, "hash mismatch", http.StatusConflict)
+			return
+		}
+		var body struct {
+			Operations []struct {
+				Type    string                 `json:"type"`
+				Key     NessieContentKey       `json:"key"`
+				Content map[string]interface{} `json:"content"`
+			} `json:"operations"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		newContents := map[string]map[string]interface{}{}
+		for key, content := range contents {
+			newContents[key] = content
+		}
+		for _, operation := range body.Operations {
+			key := strings.Join(operation.Key.Elements, ".")
+			if operation.Type == NESSIE_OPERATION_DELETE {
+				delete(newContents, key)
+				continue
+			}
+			if operation.Content["id"] == nil {
+				operation.Content["id"] = "id-" + key
+			}
+			newContents[key] = operation.Content
+		}
+		server.commitCount++
+		newHash := "hash-" + IntToString(server.commitCount)
+		server.commits[newHash] = newContents
+		server.branches[name] = newHash
+		server.writeJson(w, map[string]interface{}{"targetBranch": NessieReference{Type: NESSIE_REFERENCE_BRANCH, Name: name, Hash: newHash}})
+
+	case r.Method == http.MethodPost && parts[1] == "history/merge":
+		var body struct {
+			FromHash string `json:"fromHash"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		server.branches[name] = body.FromHash // fast-forward
+		server.writeJson(w, map[string]interface{}{"resultantTargetHash": body.FromHash})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(parts[1], "contents/"):
+		content, ok := contents[strings.TrimPrefix(parts[1], "contents/")]
+		if !ok {
+			http.Error(w, "content not found", http.StatusNotFound)
+			return
+		}
+		server.writeJson(w, map[string]interface{}{"content": content})
+
+	case r.Method == http.MethodGet && parts[1] == "entries":
+		entries := []NessieEntry{}
+		for key, content := range contents {
+			entries = append(entries, NessieEntry{Type: content["type"].(string), Name: NessieContentKey{Elements: strings.Split(key, ".")}})
+		}
+		server.writeJson(w, map[string]interface{}{"entries": entries, "hasMore": false})
+
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (server *FakeNessieServer) writeJson(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+func TestNessieCatalog(t *testing.T) {
+	schemaTable := IcebergSchemaTable{Schema: "public", Table: "Users"}
+	newCatalog := func(t *testing.T) (*NessieCatalog, *FakeNessieServer, string) {
+		server := NewFakeNessieServer()
+		t.Cleanup(server.Close)
+
+		config := loadTestConfig()
+		config.CatalogType = CATALOG_TYPE_NESSIE
+		config.Nessie = NessieConfig{Endpoint: server.URL, Branch: "main", AuthToken: "token"}
+
+		metadataPath := filepath.Join(t.TempDir(), "public", "Users", "metadata", "v1.metadata.json")
+		err := os.MkdirAll(filepath.Dir(metadataPath), 0755)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		writeNessieTestMetadata(t, metadataPath, "1234567890123456789")
+		return NewNessieCatalog(config), server, metadataPath
+	}
+
+	t.Run("Commits a table and its namespace to the branch outside syncs", func(t *testing.T) {
+		catalog, server, metadataPath := newCatalog(t)
+
+		err := catalog.UpsertTable(schemaTable, metadataPath, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if server.Content("main", "public") == nil {
+			t.Errorf("Expected the public namespace to be created")
+		}
+		table := server.Content("main", "public.Users")
+		copyPath := filepath.Join(filepath.Dir(metadataPath), "nessie-1234567890123456789.metadata.json")
+		if table == nil || table["metadataLocation"] != copyPath {
+			t.Fatalf("Expected the table to point to %s, got %v", copyPath, table)
+		}
+		if table["snapshotId"] != float64(1234567890123456789) || table["schemaId"] != float64(1) || table["specId"] != float64(2) {
+			t.Errorf("Expected the table to have the IDs of the metadata, got %v", table)
+		}
+		if _, err := os.Stat(copyPath); err != nil {
+			t.Errorf("Expected the metadata file to be copied, got %v", err)
+		}
+		if server.authTokens[0] != "Bearer token" {
+			t.Errorf("Expected the auth token to be sent, got %s", server.authTokens[0])
+		}
+	})
+
+	t.Run("Keeps the content ID when committing an existing table", func(t *testing.T) {
+		catalog, server, metadataPath := newCatalog(t)
+		err := catalog.UpsertTable(schemaTable, metadataPath, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		writeNessieTestMetadata(t, metadataPath, "1234567890123456790")
+
+		err = catalog.UpsertTable(schemaTable, metadataPath, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		table := server.Content("main", "public.Users")
+		if table["id"] != "id-public.Users" || !strings.HasSuffix(table["metadataLocation"].(string), "nessie-1234567890123456790.metadata.json") {
+			t.Errorf("Expected the existing table to point to the new metadata file, got %v", table)
+		}
+	})
+
+	t.Run("Publishes the tables of a sync when it's committed", func(t *testing.T) {
+		catalog, server, metadataPath := newCatalog(t)
+
+		err := catalog.BeginSync()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		syncBranch := catalog.syncBranch.Name
+		if !strings.HasPrefix(syncBranch, NESSIE_SYNC_BRANCH_PREFIX) {
+			t.Errorf("Expected the sync branch to be prefixed with %s, got %s", NESSIE_SYNC_BRANCH_PREFIX, syncBranch)
+		}
+		err = catalog.UpsertTable(schemaTable, metadataPath, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		err = catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: "users"}, metadataPath, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if server.Content("main", "public.Users") != nil {
+			t.Errorf("Expected the main branch to be untouched during the sync")
+		}
+
+		err = catalog.CommitSync()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if server.Content("main", "public.Users") == nil || server.Content("main", "public.users") == nil {
+			t.Errorf("Expected both tables to be merged into the main branch")
+		}
+		if _, ok := server.branches[syncBranch]; ok {
+			t.Errorf("Expected the sync branch to be deleted")
+		}
+		if catalog.syncBranch != nil {
+			t.Errorf("Expected the catalog to commit to the main branch after the sync")
+		}
+	})
+
+	t.Run("Deletes the sync branch without merging it when the sync fails", func(t *testing.T) {
+		catalog, server, metadataPath := newCatalog(t)
+		syncer := &Syncer{config: catalog.config}
+
+		func() {
+			defer func() {
+				if r := recover(); r != "sync failed" {
+					t.Errorf("Expected the sync panic to be re-raised, got %v", r)
+				}
+			}()
+			err := catalog.BeginSync()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer syncer.abortCatalogSync(catalog)
+
+			err = catalog.UpsertTable(schemaTable, metadataPath, nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			panic("sync failed")
+		}()
+
+		if len(server.branches) != 1 || server.Content("main", "public.Users") != nil {
+			t.Errorf("Expected only the untouched main branch to remain, got %v", server.branches)
+		}
+	})
+
+	t.Run("Deletes tables and schemas", func(t *testing.T) {
+		catalog, server, metadataPath := newCatalog(t)
+		for _, table := range []string{"Users", "events"} {
+			err := catalog.UpsertTable(IcebergSchemaTable{Schema: "public", Table: table}, metadataPath, nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		err := catalog.DeleteTable(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if server.Content("main", "public.Users") != nil || server.Content("main", "public.events") == nil {
+			t.Errorf("Expected only the deleted table to be removed")
+		}
+		err = catalog.DeleteTable(IcebergSchemaTable{Schema: "public", Table: "missing"})
+		if err != nil {
+			t.Errorf("Expected no error for a missing table, got %v", err)
+		}
+
+		err = catalog.DeleteSchema("public")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if server.Content("main", "public.events") != nil || server.Content("main", "public") != nil {
+			t.Errorf("Expected the tables and the namespace to be removed")
+		}
+	})
+
+	t.Run("Reads the metadata file of a table at a reference", func(t *testing.T) {
+		catalog, _, metadataPath := newCatalog(t)
+		err := catalog.UpsertTable(schemaTable, metadataPath, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		reader := NewIcebergReader(catalog.config)
+
+		refMetadataPath, err := reader.NessieMetadataFilePath(schemaTable, "main@hash-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if refMetadataPath != NessieMetadataFilePath(metadataPath, "1234567890123456789") {
+			t.Errorf("Expected the copied metadata file, got %s", refMetadataPath)
+		}
+		refMetadataPath, err = reader.NessieMetadataFilePath(schemaTable, "main@hash-0")
+		if err != nil || refMetadataPath != "" {
+			t.Errorf("Expected no metadata file before the table was committed, got %s %v", refMetadataPath, err)
+		}
+	})
+}
+
+func writeNessieTestMetadata(t *testing.T, metadataPath string, snapshotId string) {
+	metadata := `{"format-version":2,"current-snapshot-id":` + snapshotId + `,"current-schema-id":1,"default-spec-id":2,"default-sort-order-id":0,` +
+		`"schemas":[{"schema-id":1,"fields":[{"id":1,"name":"id","type":"long","required":true}]}]}`
+	err := os.WriteFile(metadataPath, []byte(metadata), 0644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHiveColumnType(t *testing.T) {
+	for icebergType, expected := range map[string]string{
+		"int":                     "int",
+		"long":                    "bigint",
+		"float":                   "float",
+		"double":                  "double",
+		"boolean":                 "boolean",
+		"string":                  "string",
+		"date":                    "date",
+		"binary":                  "binary",
+		"timestamp":               "timestamp",
+		"timestamptz":             "timestamp",
+		"decimal(38, 18)":         "decimal(38,18)",
+		"time":                    "string",
+		"uuid":                    "string",
+		"an-unknown-iceberg-type": "string",
+	} {
+		if HiveColumnType(icebergType) != expected {
+			t.Errorf("Expected %s to be mapped to %s, got %s", icebergType, expected, HiveColumnType(icebergType))
+		}
+	}
+
+	listType := map[string]interface{}{"type": "list", "element": "decimal(10, 2)", "element-id": 1, "element-required": false}
+	if HiveColumnType(listType) != "array<decimal(10,2)>" {
+		t.Errorf("Expected the list to be mapped to array<decimal(10,2)>, got %s", HiveColumnType(listType))
+	}
+}
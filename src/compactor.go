@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+type Compactor struct {
+	config        *Config
+	icebergReader *IcebergReader
+	icebergWriter *IcebergWriter
+}
+
+func NewCompactor(config *Config) *Compactor {
+	// Iceberg schema names already include the schema prefix
+	icebergConfig := *config
+	icebergConfig.Pg.SchemaPrefix = ""
+
+	return &Compactor{
+		config:        config,
+		icebergReader: NewIcebergReader(&icebergConfig),
+		icebergWriter: NewIcebergWriter(&icebergConfig),
+	}
+}
+
+func (compactor *Compactor) CompactIcebergTables() {
+	icebergSchemaTables, err := compactor.icebergReader.SchemaTables()
+	PanicIfError(err)
+
+	for _, icebergSchemaTable := range icebergSchemaTables.Values() {
+		if !compactor.shouldCompactTable(icebergSchemaTable) {
+			continue
+		}
+
+		LogComponentInfo(compactor.config, LOG_COMPONENT_ICEBERG, "Compacting", icebergSchemaTable.String()+"...")
+		err := compactor.icebergWriter.Compact(icebergSchemaTable, compactor.config.CompactTargetFileSize)
+		if err != nil {
+			LogComponentError(compactor.config, LOG_COMPONENT_ICEBERG, "Failed to compact", icebergSchemaTable.String()+":", err)
+		}
+	}
+}
+
+// Include/exclude filters use PostgreSQL schema names without the schema prefix
+func (compactor *Compactor) shouldCompactTable(icebergSchemaTable IcebergSchemaTable) bool {
+	if !strings.HasPrefix(icebergSchemaTable.Schema, compactor.config.Pg.SchemaPrefix) {
+		return false
+	}
+
+	schema := strings.TrimPrefix(icebergSchemaTable.Schema, compactor.config.Pg.SchemaPrefix)
+	return matchesPgTableFilters(compactor.config, schema, icebergSchemaTable.Table)
+}
+
+// Groups files smaller than the target file size into bins that can be merged without exceeding it.
+// Bins with a single file are skipped since there is nothing to merge
+func CompactionBins(parquetFiles []ParquetFile, targetFileSize int64) [][]ParquetFile {
+	var smallParquetFiles []ParquetFile
+	for _, parquetFile := range parquetFiles {
+		if parquetFile.Size < targetFileSize {
+			smallParquetFiles = append(smallParquetFiles, parquetFile)
+		}
+	}
+	sort.SliceStable(smallParquetFiles, func(i, j int) bool {
+		return smallParquetFiles[i].Size > smallParquetFiles[j].Size
+	})
+
+	var bins [][]ParquetFile
+	var binSizes []int64
+	for _, parquetFile := range smallParquetFiles {
+		binIndex := -1
+		for i, binSize := range binSizes {
+			if binSize+parquetFile.Size <= targetFileSize {
+				binIndex = i
+				break
+			}
+		}
+
+		if binIndex == -1 {
+			bins = append(bins, []ParquetFile{})
+			binSizes = append(binSizes, 0)
+			binIndex = len(bins) - 1
+		}
+		bins[binIndex] = append(bins[binIndex], parquetFile)
+		binSizes[binIndex] += parquetFile.Size
+	}
+
+	var mergeableBins [][]ParquetFile
+	for _, bin := range bins {
+		if len(bin) > 1 {
+			mergeableBins = append(mergeableBins, bin)
+		}
+	}
+
+	return mergeableBins
+}
@@ -0,0 +1,666 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompactionBins(t *testing.T) {
+	t.Run("groups small files without exceeding the target file size", func(t *testing.T) {
+		parquetFiles := []ParquetFile{
+			{Path: "a", Size: 60},
+			{Path: "b", Size: 30},
+			{Path: "c", Size: 50},
+			{Path: "d", Size: 20},
+		}
+
+		bins := CompactionBins(parquetFiles, 100)
+
+		if len(bins) != 2 {
+			t.Fatalf("Expected 2 bins, got %d", len(bins))
+		}
+		if binPaths(bins[0]) != "[a b]" {
+			t.Errorf("Expected first bin to be a,b, got %s", binPaths(bins[0]))
+		}
+		if binPaths(bins[1]) != "[c d]" {
+			t.Errorf("Expected second bin to be c,d, got %s", binPaths(bins[1]))
+		}
+	})
+
+	t.Run("skips files that already reach the target file size", func(t *testing.T) {
+		parquetFiles := []ParquetFile{
+			{Path: "a", Size: 100},
+			{Path: "b", Size: 10},
+			{Path: "c", Size: 10},
+		}
+
+		bins := CompactionBins(parquetFiles, 100)
+
+		if len(bins) != 1 || binPaths(bins[0]) != "[b c]" {
+			t.Errorf("Expected a single bin b,c, got %v", bins)
+		}
+	})
+
+	t.Run("skips bins with a single file", func(t *testing.T) {
+		parquetFiles := []ParquetFile{
+			{Path: "a", Size: 60},
+			{Path: "b", Size: 50},
+		}
+
+		bins := CompactionBins(parquetFiles, 100)
+
+		if len(bins) != 0 {
+			t.Errorf("Expected no bins, got %v", bins)
+		}
+	})
+}
+
+func TestShouldCompactTable(t *testing.T) {
+	t.Run("returns true when no filters are set", func(t *testing.T) {
+		compactor := &Compactor{config: &Config{}}
+
+		if !compactor.shouldCompactTable(IcebergSchemaTable{Schema: "public", Table: "users"}) {
+			t.Error("Expected shouldCompactTable to return true when no filters are set")
+		}
+	})
+
+	t.Run("respects include and exclude filters", func(t *testing.T) {
+		compactor := &Compactor{config: &Config{
+			Pg: PgConfig{
+				IncludeTables:  NewSet([]string{"public.users"}),
+				ExcludeSchemas: NewSet([]string{"private"}),
+			},
+		}}
+
+		if !compactor.shouldCompactTable(IcebergSchemaTable{Schema: "public", Table: "users"}) {
+			t.Error("Expected shouldCompactTable to return true for included table")
+		}
+		if compactor.shouldCompactTable(IcebergSchemaTable{Schema: "public", Table: "orders"}) {
+			t.Error("Expected shouldCompactTable to return false for non-included table")
+		}
+		if compactor.shouldCompactTable(IcebergSchemaTable{Schema: "private", Table: "users"}) {
+			t.Error("Expected shouldCompactTable to return false for excluded schema")
+		}
+	})
+
+	t.Run("matches filters without the schema prefix", func(t *testing.T) {
+		compactor := &Compactor{config: &Config{
+			Pg: PgConfig{
+				SchemaPrefix:  "mydb_",
+				IncludeTables: NewSet([]string{"public.users"}),
+			},
+		}}
+
+		if !compactor.shouldCompactTable(IcebergSchemaTable{Schema: "mydb_public", Table: "users"}) {
+			t.Error("Expected shouldCompactTable to return true for prefixed included table")
+		}
+		if compactor.shouldCompactTable(IcebergSchemaTable{Schema: "public", Table: "users"}) {
+			t.Error("Expected shouldCompactTable to return false for table without the schema prefix")
+		}
+	})
+}
+
+func TestCompact(t *testing.T) {
+	t.Run("merges data files without changing their rows", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_compaction", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		loadRowsOnce := func() func() [][]string {
+			loaded := false
+			return func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				return PUBLIC_TEST_TABLE_LOADED_ROWS
+			}
+		}
+		icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		appendRows := loadRowsOnce()
+		_, err := icebergWriter.Append(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, func() ([][]string, error) {
+			return appendRows(), nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var columnNames []string
+		for _, pgSchemaColumn := range PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS {
+			if pgSchemaColumn.DataType != PG_DATA_TYPE_ARRAY {
+				columnNames = append(columnNames, pgSchemaColumn.ColumnName)
+			}
+		}
+		rowsBefore, err := storage.ReadParquetColumns(schemaTable, columnNames)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		err = icebergWriter.Compact(schemaTable, 1024*1024)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		parquetFiles, err := storage.IcebergDataFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(parquetFiles) != 1 {
+			t.Fatalf("Expected 1 data file, got %d", len(parquetFiles))
+		}
+		if parquetFiles[0].RecordCount != int64(2*len(PUBLIC_TEST_TABLE_LOADED_ROWS)) {
+			t.Errorf("Expected %d records, got %d", 2*len(PUBLIC_TEST_TABLE_LOADED_ROWS), parquetFiles[0].RecordCount)
+		}
+
+		rowsAfter, err := storage.ReadParquetColumns(schemaTable, columnNames)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rowsAfter) != formatRows(rowsBefore) {
+			t.Errorf("Expected rows to be preserved, got %s instead of %s", formatRows(rowsAfter), formatRows(rowsBefore))
+		}
+
+		icebergSchemaFields, err := storage.IcebergSchemaFields(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(icebergSchemaFields) != len(PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS) {
+			t.Errorf("Expected %d schema fields, got %d", len(PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS), len(icebergSchemaFields))
+		}
+	})
+}
+
+func TestCompactWithPositionDeletes(t *testing.T) {
+	t.Run("keeps data files with deleted rows and the position delete files", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_compaction_deletes", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		pgSchemaColumns := []PgSchemaColumn{
+			{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog", PrimaryKeyPosition: 1},
+			{ColumnName: "name", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog"},
+		}
+		loadRowsOnce := func(rows [][]string) func() ([][]string, error) {
+			loaded := false
+			return func() ([][]string, error) {
+				if loaded {
+					return [][]string{}, nil
+				}
+				loaded = true
+				return rows, nil
+			}
+		}
+		writeRows := loadRowsOnce([][]string{{"1", "a"}, {"2", "b"}})
+		icebergWriter.Write(context.Background(), schemaTable, pgSchemaColumns, func() [][]string {
+			rows, _ := writeRows()
+			return rows
+		})
+		for _, rows := range [][][]string{{{"3", "c"}}, {{"1", "a2"}}} {
+			_, _, err := icebergWriter.Upsert(context.Background(), schemaTable, pgSchemaColumns, []string{"id"}, loadRowsOnce(rows))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		err := icebergWriter.Compact(schemaTable, 1024*1024)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		_, _, err = icebergWriter.Vacuum(schemaTable, 0, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		dataFiles, err := storage.IcebergDataFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(dataFiles) != 2 {
+			t.Errorf("Expected the 2 appended data files to be merged, got %d data files", len(dataFiles))
+		}
+		deleteFiles, err := storage.IcebergDeleteFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(deleteFiles) != 1 {
+			t.Errorf("Expected the position delete file to be kept, got %d delete files", len(deleteFiles))
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1a2 2b 3c]" {
+			t.Errorf("Expected only the latest row versions, got %v", rows)
+		}
+	})
+}
+
+func TestEqualityDeletes(t *testing.T) {
+	pgSchemaColumns := []PgSchemaColumn{
+		{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog", PrimaryKeyPosition: 1},
+		{ColumnName: "name", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog"},
+	}
+	loadRowsOnce := func(rows [][]string) func() ([][]string, error) {
+		loaded := false
+		return func() ([][]string, error) {
+			if loaded {
+				return [][]string{}, nil
+			}
+			loaded = true
+			return rows, nil
+		}
+	}
+	writeUpsertedTable := func(t *testing.T, schemaTable IcebergSchemaTable) (*IcebergWriter, *StorageLocal) {
+		config := loadTestConfig()
+		config.Iceberg.EqualityDeletes = true
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		t.Cleanup(func() { icebergWriter.DeleteSchema(schemaTable.Schema) })
+
+		writeRows := loadRowsOnce([][]string{{"1", "a"}, {"2", "b"}})
+		icebergWriter.Write(context.Background(), schemaTable, pgSchemaColumns, func() [][]string {
+			rows, _ := writeRows()
+			return rows
+		})
+		for _, rows := range [][][]string{{{"1", "a2"}, {"3", "c"}}, {{"1", "a3"}}} {
+			_, _, err := icebergWriter.Upsert(context.Background(), schemaTable, pgSchemaColumns, []string{"id"}, loadRowsOnce(rows))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		return icebergWriter, storage
+	}
+
+	t.Run("replaces upserted rows with equality delete files keyed on the primary key", func(t *testing.T) {
+		schemaTable := IcebergSchemaTable{Schema: "test_equality_deletes_upsert", Table: "test_table"}
+		_, storage := writeUpsertedTable(t, schemaTable)
+
+		deleteFiles, err := storage.IcebergDeleteFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var sequenceNumbers []int64
+		for _, deleteFile := range deleteFiles {
+			if deleteFile.Content != ICEBERG_CONTENT_EQUALITY_DELETES || !reflect.DeepEqual(deleteFile.EqualityFieldIds, []int{1}) {
+				t.Errorf("Expected an equality delete file keyed on the id field, got content %d with fields %v", deleteFile.Content, deleteFile.EqualityFieldIds)
+			}
+			sequenceNumbers = append(sequenceNumbers, deleteFile.SequenceNumber)
+		}
+		slices.Sort(sequenceNumbers)
+		if !reflect.DeepEqual(sequenceNumbers, []int64{2, 3}) {
+			t.Errorf("Expected the equality delete files of both upserts, got sequence numbers %v", sequenceNumbers)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1a3 2b 3c]" {
+			t.Errorf("Expected only the latest row versions, got %v", rows)
+		}
+	})
+
+	t.Run("writes a metadata copy with the equality deletes resolved into position deletes for DuckDB", func(t *testing.T) {
+		schemaTable := IcebergSchemaTable{Schema: "test_equality_deletes_reconcile", Table: "test_table"}
+		_, storage := writeUpsertedTable(t, schemaTable)
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		PanicIfError(err)
+		metadataContent, err := os.ReadFile(metadataPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		icebergSchemaFields, err := storage.IcebergSchemaFields(schemaTable)
+		PanicIfError(err)
+		tempDir := t.TempDir()
+
+		reconciledMetadataPath, err := ReconcileIcebergMetadata(metadataContent, 0, icebergSchemaFields, storage.ReadIcebergTableFile, storage.ReadParquetLocationColumns, storage.CreateParquet, tempDir)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		reconciledMetadataContent, err := os.ReadFile(reconciledMetadataPath)
+		if err != nil {
+			t.Fatalf("Expected the reconciled metadata to be written, got %v", err)
+		}
+		_, deleteFilePaths, manifestEntries, err := storage.storageBase.CurrentSnapshotFilePaths(reconciledMetadataContent, storage.ReadIcebergTableFile)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var sequenceNumbers []int64
+		for deleteFilePath := range deleteFilePaths {
+			if manifestEntries[deleteFilePath].Content != ICEBERG_CONTENT_POSITION_DELETES || !strings.HasPrefix(deleteFilePath, tempDir) {
+				t.Errorf("Expected a position delete file in the temporary directory, got %s with content %d", deleteFilePath, manifestEntries[deleteFilePath].Content)
+			}
+			sequenceNumbers = append(sequenceNumbers, manifestEntries[deleteFilePath].SequenceNumber)
+		}
+		slices.Sort(sequenceNumbers)
+		if !reflect.DeepEqual(sequenceNumbers, []int64{2, 3}) {
+			t.Errorf("Expected the sequence numbers of the equality delete files to be kept, got %v", sequenceNumbers)
+		}
+		rows, err := storage.storageBase.ReadCurrentSnapshotColumns(reconciledMetadataContent, storage.ReadIcebergTableFile, storage.ReadParquetLocationColumns, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1a3 2b 3c]" {
+			t.Errorf("Expected only the latest row versions, got %v", rows)
+		}
+
+		reusedMetadataPath, err := ReconcileIcebergMetadata(metadataContent, 0, icebergSchemaFields, storage.ReadIcebergTableFile, storage.ReadParquetLocationColumns, storage.CreateParquet, tempDir)
+		if err != nil || reusedMetadataPath != reconciledMetadataPath {
+			t.Errorf("Expected the reconciled metadata to be reused, got %s (%v)", reusedMetadataPath, err)
+		}
+	})
+
+	t.Run("resolves the equality delete files into position delete files when compacting", func(t *testing.T) {
+		schemaTable := IcebergSchemaTable{Schema: "test_equality_deletes_compaction", Table: "test_table"}
+		icebergWriter, storage := writeUpsertedTable(t, schemaTable)
+
+		err := icebergWriter.Compact(schemaTable, 1024*1024)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		deleteFiles, err := storage.IcebergDeleteFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(deleteFiles) == 0 || slices.ContainsFunc(deleteFiles, func(deleteFile ParquetFile) bool { return deleteFile.Content != ICEBERG_CONTENT_POSITION_DELETES }) {
+			t.Errorf("Expected only position delete files, got %v", deleteFiles)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1a3 2b 3c]" {
+			t.Errorf("Expected only the latest row versions, got %v", rows)
+		}
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		PanicIfError(err)
+		metadataContent, err := os.ReadFile(metadataPath)
+		PanicIfError(err)
+		icebergSchemaFields, err := storage.IcebergSchemaFields(schemaTable)
+		PanicIfError(err)
+		reconciledMetadataPath, err := ReconcileIcebergMetadata(metadataContent, 0, icebergSchemaFields, storage.ReadIcebergTableFile, storage.ReadParquetLocationColumns, storage.CreateParquet, t.TempDir())
+		if err != nil || reconciledMetadataPath != "" {
+			t.Errorf("Expected no reconciled metadata without equality delete files, got %s (%v)", reconciledMetadataPath, err)
+		}
+	})
+
+	t.Run("replaces upserted rows of partitioned tables with position delete files", func(t *testing.T) {
+		config := loadTestConfig()
+		config.Iceberg.EqualityDeletes = true
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_equality_deletes_partitioned", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		writeRows := loadRowsOnce([][]string{{"1", "active"}, {"2", "deleted"}})
+		icebergWriter.Write(context.Background(), schemaTable, PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS, func() [][]string {
+			rows, _ := writeRows()
+			return rows
+		})
+
+		_, deletedRowCount, err := icebergWriter.Upsert(context.Background(), schemaTable, PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS, []string{"id"}, loadRowsOnce([][]string{{"2", "active"}}))
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if deletedRowCount != 1 {
+			t.Errorf("Expected 1 deleted row, got %d", deletedRowCount)
+		}
+		deleteFiles, err := storage.IcebergDeleteFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(deleteFiles) != 1 || deleteFiles[0].Content != ICEBERG_CONTENT_POSITION_DELETES {
+			t.Errorf("Expected a position delete file, got %v", deleteFiles)
+		}
+	})
+}
+
+func TestConcurrentCommits(t *testing.T) {
+	idColumn := PgSchemaColumn{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog"}
+	appendRow := func(icebergWriter *IcebergWriter, schemaTable IcebergSchemaTable, id int) error {
+		loaded := false
+		_, err := icebergWriter.Append(context.Background(), schemaTable, []PgSchemaColumn{idColumn}, func() ([][]string, error) {
+			if loaded {
+				return [][]string{}, nil
+			}
+			loaded = true
+			return [][]string{{IntToString(id)}}, nil
+		})
+		return err
+	}
+	formatIds := func(count int) string {
+		var rows [][]interface{}
+		for id := 1; id <= count; id++ {
+			rows = append(rows, []interface{}{id})
+		}
+		return formatRows(rows)
+	}
+
+	t.Run("keeps the rows appended by two writers racing on the same table", func(t *testing.T) {
+		config := loadTestConfig()
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_concurrent_commits", Table: "test_table"}
+		defer NewIcebergWriter(config).DeleteSchema(schemaTable.Schema)
+
+		var waitGroup sync.WaitGroup
+		writerErrs := make([]error, 2)
+		for writer := range writerErrs {
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				icebergWriter := NewIcebergWriter(config) // as if in another process
+				for i := 0; i < 20 && writerErrs[writer] == nil; i++ {
+					writerErrs[writer] = appendRow(icebergWriter, schemaTable, 2*i+writer+1)
+				}
+			}()
+		}
+		waitGroup.Wait()
+		for writer, err := range writerErrs {
+			if err != nil {
+				t.Fatalf("Expected writer %d to commit all of its appends, got %v", writer, err)
+			}
+		}
+
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != formatIds(40) {
+			t.Errorf("Expected the rows appended by both writers, got %s", formatRows(rows))
+		}
+		version, err := storage.CurrentMetadataVersion(storage.CreateMetadataDir(schemaTable))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if version != 40 {
+			t.Errorf("Expected a metadata version for each of the 40 appends, got %d", version)
+		}
+	})
+
+	t.Run("fails a compaction when another writer commits during it", func(t *testing.T) {
+		config := loadTestConfig()
+		storage := NewLocalStorage(config)
+		icebergWriter := NewIcebergWriter(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_concurrent_compaction", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		for id := 1; id <= 2; id++ {
+			err := appendRow(icebergWriter, schemaTable, id)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		compactingWriter := &IcebergWriter{config: config, storage: &racingStorage{Storage: storage, race: func() {
+			err := appendRow(icebergWriter, schemaTable, 3)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}}}
+
+		err := compactingWriter.Compact(schemaTable, 1024*1024)
+
+		if !errors.Is(err, errConcurrentModification) {
+			t.Fatalf("Expected a concurrent modification error, got %v", err)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1 2 3]" {
+			t.Errorf("Expected the rows appended during the compaction to be kept, got %s", formatRows(rows))
+		}
+		filePaths, err := filepath.Glob(filepath.Join(storage.CreateDataDir(schemaTable), "*.parquet"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(filePaths) != 3 {
+			t.Errorf("Expected the merged data file to be deleted, got %d data files", len(filePaths))
+		}
+	})
+
+	t.Run("upserts again on top of the rows upserted by another writer", func(t *testing.T) {
+		config := loadTestConfig()
+		storage := NewLocalStorage(config)
+		icebergWriter := NewIcebergWriter(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_concurrent_upserts", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		pgSchemaColumns := []PgSchemaColumn{
+			{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog", PrimaryKeyPosition: 1},
+			{ColumnName: "name", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog"},
+		}
+		upsertRow := func(icebergWriter *IcebergWriter, row []string) error {
+			loaded := false
+			_, _, err := icebergWriter.Upsert(context.Background(), schemaTable, pgSchemaColumns, []string{"id"}, func() ([][]string, error) {
+				if loaded {
+					return [][]string{}, nil
+				}
+				loaded = true
+				return [][]string{row}, nil
+			})
+			return err
+		}
+		err := upsertRow(icebergWriter, []string{"1", "a"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		racingWriter := &IcebergWriter{config: config, storage: &racingStorage{Storage: storage, race: func() {
+			err := upsertRow(icebergWriter, []string{"1", "b"})
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}}}
+
+		err = upsertRow(racingWriter, []string{"1", "c"})
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1c]" {
+			t.Errorf("Expected the row upserted by the other writer to be replaced as well, got %s", formatRows(rows))
+		}
+		dataFiles, err := storage.IcebergDataFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(dataFiles) != 3 {
+			t.Errorf("Expected the data files of all 3 upserts, got %d data files", len(dataFiles))
+		}
+	})
+
+	t.Run("commits on top of a version that the version hint doesn't point to yet", func(t *testing.T) {
+		config := loadTestConfig()
+		storage := NewLocalStorage(config)
+		icebergWriter := NewIcebergWriter(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_concurrent_commits", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		for id := 1; id <= 2; id++ {
+			err := appendRow(icebergWriter, schemaTable, id)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		metadataDirPath := storage.CreateMetadataDir(schemaTable)
+		err := os.WriteFile(filepath.Join(metadataDirPath, VERSION_HINT_FILE_NAME), []byte("1"), 0644) // as if the writer of v2 crashed
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		err = appendRow(icebergWriter, schemaTable, 3)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if filepath.Base(metadataPath) != "v3.metadata.json" {
+			t.Errorf("Expected the current metadata file to be v3.metadata.json, got %s", metadataPath)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1 2 3]" {
+			t.Errorf("Expected the rows of all commits, got %s", formatRows(rows))
+		}
+	})
+}
+
+// Runs the race once right before the next metadata file is created, as if another writer committed in the meantime
+type racingStorage struct {
+	Storage
+	race func()
+}
+
+func (storage *racingStorage) CreateMetadata(metadataDirPath string, baseVersion int64, icebergSchemaFields []IcebergSchemaField, partitionSpec IcebergPartitionSpec, properties map[string]string, parquetFiles []ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
+	if race := storage.race; race != nil {
+		storage.race = nil
+		race()
+	}
+	return storage.Storage.CreateMetadata(metadataDirPath, baseVersion, icebergSchemaFields, partitionSpec, properties, parquetFiles, manifestFile, manifestListFile)
+}
+
+func (storage *racingStorage) CreateNextMetadata(icebergSchemaTable IcebergSchemaTable, baseVersion int64, metadataContent []byte) (metadataFile MetadataFile, err error) {
+	if race := storage.race; race != nil {
+		storage.race = nil
+		race()
+	}
+	return storage.Storage.CreateNextMetadata(icebergSchemaTable, baseVersion, metadataContent)
+}
+
+func binPaths(parquetFiles []ParquetFile) string {
+	var paths []string
+	for _, parquetFile := range parquetFiles {
+		paths = append(paths, parquetFile.Path)
+	}
+	sort.Strings(paths)
+	return fmt.Sprint(paths)
+}
+
+func formatRows(rows [][]interface{}) string {
+	var formattedRows []string
+	for _, row := range rows {
+		formattedRows = append(formattedRows, fmt.Sprint(row...))
+	}
+	sort.Strings(formattedRows)
+	return fmt.Sprint(formattedRows)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"strings"
 )
 
@@ -86,20 +85,84 @@ type IcebergSchemaTable struct {
 }
 
 func (schemaTable IcebergSchemaTable) String() string {
-	return fmt.Sprintf(`"%s"."%s"`, schemaTable.Schema, schemaTable.Table)
+	return QuoteIdentifier(schemaTable.Schema) + "." + QuoteIdentifier(schemaTable.Table)
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
+const (
+	ICEBERG_FIELD_DOC_INTERVAL_PREFIX = "interval;format="
+	ICEBERG_FIELD_DOC_CITEXT          = "citext"
+	ICEBERG_FIELD_DOC_JSON            = "json"
+	ICEBERG_FIELD_DOC_UUID_BINARY     = "uuid;format=binary"
+	ICEBERG_FIELD_DOC_LENGTH_PREFIX   = "length="
+	ICEBERG_FIELD_DOC_FORMAT_PREFIX   = "format="
+	ICEBERG_FIELD_DOC_XML             = "xml"
+	ICEBERG_FIELD_DOC_XPATH_PREFIX    = "xpath="
+)
+
 type IcebergTableField struct {
 	Name     string
 	Type     string
 	Required bool
 	IsList   bool
+	Doc      string
+}
+
+// Intervals synced as ISO 8601 strings or microseconds are cast back to intervals when queried
+func (tableField IcebergTableField) IsCastToInterval() bool {
+	format := tableField.IntervalFormat()
+	return strings.HasPrefix(tableField.Doc, ICEBERG_FIELD_DOC_INTERVAL_PREFIX) && !tableField.IsList && (format == PG_INTERVAL_FORMAT_ISO8601 || format == PG_INTERVAL_FORMAT_MICROSECONDS)
+}
+
+// citext values are stored as strings, which are compared case-insensitively when queried like in PostgreSQL
+func (tableField IcebergTableField) IsCaseInsensitive() bool {
+	docType, _, _ := strings.Cut(tableField.Doc, ";")
+	return docType == ICEBERG_FIELD_DOC_CITEXT && !tableField.IsList
+}
+
+// json and jsonb values are stored as strings, which are cast to JSON when queried
+func (tableField IcebergTableField) IsCastToJson() bool {
+	docType, _, _ := strings.Cut(tableField.Doc, ";")
+	return docType == ICEBERG_FIELD_DOC_JSON
+}
+
+// UUIDs synced as strings in fixed-length byte arrays are read as BLOB like binary values.
+// UUIDs synced as 16 bytes with the UUID logical type are read as UUID without a cast
+func (tableField IcebergTableField) IsCastToUuid() bool {
+	return tableField.Type == "uuid" && !strings.HasPrefix(tableField.Doc, ICEBERG_FIELD_DOC_UUID_BINARY)
+}
+
+// Declared lengths of char(n) and varchar(n) columns are reported as the type modifier (length + 4) like in PostgreSQL, -1 otherwise
+func (tableField IcebergTableField) PgTypmod() int {
+	docType, attributes, _ := strings.Cut(tableField.Doc, ";")
+	if docType != "bpchar" && docType != "varchar" {
+		return -1
+	}
+	for _, attribute := range strings.Split(attributes, ";") {
+		if length, found := strings.CutPrefix(attribute, ICEBERG_FIELD_DOC_LENGTH_PREFIX); found {
+			intLength, err := StringToInt(length)
+			PanicIfError(err)
+			return intLength + PG_VARHDRSZ
+		}
+	}
+	return -1
+}
+
+// The format may be followed by other ";"-separated attributes, e.g. the domain name
+func (tableField IcebergTableField) IntervalFormat() string {
+	format, _, _ := strings.Cut(strings.TrimPrefix(tableField.Doc, ICEBERG_FIELD_DOC_INTERVAL_PREFIX), ";")
+	return format
 }
 
 func (tableField IcebergTableField) ToSql() string {
-	sql := fmt.Sprintf(`"%s" %s`, tableField.Name, tableField.Type)
+	fieldType := tableField.Type
+	if tableField.IsCastToInterval() {
+		fieldType = "interval"
+	} else if tableField.IsCastToJson() {
+		fieldType = "json"
+	}
+	sql := QuoteIdentifier(tableField.Name) + " " + fieldType
 
 	if tableField.IsList {
 		sql += "[]"
@@ -120,21 +183,15 @@ type QuerySchemaTable struct {
 	Alias  string
 }
 
+// Parses a table name like in a regclass cast, e.g., 'users', 'public.users', or '"Test Schema"."Order Items"'
 func NewQuerySchemaTableFromString(schemaTable string) QuerySchemaTable {
-	parts := strings.Split(schemaTable, ".")
+	parts := ParseQualifiedIdentifier(schemaTable)
 
 	qSchemaTable := QuerySchemaTable{
 		Table: parts[len(parts)-1],
 	}
 	if len(parts) > 1 {
-		qSchemaTable.Schema = parts[0]
-	}
-
-	if !StringContainsUpper(qSchemaTable.Schema) {
-		qSchemaTable.Schema = strings.ReplaceAll(qSchemaTable.Schema, "\"", "")
-	}
-	if !StringContainsUpper(qSchemaTable.Table) {
-		qSchemaTable.Table = strings.ReplaceAll(qSchemaTable.Table, "\"", "")
+		qSchemaTable.Schema = parts[len(parts)-2]
 	}
 
 	return qSchemaTable
@@ -150,13 +207,38 @@ func (qSchemaTable QuerySchemaTable) ToIcebergSchemaTable() IcebergSchemaTable {
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 type PgSchemaTable struct {
-	Schema                 string
-	Table                  string
-	ParentPartitionedTable string
+	Schema      string
+	Table       string
+	RelKind     string
+	Unpopulated bool // materialized views created or refreshed WITH NO DATA can't be read
+
+	// Top-level partitioned table for partitions, which can be in a different schema
+	ParentPartitionedSchema string
+	ParentPartitionedTable  string
 }
 
 func (pgSchemaTable PgSchemaTable) String() string {
-	return fmt.Sprintf(`"%s"."%s"`, pgSchemaTable.Schema, pgSchemaTable.Table)
+	return QuoteIdentifier(pgSchemaTable.Schema) + "." + QuoteIdentifier(pgSchemaTable.Table)
+}
+
+func (pgSchemaTable PgSchemaTable) IsForeignTable() bool {
+	return pgSchemaTable.RelKind == PG_RELKIND_FOREIGN_TABLE
+}
+
+func (pgSchemaTable PgSchemaTable) IsView() bool {
+	return pgSchemaTable.RelKind == PG_RELKIND_VIEW
+}
+
+func (pgSchemaTable PgSchemaTable) IsMaterializedView() bool {
+	return pgSchemaTable.RelKind == PG_RELKIND_MATERIALIZED_VIEW
+}
+
+func (pgSchemaTable PgSchemaTable) IsPartitionedTable() bool {
+	return pgSchemaTable.RelKind == PG_RELKIND_PARTITIONED_TABLE
+}
+
+func (pgSchemaTable PgSchemaTable) IsPartition() bool {
+	return pgSchemaTable.ParentPartitionedTable != ""
 }
 
 func (pgSchemaTable PgSchemaTable) ToIcebergSchemaTable() IcebergSchemaTable {
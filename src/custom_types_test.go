@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewQuerySchemaTableFromString(t *testing.T) {
+	for schemaTable, expected := range map[string]QuerySchemaTable{
+		"users":                              {Table: "users"},
+		"public.users":                       {Schema: "public", Table: "users"},
+		"Public.Users":                       {Schema: "public", Table: "users"},
+		`"public"."users"`:                   {Schema: "public", Table: "users"},
+		`"Test Schema"."Order Items"`:        {Schema: "Test Schema", Table: "Order Items"},
+		`"Test.Schema"."Order ""Items"""`:    {Schema: "Test.Schema", Table: `Order "Items"`},
+		`"Test Schema".group`:                {Schema: "Test Schema", Table: "group"},
+		`bemidb."Test Schema"."Order Items"`: {Schema: "Test Schema", Table: "Order Items"},
+	} {
+		t.Run(schemaTable, func(t *testing.T) {
+			qSchemaTable := NewQuerySchemaTableFromString(schemaTable)
+
+			if qSchemaTable != expected {
+				t.Errorf("Expected %v, got %v", expected, qSchemaTable)
+			}
+		})
+	}
+}
+
+func TestIcebergSchemaTableString(t *testing.T) {
+	t.Run("quotes mixed-case schemas and tables with spaces and quotes", func(t *testing.T) {
+		schemaTable := IcebergSchemaTable{Schema: "Test Schema", Table: `Order "Items"`}
+
+		expected := `"Test Schema"."Order ""Items"""`
+		if schemaTable.String() != expected {
+			t.Errorf("Expected %s, got %s", expected, schemaTable.String())
+		}
+		if NewQuerySchemaTableFromString(schemaTable.String()).ToIcebergSchemaTable() != schemaTable {
+			t.Errorf("Expected %s to be parsed back into %v", schemaTable.String(), schemaTable)
+		}
+	})
+}
+
+func TestIcebergTableFieldToSql(t *testing.T) {
+	t.Run("quotes reserved column names", func(t *testing.T) {
+		tableField := IcebergTableField{Name: "group", Type: "varchar", Required: true}
+
+		expected := `"group" varchar NOT NULL`
+		if tableField.ToSql() != expected {
+			t.Errorf("Expected %s, got %s", expected, tableField.ToSql())
+		}
+	})
+}
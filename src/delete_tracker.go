@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DELETED_AT_COLUMN_NAME = "_deleted_at"
+
+	DELETE_TRACKER_KEY_SEPARATOR = "\x00"
+)
+
+// Primary key types that can be read back from Parquet and formatted as PostgreSQL CSV values without losing precision
+var DELETE_TRACKER_PRIMARY_KEY_TYPES = NewSet([]string{"int2", "int4", "int8", "varchar", "text", "bpchar", "uuid"})
+
+// Keeps rows that were deleted in PostgreSQL as tombstones with a "_deleted_at" timestamp:
+// - Reads primary keys (and existing tombstones) from the current Iceberg table
+// - Removes primary keys that are still present in PostgreSQL while the rows are streamed
+// - Writes the remaining primary keys as tombstones with all other columns set to NULL
+type DeleteTracker struct {
+	pgSchemaColumns        []PgSchemaColumn
+	primaryKeyIndexes      []int
+	deletedAtByPrimaryKeys map[string]string
+	deletedAt              string
+}
+
+func NewDeleteTracker(pgSchemaColumns []PgSchemaColumn, primaryKeyColumnNames []string) (*DeleteTracker, error) {
+	primaryKeyIndexes, err := pgPrimaryKeyIndexes(pgSchemaColumns, primaryKeyColumnNames)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range primaryKeyIndexes {
+		if pgSchemaColumns[index].ColumnName == DELETED_AT_COLUMN_NAME {
+			return nil, fmt.Errorf("column %s is reserved", DELETED_AT_COLUMN_NAME)
+		}
+	}
+
+	return &DeleteTracker{
+		pgSchemaColumns:        pgSchemaColumns,
+		primaryKeyIndexes:      primaryKeyIndexes,
+		deletedAtByPrimaryKeys: make(map[string]string),
+		deletedAt:              formatDeletedAt(time.Now()),
+	}, nil
+}
+
+func (tracker *DeleteTracker) PrimaryKeyColumnNames() []string {
+	var columnNames []string
+	for _, index := range tracker.primaryKeyIndexes {
+		columnNames = append(columnNames, tracker.pgSchemaColumns[index].ColumnName)
+	}
+	return columnNames
+}
+
+// Rows contain primary key values, optionally followed by a "_deleted_at" value from a previous sync
+func (tracker *DeleteTracker) LoadIcebergRows(rows [][]interface{}) {
+	for _, row := range rows {
+		primaryKey, ok := icebergRowPrimaryKey(tracker.pgSchemaColumns, tracker.primaryKeyIndexes, row[:len(tracker.primaryKeyIndexes)])
+		if !ok {
+			continue
+		}
+
+		deletedAt := ""
+		if len(row) > len(tracker.primaryKeyIndexes) {
+			if deletedAtMicro, ok := row[len(tracker.primaryKeyIndexes)].(int64); ok {
+				deletedAt = formatDeletedAt(time.UnixMicro(deletedAtMicro))
+			}
+		}
+
+		tracker.deletedAtByPrimaryKeys[primaryKey] = deletedAt
+	}
+}
+
+// Tombstones contain only primary key values, so all other columns must be nullable
+func (tracker *DeleteTracker) PgSchemaColumns() []PgSchemaColumn {
+	var pgSchemaColumns []PgSchemaColumn
+	maxOrdinalPosition := 0
+
+	for i, pgSchemaColumn := range tracker.pgSchemaColumns {
+		if !tracker.isPrimaryKeyIndex(i) {
+			pgSchemaColumn.IsNullable = PG_TRUE
+		}
+		pgSchemaColumns = append(pgSchemaColumns, pgSchemaColumn)
+
+		ordinalPosition, err := StringToInt(pgSchemaColumn.OrdinalPosition)
+		PanicIfError(err)
+		maxOrdinalPosition = max(maxOrdinalPosition, ordinalPosition)
+	}
+
+	return append(pgSchemaColumns, PgSchemaColumn{
+		ColumnName:        DELETED_AT_COLUMN_NAME,
+		DataType:          "timestamp with time zone",
+		UdtName:           "timestamptz",
+		IsNullable:        PG_TRUE,
+		OrdinalPosition:   IntToString(maxOrdinalPosition + 1),
+		DatetimePrecision: "6",
+		Namespace:         PG_SCHEMA_PG_CATALOG,
+	})
+}
+
+// Marks rows as present in PostgreSQL and appends an empty "_deleted_at" value to them
+func (tracker *DeleteTracker) TrackRows(rows [][]string) [][]string {
+	for i, row := range rows {
+		delete(tracker.deletedAtByPrimaryKeys, pgRowPrimaryKey(tracker.pgSchemaColumns, tracker.primaryKeyIndexes, row))
+		rows[i] = append(row, PG_NULL_STRING)
+	}
+	return rows
+}
+
+// Returns tombstones for rows that are no longer present in PostgreSQL. Can be called only once
+func (tracker *DeleteTracker) DeletedRows() [][]string {
+	var rows [][]string
+
+	keys := make([]string, 0, len(tracker.deletedAtByPrimaryKeys))
+	for key := range tracker.deletedAtByPrimaryKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		row := make([]string, len(tracker.pgSchemaColumns)+1)
+		for i := range row {
+			row[i] = PG_NULL_STRING
+		}
+
+		primaryKeyValues := strings.Split(key, DELETE_TRACKER_KEY_SEPARATOR)
+		for i, index := range tracker.primaryKeyIndexes {
+			row[index] = primaryKeyValues[i]
+		}
+
+		deletedAt := tracker.deletedAtByPrimaryKeys[key]
+		if deletedAt == "" {
+			deletedAt = tracker.deletedAt
+		}
+		row[len(tracker.pgSchemaColumns)] = deletedAt
+
+		rows = append(rows, row)
+	}
+
+	tracker.deletedAtByPrimaryKeys = make(map[string]string)
+	return rows
+}
+
+func (tracker *DeleteTracker) isPrimaryKeyIndex(index int) bool {
+	for _, primaryKeyIndex := range tracker.primaryKeyIndexes {
+		if primaryKeyIndex == index {
+			return true
+		}
+	}
+	return false
+}
+
+func formatDeletedAt(deletedAt time.Time) string {
+	return TimeToPgTimestamptzString(deletedAt)
+}
+
+// Returns the indexes of the primary key columns, which must have types that can be compared between exported and Parquet values
+func pgPrimaryKeyIndexes(pgSchemaColumns []PgSchemaColumn, primaryKeyColumnNames []string) ([]int, error) {
+	if len(primaryKeyColumnNames) == 0 {
+		return nil, fmt.Errorf("table has no primary key")
+	}
+
+	var primaryKeyIndexes []int
+	for _, primaryKeyColumnName := range primaryKeyColumnNames {
+		index := -1
+		for i, pgSchemaColumn := range pgSchemaColumns {
+			if pgSchemaColumn.ColumnName == primaryKeyColumnName {
+				index = i
+				break
+			}
+		}
+
+		if index == -1 {
+			return nil, fmt.Errorf("primary key column %s not found", primaryKeyColumnName)
+		}
+		if pgSchemaColumns[index].DataType == PG_DATA_TYPE_ARRAY || !DELETE_TRACKER_PRIMARY_KEY_TYPES.Contains(pgSchemaColumns[index].UdtName) {
+			return nil, fmt.Errorf("unsupported primary key column type %s", pgSchemaColumns[index].UdtName)
+		}
+		primaryKeyIndexes = append(primaryKeyIndexes, index)
+	}
+	return primaryKeyIndexes, nil
+}
+
+// Returns the primary key of an exported row, with the padding of bpchar values removed like in Parquet unless it's kept
+func pgRowPrimaryKey(pgSchemaColumns []PgSchemaColumn, primaryKeyIndexes []int, row []string) string {
+	var primaryKeyValues []string
+	for _, index := range primaryKeyIndexes {
+		value := row[index]
+		if pgSchemaColumns[index].UdtName == "bpchar" && !pgSchemaColumns[index].KeepsCharPadding {
+			value = strings.TrimRight(value, " ")
+		}
+		primaryKeyValues = append(primaryKeyValues, value)
+	}
+	return strings.Join(primaryKeyValues, DELETE_TRACKER_KEY_SEPARATOR)
+}
+
+// Returns the exported values of the primary key columns of a row as they're written to Parquet
+func pgRowPrimaryKeyValues(primaryKeyIndexes []int, row []string) []string {
+	var primaryKeyValues []string
+	for _, index := range primaryKeyIndexes {
+		primaryKeyValues = append(primaryKeyValues, row[index])
+	}
+	return primaryKeyValues
+}
+
+// Returns the primary key of the primary key values read from Parquet, or false if any of them is NULL (e.g., in rows
+// written before the primary key was added). Values are formatted like exported PostgreSQL values
+func icebergRowPrimaryKey(pgSchemaColumns []PgSchemaColumn, primaryKeyIndexes []int, primaryKeyValues []interface{}) (string, bool) {
+	var values []string
+	for i, value := range primaryKeyValues {
+		if value == nil {
+			return "", false
+		}
+		values = append(values, icebergPrimaryKeyValue(pgSchemaColumns[primaryKeyIndexes[i]], value))
+	}
+	return strings.Join(values, DELETE_TRACKER_KEY_SEPARATOR), true
+}
+
+// Uuid values are stored as 16 bytes and exported by PostgreSQL in the canonical lowercase form
+func icebergPrimaryKeyValue(pgSchemaColumn PgSchemaColumn, value interface{}) string {
+	if pgSchemaColumn.UdtName == "uuid" {
+		var uuidBytes []byte
+		switch typedValue := value.(type) {
+		case string:
+			uuidBytes = []byte(typedValue)
+		case []byte:
+			uuidBytes = typedValue
+		}
+		uuidValue, err := uuid.FromBytes(uuidBytes)
+		PanicIfError(err)
+		return uuidValue.String()
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -4,11 +4,16 @@ import (
 	"bufio"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
-	_ "github.com/marcboeker/go-duckdb"
+	goDuckdb "github.com/marcboeker/go-duckdb"
 )
 
 var DEFAULT_BOOT_QUERIES = []string{
@@ -20,19 +25,116 @@ var DEFAULT_BOOT_QUERIES = []string{
 	"SET scalar_subquery_error_on_multiple_rows=false",
 }
 
+const (
+	DUCKDB_MAX_RECONNECT_ATTEMPTS = 3
+	DUCKDB_RECONNECT_DELAY        = 500 * time.Millisecond // multiplied by the attempt number
+)
+
+// Connection settings (e.g., USE and SET) apply only to the connection that runs them
+var DUCKDB_CONNECTION_QUERY_REGEXP = regexp.MustCompile(`(?i)^\s*(USE|SET)\s`)
+
+// SET statements passed to DuckDB from clients (e.g., SET timezone), keyed by the setting name
+var DUCKDB_SET_QUERY_REGEXP = regexp.MustCompile(`(?i)^\s*SET\s+(?:SESSION\s+|GLOBAL\s+)?"?([\w.]+)`)
+
+// Errors after which every query fails: DuckDB invalidates the database after a fatal error (e.g., a failed write to the temp directory)
+var DUCKDB_BROKEN_CONNECTION_ERROR_REGEXP = regexp.MustCompile(`(?i)(FATAL Error|database has been invalidated|connection has already been closed|sql: database is closed)`)
+
+// Queries run on a pool of connections to the same in-memory database, so schemas, tables, extensions, and secrets are shared,
+// while connection settings from the boot queries are applied to each new connection.
+// If the database breaks, it's reopened with the boot queries and the SET statements run so far, and the query runs again
 type Duckdb struct {
-	db     *sql.DB
-	config *Config
+	db                 *sql.DB
+	config             *Config
+	setQueries         map[string]string // the last SET statement of each setting, applied to each connection of a reopened database
+	mutex              sync.RWMutex      // db is replaced on reconnect
+	reconnectMutex     sync.Mutex        // only one query reopens a broken database
+	reconnectCallbacks []func()
 }
 
 func NewDuckdb(config *Config) *Duckdb {
-	ctx := context.Background()
-	db, err := sql.Open("duckdb", "")
+	duckdb := &Duckdb{config: config}
+
+	db, err := duckdb.open()
 	PanicIfError(err)
+	duckdb.db = db
 
-	duckdb := &Duckdb{
-		db:     db,
-		config: config,
+	return duckdb
+}
+
+// Registers a callback to recreate the state kept in the database, e.g., Iceberg schemas and tables, after it's reopened
+func (duckdb *Duckdb) OnReconnect(callback func()) {
+	duckdb.reconnectCallbacks = append(duckdb.reconnectCallbacks, callback)
+}
+
+func (duckdb *Duckdb) ExecContext(ctx context.Context, query string, args map[string]string) (result sql.Result, err error) {
+	LogComponentDebug(duckdb.config, LOG_COMPONENT_QUERY, "Querying DuckDB:", query, args)
+	err = duckdb.withReconnect(ctx, func(db *sql.DB) (err error) {
+		result, err = db.ExecContext(ctx, replaceNamedStringArgs(query, args))
+		return err
+	})
+	if err == nil {
+		duckdb.rememberSetQuery(query)
+	}
+	return result, err
+}
+
+func (duckdb *Duckdb) QueryContext(ctx context.Context, query string) (rows *sql.Rows, err error) {
+	LogComponentDebug(duckdb.config, LOG_COMPONENT_QUERY, "Querying DuckDB:", query)
+	err = duckdb.withReconnect(ctx, func(db *sql.DB) (err error) {
+		rows, err = db.QueryContext(ctx, query)
+		return err
+	})
+	if err == nil {
+		duckdb.rememberSetQuery(query)
+	}
+	return rows, err
+}
+
+func (duckdb *Duckdb) PrepareContext(ctx context.Context, query string) (statement *sql.Stmt, err error) {
+	LogComponentDebug(duckdb.config, LOG_COMPONENT_QUERY, "Preparing DuckDB statement:", query)
+	err = duckdb.withReconnect(ctx, func(db *sql.DB) (err error) {
+		statement, err = db.PrepareContext(ctx, query)
+		return err
+	})
+	return statement, err
+}
+
+func (duckdb *Duckdb) Close() {
+	duckdb.currentDb().Close()
+}
+
+// Opens a new in-memory database: applies the resource settings, runs the boot queries, creates the storage secrets,
+// and applies the SET statements run on the previous database
+func (duckdb *Duckdb) open() (db *sql.DB, err error) {
+	ctx := context.Background()
+	config := duckdb.config
+
+	var connectionQueries []string
+	connector, err := goDuckdb.NewConnector("", func(execer driver.ExecerContext) error {
+		for _, query := range connectionQueries {
+			LogComponentDebug(config, LOG_COMPONENT_QUERY, "Setting up DuckDB connection:", query)
+			_, err := execer.ExecContext(context.Background(), query, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db = sql.OpenDB(connector)
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+	// Boot queries run on a single connection, then the connection settings are applied to new connections
+	db.SetMaxOpenConns(1)
+
+	err = duckdb.applyResourceSettings(ctx, db)
+	if err != nil {
+		return nil, err
 	}
 
 	bootQueries := readDuckdbInitFile(config)
@@ -40,48 +142,208 @@ func NewDuckdb(config *Config) *Duckdb {
 		bootQueries = DEFAULT_BOOT_QUERIES
 	}
 	for _, query := range bootQueries {
-		_, err := duckdb.ExecContext(ctx, query, nil)
-		PanicIfError(err)
+		err = duckdb.execBootQuery(ctx, db, query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if DUCKDB_CONNECTION_QUERY_REGEXP.MatchString(query) {
+			connectionQueries = append(connectionQueries, query)
+		}
 	}
 
 	switch config.StorageType {
 	case STORAGE_TYPE_S3:
 		query := "CREATE SECRET aws_s3_secret (TYPE S3, KEY_ID '$accessKeyId', SECRET '$secretAccessKey', REGION '$region', ENDPOINT '$endpoint', SCOPE '$s3Bucket')"
-		_, err = duckdb.ExecContext(ctx, query, map[string]string{
+		err = duckdb.execBootQuery(ctx, db, query, map[string]string{
 			"accessKeyId":     config.Aws.AccessKeyId,
 			"secretAccessKey": config.Aws.SecretAccessKey,
 			"region":          config.Aws.Region,
 			"endpoint":        config.Aws.S3Endpoint,
 			"s3Bucket":        "s3://" + config.Aws.S3Bucket,
 		})
-		PanicIfError(err)
+		if err != nil {
+			return nil, err
+		}
 
-		if config.LogLevel == LOG_LEVEL_TRACE {
-			_, err = duckdb.ExecContext(ctx, "SET enable_http_logging=true", nil)
-			PanicIfError(err)
+		if IsLogLevelEnabled(config, LOG_COMPONENT_QUERY, LOG_LEVEL_TRACE) {
+			err = duckdb.execBootQuery(ctx, db, "SET enable_http_logging=true", nil)
+			if err != nil {
+				return nil, err
+			}
+			connectionQueries = append(connectionQueries, "SET enable_http_logging=true")
+		}
+	case STORAGE_TYPE_AZURE:
+		for _, query := range []string{"INSTALL azure", "LOAD azure"} {
+			err = duckdb.execBootQuery(ctx, db, query, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var query string
+		switch {
+		case config.Azure.AccountKey != "":
+			query = "CREATE SECRET azure_secret (TYPE AZURE, CONNECTION_STRING 'AccountName=$accountName;AccountKey=$accountKey;BlobEndpoint=$endpoint', SCOPE '$container')"
+		case config.Azure.SasToken != "":
+			query = "CREATE SECRET azure_secret (TYPE AZURE, CONNECTION_STRING 'BlobEndpoint=$endpoint;SharedAccessSignature=$sasToken', SCOPE '$container')"
+		default:
+			query = "CREATE SECRET azure_secret (TYPE AZURE, PROVIDER CREDENTIAL_CHAIN, CHAIN 'managed_identity', ACCOUNT_NAME '$accountName', SCOPE '$container')"
+		}
+		err = duckdb.execBootQuery(ctx, db, query, map[string]string{
+			"accountName": config.Azure.AccountName,
+			"accountKey":  config.Azure.AccountKey,
+			"sasToken":    strings.TrimPrefix(config.Azure.SasToken, "?"),
+			"endpoint":    config.Azure.Endpoint,
+			"container":   "az://" + config.Azure.Container,
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return duckdb
+	duckdb.mutex.RLock()
+	setQueries := make([]string, 0, len(duckdb.setQueries))
+	for _, query := range duckdb.setQueries {
+		setQueries = append(setQueries, query)
+	}
+	duckdb.mutex.RUnlock()
+	for _, query := range setQueries {
+		err = duckdb.execBootQuery(ctx, db, query, nil)
+		if err != nil {
+			return nil, err
+		}
+		connectionQueries = append(connectionQueries, query)
+	}
+
+	db.SetMaxOpenConns(config.MaxQueryConnections)
+	db.SetMaxIdleConns(config.MaxQueryConnections)
+	return db, nil
 }
 
-func (duckdb *Duckdb) ExecContext(ctx context.Context, query string, args map[string]string) (sql.Result, error) {
-	LogDebug(duckdb.config, "Querying DuckDB:", query, args)
-	return duckdb.db.ExecContext(ctx, replaceNamedStringArgs(query, args))
+// Memory limit, temp directory, and threads are settings of the whole database, so they're set once for all connections.
+// Queries exceeding the memory limit spill to the temp directory instead of running out of memory
+func (duckdb *Duckdb) applyResourceSettings(ctx context.Context, db *sql.DB) error {
+	if duckdb.config.Duckdb.MemoryLimit != "" {
+		err := duckdb.execBootQuery(ctx, db, "SET memory_limit='$memoryLimit'", map[string]string{"memoryLimit": duckdb.config.Duckdb.MemoryLimit})
+		if err != nil {
+			return err
+		}
+	}
+	if duckdb.config.Duckdb.TempDirectory != "" {
+		err := duckdb.execBootQuery(ctx, db, "SET temp_directory='$tempDirectory'", map[string]string{"tempDirectory": duckdb.config.Duckdb.TempDirectory})
+		if err != nil {
+			return err
+		}
+	}
+	if duckdb.config.Duckdb.Threads != 0 {
+		err := duckdb.execBootQuery(ctx, db, "SET threads=$threads", map[string]string{"threads": IntToString(duckdb.config.Duckdb.Threads)})
+		if err != nil {
+			return err
+		}
+	}
+
+	var memoryLimit, tempDirectory, threads string
+	err := db.QueryRowContext(ctx, "SELECT current_setting('memory_limit'), current_setting('temp_directory'), current_setting('threads')::VARCHAR").Scan(&memoryLimit, &tempDirectory, &threads)
+	if err != nil {
+		return err
+	}
+	LogComponentInfo(duckdb.config, LOG_COMPONENT_QUERY, "DuckDB: Memory limit:", memoryLimit, "Temp directory:", tempDirectory, "Threads:", threads)
+	return nil
 }
 
-func (duckdb *Duckdb) QueryContext(ctx context.Context, query string) (*sql.Rows, error) {
-	LogDebug(duckdb.config, "Querying DuckDB:", query)
-	return duckdb.db.QueryContext(ctx, query)
+func (duckdb *Duckdb) execBootQuery(ctx context.Context, db *sql.DB, query string, args map[string]string) error {
+	LogComponentDebug(duckdb.config, LOG_COMPONENT_QUERY, "Querying DuckDB:", query, args)
+	_, err := db.ExecContext(ctx, replaceNamedStringArgs(query, args))
+	return err
 }
 
-func (duckdb *Duckdb) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	LogDebug(duckdb.config, "Preparing DuckDB statement:", query)
-	return duckdb.db.PrepareContext(ctx, query)
+// Runs the query, and if the connection is broken, reopens the database and runs the query again a limited number of times
+func (duckdb *Duckdb) withReconnect(ctx context.Context, run func(db *sql.DB) error) error {
+	db := duckdb.currentDb()
+	err := run(db)
+
+	for attempt := 1; attempt <= DUCKDB_MAX_RECONNECT_ATTEMPTS && IsDuckdbConnectionBroken(err) && ctx.Err() == nil; attempt++ {
+		LogComponentWarn(duckdb.config, LOG_COMPONENT_QUERY, "DuckDB: Reconnecting after a broken connection (attempt "+IntToString(attempt)+" of "+IntToString(DUCKDB_MAX_RECONNECT_ATTEMPTS)+"):", err.Error())
+		newDb, reconnectErr := duckdb.reconnect(db)
+		if reconnectErr != nil {
+			LogComponentError(duckdb.config, LOG_COMPONENT_QUERY, "DuckDB: Couldn't reconnect:", reconnectErr.Error())
+			time.Sleep(DUCKDB_RECONNECT_DELAY * time.Duration(attempt))
+			continue
+		}
+		db = newDb
+		err = run(db)
+	}
+
+	return err
 }
 
-func (duckdb *Duckdb) Close() {
-	duckdb.db.Close()
+// Replaces the broken database with a new one, unless another query has already replaced it.
+// Settings that aren't passed to DuckDB, e.g., SET bemidb.as_of, are kept per client session, so they still apply
+func (duckdb *Duckdb) reconnect(brokenDb *sql.DB) (*sql.DB, error) {
+	duckdb.reconnectMutex.Lock()
+	if db := duckdb.currentDb(); db != brokenDb {
+		duckdb.reconnectMutex.Unlock()
+		return db, nil
+	}
+
+	db, err := duckdb.open()
+	if err != nil {
+		duckdb.reconnectMutex.Unlock()
+		return nil, err
+	}
+	duckdb.mutex.Lock()
+	duckdb.db = db
+	duckdb.mutex.Unlock()
+	duckdb.reconnectMutex.Unlock()
+
+	brokenDb.Close()
+	LogComponentInfo(duckdb.config, LOG_COMPONENT_QUERY, "DuckDB: Reconnected")
+
+	// Callbacks run after unlocking, their queries would wait for the reconnect to finish if the new database broke too
+	for _, callback := range duckdb.reconnectCallbacks {
+		err = duckdb.runReconnectCallback(callback)
+		if err != nil {
+			LogComponentError(duckdb.config, LOG_COMPONENT_QUERY, "DuckDB:", err.Error())
+		}
+	}
+	return db, nil
+}
+
+func (duckdb *Duckdb) runReconnectCallback(callback func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to set up the reopened DuckDB database: %v", r)
+		}
+	}()
+	callback()
+	return nil
+}
+
+func (duckdb *Duckdb) currentDb() *sql.DB {
+	duckdb.mutex.RLock()
+	defer duckdb.mutex.RUnlock()
+	return duckdb.db
+}
+
+func (duckdb *Duckdb) rememberSetQuery(query string) {
+	match := DUCKDB_SET_QUERY_REGEXP.FindStringSubmatch(query)
+	if match == nil {
+		return
+	}
+
+	duckdb.mutex.Lock()
+	defer duckdb.mutex.Unlock()
+	if duckdb.setQueries == nil {
+		duckdb.setQueries = make(map[string]string)
+	}
+	duckdb.setQueries[strings.ToLower(match[1])] = query
+}
+
+func IsDuckdbConnectionBroken(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || DUCKDB_BROKEN_CONNECTION_ERROR_REGEXP.MatchString(err.Error())
 }
 
 func replaceNamedStringArgs(query string, args map[string]string) string {
@@ -97,13 +359,13 @@ func readDuckdbInitFile(config *Config) []string {
 	_, err := os.Stat(config.InitSqlFilepath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			LogDebug(config, "DuckDB: No init file found at", config.InitSqlFilepath)
+			LogComponentDebug(config, LOG_COMPONENT_QUERY, "DuckDB: No init file found at", config.InitSqlFilepath)
 			return nil
 		}
 		PanicIfError(err)
 	}
 
-	LogInfo(config, "DuckDB: Reading init file", config.InitSqlFilepath)
+	LogComponentInfo(config, LOG_COMPONENT_QUERY, "DuckDB: Reading init file", config.InitSqlFilepath)
 	file, err := os.Open(config.InitSqlFilepath)
 	PanicIfError(err)
 	defer file.Close()
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	duckDb "github.com/marcboeker/go-duckdb"
+)
+
+const (
+	PG_INTERNAL_ERROR_CODE              = "XX000"
+	PG_SYNTAX_ERROR_OR_ACCESS_RULE_CODE = "42000"
+	PG_SYNTAX_ERROR_CODE                = "42601"
+	PG_UNDEFINED_FUNCTION_CODE          = "42883"
+	PG_UNDEFINED_OBJECT_CODE            = "42704"
+	PG_INVALID_SCHEMA_NAME_CODE         = "3F000"
+	PG_GROUPING_ERROR_CODE              = "42803"
+	PG_DATATYPE_MISMATCH_CODE           = "42804"
+	PG_CANNOT_COERCE_CODE               = "42846"
+	PG_INSUFFICIENT_PRIVILEGE_CODE      = "42501"
+	PG_NUMERIC_VALUE_OUT_OF_RANGE_CODE  = "22003"
+	PG_DIVISION_BY_ZERO_CODE            = "22012"
+	PG_OUT_OF_MEMORY_CODE               = "53200"
+)
+
+// Maps a DuckDB error to a PostgreSQL error if its type matches and its message matches the pattern (if any).
+// The message may reference the pattern groups, e.g., $1, and defaults to the DuckDB message without the error type prefix
+type duckdbErrorMapping struct {
+	errorType duckDb.ErrorType
+	pattern   *regexp.Regexp // optional
+	code      string
+	message   string // optional
+}
+
+// Checked in order, the first matching mapping is used
+var DUCKDB_ERROR_MAPPINGS = []duckdbErrorMapping{
+	{errorType: duckDb.ErrorTypeCatalog, pattern: regexp.MustCompile(`^Table with name (.+) does not exist!`), code: PG_UNDEFINED_TABLE_CODE, message: `relation "$1" does not exist`},
+	{errorType: duckDb.ErrorTypeCatalog, pattern: regexp.MustCompile(`^Schema with name (.+) does not exist!`), code: PG_INVALID_SCHEMA_NAME_CODE, message: `schema "$1" does not exist`},
+	{errorType: duckDb.ErrorTypeCatalog, pattern: regexp.MustCompile(`^(?:Scalar|Table|Aggregate|Pragma|Macro) Function with name (.+) does not exist!`), code: PG_UNDEFINED_FUNCTION_CODE, message: `function $1 does not exist`},
+	{errorType: duckDb.ErrorTypeCatalog, code: PG_UNDEFINED_OBJECT_CODE},
+	{errorType: duckDb.ErrorTypeBinder, pattern: regexp.MustCompile(`^Referenced column "(.+)" not found`), code: PG_UNDEFINED_COLUMN_CODE, message: `column "$1" does not exist`},
+	{errorType: duckDb.ErrorTypeBinder, pattern: regexp.MustCompile(`^Referenced table "(.+)" not found`), code: PG_UNDEFINED_TABLE_CODE, message: `missing FROM-clause entry for table "$1"`},
+	{errorType: duckDb.ErrorTypeBinder, pattern: regexp.MustCompile(`^(No function matches|Could not choose a best candidate function)`), code: PG_UNDEFINED_FUNCTION_CODE},
+	{errorType: duckDb.ErrorTypeBinder, pattern: regexp.MustCompile(`must appear in the GROUP BY clause`), code: PG_GROUPING_ERROR_CODE},
+	{errorType: duckDb.ErrorTypeBinder, code: PG_SYNTAX_ERROR_OR_ACCESS_RULE_CODE},
+	{errorType: duckDb.ErrorTypeParser, code: PG_SYNTAX_ERROR_CODE},
+	{errorType: duckDb.ErrorTypeSyntax, code: PG_SYNTAX_ERROR_CODE},
+	{errorType: duckDb.ErrorTypeConversion, pattern: regexp.MustCompile(`out of range`), code: PG_NUMERIC_VALUE_OUT_OF_RANGE_CODE},
+	{errorType: duckDb.ErrorTypeConversion, pattern: regexp.MustCompile(`^Unimplemented type for cast`), code: PG_CANNOT_COERCE_CODE},
+	{errorType: duckDb.ErrorTypeConversion, code: PG_INVALID_TEXT_REPRESENTATION_CODE},
+	{errorType: duckDb.ErrorTypeMismatchType, code: PG_DATATYPE_MISMATCH_CODE},
+	{errorType: duckDb.ErrorTypeInvalidType, code: PG_DATATYPE_MISMATCH_CODE},
+	{errorType: duckDb.ErrorTypeOutOfRange, code: PG_NUMERIC_VALUE_OUT_OF_RANGE_CODE},
+	{errorType: duckDb.ErrorTypeDivideByZero, code: PG_DIVISION_BY_ZERO_CODE},
+	{errorType: duckDb.ErrorTypeNotImplemented, code: PG_FEATURE_NOT_SUPPORTED_CODE},
+	{errorType: duckDb.ErrorTypePermission, code: PG_INSUFFICIENT_PRIVILEGE_CODE},
+	{errorType: duckDb.ErrorTypeOutOfMemory, code: PG_OUT_OF_MEMORY_CODE},
+	{errorType: duckDb.ErrorTypeInterrupt, code: PG_QUERY_CANCELED_CODE},
+}
+
+var DUCKDB_ERROR_HINT_REGEXP = regexp.MustCompile(`(?m)^Did you mean .+\?$`)
+
+// Converts DuckDB errors into PostgreSQL errors with an SQLSTATE code, so that clients can tell them apart.
+// Unmapped DuckDB errors become internal errors (XX000). The original DuckDB message is kept as the detail,
+// and DuckDB's suggestions, e.g., 'Did you mean "users"?', as the hint. Other errors are returned as-is
+func duckdbPgError(err error) error {
+	var duckdbError *duckDb.Error
+	if !errors.As(err, &duckdbError) {
+		return err
+	}
+
+	duckdbMessage, _, _ := strings.Cut(duckdbError.Msg, "\n")
+	if errorTypePrefix, message, found := strings.Cut(duckdbMessage, ": "); found && strings.HasSuffix(errorTypePrefix, "Error") {
+		duckdbMessage = message
+	}
+
+	pgError := &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     PG_INTERNAL_ERROR_CODE,
+		Message:  duckdbMessage,
+		Detail:   duckdbError.Msg,
+		Hint:     DUCKDB_ERROR_HINT_REGEXP.FindString(duckdbError.Msg),
+	}
+	for _, mapping := range DUCKDB_ERROR_MAPPINGS {
+		if mapping.errorType != duckdbError.Type {
+			continue
+		}
+
+		if mapping.pattern == nil {
+			pgError.Code = mapping.code
+			break
+		}
+		match := mapping.pattern.FindStringSubmatchIndex(duckdbMessage)
+		if match == nil {
+			continue
+		}
+		pgError.Code = mapping.code
+		if mapping.message != "" {
+			pgError.Message = string(mapping.pattern.ExpandString(nil, mapping.message, duckdbMessage, match))
+		}
+		break
+	}
+
+	return pgError
+}
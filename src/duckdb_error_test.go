@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	duckDb "github.com/marcboeker/go-duckdb"
+)
+
+func TestDuckdbPgError(t *testing.T) {
+	t.Run("Maps DuckDB errors to PostgreSQL errors", func(t *testing.T) {
+		for _, testCase := range []struct {
+			duckdbError     *duckDb.Error
+			expectedCode    string
+			expectedMessage string
+		}{
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeCatalog, Msg: "Catalog Error: Table with name userz does not exist!\nDid you mean \"users\"?\nLINE 1: SELECT * FROM userz\n                      ^"},
+				expectedCode:    "42P01",
+				expectedMessage: `relation "userz" does not exist`,
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeCatalog, Msg: "Catalog Error: Schema with name nosuch does not exist!"},
+				expectedCode:    "3F000",
+				expectedMessage: `schema "nosuch" does not exist`,
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeCatalog, Msg: "Catalog Error: Scalar Function with name foo does not exist!\nDid you mean \"floor\"?\nLINE 1: SELECT foo(1)\n               ^"},
+				expectedCode:    "42883",
+				expectedMessage: "function foo does not exist",
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeBinder, Msg: "Binder Error: Referenced column \"nme\" not found in FROM clause!\nCandidate bindings: \"users.name\"\nLINE 1: SELECT nme FROM users\n               ^"},
+				expectedCode:    "42703",
+				expectedMessage: `column "nme" does not exist`,
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeBinder, Msg: "Binder Error: Referenced table \"x\" not found!\nCandidate tables: \"users\"\nLINE 1: SELECT x.id FROM users\n               ^"},
+				expectedCode:    "42P01",
+				expectedMessage: `missing FROM-clause entry for table "x"`,
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeBinder, Msg: "Binder Error: No function matches the given name and argument types '+(INTEGER, INTEGER[])'. You might need to add explicit type casts.\n\tCandidate functions:\n\t+(TINYINT) -> TINYINT"},
+				expectedCode:    "42883",
+				expectedMessage: "No function matches the given name and argument types '+(INTEGER, INTEGER[])'. You might need to add explicit type casts.",
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeBinder, Msg: "Binder Error: column \"id\" must appear in the GROUP BY clause or must be part of an aggregate function.\nEither add it to the GROUP BY list"},
+				expectedCode:    "42803",
+				expectedMessage: `column "id" must appear in the GROUP BY clause or must be part of an aggregate function.`,
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeParser, Msg: "Parser Error: syntax error at or near \"SELEC\""},
+				expectedCode:    "42601",
+				expectedMessage: `syntax error at or near "SELEC"`,
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeConversion, Msg: "Conversion Error: Could not convert string 'abc' to INT32\nLINE 1: SELECT 'abc'::INT\n                    ^"},
+				expectedCode:    "22P02",
+				expectedMessage: "Could not convert string 'abc' to INT32",
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeConversion, Msg: "Conversion Error: Type INT32 with value 100000 can't be cast because the value is out of range for the destination type INT8"},
+				expectedCode:    "22003",
+				expectedMessage: "Type INT32 with value 100000 can't be cast because the value is out of range for the destination type INT8",
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeConversion, Msg: "Conversion Error: Unimplemented type for cast (INTEGER -> DATE)"},
+				expectedCode:    "42846",
+				expectedMessage: "Unimplemented type for cast (INTEGER -> DATE)",
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeMismatchType, Msg: "Mismatch Type Error: Type DATE does not match with INTEGER"},
+				expectedCode:    "42804",
+				expectedMessage: "Type DATE does not match with INTEGER",
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeOutOfRange, Msg: "Out of Range Error: Overflow in addition of INT32 (2147483647 + 1)!"},
+				expectedCode:    "22003",
+				expectedMessage: "Overflow in addition of INT32 (2147483647 + 1)!",
+			},
+			{
+				duckdbError:     &duckDb.Error{Type: duckDb.ErrorTypeIO, Msg: "IO Error: Cannot open file \"s3://bucket/data.parquet\": Permission denied"},
+				expectedCode:    "XX000",
+				expectedMessage: `Cannot open file "s3://bucket/data.parquet": Permission denied`,
+			},
+		} {
+			var pgError *pgconn.PgError
+			if !errors.As(duckdbPgError(testCase.duckdbError), &pgError) {
+				t.Fatalf("Expected a PostgreSQL error for %q", testCase.duckdbError.Msg)
+			}
+			if pgError.Severity != "ERROR" || pgError.Code != testCase.expectedCode {
+				t.Errorf("Expected the %s error code for %q, got %s", testCase.expectedCode, testCase.duckdbError.Msg, pgError.Code)
+			}
+			if pgError.Message != testCase.expectedMessage {
+				t.Errorf("Expected the message to be %q, got %q", testCase.expectedMessage, pgError.Message)
+			}
+			if pgError.Detail != testCase.duckdbError.Msg {
+				t.Errorf("Expected the detail to be the DuckDB message %q, got %q", testCase.duckdbError.Msg, pgError.Detail)
+			}
+		}
+	})
+
+	t.Run("Keeps DuckDB suggestions as the hint", func(t *testing.T) {
+		pgError := duckdbPgError(&duckDb.Error{Type: duckDb.ErrorTypeCatalog, Msg: "Catalog Error: Table with name userz does not exist!\nDid you mean \"users\"?\nLINE 1: SELECT * FROM userz\n                      ^"}).(*pgconn.PgError)
+		if pgError.Hint != `Did you mean "users"?` {
+			t.Errorf("Expected the hint to be 'Did you mean \"users\"?', got %q", pgError.Hint)
+		}
+
+		pgError = duckdbPgError(&duckDb.Error{Type: duckDb.ErrorTypeParser, Msg: "Parser Error: syntax error at or near \"SELEC\""}).(*pgconn.PgError)
+		if pgError.Hint != "" {
+			t.Errorf("Expected no hint, got %q", pgError.Hint)
+		}
+	})
+
+	t.Run("Returns other errors as-is", func(t *testing.T) {
+		err := errors.New("prepared statement mismatch")
+		if duckdbPgError(err) != err {
+			t.Errorf("Expected the error to be returned as-is, got %v", duckdbPgError(err))
+		}
+	})
+}
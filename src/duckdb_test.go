@@ -30,3 +30,195 @@ func TestNewDuckdb(t *testing.T) {
 		}
 	})
 }
+
+func TestDuckdbResourceSettings(t *testing.T) {
+	t.Run("Applies the memory limit, temp directory, and threads to all connections", func(t *testing.T) {
+		config := loadTestConfig()
+		config.MaxQueryConnections = 2
+		config.Duckdb.MemoryLimit = "512MiB"
+		config.Duckdb.TempDirectory = t.TempDir()
+		config.Duckdb.Threads = 2
+		duckdb := NewDuckdb(config)
+		defer duckdb.Close()
+		ctx := context.Background()
+
+		// Keeps each connection busy until its rows are closed
+		for i := 0; i < 2; i++ {
+			rows, err := duckdb.QueryContext(ctx, "SELECT current_setting('memory_limit'), current_setting('temp_directory'), current_setting('threads')::VARCHAR")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer rows.Close()
+			rows.Next()
+			var memoryLimit, tempDirectory, threads string
+			err = rows.Scan(&memoryLimit, &tempDirectory, &threads)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if memoryLimit != "512.0 MiB" {
+				t.Errorf("Expected memory limit to be 512.0 MiB, got %s", memoryLimit)
+			}
+			if tempDirectory != config.Duckdb.TempDirectory {
+				t.Errorf("Expected temp directory to be %s, got %s", config.Duckdb.TempDirectory, tempDirectory)
+			}
+			if threads != "2" {
+				t.Errorf("Expected threads to be 2, got %s", threads)
+			}
+		}
+	})
+}
+
+func TestDuckdbReadsCompressedParquetFiles(t *testing.T) {
+	t.Run("Reads data files written with each compression", func(t *testing.T) {
+		rows := compressionTestRows(1000)
+		config := loadTestConfig()
+		duckdb := NewDuckdb(config)
+		defer duckdb.Close()
+
+		for _, compression := range PARQUET_COMPRESSIONS {
+			parquetFile := writeCompressionTestParquetFile(t, compression, 0, rows)
+
+			result, err := duckdb.QueryContext(context.Background(), "SELECT COUNT(*), MAX(id) FROM read_parquet('"+parquetFile.Path+"')")
+			if err != nil {
+				t.Fatalf("Expected no error for the %s compression, got %v", compression, err)
+			}
+			result.Next()
+			var count, maxId int
+			err = result.Scan(&count, &maxId)
+			result.Close()
+			if err != nil {
+				t.Fatalf("Expected no error for the %s compression, got %v", compression, err)
+			}
+			if count != len(rows) || maxId != len(rows)-1 {
+				t.Errorf("Expected %d rows for the %s compression, got %d with max id %d", len(rows), compression, count, maxId)
+			}
+		}
+	})
+}
+
+func TestDuckdbReadsRowGroupsAndDictionaryEncodedParquetFiles(t *testing.T) {
+	t.Run("Reads data files written with different row group and encoding settings", func(t *testing.T) {
+		rows := encodingTestRows(5000)
+		config := loadTestConfig()
+		duckdb := NewDuckdb(config)
+		defer duckdb.Close()
+
+		for _, rowGroupRows := range []int{0, 1500} {
+			parquetFile := writeEncodingTestParquetFile(t, rowGroupRows, []string{"string", "date"}, rows)
+
+			result, err := duckdb.QueryContext(context.Background(), "SELECT COUNT(*), COUNT(DISTINCT category), MAX(created_on)::TEXT FROM read_parquet('"+parquetFile.Path+"')")
+			if err != nil {
+				t.Fatalf("Expected no error for %d rows per row group, got %v", rowGroupRows, err)
+			}
+			result.Next()
+			var count, categoryCount int
+			var maxCreatedOn string
+			err = result.Scan(&count, &categoryCount, &maxCreatedOn)
+			result.Close()
+			if err != nil {
+				t.Fatalf("Expected no error for %d rows per row group, got %v", rowGroupRows, err)
+			}
+			if count != len(rows) || categoryCount != 3 || maxCreatedOn != "2024-01-09" {
+				t.Errorf("Expected %d rows with 3 categories up to 2024-01-09 for %d rows per row group, got %d rows with %d categories up to %s", len(rows), rowGroupRows, count, categoryCount, maxCreatedOn)
+			}
+		}
+	})
+}
+
+func TestDuckdbConnectionPool(t *testing.T) {
+	t.Run("Applies connection settings and shares tables across pooled connections", func(t *testing.T) {
+		config := loadTestConfig()
+		config.MaxQueryConnections = 2
+		duckdb := NewDuckdb(config)
+		defer duckdb.Close()
+		ctx := context.Background()
+		_, err := duckdb.ExecContext(ctx, "CREATE TABLE test_pool (id INTEGER)", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Keeps each connection busy until its rows are closed
+		var values []string
+		for i := 0; i < 2; i++ {
+			rows, err := duckdb.QueryContext(ctx, "SELECT current_schema() || ',' || current_setting('scalar_subquery_error_on_multiple_rows') || ',' || COUNT(*) FROM test_pool")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer rows.Close()
+			rows.Next()
+			var value string
+			err = rows.Scan(&value)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			values = append(values, value)
+		}
+
+		if duckdb.db.Stats().OpenConnections != 2 {
+			t.Errorf("Expected 2 open connections, got %d", duckdb.db.Stats().OpenConnections)
+		}
+		for _, value := range values {
+			if value != "public,false,0" {
+				t.Errorf("Expected public,false,0 on each connection, got %s", value)
+			}
+		}
+	})
+}
+
+func TestDuckdbReconnect(t *testing.T) {
+	t.Run("Reopens a broken database with the boot queries and SET statements, and runs the query again", func(t *testing.T) {
+		config := loadTestConfig()
+		duckdb := NewDuckdb(config)
+		defer duckdb.Close()
+		ctx := context.Background()
+		reconnectCount := 0
+		duckdb.OnReconnect(func() { reconnectCount++ })
+		_, err := duckdb.ExecContext(ctx, "SET default_order = 'DESC'", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		brokenDb := duckdb.db
+		brokenDb.Close()
+
+		var value string
+		rows, err := duckdb.QueryContext(ctx, "SELECT current_schema() || ',' || current_setting('scalar_subquery_error_on_multiple_rows') || ',' || current_setting('default_order')")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer rows.Close()
+		rows.Next()
+		err = rows.Scan(&value)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if value != "public,false,desc" {
+			t.Errorf("Expected public,false,desc, got %s", value)
+		}
+		if duckdb.db == brokenDb {
+			t.Errorf("Expected the broken database to be replaced")
+		}
+		if reconnectCount != 1 {
+			t.Errorf("Expected 1 reconnect, got %d", reconnectCount)
+		}
+	})
+
+	t.Run("Doesn't reconnect after query errors", func(t *testing.T) {
+		config := loadTestConfig()
+		duckdb := NewDuckdb(config)
+		defer duckdb.Close()
+		reconnectCount := 0
+		duckdb.OnReconnect(func() { reconnectCount++ })
+		db := duckdb.db
+
+		_, err := duckdb.QueryContext(context.Background(), "SELECT * FROM non_existent_table")
+
+		if err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+		if duckdb.db != db || reconnectCount != 0 {
+			t.Errorf("Expected no reconnect, got %d", reconnectCount)
+		}
+	})
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+const (
+	// String bounds are truncated like in the default truncate(16) metrics mode of other Iceberg implementations
+	ICEBERG_BOUND_STRING_LENGTH = 16
+
+	// Snapshots whose manifests have bounds compared as typed values. Bounds of older snapshots were merged across row groups
+	// by comparing their bytes, so data files are only pruned by the bounds of snapshots with this summary property
+	ICEBERG_SNAPSHOT_SUMMARY_TYPED_BOUNDS = "bemidb.typed-column-bounds"
+)
+
+// Returns the Iceberg type that bounds of the Parquet column are serialized as, or "" if it has no bounds. Binary values can be
+// arbitrarily large (e.g., images), unsigned integers don't sort like Iceberg integers, and NaN values of floating-point numbers
+// aren't excluded from Parquet statistics
+func parquetColumnBoundType(schemaElement *parquet.SchemaElement) string {
+	if schemaElement.Type == nil {
+		return ""
+	}
+
+	switch schemaElement.GetType() {
+	case parquet.Type_BOOLEAN:
+		return "boolean"
+	case parquet.Type_INT32:
+		if schemaElement.ConvertedType == nil {
+			return "int"
+		}
+		switch schemaElement.GetConvertedType() {
+		case parquet.ConvertedType_INT_8, parquet.ConvertedType_INT_16, parquet.ConvertedType_INT_32:
+			return "int"
+		case parquet.ConvertedType_DATE:
+			return "date"
+		case parquet.ConvertedType_TIME_MILLIS:
+			return "time"
+		}
+	case parquet.Type_INT64:
+		if schemaElement.ConvertedType == nil {
+			return "long"
+		}
+		switch schemaElement.GetConvertedType() {
+		case parquet.ConvertedType_INT_64:
+			return "long"
+		case parquet.ConvertedType_TIME_MICROS:
+			return "time"
+		case parquet.ConvertedType_TIMESTAMP_MILLIS, parquet.ConvertedType_TIMESTAMP_MICROS:
+			return "timestamp"
+		}
+	case parquet.Type_BYTE_ARRAY:
+		if schemaElement.ConvertedType != nil && schemaElement.GetConvertedType() == parquet.ConvertedType_UTF8 {
+			return "string"
+		}
+	case parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		if isParquetDecimalSchemaElement(schemaElement) {
+			return "decimal(" + IntToString(int(schemaElement.GetPrecision())) + ", " + IntToString(int(schemaElement.GetScale())) + ")"
+		}
+		if isParquetUuidSchemaElement(schemaElement) {
+			return "uuid"
+		}
+	}
+	return ""
+}
+
+// Decodes a plain-encoded min or max value of Parquet statistics into a bound value: int64 for integers, dates, and times and
+// timestamps in microseconds, *big.Rat for decimals, and strings, booleans, or UUID bytes. Nil if it can't be decoded
+func parquetStatisticBoundValue(schemaElement *parquet.SchemaElement, statistic []byte) interface{} {
+	switch boundType := parquetColumnBoundType(schemaElement); boundType {
+	case "boolean":
+		if len(statistic) == 1 {
+			return statistic[0] != 0
+		}
+	case "int", "date", "time", "long", "timestamp":
+		var value int64
+		switch {
+		case len(statistic) == 4 && schemaElement.GetType() == parquet.Type_INT32:
+			value = int64(int32(binary.LittleEndian.Uint32(statistic)))
+		case len(statistic) == 8 && schemaElement.GetType() == parquet.Type_INT64:
+			value = int64(binary.LittleEndian.Uint64(statistic))
+		default:
+			return nil
+		}
+		if schemaElement.ConvertedType != nil && (schemaElement.GetConvertedType() == parquet.ConvertedType_TIME_MILLIS || schemaElement.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MILLIS) {
+			value *= 1000
+		}
+		return value
+	case "string":
+		return string(statistic)
+	case "uuid":
+		if len(statistic) == PARQUET_UUID_LENGTH {
+			return statistic
+		}
+	case "":
+		return nil
+	default:
+		if decimal := decodeIcebergDecimal(statistic, int(schemaElement.GetScale())); decimal != nil {
+			return decimal
+		}
+	}
+	return nil
+}
+
+// Serializes the lower and upper bound values of a column with the Iceberg single-value serialization. Strings are truncated, and
+// the upper bound is left out (nil) for strings whose truncated prefix can't be incremented
+func icebergColumnBounds(boundType string, lowerValue interface{}, upperValue interface{}) (lowerBound []byte, upperBound []byte) {
+	if boundType == "string" {
+		lowerString, ok := truncateIcebergLowerBound(lowerValue.(string))
+		if !ok {
+			return nil, nil
+		}
+		lowerBound = []byte(lowerString)
+		if upperString, ok := truncateIcebergUpperBound(upperValue.(string)); ok {
+			upperBound = []byte(upperString)
+		}
+		return lowerBound, upperBound
+	}
+	return icebergBoundBytes(boundType, lowerValue), icebergBoundBytes(boundType, upperValue)
+}
+
+func icebergBoundBytes(boundType string, value interface{}) []byte {
+	switch boundType {
+	case "boolean":
+		if value.(bool) {
+			return []byte{1}
+		}
+		return []byte{0}
+	case "int", "date":
+		return binary.LittleEndian.AppendUint32(nil, uint32(int32(value.(int64))))
+	case "long", "time", "timestamp":
+		return binary.LittleEndian.AppendUint64(nil, uint64(value.(int64)))
+	case "uuid":
+		return value.([]byte)
+	default:
+		_, scale, ok := parseIcebergDecimalType(boundType)
+		if !ok {
+			return nil
+		}
+		return encodeIcebergDecimal(value.(*big.Rat), scale)
+	}
+}
+
+// Decodes a bound serialized with the Iceberg single-value serialization for a column of the type into a value compared with
+// compareIcebergBoundValues. Integers are decoded from 4 or 8 bytes, since int columns can be promoted to long. Nil if it's missing
+func icebergBoundValue(icebergType string, bound []byte) interface{} {
+	if bound == nil {
+		return nil
+	}
+
+	switch icebergType {
+	case "int", "long", "date", "time", "timestamp", "timestamptz":
+		switch len(bound) {
+		case 4:
+			return int64(int32(binary.LittleEndian.Uint32(bound)))
+		case 8:
+			return int64(binary.LittleEndian.Uint64(bound))
+		}
+	case "string":
+		return string(bound)
+	case "uuid":
+		return bound
+	case "boolean":
+		if len(bound) == 1 {
+			return bound[0] != 0
+		}
+	default:
+		if _, scale, ok := parseIcebergDecimalType(icebergType); ok && len(bound) > 0 {
+			return decodeIcebergDecimal(bound, scale)
+		}
+	}
+	return nil
+}
+
+// Compares bound values of the same type. Returns false if they can't be compared
+func compareIcebergBoundValues(value interface{}, otherValue interface{}) (comparison int, ok bool) {
+	switch typedValue := value.(type) {
+	case []byte:
+		if typedOtherValue, ok := otherValue.([]byte); ok {
+			return bytes.Compare(typedValue, typedOtherValue), true
+		}
+	case *big.Rat:
+		if typedOtherValue, ok := otherValue.(*big.Rat); ok {
+			return typedValue.Cmp(typedOtherValue), true
+		}
+	}
+	return compareIcebergPartitionValues(value, otherValue)
+}
+
+// Truncated lower bounds are prefixes of the values, which sort before them. Returns false for invalid UTF-8 strings
+func truncateIcebergLowerBound(value string) (string, bool) {
+	if !utf8.ValidString(value) {
+		return "", false
+	}
+	runes := []rune(value)
+	if len(runes) <= ICEBERG_BOUND_STRING_LENGTH {
+		return value, true
+	}
+	return string(runes[:ICEBERG_BOUND_STRING_LENGTH]), true
+}
+
+// Truncated upper bounds are prefixes of the values with their last character incremented, which sort after them. Returns false if
+// no character of the prefix can be incremented or for invalid UTF-8 strings
+func truncateIcebergUpperBound(value string) (string, bool) {
+	if !utf8.ValidString(value) {
+		return "", false
+	}
+	runes := []rune(value)
+	if len(runes) <= ICEBERG_BOUND_STRING_LENGTH {
+		return value, true
+	}
+
+	runes = runes[:ICEBERG_BOUND_STRING_LENGTH]
+	for i := len(runes) - 1; i >= 0; i-- {
+		nextRune := runes[i] + 1
+		if nextRune >= 0xD800 && nextRune <= 0xDFFF { // UTF-16 surrogates aren't valid characters
+			nextRune = 0xE000
+		}
+		if nextRune <= unicode.MaxRune {
+			runes[i] = nextRune
+			return string(runes[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+// Returns the precision and scale of an Iceberg decimal type, e.g. "decimal(10, 2)"
+func parseIcebergDecimalType(icebergType string) (precision int, scale int, ok bool) {
+	_, err := fmt.Sscanf(icebergType, "decimal(%d, %d)", &precision, &scale)
+	return precision, scale, err == nil
+}
+
+// Decimals are stored as unscaled two's-complement big-endian integers
+func decodeIcebergDecimal(data []byte, scale int) *big.Rat {
+	if len(data) == 0 {
+		return nil
+	}
+	unscaledValue := new(big.Int).SetBytes(data)
+	if data[0]&0x80 != 0 {
+		unscaledValue.Sub(unscaledValue, new(big.Int).Lsh(big.NewInt(1), uint(len(data)*8)))
+	}
+	return new(big.Rat).SetFrac(unscaledValue, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+}
+
+// Iceberg serializes decimals with the minimum number of bytes for their unscaled value
+func encodeIcebergDecimal(value *big.Rat, scale int) []byte {
+	unscaledValue := new(big.Int).Mul(value.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	unscaledValue.Quo(unscaledValue, value.Denom())
+
+	magnitude := unscaledValue
+	if unscaledValue.Sign() < 0 {
+		magnitude = new(big.Int).Not(unscaledValue)
+	}
+	length := magnitude.BitLen()/8 + 1
+	twosComplement := new(big.Int).Mod(unscaledValue, new(big.Int).Lsh(big.NewInt(1), uint(length*8)))
+	return twosComplement.FillBytes(make([]byte, length))
+}
+
+// Pruning
+
+type icebergBoundsSchema struct {
+	SchemaId int `json:"schema-id"`
+	Fields   []struct {
+		Id   int         `json:"id"`
+		Name string      `json:"name"`
+		Type interface{} `json:"type"`
+	} `json:"fields"`
+}
+
+// Returns true if data files can be pruned by the bounds of the column. Floating-point numbers have no bounds, and values of
+// other types are either compared differently by DuckDB (e.g., intervals or JSON) or can't be converted from query constants
+func canPruneIcebergBounds(pgSchemaColumn PgSchemaColumn) bool {
+	if pgSchemaColumn.isList() {
+		return false
+	}
+
+	switch pgSchemaColumn.UdtName {
+	case "int2", "int4", "int8", "date", "uuid", "text", "varchar":
+		return true
+	case "timestamp", "timestamptz":
+		return isIcebergTimestampType(pgSchemaColumn.icebergPrimitiveType())
+	case "numeric":
+		return pgSchemaColumn.isDecimal()
+	}
+	return false
+}
+
+// Returns the columns with predicates that the data files of the snapshot can be pruned by with their bounds by field ID.
+// Columns whose type in the snapshot schema differs from the table columns are skipped, since their bounds have another type
+func icebergBoundColumns(snapshot map[string]interface{}, schemas []icebergBoundsSchema, currentSchemaId int, pgSchemaColumns []PgSchemaColumn, predicates []ColumnPredicate) map[int32]PgSchemaColumn {
+	summary, _ := snapshot["summary"].(map[string]interface{})
+	if summary[ICEBERG_SNAPSHOT_SUMMARY_TYPED_BOUNDS] != "true" {
+		return nil
+	}
+
+	schemaId := currentSchemaId
+	if snapshotSchemaId, ok := snapshot["schema-id"].(json.Number); ok {
+		id, err := snapshotSchemaId.Int64()
+		if err != nil {
+			return nil
+		}
+		schemaId = int(id)
+	}
+
+	boundColumns := make(map[int32]PgSchemaColumn)
+	for _, schema := range schemas {
+		if schema.SchemaId != schemaId {
+			continue
+		}
+		for _, pgSchemaColumn := range pgSchemaColumns {
+			if !canPruneIcebergBounds(pgSchemaColumn) || !slices.ContainsFunc(predicates, func(predicate ColumnPredicate) bool { return predicate.ColumnName == pgSchemaColumn.ColumnName }) {
+				continue
+			}
+			for _, field := range schema.Fields {
+				if field.Name == pgSchemaColumn.ColumnName && field.Type == pgSchemaColumn.icebergPrimitiveType() {
+					boundColumns[int32(field.Id)] = pgSchemaColumn
+				}
+			}
+		}
+	}
+	return boundColumns
+}
+
+// Returns false if no row of the data file can satisfy the predicates on the columns by their lower and upper bounds. Missing bounds
+// match all values, and data files whose values of a column are all NULL never match since comparisons with NULL aren't true
+func icebergDataFileBoundsMatch(boundColumns map[int32]PgSchemaColumn, dataFile map[string]interface{}, predicates []ColumnPredicate) bool {
+	lowerBounds := icebergAvroFieldMap[[]byte](dataFile["lower_bounds"])
+	upperBounds := icebergAvroFieldMap[[]byte](dataFile["upper_bounds"])
+	valueCounts := icebergAvroFieldMap[int64](dataFile["value_counts"])
+	nullValueCounts := icebergAvroFieldMap[int64](dataFile["null_value_counts"])
+
+	for fieldId, pgSchemaColumn := range boundColumns {
+		valueCount, hasValueCount := valueCounts[fieldId]
+		nullValueCount, hasNullValueCount := nullValueCounts[fieldId]
+		isAllNull := hasValueCount && hasNullValueCount && nullValueCount == valueCount
+
+		icebergType := pgSchemaColumn.icebergPrimitiveType()
+		lowerValue := icebergBoundValue(icebergType, lowerBounds[fieldId])
+		upperValue := icebergBoundValue(icebergType, upperBounds[fieldId])
+		for _, predicate := range predicates {
+			if predicate.ColumnName == pgSchemaColumn.ColumnName && (isAllNull || !icebergBoundsMatchPredicate(pgSchemaColumn, lowerValue, upperValue, predicate)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func icebergBoundsMatchPredicate(pgSchemaColumn PgSchemaColumn, lowerValue interface{}, upperValue interface{}, predicate ColumnPredicate) (matches bool) {
+	defer func() {
+		if recover() != nil {
+			matches = true
+		}
+	}()
+
+	// Constants are compared with a margin, since timestamps are read in the session time zone and decimals can be rounded to the scale
+	predicateValue := func(value string, direction int64) interface{} {
+		boundValue := icebergBoundPredicateValue(pgSchemaColumn, value)
+		switch typedValue := boundValue.(type) {
+		case int64:
+			if isIcebergTimestampType(pgSchemaColumn.icebergPrimitiveType()) {
+				return typedValue + direction*ICEBERG_PARTITION_PRUNING_MARGIN_MICROS
+			}
+		case *big.Rat:
+			_, scale := pgSchemaColumn.decimalPrecisionAndScale()
+			margin := new(big.Rat).SetFrac(big.NewInt(direction), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+			return new(big.Rat).Add(typedValue, margin)
+		}
+		return boundValue
+	}
+	isInRange := func(fromValue interface{}, toValue interface{}) bool {
+		if lowerValue != nil && toValue != nil {
+			if comparison, ok := compareIcebergBoundValues(lowerValue, toValue); ok && comparison > 0 {
+				return false
+			}
+		}
+		if upperValue != nil && fromValue != nil {
+			if comparison, ok := compareIcebergBoundValues(upperValue, fromValue); ok && comparison < 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Ranges are inclusive since truncated bounds and margins don't tell whether values equal to them exist
+	switch predicate.Operator {
+	case "=", "IN":
+		for _, value := range predicate.Values {
+			if isInRange(predicateValue(value, -1), predicateValue(value, 1)) {
+				return true
+			}
+		}
+		return false
+	case "<", "<=":
+		return isInRange(nil, predicateValue(predicate.Values[0], 1))
+	case ">", ">=":
+		return isInRange(predicateValue(predicate.Values[0], -1), nil)
+	case "BETWEEN":
+		return isInRange(predicateValue(predicate.Values[0], -1), predicateValue(predicate.Values[1], 1))
+	}
+	return true
+}
+
+// Converts a query constant into a value compared with the bounds of the column, or nil if it can't be converted
+func icebergBoundPredicateValue(pgSchemaColumn PgSchemaColumn, value string) interface{} {
+	switch icebergType := pgSchemaColumn.icebergPrimitiveType(); icebergType {
+	case "int", "long":
+		integer, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return integer
+	case "date":
+		return int64(pgSchemaColumn.FormatParquetValue(value).(int32))
+	case "timestamp", "timestamptz":
+		return icebergPartitionSourceValue(pgSchemaColumn, value)
+	case "string", "uuid":
+		return pgSchemaColumn.FormatParquetValue(value)
+	default:
+		decimal, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return nil
+		}
+		return decimal
+	}
+}
+
+// Returns the values of an Avro union of an array of key-value records by their field ID keys, e.g. lower bounds of a data file
+func icebergAvroFieldMap[T any](value interface{}) map[int32]T {
+	fieldMap := make(map[int32]T)
+	union, _ := value.(map[string]interface{})
+	items, _ := union["array"].([]interface{})
+	for _, item := range items {
+		record, _ := item.(map[string]interface{})
+		key, isKey := record["key"].(int32)
+		fieldValue, isValue := record["value"].(T)
+		if isKey && isValue {
+			fieldMap[key] = fieldValue
+		}
+	}
+	return fieldMap
+}
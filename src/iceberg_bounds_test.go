@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+)
+
+var BOUNDS_TEST_PG_SCHEMA_COLUMNS = []PgSchemaColumn{
+	{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog", PrimaryKeyPosition: 1},
+	{ColumnName: "price", DataType: "numeric", UdtName: "numeric", IsNullable: "YES", OrdinalPosition: "2", NumericPrecision: "10", NumericScale: "2", Namespace: "pg_catalog"},
+	{ColumnName: "created_at", DataType: "timestamp without time zone", UdtName: "timestamp", IsNullable: "YES", OrdinalPosition: "3", DatetimePrecision: "3", Namespace: "pg_catalog"},
+	{ColumnName: "note", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "4", Namespace: "pg_catalog"},
+	{ColumnName: "data", DataType: "bytea", UdtName: "bytea", IsNullable: "YES", OrdinalPosition: "5", Namespace: "pg_catalog"},
+	{ColumnName: "ratio", DataType: "double precision", UdtName: "float8", IsNullable: "YES", OrdinalPosition: "6", NumericPrecision: "53", Namespace: "pg_catalog"},
+}
+
+var BOUNDS_TEST_START_TIME = time.Date(2024, 1, 1, 0, 0, 0, 123000000, time.UTC)
+
+func boundsTestRows(firstId int, rowCount int) [][]string {
+	rows := make([][]string, rowCount)
+	for i := range rows {
+		id := firstId + i
+		rows[i] = []string{
+			IntToString(id),
+			IntToString(id) + ".25",
+			BOUNDS_TEST_START_TIME.Add(time.Duration(id) * time.Hour).Format("2006-01-02 15:04:05.999"),
+			fmt.Sprintf("%05d is a long note about the row", max(id, 0)),
+			"\\x0102",
+			"0.5",
+		}
+	}
+	return rows
+}
+
+func TestReadParquetStatsBounds(t *testing.T) {
+	rows := boundsTestRows(-7, 5000)
+	rows[4000][1] = "-12.50"
+	config := loadTestConfig()
+	config.Iceberg.RowGroupRows = 1500
+	storage := NewLocalStorage(config)
+	loaded := false
+	parquetFile, err := storage.CreateParquet(t.TempDir(), BOUNDS_TEST_PG_SCHEMA_COLUMNS, func() [][]string {
+		if loaded {
+			return [][]string{}
+		}
+		loaded = true
+		return rows
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	fileReader, err := local.NewLocalFileReader(parquetFile.Path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	stats, err := storage.storageBase.ReadParquetStats(fileReader)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("merges integer bounds of row groups as numbers", func(t *testing.T) {
+		lowerBound, upperBound := stats.LowerBounds[1], stats.UpperBounds[1]
+		if !bytes.Equal(lowerBound, binary.LittleEndian.AppendUint32(nil, uint32(0xFFFFFFF9))) || !bytes.Equal(upperBound, binary.LittleEndian.AppendUint32(nil, 4992)) {
+			t.Errorf("Expected id bounds -7 and 4992, got %v and %v", lowerBound, upperBound)
+		}
+	})
+
+	t.Run("serializes decimal bounds with the minimum number of bytes", func(t *testing.T) {
+		lowerBound, upperBound := stats.LowerBounds[2], stats.UpperBounds[2]
+		if !bytes.Equal(lowerBound, []byte{0xFB, 0x1E}) || !bytes.Equal(upperBound, []byte{0x07, 0x9E, 0x19}) {
+			t.Errorf("Expected price bounds -12.50 and 4992.25 as unscaled two's-complement bytes, got %x and %x", lowerBound, upperBound)
+		}
+	})
+
+	t.Run("converts timestamp bounds in milliseconds to microseconds", func(t *testing.T) {
+		expectedLowerBound := binary.LittleEndian.AppendUint64(nil, uint64(BOUNDS_TEST_START_TIME.Add(-7*time.Hour).UnixMicro()))
+		expectedUpperBound := binary.LittleEndian.AppendUint64(nil, uint64(BOUNDS_TEST_START_TIME.Add(4992*time.Hour).UnixMicro()))
+		if !bytes.Equal(stats.LowerBounds[3], expectedLowerBound) || !bytes.Equal(stats.UpperBounds[3], expectedUpperBound) {
+			t.Errorf("Expected created_at bounds %v and %v, got %v and %v", expectedLowerBound, expectedUpperBound, stats.LowerBounds[3], stats.UpperBounds[3])
+		}
+	})
+
+	t.Run("truncates string bounds", func(t *testing.T) {
+		lowerBound, upperBound := string(stats.LowerBounds[4]), string(stats.UpperBounds[4])
+		if lowerBound != "00000 is a long " || upperBound != "04992 is a long!" {
+			t.Errorf("Expected note bounds %q and %q, got %q and %q", "00000 is a long ", "04992 is a long!", lowerBound, upperBound)
+		}
+	})
+
+	t.Run("writes no bounds of binary and floating-point columns", func(t *testing.T) {
+		for _, fieldID := range []int{5, 6} {
+			if stats.LowerBounds[fieldID] != nil || stats.UpperBounds[fieldID] != nil {
+				t.Errorf("Expected no bounds of field %d, got %v and %v", fieldID, stats.LowerBounds[fieldID], stats.UpperBounds[fieldID])
+			}
+		}
+		if stats.ValueCounts[5] != int64(len(rows)) || stats.NullValueCounts[5] != 0 {
+			t.Errorf("Expected %d values without NULLs of the data column, got %d values and %d NULLs", len(rows), stats.ValueCounts[5], stats.NullValueCounts[5])
+		}
+	})
+}
+
+func TestIcebergBoundSerialization(t *testing.T) {
+	t.Run("round-trips decimals", func(t *testing.T) {
+		expectedBytes := map[string][]byte{"0": {0x00}, "1.27": {0x7F}, "1.28": {0x00, 0x80}, "-1.28": {0x80}, "-1.29": {0xFF, 0x7F}}
+		for value, expected := range expectedBytes {
+			decimal, _ := new(big.Rat).SetString(value)
+
+			encoded := encodeIcebergDecimal(decimal, 2)
+
+			if !bytes.Equal(encoded, expected) {
+				t.Errorf("Expected %s to be serialized as %x, got %x", value, expected, encoded)
+			}
+			if decoded := decodeIcebergDecimal(encoded, 2); decoded.Cmp(decimal) != 0 {
+				t.Errorf("Expected %x to be deserialized as %s, got %s", encoded, value, decoded.FloatString(2))
+			}
+		}
+	})
+
+	t.Run("truncates upper bounds of strings to a greater prefix", func(t *testing.T) {
+		upperBound, ok := truncateIcebergUpperBound(strings.Repeat("a", 15) + "\U0010FFFF\U0010FFFF")
+		if !ok || upperBound != strings.Repeat("a", 14)+"b" {
+			t.Errorf("Expected the last incrementable character to be incremented, got %q", upperBound)
+		}
+
+		_, ok = truncateIcebergUpperBound(strings.Repeat("\U0010FFFF", 17))
+		if ok {
+			t.Errorf("Expected no upper bound if no character can be incremented")
+		}
+
+		upperBound, ok = truncateIcebergUpperBound("short")
+		if !ok || upperBound != "short" {
+			t.Errorf("Expected short strings to be kept, got %q", upperBound)
+		}
+	})
+}
+
+func TestIcebergBoundsPruning(t *testing.T) {
+	config := loadTestConfig()
+	icebergWriter := NewIcebergWriter(config)
+	storage := NewLocalStorage(config)
+	schemaTable := IcebergSchemaTable{Schema: "test_bounds_pruning", Table: "test_table"}
+	defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+	// 10 data files with 100 rows each, the first with IDs 0-99
+	loaded := false
+	icebergWriter.Write(context.Background(), schemaTable, BOUNDS_TEST_PG_SCHEMA_COLUMNS, func() [][]string {
+		if loaded {
+			return [][]string{}
+		}
+		loaded = true
+		return boundsTestRows(0, 100)
+	})
+	for i := 1; i < 10; i++ {
+		loaded := false
+		_, err := icebergWriter.Append(context.Background(), schemaTable, BOUNDS_TEST_PG_SCHEMA_COLUMNS, func() ([][]string, error) {
+			if loaded {
+				return [][]string{}, nil
+			}
+			loaded = true
+			return boundsTestRows(i*100, 100), nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	dataFiles, err := storage.IcebergDataFiles(schemaTable)
+	if err != nil || len(dataFiles) != 10 {
+		t.Fatalf("Expected 10 data files, got %d (%v)", len(dataFiles), err)
+	}
+	metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+	PanicIfError(err)
+	metadataContent, err := os.ReadFile(metadataPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	scannedDataFiles := func(metadataContent []byte, predicates []ColumnPredicate) (dataFileCount int, prunedMetadataPath string) {
+		prunedMetadataPath, err := PruneIcebergMetadata(metadataContent, 0, predicates, storage.ReadIcebergTableFile, t.TempDir())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if prunedMetadataPath == "" {
+			return len(dataFiles), ""
+		}
+		prunedMetadataContent, err := os.ReadFile(prunedMetadataPath)
+		if err != nil {
+			t.Fatalf("Expected the pruned metadata to be written, got %v", err)
+		}
+		dataFilePaths, _, _, err := storage.storageBase.CurrentSnapshotFilePaths(prunedMetadataContent, storage.ReadIcebergTableFile)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return len(dataFilePaths), prunedMetadataPath
+	}
+
+	t.Run("prunes all data files but one for a point query", func(t *testing.T) {
+		dataFileCount, prunedMetadataPath := scannedDataFiles(metadataContent, []ColumnPredicate{{ColumnName: "id", Operator: "=", Values: []string{"123"}}})
+
+		if dataFileCount != 1 {
+			t.Fatalf("Expected 1 of 10 data files to be scanned, got %d", dataFileCount)
+		}
+		if prunedMetadataPath == "" {
+			t.Errorf("Expected the pruned metadata to be written")
+		}
+	})
+
+	t.Run("prunes data files by ranges of decimals, timestamps, and strings", func(t *testing.T) {
+		predicates := map[string]ColumnPredicate{
+			"price BETWEEN 250 AND 299":        {ColumnName: "price", Operator: "BETWEEN", Values: []string{"250", "299"}},
+			"created_at > the row with ID 900": {ColumnName: "created_at", Operator: ">", Values: []string{BOUNDS_TEST_START_TIME.Add(900 * time.Hour).Format("2006-01-02 15:04:05")}},
+			"note IN notes of IDs 42 and 999":  {ColumnName: "note", Operator: "IN", Values: []string{"00042 is a long note about the row", "00999 is a long note about the row"}},
+		}
+		expectedDataFileCounts := map[string]int{
+			"price BETWEEN 250 AND 299":        1,
+			"created_at > the row with ID 900": 2, // with a day of margin
+			"note IN notes of IDs 42 and 999":  2,
+		}
+		for name, predicate := range predicates {
+			dataFileCount, _ := scannedDataFiles(metadataContent, []ColumnPredicate{predicate})
+			if dataFileCount != expectedDataFileCounts[name] {
+				t.Errorf("Expected %d data files to be scanned for %s, got %d", expectedDataFileCounts[name], name, dataFileCount)
+			}
+		}
+	})
+
+	t.Run("keeps all data files of snapshots without typed bounds", func(t *testing.T) {
+		untypedMetadataContent := []byte(strings.ReplaceAll(string(metadataContent), ICEBERG_SNAPSHOT_SUMMARY_TYPED_BOUNDS, "bemidb.other"))
+
+		_, prunedMetadataPath := scannedDataFiles(untypedMetadataContent, []ColumnPredicate{{ColumnName: "id", Operator: "=", Values: []string{"123"}}})
+
+		if prunedMetadataPath != "" {
+			t.Errorf("Expected no pruning, got %s", prunedMetadataPath)
+		}
+	})
+}
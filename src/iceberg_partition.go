@@ -0,0 +1,1053 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/linkedin/goavro"
+)
+
+const (
+	ICEBERG_PARTITION_TRANSFORM_IDENTITY = "identity"
+	ICEBERG_PARTITION_TRANSFORM_YEAR     = "year"
+	ICEBERG_PARTITION_TRANSFORM_MONTH    = "month"
+	ICEBERG_PARTITION_TRANSFORM_DAY      = "day"
+	ICEBERG_PARTITION_TRANSFORM_BUCKET   = "bucket"
+
+	ICEBERG_PARTITION_FIELD_ID_START = 1000 // partition field IDs are assigned after the ones reserved for data files
+
+	// Timestamp literals of queries are read in the session time zone, so time partitions are pruned with a day of margin
+	ICEBERG_PARTITION_PRUNING_MARGIN_MICROS = 24 * 60 * 60 * 1000000
+
+	ICEBERG_PRUNED_METADATA_DIR_NAME     = "bemidb-pruned-metadata"     // in the temporary directory
+	ICEBERG_RECONCILED_METADATA_DIR_NAME = "bemidb-reconciled-metadata" // in the temporary directory
+)
+
+var ICEBERG_PARTITION_TRANSFORMS = []string{
+	ICEBERG_PARTITION_TRANSFORM_IDENTITY,
+	ICEBERG_PARTITION_TRANSFORM_YEAR,
+	ICEBERG_PARTITION_TRANSFORM_MONTH,
+	ICEBERG_PARTITION_TRANSFORM_DAY,
+	ICEBERG_PARTITION_TRANSFORM_BUCKET + "[N]",
+}
+
+// Iceberg types of the columns that each transform can partition by
+var ICEBERG_PARTITION_SOURCE_TYPES = map[string][]string{
+	ICEBERG_PARTITION_TRANSFORM_IDENTITY: {"int", "long", "string", "boolean", "date"},
+	ICEBERG_PARTITION_TRANSFORM_YEAR:     {"date", "timestamp", "timestamptz"},
+	ICEBERG_PARTITION_TRANSFORM_MONTH:    {"date", "timestamp", "timestamptz"},
+	ICEBERG_PARTITION_TRANSFORM_DAY:      {"date", "timestamp", "timestamptz"},
+	ICEBERG_PARTITION_TRANSFORM_BUCKET:   {"int", "long", "string", "date", "timestamp", "timestamptz", "uuid"},
+}
+
+// Column that a table is partitioned by with --iceberg-partition-by, e.g. "day(created_at)", "bucket[16](user_id)", or "status"
+type IcebergPartitionBy struct {
+	ColumnName string
+	Transform  string // identity, year, month, day, or bucket[N]
+}
+
+// Parses "transform(column)", or "column" for the identity transform
+func ParseIcebergPartitionBy(value string) (partitionBy IcebergPartitionBy, err error) {
+	transform, columnName, hasTransform := strings.Cut(value, "(")
+	if !hasTransform {
+		transform, columnName = ICEBERG_PARTITION_TRANSFORM_IDENTITY, value+")"
+	}
+	columnName, isClosed := strings.CutSuffix(columnName, ")")
+	if !isClosed || columnName == "" || strings.ContainsAny(columnName, "()") {
+		return IcebergPartitionBy{}, fmt.Errorf("invalid partition column in %s", value)
+	}
+	if _, ok := ICEBERG_PARTITION_SOURCE_TYPES[icebergPartitionTransformName(transform)]; !ok {
+		return IcebergPartitionBy{}, fmt.Errorf("invalid partition transform %s", transform)
+	}
+	if icebergPartitionTransformName(transform) == ICEBERG_PARTITION_TRANSFORM_BUCKET {
+		if _, ok := icebergBucketCount(transform); !ok {
+			return IcebergPartitionBy{}, fmt.Errorf("invalid bucket count in %s", transform)
+		}
+	}
+
+	return IcebergPartitionBy{ColumnName: columnName, Transform: transform}, nil
+}
+
+func (partitionBy IcebergPartitionBy) String() string {
+	return partitionBy.Transform + "(" + partitionBy.ColumnName + ")"
+}
+
+// Partition spec of an Iceberg table. Tables are partitioned by at most one column, unpartitioned tables have no fields
+type IcebergPartitionSpec struct {
+	SpecId int                     `json:"spec-id"`
+	Fields []IcebergPartitionField `json:"fields"`
+}
+
+type IcebergPartitionField struct {
+	Name       string `json:"name"`
+	Transform  string `json:"transform"`
+	SourceId   int    `json:"source-id"`
+	FieldId    int    `json:"field-id"`
+	ResultType string `json:"-"` // Iceberg type of the partition values: int, long, string, boolean, or date
+}
+
+// Lower and upper bounds of the partition values of a manifest's files, which are recorded in the manifest list
+type IcebergPartitionFieldSummary struct {
+	ContainsNull bool
+	LowerBound   []byte // nil if all values are NULL
+	UpperBound   []byte
+}
+
+// Returns an error if the column can't be partitioned by the transform
+func checkIcebergPartitionTransform(pgSchemaColumn PgSchemaColumn, transform string) error {
+	if pgSchemaColumn.isList() {
+		return fmt.Errorf("column %s is an array", pgSchemaColumn.ColumnName)
+	}
+	icebergType := pgSchemaColumn.icebergPrimitiveType()
+	if !slices.Contains(ICEBERG_PARTITION_SOURCE_TYPES[icebergPartitionTransformName(transform)], icebergType) {
+		return fmt.Errorf("column %s of type %s can't be partitioned by %s. Must be one of %s", pgSchemaColumn.ColumnName, icebergType, transform, strings.Join(ICEBERG_PARTITION_SOURCE_TYPES[icebergPartitionTransformName(transform)], ", "))
+	}
+	return nil
+}
+
+// Returns the index of the column with a partition transform, or -1 if the table isn't partitioned
+func icebergPartitionColumnIndex(pgSchemaColumns []PgSchemaColumn) int {
+	return slices.IndexFunc(pgSchemaColumns, func(pgSchemaColumn PgSchemaColumn) bool { return pgSchemaColumn.PartitionTransform != "" })
+}
+
+// Returns the fields of the table partition spec without their IDs, which are assigned when committing a snapshot.
+// Fields are named like in other Iceberg implementations, e.g. "created_at_day" or "status" for the identity transform
+func icebergPartitionFields(pgSchemaColumns []PgSchemaColumn) []IcebergPartitionField {
+	index := icebergPartitionColumnIndex(pgSchemaColumns)
+	if index == -1 {
+		return []IcebergPartitionField{}
+	}
+
+	pgSchemaColumn := pgSchemaColumns[index]
+	sourceId, err := StringToInt(pgSchemaColumn.OrdinalPosition)
+	PanicIfError(err)
+	name := pgSchemaColumn.ColumnName
+	resultType := pgSchemaColumn.icebergPrimitiveType()
+	if transformName := icebergPartitionTransformName(pgSchemaColumn.PartitionTransform); transformName != ICEBERG_PARTITION_TRANSFORM_IDENTITY {
+		name += "_" + transformName
+		resultType = "int"
+	}
+	return []IcebergPartitionField{{Name: name, Transform: pgSchemaColumn.PartitionTransform, SourceId: sourceId, ResultType: resultType}}
+}
+
+// Returns the partition fields of the PostgreSQL columns recorded in the table properties
+func icebergTablePartitionFields(properties map[string]string) ([]IcebergPartitionField, error) {
+	pgSchemaColumns, err := icebergTablePgSchemaColumns(properties)
+	if err != nil {
+		return nil, err
+	}
+	return icebergPartitionFields(pgSchemaColumns), nil
+}
+
+// Returns the PostgreSQL columns recorded in the table properties, or none for tables synced before they were recorded
+func icebergTablePgSchemaColumns(properties map[string]string) (pgSchemaColumns []PgSchemaColumn, err error) {
+	pgSchemaColumnsJson, ok := properties[ICEBERG_PROPERTY_PG_SCHEMA_COLUMNS]
+	if !ok {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(pgSchemaColumnsJson), &pgSchemaColumns); err != nil {
+		return nil, fmt.Errorf("failed to parse PostgreSQL columns: %v", err)
+	}
+	return pgSchemaColumns, nil
+}
+
+// Describes how the table is partitioned for logs, e.g. "day(created_at)"
+func icebergPartitionDescription(pgSchemaColumns []PgSchemaColumn) string {
+	index := icebergPartitionColumnIndex(pgSchemaColumns)
+	if index == -1 {
+		return "unpartitioned"
+	}
+	return IcebergPartitionBy{ColumnName: pgSchemaColumns[index].ColumnName, Transform: pgSchemaColumns[index].PartitionTransform}.String()
+}
+
+// Returns true if the fields partition tables the same way, regardless of their field IDs
+func isSameIcebergPartitionFields(fields []IcebergPartitionField, otherFields []IcebergPartitionField) bool {
+	return slices.EqualFunc(fields, otherFields, func(field IcebergPartitionField, otherField IcebergPartitionField) bool {
+		return field.Name == otherField.Name && field.Transform == otherField.Transform && field.SourceId == otherField.SourceId
+	})
+}
+
+// "bucket[16]" -> "bucket", other transforms are returned as they are
+func icebergPartitionTransformName(transform string) string {
+	if strings.HasPrefix(transform, ICEBERG_PARTITION_TRANSFORM_BUCKET+"[") {
+		return ICEBERG_PARTITION_TRANSFORM_BUCKET
+	}
+	return transform
+}
+
+func icebergBucketCount(transform string) (bucketCount int, ok bool) {
+	countValue, isBucket := strings.CutPrefix(transform, ICEBERG_PARTITION_TRANSFORM_BUCKET+"[")
+	countValue, isClosed := strings.CutSuffix(countValue, "]")
+	bucketCount, err := strconv.Atoi(countValue)
+	if !isBucket || !isClosed || err != nil || bucketCount <= 0 {
+		return 0, false
+	}
+	return bucketCount, true
+}
+
+// Returns the partition value of a row value of the column with a partition transform
+func icebergPartitionValue(pgSchemaColumn PgSchemaColumn, value string) interface{} {
+	return icebergPartitionTransformValue(pgSchemaColumn.PartitionTransform, icebergPartitionSourceValue(pgSchemaColumn, value))
+}
+
+// Returns the value that partition transforms are applied to: int32 for int and date values, int64 for long values and
+// timestamps in microseconds, and strings, booleans, or UUID bytes as they are written to Parquet. Nil for NULL values
+func icebergPartitionSourceValue(pgSchemaColumn PgSchemaColumn, value string) interface{} {
+	parquetValue := pgSchemaColumn.FormatParquetValue(value)
+	switch typedValue := parquetValue.(type) {
+	case uint64:
+		if pgSchemaColumn.icebergPrimitiveType() == "int" {
+			return int32(typedValue)
+		}
+		return int64(typedValue)
+	case int64:
+		if isIcebergTimestampType(pgSchemaColumn.icebergPrimitiveType()) && !pgSchemaColumn.hasMicrosecondPrecision() {
+			return typedValue * 1000
+		}
+	}
+	return parquetValue
+}
+
+func isIcebergTimestampType(icebergType string) bool {
+	return icebergType == "timestamp" || icebergType == "timestamptz"
+}
+
+// Applies the transform as defined by the Iceberg spec: time transforms return the number of years, months, or days since
+// 1970-01-01 and the bucket transform returns the Murmur3 hash of the value modulo the number of buckets
+func icebergPartitionTransformValue(transform string, sourceValue interface{}) interface{} {
+	if sourceValue == nil {
+		return nil
+	}
+
+	switch icebergPartitionTransformName(transform) {
+	case ICEBERG_PARTITION_TRANSFORM_YEAR, ICEBERG_PARTITION_TRANSFORM_MONTH, ICEBERG_PARTITION_TRANSFORM_DAY:
+		var days int64
+		var utcTime time.Time
+		switch typedValue := sourceValue.(type) {
+		case int32:
+			days = int64(typedValue)
+			utcTime = time.Unix(days*86400, 0).UTC()
+		case int64:
+			days = typedValue / 86400000000
+			if typedValue%86400000000 < 0 {
+				days--
+			}
+			utcTime = time.UnixMicro(typedValue).UTC()
+		}
+		switch transform {
+		case ICEBERG_PARTITION_TRANSFORM_YEAR:
+			return int32(utcTime.Year() - 1970)
+		case ICEBERG_PARTITION_TRANSFORM_MONTH:
+			return int32((utcTime.Year()-1970)*12 + int(utcTime.Month()) - 1)
+		default:
+			return int32(days)
+		}
+	case ICEBERG_PARTITION_TRANSFORM_BUCKET:
+		bucketCount, _ := icebergBucketCount(transform)
+		var hashedBytes []byte
+		switch typedValue := sourceValue.(type) {
+		case int32:
+			hashedBytes = binary.LittleEndian.AppendUint64(nil, uint64(int64(typedValue)))
+		case int64:
+			hashedBytes = binary.LittleEndian.AppendUint64(nil, uint64(typedValue))
+		case string:
+			hashedBytes = []byte(typedValue)
+		case []byte:
+			hashedBytes = typedValue
+		}
+		return int32((icebergMurmur3Hash(hashedBytes) & math.MaxInt32) % int32(bucketCount))
+	}
+	return sourceValue
+}
+
+// MurmurHash3 x86 32-bit with seed 0, which the Iceberg bucket transform hashes values with
+func icebergMurmur3Hash(data []byte) int32 {
+	const c1, c2 uint32 = 0xcc9e2d51, 0x1b873593
+
+	var hash uint32
+	length := len(data)
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data) * c1
+		hash ^= bits.RotateLeft32(k, 15) * c2
+		hash = bits.RotateLeft32(hash, 13)*5 + 0xe6546b64
+	}
+
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		hash ^= bits.RotateLeft32(k*c1, 15) * c2
+	}
+
+	hash ^= uint32(length)
+	hash ^= hash >> 16
+	hash *= 0x85ebca6b
+	hash ^= hash >> 13
+	hash *= 0xc2b2ae35
+	hash ^= hash >> 16
+	return int32(hash)
+}
+
+// Compares partition values of the same type. Returns false if they can't be compared
+func compareIcebergPartitionValues(value interface{}, otherValue interface{}) (comparison int, ok bool) {
+	switch typedValue := value.(type) {
+	case int32:
+		if typedOtherValue, ok := otherValue.(int32); ok {
+			return int(max(-1, min(1, int64(typedValue)-int64(typedOtherValue)))), true
+		}
+	case int64:
+		if typedOtherValue, ok := otherValue.(int64); ok {
+			if typedValue == typedOtherValue {
+				return 0, true
+			} else if typedValue < typedOtherValue {
+				return -1, true
+			}
+			return 1, true
+		}
+	case string:
+		if typedOtherValue, ok := otherValue.(string); ok {
+			return strings.Compare(typedValue, typedOtherValue), true
+		}
+	case bool:
+		if typedOtherValue, ok := otherValue.(bool); ok {
+			if typedValue == typedOtherValue {
+				return 0, true
+			} else if typedOtherValue {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// Groups the files by their partition values in the order of the first file of each partition
+func groupParquetFilesByPartition(parquetFiles []ParquetFile) [][]ParquetFile {
+	var partitionValues []interface{}
+	partitionFiles := make(map[interface{}][]ParquetFile)
+	for _, parquetFile := range parquetFiles {
+		if _, ok := partitionFiles[parquetFile.PartitionValue]; !ok {
+			partitionValues = append(partitionValues, parquetFile.PartitionValue)
+		}
+		partitionFiles[parquetFile.PartitionValue] = append(partitionFiles[parquetFile.PartitionValue], parquetFile)
+	}
+
+	groups := make([][]ParquetFile, len(partitionValues))
+	for i, partitionValue := range partitionValues {
+		groups[i] = partitionFiles[partitionValue]
+	}
+	return groups
+}
+
+// Manifests
+
+// Returns the manifest schema with the partition tuple of the spec, which is omitted for unpartitioned tables
+func icebergManifestSchema(partitionSpec IcebergPartitionSpec) (string, error) {
+	if len(partitionSpec.Fields) == 0 {
+		return MANIFEST_SCHEMA, nil
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(MANIFEST_SCHEMA), &schema); err != nil {
+		return "", err
+	}
+
+	partitionFields := []interface{}{}
+	for _, field := range partitionSpec.Fields {
+		partitionFields = append(partitionFields, map[string]interface{}{
+			"name":     icebergAvroName(field.Name),
+			"type":     []interface{}{"null", icebergPartitionAvroType(field.ResultType)},
+			"default":  nil,
+			"field-id": field.FieldId,
+		})
+	}
+	partitionField := map[string]interface{}{
+		"name":     "partition",
+		"type":     map[string]interface{}{"type": "record", "name": "r102", "fields": partitionFields},
+		"doc":      "Partition data tuple, schema based on the partition spec",
+		"field-id": 102,
+	}
+
+	for _, field := range schema["fields"].([]interface{}) {
+		field := field.(map[string]interface{})
+		if field["name"] != "data_file" {
+			continue
+		}
+		dataFileType := field["type"].(map[string]interface{})
+		dataFileFields := dataFileType["fields"].([]interface{})
+		index := slices.IndexFunc(dataFileFields, func(dataFileField interface{}) bool {
+			return dataFileField.(map[string]interface{})["name"] == "file_format"
+		})
+		dataFileType["fields"] = slices.Insert(dataFileFields, index+1, interface{}(partitionField))
+	}
+
+	schemaJson, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return string(schemaJson), nil
+}
+
+// Avro names can only contain letters, digits, and underscores and can't start with a digit.
+// Other characters are replaced with "_x" and their hex code like in other Iceberg implementations
+func icebergAvroName(name string) string {
+	var avroName strings.Builder
+	for i, character := range name {
+		isValid := character < unicode.MaxASCII && (unicode.IsLetter(character) || character == '_' || (i > 0 && unicode.IsDigit(character)))
+		switch {
+		case isValid:
+			avroName.WriteRune(character)
+		case i == 0 && character < unicode.MaxASCII && unicode.IsDigit(character):
+			avroName.WriteString("_" + string(character))
+		default:
+			avroName.WriteString("_x" + strings.ToUpper(strconv.FormatInt(int64(character), 16)))
+		}
+	}
+	return avroName.String()
+}
+
+func icebergPartitionAvroType(resultType string) string {
+	switch resultType {
+	case "int", "date":
+		return "int"
+	}
+	return resultType
+}
+
+// Returns the partition tuple of a data file for the manifest
+func icebergPartitionAvroRecord(partitionSpec IcebergPartitionSpec, partitionValue interface{}) map[string]interface{} {
+	record := map[string]interface{}{}
+	for _, field := range partitionSpec.Fields {
+		if partitionValue == nil {
+			record[icebergAvroName(field.Name)] = nil
+		} else {
+			record[icebergAvroName(field.Name)] = map[string]interface{}{icebergPartitionAvroType(field.ResultType): partitionValue}
+		}
+	}
+	return record
+}
+
+// Returns the partition value of a partition tuple read from a manifest, nil for NULL values and unpartitioned tables
+func icebergPartitionAvroValue(record interface{}) interface{} {
+	partition, _ := record.(map[string]interface{})
+	for _, value := range partition {
+		if union, ok := value.(map[string]interface{}); ok {
+			for _, unionValue := range union {
+				return unionValue
+			}
+		}
+	}
+	return nil
+}
+
+// Serializes a partition value with the Iceberg single-value serialization for manifest list bounds
+func icebergPartitionBound(value interface{}) []byte {
+	switch typedValue := value.(type) {
+	case int32:
+		return binary.LittleEndian.AppendUint32(nil, uint32(typedValue))
+	case int64:
+		return binary.LittleEndian.AppendUint64(nil, uint64(typedValue))
+	case string:
+		return []byte(typedValue)
+	case bool:
+		if typedValue {
+			return []byte{1}
+		}
+		return []byte{0}
+	}
+	return nil
+}
+
+// Returns the summary of the partition values of the files for the manifest list, none for unpartitioned tables
+func icebergPartitionFieldSummaries(partitionSpec IcebergPartitionSpec, parquetFiles []ParquetFile) []IcebergPartitionFieldSummary {
+	summaries := []IcebergPartitionFieldSummary{}
+	for range partitionSpec.Fields {
+		var summary IcebergPartitionFieldSummary
+		var lowerValue, upperValue interface{}
+		for _, parquetFile := range parquetFiles {
+			if parquetFile.PartitionValue == nil {
+				summary.ContainsNull = true
+				continue
+			}
+			if comparison, ok := compareIcebergPartitionValues(parquetFile.PartitionValue, lowerValue); !ok || comparison < 0 {
+				lowerValue = parquetFile.PartitionValue
+			}
+			if comparison, ok := compareIcebergPartitionValues(parquetFile.PartitionValue, upperValue); !ok || comparison > 0 {
+				upperValue = parquetFile.PartitionValue
+			}
+		}
+		summary.LowerBound = icebergPartitionBound(lowerValue)
+		summary.UpperBound = icebergPartitionBound(upperValue)
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// Pruning
+
+// Returns false if no row of the partition can satisfy the predicates on the column with the partition transform.
+// Predicates on other columns, operators that the transform doesn't preserve, and values that can't be converted to the column type
+// match all partitions. NULL partitions never match since comparisons with NULL aren't true
+func icebergPartitionMatches(pgSchemaColumn PgSchemaColumn, partitionValue interface{}, predicates []ColumnPredicate) bool {
+	for _, predicate := range predicates {
+		if predicate.ColumnName == pgSchemaColumn.ColumnName && !icebergPartitionMatchesPredicate(pgSchemaColumn, partitionValue, predicate) {
+			return false
+		}
+	}
+	return true
+}
+
+func icebergPartitionMatchesPredicate(pgSchemaColumn PgSchemaColumn, partitionValue interface{}, predicate ColumnPredicate) (matches bool) {
+	if partitionValue == nil {
+		return false
+	}
+	defer func() {
+		if recover() != nil {
+			matches = true
+		}
+	}()
+
+	transform := pgSchemaColumn.PartitionTransform
+	var marginMicros int64
+	if isIcebergTimestampType(pgSchemaColumn.icebergPrimitiveType()) {
+		if icebergPartitionTransformName(transform) == ICEBERG_PARTITION_TRANSFORM_BUCKET {
+			return true
+		}
+		marginMicros = ICEBERG_PARTITION_PRUNING_MARGIN_MICROS
+	}
+	transformValue := func(value string, offsetMicros int64) interface{} {
+		sourceValue := icebergPartitionSourceValue(pgSchemaColumn, value)
+		if micros, ok := sourceValue.(int64); ok && marginMicros > 0 {
+			sourceValue = micros + offsetMicros
+		}
+		return icebergPartitionTransformValue(transform, sourceValue)
+	}
+	isInRange := func(lowerValue interface{}, upperValue interface{}) bool {
+		if lowerValue != nil {
+			if comparison, ok := compareIcebergPartitionValues(partitionValue, lowerValue); ok && comparison < 0 {
+				return false
+			}
+		}
+		if upperValue != nil {
+			if comparison, ok := compareIcebergPartitionValues(partitionValue, upperValue); ok && comparison > 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	if icebergPartitionTransformName(transform) == ICEBERG_PARTITION_TRANSFORM_BUCKET {
+		if predicate.Operator != "=" && predicate.Operator != "IN" {
+			return true
+		}
+		for _, value := range predicate.Values {
+			if bucket := transformValue(value, 0); bucket == nil || bucket == partitionValue {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Ranges are inclusive since transforms map multiple values to the same partition
+	switch predicate.Operator {
+	case "=", "IN":
+		for _, value := range predicate.Values {
+			if isInRange(transformValue(value, -marginMicros), transformValue(value, marginMicros)) {
+				return true
+			}
+		}
+		return false
+	case "<", "<=":
+		return isInRange(nil, transformValue(predicate.Values[0], marginMicros))
+	case ">", ">=":
+		return isInRange(transformValue(predicate.Values[0], -marginMicros), nil)
+	case "BETWEEN":
+		return isInRange(transformValue(predicate.Values[0], -marginMicros), transformValue(predicate.Values[1], marginMicros))
+	}
+	return true
+}
+
+// Writes a copy of the metadata, manifest list, and data manifests of the snapshot (0 for the current one) without the data files
+// whose partitions or column bounds can't match the predicates to a directory in tempDir, which DuckDB scans instead of the table
+// metadata. Returns the path of the metadata copy, or an empty path if no data files can be pruned. Copies only depend on the
+// metadata, snapshot, and remaining data files, so they are written once and reused by queries pruning the same data files.
+// At least one data file is kept, and delete manifests are kept as they are since their files only apply to the remaining ones
+func PruneIcebergMetadata(metadataContent []byte, snapshotId int64, predicates []ColumnPredicate, readFile func(path string) ([]byte, error), tempDir string) (prunedMetadataPath string, err error) {
+	var metadata struct {
+		CurrentSnapshotId *json.Number             `json:"current-snapshot-id"`
+		CurrentSchemaId   int                      `json:"current-schema-id"`
+		DefaultSpecId     int                      `json:"default-spec-id"`
+		PartitionSpecs    []IcebergPartitionSpec   `json:"partition-specs"`
+		Properties        map[string]string        `json:"properties"`
+		Schemas           []icebergBoundsSchema    `json:"schemas"`
+		Snapshots         []map[string]interface{} `json:"snapshots"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	if err := decoder.Decode(&metadata); err != nil {
+		return "", fmt.Errorf("failed to parse metadata: %v", err)
+	}
+
+	pgSchemaColumns, err := icebergTablePgSchemaColumns(metadata.Properties)
+	if err != nil {
+		return "", err
+	}
+	// Partitions are pruned if the table is partitioned by the column of a predicate with the current partition spec
+	var partitionSpec *IcebergPartitionSpec
+	var partitionColumn PgSchemaColumn
+	specIndex := slices.IndexFunc(metadata.PartitionSpecs, func(spec IcebergPartitionSpec) bool { return spec.SpecId == metadata.DefaultSpecId })
+	partitionColumnIndex := icebergPartitionColumnIndex(pgSchemaColumns)
+	if specIndex != -1 && partitionColumnIndex != -1 && isSameIcebergPartitionFields(metadata.PartitionSpecs[specIndex].Fields, icebergPartitionFields(pgSchemaColumns)) {
+		partitionColumn = pgSchemaColumns[partitionColumnIndex]
+		if slices.ContainsFunc(predicates, func(predicate ColumnPredicate) bool { return predicate.ColumnName == partitionColumn.ColumnName }) {
+			partitionSpec = &metadata.PartitionSpecs[specIndex]
+		}
+	}
+
+	snapshotIdValue := json.Number(strconv.FormatInt(snapshotId, 10))
+	if snapshotId == 0 {
+		if metadata.CurrentSnapshotId == nil {
+			return "", nil
+		}
+		snapshotIdValue = *metadata.CurrentSnapshotId
+	}
+	snapshotIndex := slices.IndexFunc(metadata.Snapshots, func(snapshot map[string]interface{}) bool { return snapshot["snapshot-id"] == snapshotIdValue })
+	if snapshotIndex == -1 {
+		return "", fmt.Errorf("snapshot %s not found in metadata", snapshotIdValue)
+	}
+	boundColumns := icebergBoundColumns(metadata.Snapshots[snapshotIndex], metadata.Schemas, metadata.CurrentSchemaId, pgSchemaColumns, predicates)
+	if partitionSpec == nil && len(boundColumns) == 0 {
+		return "", nil
+	}
+	manifestListPath, _ := metadata.Snapshots[snapshotIndex]["manifest-list"].(string)
+
+	manifestListContent, err := readFile(manifestListPath)
+	if err != nil {
+		return "", err
+	}
+	manifestListFile, err := readAvroFile(manifestListContent)
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest list: %v", err)
+	}
+
+	// Pruned manifests by their index in the manifest list
+	prunedManifestFiles := make(map[int]*icebergAvroFile)
+	var keptDataFilePaths []string
+	var firstPrunedManifestIndex int
+	var firstPrunedEntry interface{}
+	for i, record := range manifestListFile.records {
+		prunesPartitions := partitionSpec != nil && record["partition_spec_id"] == int32(partitionSpec.SpecId)
+		if record["content"] != int32(ICEBERG_CONTENT_DATA) || (!prunesPartitions && len(boundColumns) == 0) {
+			continue
+		}
+		manifestContent, err := readFile(record["manifest_path"].(string))
+		if err != nil {
+			return "", err
+		}
+		manifestFile, err := readAvroFile(manifestContent)
+		if err != nil {
+			return "", fmt.Errorf("failed to read manifest: %v", err)
+		}
+
+		var keptEntries []map[string]interface{}
+		for _, entry := range manifestFile.records {
+			dataFile := entry["data_file"].(map[string]interface{})
+			if entry["status"] != int32(2) {
+				if (prunesPartitions && !icebergPartitionMatches(partitionColumn, icebergPartitionAvroValue(dataFile["partition"]), predicates)) ||
+					!icebergDataFileBoundsMatch(boundColumns, dataFile, predicates) {
+					if firstPrunedEntry == nil {
+						firstPrunedManifestIndex, firstPrunedEntry = i, entry
+					}
+					continue
+				}
+				keptDataFilePaths = append(keptDataFilePaths, dataFile["file_path"].(string))
+			}
+			keptEntries = append(keptEntries, entry)
+		}
+		if len(keptEntries) < len(manifestFile.records) {
+			manifestFile.records = keptEntries
+			prunedManifestFiles[i] = manifestFile
+		}
+	}
+	if len(prunedManifestFiles) == 0 {
+		return "", nil
+	}
+	if len(keptDataFilePaths) == 0 {
+		entry := firstPrunedEntry.(map[string]interface{})
+		prunedManifestFiles[firstPrunedManifestIndex].records = append(prunedManifestFiles[firstPrunedManifestIndex].records, entry)
+		keptDataFilePaths = append(keptDataFilePaths, entry["data_file"].(map[string]interface{})["file_path"].(string))
+	}
+
+	hash := sha256.New()
+	hash.Write(metadataContent)
+	hash.Write([]byte(snapshotIdValue))
+	for _, keptDataFilePath := range keptDataFilePaths {
+		hash.Write([]byte("\n" + keptDataFilePath))
+	}
+	prunedDirPath := filepath.Join(tempDir, ICEBERG_PRUNED_METADATA_DIR_NAME, hex.EncodeToString(hash.Sum(nil))[:32])
+	prunedMetadataPath = filepath.Join(prunedDirPath, IcebergMetadataFileName(ICEBERG_FIRST_METADATA_VERSION))
+	if _, err := os.Stat(prunedMetadataPath); err == nil {
+		return prunedMetadataPath, nil
+	}
+	err = os.MkdirAll(prunedDirPath, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	for i, manifestFile := range prunedManifestFiles {
+		manifestPath := filepath.Join(prunedDirPath, strconv.Itoa(i)+"-m0.avro")
+		manifestSize, err := manifestFile.write(manifestPath)
+		if err != nil {
+			return "", err
+		}
+
+		var fileCount int32
+		var recordCount int64
+		for _, entry := range manifestFile.records {
+			if entry["status"] != int32(2) {
+				fileCount++
+				recordCount += entry["data_file"].(map[string]interface{})["record_count"].(int64)
+			}
+		}
+		record := manifestListFile.records[i]
+		record["manifest_path"] = manifestPath
+		record["manifest_length"] = manifestSize
+		record["added_files_count"] = fileCount
+		record["added_rows_count"] = recordCount
+		record["existing_files_count"] = int32(0)
+		record["existing_rows_count"] = int64(0)
+	}
+	prunedManifestListPath := filepath.Join(prunedDirPath, "snap-"+string(snapshotIdValue)+".avro")
+	_, err = manifestListFile.write(prunedManifestListPath)
+	if err != nil {
+		return "", err
+	}
+
+	// The metadata is written last, so that it only exists once the files it references are complete
+	var prunedMetadata map[string]interface{}
+	decoder = json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber()
+	if err := decoder.Decode(&prunedMetadata); err != nil {
+		return "", fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	for _, snapshot := range prunedMetadata["snapshots"].([]interface{}) {
+		if snapshot := snapshot.(map[string]interface{}); snapshot["snapshot-id"] == snapshotIdValue {
+			snapshot["manifest-list"] = prunedManifestListPath
+		}
+	}
+	prunedMetadataContent, err := json.Marshal(prunedMetadata)
+	if err != nil {
+		return "", err
+	}
+	tempMetadataFile, err := os.CreateTemp(prunedDirPath, "metadata-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tempMetadataFile.Write(prunedMetadataContent)
+	err = errors.Join(err, tempMetadataFile.Close())
+	if err != nil {
+		os.Remove(tempMetadataFile.Name())
+		return "", err
+	}
+	return prunedMetadataPath, os.Rename(tempMetadataFile.Name(), prunedMetadataPath)
+}
+
+// Writes a copy of the metadata, manifest list, and delete manifests of the snapshot (0 for the current one) with its equality delete files
+// replaced by position delete files listing the rows they delete to a directory in tempDir, which DuckDB scans instead of the table metadata
+// since its Iceberg reader doesn't apply equality deletes. Returns the path of the metadata copy, or an empty path if the snapshot has
+// no equality delete files. Copies only depend on the metadata and snapshot, so they are written once and reused by later queries.
+// Position delete files keep the data sequence numbers of the equality delete files, and the ones that delete no rows are dropped
+func ReconcileIcebergMetadata(
+	metadataContent []byte,
+	snapshotId int64,
+	icebergSchemaFields []IcebergSchemaField,
+	readFile func(path string) ([]byte, error),
+	readFileColumns func(location string, columnNames []string) ([][]interface{}, error),
+	createParquet func(dirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (ParquetFile, error),
+	tempDir string,
+) (reconciledMetadataPath string, err error) {
+	var metadata struct {
+		CurrentSnapshotId *json.Number `json:"current-snapshot-id"`
+		Snapshots         []struct {
+			SnapshotId   json.Number       `json:"snapshot-id"`
+			ManifestList string            `json:"manifest-list"`
+			Summary      map[string]string `json:"summary"`
+		} `json:"snapshots"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	if err := decoder.Decode(&metadata); err != nil {
+		return "", fmt.Errorf("failed to parse metadata: %v", err)
+	}
+
+	snapshotIdValue := json.Number(strconv.FormatInt(snapshotId, 10))
+	if snapshotId == 0 {
+		if metadata.CurrentSnapshotId == nil {
+			return "", nil
+		}
+		snapshotIdValue = *metadata.CurrentSnapshotId
+	}
+	snapshotIndex := -1
+	for i, snapshot := range metadata.Snapshots {
+		if snapshot.SnapshotId == snapshotIdValue {
+			snapshotIndex = i
+		}
+	}
+	if snapshotIndex == -1 {
+		return "", fmt.Errorf("snapshot %s not found in metadata", snapshotIdValue)
+	}
+	snapshot := metadata.Snapshots[snapshotIndex]
+	if equalityDeleteCount := snapshot.Summary["total-equality-deletes"]; equalityDeleteCount == "" || equalityDeleteCount == "0" {
+		return "", nil
+	}
+
+	hash := sha256.New()
+	hash.Write(metadataContent)
+	hash.Write([]byte(snapshotIdValue))
+	reconciledDirPath := filepath.Join(tempDir, ICEBERG_RECONCILED_METADATA_DIR_NAME, hex.EncodeToString(hash.Sum(nil))[:32])
+	reconciledMetadataPath = filepath.Join(reconciledDirPath, IcebergMetadataFileName(ICEBERG_FIRST_METADATA_VERSION))
+	if _, err := os.Stat(reconciledMetadataPath); err == nil {
+		return reconciledMetadataPath, nil
+	}
+
+	manifestListContent, err := readFile(snapshot.ManifestList)
+	if err != nil {
+		return "", err
+	}
+	manifestListFile, err := readAvroFile(manifestListContent)
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest list: %v", err)
+	}
+
+	// Delete manifests with equality delete files by their index in the manifest list
+	reconciledManifestFiles := make(map[int]*icebergAvroFile)
+	var dataFiles []ParquetFile
+	var equalityDeleteFiles []ParquetFile
+	for i, record := range manifestListFile.records {
+		manifestContent, err := readFile(record["manifest_path"].(string))
+		if err != nil {
+			return "", err
+		}
+		manifestFile, err := readAvroFile(manifestContent)
+		if err != nil {
+			return "", fmt.Errorf("failed to read manifest: %v", err)
+		}
+		_, _, manifestEntries, err := parseManifestFiles(manifestContent, record["sequence_number"].(int64))
+		if err != nil {
+			return "", err
+		}
+
+		for _, entry := range manifestFile.records {
+			filePath := entry["data_file"].(map[string]interface{})["file_path"].(string)
+			manifestEntry, ok := manifestEntries[filePath]
+			if !ok || entry["status"] == int32(2) {
+				continue
+			}
+			parquetFile := ParquetFile{Path: filePath, Content: manifestEntry.Content, SequenceNumber: manifestEntry.SequenceNumber, EqualityFieldIds: manifestEntry.EqualityFieldIds}
+			switch manifestEntry.Content {
+			case ICEBERG_CONTENT_DATA:
+				dataFiles = append(dataFiles, parquetFile)
+			case ICEBERG_CONTENT_EQUALITY_DELETES:
+				equalityDeleteFiles = append(equalityDeleteFiles, parquetFile)
+				reconciledManifestFiles[i] = manifestFile
+			}
+		}
+	}
+	if len(equalityDeleteFiles) == 0 {
+		return "", nil
+	}
+
+	location := func(parquetFile ParquetFile) string { return parquetFile.Path }
+	readParquetFileColumns := func(parquetFile ParquetFile, columnNames []string) ([][]interface{}, error) {
+		return readFileColumns(parquetFile.Path, columnNames)
+	}
+	positionDeleteRows, err := resolveEqualityDeletes(dataFiles, equalityDeleteFiles, icebergSchemaFields, location, readParquetFileColumns)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(reconciledDirPath, 0755)
+	if err != nil {
+		return "", err
+	}
+	positionDeleteFiles := make(map[string]*ParquetFile)
+	for i, equalityDeleteFile := range equalityDeleteFiles {
+		if len(positionDeleteRows[i]) == 0 {
+			positionDeleteFiles[equalityDeleteFile.Path] = nil
+			continue
+		}
+		rows := positionDeleteRows[i]
+		positionDeleteFile, err := createParquet(reconciledDirPath, POSITION_DELETE_PG_SCHEMA_COLUMNS, func() [][]string {
+			loadedRows := rows
+			rows = nil
+			return loadedRows
+		})
+		if err != nil {
+			return "", err
+		}
+		positionDeleteFiles[equalityDeleteFile.Path] = &positionDeleteFile
+	}
+
+	for i, manifestFile := range reconciledManifestFiles {
+		var reconciledEntries []map[string]interface{}
+		for _, entry := range manifestFile.records {
+			dataFile := entry["data_file"].(map[string]interface{})
+			positionDeleteFile, ok := positionDeleteFiles[dataFile["file_path"].(string)]
+			if ok && entry["status"] != int32(2) {
+				if positionDeleteFile == nil {
+					continue
+				}
+				// The entry keeps its data sequence number, so that the position deletes apply to the same data files
+				dataFile["content"] = int32(ICEBERG_CONTENT_POSITION_DELETES)
+				dataFile["file_path"] = positionDeleteFile.Path
+				dataFile["file_size_in_bytes"] = positionDeleteFile.Size
+				dataFile["record_count"] = positionDeleteFile.RecordCount
+				dataFile["equality_ids"] = nil
+				for _, statsName := range []string{"column_sizes", "value_counts", "null_value_counts", "nan_value_counts", "lower_bounds", "upper_bounds", "split_offsets"} {
+					dataFile[statsName] = nil
+				}
+			}
+			reconciledEntries = append(reconciledEntries, entry)
+		}
+		manifestFile.records = reconciledEntries
+
+		manifestPath := filepath.Join(reconciledDirPath, strconv.Itoa(i)+"-m0.avro")
+		manifestSize, err := manifestFile.write(manifestPath)
+		if err != nil {
+			return "", err
+		}
+
+		var fileCount int32
+		var recordCount int64
+		for _, entry := range manifestFile.records {
+			if entry["status"] != int32(2) {
+				fileCount++
+				recordCount += entry["data_file"].(map[string]interface{})["record_count"].(int64)
+			}
+		}
+		record := manifestListFile.records[i]
+		record["manifest_path"] = manifestPath
+		record["manifest_length"] = manifestSize
+		record["added_files_count"] = fileCount
+		record["added_rows_count"] = recordCount
+		record["existing_files_count"] = int32(0)
+		record["existing_rows_count"] = int64(0)
+	}
+	reconciledManifestListPath := filepath.Join(reconciledDirPath, "snap-"+string(snapshotIdValue)+".avro")
+	_, err = manifestListFile.write(reconciledManifestListPath)
+	if err != nil {
+		return "", err
+	}
+
+	// The metadata is written last, so that it only exists once the files it references are complete
+	var reconciledMetadata map[string]interface{}
+	decoder = json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber()
+	if err := decoder.Decode(&reconciledMetadata); err != nil {
+		return "", fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	for _, snapshot := range reconciledMetadata["snapshots"].([]interface{}) {
+		if snapshot := snapshot.(map[string]interface{}); snapshot["snapshot-id"] == snapshotIdValue {
+			snapshot["manifest-list"] = reconciledManifestListPath
+		}
+	}
+	reconciledMetadataContent, err := json.Marshal(reconciledMetadata)
+	if err != nil {
+		return "", err
+	}
+	tempMetadataFile, err := os.CreateTemp(reconciledDirPath, "metadata-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tempMetadataFile.Write(reconciledMetadataContent)
+	err = errors.Join(err, tempMetadataFile.Close())
+	if err != nil {
+		os.Remove(tempMetadataFile.Name())
+		return "", err
+	}
+	return reconciledMetadataPath, os.Rename(tempMetadataFile.Name(), reconciledMetadataPath)
+}
+
+// Records of an Avro file with the schema, codec, and metadata to write them again
+type icebergAvroFile struct {
+	codec           *goavro.Codec
+	metaData        map[string][]byte
+	compressionName string
+	records         []map[string]interface{}
+}
+
+func readAvroFile(content []byte) (*icebergAvroFile, error) {
+	ocfReader, err := goavro.NewOCFReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	avroFile := &icebergAvroFile{codec: ocfReader.Codec(), metaData: ocfReader.MetaData(), compressionName: ocfReader.CompressionName()}
+	for ocfReader.Scan() {
+		datum, err := ocfReader.Read()
+		if err != nil {
+			return nil, err
+		}
+		avroFile.records = append(avroFile.records, datum.(map[string]interface{}))
+	}
+	return avroFile, ocfReader.Err()
+}
+
+func (avroFile *icebergAvroFile) write(filePath string) (size int64, err error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	metaData := make(map[string][]byte)
+	for key, value := range avroFile.metaData {
+		if !strings.HasPrefix(key, "avro.") {
+			metaData[key] = value
+		}
+	}
+	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:               file,
+		Codec:           avroFile.codec,
+		CompressionName: avroFile.compressionName,
+		MetaData:        metaData,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	records := make([]interface{}, len(avroFile.records))
+	for i, record := range avroFile.records {
+		records[i] = record
+	}
+	err = ocfWriter.Append(records)
+	if err != nil {
+		return 0, err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fileInfo.Size(), nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+var PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS = []PgSchemaColumn{
+	{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog", PrimaryKeyPosition: 1},
+	{ColumnName: "status", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog", PartitionTransform: "identity"},
+}
+
+func TestParseIcebergPartitionBy(t *testing.T) {
+	t.Run("parses transforms and identity columns", func(t *testing.T) {
+		for value, expected := range map[string]IcebergPartitionBy{
+			"day(created_at)":     {ColumnName: "created_at", Transform: "day"},
+			"month(created_at)":   {ColumnName: "created_at", Transform: "month"},
+			"year(created_at)":    {ColumnName: "created_at", Transform: "year"},
+			"bucket[16](user_id)": {ColumnName: "user_id", Transform: "bucket[16]"},
+			"identity(status)":    {ColumnName: "status", Transform: "identity"},
+			"status":              {ColumnName: "status", Transform: "identity"},
+		} {
+			partitionBy, err := ParseIcebergPartitionBy(value)
+
+			if err != nil {
+				t.Fatalf("Expected no error for %s, got %v", value, err)
+			}
+			if partitionBy != expected {
+				t.Errorf("Expected %v for %s, got %v", expected, value, partitionBy)
+			}
+		}
+	})
+
+	t.Run("returns an error for invalid partitions", func(t *testing.T) {
+		for _, value := range []string{"hour(created_at)", "bucket(user_id)", "bucket[0](user_id)", "day(created_at", "day()", ""} {
+			_, err := ParseIcebergPartitionBy(value)
+
+			if err == nil {
+				t.Errorf("Expected an error for %s", value)
+			}
+		}
+	})
+}
+
+func TestIcebergPartitionTransformValue(t *testing.T) {
+	t.Run("hashes values like the Iceberg spec", func(t *testing.T) {
+		uuidColumn := PgSchemaColumn{ColumnName: "external_id", DataType: "uuid", UdtName: "uuid"}
+		dateColumn := PgSchemaColumn{ColumnName: "created_on", DataType: "date", UdtName: "date"}
+		timestampColumn := PgSchemaColumn{ColumnName: "created_at", DataType: "timestamp without time zone", UdtName: "timestamp", DatetimePrecision: "6"}
+
+		for name, testCase := range map[string]struct {
+			sourceValue  interface{}
+			expectedHash int32
+		}{
+			"int":       {int32(34), 2017239379},
+			"long":      {int64(34), 2017239379},
+			"string":    {"iceberg", 1210000089},
+			"uuid":      {icebergPartitionSourceValue(uuidColumn, "f79c3e09-677c-4bbd-a479-3f349cb785e7"), 1488055340},
+			"date":      {icebergPartitionSourceValue(dateColumn, "2017-11-16"), -653330422},
+			"timestamp": {icebergPartitionSourceValue(timestampColumn, "2017-11-16 22:31:08"), -2047944441},
+			"bytes":     {[]byte{0, 1, 2, 3}, -188683207},
+		} {
+			bucket := icebergPartitionTransformValue("bucket[2147483647]", testCase.sourceValue)
+
+			expectedBucket := int32(int64(testCase.expectedHash&0x7fffffff) % 2147483647)
+			if bucket != expectedBucket {
+				t.Errorf("Expected %s bucket to be %d, got %v", name, expectedBucket, bucket)
+			}
+		}
+		if bucket := icebergPartitionTransformValue("bucket[16]", int32(34)); bucket != int32(3) {
+			t.Errorf("Expected bucket 3, got %v", bucket)
+		}
+	})
+
+	t.Run("returns years, months, and days since 1970-01-01", func(t *testing.T) {
+		timestampColumn := PgSchemaColumn{ColumnName: "created_at", DataType: "timestamp with time zone", UdtName: "timestamptz", DatetimePrecision: "6"}
+		dateColumn := PgSchemaColumn{ColumnName: "created_on", DataType: "date", UdtName: "date"}
+
+		for _, testCase := range []struct {
+			pgSchemaColumn PgSchemaColumn
+			transform      string
+			value          string
+			expected       interface{}
+		}{
+			{timestampColumn, "day", "2024-03-15 23:30:00+00", int32(19797)},
+			{timestampColumn, "day", "2024-03-16 01:30:00+02", int32(19797)},
+			{timestampColumn, "day", "1969-12-31 23:59:59+00", int32(-1)},
+			{timestampColumn, "month", "2024-03-15 23:30:00+00", int32(650)},
+			{timestampColumn, "year", "2024-03-15 23:30:00+00", int32(54)},
+			{dateColumn, "day", "2024-03-15", int32(19797)},
+			{dateColumn, "month", "1969-12-01", int32(-1)},
+			{dateColumn, "day", PG_NULL_STRING, nil},
+		} {
+			pgSchemaColumn := testCase.pgSchemaColumn
+			pgSchemaColumn.PartitionTransform = testCase.transform
+
+			value := icebergPartitionValue(pgSchemaColumn, testCase.value)
+
+			if value != testCase.expected {
+				t.Errorf("Expected %s(%s) to be %v, got %v", testCase.transform, testCase.value, testCase.expected, value)
+			}
+		}
+	})
+}
+
+func TestIcebergPartitionMatches(t *testing.T) {
+	dayColumn := PgSchemaColumn{ColumnName: "created_at", DataType: "timestamp with time zone", UdtName: "timestamptz", DatetimePrecision: "6", PartitionTransform: "day"}
+	bucketColumn := PgSchemaColumn{ColumnName: "id", DataType: "integer", UdtName: "int4", PartitionTransform: "bucket[16]"}
+	identityColumn := PgSchemaColumn{ColumnName: "status", DataType: "text", UdtName: "text", PartitionTransform: "identity"}
+
+	for _, testCase := range []struct {
+		pgSchemaColumn PgSchemaColumn
+		partitionValue interface{}
+		predicate      ColumnPredicate
+		expected       bool
+	}{
+		{dayColumn, int32(19797), ColumnPredicate{"created_at", "=", []string{"2024-03-15 12:00:00+00"}}, true},
+		{dayColumn, int32(19790), ColumnPredicate{"created_at", "=", []string{"2024-03-15 12:00:00+00"}}, false},
+		{dayColumn, int32(19796), ColumnPredicate{"created_at", ">=", []string{"2024-03-15"}}, true},
+		{dayColumn, int32(19790), ColumnPredicate{"created_at", ">=", []string{"2024-03-15"}}, false},
+		{dayColumn, int32(19800), ColumnPredicate{"created_at", "<", []string{"2024-03-15"}}, false},
+		{dayColumn, int32(19797), ColumnPredicate{"created_at", "BETWEEN", []string{"2024-03-10", "2024-03-20"}}, true},
+		{dayColumn, int32(19797), ColumnPredicate{"created_at", "=", []string{"not a timestamp"}}, true},
+		{dayColumn, nil, ColumnPredicate{"created_at", ">=", []string{"2024-03-15"}}, false},
+		{dayColumn, int32(19790), ColumnPredicate{"updated_at", "=", []string{"2024-03-15"}}, true},
+		{bucketColumn, int32(3), ColumnPredicate{"id", "IN", []string{"1", "34"}}, true},
+		{bucketColumn, int32(4), ColumnPredicate{"id", "=", []string{"34"}}, false},
+		{bucketColumn, int32(4), ColumnPredicate{"id", ">", []string{"34"}}, true},
+		{identityColumn, "active", ColumnPredicate{"status", "=", []string{"active"}}, true},
+		{identityColumn, "deleted", ColumnPredicate{"status", "IN", []string{"active", "pending"}}, false},
+	} {
+		matches := icebergPartitionMatches(testCase.pgSchemaColumn, testCase.partitionValue, []ColumnPredicate{testCase.predicate})
+
+		if matches != testCase.expected {
+			t.Errorf("Expected partition %v to match %v: %t, got %t", testCase.partitionValue, testCase.predicate, testCase.expected, matches)
+		}
+	}
+}
+
+func TestIcebergAvroName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"created_at_day": "created_at_day",
+		"1st_column":     "_1st_column",
+		"user-id":        "user_x2Did",
+	} {
+		if avroName := icebergAvroName(name); avroName != expected {
+			t.Errorf("Expected %s to be %s, got %s", name, expected, avroName)
+		}
+	}
+}
+
+func TestColumnPredicates(t *testing.T) {
+	parseWhereClause := func(t *testing.T, query string) *pgQuery.Node {
+		queryTree, err := pgQuery.Parse(query)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return queryTree.Stmts[0].Stmt.GetSelectStmt().WhereClause
+	}
+
+	t.Run("returns comparisons of the table columns with constants", func(t *testing.T) {
+		whereClause := parseWhereClause(t, "SELECT * FROM events e WHERE e.created_at >= '2024-01-01'::date AND 5 > id AND status IN ('a', 'b') AND amount BETWEEN 1 AND 2 AND other.id = 1 AND name = other_name")
+
+		predicates := NewParserWhere(loadTestConfig()).ColumnPredicates(whereClause, QuerySchemaTable{Table: "events", Alias: "e"})
+
+		expectedPredicates := []ColumnPredicate{
+			{ColumnName: "created_at", Operator: ">=", Values: []string{"2024-01-01"}},
+			{ColumnName: "id", Operator: "<", Values: []string{"5"}},
+			{ColumnName: "status", Operator: "IN", Values: []string{"a", "b"}},
+			{ColumnName: "amount", Operator: "BETWEEN", Values: []string{"1", "2"}},
+		}
+		if !reflect.DeepEqual(predicates, expectedPredicates) {
+			t.Errorf("Expected %v, got %v", expectedPredicates, predicates)
+		}
+	})
+
+	t.Run("returns no predicates for OR conditions", func(t *testing.T) {
+		whereClause := parseWhereClause(t, "SELECT * FROM events WHERE id = 1 OR id = 2")
+
+		predicates := NewParserWhere(loadTestConfig()).ColumnPredicates(whereClause, QuerySchemaTable{Table: "events"})
+
+		if len(predicates) != 0 {
+			t.Errorf("Expected no predicates, got %v", predicates)
+		}
+	})
+}
+
+func TestPartitionedIcebergWriter(t *testing.T) {
+	loadRowsOnce := func(rows [][]string) func() ([][]string, error) {
+		loaded := false
+		return func() ([][]string, error) {
+			if loaded {
+				return [][]string{}, nil
+			}
+			loaded = true
+			return rows, nil
+		}
+	}
+	partitionValues := func(parquetFiles []ParquetFile) []string {
+		var values []string
+		for _, parquetFile := range parquetFiles {
+			value, _ := parquetFile.PartitionValue.(string)
+			values = append(values, value)
+		}
+		slices.Sort(values)
+		return values
+	}
+
+	t.Run("writes a data file per partition and records the partition spec", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_partitioning", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		writeRows := loadRowsOnce([][]string{{"1", "active"}, {"2", "deleted"}, {"3", "active"}})
+
+		icebergWriter.Write(context.Background(), schemaTable, PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS, func() [][]string {
+			rows, _ := writeRows()
+			return rows
+		})
+
+		dataFiles, err := storage.IcebergDataFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if values := partitionValues(dataFiles); !reflect.DeepEqual(values, []string{"active", "deleted"}) {
+			t.Errorf("Expected a data file per partition, got partitions %v", values)
+		}
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		PanicIfError(err)
+		metadataContent, err := os.ReadFile(metadataPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var metadata struct {
+			PartitionSpecs  []IcebergPartitionSpec `json:"partition-specs"`
+			DefaultSpecId   int                    `json:"default-spec-id"`
+			LastPartitionId int                    `json:"last-partition-id"`
+		}
+		err = json.Unmarshal(metadataContent, &metadata)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expectedPartitionSpecs := []IcebergPartitionSpec{{SpecId: 0, Fields: []IcebergPartitionField{{Name: "status", Transform: "identity", SourceId: 2, FieldId: 1000}}}}
+		if !reflect.DeepEqual(metadata.PartitionSpecs, expectedPartitionSpecs) || metadata.DefaultSpecId != 0 || metadata.LastPartitionId != 1000 {
+			t.Errorf("Expected partition specs %v, got %s", expectedPartitionSpecs, string(metadataContent))
+		}
+	})
+
+	t.Run("keeps partitions of upserted rows, position deletes, and compacted files", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_partitioning_upsert", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		writeRows := loadRowsOnce([][]string{{"1", "active"}, {"2", "deleted"}})
+		icebergWriter.Write(context.Background(), schemaTable, PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS, func() [][]string {
+			rows, _ := writeRows()
+			return rows
+		})
+
+		_, deletedRowCount, err := icebergWriter.Upsert(context.Background(), schemaTable, PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS, []string{"id"}, loadRowsOnce([][]string{{"2", "active"}, {"3", "deleted"}}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if deletedRowCount != 1 {
+			t.Errorf("Expected 1 deleted row, got %d", deletedRowCount)
+		}
+		_, err = icebergWriter.Append(context.Background(), schemaTable, PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce([][]string{{"4", "active"}}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		err = icebergWriter.Compact(schemaTable, 1024*1024)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		dataFiles, err := storage.IcebergDataFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if values := partitionValues(dataFiles); !reflect.DeepEqual(values, []string{"active", "deleted", "deleted"}) {
+			t.Errorf("Expected the active files to be merged and the deleted file with a deleted row to be kept, got partitions %v", values)
+		}
+		deleteFiles, err := storage.IcebergDeleteFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if values := partitionValues(deleteFiles); !reflect.DeepEqual(values, []string{"deleted"}) {
+			t.Errorf("Expected a position delete file in the partition of the deleted row, got partitions %v", values)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id", "status"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[1active 2active 3deleted 4active]" {
+			t.Errorf("Expected only the latest row versions, got %v", rows)
+		}
+	})
+
+	t.Run("prunes data files of partitions that can't match the predicates", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_partitioning_pruning", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		writeRows := loadRowsOnce([][]string{{"1", "active"}, {"2", "deleted"}, {"3", "pending"}})
+		icebergWriter.Write(context.Background(), schemaTable, PARTITIONED_TEST_TABLE_PG_SCHEMA_COLUMNS, func() [][]string {
+			rows, _ := writeRows()
+			return rows
+		})
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		PanicIfError(err)
+		metadataContent, err := os.ReadFile(metadataPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		tempDir := t.TempDir()
+
+		prunedMetadataPath, err := PruneIcebergMetadata(metadataContent, 0, []ColumnPredicate{{ColumnName: "status", Operator: "IN", Values: []string{"active", "pending"}}}, storage.ReadIcebergTableFile, tempDir)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		prunedMetadataContent, err := os.ReadFile(prunedMetadataPath)
+		if err != nil {
+			t.Fatalf("Expected the pruned metadata to be written, got %v", err)
+		}
+		dataFilePaths, _, manifestEntries, err := storage.storageBase.CurrentSnapshotFilePaths(prunedMetadataContent, storage.ReadIcebergTableFile)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var values []string
+		for dataFilePath := range dataFilePaths {
+			values = append(values, manifestEntries[dataFilePath].PartitionValue.(string))
+		}
+		slices.Sort(values)
+		if !reflect.DeepEqual(values, []string{"active", "pending"}) {
+			t.Errorf("Expected only the data files of the matching partitions, got partitions %v", values)
+		}
+
+		reusedMetadataPath, err := PruneIcebergMetadata(metadataContent, 0, []ColumnPredicate{{ColumnName: "status", Operator: "IN", Values: []string{"pending", "active"}}}, storage.ReadIcebergTableFile, tempDir)
+		if err != nil || reusedMetadataPath != prunedMetadataPath {
+			t.Errorf("Expected the pruned metadata to be reused, got %s (%v)", reusedMetadataPath, err)
+		}
+		unprunedMetadataPath, err := PruneIcebergMetadata(metadataContent, 0, []ColumnPredicate{{ColumnName: "id", Operator: "<=", Values: []string{"3"}}}, storage.ReadIcebergTableFile, tempDir)
+		if err != nil || unprunedMetadataPath != "" {
+			t.Errorf("Expected no pruning if all data files can match the predicates, got %s (%v)", unprunedMetadataPath, err)
+		}
+	})
+}
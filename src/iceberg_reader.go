@@ -1,30 +1,188 @@
 package main
 
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
 type IcebergReader struct {
-	config  *Config
-	storage Storage
+	config       *Config
+	storage      Storage
+	nessieClient *NessieClient // optional, with the NESSIE catalog type
 }
 
 func NewIcebergReader(config *Config) *IcebergReader {
 	storage := NewStorage(config)
-	return &IcebergReader{config: config, storage: storage}
+	reader := &IcebergReader{config: config, storage: storage}
+	if config.CatalogType == CATALOG_TYPE_NESSIE {
+		reader.nessieClient = NewNessieClient(config)
+	}
+	return reader
 }
 
 func (reader *IcebergReader) Schemas() (icebergSchemas []string, err error) {
-	LogDebug(reader.config, "Reading Iceberg schemas...")
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg schemas...")
 	return reader.storage.IcebergSchemas()
 }
 
 func (reader *IcebergReader) SchemaTables() (icebergSchemaTables Set[IcebergSchemaTable], err error) {
-	LogDebug(reader.config, "Reading Iceberg tables...")
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg tables...")
 	return reader.storage.IcebergSchemaTables()
 }
 
 func (reader *IcebergReader) TableFields(icebergSchemaTable IcebergSchemaTable) (icebergTableFields []IcebergTableField, err error) {
-	LogDebug(reader.config, "Reading Iceberg table "+icebergSchemaTable.String()+" fields...")
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+icebergSchemaTable.String()+" fields...")
 	return reader.storage.IcebergTableFields(icebergSchemaTable)
 }
 
-func (reader *IcebergReader) MetadataFilePath(icebergSchemaTable IcebergSchemaTable) string {
+func (reader *IcebergReader) TableColumnValues(schemaTable IcebergSchemaTable, columnNames []string) (rows [][]interface{}, err error) {
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+schemaTable.String()+" columns...")
+	return reader.storage.ReadParquetColumns(schemaTable, columnNames)
+}
+
+func (reader *IcebergReader) MetadataFilePath(icebergSchemaTable IcebergSchemaTable) (metadataPath string, err error) {
 	return reader.storage.IcebergMetadataFilePath(icebergSchemaTable)
 }
+
+// Returns false if the metadata file can't be read anymore, e.g., after it was expired by a concurrent commit
+func (reader *IcebergReader) MetadataFileExists(metadataPath string) bool {
+	_, err := reader.storage.ReadIcebergTableFile(metadataPath)
+	return err == nil
+}
+
+// Returns the path of the table metadata committed to the Nessie reference, "" if the table doesn't exist at the reference
+func (reader *IcebergReader) NessieMetadataFilePath(icebergSchemaTable IcebergSchemaTable, ref string) (metadataPath string, err error) {
+	if reader.nessieClient == nil {
+		return "", errors.New(PG_SETTING_NESSIE_REF + " requires the " + CATALOG_TYPE_NESSIE + " catalog type")
+	}
+
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+icebergSchemaTable.String()+" at Nessie reference "+ref+"...")
+	nessieTable, err := reader.nessieClient.Table(ref, NessieContentKeyFor(icebergSchemaTable))
+	if err != nil || nessieTable == nil {
+		return "", err
+	}
+	return nessieTable.MetadataLocation, nil
+}
+
+// Returns the fields of the current schema in the metadata file, e.g., of a table committed to a Nessie reference
+func (reader *IcebergReader) MetadataTableFields(metadataPath string) (icebergTableFields []IcebergTableField, err error) {
+	metadataContent, err := reader.storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIcebergTableFields(metadataContent)
+}
+
+// Returns the path of a copy of the table metadata whose snapshot (0 for the current one) only lists the data files whose partitions
+// and column bounds can match the predicates, or the table metadata path if no data files can be pruned
+func (reader *IcebergReader) PrunedMetadataFilePath(icebergSchemaTable IcebergSchemaTable, metadataPath string, snapshotId int64, predicates []ColumnPredicate) (prunedMetadataPath string, err error) {
+	if len(predicates) == 0 {
+		return metadataPath, nil
+	}
+
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Pruning Iceberg table "+icebergSchemaTable.String()+" data files...")
+	metadataContent, err := reader.readIcebergTableFile(metadataPath)
+	if err != nil {
+		return "", err
+	}
+
+	prunedMetadataPath, err = PruneIcebergMetadata(metadataContent, snapshotId, predicates, reader.readIcebergTableFile, reader.tempDir())
+	if err != nil || prunedMetadataPath == "" {
+		return metadataPath, err
+	}
+	return prunedMetadataPath, nil
+}
+
+// Returns the path of a copy of the table metadata whose snapshot (0 for the current one) lists the rows deleted by equality delete files
+// in position delete files, which DuckDB applies, or the table metadata path if the snapshot has no equality delete files
+func (reader *IcebergReader) ReconciledMetadataFilePath(icebergSchemaTable IcebergSchemaTable, metadataPath string, snapshotId int64) (reconciledMetadataPath string, err error) {
+	metadataContent, err := reader.readIcebergTableFile(metadataPath)
+	if err != nil {
+		return "", err
+	}
+
+	localStorage := NewLocalStorage(reader.config)
+	icebergSchemaFields, err := localStorage.storageBase.ParseIcebergSchemaFields(metadataContent)
+	if err != nil {
+		return "", err
+	}
+	reconciledMetadataPath, err = ReconcileIcebergMetadata(
+		metadataContent,
+		snapshotId,
+		icebergSchemaFields,
+		reader.readIcebergTableFile,
+		reader.storage.ReadParquetLocationColumns,
+		localStorage.CreateParquet,
+		reader.tempDir(),
+	)
+	if err != nil || reconciledMetadataPath == "" {
+		return metadataPath, err
+	}
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Resolved Iceberg table "+icebergSchemaTable.String()+" equality delete files at:", reconciledMetadataPath)
+	return reconciledMetadataPath, nil
+}
+
+func (reader *IcebergReader) SchemaFields(icebergSchemaTable IcebergSchemaTable) (icebergSchemaFields []IcebergSchemaField, err error) {
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+icebergSchemaTable.String()+" schema fields...")
+	return reader.storage.IcebergSchemaFields(icebergSchemaTable)
+}
+
+func (reader *IcebergReader) TableProperties(icebergSchemaTable IcebergSchemaTable) (properties map[string]string, err error) {
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+icebergSchemaTable.String()+" properties...")
+	return reader.storage.IcebergTableProperties(icebergSchemaTable)
+}
+
+func (reader *IcebergReader) SnapshotAsOf(icebergSchemaTable IcebergSchemaTable, metadataPath string, asOf time.Time) (snapshot *IcebergSnapshot, err error) {
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+icebergSchemaTable.String()+" snapshot as of "+asOf.Format(time.RFC3339)+"...")
+	metadataContent, err := reader.storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseIcebergSnapshotAsOf(metadataContent, asOf)
+}
+
+func (reader *IcebergReader) HistoryStart(icebergSchemaTable IcebergSchemaTable) (historyStart *time.Time, err error) {
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+icebergSchemaTable.String()+" history start...")
+	metadataPath, err := reader.storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	metadataContent, err := reader.storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseIcebergHistoryStart(metadataContent)
+}
+
+func (reader *IcebergReader) LastColumnId(icebergSchemaTable IcebergSchemaTable) (lastColumnId int, err error) {
+	LogComponentDebug(reader.config, LOG_COMPONENT_ICEBERG, "Reading Iceberg table "+icebergSchemaTable.String()+" last column ID...")
+	metadataPath, err := reader.storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return 0, err
+	}
+	metadataContent, err := reader.storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return ParseIcebergLastColumnId(metadataContent)
+}
+
+// Metadata copies with pruned data files or resolved equality deletes are in the local temporary directory regardless of the storage type
+func (reader *IcebergReader) readIcebergTableFile(path string) ([]byte, error) {
+	if strings.HasPrefix(path, reader.tempDir()) {
+		return os.ReadFile(path)
+	}
+	return reader.storage.ReadIcebergTableFile(path)
+}
+
+func (reader *IcebergReader) tempDir() string {
+	if reader.config.TempDir == "" {
+		return os.TempDir()
+	}
+	return reader.config.TempDir
+}
@@ -1,13 +1,28 @@
 package main
 
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
 type IcebergWriter struct {
 	config  *Config
 	storage Storage
+	catalog Catalog // optional
 }
 
 func NewIcebergWriter(config *Config) *IcebergWriter {
 	storage := NewStorage(config)
-	return &IcebergWriter{config: config, storage: storage}
+	return &IcebergWriter{config: config, storage: storage, catalog: NewCatalog(config)}
 }
 
 const (
@@ -329,36 +344,1412 @@ const (
 	}`
 )
 
-func (icebergWriter *IcebergWriter) Write(schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) {
-	err := icebergWriter.storage.DeleteSchemaTable(schemaTable)
-	PanicIfError(err)
+// Rows of partitioned tables are buffered by partition up to this size of their values without a target file size
+const ICEBERG_PARTITION_BUFFER_SIZE = 128 * 1024 * 1024
+
+// Commits that lose a race with another writer are attempted again on top of its snapshot, waiting longer after each attempt
+const (
+	ICEBERG_COMMIT_ATTEMPTS    = 5
+	ICEBERG_COMMIT_RETRY_DELAY = 100 * time.Millisecond
+)
+
+// Writes all rows to new data files and commits a new snapshot with them. The data files of the previous snapshots are kept
+// for time travel until the snapshots expire and are vacuumed
+func (icebergWriter *IcebergWriter) Write(ctx context.Context, schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) []ParquetFile {
+	_, span := StartSpan(ctx, "IcebergWriter.Write", schemaTableSpanAttributes(schemaTable.Schema, schemaTable.Table)...)
+	defer EndSpanOnPanic(span)
 
 	dataDirPath := icebergWriter.storage.CreateDataDir(schemaTable)
 
-	parquetFile, err := icebergWriter.storage.CreateParquet(dataDirPath, pgSchemaColumns, loadRows)
+	parquetFiles := icebergWriter.createParquetFiles(dataDirPath, pgSchemaColumns, loadRows)
+
+	// The snapshot doesn't depend on the previous ones, so it's committed on top of any snapshot committed by another writer in the meantime
+	metadataDirPath := icebergWriter.storage.CreateMetadataDir(schemaTable)
+	for attempt := 1; ; attempt++ {
+		baseVersion, err := icebergWriter.storage.CurrentMetadataVersion(metadataDirPath)
+		PanicIfError(err)
+		err = icebergWriter.writeMetadata(schemaTable, metadataDirPath, baseVersion, icebergSchemaFields(pgSchemaColumns), icebergPartitionFields(pgSchemaColumns), icebergTableProperties(pgSchemaColumns), parquetFiles)
+		if !icebergWriter.retriesCommit(schemaTable, err, attempt) {
+			PanicIfError(err)
+			break
+		}
+	}
+	span.SetAttributes(parquetFilesSpanAttributes(parquetFiles)...)
+	return parquetFiles
+}
+
+// Rewrites the table like Write, then commits the expiry of its previous snapshots and metadata files as the next version.
+// Unlike a table that is deleted before it's rewritten, readers see the previous rows until the new snapshot is committed.
+// The files of the previous snapshots are left to vacuum, since queries that resolved the previous version may still read them
+func (icebergWriter *IcebergWriter) Replace(ctx context.Context, schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) []ParquetFile {
+	parquetFiles := icebergWriter.Write(ctx, schemaTable, pgSchemaColumns, loadRows)
+
+	icebergSchemaTable := icebergWriter.prefixedSchemaTable(schemaTable)
+	var expiredSnapshotIds, expiredMetadataPaths []string
+	for attempt := 1; ; attempt++ {
+		var err error
+		expiredSnapshotIds, expiredMetadataPaths, err = icebergWriter.expireReplacedSnapshots(icebergSchemaTable)
+		if !icebergWriter.retriesCommit(schemaTable, err, attempt) {
+			PanicIfError(err)
+			break
+		}
+	}
+
+	LogComponentDebug(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Expired", len(expiredSnapshotIds), "snapshots and", len(expiredMetadataPaths), "metadata files of", schemaTable.String(), "after replacing it, leaving their files to vacuum")
+	return parquetFiles
+}
+
+// Fields are identified by the column ordinal positions, so that the data files written with previous schemas are read
+// by matching field IDs after columns are added, dropped, or renamed
+func icebergSchemaFields(pgSchemaColumns []PgSchemaColumn) []IcebergSchemaField {
+	icebergSchemaFields := make([]IcebergSchemaField, len(pgSchemaColumns))
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		icebergSchemaFields[i] = pgSchemaColumn.ToIcebergSchemaFieldMap()
+	}
+	return icebergSchemaFields
+}
+
+// Loads batches in the current goroutine and writes them with a pool of writers, each creating Parquet files of up to
+// the target file size. Batches are distributed round-robin, so the N-th writer always writes batches N, N + writers, etc.
+// and the files are returned in this order to be committed together. Writers are started only when there are batches for them.
+// Partitioned tables are written by a single writer instead (see createPartitionedParquetFiles)
+func (icebergWriter *IcebergWriter) createParquetFiles(dataDirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) []ParquetFile {
+	if icebergPartitionColumnIndex(pgSchemaColumns) != -1 {
+		parquetFiles, err := icebergWriter.createPartitionedParquetFiles(dataDirPath, pgSchemaColumns, loadRows)
+		PanicIfError(err)
+		return parquetFiles
+	}
+
+	writerCount := icebergWriter.config.ParquetWriters
+	if writerCount <= 1 {
+		parquetFiles, err := icebergWriter.createRollingParquetFiles(dataDirPath, pgSchemaColumns, loadRows)
+		PanicIfError(err)
+		return parquetFiles
+	}
+
+	var batchChannels []chan [][]string
+	writerParquetFiles := make([][]ParquetFile, writerCount)
+	errs := make([]error, writerCount)
+	var waitGroup sync.WaitGroup
+
+	for batchIndex := 0; ; batchIndex++ {
+		rows := loadRows()
+		if len(rows) == 0 {
+			break
+		}
+
+		writerIndex := batchIndex % writerCount
+		if writerIndex == len(batchChannels) {
+			batchChannel := make(chan [][]string, 1)
+			batchChannels = append(batchChannels, batchChannel)
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				writerParquetFiles[writerIndex], errs[writerIndex] = icebergWriter.createParquetFilesFromBatches(dataDirPath, pgSchemaColumns, batchChannel)
+			}()
+		}
+		batchChannels[writerIndex] <- rows
+	}
+
+	for _, batchChannel := range batchChannels {
+		close(batchChannel)
+	}
+	waitGroup.Wait()
+
+	if len(batchChannels) == 0 {
+		parquetFile, err := icebergWriter.storage.CreateParquet(dataDirPath, pgSchemaColumns, func() [][]string { return [][]string{} })
+		PanicIfError(err)
+		return []ParquetFile{parquetFile}
+	}
+	var parquetFiles []ParquetFile
+	for writerIndex, err := range errs {
+		PanicIfError(err)
+		parquetFiles = append(parquetFiles, writerParquetFiles[writerIndex]...)
+	}
+	return parquetFiles
+}
+
+func (icebergWriter *IcebergWriter) createParquetFilesFromBatches(dataDirPath string, pgSchemaColumns []PgSchemaColumn, batchChannel <-chan [][]string) (parquetFiles []ParquetFile, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		// Drain the remaining batches to keep the batches loading until the end
+		for range batchChannel {
+		}
+	}()
+
+	return icebergWriter.createRollingParquetFiles(dataDirPath, pgSchemaColumns, func() [][]string {
+		rows, ok := <-batchChannel
+		if !ok {
+			return [][]string{}
+		}
+		return rows
+	})
+}
+
+// Writes the rows to Parquet files, starting a new file when the previous one reaches the target file size and there
+// are rows left. Rows are never loaded again once loading returned no rows (e.g., to not track deleted rows twice)
+func (icebergWriter *IcebergWriter) createRollingParquetFiles(dataDirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (parquetFiles []ParquetFile, err error) {
+	loadedAll := false
+	var nextRows [][]string
+	loadNextRows := func() [][]string {
+		if len(nextRows) > 0 {
+			rows := nextRows
+			nextRows = nil
+			return rows
+		}
+		if loadedAll {
+			return [][]string{}
+		}
+		rows := loadRows()
+		loadedAll = len(rows) == 0
+		return rows
+	}
+
+	for {
+		parquetFile, err := icebergWriter.storage.CreateParquet(dataDirPath, pgSchemaColumns, loadNextRows)
+		if err != nil {
+			return nil, err
+		}
+		parquetFiles = append(parquetFiles, parquetFile)
+
+		if !loadedAll {
+			nextRows = loadNextRows()
+		}
+		if loadedAll {
+			return parquetFiles, nil
+		}
+		LogComponentDebug(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Starting Parquet file", len(parquetFiles)+1, "after reaching the target file size")
+	}
+}
+
+// Writes the rows to Parquet files by partition, since each data file of a partitioned table must only contain rows of one partition.
+// Rows are buffered by partition until the buffered values reach the target file size (or ICEBERG_PARTITION_BUFFER_SIZE without one),
+// then the partition with the most buffered values is written to new files. Returns an empty data file if there are no rows
+func (icebergWriter *IcebergWriter) createPartitionedParquetFiles(dataDirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (parquetFiles []ParquetFile, err error) {
+	partitionColumnIndex := icebergPartitionColumnIndex(pgSchemaColumns)
+	bufferSize := icebergWriter.config.Iceberg.TargetFileSizeBytes
+	if bufferSize <= 0 {
+		bufferSize = ICEBERG_PARTITION_BUFFER_SIZE
+	}
+
+	var partitionValues []interface{} // in the order of their first buffered rows
+	partitionRows := make(map[interface{}][][]string)
+	partitionSizes := make(map[interface{}]int64)
+	var bufferedSize int64
+
+	writePartition := func(partitionValue interface{}) error {
+		rows := partitionRows[partitionValue]
+		bufferedSize -= partitionSizes[partitionValue]
+		delete(partitionRows, partitionValue)
+		delete(partitionSizes, partitionValue)
+
+		loaded := false
+		partitionParquetFiles, err := icebergWriter.createRollingParquetFiles(dataDirPath, pgSchemaColumns, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return rows
+		})
+		if err != nil {
+			return err
+		}
+		for _, parquetFile := range partitionParquetFiles {
+			parquetFile.PartitionValue = partitionValue
+			parquetFiles = append(parquetFiles, parquetFile)
+		}
+		return nil
+	}
+
+	for {
+		rows := loadRows()
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			partitionValue := icebergPartitionValue(pgSchemaColumns[partitionColumnIndex], row[partitionColumnIndex])
+			if _, ok := partitionRows[partitionValue]; !ok {
+				partitionValues = append(partitionValues, partitionValue)
+			}
+			partitionRows[partitionValue] = append(partitionRows[partitionValue], row)
+			rowSize := pgRowSize(row)
+			partitionSizes[partitionValue] += rowSize
+			bufferedSize += rowSize
+		}
+
+		for bufferedSize >= bufferSize {
+			var largestPartitionValue interface{}
+			largestPartitionSize := int64(-1)
+			for partitionValue, partitionSize := range partitionSizes {
+				if partitionSize > largestPartitionSize {
+					largestPartitionValue, largestPartitionSize = partitionValue, partitionSize
+				}
+			}
+			err = writePartition(largestPartitionValue)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Partitions that were written before are listed again after their next buffered row
+	for _, partitionValue := range partitionValues {
+		if _, ok := partitionRows[partitionValue]; ok {
+			err = writePartition(partitionValue)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(parquetFiles) == 0 {
+		parquetFile, err := icebergWriter.storage.CreateParquet(dataDirPath, pgSchemaColumns, func() [][]string { return [][]string{} })
+		if err != nil {
+			return nil, err
+		}
+		parquetFiles = append(parquetFiles, parquetFile)
+	}
+	return parquetFiles, nil
+}
+
+func pgRowSize(row []string) (size int64) {
+	for _, value := range row {
+		size += int64(len(value))
+	}
+	return size
+}
+
+// Records enum labels as table properties since Iceberg stores enum values as plain strings.
+// Also records the PostgreSQL columns to convert rows appended with COPY like the synced ones,
+// and the primary key and unique key column names in the key order for consumers merging rows
+func icebergTableProperties(pgSchemaColumns []PgSchemaColumn) map[string]string {
+	pgSchemaColumnsJson, err := json.Marshal(pgSchemaColumns)
 	PanicIfError(err)
+	properties := map[string]string{ICEBERG_PROPERTY_PG_SCHEMA_COLUMNS: string(pgSchemaColumnsJson)}
+	var primaryKeyColumns []PgSchemaColumn
+	uniqueKeyColumnNames := make(map[string][]string)
+	for _, pgSchemaColumn := range pgSchemaColumns {
+		if pgSchemaColumn.IsEnum() {
+			enumLabelsJson, err := json.Marshal(pgSchemaColumn.EnumLabels)
+			PanicIfError(err)
+			properties[ICEBERG_PROPERTY_ENUM_LABELS_PREFIX+pgSchemaColumn.ColumnName] = string(enumLabelsJson)
+		}
+		if pgSchemaColumn.PrimaryKeyPosition > 0 {
+			primaryKeyColumns = append(primaryKeyColumns, pgSchemaColumn)
+		}
+		for keyName, position := range pgSchemaColumn.UniqueKeyPositions {
+			columnNames := uniqueKeyColumnNames[keyName]
+			for len(columnNames) < position {
+				columnNames = append(columnNames, "")
+			}
+			columnNames[position-1] = pgSchemaColumn.ColumnName
+			uniqueKeyColumnNames[keyName] = columnNames
+		}
+	}
+	if len(primaryKeyColumns) > 0 {
+		slices.SortFunc(primaryKeyColumns, func(a, b PgSchemaColumn) int { return a.PrimaryKeyPosition - b.PrimaryKeyPosition })
+		primaryKeyColumnNames := make([]string, len(primaryKeyColumns))
+		for i, primaryKeyColumn := range primaryKeyColumns {
+			primaryKeyColumnNames[i] = primaryKeyColumn.ColumnName
+		}
+		primaryKeyJson, err := json.Marshal(primaryKeyColumnNames)
+		PanicIfError(err)
+		properties[ICEBERG_PROPERTY_PRIMARY_KEY] = string(primaryKeyJson)
+	}
+	if len(uniqueKeyColumnNames) > 0 {
+		uniqueKeysJson, err := json.Marshal(uniqueKeyColumnNames)
+		PanicIfError(err)
+		properties[ICEBERG_PROPERTY_UNIQUE_KEYS] = string(uniqueKeysJson)
+	}
+	return properties
+}
+
+// Writes the loaded rows to new data files and commits a new snapshot with the existing files and the new ones.
+// The snapshot has the schema of the PostgreSQL columns, which may evolve the existing one (see CheckAppendableIcebergSchema).
+// Nothing is committed if loading the rows fails or there are no rows
+func (icebergWriter *IcebergWriter) Append(ctx context.Context, schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() ([][]string, error)) (appendedParquetFiles []ParquetFile, err error) {
+	_, span := StartSpan(ctx, "IcebergWriter.Append", schemaTableSpanAttributes(schemaTable.Schema, schemaTable.Table)...)
+	defer EndSpanOnPanic(span)
+	defer func() { SetSpanError(span, err) }()
 
 	metadataDirPath := icebergWriter.storage.CreateMetadataDir(schemaTable)
+	existingTable, err := icebergWriter.readExistingTable(schemaTable, metadataDirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	appendedParquetFiles, recordCount, err := icebergWriter.createAppendedParquetFiles(schemaTable, pgSchemaColumns, loadRows)
+	if err != nil || recordCount == 0 {
+		return nil, err
+	}
+
+	// The appended files don't depend on the existing ones, so they're committed again with the files committed by another writer in the meantime
+	for attempt := 1; ; attempt++ {
+		err = icebergWriter.writeMetadata(schemaTable, metadataDirPath, existingTable.metadataVersion, icebergSchemaFields(pgSchemaColumns), icebergPartitionFields(pgSchemaColumns), icebergTableProperties(pgSchemaColumns), slices.Concat(existingTable.dataFiles, appendedParquetFiles, existingTable.deleteFiles))
+		if !icebergWriter.retriesCommit(schemaTable, err, attempt) {
+			break
+		}
+		existingTable, err = icebergWriter.readExistingTable(schemaTable, metadataDirPath)
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		icebergWriter.deleteUncommittedParquetFiles(schemaTable, appendedParquetFiles)
+		return nil, err
+	}
+
+	LogComponentInfo(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Appended", recordCount, "row(s) to", schemaTable.String())
+	span.SetAttributes(parquetFilesSpanAttributes(appendedParquetFiles)...)
+	return appendedParquetFiles, nil
+}
+
+// Writes the loaded rows to new data files and deletes the previous versions of rows with the same primary key with a
+// position delete file, so that changed rows are merged on read instead of rewriting the table.
+// With --iceberg-equality-deletes, unpartitioned tables get an equality delete file keyed on the primary key instead, which doesn't
+// read the primary keys of the existing rows, so the replaced rows aren't counted. DuckDB's iceberg_scan doesn't apply equality deletes,
+// so queries read them resolved into position deletes (see IcebergReader.ReconciledMetadataFilePath) until compaction resolves them.
+// Nothing is committed if loading the rows fails or there are no rows
+func (icebergWriter *IcebergWriter) Upsert(ctx context.Context, schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, primaryKeyColumnNames []string, loadRows func() ([][]string, error)) (writtenParquetFiles []ParquetFile, deletedRowCount int64, err error) {
+	_, span := StartSpan(ctx, "IcebergWriter.Upsert", schemaTableSpanAttributes(schemaTable.Schema, schemaTable.Table)...)
+	defer EndSpanOnPanic(span)
+	defer func() { SetSpanError(span, err) }()
+
+	primaryKeyIndexes, err := pgPrimaryKeyIndexes(pgSchemaColumns, primaryKeyColumnNames)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	metadataDirPath := icebergWriter.storage.CreateMetadataDir(schemaTable)
+	existingTable, err := icebergWriter.readExistingTable(schemaTable, metadataDirPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Equality delete files only apply to data files of their partition, and the previous version of a row may be in another one
+	writesEqualityDeletes := icebergWriter.config.Iceberg.EqualityDeletes && icebergPartitionColumnIndex(pgSchemaColumns) == -1
+	upsertedPrimaryKeys := make(Set[string])
+	var upsertedPrimaryKeyRows [][]string
+	appendedParquetFiles, recordCount, err := icebergWriter.createAppendedParquetFiles(schemaTable, pgSchemaColumns, func() ([][]string, error) {
+		rows, err := loadRows()
+		for _, row := range rows {
+			primaryKey := pgRowPrimaryKey(pgSchemaColumns, primaryKeyIndexes, row)
+			if writesEqualityDeletes && !upsertedPrimaryKeys.Contains(primaryKey) {
+				upsertedPrimaryKeyRows = append(upsertedPrimaryKeyRows, pgRowPrimaryKeyValues(primaryKeyIndexes, row))
+			}
+			upsertedPrimaryKeys.Add(primaryKey)
+		}
+		return rows, err
+	})
+	if err != nil || recordCount == 0 {
+		return nil, 0, err
+	}
+
+	var deleteFiles []ParquetFile
+	if writesEqualityDeletes {
+		var deleteFile ParquetFile
+		deleteFile, err = icebergWriter.createEqualityDeleteFile(schemaTable, pgSchemaColumns, primaryKeyIndexes, upsertedPrimaryKeyRows)
+		if err != nil {
+			icebergWriter.deleteUncommittedParquetFiles(schemaTable, appendedParquetFiles)
+			return nil, 0, err
+		}
+		deleteFiles = []ParquetFile{deleteFile}
+	}
+	for attempt := 1; ; attempt++ {
+		if !writesEqualityDeletes {
+			var positionDeleteRows [][]string
+			positionDeleteRows, err = icebergWriter.positionDeleteRows(existingTable, pgSchemaColumns, primaryKeyIndexes, upsertedPrimaryKeys)
+			if err != nil {
+				break
+			}
+			deleteFiles, err = icebergWriter.createPositionDeleteFiles(schemaTable, existingTable.dataFiles, positionDeleteRows)
+			if err != nil {
+				break
+			}
+			deletedRowCount = int64(len(positionDeleteRows))
+		}
+
+		err = icebergWriter.writeMetadata(schemaTable, metadataDirPath, existingTable.metadataVersion, icebergSchemaFields(pgSchemaColumns), icebergPartitionFields(pgSchemaColumns), icebergTableProperties(pgSchemaColumns), slices.Concat(existingTable.dataFiles, appendedParquetFiles, existingTable.deleteFiles, deleteFiles))
+		if !icebergWriter.retriesCommit(schemaTable, err, attempt) {
+			break
+		}
+
+		// The rows replaced by the upserted ones are looked up again in the files committed by another writer in the meantime.
+		// An equality delete file applies to them without a lookup, so it's committed again like the appended files
+		if !writesEqualityDeletes {
+			icebergWriter.deleteUncommittedParquetFiles(schemaTable, deleteFiles)
+			deleteFiles = nil
+		}
+		existingTable, err = icebergWriter.readExistingTable(schemaTable, metadataDirPath)
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		icebergWriter.deleteUncommittedParquetFiles(schemaTable, slices.Concat(appendedParquetFiles, deleteFiles))
+		return nil, 0, err
+	}
+	writtenParquetFiles = slices.Concat(appendedParquetFiles, deleteFiles)
+
+	if writesEqualityDeletes {
+		LogComponentInfo(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Appended", recordCount, "row(s) to", schemaTable.String(), "deleting the previous versions of", len(upsertedPrimaryKeyRows), "primary key(s) with an equality delete file")
+	} else {
+		LogComponentInfo(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Appended", recordCount, "row(s) to", schemaTable.String(), "replacing", deletedRowCount, "row(s) with the same primary key")
+	}
+	span.SetAttributes(parquetFilesSpanAttributes(writtenParquetFiles)...)
+	return writtenParquetFiles, deletedRowCount, nil
+}
+
+// Files of the current snapshot that new snapshots are committed on top of
+type icebergExistingTable struct {
+	metadataVersion int64 // 0 for new tables
+	dataFiles       []ParquetFile
+	deleteFiles     []ParquetFile
+}
+
+// The metadata version is read before the files, so that a snapshot committed in between fails the commit instead of being overwritten
+func (icebergWriter *IcebergWriter) readExistingTable(schemaTable IcebergSchemaTable, metadataDirPath string) (existingTable icebergExistingTable, err error) {
+	existingTable.metadataVersion, err = icebergWriter.storage.CurrentMetadataVersion(metadataDirPath)
+	if err != nil {
+		return icebergExistingTable{}, err
+	}
+
+	existingTable.dataFiles, err = icebergWriter.storage.IcebergDataFiles(schemaTable)
+	if err != nil {
+		return icebergExistingTable{}, err
+	}
+
+	existingTable.deleteFiles, err = icebergWriter.storage.IcebergDeleteFiles(schemaTable)
+	if err != nil {
+		return icebergExistingTable{}, err
+	}
+
+	return existingTable, nil
+}
+
+// Deletes the written files again if loading the rows fails or there are no rows
+func (icebergWriter *IcebergWriter) createAppendedParquetFiles(schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() ([][]string, error)) (appendedParquetFiles []ParquetFile, recordCount int64, err error) {
+	dataDirPath := icebergWriter.storage.CreateDataDir(schemaTable)
+
+	createParquetFiles := icebergWriter.createRollingParquetFiles
+	if icebergPartitionColumnIndex(pgSchemaColumns) != -1 {
+		createParquetFiles = icebergWriter.createPartitionedParquetFiles
+	}
+
+	var loadErr error
+	appendedParquetFiles, err = createParquetFiles(dataDirPath, pgSchemaColumns, func() [][]string {
+		if loadErr != nil {
+			return [][]string{}
+		}
+		var rows [][]string
+		rows, loadErr = loadRows()
+		if loadErr != nil {
+			return [][]string{}
+		}
+		return rows
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, parquetFile := range appendedParquetFiles {
+		recordCount += parquetFile.RecordCount
+	}
+	if loadErr != nil || recordCount == 0 {
+		for _, parquetFile := range appendedParquetFiles {
+			err = icebergWriter.storage.DeleteParquet(parquetFile)
+			if err != nil {
+				break
+			}
+		}
+		if loadErr != nil {
+			return nil, 0, loadErr
+		}
+		return nil, 0, err
+	}
+
+	return appendedParquetFiles, recordCount, nil
+}
+
+// Returns the locations and positions of the existing rows with the upserted primary keys, skipping already deleted rows.
+// Only the primary key columns of the data files are read. Rows are sorted by location and position as required by the Iceberg spec
+func (icebergWriter *IcebergWriter) positionDeleteRows(existingTable icebergExistingTable, pgSchemaColumns []PgSchemaColumn, primaryKeyIndexes []int, upsertedPrimaryKeys Set[string]) (positionDeleteRows [][]string, err error) {
+	var primaryKeyColumnNames []string
+	for _, index := range primaryKeyIndexes {
+		primaryKeyColumnNames = append(primaryKeyColumnNames, pgSchemaColumns[index].ColumnName)
+	}
+
+	deletedPositions, err := icebergWriter.readDeletedPositions(existingTable.dataFiles, existingTable.deleteFiles, icebergSchemaFields(pgSchemaColumns))
+	if err != nil {
+		return nil, err
+	}
+
+	dataFiles := slices.Clone(existingTable.dataFiles)
+	slices.SortFunc(dataFiles, func(a, b ParquetFile) int {
+		return strings.Compare(icebergWriter.storage.ParquetFileLocation(a), icebergWriter.storage.ParquetFileLocation(b))
+	})
+	for _, dataFile := range dataFiles {
+		location := icebergWriter.storage.ParquetFileLocation(dataFile)
+		rows, err := icebergWriter.storage.ReadParquetFileColumns(dataFile, primaryKeyColumnNames)
+		if err != nil {
+			return nil, err
+		}
+
+		for pos, row := range rows {
+			if deletedPositions[location].Contains(int64(pos)) {
+				continue
+			}
+			primaryKey, ok := icebergRowPrimaryKey(pgSchemaColumns, primaryKeyIndexes, row)
+			if ok && upsertedPrimaryKeys.Contains(primaryKey) {
+				positionDeleteRows = append(positionDeleteRows, []string{location, IntToString(pos)})
+			}
+		}
+	}
+	return positionDeleteRows, nil
+}
+
+// Writes a position delete file for each partition of the data files with deleted rows, since delete files only apply to data files
+// of the same partition. The rows keep their order by location and position within each delete file
+func (icebergWriter *IcebergWriter) createPositionDeleteFiles(schemaTable IcebergSchemaTable, dataFiles []ParquetFile, positionDeleteRows [][]string) (deleteFiles []ParquetFile, err error) {
+	dataFilePartitionValues := make(map[string]interface{})
+	for _, dataFile := range dataFiles {
+		dataFilePartitionValues[icebergWriter.storage.ParquetFileLocation(dataFile)] = dataFile.PartitionValue
+	}
+
+	var partitionValues []interface{}
+	partitionRows := make(map[interface{}][][]string)
+	for _, row := range positionDeleteRows {
+		partitionValue := dataFilePartitionValues[row[0]]
+		if _, ok := partitionRows[partitionValue]; !ok {
+			partitionValues = append(partitionValues, partitionValue)
+		}
+		partitionRows[partitionValue] = append(partitionRows[partitionValue], row)
+	}
+
+	for _, partitionValue := range partitionValues {
+		loaded := false
+		deleteFile, err := icebergWriter.storage.CreateParquet(icebergWriter.storage.CreateDataDir(schemaTable), POSITION_DELETE_PG_SCHEMA_COLUMNS, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return partitionRows[partitionValue]
+		})
+		if err != nil {
+			return nil, err
+		}
+		deleteFile.Content = ICEBERG_CONTENT_POSITION_DELETES
+		deleteFile.PartitionValue = partitionValue
+		deleteFiles = append(deleteFiles, deleteFile)
+	}
+	return deleteFiles, nil
+}
+
+// Writes an equality delete file with the primary keys of the upserted rows, which deletes the previous versions of the rows in the
+// data files committed before it. The primary key columns keep their field IDs, which the delete file lists as its equality fields
+func (icebergWriter *IcebergWriter) createEqualityDeleteFile(schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, primaryKeyIndexes []int, primaryKeyRows [][]string) (deleteFile ParquetFile, err error) {
+	var primaryKeyPgSchemaColumns []PgSchemaColumn
+	var equalityFieldIds []int
+	for _, index := range primaryKeyIndexes {
+		primaryKeyPgSchemaColumns = append(primaryKeyPgSchemaColumns, pgSchemaColumns[index])
+		equalityFieldIds = append(equalityFieldIds, pgSchemaColumns[index].ToIcebergSchemaFieldMap().Id)
+	}
+
+	loaded := false
+	deleteFile, err = icebergWriter.storage.CreateParquet(icebergWriter.storage.CreateDataDir(schemaTable), primaryKeyPgSchemaColumns, func() [][]string {
+		if loaded {
+			return [][]string{}
+		}
+		loaded = true
+		return primaryKeyRows
+	})
+	if err != nil {
+		return ParquetFile{}, err
+	}
+	deleteFile.Content = ICEBERG_CONTENT_EQUALITY_DELETES
+	deleteFile.EqualityFieldIds = equalityFieldIds
+	return deleteFile, nil
+}
+
+// Resolves the equality delete files into position delete files with the same sequence number, which delete the same rows.
+// Equality delete files that don't delete any rows are dropped. Returns the delete files with the resolved ones and the created files
+func (icebergWriter *IcebergWriter) resolveEqualityDeleteFiles(schemaTable IcebergSchemaTable, dataFiles []ParquetFile, deleteFiles []ParquetFile, icebergSchemaFields []IcebergSchemaField) (resolvedDeleteFiles []ParquetFile, createdDeleteFiles []ParquetFile, err error) {
+	var equalityDeleteFiles []ParquetFile
+	for _, deleteFile := range deleteFiles {
+		if deleteFile.Content == ICEBERG_CONTENT_EQUALITY_DELETES {
+			equalityDeleteFiles = append(equalityDeleteFiles, deleteFile)
+		} else {
+			resolvedDeleteFiles = append(resolvedDeleteFiles, deleteFile)
+		}
+	}
+	if len(equalityDeleteFiles) == 0 {
+		return deleteFiles, nil, nil
+	}
+
+	positionDeleteRows, err := resolveEqualityDeletes(dataFiles, equalityDeleteFiles, icebergSchemaFields, icebergWriter.storage.ParquetFileLocation, icebergWriter.storage.ReadParquetFileColumns)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, equalityDeleteFile := range equalityDeleteFiles {
+		positionDeleteFiles, err := icebergWriter.createPositionDeleteFiles(schemaTable, dataFiles, positionDeleteRows[i])
+		if err != nil {
+			icebergWriter.deleteUncommittedParquetFiles(schemaTable, createdDeleteFiles)
+			return nil, nil, err
+		}
+		for _, positionDeleteFile := range positionDeleteFiles {
+			positionDeleteFile.SequenceNumber = equalityDeleteFile.SequenceNumber
+			createdDeleteFiles = append(createdDeleteFiles, positionDeleteFile)
+		}
+	}
+	return slices.Concat(resolvedDeleteFiles, createdDeleteFiles), createdDeleteFiles, nil
+}
+
+// Returns the deleted row positions by data file location
+func (icebergWriter *IcebergWriter) readDeletedPositions(dataFiles []ParquetFile, deleteFiles []ParquetFile, icebergSchemaFields []IcebergSchemaField) (deletedPositions map[string]Set[int64], err error) {
+	return icebergDeletedPositions(dataFiles, deleteFiles, icebergSchemaFields, icebergWriter.storage.ParquetFileLocation, icebergWriter.storage.ReadParquetFileColumns)
+}
+
+// Merges data files smaller than the target file size and writes a new snapshot with the resulting files.
+// The merged files are still referenced by previous snapshots and are deleted by vacuuming once those expire.
+// Equality delete files are resolved into position delete files first, since DuckDB's iceberg_scan doesn't apply them and merged files
+// get a new sequence number that they wouldn't apply to anymore.
+// Data files with deleted rows are kept as they are, since merging them would change the positions of their rows.
+// Row groups are copied without decoding them, so files written before and after a schema change aren't merged together.
+// Files of different partitions aren't merged together either.
+// Fails with errConcurrentModification if another writer commits to the table during the compaction
+func (icebergWriter *IcebergWriter) Compact(schemaTable IcebergSchemaTable, targetFileSize int64) (err error) {
+	metadataDirPath := icebergWriter.storage.CreateMetadataDir(schemaTable)
+	baseVersion, err := icebergWriter.storage.CurrentMetadataVersion(metadataDirPath)
+	if err != nil {
+		return err
+	}
+
+	parquetFiles, err := icebergWriter.storage.IcebergDataFiles(schemaTable)
+	if err != nil {
+		return err
+	}
+
+	deleteFiles, err := icebergWriter.storage.IcebergDeleteFiles(schemaTable)
+	if err != nil {
+		return err
+	}
+
+	icebergSchemaFields, err := icebergWriter.storage.IcebergSchemaFields(schemaTable)
+	if err != nil {
+		return err
+	}
+
+	resolvesEqualityDeletes := slices.ContainsFunc(deleteFiles, func(deleteFile ParquetFile) bool { return deleteFile.Content == ICEBERG_CONTENT_EQUALITY_DELETES })
+	deleteFiles, resolvedDeleteFiles, err := icebergWriter.resolveEqualityDeleteFiles(schemaTable, parquetFiles, deleteFiles, icebergSchemaFields)
+	if err != nil {
+		return err
+	}
+	deletedPositions, err := icebergWriter.readDeletedPositions(parquetFiles, deleteFiles, icebergSchemaFields)
+	if err != nil {
+		icebergWriter.deleteUncommittedParquetFiles(schemaTable, resolvedDeleteFiles)
+		return err
+	}
+	var compactableParquetFiles []ParquetFile
+	for _, parquetFile := range parquetFiles {
+		if len(deletedPositions[icebergWriter.storage.ParquetFileLocation(parquetFile)]) == 0 {
+			compactableParquetFiles = append(compactableParquetFiles, parquetFile)
+		}
+	}
+
+	var bins [][]ParquetFile
+	for _, partitionParquetFiles := range groupParquetFilesByPartition(compactableParquetFiles) {
+		bins = append(bins, CompactionBins(partitionParquetFiles, targetFileSize)...)
+	}
+	if len(bins) == 0 && !resolvesEqualityDeletes {
+		LogComponentDebug(icebergWriter.config, LOG_COMPONENT_ICEBERG, "No Parquet files to compact in", schemaTable.String())
+		return nil
+	}
+
+	properties, err := icebergWriter.storage.IcebergTableProperties(schemaTable)
+	if err != nil {
+		icebergWriter.deleteUncommittedParquetFiles(schemaTable, resolvedDeleteFiles)
+		return err
+	}
+	partitionFields, err := icebergTablePartitionFields(properties)
+	if err != nil {
+		icebergWriter.deleteUncommittedParquetFiles(schemaTable, resolvedDeleteFiles)
+		return err
+	}
 
-	manifestFile, err := icebergWriter.storage.CreateManifest(metadataDirPath, parquetFile)
+	dataDirPath := icebergWriter.storage.CreateDataDir(schemaTable)
+
+	var compactedParquetFiles []ParquetFile
+	mergedParquetFiles := make(map[string]bool)
+	for _, bin := range bins {
+		parquetFile, err := icebergWriter.storage.MergeParquet(dataDirPath, bin)
+		if errors.Is(err, errParquetSchemaMismatch) {
+			LogComponentDebug(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Skipping compaction of", len(bin), "Parquet file(s) written with different schemas in", schemaTable.String())
+			continue
+		}
+		if err != nil {
+			icebergWriter.deleteUncommittedParquetFiles(schemaTable, resolvedDeleteFiles)
+			return err
+		}
+
+		parquetFile.PartitionValue = bin[0].PartitionValue
+		compactedParquetFiles = append(compactedParquetFiles, parquetFile)
+		for _, mergedParquetFile := range bin {
+			mergedParquetFiles[mergedParquetFile.Path] = true
+		}
+	}
+	if len(compactedParquetFiles) == 0 && !resolvesEqualityDeletes {
+		LogComponentDebug(icebergWriter.config, LOG_COMPONENT_ICEBERG, "No Parquet files with the same schema to compact in", schemaTable.String())
+		return nil
+	}
+	mergedBinCount := len(compactedParquetFiles)
+	for _, parquetFile := range parquetFiles {
+		if !mergedParquetFiles[parquetFile.Path] {
+			compactedParquetFiles = append(compactedParquetFiles, parquetFile)
+		}
+	}
+
+	// The merged files may have been replaced or deleted by the snapshot of the other writer, so it's compacted again by the next compaction
+	err = icebergWriter.writeMetadata(schemaTable, metadataDirPath, baseVersion, icebergSchemaFields, partitionFields, properties, append(compactedParquetFiles, deleteFiles...))
+	if err != nil {
+		icebergWriter.deleteUncommittedParquetFiles(schemaTable, slices.Concat(compactedParquetFiles[:mergedBinCount], resolvedDeleteFiles))
+		return err
+	}
+
+	if resolvesEqualityDeletes {
+		LogComponentInfo(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Resolved the equality delete files of", schemaTable.String(), "into", len(resolvedDeleteFiles), "position delete file(s)")
+	}
+	LogComponentInfo(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Compacted", len(mergedParquetFiles), "Parquet file(s) into", mergedBinCount, "in", schemaTable.String())
+	return nil
+}
+
+// Expires snapshots created before the retention period and deletes files that are not referenced by the remaining snapshots.
+// Unreferenced files created within the retention period are kept since they may belong to in-progress writes or reads
+func (icebergWriter *IcebergWriter) Vacuum(schemaTable IcebergSchemaTable, retention time.Duration, dryRun bool) (expiredSnapshotIds []string, orphanFiles []IcebergTableFile, err error) {
+	expireBefore := time.Now().Add(-retention)
+
+	// Like in ExpireSnapshots, the vacuum is computed again on top of a snapshot committed by another writer in the meantime
+	for attempt := 1; ; attempt++ {
+		expiredSnapshotIds, orphanFiles, err = icebergWriter.vacuum(schemaTable, expireBefore, dryRun)
+		if !icebergWriter.retriesCommit(schemaTable, err, attempt) {
+			break
+		}
+	}
+	if err != nil || dryRun {
+		return expiredSnapshotIds, orphanFiles, err
+	}
+
+	for _, orphanFile := range orphanFiles {
+		err = icebergWriter.storage.DeleteIcebergTableFile(orphanFile.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return expiredSnapshotIds, orphanFiles, nil
+}
+
+// Commits the expiry of snapshots created before expireBefore on top of the current metadata version (if any) and returns
+// the orphan files to delete afterwards. Returns errConcurrentModification if another writer committed after the metadata was read
+func (icebergWriter *IcebergWriter) vacuum(schemaTable IcebergSchemaTable, expireBefore time.Time, dryRun bool) (expiredSnapshotIds []string, orphanFiles []IcebergTableFile, err error) {
+	metadataPath, baseVersion, metadataContent, err := icebergWriter.readCurrentMetadata(schemaTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadataContent, expiredSnapshotIds, err = icebergWriter.expireMetadataSnapshots(metadataContent, expireBefore, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	referencedPaths, err := icebergWriter.metadataReferencedPaths(metadataPath, metadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	icebergTableFiles, err := icebergWriter.storage.IcebergTableFiles(schemaTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	gracePeriodPaths, err := icebergWriter.gracePeriodReferencedPaths(icebergTableFiles, referencedPaths, expireBefore)
+	if err != nil {
+		return nil, nil, err
+	}
+	orphanFiles = unreferencedTableFiles(icebergTableFiles, NewSet(slices.Concat(referencedPaths.Values(), gracePeriodPaths.Values())), expireBefore)
+
+	if dryRun || len(expiredSnapshotIds) == 0 {
+		return expiredSnapshotIds, orphanFiles, nil
+	}
+
+	err = icebergWriter.commitMetadataContent(schemaTable, baseVersion, metadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return expiredSnapshotIds, orphanFiles, nil
+}
+
+// Deletes the given table files that are not referenced by any snapshot and were last modified before olderThan.
+// All files of a table without metadata are unreferenced, e.g., when its first write was interrupted
+func (icebergWriter *IcebergWriter) DeleteOrphanFiles(schemaTable IcebergSchemaTable, icebergTableFiles []IcebergTableFile, olderThan time.Time, dryRun bool) (orphanFiles []IcebergTableFile, err error) {
+	metadataPath, err := icebergWriter.storage.IcebergMetadataFilePath(schemaTable)
+	if err != nil {
+		return nil, err
+	}
+	referencedPaths := NewSet([]string{})
+	if slices.ContainsFunc(icebergTableFiles, func(icebergTableFile IcebergTableFile) bool { return icebergTableFile.Path == metadataPath }) {
+		metadataContent, err := icebergWriter.storage.ReadIcebergTableFile(metadataPath)
+		if err != nil {
+			return nil, err
+		}
+		referencedPaths, err = icebergWriter.metadataReferencedPaths(metadataPath, metadataContent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gracePeriodPaths, err := icebergWriter.gracePeriodReferencedPaths(icebergTableFiles, referencedPaths, olderThan)
+	if err != nil {
+		return nil, err
+	}
+	orphanFiles = unreferencedTableFiles(icebergTableFiles, NewSet(slices.Concat(referencedPaths.Values(), gracePeriodPaths.Values())), olderThan)
+
+	if dryRun {
+		return orphanFiles, nil
+	}
+
+	for _, orphanFile := range orphanFiles {
+		err = icebergWriter.storage.DeleteIcebergTableFile(orphanFile.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return orphanFiles, nil
+}
+
+// Returns the files that are not referenced and were last modified before olderThan. A numbered metadata file can be resolved by
+// queries until the next version is committed, so it's kept until the next version was last modified before olderThan instead
+func unreferencedTableFiles(icebergTableFiles []IcebergTableFile, referencedPaths Set[string], olderThan time.Time) (unreferencedFiles []IcebergTableFile) {
+	// Metadata files are superseded by the next version, estimated by the earliest last modification of the later versions present
+	supersededAt := make(map[string]time.Time)
+	laterVersionsLastModified := make(map[string]time.Time)
+	metadataFiles := slices.Clone(icebergTableFiles)
+	slices.SortFunc(metadataFiles, func(a, b IcebergTableFile) int {
+		aVersion, _ := IcebergMetadataFileVersion(a.Path)
+		bVersion, _ := IcebergMetadataFileVersion(b.Path)
+		return cmp.Compare(bVersion, aVersion)
+	})
+	for _, metadataFile := range metadataFiles {
+		if _, ok := IcebergMetadataFileVersion(metadataFile.Path); !ok {
+			continue
+		}
+		metadataDirPath := filepath.Dir(metadataFile.Path)
+		lastModified, ok := laterVersionsLastModified[metadataDirPath]
+		if ok {
+			supersededAt[metadataFile.Path] = lastModified
+		}
+		if !ok || metadataFile.LastModified.Before(lastModified) {
+			laterVersionsLastModified[metadataDirPath] = metadataFile.LastModified
+		}
+	}
+
+	for _, icebergTableFile := range icebergTableFiles {
+		if referencedPaths.Contains(icebergTableFile.Path) {
+			continue
+		}
+		lastModified := icebergTableFile.LastModified
+		if supersededLastModified, ok := supersededAt[icebergTableFile.Path]; ok && supersededLastModified.After(lastModified) {
+			lastModified = supersededLastModified
+		}
+		if lastModified.Before(olderThan) {
+			unreferencedFiles = append(unreferencedFiles, icebergTableFile)
+		}
+	}
+	return unreferencedFiles
+}
+
+// Returns the files of the current snapshots of numbered metadata files that are no longer referenced but kept for the grace period
+// (see unreferencedTableFiles), e.g., after a replace expired their snapshots, since queries that resolved them may still read
+// their files. Manifest lists that were already deleted, e.g., by expiring their snapshots, are skipped
+func (icebergWriter *IcebergWriter) gracePeriodReferencedPaths(icebergTableFiles []IcebergTableFile, referencedPaths Set[string], olderThan time.Time) (gracePeriodPaths Set[string], err error) {
+	tableFilePaths := NewSet([]string{})
+	for _, icebergTableFile := range icebergTableFiles {
+		tableFilePaths.Add(icebergTableFile.Path)
+	}
+	unreferencedPaths := NewSet([]string{})
+	for _, unreferencedFile := range unreferencedTableFiles(icebergTableFiles, referencedPaths, olderThan) {
+		unreferencedPaths.Add(unreferencedFile.Path)
+	}
+
+	manifestListPaths := NewSet([]string{})
+	for _, icebergTableFile := range icebergTableFiles {
+		if _, ok := IcebergMetadataFileVersion(icebergTableFile.Path); !ok || referencedPaths.Contains(icebergTableFile.Path) || unreferencedPaths.Contains(icebergTableFile.Path) {
+			continue
+		}
+		metadataContent, err := icebergWriter.storage.ReadIcebergTableFile(icebergTableFile.Path)
+		if err != nil {
+			return nil, err
+		}
+		manifestListPath, err := parseCurrentSnapshotManifestListPath(metadataContent)
+		if err != nil {
+			return nil, err
+		}
+		if tableFilePaths.Contains(manifestListPath) && !referencedPaths.Contains(manifestListPath) {
+			manifestListPaths.Add(manifestListPath)
+		}
+	}
+
+	return icebergWriter.manifestListReferencedPaths(manifestListPaths.Values())
+}
+
+// Returns the paths of the metadata file, the previous metadata files in its log, the version hint, and the manifest lists,
+// manifests, and data files of all snapshots
+func (icebergWriter *IcebergWriter) metadataReferencedPaths(metadataPath string, metadataContent []byte) (referencedPaths Set[string], err error) {
+	manifestListPaths, err := icebergWriter.parseMetadataManifestListPaths(metadataContent)
+	if err != nil {
+		return nil, err
+	}
+	referencedPaths, err = icebergWriter.manifestListReferencedPaths(manifestListPaths)
+	if err != nil {
+		return nil, err
+	}
+	referencedPaths.Add(metadataPath)
+	referencedPaths.Add(strings.TrimSuffix(metadataPath, filepath.Base(metadataPath)) + VERSION_HINT_FILE_NAME)
+
+	// Nessie commits of retained snapshots stay readable
+	snapshotLog, err := parseIcebergSnapshotLog(metadataContent)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshotLog.Snapshots {
+		referencedPaths.Add(NessieMetadataFilePath(metadataPath, snapshot.SnapshotId.String()))
+	}
+	for _, metadataLogEntry := range snapshotLog.MetadataLog {
+		referencedPaths.Add(metadataLogEntry.MetadataFile)
+	}
+
+	return referencedPaths, nil
+}
+
+// Expires snapshots beyond the keepSnapshots most recent ones that are also older than keepDuration, ignoring a zero setting.
+// Deletes only the files that were referenced by the expired snapshots and are not referenced by any retained snapshot
+func (icebergWriter *IcebergWriter) ExpireSnapshots(schemaTable IcebergSchemaTable, keepSnapshots int, keepDuration time.Duration, dryRun bool) (expiredSnapshotIds []string, expiredFiles []IcebergTableFile, err error) {
+	var expireBefore time.Time
+	if keepDuration > 0 {
+		expireBefore = time.Now().Add(-keepDuration)
+	}
+
+	// The expiry is committed as the next metadata version, so it's computed again on top of a snapshot committed by another writer in the meantime
+	for attempt := 1; ; attempt++ {
+		expiredSnapshotIds, expiredFiles, err = icebergWriter.expireSnapshots(schemaTable, expireBefore, keepSnapshots, dryRun)
+		if !icebergWriter.retriesCommit(schemaTable, err, attempt) {
+			break
+		}
+	}
+	if err != nil || dryRun {
+		return expiredSnapshotIds, expiredFiles, err
+	}
+
+	// Files are deleted only after the metadata is committed, so that it never references deleted files
+	for _, expiredFile := range expiredFiles {
+		err = icebergWriter.storage.DeleteIcebergTableFile(expiredFile.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return expiredSnapshotIds, expiredFiles, nil
+}
+
+// Commits the expiry of snapshots on top of the current metadata version and returns the files to delete afterwards.
+// Returns errConcurrentModification if another writer committed after the metadata was read
+func (icebergWriter *IcebergWriter) expireSnapshots(schemaTable IcebergSchemaTable, expireBefore time.Time, keepSnapshots int, dryRun bool) (expiredSnapshotIds []string, expiredFiles []IcebergTableFile, err error) {
+	_, baseVersion, metadataContent, err := icebergWriter.readCurrentMetadata(schemaTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newMetadataContent, expiredSnapshotIds, err := icebergWriter.expireMetadataSnapshots(metadataContent, expireBefore, keepSnapshots)
+	if err != nil || len(expiredSnapshotIds) == 0 {
+		return nil, nil, err
+	}
+
+	manifestListPaths, err := icebergWriter.parseMetadataManifestListPaths(metadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	retainedManifestListPaths, err := icebergWriter.parseMetadataManifestListPaths(newMetadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	retainedPaths, err := icebergWriter.manifestListReferencedPaths(retainedManifestListPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	retainedManifestListPathSet := NewSet(retainedManifestListPaths)
+	expiredManifestListPaths := []string{}
+	for _, manifestListPath := range manifestListPaths {
+		if !retainedManifestListPathSet.Contains(manifestListPath) {
+			expiredManifestListPaths = append(expiredManifestListPaths, manifestListPath)
+		}
+	}
+	expiredPaths, err := icebergWriter.manifestListReferencedPaths(expiredManifestListPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Files that were already deleted are skipped
+	icebergTableFiles, err := icebergWriter.storage.IcebergTableFiles(schemaTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, icebergTableFile := range icebergTableFiles {
+		if expiredPaths.Contains(icebergTableFile.Path) && !retainedPaths.Contains(icebergTableFile.Path) {
+			expiredFiles = append(expiredFiles, icebergTableFile)
+		}
+	}
+
+	if dryRun {
+		return expiredSnapshotIds, expiredFiles, nil
+	}
+
+	err = icebergWriter.commitMetadataContent(schemaTable, baseVersion, newMetadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return expiredSnapshotIds, expiredFiles, nil
+}
+
+// Returns the current metadata file of the table with its version, which changes to the metadata are committed on top of
+func (icebergWriter *IcebergWriter) readCurrentMetadata(icebergSchemaTable IcebergSchemaTable) (metadataPath string, version int64, metadataContent []byte, err error) {
+	metadataPath, err = icebergWriter.storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	metadataContent, err = icebergWriter.storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	version, _ = IcebergMetadataFileVersion(metadataPath)
+	return metadataPath, version, metadataContent, nil
+}
+
+// Commits metadata derived from the base version as the next version instead of rewriting the base version, which queries
+// may be reading, and registers it in the catalog (if any). Returns errConcurrentModification if another writer committed after the base version
+func (icebergWriter *IcebergWriter) commitMetadataContent(icebergSchemaTable IcebergSchemaTable, baseVersion int64, metadataContent []byte) (err error) {
+	metadataFile, err := icebergWriter.storage.CreateNextMetadata(icebergSchemaTable, baseVersion, metadataContent)
+	if err != nil {
+		return err
+	}
+
+	if icebergWriter.catalog != nil {
+		metadataPath, err := icebergWriter.storage.IcebergMetadataFilePath(icebergSchemaTable)
+		if err != nil {
+			return err
+		}
+		icebergSchemaFields, err := icebergWriter.storage.IcebergSchemaFields(icebergSchemaTable)
+		if err != nil {
+			return err
+		}
+		err = icebergWriter.catalog.UpsertTable(icebergSchemaTable, metadataPath, icebergSchemaFields)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Like in writeMetadata, metadata files beyond the kept versions are left to vacuum
+	if len(metadataFile.ExpiredPaths) > 0 {
+		LogComponentDebug(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Expired", len(metadataFile.ExpiredPaths), "metadata file(s) of", icebergSchemaTable.String())
+	}
+	return nil
+}
+
+// Commits a snapshot with the data files and delete files, which are listed in separate manifests
+// with the partition spec of the fields (see StorageBase.ResolvePartitionSpec), and registers the table in the catalog (if any).
+// Returns errConcurrentModification if another writer committed after the base version, deleting the manifests written for the snapshot
+func (icebergWriter *IcebergWriter) writeMetadata(schemaTable IcebergSchemaTable, metadataDirPath string, baseVersion int64, icebergSchemaFields []IcebergSchemaField, partitionFields []IcebergPartitionField, properties map[string]string, parquetFiles []ParquetFile) (err error) {
+	var dataFiles, deleteFiles []ParquetFile
+	for _, parquetFile := range parquetFiles {
+		if parquetFile.Content == ICEBERG_CONTENT_DATA {
+			dataFiles = append(dataFiles, parquetFile)
+		} else {
+			deleteFiles = append(deleteFiles, parquetFile)
+		}
+	}
+
+	partitionSpec, err := icebergWriter.storage.ResolvePartitionSpec(metadataDirPath, partitionFields)
 	PanicIfError(err)
 
-	manifestListFile, err := icebergWriter.storage.CreateManifestList(metadataDirPath, parquetFile, manifestFile)
+	// Equality deletes only apply to files with a lower sequence number, so committed files keep theirs
+	sequenceNumber, err := icebergWriter.storage.NextSequenceNumber(metadataDirPath, baseVersion)
+	if errors.Is(err, errConcurrentModification) {
+		return err
+	}
 	PanicIfError(err)
 
-	metadataFile, err := icebergWriter.storage.CreateMetadata(metadataDirPath, pgSchemaColumns, parquetFile, manifestFile, manifestListFile)
+	snapshotId := time.Now().UnixNano()
+	manifestFile, err := icebergWriter.storage.CreateManifest(metadataDirPath, snapshotId, sequenceNumber, partitionSpec, dataFiles)
+	PanicIfError(err)
+	manifestFiles := []ManifestFile{manifestFile}
+	if len(deleteFiles) > 0 {
+		deleteManifestFile, err := icebergWriter.storage.CreateManifest(metadataDirPath, snapshotId, sequenceNumber, partitionSpec, deleteFiles)
+		PanicIfError(err)
+		manifestFiles = append(manifestFiles, deleteManifestFile)
+	}
+
+	manifestListFile, err := icebergWriter.storage.CreateManifestList(metadataDirPath, dataFiles, manifestFiles)
+	PanicIfError(err)
+
+	metadataFile, err := icebergWriter.storage.CreateMetadata(metadataDirPath, baseVersion, icebergSchemaFields, partitionSpec, properties, parquetFiles, manifestFile, manifestListFile)
+	if errors.Is(err, errConcurrentModification) {
+		icebergWriter.storage.DeleteIcebergTableFile(manifestListFile.Path)
+		for _, manifestFile := range manifestFiles {
+			icebergWriter.storage.DeleteIcebergTableFile(manifestFile.Path)
+		}
+		return err
+	}
 	PanicIfError(err)
 
 	err = icebergWriter.storage.CreateVersionHint(metadataDirPath, metadataFile)
 	PanicIfError(err)
+
+	if icebergWriter.catalog != nil {
+		icebergSchemaTable := icebergWriter.prefixedSchemaTable(schemaTable)
+		metadataPath, err := icebergWriter.storage.IcebergMetadataFilePath(icebergSchemaTable)
+		PanicIfError(err)
+		err = icebergWriter.catalog.UpsertTable(icebergSchemaTable, metadataPath, icebergSchemaFields)
+		PanicIfError(err)
+	}
+
+	// Metadata files beyond the kept versions may still be read by queries that resolved them before this commit, so they're
+	// left to vacuum, which deletes them after the grace period (see unreferencedTableFiles)
+	if len(metadataFile.ExpiredPaths) > 0 {
+		LogComponentDebug(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Expired", len(metadataFile.ExpiredPaths), "metadata file(s) of", schemaTable.String())
+	}
+	return nil
+}
+
+// Returns true if the commit lost a race with another writer and can be attempted again after a delay
+func (icebergWriter *IcebergWriter) retriesCommit(schemaTable IcebergSchemaTable, err error, attempt int) bool {
+	if !errors.Is(err, errConcurrentModification) || attempt >= ICEBERG_COMMIT_ATTEMPTS {
+		return false
+	}
+
+	LogComponentWarn(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Retrying the commit to", schemaTable.String(), "after attempt", attempt, "of", ICEBERG_COMMIT_ATTEMPTS, "failed:", err)
+	time.Sleep(time.Duration(attempt) * ICEBERG_COMMIT_RETRY_DELAY)
+	return true
+}
+
+// Deletes the written files of a failed commit, which are referenced by no snapshot
+func (icebergWriter *IcebergWriter) deleteUncommittedParquetFiles(schemaTable IcebergSchemaTable, parquetFiles []ParquetFile) {
+	for _, parquetFile := range parquetFiles {
+		err := icebergWriter.storage.DeleteParquet(parquetFile)
+		if err != nil {
+			LogComponentWarn(icebergWriter.config, LOG_COMPONENT_ICEBERG, "Couldn't delete uncommitted Parquet file", parquetFile.Path, "of", schemaTable.String()+":", err)
+		}
+	}
 }
 
 func (icebergWriter *IcebergWriter) DeleteSchemaTable(schemaTable IcebergSchemaTable) {
 	err := icebergWriter.storage.DeleteSchemaTable(schemaTable)
 	PanicIfError(err)
+
+	if icebergWriter.catalog != nil {
+		err = icebergWriter.catalog.DeleteTable(icebergWriter.prefixedSchemaTable(schemaTable))
+		PanicIfError(err)
+	}
 }
 
 func (icebergWriter *IcebergWriter) DeleteSchema(schema string) {
 	err := icebergWriter.storage.DeleteSchema(schema)
 	PanicIfError(err)
+
+	if icebergWriter.catalog != nil {
+		err = icebergWriter.catalog.DeleteSchema(schema)
+		PanicIfError(err)
+	}
+}
+
+// Storage paths of tables include the schema prefix, which the catalog table names need as well
+func (icebergWriter *IcebergWriter) prefixedSchemaTable(schemaTable IcebergSchemaTable) IcebergSchemaTable {
+	return IcebergSchemaTable{Schema: icebergWriter.config.Pg.SchemaPrefix + schemaTable.Schema, Table: schemaTable.Table}
+}
+
+// Removes snapshots created before expireBefore that are not among the keepSnapshots most recent ones, with no limit for a zero value,
+// except for the current snapshot and snapshots referenced by branches or tags
+func (icebergWriter *IcebergWriter) expireMetadataSnapshots(metadataContent []byte, expireBefore time.Time, keepSnapshots int) (newMetadataContent []byte, expiredSnapshotIds []string, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	var metadata map[string]interface{}
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+
+	liveSnapshotIds := NewSet([]string{fmt.Sprint(metadata["current-snapshot-id"])})
+	if refs, ok := metadata["refs"].(map[string]interface{}); ok {
+		for _, ref := range refs {
+			if ref, ok := ref.(map[string]interface{}); ok {
+				liveSnapshotIds.Add(fmt.Sprint(ref["snapshot-id"]))
+			}
+		}
+	}
+
+	snapshots, _ := metadata["snapshots"].([]interface{})
+	snapshotTimes := make([]time.Time, len(snapshots))
+	for i, snapshot := range snapshots {
+		timestampMs, err := snapshot.(map[string]interface{})["timestamp-ms"].(json.Number).Int64()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse snapshot timestamp: %v", err)
+		}
+		snapshotTimes[i] = time.UnixMilli(timestampMs)
+	}
+
+	// Snapshots are committed in order, so ties of timestamps in the same millisecond are ordered by position
+	recentSnapshotIndexes := make([]int, len(snapshots))
+	for i := range snapshots {
+		recentSnapshotIndexes[i] = i
+	}
+	slices.SortFunc(recentSnapshotIndexes, func(i, j int) int {
+		if compared := snapshotTimes[j].Compare(snapshotTimes[i]); compared != 0 {
+			return compared
+		}
+		return j - i
+	})
+	if keepSnapshots > 0 {
+		for _, index := range recentSnapshotIndexes[:min(keepSnapshots, len(snapshots))] {
+			liveSnapshotIds.Add(fmt.Sprint(snapshots[index].(map[string]interface{})["snapshot-id"]))
+		}
+	}
+
+	liveSnapshots := []interface{}{}
+	for i, snapshot := range snapshots {
+		snapshotId := fmt.Sprint(snapshot.(map[string]interface{})["snapshot-id"])
+		if liveSnapshotIds.Contains(snapshotId) || (!expireBefore.IsZero() && !snapshotTimes[i].Before(expireBefore)) {
+			liveSnapshots = append(liveSnapshots, snapshot)
+		} else {
+			expiredSnapshotIds = append(expiredSnapshotIds, snapshotId)
+		}
+	}
+
+	if len(expiredSnapshotIds) == 0 {
+		return metadataContent, nil, nil
+	}
+
+	expiredSnapshotIdSet := NewSet(expiredSnapshotIds)
+	snapshotLog, _ := metadata["snapshot-log"].([]interface{})
+	liveSnapshotLog := []interface{}{}
+	for _, entry := range snapshotLog {
+		if !expiredSnapshotIdSet.Contains(fmt.Sprint(entry.(map[string]interface{})["snapshot-id"])) {
+			liveSnapshotLog = append(liveSnapshotLog, entry)
+		}
+	}
+	metadata["snapshots"] = liveSnapshots
+	metadata["snapshot-log"] = liveSnapshotLog
+	metadata["last-updated-ms"] = time.Now().UnixMilli()
+
+	newMetadataContent, err = json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialize metadata: %v", err)
+	}
+
+	return append(newMetadataContent, '\n'), expiredSnapshotIds, nil
+}
+
+// Commits the expiry of all snapshots but the current one and of the metadata log on top of the current metadata version,
+// returning the expired snapshots and the previous metadata files that the log listed. Returns errConcurrentModification
+// if another writer committed after the metadata was read
+func (icebergWriter *IcebergWriter) expireReplacedSnapshots(icebergSchemaTable IcebergSchemaTable) (expiredSnapshotIds []string, expiredMetadataPaths []string, err error) {
+	_, baseVersion, metadataContent, err := icebergWriter.readCurrentMetadata(icebergSchemaTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadataContent, expiredSnapshotIds, err = icebergWriter.expireMetadataSnapshots(metadataContent, time.Time{}, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	var metadata map[string]interface{}
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	metadataLog, _ := metadata["metadata-log"].([]interface{})
+	for _, entry := range metadataLog {
+		expiredMetadataPaths = append(expiredMetadataPaths, fmt.Sprint(entry.(map[string]interface{})["metadata-file"]))
+	}
+	if len(expiredSnapshotIds) == 0 && len(expiredMetadataPaths) == 0 {
+		return nil, nil, nil
+	}
+	metadata["metadata-log"] = []interface{}{}
+
+	metadataContent, err = json.Marshal(metadata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialize metadata: %v", err)
+	}
+
+	// The next version lists only the base version in its metadata log, the previous metadata files are left to vacuum like
+	// the ones beyond the kept versions (see writeMetadata)
+	err = icebergWriter.commitMetadataContent(icebergSchemaTable, baseVersion, metadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return expiredSnapshotIds, expiredMetadataPaths, nil
+}
+
+// Returns the manifest lists with the manifests, data files, and delete files that they reference
+func (icebergWriter *IcebergWriter) manifestListReferencedPaths(manifestListPaths []string) (referencedPaths Set[string], err error) {
+	referencedPaths = NewSet([]string{})
+	for _, manifestListPath := range manifestListPaths {
+		referencedPaths.Add(manifestListPath)
+
+		manifestListContent, err := icebergWriter.storage.ReadIcebergTableFile(manifestListPath)
+		if err != nil {
+			return nil, err
+		}
+		manifestPaths, err := parseManifestListManifestPaths(manifestListContent)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, manifestPath := range manifestPaths {
+			referencedPaths.Add(manifestPath)
+
+			manifestContent, err := icebergWriter.storage.ReadIcebergTableFile(manifestPath)
+			if err != nil {
+				return nil, err
+			}
+			dataFilePaths, deleteFilePaths, err := parseManifestFilePaths(manifestContent)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, filePath := range slices.Concat(dataFilePaths, deleteFilePaths) {
+				referencedPaths.Add(filePath)
+			}
+		}
+	}
+	return referencedPaths, nil
+}
+
+func (icebergWriter *IcebergWriter) parseMetadataManifestListPaths(metadataContent []byte) (manifestListPaths []string, err error) {
+	var metadata struct {
+		Snapshots []struct {
+			ManifestList string `json:"manifest-list"`
+		} `json:"snapshots"`
+	}
+	if err := json.Unmarshal(metadataContent, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+
+	for _, snapshot := range metadata.Snapshots {
+		manifestListPaths = append(manifestListPaths, snapshot.ManifestList)
+	}
+
+	return manifestListPaths, nil
 }
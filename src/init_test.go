@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 )
@@ -115,9 +116,10 @@ var PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS = []PgSchemaColumn{
 		ColumnName:       "numeric_column_without_precision",
 		DataType:         "numeric",
 		UdtName:          "numeric",
-		NumericPrecision: "0", // Will be changed to 19
-		NumericScale:     "0", // Will be changed to 19
+		NumericPrecision: "38", // Changed from 0 for the default unconstrained numeric format
+		NumericScale:     "18", // Changed from 0 for the default unconstrained numeric format
 		Namespace:        "pg_catalog",
+		NumericFormat:    PG_UNCONSTRAINED_NUMERIC_FORMAT_DECIMAL,
 	},
 	{
 		ColumnName:        "date_column",
@@ -391,8 +393,13 @@ func init() {
 		}
 	}
 
+	// Writes keep the previous snapshots, so start from empty tables on each run
+	icebergWriter.DeleteSchemaTable(IcebergSchemaTable{Schema: "public", Table: "test_table"})
+	icebergWriter.DeleteSchemaTable(IcebergSchemaTable{Schema: "test_schema", Table: "simple_table"})
+
 	i := 0
 	icebergWriter.Write(
+		context.Background(),
 		IcebergSchemaTable{Schema: "public", Table: "test_table"},
 		PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS,
 		func() [][]string {
@@ -405,6 +412,7 @@ func init() {
 		},
 	)
 	icebergWriter.Write(
+		context.Background(),
 		IcebergSchemaTable{Schema: "test_schema", Table: "simple_table"},
 		TEST_SCHEMA_SIMPLE_TABLE_PG_SCHEMA_COLUMNS,
 		func() [][]string {
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	krb5Client "github.com/jcmturner/gokrb5/v8/client"
+	krb5Config "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+const (
+	DEFAULT_KRB5_CONFIG_PATH = "/etc/krb5.conf"
+	DEFAULT_KRB5_CCACHE_PATH = "/tmp/krb5cc_" // followed by the user id
+)
+
+// Logs in to Kerberos with the keytab if set (as the "user@REALM" principal), or with the credential cache otherwise (e.g., after kinit).
+// Uses the standard KRB5_CONFIG and KRB5CCNAME environment variables to locate krb5.conf and the credential cache
+func NewKrb5Client(keytabPath string, principal string) (*krb5Client.Client, error) {
+	krb5ConfigPath := os.Getenv("KRB5_CONFIG")
+	if krb5ConfigPath == "" {
+		krb5ConfigPath = DEFAULT_KRB5_CONFIG_PATH
+	}
+	krb5Conf, err := krb5Config.Load(krb5ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("kerberos error: couldn't load %s: %w", krb5ConfigPath, err)
+	}
+
+	var client *krb5Client.Client
+	if keytabPath != "" {
+		keytabFile, err := keytab.Load(keytabPath)
+		if err != nil {
+			return nil, fmt.Errorf("kerberos error: couldn't load keytab %s: %w", keytabPath, err)
+		}
+		username, realm, _ := strings.Cut(principal, "@")
+		client = krb5Client.NewWithKeytab(username, realm, keytabFile, krb5Conf, krb5Client.DisablePAFXFAST(true))
+	} else {
+		ccachePath, err := krb5CcachePath()
+		if err != nil {
+			return nil, err
+		}
+		ccache, err := credentials.LoadCCache(ccachePath)
+		if err != nil {
+			return nil, fmt.Errorf("kerberos error: couldn't load credential cache %s: %w", ccachePath, err)
+		}
+		client, err = krb5Client.NewFromCCache(ccache, krb5Conf, krb5Client.DisablePAFXFAST(true))
+		if err != nil {
+			return nil, fmt.Errorf("kerberos error: %w", err)
+		}
+	}
+
+	err = client.Login()
+	if err != nil {
+		return nil, fmt.Errorf("kerberos error: couldn't log in: %w", err)
+	}
+	return client, nil
+}
+
+// KRB5CCNAME may have a "FILE:" prefix, other credential cache types aren't supported
+func krb5CcachePath() (string, error) {
+	ccacheName := os.Getenv("KRB5CCNAME")
+	if ccacheName == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("kerberos error: %w", err)
+		}
+		return DEFAULT_KRB5_CCACHE_PATH + currentUser.Uid, nil
+	}
+
+	cacheType, path, found := strings.Cut(ccacheName, ":")
+	if !found {
+		return ccacheName, nil
+	}
+	if cacheType != "FILE" {
+		return "", errors.New("kerberos error: unsupported credential cache type " + cacheType + ", only FILE is supported")
+	}
+	return path, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"slices"
 )
 
 type LogLevel string
@@ -9,43 +10,96 @@ type LogLevel string
 const (
 	LOG_LEVEL_TRACE = "TRACE"
 	LOG_LEVEL_DEBUG = "DEBUG"
-	LOG_LEVEL_WARN  = "WARN"
 	LOG_LEVEL_INFO  = "INFO"
+	LOG_LEVEL_WARN  = "WARN"
 	LOG_LEVEL_ERROR = "ERROR"
 )
 
+// Ordered from the most to the least verbose level
 var LOG_LEVELS = []string{
 	LOG_LEVEL_TRACE,
 	LOG_LEVEL_DEBUG,
-	LOG_LEVEL_WARN,
 	LOG_LEVEL_INFO,
+	LOG_LEVEL_WARN,
 	LOG_LEVEL_ERROR,
 }
 
+const (
+	LOG_COMPONENT_SYNCER  = "syncer"
+	LOG_COMPONENT_QUERY   = "query"
+	LOG_COMPONENT_ICEBERG = "iceberg"
+)
+
+var LOG_COMPONENTS = []string{
+	LOG_COMPONENT_SYNCER,
+	LOG_COMPONENT_QUERY,
+	LOG_COMPONENT_ICEBERG,
+}
+
 func LogError(config *Config, message ...interface{}) {
-	log.Println(append([]interface{}{"[ERROR]"}, message...)...)
+	logMessage(config, "", LOG_LEVEL_ERROR, message)
 }
 
 func LogWarn(config *Config, message ...interface{}) {
-	if config.LogLevel != LOG_LEVEL_ERROR {
-		log.Println(append([]interface{}{"[WARN]"}, message...)...)
-	}
+	logMessage(config, "", LOG_LEVEL_WARN, message)
 }
 
 func LogInfo(config *Config, message ...interface{}) {
-	if config.LogLevel != LOG_LEVEL_ERROR && config.LogLevel != LOG_LEVEL_WARN {
-		log.Println(append([]interface{}{"[INFO]"}, message...)...)
-	}
+	logMessage(config, "", LOG_LEVEL_INFO, message)
 }
 
 func LogDebug(config *Config, message ...interface{}) {
-	if config.LogLevel == LOG_LEVEL_DEBUG || config.LogLevel == LOG_LEVEL_TRACE {
-		log.Println(append([]interface{}{"[DEBUG]"}, message...)...)
-	}
+	logMessage(config, "", LOG_LEVEL_DEBUG, message)
 }
 
 func LogTrace(config *Config, message ...interface{}) {
-	if config.LogLevel == LOG_LEVEL_TRACE {
-		log.Println(append([]interface{}{"[TRACE]"}, message...)...)
+	logMessage(config, "", LOG_LEVEL_TRACE, message)
+}
+
+// Component messages are logged at the component's level from --log-component-levels, or at the log level if it isn't set
+func LogComponentError(config *Config, component string, message ...interface{}) {
+	logMessage(config, component, LOG_LEVEL_ERROR, message)
+}
+
+func LogComponentWarn(config *Config, component string, message ...interface{}) {
+	logMessage(config, component, LOG_LEVEL_WARN, message)
+}
+
+func LogComponentInfo(config *Config, component string, message ...interface{}) {
+	logMessage(config, component, LOG_LEVEL_INFO, message)
+}
+
+func LogComponentDebug(config *Config, component string, message ...interface{}) {
+	logMessage(config, component, LOG_LEVEL_DEBUG, message)
+}
+
+func LogComponentTrace(config *Config, component string, message ...interface{}) {
+	logMessage(config, component, LOG_LEVEL_TRACE, message)
+}
+
+// Checks the level before formatting, so that messages filtered out don't format their values
+func logMessage(config *Config, component string, level string, message []interface{}) {
+	if !IsLogLevelEnabled(config, component, level) {
+		return
+	}
+
+	prefix := []interface{}{"[" + level + "]"}
+	if component != "" {
+		prefix = append(prefix, "["+component+"]")
+	}
+	log.Println(append(prefix, message...)...)
+}
+
+// Returns true if messages of the level are logged for the component, "" for messages that don't belong to one
+func IsLogLevelEnabled(config *Config, component string, level string) bool {
+	threshold := config.LogLevel
+	if componentLevel, ok := config.LogComponentLevels[component]; ok && component != "" {
+		threshold = componentLevel
+	}
+
+	thresholdIndex := slices.Index(LOG_LEVELS, threshold)
+	if thresholdIndex == -1 {
+		thresholdIndex = slices.Index(LOG_LEVELS, DEFAULT_LOG_LEVEL)
 	}
+	return slices.Index(LOG_LEVELS, level) >= thresholdIndex
 }
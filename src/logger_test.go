@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIsLogLevelEnabled(t *testing.T) {
+	t.Run("logs messages at or above the log level", func(t *testing.T) {
+		config := &Config{LogLevel: LOG_LEVEL_INFO}
+
+		for level, expected := range map[string]bool{LOG_LEVEL_TRACE: false, LOG_LEVEL_DEBUG: false, LOG_LEVEL_INFO: true, LOG_LEVEL_WARN: true, LOG_LEVEL_ERROR: true} {
+			if IsLogLevelEnabled(config, "", level) != expected {
+				t.Errorf("Expected IsLogLevelEnabled for %s to be %t", level, expected)
+			}
+		}
+	})
+
+	t.Run("uses the level of a component instead of the log level", func(t *testing.T) {
+		config := &Config{LogLevel: LOG_LEVEL_INFO, LogComponentLevels: map[string]string{LOG_COMPONENT_ICEBERG: LOG_LEVEL_DEBUG, LOG_COMPONENT_QUERY: LOG_LEVEL_ERROR}}
+
+		if !IsLogLevelEnabled(config, LOG_COMPONENT_ICEBERG, LOG_LEVEL_DEBUG) {
+			t.Error("Expected iceberg DEBUG messages to be logged")
+		}
+		if IsLogLevelEnabled(config, LOG_COMPONENT_QUERY, LOG_LEVEL_WARN) {
+			t.Error("Expected query WARN messages not to be logged")
+		}
+		if IsLogLevelEnabled(config, LOG_COMPONENT_SYNCER, LOG_LEVEL_DEBUG) {
+			t.Error("Expected syncer DEBUG messages not to be logged")
+		}
+		if IsLogLevelEnabled(config, "", LOG_LEVEL_DEBUG) {
+			t.Error("Expected DEBUG messages without a component not to be logged")
+		}
+	})
+
+	t.Run("uses the default log level if it isn't set", func(t *testing.T) {
+		config := &Config{}
+
+		if !IsLogLevelEnabled(config, "", LOG_LEVEL_INFO) || IsLogLevelEnabled(config, "", LOG_LEVEL_DEBUG) {
+			t.Error("Expected messages to be logged at the INFO level")
+		}
+	})
+}
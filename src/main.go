@@ -3,6 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -11,8 +14,24 @@ const VERSION = "0.32.2"
 func main() {
 	var since string
 	flag.StringVar(&since, "since", "", "Sync changes since this time (e.g., '24h' or ISO timestamp)")
+	var sinceTableMetadata bool
+	flag.BoolVar(&sinceTableMetadata, "since-table-metadata", false, "Skip tables with an updatedAt column that haven't changed since their own last sync, instead of a --since time for all tables")
+	var tables string
+	flag.StringVar(&tables, "tables", "", "Sync or validate only these tables, overriding the include/exclude filters (comma-separated, format: schema.table)")
+	var full bool
+	flag.BoolVar(&full, "full", false, "Sync tables fully, ignoring the checksums and xmin snapshots of previous syncs (combine with --tables to rebuild only these tables)")
+	var deleteExisting bool
+	flag.BoolVar(&deleteExisting, "delete-existing", false, "Delete the previous snapshots of Iceberg tables after rewriting them with --full")
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "List snapshots and files that the vacuum, expire-snapshots, or cleanup-orphans command would delete without deleting them")
+	var olderThan time.Duration
+	flag.DurationVar(&olderThan, "older-than", 24*time.Hour, "Delete only orphan files last modified before this duration with the cleanup-orphans command (e.g., '24h')")
+	var limit int
+	flag.IntVar(&limit, "limit", 10, "Number of recent sync runs that the history command prints")
 	
 	config := LoadConfig()
+	shutdownTracing := InitTracing(config)
+	defer shutdownTracing()
 
 	if len(flag.Args()) == 0 {
 		start(config)
@@ -32,12 +51,37 @@ func main() {
 			}
 			LogInfo(config, "Starting sync loop with interval:", config.Pg.SyncInterval)
 			for {
-				syncFromPg(config, since)
+				syncFromPg(config, since, sinceTableMetadata, tables, full, deleteExisting)
+				// Only the first sync of the loop is full, the next ones continue incrementally
+				full, deleteExisting = false, false
 				LogInfo(config, "Sleeping for", config.Pg.SyncInterval)
 				time.Sleep(duration)
 			}
 		} else {
-			syncFromPg(config, since)
+			syncFromPg(config, since, sinceTableMetadata, tables, full, deleteExisting)
+		}
+	case "compact":
+		compactor := NewCompactor(config)
+		compactor.CompactIcebergTables()
+		LogInfo(config, "Compaction completed successfully.")
+	case "vacuum":
+		vacuumer := NewVacuumer(config)
+		vacuumer.VacuumIcebergTables(dryRun)
+		LogInfo(config, "Vacuum completed successfully.")
+	case "expire-snapshots":
+		vacuumer := NewVacuumer(config)
+		vacuumer.ExpireIcebergSnapshots(dryRun)
+		LogInfo(config, "Snapshot expiration completed successfully.")
+	case "cleanup-orphans":
+		vacuumer := NewVacuumer(config)
+		vacuumer.CleanupOrphanFiles(olderThan, dryRun)
+		LogInfo(config, "Orphan file cleanup completed successfully.")
+	case "history":
+		printSyncHistory(config, limit)
+	case "validate":
+		if !validateIcebergTables(config, tables) {
+			shutdownTracing()
+			os.Exit(1)
 		}
 	case "version":
 		fmt.Println("BemiDB version:", VERSION)
@@ -55,12 +99,13 @@ func start(config *Config) {
 	defer duckdb.Close()
 
 	icebergReader := NewIcebergReader(config)
-	queryHandler := NewQueryHandler(config, duckdb, icebergReader)
+	sessionRegistry := NewPgSessionRegistry()
+	queryHandler := NewQueryHandler(config, duckdb, icebergReader, sessionRegistry)
 
 	for {
 		conn := AcceptConnection(tcpListener)
 		LogInfo(config, "BemiDB: Accepted connection from", conn.RemoteAddr())
-		postgres := NewPostgres(config, &conn)
+		postgres := NewPostgres(config, &conn, sessionRegistry)
 
 		go func() {
 			postgres.Run(queryHandler)
@@ -70,12 +115,39 @@ func start(config *Config) {
 	}
 }
 
-func syncFromPg(config *Config, since string) {
+func syncFromPg(config *Config, since string, sinceTableMetadata bool, tables string, full bool, deleteExisting bool) {
 	syncer := NewSyncer(config)
+	if deleteExisting && !full {
+		panic("--delete-existing can only be used with --full")
+	}
+	if full && since != "" {
+		panic("--full can't be combined with --since")
+	}
+	if sinceTableMetadata && since != "" {
+		panic("--since-table-metadata can't be combined with --since")
+	}
+	if sinceTableMetadata && full {
+		panic("--full can't be combined with --since-table-metadata")
+	}
 	
 	var options *SyncOptions
-	if since != "" {
+	if since != "" || sinceTableMetadata || tables != "" || full {
 		options = &SyncOptions{}
+	}
+	if tables != "" {
+		options.Tables = parseSyncTables(tables)
+		LogDebug(config, "Syncing only tables:", tables)
+	}
+	if full {
+		options.Full = true
+		options.DeleteExisting = deleteExisting
+		if deleteExisting {
+			LogInfo(config, "Full sync requested, rewriting all synced tables and deleting their previous snapshots")
+		} else {
+			LogInfo(config, "Full sync requested, rewriting all synced tables")
+		}
+	}
+	if since != "" {
 		
 		var err error
 		duration, err := time.ParseDuration(since)
@@ -91,10 +163,51 @@ func syncFromPg(config *Config, since string) {
 			options.Since = t
 			LogDebug(config, "Syncing changes since:", options.Since.Format(time.RFC3339))
 		}
-	} else {
+	} else if sinceTableMetadata {
+		options.SinceTableMetadata = true
+		LogDebug(config, "Syncing changes since the last sync of each table")
+	} else if tables == "" && !full {
 		LogDebug(config, "No sync options provided, performing full sync")
 	}
 	
-	syncer.SyncFromPostgres(options)
-	LogInfo(config, "Sync from PostgreSQL completed successfully.")
+	summary := syncer.SyncFromPostgres(options)
+	LogInfo(config, "Sync from PostgreSQL completed successfully.", summary.String())
+}
+
+func printSyncHistory(config *Config, limit int) {
+	manifests, err := ReadSyncManifests(config, limit)
+	PanicIfError(err)
+
+	if len(manifests) == 0 {
+		fmt.Println("No sync runs found. Enable sync manifests with --sync-manifests to record them.")
+		return
+	}
+	for _, manifest := range manifests {
+		fmt.Println(manifest.String())
+	}
+}
+
+// Returns false if any table diverges from PostgreSQL
+func validateIcebergTables(config *Config, tables string) bool {
+	var options *SyncOptions
+	if tables != "" {
+		options = &SyncOptions{Tables: parseSyncTables(tables)}
+	}
+
+	validations := NewValidator(config).ValidateIcebergTables(options)
+	PrintTableValidations(os.Stdout, validations)
+	return !slices.ContainsFunc(validations, TableValidation.Diverges)
+}
+
+func parseSyncTables(tables string) Set[string] {
+	tableIds := make(Set[string])
+	for _, tableId := range strings.Split(tables, ",") {
+		tableId = strings.TrimSpace(tableId)
+		schema, table, found := strings.Cut(tableId, ".")
+		if !found || schema == "" || table == "" {
+			panic("Invalid table " + tableId + " for --tables. Must be schema.table")
+		}
+		tableIds.Add(tableId)
+	}
+	return tableIds
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	NESSIE_TIMEOUT           = 30 * time.Second
+	NESSIE_MAX_ERROR_LENGTH  = 1024 // characters of the response body to include in errors
+	NESSIE_REFERENCE_BRANCH  = "BRANCH"
+	NESSIE_CONTENT_TABLE     = "ICEBERG_TABLE"
+	NESSIE_CONTENT_NAMESPACE = "NAMESPACE"
+	NESSIE_OPERATION_PUT     = "PUT"
+	NESSIE_OPERATION_DELETE  = "DELETE"
+
+	// Separates the elements of content keys in URL paths, dots within elements are escaped with the group separator
+	NESSIE_KEY_SEPARATOR         = "."
+	NESSIE_KEY_ESCAPED_SEPARATOR = "\u001D"
+)
+
+type NessieReference struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+type NessieContentKey struct {
+	Elements []string `json:"elements"`
+}
+
+type NessieTable struct {
+	Type             string `json:"type"`
+	Id               string `json:"id,omitempty"` // empty for new tables
+	MetadataLocation string `json:"metadataLocation"`
+	SnapshotId       int64  `json:"snapshotId"`
+	SchemaId         int    `json:"schemaId"`
+	SpecId           int    `json:"specId"`
+	SortOrderId      int    `json:"sortOrderId"`
+}
+
+type NessieNamespace struct {
+	Type     string   `json:"type"`
+	Id       string   `json:"id,omitempty"`
+	Elements []string `json:"elements"`
+}
+
+type NessieOperation struct {
+	Type    string           `json:"type"`
+	Key     NessieContentKey `json:"key"`
+	Content interface{}      `json:"content,omitempty"` // NessieTable or NessieNamespace for PUT operations
+}
+
+type NessieEntry struct {
+	Type string           `json:"type"`
+	Name NessieContentKey `json:"name"`
+}
+
+// Client for the Nessie REST API v2 (https://projectnessie.org/nessie-latest/rest/)
+type NessieClient struct {
+	endpoint   string
+	authToken  string
+	httpClient http.Client
+}
+
+func NewNessieClient(config *Config) *NessieClient {
+	return &NessieClient{
+		endpoint:   config.Nessie.Endpoint + "/api/v2",
+		authToken:  config.Nessie.AuthToken,
+		httpClient: http.Client{Timeout: NESSIE_TIMEOUT, Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}},
+	}
+}
+
+// Accepts a branch or tag name, optionally with a commit hash, e.g., "main@2e1cfa82b035c26cbbbdae632cea070514eb8b773f616aaeaf668e2f0be8f10d"
+func (client *NessieClient) Reference(ref string) (reference NessieReference, err error) {
+	var response struct {
+		Reference NessieReference `json:"reference"`
+	}
+	found, err := client.request(http.MethodGet, "/trees/"+url.PathEscape(ref), nil, nil, &response)
+	if err == nil && !found {
+		err = errors.New("Nessie reference " + ref + " doesn't exist")
+	}
+	return response.Reference, err
+}
+
+func (client *NessieClient) CreateBranch(name string, from NessieReference) (reference NessieReference, err error) {
+	var response struct {
+		Reference NessieReference `json:"reference"`
+	}
+	query := url.Values{"name": {name}, "type": {NESSIE_REFERENCE_BRANCH}}
+	_, err = client.request(http.MethodPost, "/trees", query, from, &response)
+	return response.Reference, err
+}
+
+func (client *NessieClient) DeleteBranch(branch NessieReference) error {
+	_, err := client.request(http.MethodDelete, "/trees/"+client.pathRef(branch), nil, nil, nil)
+	return err
+}
+
+// Returns the branch with its new hash. Fails with a conflict if the branch has moved past its hash and the operations conflict
+func (client *NessieClient) Commit(branch NessieReference, message string, operations []NessieOperation) (newBranch NessieReference, err error) {
+	var response struct {
+		TargetBranch NessieReference `json:"targetBranch"`
+	}
+	body := map[string]interface{}{
+		"commitMeta": map[string]string{"message": message},
+		"operations": operations,
+	}
+	_, err = client.request(http.MethodPost, "/trees/"+client.pathRef(branch)+"/history/commit", nil, body, &response)
+	return response.TargetBranch, err
+}
+
+// Merges the commits of the source branch into the target branch, fast-forwarding it if it hasn't moved since the source branch was created
+func (client *NessieClient) Merge(target NessieReference, source NessieReference, message string) error {
+	body := map[string]string{
+		"fromRefName": source.Name,
+		"fromHash":    source.Hash,
+		"message":     message,
+	}
+	_, err := client.request(http.MethodPost, "/trees/"+client.pathRef(target)+"/history/merge", nil, body, nil)
+	return err
+}
+
+// Returns nil if the table doesn't exist at the reference
+func (client *NessieClient) Table(ref string, key NessieContentKey) (table *NessieTable, err error) {
+	var response struct {
+		Content NessieTable `json:"content"`
+	}
+	found, err := client.request(http.MethodGet, "/trees/"+url.PathEscape(ref)+"/contents/"+client.pathKey(key), nil, nil, &response)
+	if err != nil || !found {
+		return nil, err
+	}
+	if response.Content.Type != NESSIE_CONTENT_TABLE {
+		return nil, fmt.Errorf("Nessie content %s is a %s instead of an Iceberg table", strings.Join(key.Elements, NESSIE_KEY_SEPARATOR), response.Content.Type)
+	}
+	return &response.Content, nil
+}
+
+// Returns false if the namespace doesn't exist at the reference
+func (client *NessieClient) NamespaceExists(ref string, key NessieContentKey) (bool, error) {
+	return client.request(http.MethodGet, "/trees/"+url.PathEscape(ref)+"/contents/"+client.pathKey(key), nil, nil, nil)
+}
+
+// Lists all entries at the reference, fetching them page by page
+func (client *NessieClient) Entries(ref string) (entries []NessieEntry, err error) {
+	query := url.Values{}
+	for {
+		var response struct {
+			Entries []NessieEntry `json:"entries"`
+			HasMore bool          `json:"hasMore"`
+			Token   string        `json:"token"`
+		}
+		_, err = client.request(http.MethodGet, "/trees/"+url.PathEscape(ref)+"/entries", query, nil, &response)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, response.Entries...)
+		if !response.HasMore || response.Token == "" {
+			return entries, nil
+		}
+		query.Set("page-token", response.Token)
+	}
+}
+
+// Returns false for a 404 response, and decodes a successful response into the result (if not nil)
+func (client *NessieClient) request(method string, path string, query url.Values, body interface{}, result interface{}) (found bool, err error) {
+	requestUrl := client.endpoint + path
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return false, err
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(context.Background(), method, requestUrl, bodyReader)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if client.authToken != "" {
+		request.Header.Set("Authorization", "Bearer "+client.authToken)
+	}
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return false, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		responseBody, _ := io.ReadAll(io.LimitReader(response.Body, NESSIE_MAX_ERROR_LENGTH))
+		return false, fmt.Errorf("Nessie request %s %s failed with unexpected status %s: %s", method, path, response.Status, strings.TrimSpace(string(responseBody)))
+	}
+
+	if result != nil {
+		err = json.NewDecoder(response.Body).Decode(result)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, fmt.Errorf("failed to parse Nessie response of %s %s: %w", method, path, err)
+		}
+	}
+	return true, nil
+}
+
+func (client *NessieClient) pathRef(reference NessieReference) string {
+	return url.PathEscape(reference.Name) + "@" + reference.Hash
+}
+
+func (client *NessieClient) pathKey(key NessieContentKey) string {
+	elements := make([]string, len(key.Elements))
+	for i, element := range key.Elements {
+		elements[i] = strings.ReplaceAll(element, NESSIE_KEY_SEPARATOR, NESSIE_KEY_ESCAPED_SEPARATOR)
+	}
+	return url.PathEscape(strings.Join(elements, NESSIE_KEY_SEPARATOR))
+}
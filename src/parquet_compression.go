@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	_ "unsafe"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/xitongsys/parquet-go/compress"
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+const (
+	PARQUET_COMPRESSION_NONE   = "none"
+	PARQUET_COMPRESSION_SNAPPY = "snappy"
+	PARQUET_COMPRESSION_GZIP   = "gzip"
+	PARQUET_COMPRESSION_ZSTD   = "zstd"
+
+	ICEBERG_PROPERTY_PARQUET_COMPRESSION_CODEC = "write.parquet.compression-codec"
+	ICEBERG_PROPERTY_PARQUET_COMPRESSION_LEVEL = "write.parquet.compression-level"
+)
+
+var PARQUET_COMPRESSIONS = []string{
+	PARQUET_COMPRESSION_NONE,
+	PARQUET_COMPRESSION_SNAPPY,
+	PARQUET_COMPRESSION_GZIP,
+	PARQUET_COMPRESSION_ZSTD,
+}
+
+// Supported levels of codecs that have them, the codec's default level is used for 0
+var PARQUET_COMPRESSION_LEVELS = map[string][2]int{
+	PARQUET_COMPRESSION_GZIP: {gzip.BestSpeed, gzip.BestCompression},
+	PARQUET_COMPRESSION_ZSTD: {1, 22},
+}
+
+// parquet-go compresses pages with the compressor registered for the codec of the writer, which always uses the default level
+//
+//go:linkname parquetCompressors github.com/xitongsys/parquet-go/compress.compressors
+var parquetCompressors map[parquet.CompressionCodec]*compress.Compressor
+
+// Levels are set from the config before writing, so all Parquet files written by the process use the same ones
+var parquetGzipLevel, parquetZstdLevel atomic.Int32
+
+// Compressors for the default levels, used if no level is set
+var defaultParquetGzipCompressor, defaultParquetZstdCompressor *compress.Compressor
+
+// Pooled, so that unused compressors of other levels are garbage collected
+var parquetGzipWriterPools [gzip.BestCompression + 1]sync.Pool
+var parquetZstdEncoderPools sync.Map // zstd.EncoderLevel -> *sync.Pool
+
+// Replaces the gzip and zstd compressors before any Parquet file is written, since the map isn't safe for concurrent writes
+func init() {
+	defaultParquetGzipCompressor = parquetCompressors[parquet.CompressionCodec_GZIP]
+	parquetCompressors[parquet.CompressionCodec_GZIP] = &compress.Compressor{
+		Compress:   compressParquetGzip,
+		Uncompress: defaultParquetGzipCompressor.Uncompress,
+	}
+
+	defaultParquetZstdCompressor = parquetCompressors[parquet.CompressionCodec_ZSTD]
+	parquetCompressors[parquet.CompressionCodec_ZSTD] = &compress.Compressor{
+		Compress:   compressParquetZstd,
+		Uncompress: defaultParquetZstdCompressor.Uncompress,
+	}
+}
+
+// Returns the Parquet codec of the configured compression and sets its level for the compressor
+func parquetCompressionCodec(config *Config) parquet.CompressionCodec {
+	switch config.Iceberg.ParquetCompression {
+	case PARQUET_COMPRESSION_NONE:
+		return parquet.CompressionCodec_UNCOMPRESSED
+	case PARQUET_COMPRESSION_SNAPPY:
+		return parquet.CompressionCodec_SNAPPY
+	case PARQUET_COMPRESSION_GZIP:
+		parquetGzipLevel.Store(int32(config.Iceberg.ParquetCompressionLevel))
+		return parquet.CompressionCodec_GZIP
+	default:
+		parquetZstdLevel.Store(int32(config.Iceberg.ParquetCompressionLevel))
+		return parquet.CompressionCodec_ZSTD
+	}
+}
+
+// Records the codec in the Iceberg table properties read by other engines writing to the table
+func setParquetCompressionProperties(config *Config, properties map[string]string) {
+	codec := config.Iceberg.ParquetCompression
+	if codec == "" {
+		codec = PARQUET_COMPRESSION_ZSTD
+	} else if codec == PARQUET_COMPRESSION_NONE {
+		codec = "uncompressed"
+	}
+	properties[ICEBERG_PROPERTY_PARQUET_COMPRESSION_CODEC] = codec
+
+	delete(properties, ICEBERG_PROPERTY_PARQUET_COMPRESSION_LEVEL)
+	if config.Iceberg.ParquetCompressionLevel != 0 {
+		properties[ICEBERG_PROPERTY_PARQUET_COMPRESSION_LEVEL] = IntToString(config.Iceberg.ParquetCompressionLevel)
+	}
+}
+
+func compressParquetGzip(buf []byte) []byte {
+	level := int(parquetGzipLevel.Load())
+	if level == 0 {
+		return defaultParquetGzipCompressor.Compress(buf)
+	}
+
+	result := new(bytes.Buffer)
+	pool := &parquetGzipWriterPools[level]
+	gzipWriter, ok := pool.Get().(*gzip.Writer)
+	if ok {
+		gzipWriter.Reset(result)
+	} else {
+		var err error
+		gzipWriter, err = gzip.NewWriterLevel(result, level)
+		PanicIfError(err)
+	}
+	gzipWriter.Write(buf)
+	gzipWriter.Close()
+	gzipWriter.Reset(nil)
+	pool.Put(gzipWriter)
+	return result.Bytes()
+}
+
+func compressParquetZstd(buf []byte) []byte {
+	level := int(parquetZstdLevel.Load())
+	if level == 0 {
+		return defaultParquetZstdCompressor.Compress(buf)
+	}
+
+	encoderLevel := zstd.EncoderLevelFromZstd(level)
+	pool, _ := parquetZstdEncoderPools.LoadOrStore(encoderLevel, &sync.Pool{})
+	encoder, ok := pool.(*sync.Pool).Get().(*zstd.Encoder)
+	if !ok {
+		var err error
+		encoder, err = zstd.NewWriter(nil, zstd.WithZeroFrames(true), zstd.WithEncoderLevel(encoderLevel), zstd.WithEncoderConcurrency(1))
+		PanicIfError(err)
+	}
+	result := encoder.EncodeAll(buf, nil)
+	pool.(*sync.Pool).Put(encoder)
+	return result
+}
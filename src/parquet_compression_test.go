@@ -0,0 +1,171 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+var COMPRESSION_TEST_PG_SCHEMA_COLUMNS = []PgSchemaColumn{
+	{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog"},
+	{ColumnName: "body", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog"},
+}
+
+// Text-heavy rows with repeated words in a varying order, like log messages or comments
+func compressionTestRows(rowCount int) [][]string {
+	words := strings.Fields("the sync of table users failed with a timeout while exporting rows to parquet files in storage bucket retry later")
+	rows := make([][]string, rowCount)
+	seed := uint32(1)
+	for i := range rows {
+		bodyWords := make([]string, 24)
+		for j := range bodyWords {
+			seed = seed*1664525 + 1013904223
+			bodyWords[j] = words[seed>>16%uint32(len(words))]
+		}
+		rows[i] = []string{IntToString(i), strings.Join(bodyWords, " ")}
+	}
+	return rows
+}
+
+func writeCompressionTestParquetFile(t testing.TB, compression string, level int, rows [][]string) ParquetFile {
+	config := loadTestConfig()
+	config.Iceberg.ParquetCompression = compression
+	config.Iceberg.ParquetCompressionLevel = level
+	storage := NewLocalStorage(config)
+	loaded := false
+
+	parquetFile, err := storage.CreateParquet(t.TempDir(), COMPRESSION_TEST_PG_SCHEMA_COLUMNS, func() [][]string {
+		if loaded {
+			return [][]string{}
+		}
+		loaded = true
+		return rows
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return parquetFile
+}
+
+func parquetFileCodecs(t *testing.T, path string) []parquet.CompressionCodec {
+	fileReader, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer fileReader.Close()
+	parquetReader, err := reader.NewParquetReader(fileReader, nil, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer parquetReader.ReadStop()
+
+	var codecs []parquet.CompressionCodec
+	for _, rowGroup := range parquetReader.Footer.RowGroups {
+		for _, column := range rowGroup.Columns {
+			codecs = append(codecs, column.MetaData.Codec)
+		}
+	}
+	return codecs
+}
+
+func TestParquetCompression(t *testing.T) {
+	rows := compressionTestRows(5000)
+
+	t.Run("writes data files with the configured codec", func(t *testing.T) {
+		expectedCodecs := map[string]parquet.CompressionCodec{
+			PARQUET_COMPRESSION_NONE:   parquet.CompressionCodec_UNCOMPRESSED,
+			PARQUET_COMPRESSION_SNAPPY: parquet.CompressionCodec_SNAPPY,
+			PARQUET_COMPRESSION_GZIP:   parquet.CompressionCodec_GZIP,
+			PARQUET_COMPRESSION_ZSTD:   parquet.CompressionCodec_ZSTD,
+		}
+		for compression, expectedCodec := range expectedCodecs {
+			parquetFile := writeCompressionTestParquetFile(t, compression, 0, rows)
+
+			codecs := parquetFileCodecs(t, parquetFile.Path)
+			if len(codecs) != 2 || codecs[0] != expectedCodec || codecs[1] != expectedCodec {
+				t.Errorf("Expected the %s compression to write columns with the %s codec, got %v", compression, expectedCodec, codecs)
+			}
+
+			fileReader, err := local.NewLocalFileReader(parquetFile.Path)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			readRows, err := NewLocalStorage(loadTestConfig()).storageBase.ReadParquetColumns(fileReader, []string{"body"})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(readRows) != len(rows) || readRows[len(rows)-1][0] != rows[len(rows)-1][1] {
+				t.Errorf("Expected the %s compressed file to be read back, got %d rows", compression, len(readRows))
+			}
+		}
+	})
+
+	t.Run("writes smaller data files with higher compression levels", func(t *testing.T) {
+		uncompressedFile := writeCompressionTestParquetFile(t, PARQUET_COMPRESSION_NONE, 0, rows)
+		snappyFile := writeCompressionTestParquetFile(t, PARQUET_COMPRESSION_SNAPPY, 0, rows)
+		fastestZstdFile := writeCompressionTestParquetFile(t, PARQUET_COMPRESSION_ZSTD, 1, rows)
+		bestZstdFile := writeCompressionTestParquetFile(t, PARQUET_COMPRESSION_ZSTD, 19, rows)
+		fastestGzipFile := writeCompressionTestParquetFile(t, PARQUET_COMPRESSION_GZIP, 1, rows)
+		bestGzipFile := writeCompressionTestParquetFile(t, PARQUET_COMPRESSION_GZIP, 9, rows)
+
+		if snappyFile.Size >= uncompressedFile.Size {
+			t.Errorf("Expected the snappy file (%d bytes) to be smaller than the uncompressed one (%d bytes)", snappyFile.Size, uncompressedFile.Size)
+		}
+		if bestZstdFile.Size >= fastestZstdFile.Size || bestZstdFile.Size >= snappyFile.Size {
+			t.Errorf("Expected the zstd level 19 file (%d bytes) to be smaller than the level 1 (%d bytes) and snappy (%d bytes) ones", bestZstdFile.Size, fastestZstdFile.Size, snappyFile.Size)
+		}
+		if bestGzipFile.Size >= fastestGzipFile.Size {
+			t.Errorf("Expected the gzip level 9 file (%d bytes) to be smaller than the level 1 one (%d bytes)", bestGzipFile.Size, fastestGzipFile.Size)
+		}
+	})
+
+	t.Run("records the codec and level in the table properties", func(t *testing.T) {
+		config := loadTestConfig()
+		config.Iceberg.ParquetCompression = PARQUET_COMPRESSION_ZSTD
+		config.Iceberg.ParquetCompressionLevel = 6
+		properties := map[string]string{}
+
+		setParquetCompressionProperties(config, properties)
+
+		if properties["write.parquet.compression-codec"] != "zstd" || properties["write.parquet.compression-level"] != "6" {
+			t.Errorf("Expected the zstd codec with level 6, got %v", properties)
+		}
+
+		config.Iceberg.ParquetCompression = PARQUET_COMPRESSION_NONE
+		config.Iceberg.ParquetCompressionLevel = 0
+		setParquetCompressionProperties(config, properties)
+
+		if properties["write.parquet.compression-codec"] != "uncompressed" || properties["write.parquet.compression-level"] != "" {
+			t.Errorf("Expected the uncompressed codec without a level, got %v", properties)
+		}
+	})
+}
+
+func BenchmarkParquetCompression(b *testing.B) {
+	rows := compressionTestRows(20000)
+	compressions := []struct {
+		compression string
+		level       int
+	}{
+		{PARQUET_COMPRESSION_NONE, 0},
+		{PARQUET_COMPRESSION_SNAPPY, 0},
+		{PARQUET_COMPRESSION_GZIP, 0},
+		{PARQUET_COMPRESSION_ZSTD, 0},
+		{PARQUET_COMPRESSION_ZSTD, 6},
+		{PARQUET_COMPRESSION_ZSTD, 19},
+	}
+
+	for _, compression := range compressions {
+		b.Run(filepath.Join(compression.compression, IntToString(compression.level)), func(b *testing.B) {
+			var parquetFile ParquetFile
+			for i := 0; i < b.N; i++ {
+				parquetFile = writeCompressionTestParquetFile(b, compression.compression, compression.level, rows)
+			}
+			b.ReportMetric(float64(parquetFile.Size), "bytes/file")
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+)
+
+const PARQUET_ENCODING_PLAIN_DICTIONARY = "PLAIN_DICTIONARY"
+
+// Iceberg types of columns that can be written with dictionary encoding, decimals regardless of their precision and scale
+var ICEBERG_DICTIONARY_ENCODING_TYPES = []string{
+	"string",
+	"int",
+	"long",
+	"float",
+	"double",
+	"decimal",
+	"date",
+	"time",
+	"timestamp",
+	"timestamptz",
+	"binary",
+	"uuid",
+}
+
+// Dictionary encoding stores the distinct values of a column chunk once, which shrinks columns with few distinct values.
+// Array columns are always written with plain encoding
+func setParquetDictionaryEncoding(config *Config, pgSchemaColumn PgSchemaColumn, fieldMap map[string]interface{}) {
+	if len(config.Iceberg.DictionaryEncodingTypes) == 0 || pgSchemaColumn.isList() {
+		return
+	}
+
+	icebergType, _, _ := strings.Cut(pgSchemaColumn.icebergPrimitiveType(), "(")
+	if config.Iceberg.DictionaryEncodingTypes.Contains(icebergType) {
+		fieldMap["Tag"] = fieldMap["Tag"].(string) + ", encoding=" + PARQUET_ENCODING_PLAIN_DICTIONARY
+	}
+}
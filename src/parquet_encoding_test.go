@@ -0,0 +1,158 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+var ENCODING_TEST_PG_SCHEMA_COLUMNS = []PgSchemaColumn{
+	{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog"},
+	{ColumnName: "category", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog"},
+	{ColumnName: "created_on", DataType: "date", UdtName: "date", IsNullable: "YES", OrdinalPosition: "3", Namespace: "pg_catalog"},
+	{ColumnName: "active", DataType: "boolean", UdtName: "bool", IsNullable: "YES", OrdinalPosition: "4", Namespace: "pg_catalog"},
+	{ColumnName: "tags", DataType: "ARRAY", UdtName: "_text", IsNullable: "YES", OrdinalPosition: "5", Namespace: "pg_catalog"},
+}
+
+// Rows with few distinct values in all columns but the id
+func encodingTestRows(rowCount int) [][]string {
+	categories := []string{"books", "games", "music"}
+	rows := make([][]string, rowCount)
+	for i := range rows {
+		rows[i] = []string{
+			IntToString(i),
+			categories[i%len(categories)],
+			"2024-01-0" + IntToString(i%9+1),
+			[]string{"true", "false"}[i%2],
+			"{" + categories[i%len(categories)] + ",new}",
+		}
+	}
+	return rows
+}
+
+func writeEncodingTestParquetFile(t *testing.T, rowGroupRows int, dictionaryEncodingTypes []string, rows [][]string) ParquetFile {
+	config := loadTestConfig()
+	config.Iceberg.RowGroupRows = rowGroupRows
+	config.Iceberg.DictionaryEncodingTypes = NewSet(dictionaryEncodingTypes)
+	storage := NewLocalStorage(config)
+	loaded := false
+
+	parquetFile, err := storage.CreateParquet(t.TempDir(), ENCODING_TEST_PG_SCHEMA_COLUMNS, func() [][]string {
+		if loaded {
+			return [][]string{}
+		}
+		loaded = true
+		return rows
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return parquetFile
+}
+
+func parquetFileFooter(t *testing.T, path string) *parquet.FileMetaData {
+	fileReader, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer fileReader.Close()
+	parquetReader, err := reader.NewParquetReader(fileReader, nil, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer parquetReader.ReadStop()
+
+	return parquetReader.Footer
+}
+
+// Returns the columns of the first row group that have dictionary-encoded pages
+func parquetDictionaryEncodedColumns(footer *parquet.FileMetaData) []string {
+	var columns []string
+	for _, column := range footer.RowGroups[0].Columns {
+		if slices.Contains(column.MetaData.Encodings, parquet.Encoding_PLAIN_DICTIONARY) {
+			columns = append(columns, strings.ToLower(column.MetaData.PathInSchema[0]))
+		}
+	}
+	return columns
+}
+
+func TestParquetEncoding(t *testing.T) {
+	rows := encodingTestRows(5000)
+
+	t.Run("writes a single row group by default", func(t *testing.T) {
+		parquetFile := writeEncodingTestParquetFile(t, 0, nil, rows)
+
+		footer := parquetFileFooter(t, parquetFile.Path)
+		if len(footer.RowGroups) != 1 || footer.RowGroups[0].NumRows != int64(len(rows)) {
+			t.Errorf("Expected 1 row group with %d rows, got %d row group(s)", len(rows), len(footer.RowGroups))
+		}
+		if columns := parquetDictionaryEncodedColumns(footer); len(columns) != 0 {
+			t.Errorf("Expected no dictionary-encoded columns, got %v", columns)
+		}
+	})
+
+	t.Run("limits the number of rows in row groups", func(t *testing.T) {
+		parquetFile := writeEncodingTestParquetFile(t, 1500, nil, rows)
+
+		footer := parquetFileFooter(t, parquetFile.Path)
+		var rowGroupRows []int64
+		for _, rowGroup := range footer.RowGroups {
+			rowGroupRows = append(rowGroupRows, rowGroup.NumRows)
+		}
+		if !slices.Equal(rowGroupRows, []int64{1500, 1500, 1500, 500}) {
+			t.Errorf("Expected row groups with [1500 1500 1500 500] rows, got %v", rowGroupRows)
+		}
+		if parquetFile.RecordCount != int64(len(rows)) {
+			t.Errorf("Expected %d records, got %d", len(rows), parquetFile.RecordCount)
+		}
+	})
+
+	t.Run("writes columns of the configured types with dictionary encoding", func(t *testing.T) {
+		plainFile := writeEncodingTestParquetFile(t, 0, nil, rows)
+		dictionaryFile := writeEncodingTestParquetFile(t, 0, []string{"string", "date"}, rows)
+
+		dictionaryFooter := parquetFileFooter(t, dictionaryFile.Path)
+		columns := parquetDictionaryEncodedColumns(dictionaryFooter)
+		if !slices.Equal(columns, []string{"category", "created_on"}) {
+			t.Errorf("Expected the category and created_on columns to be dictionary-encoded, got %v", columns)
+		}
+
+		plainSize := parquetFileFooter(t, plainFile.Path).RowGroups[0].Columns[1].MetaData.TotalUncompressedSize
+		dictionarySize := dictionaryFooter.RowGroups[0].Columns[1].MetaData.TotalUncompressedSize
+		if dictionarySize >= plainSize {
+			t.Errorf("Expected the dictionary-encoded category column (%d bytes) to be smaller than the plain one (%d bytes)", dictionarySize, plainSize)
+		}
+	})
+
+	t.Run("reads back rows of all row groups and encodings", func(t *testing.T) {
+		parquetFile := writeEncodingTestParquetFile(t, 1500, []string{"int", "string", "date"}, rows)
+
+		fileReader, err := local.NewLocalFileReader(parquetFile.Path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		readRows, err := NewLocalStorage(loadTestConfig()).storageBase.ReadParquetColumns(fileReader, []string{"category"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(readRows) != len(rows) || readRows[len(rows)-1][0] != rows[len(rows)-1][1] {
+			t.Errorf("Expected %d rows to be read back, got %d rows", len(rows), len(readRows))
+		}
+
+		fileReader, err = local.NewLocalFileReader(parquetFile.Path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		stats, err := NewLocalStorage(loadTestConfig()).storageBase.ReadParquetStats(fileReader)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.ValueCounts[1] != int64(len(rows)) {
+			t.Errorf("Expected %d values of the id column across row groups, got %d", len(rows), stats.ValueCounts[1])
+		}
+	})
+}
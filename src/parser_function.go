@@ -19,6 +19,7 @@ var REMAPPED_CONSTANT_BY_PG_FUNCTION_NAME = map[string]string{
 	"current_setting":                    "",
 	"aclexplode":                         "",
 	"pg_get_indexdef":                    "",
+	"pg_sleep":                           "", // the query handler waits for the duration instead
 }
 
 type ParserFunction struct {
@@ -32,6 +33,12 @@ func NewParserFunction(config *Config) *ParserFunction {
 
 func (parser *ParserFunction) RemapToConstant(functionCall *pgQuery.FuncCall) *pgQuery.Node {
 	schemaFunction := parser.SchemaFunction(functionCall)
+
+	// current_database() -> 'bemidb' instead of DuckDB's in-memory database name
+	if schemaFunction.Function == PG_FUNCTION_CURRENT_DATABASE {
+		return pgQuery.MakeAConstStrNode(parser.config.Database, 0)
+	}
+
 	constant, ok := REMAPPED_CONSTANT_BY_PG_FUNCTION_NAME[schemaFunction.Function]
 	if ok {
 		return pgQuery.MakeAConstStrNode(constant, 0)
@@ -71,13 +78,13 @@ func (parser *ParserFunction) SchemaFunction(functionCall *pgQuery.FuncCall) PgS
 	return parser.utils.SchemaFunction(functionCall)
 }
 
-// quote_ident(str) -> concat("\""+str+"\"")
+// quote_ident(str) -> concat("\""+str+"\""), with embedded quotes doubled
 func (parser *ParserFunction) RemapQuoteIdentToConcat(functionCall *pgQuery.FuncCall) *pgQuery.FuncCall {
 	functionCall.Funcname[0] = pgQuery.MakeStrNode("concat")
 	argConstant := functionCall.Args[0].GetAConst()
 	if argConstant != nil {
 		str := argConstant.GetSval().Sval
-		str = "\"" + str + "\""
+		str = QuoteIdentifier(str)
 		functionCall.Args[0] = pgQuery.MakeAConstStrNode(str, 0)
 	}
 
@@ -104,7 +111,7 @@ func (parser *ParserFunction) RemoveSecondArgument(functionCall *pgQuery.FuncCal
 func (parser *ParserFunction) SetConfigValueNode(targetNode *pgQuery.Node, functionCall *pgQuery.FuncCall) *pgQuery.Node {
 	valueNode := functionCall.Args[1]
 	settingName := functionCall.Args[0].GetAConst().GetSval().Sval
-	LogWarn(parser.config, "Unsupported set_config", settingName, ":", functionCall)
+	LogComponentWarn(parser.config, LOG_COMPONENT_QUERY, "Unsupported set_config", settingName, ":", functionCall)
 
 	return valueNode
 }
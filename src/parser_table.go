@@ -1,9 +1,16 @@
 package main
 
 import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	pgQuery "github.com/pganalyze/pg_query_go/v5"
 )
 
+const ISO8601_INTERVAL_REGEXP = `^P(-?[0-9]+)Y(-?[0-9]+)M(-?[0-9]+)DT(-?[0-9]+)H(-?[0-9]+)M(-?[0-9.]+)S$`
+
 type ParserTable struct {
 	config *Config
 	utils  *ParserUtils
@@ -130,6 +137,66 @@ func (parser *ParserTable) MakePgStatUserTablesNode(schemaTables Set[IcebergSche
 	return parser.utils.MakeSubselectWithRowsNode(PG_TABLE_PG_STAT_USER_TABLES, tableDef, rowsValues, alias)
 }
 
+// pg_catalog.pg_stat_activity -> VALUES(values...) t(columns...)
+func (parser *ParserTable) MakePgStatActivityNode(sessions []PgSession, alias string) *pgQuery.Node {
+	tableDef := PG_STAT_ACTIVITY_DEFINITION
+	if len(sessions) == 0 {
+		return parser.MakeEmptyTableNode(PG_TABLE_PG_STAT_ACTIVITY, tableDef, alias)
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "NULL"
+		}
+		return TimeToPgTimestamptzString(t)
+	}
+
+	var rowsValues [][]string
+	for _, session := range sessions {
+		values := make([]string, len(tableDef.Columns))
+
+		for i, col := range tableDef.Columns {
+			switch col.Name {
+			case "datname":
+				values[i] = session.Database
+			case "pid":
+				values[i] = strconv.FormatUint(uint64(session.ProcessId), 10)
+			case "usename":
+				values[i] = session.User
+			case "application_name":
+				values[i] = session.ApplicationName
+			case "client_addr":
+				values[i] = "NULL"
+				if session.ClientAddr != "" {
+					values[i] = session.ClientAddr
+				}
+			case "client_port":
+				values[i] = "NULL"
+				if session.ClientPort != 0 {
+					values[i] = IntToString(session.ClientPort)
+				}
+			case "backend_start":
+				values[i] = formatTime(session.BackendStart)
+			case "query_start":
+				values[i] = formatTime(session.QueryStart)
+			case "state_change":
+				values[i] = formatTime(session.StateChange)
+			case "state":
+				values[i] = session.State
+			case "query":
+				values[i] = session.Query
+			case "backend_type":
+				values[i] = "client backend"
+			default:
+				values[i] = "NULL"
+			}
+		}
+		rowsValues = append(rowsValues, values)
+	}
+
+	return parser.utils.MakeSubselectWithRowsNode(PG_TABLE_PG_STAT_ACTIVITY, tableDef, rowsValues, alias)
+}
+
 // pg_index -> returns (SELECT *, FALSE AS indnullsnotdistinct FROM pg_index)
 func (parser *ParserTable) MakePgIndexNode(qSchemaTable QuerySchemaTable) *pgQuery.Node {
 	targetList := []*pgQuery.Node{
@@ -152,32 +219,120 @@ func (parser *ParserTable) MakePgIndexNode(qSchemaTable QuerySchemaTable) *pgQue
 	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, targetList, fromNode, qSchemaTable.Alias)
 }
 
+// pg_constraint -> returns (SELECT ..., constraint_name AS conname, ..., [1-based column numbers] AS conkey, ... FROM duckdb_constraints() WHERE constraint_type <> 'NOT NULL')
+// DuckDB names constraints by their definitions, numbers their columns from 0, and reports NOT NULL columns as constraints
+func (parser *ParserTable) MakePgConstraintNode(qSchemaTable QuerySchemaTable) *pgQuery.Node {
+	queryTree, err := pgQuery.Parse("SELECT " +
+		"((table_oid * 1000000) + constraint_index) AS oid, " +
+		"constraint_name AS conname, " +
+		"schema_oid AS connamespace, " +
+		"CASE WHEN constraint_type = 'CHECK' THEN 'c' WHEN constraint_type = 'UNIQUE' THEN 'u' WHEN constraint_type = 'PRIMARY KEY' THEN 'p' WHEN constraint_type = 'FOREIGN KEY' THEN 'f' ELSE 'x' END AS contype, " +
+		"FALSE AS condeferrable, FALSE AS condeferred, TRUE AS convalidated, " +
+		"table_oid AS conrelid, 0 AS contypid, 0 AS conindid, 0 AS conparentid, 0 AS confrelid, " +
+		"NULL AS confupdtype, NULL AS confdeltype, NULL AS confmatchtype, " +
+		"TRUE AS conislocal, 0 AS coninhcount, FALSE AS connoinherit, " +
+		"list_transform(constraint_column_indexes, i -> i + 1) AS conkey, " +
+		"NULL AS confkey, NULL AS conpfeqop, NULL AS conppeqop, NULL AS conffeqop, NULL AS conexclop, " +
+		"expression AS conbin " +
+		"FROM duckdb_constraints() WHERE constraint_type <> 'NOT NULL'")
+	PanicIfError(err)
+
+	alias := qSchemaTable.Alias
+	if alias == "" {
+		alias = qSchemaTable.Table
+	}
+
+	return &pgQuery.Node{
+		Node: &pgQuery.Node_RangeSubselect{
+			RangeSubselect: &pgQuery.RangeSubselect{
+				Subquery: queryTree.Stmts[0].Stmt,
+				Alias:    &pgQuery.Alias{Aliasname: alias},
+			},
+		},
+	}
+}
+
+// pg_attribute -> returns (SELECT attrelid, ..., CASE WHEN attrelid = [table oid] AND attname = [column] THEN [typmod] ... ELSE atttypmod END AS atttypmod, ... FROM pg_attribute)
+// DuckDB ignores lengths of char(n) and varchar(n) columns, so they are taken from the Iceberg field docs
+func (parser *ParserTable) MakePgAttributeNode(node *pgQuery.Node, qSchemaTable QuerySchemaTable, icebergTableFields map[IcebergSchemaTable][]IcebergTableField) *pgQuery.Node {
+	quote := func(value string) string {
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+
+	schemaTables := make([]IcebergSchemaTable, 0, len(icebergTableFields))
+	for schemaTable := range icebergTableFields {
+		schemaTables = append(schemaTables, schemaTable)
+	}
+	slices.SortFunc(schemaTables, func(a, b IcebergSchemaTable) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	var whenClauses []string
+	for _, schemaTable := range schemaTables {
+		tableOid := "(SELECT table_oid FROM duckdb_tables() WHERE schema_name = " + quote(schemaTable.Schema) + " AND table_name = " + quote(schemaTable.Table) + ")"
+		for _, icebergTableField := range icebergTableFields[schemaTable] {
+			if typmod := icebergTableField.PgTypmod(); typmod != -1 {
+				whenClauses = append(whenClauses, "WHEN attrelid = "+tableOid+" AND attname = "+quote(icebergTableField.Name)+" THEN "+IntToString(typmod))
+			}
+		}
+	}
+	if len(whenClauses) == 0 {
+		return node
+	}
+
+	columns := make([]string, len(PG_ATTRIBUTE_COLUMNS))
+	for i, column := range PG_ATTRIBUTE_COLUMNS {
+		columns[i] = column
+		if column == "atttypmod" {
+			columns[i] = "CASE " + strings.Join(whenClauses, " ") + " ELSE atttypmod END AS atttypmod"
+		}
+	}
+
+	queryTree, err := pgQuery.Parse("SELECT " + strings.Join(columns, ", ") + " FROM " + PG_SCHEMA_PG_CATALOG + "." + PG_TABLE_PG_ATTRIBUTE)
+	PanicIfError(err)
+	selectStatement := queryTree.Stmts[0].Stmt.GetSelectStmt()
+
+	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, selectStatement.TargetList, selectStatement.FromClause[0], qSchemaTable.Alias)
+}
+
 // Other information_schema.* tables
 func (parser *ParserTable) IsTableFromInformationSchema(qSchemaTable QuerySchemaTable) bool {
 	return qSchemaTable.Schema == PG_SCHEMA_INFORMATION_SCHEMA
 }
 
 // iceberg.table -> FROM iceberg_scan('path', skip_schema_inference = true)
-func (parser *ParserTable) MakeIcebergTableNode(tablePath string, qSchemaTable QuerySchemaTable) *pgQuery.Node {
+// Reads the current snapshot of the table, or the snapshot with the given ID if it isn't 0
+func (parser *ParserTable) MakeIcebergTableNode(tablePath string, qSchemaTable QuerySchemaTable, icebergTableFields []IcebergTableField, snapshotId int64) *pgQuery.Node {
+	icebergScanArgs := []*pgQuery.Node{
+		pgQuery.MakeAConstStrNode(
+			tablePath,
+			0,
+		),
+		pgQuery.MakeAExprNode(
+			pgQuery.A_Expr_Kind_AEXPR_OP,
+			[]*pgQuery.Node{pgQuery.MakeStrNode("=")},
+			pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode("skip_schema_inference")}, 0),
+			parser.utils.MakeAConstBoolNode(true),
+			0,
+		),
+	}
+	if snapshotId != 0 {
+		icebergScanArgs = append(icebergScanArgs, pgQuery.MakeAExprNode(
+			pgQuery.A_Expr_Kind_AEXPR_OP,
+			[]*pgQuery.Node{pgQuery.MakeStrNode("=")},
+			pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode("snapshot_from_id")}, 0),
+			parser.utils.MakeAConstBigIntNode(snapshotId),
+			0,
+		))
+	}
+
 	node := pgQuery.MakeSimpleRangeFunctionNode([]*pgQuery.Node{
 		pgQuery.MakeListNode([]*pgQuery.Node{
 			pgQuery.MakeFuncCallNode(
 				[]*pgQuery.Node{
 					pgQuery.MakeStrNode("iceberg_scan"),
 				},
-				[]*pgQuery.Node{
-					pgQuery.MakeAConstStrNode(
-						tablePath,
-						0,
-					),
-					pgQuery.MakeAExprNode(
-						pgQuery.A_Expr_Kind_AEXPR_OP,
-						[]*pgQuery.Node{pgQuery.MakeStrNode("=")},
-						pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode("skip_schema_inference")}, 0),
-						parser.utils.MakeAConstBoolNode(true),
-						0,
-					),
-				},
+				icebergScanArgs,
 				0,
 			),
 		}),
@@ -191,7 +346,93 @@ func (parser *ParserTable) MakeIcebergTableNode(tablePath string, qSchemaTable Q
 		),
 		0,
 	)
-	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, []*pgQuery.Node{selectStarNode}, node, qSchemaTable.Alias)
+	targetList := []*pgQuery.Node{selectStarNode}
+
+	// SELECT col1, [interval, uuid, or json cast or case-insensitive collation](col2) AS col2, ... to keep the column order
+	if slices.ContainsFunc(icebergTableFields, IcebergTableField.IsCastToInterval) ||
+		slices.ContainsFunc(icebergTableFields, IcebergTableField.IsCastToUuid) ||
+		slices.ContainsFunc(icebergTableFields, IcebergTableField.IsCastToJson) ||
+		slices.ContainsFunc(icebergTableFields, IcebergTableField.IsCaseInsensitive) {
+		targetList = []*pgQuery.Node{}
+		for _, icebergTableField := range icebergTableFields {
+			if icebergTableField.IsCastToInterval() {
+				targetList = append(targetList, parser.makeIntervalCastNode(icebergTableField))
+			} else if icebergTableField.IsCastToUuid() {
+				targetList = append(targetList, parser.makeUuidCastNode(icebergTableField))
+			} else if icebergTableField.IsCastToJson() {
+				targetList = append(targetList, parser.makeJsonCastNode(icebergTableField))
+			} else if icebergTableField.IsCaseInsensitive() {
+				targetList = append(targetList, parser.makeCaseInsensitiveNode(icebergTableField))
+			} else {
+				targetList = append(targetList, pgQuery.MakeResTargetNodeWithVal(
+					pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode(icebergTableField.Name)}, 0),
+					0,
+				))
+			}
+		}
+	}
+
+	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, targetList, node, qSchemaTable.Alias)
+}
+
+// DuckDB can't parse ISO 8601 durations, so each component is extracted from the "P1Y2M3DT4H5M6.500000S" format written by the syncer
+func (parser *ParserTable) makeIntervalCastNode(icebergTableField IcebergTableField) *pgQuery.Node {
+	column := QuoteIdentifier(icebergTableField.Name)
+
+	var sql string
+	switch icebergTableField.IntervalFormat() {
+	case PG_INTERVAL_FORMAT_MICROSECONDS:
+		sql = "to_microseconds(" + column + ")"
+	default:
+		component := func(index int, typeName string) string {
+			return "CAST(regexp_extract(" + column + ", '" + ISO8601_INTERVAL_REGEXP + "', " + IntToString(index) + ") AS " + typeName + ")"
+		}
+		sql = "to_months(" + component(1, "INTEGER") + " * 12 + " + component(2, "INTEGER") + ")" +
+			" + to_days(" + component(3, "INTEGER") + ")" +
+			" + to_microseconds(" + component(4, "BIGINT") + " * 3600000000 + " + component(5, "BIGINT") + " * 60000000 + CAST(round(" + component(6, "DECIMAL(18, 6)") + " * 1000000) AS BIGINT))"
+	}
+
+	queryTree, err := pgQuery.Parse("SELECT " + sql + " AS " + column)
+	PanicIfError(err)
+	return queryTree.Stmts[0].Stmt.GetSelectStmt().TargetList[0]
+}
+
+// BLOB -> VARCHAR -> UUID, so that UUIDs are returned as uuid and BLOBs as bytea
+func (parser *ParserTable) makeUuidCastNode(icebergTableField IcebergTableField) *pgQuery.Node {
+	column := QuoteIdentifier(icebergTableField.Name)
+
+	sql := "CAST(CAST(" + column + " AS VARCHAR) AS UUID)"
+	if icebergTableField.IsList {
+		sql = "CAST(CAST(" + column + " AS VARCHAR[]) AS UUID[])"
+	}
+
+	queryTree, err := pgQuery.Parse("SELECT " + sql + " AS " + column)
+	PanicIfError(err)
+	return queryTree.Stmts[0].Stmt.GetSelectStmt().TargetList[0]
+}
+
+// JSON keeps the original text of each value, so ->, ->>, and json_extract() work on the column without casting
+func (parser *ParserTable) makeJsonCastNode(icebergTableField IcebergTableField) *pgQuery.Node {
+	column := QuoteIdentifier(icebergTableField.Name)
+
+	sql := "CAST(" + column + " AS JSON)"
+	if icebergTableField.IsList {
+		sql = "CAST(" + column + " AS JSON[])"
+	}
+
+	queryTree, err := pgQuery.Parse("SELECT " + sql + " AS " + column)
+	PanicIfError(err)
+	return queryTree.Stmts[0].Stmt.GetSelectStmt().TargetList[0]
+}
+
+// The NOCASE collation is kept by expressions that select the column, so equality, IN, joins, GROUP BY, and SELECT DISTINCT fold case
+// like with lower() on both sides, while the original values are returned
+func (parser *ParserTable) makeCaseInsensitiveNode(icebergTableField IcebergTableField) *pgQuery.Node {
+	column := QuoteIdentifier(icebergTableField.Name)
+
+	queryTree, err := pgQuery.Parse("SELECT " + column + " COLLATE NOCASE AS " + column)
+	PanicIfError(err)
+	return queryTree.Stmts[0].Stmt.GetSelectStmt().TargetList[0]
 }
 
 func (parser *ParserTable) SchemaFunction(node *pgQuery.Node) PgSchemaFunction {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strconv"
 	"strings"
 
 	pgQuery "github.com/pganalyze/pg_query_go/v5"
@@ -154,6 +155,23 @@ func (utils *ParserUtils) MakeAConstBoolNode(val bool) *pgQuery.Node {
 	}
 }
 
+// Integer constants are 32-bit in the query tree, so larger values are kept as numeric constants like the parser does
+func (utils *ParserUtils) MakeAConstBigIntNode(val int64) *pgQuery.Node {
+	return &pgQuery.Node{
+		Node: &pgQuery.Node_AConst{
+			AConst: &pgQuery.A_Const{
+				Val: &pgQuery.A_Const_Fval{
+					Fval: &pgQuery.Float{
+						Fval: strconv.FormatInt(val, 10),
+					},
+				},
+				Isnull:   false,
+				Location: 0,
+			},
+		},
+	}
+}
+
 func (utils *ParserUtils) makeTypedConstNode(val string, pgType string) *pgQuery.Node {
 	if val == "NULL" {
 		return &pgQuery.Node{
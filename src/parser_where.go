@@ -1,9 +1,20 @@
 package main
 
 import (
+	"strconv"
+
 	pgQuery "github.com/pganalyze/pg_query_go/v5"
 )
 
+// Comparison of a table column with constants in a WHERE clause, e.g. "created_at >= '2024-01-01'"
+type ColumnPredicate struct {
+	ColumnName string
+	Operator   string   // =, <, <=, >, >=, IN, or BETWEEN
+	Values     []string // constants as written in the query, two for BETWEEN
+}
+
+var COLUMN_PREDICATE_FLIPPED_OPERATORS = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
 type ParserWhere struct {
 	config *Config
 	utils  *ParserUtils
@@ -17,6 +28,117 @@ func (parser *ParserWhere) FunctionCall(whereNode *pgQuery.Node) *pgQuery.FuncCa
 	return whereNode.GetFuncCall()
 }
 
+// Returns the comparisons of the table's columns with constants that the WHERE clause requires, i.e., the clause itself or the
+// arguments of its top-level AND. Columns qualified by another table or alias are skipped
+func (parser *ParserWhere) ColumnPredicates(whereClause *pgQuery.Node, qSchemaTable QuerySchemaTable) (predicates []ColumnPredicate) {
+	if whereClause == nil {
+		return nil
+	}
+
+	conditions := []*pgQuery.Node{whereClause}
+	if boolExpr := whereClause.GetBoolExpr(); boolExpr != nil {
+		if boolExpr.Boolop != pgQuery.BoolExprType_AND_EXPR {
+			return nil
+		}
+		conditions = boolExpr.Args
+	}
+
+	for _, condition := range conditions {
+		aExpr := condition.GetAExpr()
+		if aExpr == nil || len(aExpr.Name) != 1 {
+			continue
+		}
+		operator := aExpr.Name[0].GetString_().GetSval()
+		columnName, isColumn := parser.tableColumnName(aExpr.Lexpr, qSchemaTable)
+
+		switch aExpr.Kind {
+		case pgQuery.A_Expr_Kind_AEXPR_OP:
+			valueNode := aExpr.Rexpr
+			if !isColumn { // constant = column
+				columnName, isColumn = parser.tableColumnName(aExpr.Rexpr, qSchemaTable)
+				valueNode = aExpr.Lexpr
+				operator = COLUMN_PREDICATE_FLIPPED_OPERATORS[operator]
+			}
+			value, isConstant := parser.constantValue(valueNode)
+			if isColumn && isConstant && operator != "" {
+				predicates = append(predicates, ColumnPredicate{ColumnName: columnName, Operator: operator, Values: []string{value}})
+			}
+		case pgQuery.A_Expr_Kind_AEXPR_IN, pgQuery.A_Expr_Kind_AEXPR_BETWEEN:
+			if !isColumn || aExpr.Rexpr.GetList() == nil || (aExpr.Kind == pgQuery.A_Expr_Kind_AEXPR_IN && operator != "=") {
+				continue
+			}
+			values, isConstant := parser.constantValues(aExpr.Rexpr.GetList().Items)
+			if !isConstant {
+				continue
+			}
+			operator = "IN"
+			if aExpr.Kind == pgQuery.A_Expr_Kind_AEXPR_BETWEEN {
+				operator = "BETWEEN"
+			}
+			predicates = append(predicates, ColumnPredicate{ColumnName: columnName, Operator: operator, Values: values})
+		}
+	}
+
+	return predicates
+}
+
+// Returns the column name if the node references a column of the table, unqualified or qualified by its alias (or name without an alias)
+func (parser *ParserWhere) tableColumnName(node *pgQuery.Node, qSchemaTable QuerySchemaTable) (columnName string, ok bool) {
+	columnRef := node.GetColumnRef()
+	if columnRef == nil || len(columnRef.Fields) > 3 {
+		return "", false
+	}
+
+	var names []string
+	for _, field := range columnRef.Fields {
+		if field.GetString_() == nil {
+			return "", false
+		}
+		names = append(names, field.GetString_().Sval)
+	}
+	if len(names) > 1 {
+		qualifier := names[len(names)-2]
+		if (qSchemaTable.Alias != "" && qualifier != qSchemaTable.Alias) || (qSchemaTable.Alias == "" && qualifier != qSchemaTable.Table) {
+			return "", false
+		}
+	}
+	return names[len(names)-1], true
+}
+
+// Returns the value of a constant that isn't NULL, with or without a type cast
+func (parser *ParserWhere) constantValue(node *pgQuery.Node) (value string, ok bool) {
+	if typeCast := node.GetTypeCast(); typeCast != nil {
+		node = typeCast.Arg
+	}
+	aConst := node.GetAConst()
+	if aConst == nil || aConst.Isnull {
+		return "", false
+	}
+
+	switch {
+	case aConst.GetSval() != nil:
+		return aConst.GetSval().Sval, true
+	case aConst.GetIval() != nil:
+		return strconv.Itoa(int(aConst.GetIval().Ival)), true
+	case aConst.GetFval() != nil:
+		return aConst.GetFval().Fval, true
+	case aConst.GetBoolval() != nil:
+		return strconv.FormatBool(aConst.GetBoolval().Boolval), true
+	}
+	return "", false
+}
+
+func (parser *ParserWhere) constantValues(nodes []*pgQuery.Node) (values []string, ok bool) {
+	for _, node := range nodes {
+		value, ok := parser.constantValue(node)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
 // WHERE column NOT IN (values)
 func (parser *ParserWhere) MakeNotInExpressionNode(column string, values []int64, alias string) *pgQuery.Node {
 	columnRefNodes := []*pgQuery.Node{pgQuery.MakeStrNode(column)}
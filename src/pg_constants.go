@@ -17,11 +17,14 @@ const (
 	PG_FUNCTION_SET_CONFIG           = "set_config"
 	PG_FUNCTION_ACLEXPLODE           = "aclexplode"
 	PG_FUNCTION_PG_GET_VIEWDEF       = "pg_get_viewdef"
+	PG_FUNCTION_CURRENT_DATABASE     = "current_database"
+	PG_FUNCTION_PG_SLEEP             = "pg_sleep"
 
 	PG_TABLE_PG_ATTRIBUTE          = "pg_attribute"
 	PG_TABLE_PG_AUTH_MEMBERS       = "pg_auth_members"
 	PG_TABLE_PG_CLASS              = "pg_class"
 	PG_TABLE_PG_COLLATION          = "pg_collation"
+	PG_TABLE_PG_CONSTRAINT         = "pg_constraint"
 	PG_TABLE_PG_DATABASE           = "pg_database"
 	PG_TABLE_PG_EXTENSION          = "pg_extension"
 	PG_TABLE_PG_INDEX              = "pg_index"
@@ -42,6 +45,12 @@ const (
 	PG_TABLE_TABLES                = "tables"
 
 	PG_VAR_SEARCH_PATH = "search_path"
+
+	PG_RELKIND_TABLE             = "r"
+	PG_RELKIND_FOREIGN_TABLE     = "f"
+	PG_RELKIND_PARTITIONED_TABLE = "p"
+	PG_RELKIND_MATERIALIZED_VIEW = "m"
+	PG_RELKIND_VIEW              = "v"
 )
 
 type ColumnDefinition struct {
@@ -427,6 +436,36 @@ var PG_OPCLASS_DEFINITION = TableDefinition{
 	},
 }
 
+// Columns of the pg_catalog.pg_attribute view in DuckDB
+var PG_ATTRIBUTE_COLUMNS = []string{
+	"attrelid",
+	"attname",
+	"atttypid",
+	"attstattarget",
+	"attlen",
+	"attnum",
+	"attndims",
+	"attcacheoff",
+	"atttypmod",
+	"attbyval",
+	"attstorage",
+	"attalign",
+	"attnotnull",
+	"atthasdef",
+	"atthasmissing",
+	"attidentity",
+	"attgenerated",
+	"attisdropped",
+	"attislocal",
+	"attinhcount",
+	"attcollation",
+	"attcompression",
+	"attacl",
+	"attoptions",
+	"attfdwoptions",
+	"attmissingval",
+}
+
 var PG_SYSTEM_TABLES = NewSet([]string{
 	"pg_aggregate",
 	"pg_am",
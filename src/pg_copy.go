@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	PG_COPY_FORMAT_TEXT = "text"
+	PG_COPY_FORMAT_CSV  = "csv"
+
+	PG_COPY_END_OF_DATA = `\.`
+	PG_COPY_BATCH_SIZE  = 10000
+
+	PG_FEATURE_NOT_SUPPORTED_CODE       = "0A000"
+	PG_BAD_COPY_FILE_FORMAT_CODE        = "22P04"
+	PG_INVALID_TEXT_REPRESENTATION_CODE = "22P02"
+	PG_CHARACTER_NOT_IN_REPERTOIRE_CODE = "22021"
+	PG_NOT_NULL_VIOLATION_CODE          = "23502"
+	PG_UNDEFINED_TABLE_CODE             = "42P01"
+	PG_UNDEFINED_COLUMN_CODE            = "42703"
+	PG_DUPLICATE_COLUMN_CODE            = "42701"
+)
+
+// COPY [schema.]table [(column, ...)] FROM STDIN [WITH (option value, ...)]
+type PgCopyStatement struct {
+	SchemaTable IcebergSchemaTable
+	ColumnNames []string // all table columns in their order if not listed
+	Format      string
+	Delimiter   byte
+	NullString  string
+	Header      bool
+	Quote       byte // CSV only
+	Escape      byte // CSV only
+}
+
+// Returns nil without an error if the query is not a COPY ... FROM STDIN statement
+func ParsePgCopyFromStdin(query string) (*PgCopyStatement, error) {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "COPY") {
+		return nil, nil
+	}
+
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return nil, nil
+	}
+	copyStmt := queryTree.Stmts[0].Stmt.GetCopyStmt()
+	if copyStmt == nil || !copyStmt.IsFrom || copyStmt.Filename != "" || copyStmt.IsProgram || copyStmt.Relation == nil {
+		return nil, nil
+	}
+	if copyStmt.WhereClause != nil {
+		return nil, pgCopyNotSupportedError("COPY FROM with WHERE is not supported")
+	}
+
+	copyStatement := &PgCopyStatement{
+		SchemaTable: IcebergSchemaTable{Schema: copyStmt.Relation.Schemaname, Table: copyStmt.Relation.Relname},
+		Format:      PG_COPY_FORMAT_TEXT,
+		Quote:       '"',
+	}
+	if copyStatement.SchemaTable.Schema == "" {
+		copyStatement.SchemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+	for _, attribute := range copyStmt.Attlist {
+		copyStatement.ColumnNames = append(copyStatement.ColumnNames, attribute.GetString_().Sval)
+	}
+
+	var delimiter, nullString, escape *string
+	for _, option := range copyStmt.Options {
+		defElem := option.GetDefElem()
+		value := pgCopyOptionValue(defElem)
+
+		switch defElem.Defname {
+		case "format":
+			if value != PG_COPY_FORMAT_TEXT && value != PG_COPY_FORMAT_CSV {
+				return nil, pgCopyNotSupportedError("COPY format \"" + value + "\" is not supported")
+			}
+			copyStatement.Format = value
+		case "delimiter":
+			delimiter = &value
+		case "null":
+			nullString = &value
+		case "header":
+			switch strings.ToLower(value) {
+			case "", "true", "on", "1":
+				copyStatement.Header = true
+			case "false", "off", "0":
+				copyStatement.Header = false
+			default:
+				return nil, pgCopyNotSupportedError("COPY HEADER " + value + " is not supported")
+			}
+		case "quote":
+			if len(value) != 1 {
+				return nil, pgCopyNotSupportedError("COPY quote must be a single one-byte character")
+			}
+			copyStatement.Quote = value[0]
+		case "escape":
+			escape = &value
+		default:
+			return nil, pgCopyNotSupportedError("COPY option \"" + defElem.Defname + "\" is not supported")
+		}
+	}
+
+	if copyStatement.Format == PG_COPY_FORMAT_CSV {
+		copyStatement.Delimiter = ','
+		copyStatement.NullString = ""
+	} else {
+		copyStatement.Delimiter = '\t'
+		copyStatement.NullString = `\N`
+	}
+	copyStatement.Escape = copyStatement.Quote
+	if delimiter != nil {
+		if len(*delimiter) != 1 || *delimiter == "\n" || *delimiter == "\r" {
+			return nil, pgCopyNotSupportedError("COPY delimiter must be a single one-byte character")
+		}
+		copyStatement.Delimiter = (*delimiter)[0]
+	}
+	if nullString != nil {
+		copyStatement.NullString = *nullString
+	}
+	if escape != nil {
+		if len(*escape) != 1 {
+			return nil, pgCopyNotSupportedError("COPY escape must be a single one-byte character")
+		}
+		copyStatement.Escape = (*escape)[0]
+	}
+
+	return copyStatement, nil
+}
+
+// Option values are strings, numbers, or booleans (e.g., HEADER without a value in the legacy syntax)
+func pgCopyOptionValue(defElem *pgQuery.DefElem) string {
+	if defElem.Arg == nil {
+		return ""
+	}
+
+	switch arg := defElem.Arg.Node.(type) {
+	case *pgQuery.Node_String_:
+		return arg.String_.Sval
+	case *pgQuery.Node_Integer:
+		return IntToString(int(arg.Integer.Ival))
+	case *pgQuery.Node_Boolean:
+		if arg.Boolean.Boolval {
+			return "true"
+		}
+		return "false"
+	default:
+		return ""
+	}
+}
+
+func pgCopyNotSupportedError(message string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_FEATURE_NOT_SUPPORTED_CODE, Message: message}
+}
+
+func pgCopyFormatError(lineNumber int, message string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_BAD_COPY_FILE_FORMAT_CODE, Message: message, Where: fmt.Sprintf("COPY, line %d", lineNumber)}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Reads rows of COPY data in the text or CSV format, returning NULL values as PG_NULL_STRING.
+// Also reads the CSV exported from Postgres on sync
+type PgCopyReader struct {
+	reader     *bufio.Reader
+	statement  *PgCopyStatement
+	LineNumber int
+	MaxRowSize int64 // optional, bytes of CSV row values, 0 for no limit
+
+	// Reused between CSV rows, so that wide values are copied once instead of growing a new buffer for every row
+	csvValue bytes.Buffer
+}
+
+// Returned for a CSV row with values over the max row size. The rest of the row is read without keeping its values,
+// so that the memory is bounded and the next row can still be read
+type PgCopyRowSizeError struct {
+	LineNumber int
+	MaxRowSize int64
+}
+
+func (err *PgCopyRowSizeError) Error() string {
+	return fmt.Sprintf("row on line %d is larger than the max row size of %d bytes", err.LineNumber, err.MaxRowSize)
+}
+
+func NewPgCopyReader(reader io.Reader, copyStatement *PgCopyStatement) *PgCopyReader {
+	return &PgCopyReader{reader: bufio.NewReader(reader), statement: copyStatement}
+}
+
+// Returns io.EOF after the last row or the end-of-data marker
+func (copyReader *PgCopyReader) ReadRow() ([]string, error) {
+	for {
+		var values []string
+		var err error
+		if copyReader.statement.Format == PG_COPY_FORMAT_CSV {
+			values, err = copyReader.readCsvRow()
+		} else {
+			values, err = copyReader.readTextRow()
+		}
+		if err == io.EOF {
+			// Data after the end-of-data marker is ignored, but the COPY still fails if the client aborts it
+			_, err = io.Copy(io.Discard, copyReader.reader)
+			if err == nil {
+				err = io.EOF
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if copyReader.statement.Header && copyReader.LineNumber == 1 {
+			continue
+		}
+		return values, nil
+	}
+}
+
+// Values are separated by the delimiter and backslash sequences are unescaped.
+// NULL values are compared before unescaping, so "\\N" is a literal "\N"
+func (copyReader *PgCopyReader) readTextRow() ([]string, error) {
+	line, err := copyReader.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return nil, err
+	}
+	copyReader.LineNumber++
+
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if line == PG_COPY_END_OF_DATA {
+		return nil, io.EOF
+	}
+
+	var values []string
+	var value, rawValue strings.Builder
+	appendValue := func() {
+		if rawValue.String() == copyReader.statement.NullString {
+			values = append(values, PG_NULL_STRING)
+		} else {
+			values = append(values, value.String())
+		}
+		value.Reset()
+		rawValue.Reset()
+	}
+
+	for i := 0; i < len(line); i++ {
+		char := line[i]
+		if char == copyReader.statement.Delimiter {
+			appendValue()
+			continue
+		}
+
+		rawValue.WriteByte(char)
+		if char != '\\' || i+1 == len(line) {
+			value.WriteByte(char)
+			continue
+		}
+
+		i++
+		char = line[i]
+		rawValue.WriteByte(char)
+		switch char {
+		case 'b':
+			value.WriteByte('\b')
+		case 'f':
+			value.WriteByte('\f')
+		case 'n':
+			value.WriteByte('\n')
+		case 'r':
+			value.WriteByte('\r')
+		case 't':
+			value.WriteByte('\t')
+		case 'v':
+			value.WriteByte('\v')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			code := int(char - '0')
+			for digits := 1; digits < 3 && i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '7'; digits++ {
+				i++
+				rawValue.WriteByte(line[i])
+				code = code*8 + int(line[i]-'0')
+			}
+			value.WriteByte(byte(code))
+		case 'x':
+			code, digits := 0, 0
+			for ; digits < 2 && i+1 < len(line) && isHexDigit(line[i+1]); digits++ {
+				i++
+				rawValue.WriteByte(line[i])
+				code = code*16 + hexDigitValue(line[i])
+			}
+			if digits == 0 {
+				value.WriteByte('x')
+			} else {
+				value.WriteByte(byte(code))
+			}
+		default:
+			value.WriteByte(char)
+		}
+	}
+	appendValue()
+
+	return values, nil
+}
+
+// Values are separated by the delimiter and may be quoted to contain delimiters, quotes, and line breaks.
+// Only unquoted values matching the NULL string are NULL, so an empty quoted value is an empty string
+func (copyReader *PgCopyReader) readCsvRow() ([]string, error) {
+	quote := copyReader.statement.Quote
+	escape := copyReader.statement.Escape
+
+	var values []string
+	value := &copyReader.csvValue
+	value.Reset()
+	quoted, inQuotes, empty := false, false, true
+	var rowSize int64
+	oversized := false
+	writeByte := func(char byte) {
+		if oversized {
+			return
+		}
+		rowSize++
+		if copyReader.MaxRowSize > 0 && rowSize > copyReader.MaxRowSize {
+			oversized = true
+			values = nil
+			value.Reset()
+			return
+		}
+		value.WriteByte(char)
+	}
+	appendValue := func() {
+		if oversized {
+			return
+		}
+		if !quoted && string(value.Bytes()) == copyReader.statement.NullString {
+			values = append(values, PG_NULL_STRING)
+		} else {
+			values = append(values, string(value.Bytes()))
+		}
+		value.Reset()
+		quoted = false
+	}
+
+	for {
+		char, err := copyReader.reader.ReadByte()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, pgCopyFormatError(copyReader.LineNumber+1, "unterminated CSV quoted field")
+			}
+			if empty {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		empty = false
+
+		if inQuotes {
+			if char == escape {
+				next, err := copyReader.reader.Peek(1)
+				if err == nil && (next[0] == quote || next[0] == escape) {
+					copyReader.reader.ReadByte()
+					writeByte(next[0])
+					continue
+				}
+			}
+			if char == quote {
+				inQuotes = false
+				continue
+			}
+			writeByte(char)
+			continue
+		}
+
+		if char == quote {
+			inQuotes, quoted = true, true
+			continue
+		}
+		if char == copyReader.statement.Delimiter {
+			appendValue()
+			continue
+		}
+		if char == '\r' {
+			next, err := copyReader.reader.Peek(1)
+			if err == nil && next[0] == '\n' {
+				copyReader.reader.ReadByte()
+			}
+			break
+		}
+		if char == '\n' {
+			break
+		}
+		writeByte(char)
+	}
+	copyReader.LineNumber++
+
+	if oversized {
+		return nil, &PgCopyRowSizeError{LineNumber: copyReader.LineNumber, MaxRowSize: copyReader.MaxRowSize}
+	}
+
+	if len(values) == 0 && !quoted && string(value.Bytes()) == PG_COPY_END_OF_DATA {
+		return nil, io.EOF
+	}
+	appendValue()
+
+	return values, nil
+}
+
+func isHexDigit(char byte) bool {
+	return (char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
+}
+
+func hexDigitValue(char byte) int {
+	switch {
+	case char >= 'a':
+		return int(char-'a') + 10
+	case char >= 'A':
+		return int(char-'A') + 10
+	default:
+		return int(char - '0')
+	}
+}
+
+// Returned by the reader when the client aborts the COPY with CopyFail
+func pgCopyFailError(message string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_QUERY_CANCELED_CODE, Message: "COPY from stdin failed: " + message}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// COPY TO STDOUT output written into a pipe by a goroutine while it is read on sync.
+// Closing the stream reads the remaining output instead of aborting the COPY, which would close the connection
+type PgCopyStream struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+func (copyStream *PgCopyStream) Close() error {
+	_, err := io.Copy(io.Discard, copyStream.PipeReader)
+	<-copyStream.done
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	krb5Client "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// Authenticates to PostgreSQL with Kerberos tickets obtained from a keytab or the credential cache (e.g., after kinit)
+type PgGss struct {
+	client *krb5Client.Client
+}
+
+func registerPgGssProvider(config *Config) {
+	pgconn.RegisterGSSProvider(func() (pgconn.GSS, error) {
+		return NewPgGss(config)
+	})
+}
+
+func NewPgGss(config *Config) (*PgGss, error) {
+	client, err := NewKrb5Client(config.Pg.KerberosKeytab, config.Pg.KerberosPrincipal)
+	if err != nil {
+		return nil, err
+	}
+	return &PgGss{client: client}, nil
+}
+
+func (gss *PgGss) GetInitToken(host string, service string) ([]byte, error) {
+	return gss.GetInitTokenFromSPN(service + "/" + host)
+}
+
+func (gss *PgGss) GetInitTokenFromSPN(spn string) ([]byte, error) {
+	contextToken, err := spnego.SPNEGOClient(gss.client, spn).InitSecContext()
+	if err != nil {
+		return nil, fmt.Errorf("kerberos error: couldn't initialize the security context for %s: %w", spn, err)
+	}
+	return contextToken.Marshal()
+}
+
+// The server accepts the initial token in a single round trip
+func (gss *PgGss) Continue(inToken []byte) (done bool, outToken []byte, err error) {
+	token := &spnego.SPNEGOToken{}
+	err = token.Unmarshal(inToken)
+	if err != nil {
+		return true, nil, fmt.Errorf("kerberos error: couldn't read the server response: %w", err)
+	}
+	if !token.Resp {
+		return true, nil, errors.New("kerberos error: expected a response token from the server")
+	}
+	if token.NegTokenResp.State() != spnego.NegStateAcceptCompleted {
+		return true, nil, fmt.Errorf("kerberos error: expected the server to accept the security context, got state %d", token.NegTokenResp.State())
+	}
+	return true, nil, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	PG_INTERVAL_MICROSECONDS_PER_SECOND = int64(1_000_000)
+	PG_INTERVAL_MICROSECONDS_PER_MINUTE = 60 * PG_INTERVAL_MICROSECONDS_PER_SECOND
+	PG_INTERVAL_MICROSECONDS_PER_HOUR   = 60 * PG_INTERVAL_MICROSECONDS_PER_MINUTE
+	PG_INTERVAL_MICROSECONDS_PER_DAY    = 24 * PG_INTERVAL_MICROSECONDS_PER_HOUR
+	PG_INTERVAL_MICROSECONDS_PER_MONTH  = 30 * PG_INTERVAL_MICROSECONDS_PER_DAY          // as in EXTRACT(EPOCH FROM interval)
+	PG_INTERVAL_MICROSECONDS_PER_YEAR   = 36525 * PG_INTERVAL_MICROSECONDS_PER_DAY / 100 // 365.25 days
+)
+
+// An interval as stored by PostgreSQL: months, days, and microseconds are kept separately and can have different signs
+type PgInterval struct {
+	Months       int64
+	Days         int64
+	Microseconds int64
+}
+
+// Parses interval values in the "postgres" (default), "postgres_verbose", and "iso_8601" IntervalStyle output formats,
+// e.g. "1 year 2 mons -3 days +04:05:06.5", "@ 1 year 2 mons 3 days 4 hours 5 mins 6.5 secs ago", or "P1Y2M-3DT4H5M6.5S"
+func ParsePgInterval(value string) (interval PgInterval, err error) {
+	trimmedValue := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmedValue, "P") {
+		interval, err = parseIso8601PgInterval(trimmedValue)
+	} else {
+		interval, err = parsePostgresPgInterval(trimmedValue)
+	}
+	if err != nil {
+		return PgInterval{}, fmt.Errorf("invalid interval %s: %v", value, err)
+	}
+	return interval, nil
+}
+
+// Returns the value exported with the ISO8601 interval format, e.g. "P1Y2M-3DT4H5M6.500000S"
+func (interval PgInterval) Iso8601String() string {
+	seconds := interval.Microseconds % PG_INTERVAL_MICROSECONDS_PER_MINUTE
+	secondsSign := ""
+	if seconds < 0 {
+		secondsSign = "-"
+		seconds = -seconds
+	}
+
+	return fmt.Sprintf("P%dY%dM%dDT%dH%dM%s%d.%06dS",
+		interval.Months/12,
+		interval.Months%12,
+		interval.Days,
+		interval.Microseconds/PG_INTERVAL_MICROSECONDS_PER_HOUR,
+		interval.Microseconds%PG_INTERVAL_MICROSECONDS_PER_HOUR/PG_INTERVAL_MICROSECONDS_PER_MINUTE,
+		secondsSign,
+		seconds/PG_INTERVAL_MICROSECONDS_PER_SECOND,
+		seconds%PG_INTERVAL_MICROSECONDS_PER_SECOND,
+	)
+}
+
+// Returns the value exported with the MICROSECONDS interval format, with 30 days per month and 365.25 days per year
+func (interval PgInterval) TotalMicroseconds() int64 {
+	return interval.Months/12*PG_INTERVAL_MICROSECONDS_PER_YEAR +
+		interval.Months%12*PG_INTERVAL_MICROSECONDS_PER_MONTH +
+		interval.Days*PG_INTERVAL_MICROSECONDS_PER_DAY +
+		interval.Microseconds
+}
+
+func parsePostgresPgInterval(value string) (interval PgInterval, err error) {
+	fields := strings.Fields(value)
+	verbose := len(fields) > 0 && fields[0] == "@"
+	if verbose {
+		fields = fields[1:]
+	}
+	ago := len(fields) > 0 && fields[len(fields)-1] == "ago"
+	if ago {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return PgInterval{}, fmt.Errorf("no components")
+	}
+
+	for i := 0; i < len(fields); i++ {
+		if strings.Contains(fields[i], ":") {
+			microseconds, err := parsePgIntervalTime(fields[i])
+			if err != nil {
+				return PgInterval{}, err
+			}
+			interval.Microseconds += microseconds
+			continue
+		}
+
+		if i+1 == len(fields) {
+			return PgInterval{}, fmt.Errorf("missing unit of %s", fields[i])
+		}
+		number, unit := fields[i], strings.TrimSuffix(fields[i+1], "s")
+		i++
+
+		if unit == "sec" || unit == "second" {
+			microseconds, err := parsePgIntervalSeconds(number)
+			if err != nil {
+				return PgInterval{}, err
+			}
+			interval.Microseconds += microseconds
+			continue
+		}
+
+		count, err := strconv.ParseInt(number, 10, 64)
+		if err != nil {
+			return PgInterval{}, fmt.Errorf("invalid number %s", number)
+		}
+		switch unit {
+		case "year":
+			interval.Months += count * 12
+		case "mon", "month":
+			interval.Months += count
+		case "day":
+			interval.Days += count
+		case "hour":
+			interval.Microseconds += count * PG_INTERVAL_MICROSECONDS_PER_HOUR
+		case "min", "minute":
+			interval.Microseconds += count * PG_INTERVAL_MICROSECONDS_PER_MINUTE
+		default:
+			return PgInterval{}, fmt.Errorf("unknown unit %s", fields[i])
+		}
+	}
+
+	if ago {
+		interval = PgInterval{Months: -interval.Months, Days: -interval.Days, Microseconds: -interval.Microseconds}
+	}
+	return interval, nil
+}
+
+// Parses "[+-]hours:minutes[:seconds[.fraction]]", where hours can exceed 24
+func parsePgIntervalTime(value string) (microseconds int64, err error) {
+	sign := int64(1)
+	unsignedValue := value
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if value[0] == '-' {
+			sign = -1
+		}
+		unsignedValue = value[1:]
+	}
+
+	parts := strings.Split(unsignedValue, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %s", value)
+	}
+	for i, part := range parts[:min(len(parts), 2)] {
+		count, err := strconv.ParseUint(part, 10, 63)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %s", value)
+		}
+		microseconds += int64(count) * []int64{PG_INTERVAL_MICROSECONDS_PER_HOUR, PG_INTERVAL_MICROSECONDS_PER_MINUTE}[i]
+	}
+	if len(parts) == 3 {
+		if strings.HasPrefix(parts[2], "-") || strings.HasPrefix(parts[2], "+") {
+			return 0, fmt.Errorf("invalid time %s", value)
+		}
+		secondsMicroseconds, err := parsePgIntervalSeconds(parts[2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %s", value)
+		}
+		microseconds += secondsMicroseconds
+	}
+	return sign * microseconds, nil
+}
+
+// Parses "[+-]seconds[.fraction]" with up to microsecond precision
+func parsePgIntervalSeconds(value string) (microseconds int64, err error) {
+	sign := int64(1)
+	unsignedValue := value
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if value[0] == '-' {
+			sign = -1
+		}
+		unsignedValue = value[1:]
+	}
+
+	wholeSeconds, fraction, _ := strings.Cut(unsignedValue, ".")
+	if len(fraction) > 6 {
+		return 0, fmt.Errorf("invalid seconds %s", value)
+	}
+	seconds, err := strconv.ParseUint(wholeSeconds, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seconds %s", value)
+	}
+	fractionMicroseconds := uint64(0)
+	if fraction != "" {
+		fractionMicroseconds, err = strconv.ParseUint(fraction+strings.Repeat("0", 6-len(fraction)), 10, 63)
+		if err != nil {
+			return 0, fmt.Errorf("invalid seconds %s", value)
+		}
+	}
+	return sign * (int64(seconds)*PG_INTERVAL_MICROSECONDS_PER_SECOND + int64(fractionMicroseconds)), nil
+}
+
+// Parses "P[nY][nM][nW][nD][T[nH][nM][nS]]", where each number can be negative and seconds can have a fraction
+func parseIso8601PgInterval(value string) (interval PgInterval, err error) {
+	designators := strings.TrimPrefix(value, "P")
+	if designators == "" {
+		return PgInterval{}, fmt.Errorf("no components")
+	}
+
+	inTime := false
+	number := ""
+	for _, char := range designators {
+		switch {
+		case char == 'T' && !inTime && number == "":
+			inTime = true
+			continue
+		case char >= '0' && char <= '9' || char == '-' || char == '+' || char == '.':
+			number += string(char)
+			continue
+		case number == "":
+			return PgInterval{}, fmt.Errorf("missing number before %c", char)
+		}
+
+		if inTime && char == 'S' {
+			microseconds, err := parsePgIntervalSeconds(number)
+			if err != nil {
+				return PgInterval{}, err
+			}
+			interval.Microseconds += microseconds
+			number = ""
+			continue
+		}
+
+		count, err := strconv.ParseInt(number, 10, 64)
+		if err != nil {
+			return PgInterval{}, fmt.Errorf("invalid number %s", number)
+		}
+		switch {
+		case !inTime && char == 'Y':
+			interval.Months += count * 12
+		case !inTime && char == 'M':
+			interval.Months += count
+		case !inTime && char == 'W':
+			interval.Days += count * 7
+		case !inTime && char == 'D':
+			interval.Days += count
+		case inTime && char == 'H':
+			interval.Microseconds += count * PG_INTERVAL_MICROSECONDS_PER_HOUR
+		case inTime && char == 'M':
+			interval.Microseconds += count * PG_INTERVAL_MICROSECONDS_PER_MINUTE
+		default:
+			return PgInterval{}, fmt.Errorf("unknown designator %c", char)
+		}
+		number = ""
+	}
+	if number != "" {
+		return PgInterval{}, fmt.Errorf("missing designator after %s", number)
+	}
+
+	return interval, nil
+}
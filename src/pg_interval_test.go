@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParsePgInterval(t *testing.T) {
+	t.Run("parses months, days, and microseconds of each IntervalStyle output format", func(t *testing.T) {
+		for value, expected := range map[string]PgInterval{
+			"00:00:00":                             {},
+			"1 day 02:03:04":                       {Days: 1, Microseconds: 7384000000},
+			"1 year 2 mons 3 days 04:05:06.5":      {Months: 14, Days: 3, Microseconds: 14706500000},
+			"-1 years -2 mons +3 days -04:05:06.5": {Months: -14, Days: 3, Microseconds: -14706500000},
+			"1 mon -1 days":                        {Months: 1, Days: -1},
+			"-00:00:00.000001":                     {Microseconds: -1},
+			"100:00:00":                            {Microseconds: 360000000000},
+			"@ 1 year 2 mons 3 days 4 hours 5 mins 6.5 secs":     {Months: 14, Days: 3, Microseconds: 14706500000},
+			"@ 1 year 2 mons 3 days 4 hours 5 mins 6.5 secs ago": {Months: -14, Days: -3, Microseconds: -14706500000},
+			"@ 1 mon -1 days":       {Months: 1, Days: -1},
+			"P1Y2M3DT4H5M6.5S":      {Months: 14, Days: 3, Microseconds: 14706500000},
+			"P-1Y-2M3DT-4H-5M-6.5S": {Months: -14, Days: 3, Microseconds: -14706500000},
+			"P1Y2M3DT4H5M6.500000S": {Months: 14, Days: 3, Microseconds: 14706500000},
+			"P2W":                   {Days: 14},
+			"PT0S":                  {},
+			"PT-0.000001S":          {Microseconds: -1},
+			"P0Y0M0DT0H0M0.000000S": {},
+		} {
+			interval, err := ParsePgInterval(value)
+
+			if err != nil {
+				t.Fatalf("Expected no error for %s, got %v", value, err)
+			}
+			if interval != expected {
+				t.Errorf("Expected %s to be parsed as %v, got %v", value, expected, interval)
+			}
+		}
+	})
+
+	t.Run("returns an error for invalid intervals", func(t *testing.T) {
+		for _, value := range []string{"", "@", "1", "1 fortnight", "1.5 days", "1:2:3:4", "01:-02:03", "1 sec 1234567", "0.0000001 secs", "P", "P1", "P1S", "PT1D", "P1.5D", "infinity"} {
+			_, err := ParsePgInterval(value)
+
+			if err == nil {
+				t.Errorf("Expected an error for %s", value)
+			}
+		}
+	})
+}
+
+func TestPgIntervalFormats(t *testing.T) {
+	t.Run("formats intervals like the PostgreSQL export expressions", func(t *testing.T) {
+		for _, testCase := range []struct {
+			interval             PgInterval
+			expectedIso8601      string
+			expectedMicroseconds int64
+		}{
+			{PgInterval{}, "P0Y0M0DT0H0M0.000000S", 0},
+			{PgInterval{Days: 1, Microseconds: 7384000000}, "P0Y0M1DT2H3M4.000000S", 93784000000},
+			{PgInterval{Months: 14, Days: 3, Microseconds: 14706500000}, "P1Y2M3DT4H5M6.500000S", 37015506500000},
+			{PgInterval{Months: -14, Days: 3, Microseconds: -14706500000}, "P-1Y-2M3DT-4H-5M-6.500000S", -36497106500000},
+			{PgInterval{Microseconds: -500000}, "P0Y0M0DT0H0M-0.500000S", -500000},
+			{PgInterval{Months: 12}, "P1Y0M0DT0H0M0.000000S", 31557600000000},
+		} {
+			if iso8601 := testCase.interval.Iso8601String(); iso8601 != testCase.expectedIso8601 {
+				t.Errorf("Expected %v to be formatted as %s, got %s", testCase.interval, testCase.expectedIso8601, iso8601)
+			}
+			if microseconds := testCase.interval.TotalMicroseconds(); microseconds != testCase.expectedMicroseconds {
+				t.Errorf("Expected %v to have %d microseconds, got %d", testCase.interval, testCase.expectedMicroseconds, microseconds)
+			}
+		}
+	})
+
+	t.Run("writes interval values in the IntervalStyle output format", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_interval_styles", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		pgSchemaColumns := []PgSchemaColumn{
+			{ColumnName: "iso_column", DataType: "interval", UdtName: "interval", IsNullable: "YES", OrdinalPosition: "1", Namespace: "pg_catalog", IntervalFormat: PG_INTERVAL_FORMAT_ISO8601},
+			{ColumnName: "microseconds_column", DataType: "interval", UdtName: "interval", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog", IntervalFormat: PG_INTERVAL_FORMAT_MICROSECONDS},
+			{ColumnName: "text_column", DataType: "interval", UdtName: "interval", IsNullable: "YES", OrdinalPosition: "3", Namespace: "pg_catalog", IntervalFormat: PG_INTERVAL_FORMAT_TEXT},
+		}
+
+		loaded := false
+		icebergWriter.Write(context.Background(), schemaTable, pgSchemaColumns, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return [][]string{
+				{"-1 years -2 mons +3 days -04:05:06.5", "1 day 02:03:04", "1 day 02:03:04"},
+				{"P1Y2M3DT4H5M6.500000S", "3723000000", "P1D"},
+			}
+		})
+
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"iso_column", "microseconds_column", "text_column"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expectedRows := [][]interface{}{
+			{"P-1Y-2M3DT-4H-5M-6.500000S", int64(93784000000), "1 day 02:03:04"},
+			{"P1Y2M3DT4H5M6.500000S", int64(3723000000), "P1D"},
+		}
+		if !reflect.DeepEqual(rows, expectedRows) {
+			t.Errorf("Expected interval values to be converted to their formats, got %v", rows)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	PG_NETWORK_FAMILY_COLUMN_SUFFIX  = "_family"
+	PG_NETWORK_MASKLEN_COLUMN_SUFFIX = "_masklen"
+
+	PG_NETWORK_FAMILY_IPV4 = 4
+	PG_NETWORK_FAMILY_IPV6 = 6
+)
+
+func isPgNetworkAddressType(typeName string) bool {
+	return typeName == "inet" || typeName == "cidr"
+}
+
+func isPgMacAddressType(typeName string) bool {
+	return typeName == "macaddr" || typeName == "macaddr8"
+}
+
+// Parses inet and cidr values, e.g. "192.168.0.1" (a host address with the /32 mask omitted), "10.0.0.0/8", or "fe80::1%eth0/64".
+// Returns the address with its zone ID, if any, and the prefix length
+func ParsePgNetworkAddress(value string) (address netip.Addr, masklen int, err error) {
+	addressText, masklenText, hasMasklen := strings.Cut(value, "/")
+
+	address, err = netip.ParseAddr(addressText)
+	if err != nil {
+		return netip.Addr{}, 0, fmt.Errorf("invalid network address %s: %v", value, err)
+	}
+
+	masklen = address.BitLen()
+	if hasMasklen {
+		masklen, err = strconv.Atoi(masklenText)
+		if err != nil || masklen < 0 || masklen > address.BitLen() {
+			return netip.Addr{}, 0, fmt.Errorf("invalid network address %s: invalid prefix length %s", value, masklenText)
+		}
+	}
+	return address, masklen, nil
+}
+
+func pgNetworkFamily(address netip.Addr) int {
+	if address.Is4() {
+		return PG_NETWORK_FAMILY_IPV4
+	}
+	return PG_NETWORK_FAMILY_IPV6
+}
+
+// Returns the text form that PostgreSQL outputs for the value, so that it can be compared with synced values as text:
+//   - inet omits the prefix length of host addresses, e.g. "192.168.0.1/32" -> "192.168.0.1"
+//   - cidr always has the prefix length, e.g. "2001:DB8::/32" -> "2001:db8::/32"
+//   - macaddr and macaddr8 are lowercase and colon-separated, e.g. "08-00-2B-01-02-03" -> "08:00:2b:01:02:03"
+//
+// Values that can't be parsed, including cidr values without a prefix length that PostgreSQL derives from the
+// address class, are returned as is
+func CanonicalPgNetworkText(typeName string, value string) string {
+	switch typeName {
+	case "inet", "cidr":
+		if typeName == "cidr" && !strings.Contains(value, "/") {
+			return value
+		}
+		address, masklen, err := ParsePgNetworkAddress(value)
+		if err != nil {
+			return value
+		}
+		if typeName == "inet" && masklen == address.BitLen() {
+			return address.String()
+		}
+		return address.String() + "/" + IntToString(masklen)
+	case "macaddr", "macaddr8":
+		hardwareAddress, err := net.ParseMAC(value)
+		if err != nil || (typeName == "macaddr" && len(hardwareAddress) != 6) || (typeName == "macaddr8" && len(hardwareAddress) != 8) {
+			return value
+		}
+		return hardwareAddress.String()
+	}
+	return value
+}
+
+// Appends integer columns with the address family (4 or 6) and the prefix length of inet and cidr columns,
+// e.g. "client_ip_family" and "client_ip_masklen" for "client_ip", so that rows can be filtered by subnet.
+// Returns the indexes of the source columns in the order of the appended columns
+func (syncer *Syncer) appendPgNetworkDetailColumns(pgSchemaTable PgSchemaTable, pgSchemaColumns []PgSchemaColumn) ([]PgSchemaColumn, []int) {
+	columnNames := NewSet([]string{})
+	maxOrdinalPosition := 0
+	for _, pgSchemaColumn := range pgSchemaColumns {
+		columnNames.Add(pgSchemaColumn.ColumnName)
+		ordinalPosition, err := StringToInt(pgSchemaColumn.OrdinalPosition)
+		PanicIfError(err)
+		maxOrdinalPosition = max(maxOrdinalPosition, ordinalPosition)
+	}
+
+	var detailColumns []PgSchemaColumn
+	var sourceIndexes []int
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		if !isPgNetworkAddressType(pgSchemaColumn.UdtName) {
+			continue
+		}
+
+		familyColumnName := pgSchemaColumn.ColumnName + PG_NETWORK_FAMILY_COLUMN_SUFFIX
+		masklenColumnName := pgSchemaColumn.ColumnName + PG_NETWORK_MASKLEN_COLUMN_SUFFIX
+		if columnNames.Contains(familyColumnName) || columnNames.Contains(masklenColumnName) {
+			LogComponentWarn(syncer.config, LOG_COMPONENT_SYNCER, "Not adding network details of "+pgSchemaTable.String()+"."+QuoteIdentifier(pgSchemaColumn.ColumnName)+": column "+familyColumnName+" or "+masklenColumnName+" already exists")
+			continue
+		}
+
+		for _, columnName := range []string{familyColumnName, masklenColumnName} {
+			maxOrdinalPosition++
+			detailColumns = append(detailColumns, PgSchemaColumn{
+				ColumnName:       columnName,
+				DataType:         "integer",
+				UdtName:          "int4",
+				IsNullable:       PG_TRUE,
+				OrdinalPosition:  IntToString(maxOrdinalPosition),
+				NumericPrecision: "32",
+				Namespace:        PG_SCHEMA_PG_CATALOG,
+			})
+		}
+		sourceIndexes = append(sourceIndexes, i)
+	}
+
+	return append(pgSchemaColumns, detailColumns...), sourceIndexes
+}
+
+// Appends the address family and the prefix length of the values at the source indexes to each row, NULL for NULL values
+func appendPgNetworkDetails(rows [][]string, sourceIndexes []int) [][]string {
+	if len(sourceIndexes) == 0 {
+		return rows
+	}
+
+	for i, row := range rows {
+		for _, sourceIndex := range sourceIndexes {
+			if row[sourceIndex] == PG_NULL_STRING {
+				row = append(row, PG_NULL_STRING, PG_NULL_STRING)
+				continue
+			}
+
+			address, masklen, err := ParsePgNetworkAddress(row[sourceIndex])
+			PanicIfError(err)
+			row = append(row, IntToString(pgNetworkFamily(address)), IntToString(masklen))
+		}
+		rows[i] = row
+	}
+	return rows
+}
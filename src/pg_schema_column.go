@@ -1,42 +1,165 @@
 package main
 
 import (
-	"encoding/csv"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"math"
+	"math/big"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/xitongsys/parquet-go/common"
 )
 
+// Represents NULL values in rows. Postgres text values can't contain NUL bytes, and the random suffix generated on every run
+// keeps values that are decoded from escapes, e.g., in COPY FROM STDIN data, from matching it
+var PG_NULL_STRING = fmt.Sprintf("\x00BEMIDB_NULL_%08x%08x", randomUint32(), randomUint32())
+
 const (
-	PG_NULL_STRING = "BEMIDB_NULL"
-	PG_TRUE        = "YES"
-	PG_FALSE       = "FALSE"
+	PG_TRUE  = "YES"
+	PG_FALSE = "FALSE"
 
 	PG_DATA_TYPE_ARRAY = "ARRAY"
 
+	PG_GENERATED_ALWAYS = "ALWAYS"
+
+	PG_GEOMETRY_FORMAT_WKT     = "WKT"
+	PG_GEOMETRY_FORMAT_GEOJSON = "GEOJSON"
+	PG_GEOMETRY_FORMAT_WKB     = "WKB"
+
+	PG_GEOGRAPHY_DEFAULT_SRID = 4326
+
+	PG_TSVECTOR_FORMAT_TEXT    = "TEXT"
+	PG_TSVECTOR_FORMAT_STRIP   = "STRIP"
+	PG_TSVECTOR_FORMAT_LEXEMES = "LEXEMES"
+	PG_TSVECTOR_FORMAT_SKIP    = "SKIP"
+
+	PG_INTERVAL_FORMAT_TEXT         = "TEXT"
+	PG_INTERVAL_FORMAT_ISO8601      = "ISO8601"
+	PG_INTERVAL_FORMAT_MICROSECONDS = "MICROSECONDS"
+
+	PG_BIT_FORMAT_TEXT   = "TEXT"
+	PG_BIT_FORMAT_BINARY = "BINARY"
+
+	// Size of the bit length prefix of bit and bit varying values in the PostgreSQL binary format
+	PG_BIT_LENGTH_SIZE = 4
+
+	PG_UNCONSTRAINED_NUMERIC_FORMAT_DECIMAL = "DECIMAL"
+	PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE  = "DOUBLE"
+	PG_UNCONSTRAINED_NUMERIC_FORMAT_STRING  = "STRING"
+
+	PG_INFINITE_TIMESTAMP_FORMAT_CLAMP = "CLAMP"
+	PG_INFINITE_TIMESTAMP_FORMAT_NULL  = "NULL"
+
+	PG_INFINITY          = "infinity"
+	PG_NEGATIVE_INFINITY = "-infinity"
+	PG_BC_SUFFIX         = " BC"
+
+	PG_COLUMN_NAME_CASE_PRESERVE = "preserve"
+	PG_COLUMN_NAME_CASE_LOWER    = "lower"
+	PG_COLUMN_NAME_CASE_SNAKE    = "snake"
+
+	// Range of money values, which are exported as numeric with 2 fractional digits regardless of lc_monetary
+	PG_MONEY_NUMERIC_PRECISION = "19"
+	PG_MONEY_NUMERIC_SCALE     = "2"
+
+	// Size of the varlena header that numeric type modifiers are offset by, e.g. (10 << 16 | 2) + 4 for numeric(10,2)
+	PG_VARHDRSZ = 4
+
 	PARQUET_SCHEMA_REPETITION_TYPE_REQUIRED = "REQUIRED"
 	PARQUET_SCHEMA_REPETITION_TYPE_OPTIONAL = "OPTIONAL"
 
 	PARQUET_NAN                   = "NaN"
+	PARQUET_POSITIVE_INFINITY     = "Infinity"
+	PARQUET_NEGATIVE_INFINITY     = "-Infinity"
 	PARQUET_MAX_DECIMAL_PRECISION = 38
-	PARQUET_UUID_LENGTH           = 36
+	PARQUET_UUID_LENGTH           = 16
+
+	// Range of timestamps (290309-12-22 BC 00:00:00 - 294247-01-10 04:00:54.775806) and dates that DuckDB can read,
+	// the values right outside of it are reserved for infinity
+	PARQUET_MIN_TIMESTAMP_MICROS = -9223372022400000000
+	PARQUET_MAX_TIMESTAMP_MICROS = math.MaxInt64 - 1
+	PARQUET_MIN_DATE_DAYS        = math.MinInt32 + 2
+	PARQUET_MAX_DATE_DAYS        = math.MaxInt32 - 1
 
 	// 0000-01-01 00:00:00 +0000 UTC
 	EPOCH_TIME_MS = -62167219200000
 )
 
+var PG_GEOMETRY_FORMATS = []string{PG_GEOMETRY_FORMAT_WKT, PG_GEOMETRY_FORMAT_GEOJSON, PG_GEOMETRY_FORMAT_WKB}
+var PG_TSVECTOR_FORMATS = []string{PG_TSVECTOR_FORMAT_TEXT, PG_TSVECTOR_FORMAT_STRIP, PG_TSVECTOR_FORMAT_LEXEMES, PG_TSVECTOR_FORMAT_SKIP}
+var PG_INTERVAL_FORMATS = []string{PG_INTERVAL_FORMAT_TEXT, PG_INTERVAL_FORMAT_ISO8601, PG_INTERVAL_FORMAT_MICROSECONDS}
+var PG_BIT_FORMATS = []string{PG_BIT_FORMAT_TEXT, PG_BIT_FORMAT_BINARY}
+
+// Object identifier alias types, exported by COPY as object names, e.g. "public.users" for regclass,
+// or as raw numbers for objects that no longer exist
+var PG_OID_ALIAS_TYPES = []string{
+	"regclass", "regcollation", "regconfig", "regdictionary", "regnamespace",
+	"regoper", "regoperator", "regproc", "regprocedure", "regrole", "regtype",
+}
+
+// Iceberg types that columns of other PostgreSQL types can be synced as with --pg-type-overrides,
+// and the PostgreSQL types their values are cast to on export
+var PG_TYPE_OVERRIDE_PG_TYPES = map[string]string{
+	"string":      "text",
+	"json":        "jsonb",
+	"int":         "int4",
+	"long":        "int8",
+	"double":      "float8",
+	"boolean":     "bool",
+	"date":        "date",
+	"timestamp":   "timestamp",
+	"timestamptz": "timestamptz",
+	"uuid":        "uuid",
+}
+var PG_TYPE_OVERRIDE_ICEBERG_TYPES = []string{"string", "json", "int", "long", "double", "boolean", "date", "timestamp", "timestamptz", "uuid"}
+
+// Types of extensions synced as Iceberg types unless overridden with --pg-type-overrides.
+// citext columns are kept as is to be compared case-insensitively, other extension types are synced as their text output
+var PG_EXTENSION_TYPE_OVERRIDES = map[string]string{
+	"hstore": "json",
+	"ltree":  "string",
+}
+
+var PG_UNCONSTRAINED_NUMERIC_FORMATS = []string{PG_UNCONSTRAINED_NUMERIC_FORMAT_DECIMAL, PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE, PG_UNCONSTRAINED_NUMERIC_FORMAT_STRING}
+var PG_INFINITE_TIMESTAMP_FORMATS = []string{PG_INFINITE_TIMESTAMP_FORMAT_CLAMP, PG_INFINITE_TIMESTAMP_FORMAT_NULL}
+var PG_COLUMN_NAME_CASES = []string{PG_COLUMN_NAME_CASE_PRESERVE, PG_COLUMN_NAME_CASE_LOWER, PG_COLUMN_NAME_CASE_SNAKE}
+
 type PgSchemaColumn struct {
-	ColumnName             string
-	DataType               string
-	UdtName                string
-	IsNullable             string
-	OrdinalPosition        string
-	CharacterMaximumLength string
-	NumericPrecision       string
-	NumericScale           string
-	DatetimePrecision      string
-	Namespace              string
+	ColumnName              string
+	DataType                string
+	UdtName                 string
+	IsNullable              string
+	OrdinalPosition         string
+	CharacterMaximumLength  string
+	NumericPrecision        string
+	NumericScale            string
+	DatetimePrecision       string
+	Namespace               string
+	IsGenerated             string
+	IdentityGeneration      string
+	EnumLabels              []string       // for user-defined enum types (and arrays of them), in sort order
+	IsComposite             bool           // for user-defined composite types (and arrays of them), exported as JSON
+	GeometryFormat          string         // for PostGIS geometry and geography types, how values are exported
+	Srid                    string         // for PostGIS geometry and geography types
+	TsvectorFormat          string         // for tsvector type, how values are exported
+	IntervalFormat          string         // for interval type (not arrays of it), how values are exported
+	BitFormat               string         // for bit and bit varying types (and arrays of them), how values are synced
+	NumericFormat           string         // for numeric type without precision (and arrays of it), how values are synced
+	InfiniteTimestampFormat string         // for date and timestamp types (and arrays of them), how infinite values are synced
+	IsLargeObject           bool           // for oid columns referencing large objects, synced as bytea with the object content
+	DomainName              string         // for domain types, "schema.domain" of the column type, other fields describe its base type
+	KeepsCharPadding        bool           // for bpchar type (and arrays of it), keeps the trailing spaces of values
+	XmlXpath                string         // for xml type (not arrays of it), XPath of the node that values are synced as
+	PrimaryKeyPosition      int            // for primary key columns, 1-based position of the column in the key, 0 otherwise
+	UniqueKeyPositions      map[string]int // for columns of unique constraints and unique indexes, index name -> 1-based position of the column in the key
+	TypeOverride            string         // for types synced as another type with --pg-type-overrides (or extension types), the original type name
+	PartitionTransform      string         // for the column that the table is partitioned by with --iceberg-partition-by, the Iceberg transform, e.g. "day" or "bucket[16]"
 }
 
 type ParquetSchemaField struct {
@@ -50,6 +173,11 @@ type ParquetSchemaField struct {
 	Precision           string
 	NestedType          string
 	NestedConvertedType string
+	NestedLength        string
+	NestedScale         string
+	NestedPrecision     string
+	IsAdjustedToUtc     string // for timestamps, "true" if values are instants (timestamptz), applies to list elements too
+	LogicalType         string // for logical types without a converted type (UUID), applies to list elements too
 }
 
 type IcebergSchemaField struct {
@@ -57,23 +185,31 @@ type IcebergSchemaField struct {
 	Name     string      `json:"name"`
 	Type     interface{} `json:"type"`
 	Required bool        `json:"required"`
+	Doc      string      `json:"doc,omitempty"`
 }
 
 func (pgSchemaColumn PgSchemaColumn) ToParquetSchemaFieldMap() map[string]interface{} {
 	field := pgSchemaColumn.toParquetSchemaField()
 
-	tagKeyVals := []string{
-		"name=" + field.Name,
-		"type=" + field.Type,
-		"repetitiontype=" + field.RepetitionType,
-		"fieldid=" + field.FieldId,
+	tagKeyVals := []string{"name=" + field.tagName()}
+	if field.tagName() != field.Name {
+		tagKeyVals = append(tagKeyVals, "inname="+common.StringToVariableName(field.Name))
 	}
+	tagKeyVals = append(tagKeyVals,
+		"type="+field.Type,
+		"repetitiontype="+field.RepetitionType,
+		"fieldid="+field.FieldId,
+	)
 
 	if field.Length != "" {
 		tagKeyVals = append(tagKeyVals, "length="+field.Length)
 	}
+	if field.LogicalType != "" && field.NestedType == "" {
+		tagKeyVals = append(tagKeyVals, "logicaltype="+field.LogicalType)
+	}
 	if field.ConvertedType != "" {
 		tagKeyVals = append(tagKeyVals, "convertedtype="+field.ConvertedType)
+		tagKeyVals = append(tagKeyVals, timestampLogicalTypeTagKeyVals(field.ConvertedType, field.IsAdjustedToUtc)...)
 	}
 	if field.Scale != "" {
 		tagKeyVals = append(tagKeyVals, "scale="+field.Scale)
@@ -87,13 +223,28 @@ func (pgSchemaColumn PgSchemaColumn) ToParquetSchemaFieldMap() map[string]interf
 	}
 
 	if field.NestedType != "" {
+		// Elements are optional to keep NULL elements of arrays
 		nestedTagKeyVals := []string{
 			"name=element",
 			"type=" + field.NestedType,
+			"repetitiontype=" + PARQUET_SCHEMA_REPETITION_TYPE_OPTIONAL,
 		}
 
+		if field.NestedLength != "" {
+			nestedTagKeyVals = append(nestedTagKeyVals, "length="+field.NestedLength)
+		}
+		if field.LogicalType != "" {
+			nestedTagKeyVals = append(nestedTagKeyVals, "logicaltype="+field.LogicalType)
+		}
 		if field.NestedConvertedType != "" {
 			nestedTagKeyVals = append(nestedTagKeyVals, "convertedtype="+field.NestedConvertedType)
+			nestedTagKeyVals = append(nestedTagKeyVals, timestampLogicalTypeTagKeyVals(field.NestedConvertedType, field.IsAdjustedToUtc)...)
+		}
+		if field.NestedScale != "" {
+			nestedTagKeyVals = append(nestedTagKeyVals, "scale="+field.NestedScale)
+		}
+		if field.NestedPrecision != "" {
+			nestedTagKeyVals = append(nestedTagKeyVals, "precision="+field.NestedPrecision)
 		}
 
 		result["Fields"] = []map[string]interface{}{
@@ -104,6 +255,30 @@ func (pgSchemaColumn PgSchemaColumn) ToParquetSchemaFieldMap() map[string]interf
 	return result
 }
 
+// parquet-go splits schema tags on commas and trims tabs and surrounding whitespace, so such names are tagged with a placeholder.
+// The internal name still matches the JSON keys of rows, and WriteParquetFile renames the placeholder to the column name
+func (field ParquetSchemaField) tagName() string {
+	if !strings.ContainsAny(field.Name, ",\t") && strings.TrimSpace(field.Name) == field.Name {
+		return field.Name
+	}
+	return "bemidb_field_" + field.FieldId
+}
+
+// Timestamp converted types are always adjusted to UTC, so the logical type tells readers which timestamps have no time zone
+func timestampLogicalTypeTagKeyVals(convertedType string, isAdjustedToUtc string) []string {
+	if isAdjustedToUtc == "" {
+		return nil
+	}
+
+	switch convertedType {
+	case "TIMESTAMP_MICROS":
+		return []string{"logicaltype=TIMESTAMP", "logicaltype.isadjustedtoutc=" + isAdjustedToUtc, "logicaltype.unit=MICROS"}
+	case "TIMESTAMP_MILLIS":
+		return []string{"logicaltype=TIMESTAMP", "logicaltype.isadjustedtoutc=" + isAdjustedToUtc, "logicaltype.unit=MILLIS"}
+	}
+	return nil
+}
+
 func (pgSchemaColumn PgSchemaColumn) ToIcebergSchemaFieldMap() IcebergSchemaField {
 	icebergSchemaField := IcebergSchemaField{}
 
@@ -122,7 +297,7 @@ func (pgSchemaColumn PgSchemaColumn) ToIcebergSchemaFieldMap() IcebergSchemaFiel
 	}
 
 	primitiveType := pgSchemaColumn.icebergPrimitiveType()
-	if pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY {
+	if pgSchemaColumn.isList() {
 		icebergSchemaField.Type = map[string]interface{}{
 			"type":             "list",
 			"element":          primitiveType,
@@ -133,6 +308,41 @@ func (pgSchemaColumn PgSchemaColumn) ToIcebergSchemaFieldMap() IcebergSchemaFiel
 		icebergSchemaField.Type = primitiveType
 	}
 
+	if pgSchemaColumn.IsGeometry() {
+		icebergSchemaField.Doc = "postgis:" + strings.TrimLeft(pgSchemaColumn.UdtName, "_") + ";srid=" + pgSchemaColumn.Srid + ";format=" + pgSchemaColumn.GeometryFormat
+	} else if pgSchemaColumn.TsvectorFormat != "" {
+		icebergSchemaField.Doc = "tsvector;format=" + pgSchemaColumn.TsvectorFormat
+	} else if pgSchemaColumn.IntervalFormat != "" {
+		icebergSchemaField.Doc = ICEBERG_FIELD_DOC_INTERVAL_PREFIX + pgSchemaColumn.IntervalFormat
+	} else if pgSchemaColumn.NumericFormat != "" {
+		icebergSchemaField.Doc = "numeric;format=" + pgSchemaColumn.NumericFormat
+	} else if udtName := strings.TrimLeft(pgSchemaColumn.UdtName, "_"); (udtName == "bpchar" || udtName == "varchar") && pgSchemaColumn.CharacterMaximumLength != "" && pgSchemaColumn.CharacterMaximumLength != "0" {
+		icebergSchemaField.Doc = udtName + ";" + ICEBERG_FIELD_DOC_LENGTH_PREFIX + pgSchemaColumn.CharacterMaximumLength
+	} else if pgSchemaColumn.isBit() {
+		icebergSchemaField.Doc = pgSchemaColumn.bitFieldDoc()
+	} else if udtName := strings.TrimLeft(pgSchemaColumn.UdtName, "_"); udtName == "oid" || pgSchemaColumn.isOidAlias() {
+		icebergSchemaField.Doc = udtName
+	} else if udtName := strings.TrimLeft(pgSchemaColumn.UdtName, "_"); isPgNetworkAddressType(udtName) || isPgMacAddressType(udtName) {
+		icebergSchemaField.Doc = udtName
+	} else if strings.TrimLeft(pgSchemaColumn.UdtName, "_") == "citext" {
+		icebergSchemaField.Doc = ICEBERG_FIELD_DOC_CITEXT
+	} else if udtName := strings.TrimLeft(pgSchemaColumn.UdtName, "_"); udtName == "json" || udtName == "jsonb" {
+		icebergSchemaField.Doc = ICEBERG_FIELD_DOC_JSON
+	} else if strings.TrimLeft(pgSchemaColumn.UdtName, "_") == "uuid" {
+		icebergSchemaField.Doc = ICEBERG_FIELD_DOC_UUID_BINARY
+	} else if strings.TrimLeft(pgSchemaColumn.UdtName, "_") == "xml" {
+		icebergSchemaField.Doc = ICEBERG_FIELD_DOC_XML
+		if pgSchemaColumn.XmlXpath != "" {
+			icebergSchemaField.Doc += ";" + ICEBERG_FIELD_DOC_XPATH_PREFIX + pgSchemaColumn.XmlXpath
+		}
+	}
+	if pgSchemaColumn.DomainName != "" {
+		if icebergSchemaField.Doc != "" {
+			icebergSchemaField.Doc += ";"
+		}
+		icebergSchemaField.Doc += "domain=" + pgSchemaColumn.DomainName
+	}
+
 	return icebergSchemaField
 }
 
@@ -141,20 +351,20 @@ func (pgSchemaColumn *PgSchemaColumn) FormatParquetValue(value string) interface
 		return nil
 	}
 
-	if pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY {
-		var values []interface{}
-
-		csvString := strings.Trim(value, "{}")
-		if csvString == "" {
-			return values
+	if pgSchemaColumn.isList() {
+		elements, err := parsePgArrayElements(value, pgArrayDelimiter(pgSchemaColumn.UdtName))
+		if err != nil {
+			panic(fmt.Errorf("value of column %s can't be synced as a list: %v", pgSchemaColumn.ColumnName, err))
 		}
 
-		csvReader := csv.NewReader(strings.NewReader(csvString))
-		stringValues, err := csvReader.Read()
-		PanicIfError(err)
-
-		for _, stringValue := range stringValues {
-			values = append(values, pgSchemaColumn.parquetPrimitiveValue(stringValue))
+		// Empty arrays are kept as empty lists, not NULL
+		values := make([]interface{}, 0, len(elements))
+		for _, element := range elements {
+			if element == nil {
+				values = append(values, nil)
+			} else {
+				values = append(values, pgSchemaColumn.parquetPrimitiveValue(*element))
+			}
 		}
 
 		return values
@@ -173,6 +383,13 @@ func (pgSchemaColumn *PgSchemaColumn) toParquetSchemaField() ParquetSchemaField
 		ConvertedType: primitiveConvertedType,
 	}
 
+	switch strings.TrimLeft(pgSchemaColumn.UdtName, "_") {
+	case "timestamp":
+		parquetSchemaField.IsAdjustedToUtc = "false"
+	case "timestamptz":
+		parquetSchemaField.IsAdjustedToUtc = "true"
+	}
+
 	// Set RepetitionType
 	if pgSchemaColumn.IsNullable == PG_TRUE {
 		parquetSchemaField.RepetitionType = PARQUET_SCHEMA_REPETITION_TYPE_OPTIONAL
@@ -181,46 +398,162 @@ func (pgSchemaColumn *PgSchemaColumn) toParquetSchemaField() ParquetSchemaField
 	}
 
 	// Set other field properties
-	switch pgSchemaColumn.UdtName {
-	case "numeric":
-		scale, err := StringToInt(pgSchemaColumn.NumericScale)
-		PanicIfError(err)
-		precision, err := StringToInt(pgSchemaColumn.NumericPrecision)
-		PanicIfError(err)
-		if precision > PARQUET_MAX_DECIMAL_PRECISION {
-			precision = PARQUET_MAX_DECIMAL_PRECISION
-		} else if precision == 0 {
-			precision = PARQUET_MAX_DECIMAL_PRECISION / 2
-			scale = PARQUET_MAX_DECIMAL_PRECISION / 2
-		}
-
+	switch {
+	case pgSchemaColumn.isDecimal():
+		precision, scale := pgSchemaColumn.decimalPrecisionAndScale()
 		parquetSchemaField.Scale = IntToString(scale)
 		parquetSchemaField.Precision = IntToString(precision)
 		parquetSchemaField.Length = IntToString(scale + precision)
-	case "uuid":
+	case strings.TrimLeft(pgSchemaColumn.UdtName, "_") == "uuid":
 		parquetSchemaField.Length = IntToString(PARQUET_UUID_LENGTH)
-	default:
-		if pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY {
-			parquetSchemaField.NestedType = parquetSchemaField.Type
-			parquetSchemaField.NestedConvertedType = parquetSchemaField.ConvertedType
-			parquetSchemaField.Type = "LIST"
-			parquetSchemaField.ConvertedType = ""
-		}
+		parquetSchemaField.LogicalType = "UUID"
+	}
+
+	// Move the element properties to the nested field
+	if pgSchemaColumn.isList() {
+		parquetSchemaField.NestedType = parquetSchemaField.Type
+		parquetSchemaField.NestedConvertedType = parquetSchemaField.ConvertedType
+		parquetSchemaField.NestedLength = parquetSchemaField.Length
+		parquetSchemaField.NestedScale = parquetSchemaField.Scale
+		parquetSchemaField.NestedPrecision = parquetSchemaField.Precision
+		parquetSchemaField.Type = "LIST"
+		parquetSchemaField.ConvertedType = ""
+		parquetSchemaField.Length = ""
+		parquetSchemaField.Scale = ""
+		parquetSchemaField.Precision = ""
 	}
 
 	return parquetSchemaField
 }
 
+func (pgSchemaColumn *PgSchemaColumn) IsEnum() bool {
+	return len(pgSchemaColumn.EnumLabels) > 0
+}
+
+func (pgSchemaColumn *PgSchemaColumn) IsGeometry() bool {
+	return pgSchemaColumn.GeometryFormat != ""
+}
+
+func (pgSchemaColumn *PgSchemaColumn) isBit() bool {
+	udtName := strings.TrimLeft(pgSchemaColumn.UdtName, "_")
+	return udtName == "bit" || udtName == "varbit"
+}
+
+func (pgSchemaColumn *PgSchemaColumn) isOidAlias() bool {
+	return slices.Contains(PG_OID_ALIAS_TYPES, strings.TrimLeft(pgSchemaColumn.UdtName, "_"))
+}
+
+// Records the type, e.g. "bit;length=8", "varbit;format=binary", or "varbit;format=binary;length=64" for bit varying(64)
+func (pgSchemaColumn *PgSchemaColumn) bitFieldDoc() string {
+	doc := strings.TrimLeft(pgSchemaColumn.UdtName, "_")
+	if pgSchemaColumn.BitFormat == PG_BIT_FORMAT_BINARY {
+		doc += ";" + ICEBERG_FIELD_DOC_FORMAT_PREFIX + "binary"
+	}
+	if pgSchemaColumn.CharacterMaximumLength != "" && pgSchemaColumn.CharacterMaximumLength != "0" {
+		doc += ";" + ICEBERG_FIELD_DOC_LENGTH_PREFIX + pgSchemaColumn.CharacterMaximumLength
+	}
+	return doc
+}
+
+// Arrays of composite types are exported as a single JSON array value instead of a PostgreSQL array literal.
+// Tsvector values can be exported as arrays of lexemes
+func (pgSchemaColumn *PgSchemaColumn) isList() bool {
+	if pgSchemaColumn.TsvectorFormat == PG_TSVECTOR_FORMAT_LEXEMES {
+		return true
+	}
+	return pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY && !pgSchemaColumn.IsComposite
+}
+
+// Numeric columns and arrays of them are synced as decimals unless they are unconstrained and configured otherwise
+func (pgSchemaColumn *PgSchemaColumn) isDecimal() bool {
+	return strings.TrimLeft(pgSchemaColumn.UdtName, "_") == "numeric" &&
+		pgSchemaColumn.NumericFormat != PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE &&
+		pgSchemaColumn.NumericFormat != PG_UNCONSTRAINED_NUMERIC_FORMAT_STRING
+}
+
+// Precision is capped to the maximum supported by Parquet
+func (pgSchemaColumn *PgSchemaColumn) decimalPrecisionAndScale() (precision int, scale int) {
+	precision, err := StringToInt(pgSchemaColumn.NumericPrecision)
+	PanicIfError(err)
+	scale, err = StringToInt(pgSchemaColumn.NumericScale)
+	PanicIfError(err)
+	if precision > PARQUET_MAX_DECIMAL_PRECISION || precision == 0 {
+		precision = PARQUET_MAX_DECIMAL_PRECISION
+	}
+	return precision, scale
+}
+
+// Returns a plain decimal string with exactly "scale" fractional digits, e.g. "1.5E+3" -> "1500.00" for decimal(10, 2).
+// Fails on values that don't fit into the decimal instead of letting them overflow
+func (pgSchemaColumn *PgSchemaColumn) parquetDecimalValue(value string) string {
+	precision, scale := pgSchemaColumn.decimalPrecisionAndScale()
+	unscaledValue, err := unscaledDecimalValue(value, precision, scale)
+	if err != nil {
+		panic(fmt.Errorf("value of column %s can't be synced as decimal(%d, %d): %v", pgSchemaColumn.ColumnName, precision, scale, err))
+	}
+
+	digits := new(big.Int).Abs(unscaledValue).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	decimalValue := digits
+	if scale > 0 {
+		decimalValue = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if unscaledValue.Sign() < 0 {
+		decimalValue = "-" + decimalValue
+	}
+	return decimalValue
+}
+
 func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveValue(value string) interface{} {
+	if pgSchemaColumn.IsEnum() || pgSchemaColumn.IsComposite {
+		return value
+	}
+	if pgSchemaColumn.IntervalFormat == PG_INTERVAL_FORMAT_MICROSECONDS || pgSchemaColumn.IntervalFormat == PG_INTERVAL_FORMAT_ISO8601 {
+		return pgSchemaColumn.parquetIntervalValue(value)
+	}
+	if pgSchemaColumn.NumericFormat == PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE {
+		return parquetDoubleValue(value)
+	}
+	if pgSchemaColumn.isDecimal() {
+		return pgSchemaColumn.parquetDecimalValue(value)
+	}
+	if pgSchemaColumn.isBit() && pgSchemaColumn.BitFormat == PG_BIT_FORMAT_BINARY {
+		return pgSchemaColumn.parquetBitBinaryValue(value)
+	}
+
+	if pgSchemaColumn.isOidAlias() {
+		return value
+	}
+
 	switch strings.TrimLeft(pgSchemaColumn.UdtName, "_") {
-	case "varchar", "char", "text", "bit", "bytea", "jsonb", "json", "numeric", "uuid", "interval",
+	case "varchar", "char", "text", "bit", "varbit", "numeric", "interval",
 		"point", "line", "lseg", "box", "path", "polygon", "circle",
 		"cidr", "inet", "macaddr", "macaddr8",
-		"tsvector", "xml", "pg_snapshot":
+		"tsvector", "tsquery", "xml", "pg_snapshot":
+		return value
+	case "json", "jsonb":
+		// Values are kept as exported, with the json whitespace and the jsonb key order
+		if !json.Valid([]byte(value)) {
+			panic("Invalid PostgreSQL " + pgSchemaColumn.UdtName + " value in column " + pgSchemaColumn.ColumnName)
+		}
 		return value
 	case "bpchar":
+		if pgSchemaColumn.KeepsCharPadding {
+			return value
+		}
 		trimmedValue := strings.TrimRight(value, " ")
 		return trimmedValue
+	case "bytea":
+		return decodePgBytea(value)
+	case "uuid":
+		// Stored as 16 bytes, any textual form accepted by PostgreSQL is exported in the canonical lowercase one
+		uuidValue, err := uuid.Parse(value)
+		if err != nil {
+			panic("Invalid PostgreSQL uuid value in column " + pgSchemaColumn.ColumnName)
+		}
+		return uuidValue[:]
 	case "int2", "int4":
 		intValue, err := StringToInt(value)
 		PanicIfError(err)
@@ -229,6 +562,11 @@ func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveValue(value string) interf
 		intValue, err := strconv.ParseInt(value, 10, 64)
 		PanicIfError(err)
 		return intValue
+	case "oid":
+		// Unsigned 32-bit, stored as signed 64-bit to keep values above 2^31 positive
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		PanicIfError(err)
+		return intValue
 	case "xid":
 		intValue, err := strconv.ParseUint(value, 10, 32)
 		PanicIfError(err)
@@ -240,49 +578,20 @@ func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveValue(value string) interf
 	case "float4":
 		floatValue, err := strconv.ParseFloat(value, 32)
 		PanicIfError(err)
-		if math.IsNaN(floatValue) {
-			return PARQUET_NAN
+		if nonFiniteValue, ok := parquetNonFiniteFloatValue(floatValue); ok {
+			return nonFiniteValue
 		}
 		return float32(floatValue)
 	case "float8":
-		floatValue, err := strconv.ParseFloat(value, 64)
-		PanicIfError(err)
-		if math.IsNaN(floatValue) {
-			return PARQUET_NAN
-		}
-		return floatValue
+		return parquetDoubleValue(value)
 	case "bool":
 		boolValue, err := strconv.ParseBool(value)
 		PanicIfError(err)
 		return boolValue
-	case "timestamp":
-		if pgSchemaColumn.DatetimePrecision == "6" {
-			parsedTime, err := time.Parse("2006-01-02 15:04:05.999999", value)
-			PanicIfError(err)
-			return parsedTime.UnixMicro()
-		} else {
-			parsedTime, err := time.Parse("2006-01-02 15:04:05.999", value)
-			PanicIfError(err)
-			return parsedTime.UnixMilli()
-		}
-	case "timestamptz":
-		if pgSchemaColumn.DatetimePrecision == "6" {
-			parsedTime, err := time.Parse("2006-01-02 15:04:05.999999-07:00", value)
-			if err != nil {
-				parsedTime, err = time.Parse("2006-01-02 15:04:05.999999-07", value)
-				PanicIfError(err)
-			}
-			return parsedTime.UnixMicro()
-		} else {
-			parsedTime, err := time.Parse("2006-01-02 15:04:05.999-07:00", value)
-			if err != nil {
-				parsedTime, err = time.Parse("2006-01-02 15:04:05.999-07", value)
-				PanicIfError(err)
-			}
-			return parsedTime.UnixMilli()
-		}
+	case "timestamp", "timestamptz":
+		return pgSchemaColumn.parquetTimestampValue(value)
 	case "time":
-		if pgSchemaColumn.DatetimePrecision == "6" {
+		if pgSchemaColumn.hasMicrosecondPrecision() {
 			parsedTime, err := time.Parse("15:04:05.999999", value)
 			PanicIfError(err)
 			return int64(-EPOCH_TIME_MS*1000 + parsedTime.UnixMicro())
@@ -292,7 +601,7 @@ func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveValue(value string) interf
 			return -EPOCH_TIME_MS + parsedTime.UnixMilli()
 		}
 	case "timetz":
-		if pgSchemaColumn.DatetimePrecision == "6" {
+		if pgSchemaColumn.hasMicrosecondPrecision() {
 			parsedTime, err := time.Parse("15:04:05.999999-07", value)
 			PanicIfError(err)
 			return int64(-EPOCH_TIME_MS*1000 + parsedTime.UnixMicro())
@@ -302,9 +611,7 @@ func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveValue(value string) interf
 			return -EPOCH_TIME_MS + parsedTime.UnixMilli()
 		}
 	case "date":
-		parsedTime, err := time.Parse("2006-01-02", value)
-		PanicIfError(err)
-		return parsedTime.Unix() / 86400
+		return pgSchemaColumn.parquetDateValue(value)
 	default:
 		// User-defined types
 		if pgSchemaColumn.Namespace != PG_SCHEMA_PG_CATALOG {
@@ -315,18 +622,56 @@ func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveValue(value string) interf
 	panic("Unsupported PostgreSQL value: " + value)
 }
 
+// Values are usually converted on export, but can also be in an IntervalStyle output format, e.g. when loaded with COPY
+func (pgSchemaColumn *PgSchemaColumn) parquetIntervalValue(value string) interface{} {
+	if pgSchemaColumn.IntervalFormat == PG_INTERVAL_FORMAT_MICROSECONDS {
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			return intValue
+		}
+	}
+
+	interval, err := ParsePgInterval(value)
+	PanicIfError(err)
+	if pgSchemaColumn.IntervalFormat == PG_INTERVAL_FORMAT_MICROSECONDS {
+		return interval.TotalMicroseconds()
+	}
+	return interval.Iso8601String()
+}
+
 func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveTypes() (primitiveType string, primitiveConvertedType string) {
+	if pgSchemaColumn.IsEnum() || pgSchemaColumn.IsComposite || pgSchemaColumn.IsGeometry() {
+		return "BYTE_ARRAY", "UTF8"
+	}
+	if pgSchemaColumn.IntervalFormat == PG_INTERVAL_FORMAT_MICROSECONDS {
+		return "INT64", ""
+	}
+	switch pgSchemaColumn.NumericFormat {
+	case PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE:
+		return "DOUBLE", ""
+	case PG_UNCONSTRAINED_NUMERIC_FORMAT_STRING:
+		return "BYTE_ARRAY", "UTF8"
+	}
+	if pgSchemaColumn.isBit() && pgSchemaColumn.BitFormat == PG_BIT_FORMAT_BINARY {
+		return "BYTE_ARRAY", ""
+	}
+	if pgSchemaColumn.isOidAlias() {
+		return "BYTE_ARRAY", "UTF8"
+	}
+
 	switch strings.TrimLeft(pgSchemaColumn.UdtName, "_") {
-	case "varchar", "char", "text", "bpchar", "bit", "bytea", "interval", "jsonb", "json",
+	case "varchar", "char", "text", "bpchar", "bit", "varbit", "interval", "jsonb", "json",
 		"point", "line", "lseg", "box", "path", "polygon", "circle",
 		"cidr", "inet", "macaddr", "macaddr8",
-		"tsvector", "xml", "pg_snapshot":
+		"tsvector", "tsquery", "xml", "pg_snapshot":
 		return "BYTE_ARRAY", "UTF8"
+	case "bytea":
+		return "BYTE_ARRAY", ""
 	case "date":
 		return "INT32", "DATE"
 	case "int2", "int4":
 		return "INT32", ""
-	case "int8":
+	case "int8", "oid":
 		return "INT64", ""
 	case "float4":
 		return "FLOAT", ""
@@ -343,13 +688,13 @@ func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveTypes() (primitiveType str
 	case "bool":
 		return "BOOLEAN", ""
 	case "time", "timetz":
-		if pgSchemaColumn.DatetimePrecision == "6" {
+		if pgSchemaColumn.hasMicrosecondPrecision() {
 			return "INT64", "TIME_MICROS"
 		} else {
 			return "INT32", "TIME_MILLIS"
 		}
 	case "timestamp", "timestamptz":
-		if pgSchemaColumn.DatetimePrecision == "6" {
+		if pgSchemaColumn.hasMicrosecondPrecision() {
 			return "INT64", "TIMESTAMP_MICROS"
 		} else {
 			return "INT64", "TIMESTAMP_MILLIS"
@@ -361,47 +706,64 @@ func (pgSchemaColumn *PgSchemaColumn) parquetPrimitiveTypes() (primitiveType str
 		}
 	}
 
-	panic("Unsupported PostgreSQL type: " + pgSchemaColumn.UdtName)
+	panic(pgSchemaColumn.unsupportedTypeMessage())
 }
 
 func (pgSchemaColumn *PgSchemaColumn) icebergPrimitiveType() string {
+	if pgSchemaColumn.IsEnum() || pgSchemaColumn.IsComposite || pgSchemaColumn.IsGeometry() {
+		return "string"
+	}
+	if pgSchemaColumn.IntervalFormat == PG_INTERVAL_FORMAT_MICROSECONDS {
+		return "long"
+	}
+	switch pgSchemaColumn.NumericFormat {
+	case PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE:
+		return "double"
+	case PG_UNCONSTRAINED_NUMERIC_FORMAT_STRING:
+		return "string"
+	}
+	if pgSchemaColumn.isBit() && pgSchemaColumn.BitFormat == PG_BIT_FORMAT_BINARY {
+		return "binary"
+	}
+	if pgSchemaColumn.isOidAlias() {
+		return "string"
+	}
+
 	switch strings.TrimLeft(pgSchemaColumn.UdtName, "_") {
-	case "varchar", "char", "text", "interval", "jsonb", "json", "bpchar", "bit",
+	case "varchar", "char", "text", "interval", "jsonb", "json", "bpchar", "bit", "varbit",
 		"point", "line", "lseg", "box", "path", "polygon", "circle",
 		"cidr", "inet", "macaddr", "macaddr8",
-		"tsvector", "xml", "pg_snapshot":
+		"tsvector", "tsquery", "xml", "pg_snapshot":
 		return "string"
 	case "uuid":
 		return "uuid"
 	case "int2", "int4", "xid":
 		return "int"
-	case "int8", "xid8":
+	case "int8", "oid", "xid8":
 		return "long"
 	case "float4", "float8":
 		return "float"
 	case "numeric":
-		if pgSchemaColumn.NumericScale == "0" {
-			return "decimal"
-		}
-
-		precision, err := StringToInt(pgSchemaColumn.NumericPrecision)
-		PanicIfError(err)
-		if precision > PARQUET_MAX_DECIMAL_PRECISION {
-			precision = PARQUET_MAX_DECIMAL_PRECISION
-		}
-		return "decimal(" + IntToString(precision) + ", " + pgSchemaColumn.NumericScale + ")"
+		precision, scale := pgSchemaColumn.decimalPrecisionAndScale()
+		return "decimal(" + IntToString(precision) + ", " + IntToString(scale) + ")"
 	case "bool":
 		return "boolean"
 	case "date":
 		return "date"
 	case "bytea":
 		return "binary"
-	case "timestamp", "timestamptz":
+	case "timestamp":
 		if pgSchemaColumn.DatetimePrecision == "9" {
 			return "timestamp_ns"
 		} else {
 			return "timestamp"
 		}
+	case "timestamptz":
+		if pgSchemaColumn.DatetimePrecision == "9" {
+			return "timestamptz_ns"
+		} else {
+			return "timestamptz"
+		}
 	case "time", "timetz":
 		return "time"
 	default:
@@ -411,5 +773,298 @@ func (pgSchemaColumn *PgSchemaColumn) icebergPrimitiveType() string {
 		}
 	}
 
-	panic("Unsupported PostgreSQL type: " + pgSchemaColumn.UdtName)
+	panic(pgSchemaColumn.unsupportedTypeMessage())
+}
+
+func (pgSchemaColumn *PgSchemaColumn) unsupportedTypeMessage() string {
+	udtName := strings.TrimLeft(pgSchemaColumn.UdtName, "_")
+	return "Unsupported PostgreSQL type " + udtName + " of column " + pgSchemaColumn.ColumnName +
+		". Sync it as another type with --pg-type-overrides " + udtName + "=string (or one of " + strings.Join(PG_TYPE_OVERRIDE_ICEBERG_TYPES, ", ") + ")"
+}
+
+// Fractional seconds with more than 3 digits, e.g. timestamp(4) or time(6), are synced as microseconds instead of milliseconds
+func (pgSchemaColumn *PgSchemaColumn) hasMicrosecondPrecision() bool {
+	precision, err := StringToInt(pgSchemaColumn.DatetimePrecision)
+	return err == nil && precision > 3
+}
+
+// Infinite values of nullable columns (not arrays) can be synced as NULL, other infinite values are clamped to the supported range
+func (pgSchemaColumn *PgSchemaColumn) IsInfinitySyncedAsNull(value string) bool {
+	return (value == PG_INFINITY || value == PG_NEGATIVE_INFINITY) &&
+		pgSchemaColumn.InfiniteTimestampFormat == PG_INFINITE_TIMESTAMP_FORMAT_NULL &&
+		pgSchemaColumn.IsNullable == PG_TRUE &&
+		!pgSchemaColumn.isList()
+}
+
+func (pgSchemaColumn *PgSchemaColumn) parquetTimestampValue(value string) interface{} {
+	var timestampMicros int64
+	switch {
+	case pgSchemaColumn.IsInfinitySyncedAsNull(value):
+		return nil
+	case value == PG_INFINITY:
+		timestampMicros = PARQUET_MAX_TIMESTAMP_MICROS
+	case value == PG_NEGATIVE_INFINITY:
+		timestampMicros = PARQUET_MIN_TIMESTAMP_MICROS
+	default:
+		parsedTime, err := parsePgTimestamp(value)
+		if err == nil && (parsedTime.Before(time.UnixMicro(PARQUET_MIN_TIMESTAMP_MICROS)) || parsedTime.After(time.UnixMicro(PARQUET_MAX_TIMESTAMP_MICROS))) {
+			err = fmt.Errorf("%s is out of the supported range", value)
+		}
+		if err != nil {
+			panic(fmt.Errorf("value of column %s can't be synced as a timestamp: %v", pgSchemaColumn.ColumnName, err))
+		}
+		timestampMicros = parsedTime.UnixMicro()
+	}
+
+	if pgSchemaColumn.hasMicrosecondPrecision() {
+		return timestampMicros
+	}
+	return timestampMicros / 1000
+}
+
+func (pgSchemaColumn *PgSchemaColumn) parquetDateValue(value string) interface{} {
+	switch {
+	case pgSchemaColumn.IsInfinitySyncedAsNull(value):
+		return nil
+	case value == PG_INFINITY:
+		return int32(PARQUET_MAX_DATE_DAYS)
+	case value == PG_NEGATIVE_INFINITY:
+		return int32(PARQUET_MIN_DATE_DAYS)
+	}
+
+	parsedTime, err := parsePgTimestamp(value)
+	if err != nil {
+		panic(fmt.Errorf("value of column %s can't be synced as a date: %v", pgSchemaColumn.ColumnName, err))
+	}
+	days := parsedTime.Unix() / 86400
+	if parsedTime.Unix()%86400 < 0 {
+		days--
+	}
+	return int32(days)
+}
+
+// Encodes a string of "0" and "1" like the PostgreSQL binary format: the bit length as a 4-byte big-endian integer
+// followed by the bits packed into bytes from the most significant bit, with the unused bits of the last byte set to 0
+func (pgSchemaColumn *PgSchemaColumn) parquetBitBinaryValue(value string) []byte {
+	binaryValue := make([]byte, PG_BIT_LENGTH_SIZE+(len(value)+7)/8)
+	binary.BigEndian.PutUint32(binaryValue, uint32(len(value)))
+	for i, bit := range []byte(value) {
+		switch bit {
+		case '1':
+			binaryValue[PG_BIT_LENGTH_SIZE+i/8] |= 0x80 >> (i % 8)
+		case '0':
+		default:
+			panic("Invalid PostgreSQL " + strings.TrimLeft(pgSchemaColumn.UdtName, "_") + " value in column " + pgSchemaColumn.ColumnName)
+		}
+	}
+	return binaryValue
+}
+
+func parquetDoubleValue(value string) interface{} {
+	floatValue, err := strconv.ParseFloat(value, 64)
+	PanicIfError(err)
+	if nonFiniteValue, ok := parquetNonFiniteFloatValue(floatValue); ok {
+		return nonFiniteValue
+	}
+	return floatValue
+}
+
+// Rows are marshaled to JSON before they are written to Parquet, and JSON can't encode NaN and infinities as numbers.
+// Passing them as strings keeps the IEEE 754 values because the Parquet writer parses float strings with fmt.Sscanf
+func parquetNonFiniteFloatValue(floatValue float64) (string, bool) {
+	switch {
+	case math.IsNaN(floatValue):
+		return PARQUET_NAN, true
+	case math.IsInf(floatValue, 1):
+		return PARQUET_POSITIVE_INFINITY, true
+	case math.IsInf(floatValue, -1):
+		return PARQUET_NEGATIVE_INFINITY, true
+	}
+	return "", false
+}
+
+// Converts a decimal value (optionally in scientific notation) to an integer with "scale" implied fractional digits.
+// Extra fractional digits are rounded half away from zero like in PostgreSQL, extra integer digits are an error
+func unscaledDecimalValue(value string, precision int, scale int) (*big.Int, error) {
+	ratValue, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a finite number", value)
+	}
+
+	numerator := new(big.Int).Mul(ratValue.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	unscaledValue, remainder := new(big.Int).QuoRem(numerator, ratValue.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(ratValue.Denom()) >= 0 {
+		unscaledValue.Add(unscaledValue, big.NewInt(int64(ratValue.Sign())))
+	}
+
+	maxUnscaledValue := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	if new(big.Int).Abs(unscaledValue).Cmp(maxUnscaledValue) >= 0 {
+		return nil, fmt.Errorf("%s is out of range, it must have at most %d integer digits", value, precision-scale)
+	}
+	return unscaledValue, nil
+}
+
+// Parses dates and timestamps in the PostgreSQL ISO output format, including years with more than 4 digits,
+// BC years ("0044-03-15 12:00:00 BC"), and time zone offsets with seconds ("1850-01-01 00:00:00-04:56:02")
+func parsePgTimestamp(value string) (time.Time, error) {
+	dateTimeValue, isBc := strings.CutSuffix(value, PG_BC_SUFFIX)
+	dateValue, clockValue, hasClock := strings.Cut(dateTimeValue, " ")
+
+	dateParts := strings.Split(dateValue, "-")
+	if len(dateParts) != 3 || len(dateParts[0]) < 4 {
+		return time.Time{}, fmt.Errorf("invalid date %s", value)
+	}
+	year, err := StringToInt(dateParts[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid year in %s", value)
+	}
+	if isBc {
+		// There is no year 0: 1 BC is year 0, 2 BC is year -1, etc.
+		year = 1 - year
+	}
+	parsedDate, err := time.Parse("01-02", dateParts[1]+"-"+dateParts[2])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s", value)
+	}
+
+	var parsedClock time.Time
+	location := time.UTC
+	if hasClock {
+		if offsetIndex := strings.IndexAny(clockValue, "+-"); offsetIndex != -1 {
+			offsetSeconds, err := parsePgTimeZoneOffset(clockValue[offsetIndex:])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid time zone offset in %s", value)
+			}
+			location = time.FixedZone("", offsetSeconds)
+			clockValue = clockValue[:offsetIndex]
+		}
+		parsedClock, err = time.Parse("15:04:05.999999999", clockValue)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time in %s", value)
+		}
+	}
+
+	return time.Date(year, parsedDate.Month(), parsedDate.Day(), parsedClock.Hour(), parsedClock.Minute(), parsedClock.Second(), parsedClock.Nanosecond(), location).UTC(), nil
+}
+
+// Parses offsets in the "+05", "-05:30", or "-04:56:02" format
+func parsePgTimeZoneOffset(offset string) (int, error) {
+	sign := 1
+	if offset[0] == '-' {
+		sign = -1
+	}
+
+	offsetSeconds := 0
+	multiplier := 3600
+	for _, offsetPart := range strings.Split(offset[1:], ":") {
+		number, err := StringToInt(offsetPart)
+		if err != nil || len(offsetPart) != 2 || multiplier == 0 {
+			return 0, fmt.Errorf("invalid time zone offset %s", offset)
+		}
+		offsetSeconds += number * multiplier
+		multiplier /= 60
+	}
+	return sign * offsetSeconds, nil
+}
+
+// Parses a PostgreSQL array literal into its elements, which are nil for NULL elements.
+// Multi-dimensional arrays are flattened in row-major order, e.g. {{1,2},{3,NULL}} -> [1, 2, 3, nil],
+// and the bounds of arrays that don't start at 1 are ignored, e.g. [0:1]={1,2} -> [1, 2]
+func parsePgArrayElements(value string, delimiter byte) ([]*string, error) {
+	if strings.HasPrefix(value, "[") {
+		_, elementsValue, found := strings.Cut(value, "=")
+		if !found {
+			return nil, fmt.Errorf("malformed array literal %s", value)
+		}
+		value = elementsValue
+	}
+	if !strings.HasPrefix(value, "{") {
+		return nil, fmt.Errorf("malformed array literal %s", value)
+	}
+
+	elements := []*string{}
+	depth := 0
+	for i := 0; i < len(value); {
+		switch value[i] {
+		case '{':
+			depth++
+			i++
+		case '}':
+			depth--
+			i++
+			if depth < 0 {
+				return nil, fmt.Errorf("malformed array literal %s", value)
+			}
+		case delimiter, ' ':
+			i++
+		case '"':
+			var element strings.Builder
+			for i++; i < len(value) && value[i] != '"'; i++ {
+				if value[i] == '\\' && i+1 < len(value) {
+					i++
+				}
+				element.WriteByte(value[i])
+			}
+			if i == len(value) {
+				return nil, fmt.Errorf("unterminated quoted element in array literal %s", value)
+			}
+			i++
+
+			quotedElement := element.String()
+			elements = append(elements, &quotedElement)
+		default:
+			start := i
+			for i < len(value) && value[i] != delimiter && value[i] != '}' {
+				i++
+			}
+
+			element := strings.TrimSpace(value[start:i])
+			if strings.EqualFold(element, "NULL") {
+				elements = append(elements, nil)
+			} else {
+				elements = append(elements, &element)
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("malformed array literal %s", value)
+	}
+
+	return elements, nil
+}
+
+// Elements of box arrays are separated with semicolons because boxes contain commas, e.g. {(1,1),(0,0);(2,2),(1,1)}
+func pgArrayDelimiter(udtName string) byte {
+	if udtName == "_box" {
+		return ';'
+	}
+	return ','
+}
+
+// Decodes bytea values in the hex format ("\x0102") or the legacy escape format ("a\\b\001")
+// into bytes, which are empty but not nil for empty values to distinguish them from NULL
+func decodePgBytea(value string) []byte {
+	if strings.HasPrefix(value, `\x`) {
+		decodedValue, err := hex.DecodeString(value[2:])
+		PanicIfError(err)
+		return decodedValue
+	}
+
+	decodedValue := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			decodedValue = append(decodedValue, value[i])
+		} else if i+1 < len(value) && value[i+1] == '\\' {
+			decodedValue = append(decodedValue, '\\')
+			i++
+		} else if i+3 < len(value) {
+			octalValue, err := strconv.ParseUint(value[i+1:i+4], 8, 8)
+			PanicIfError(err)
+			decodedValue = append(decodedValue, byte(octalValue))
+			i += 3
+		} else {
+			panic("Invalid PostgreSQL bytea value: " + value)
+		}
+	}
+	return decodedValue
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	PG_XID_EPOCH_BITS = 32
+
+	// xmin is a 32-bit transaction ID, txid_snapshot values are 64-bit with the wraparound epoch in the high bits
+	PG_XMIN_COLUMN_EXPRESSION = "xmin::text::bigint"
+)
+
+// Best-effort incremental sync with the xmin system column, which is set to the ID of the transaction that inserted
+// or last updated a row version. Rows are synced incrementally if their xmin wasn't visible in the snapshot of the
+// last sync, recorded with txid_current_snapshot() in the table metadata.
+//
+// WARNING: xmin is a 32-bit transaction ID that wraps around every ~4 billion transactions, so:
+//   - Changes are only detected within a single wraparound epoch. If the epoch has changed since the last sync,
+//     including a snapshot that spans two epochs, the table is synced fully instead.
+//   - Frozen tuples keep their original xmin (PostgreSQL 9.4+), so rows that weren't updated for more than
+//     ~4 billion transactions can have an xmin that looks recent and may be appended again.
+//   - Subtransactions (savepoints) of transactions that were running during the last sync aren't listed in the snapshot,
+//     so their rows may be missed until they are updated again.
+//
+// Updated rows are appended as new row versions and deleted rows aren't detected, so it suits append-only tables.
+type PgXminSnapshot struct {
+	Xmin uint64
+	Xmax uint64
+	Xip  []uint64 // in-progress transaction IDs
+}
+
+// Parses the "xmin:xmax:xip,..." text format of txid_snapshot
+func ParsePgXminSnapshot(text string) (*PgXminSnapshot, error) {
+	parts := strings.Split(text, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid transaction snapshot %s", text)
+	}
+
+	xmin, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction snapshot %s: %v", text, err)
+	}
+	xmax, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction snapshot %s: %v", text, err)
+	}
+
+	snapshot := &PgXminSnapshot{Xmin: xmin, Xmax: xmax}
+	if parts[2] != "" {
+		for _, xipText := range strings.Split(parts[2], ",") {
+			xip, err := strconv.ParseUint(xipText, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transaction snapshot %s: %v", text, err)
+			}
+			snapshot.Xip = append(snapshot.Xip, xip)
+		}
+	}
+	return snapshot, nil
+}
+
+func (snapshot PgXminSnapshot) String() string {
+	xips := make([]string, len(snapshot.Xip))
+	for i, xip := range snapshot.Xip {
+		xips[i] = strconv.FormatUint(xip, 10)
+	}
+	return strconv.FormatUint(snapshot.Xmin, 10) + ":" + strconv.FormatUint(snapshot.Xmax, 10) + ":" + strings.Join(xips, ",")
+}
+
+// Changes can be detected with 32-bit xmin values only if both snapshots are in the same wraparound epoch
+func (snapshot PgXminSnapshot) IsInSameEpoch(currentSnapshot PgXminSnapshot) bool {
+	epoch := snapshot.Xmin >> PG_XID_EPOCH_BITS
+	return snapshot.Xmin <= currentSnapshot.Xmax && snapshot.Xmax>>PG_XID_EPOCH_BITS == epoch && currentSnapshot.Xmax>>PG_XID_EPOCH_BITS == epoch
+}
+
+// Returns a predicate for rows with an xmin that wasn't visible in the snapshot, but is visible in the current one.
+// The xmin range excludes rows from transactions of previous epochs with an xmin outside of it
+func (snapshot PgXminSnapshot) ChangedRowsPredicate(currentSnapshot PgXminSnapshot) string {
+	epochMask := uint64(1)<<PG_XID_EPOCH_BITS - 1
+	epochStart := snapshot.Xmin &^ epochMask
+
+	return fmt.Sprintf(
+		"%s >= %d AND %s < %d AND NOT txid_visible_in_snapshot(%d + %s, '%s'::txid_snapshot)",
+		PG_XMIN_COLUMN_EXPRESSION, snapshot.Xmin&epochMask,
+		PG_XMIN_COLUMN_EXPRESSION, currentSnapshot.Xmax&epochMask,
+		epochStart, PG_XMIN_COLUMN_EXPRESSION, snapshot.String(),
+	)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePgXminSnapshot(t *testing.T) {
+	t.Run("parses the txid_snapshot text format", func(t *testing.T) {
+		for text, expected := range map[string]*PgXminSnapshot{
+			"100:105:":               {Xmin: 100, Xmax: 105},
+			"100:105:100,103":        {Xmin: 100, Xmax: 105, Xip: []uint64{100, 103}},
+			"4294967396:4294967400:": {Xmin: 4294967396, Xmax: 4294967400},
+		} {
+			snapshot, err := ParsePgXminSnapshot(text)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(snapshot, expected) {
+				t.Errorf("Expected %v, got %v", expected, snapshot)
+			}
+			if snapshot.String() != text {
+				t.Errorf("Expected %s, got %s", text, snapshot.String())
+			}
+		}
+	})
+
+	t.Run("returns an error for invalid snapshots", func(t *testing.T) {
+		for _, text := range []string{"", "100:105", "100:abc:", "100:105:1,x"} {
+			_, err := ParsePgXminSnapshot(text)
+
+			if err == nil {
+				t.Errorf("Expected an error for %s", text)
+			}
+		}
+	})
+}
+
+func TestPgXminSnapshotIsInSameEpoch(t *testing.T) {
+	t.Run("returns true for snapshots in the same epoch", func(t *testing.T) {
+		snapshot := PgXminSnapshot{Xmin: 4294967396, Xmax: 4294967400}
+
+		if !snapshot.IsInSameEpoch(PgXminSnapshot{Xmin: 4294968000, Xmax: 4294968005}) {
+			t.Errorf("Expected snapshots to be in the same epoch")
+		}
+	})
+
+	t.Run("returns false after a wraparound", func(t *testing.T) {
+		snapshot := PgXminSnapshot{Xmin: 4294967000, Xmax: 4294967005}
+
+		if snapshot.IsInSameEpoch(PgXminSnapshot{Xmin: 4294967396, Xmax: 4294967400}) {
+			t.Errorf("Expected snapshots to be in different epochs")
+		}
+	})
+
+	t.Run("returns false for a snapshot that spans two epochs", func(t *testing.T) {
+		snapshot := PgXminSnapshot{Xmin: 4294967000, Xmax: 4294967300}
+
+		if snapshot.IsInSameEpoch(PgXminSnapshot{Xmin: 4294967300, Xmax: 4294967400}) {
+			t.Errorf("Expected snapshots to be in different epochs")
+		}
+	})
+
+	t.Run("returns false for a snapshot newer than the current one", func(t *testing.T) {
+		snapshot := PgXminSnapshot{Xmin: 200, Xmax: 205}
+
+		if snapshot.IsInSameEpoch(PgXminSnapshot{Xmin: 100, Xmax: 105}) {
+			t.Errorf("Expected the snapshot to be rejected")
+		}
+	})
+}
+
+func TestPgXminSnapshotChangedRowsPredicate(t *testing.T) {
+	t.Run("selects rows with an xmin that wasn't visible in the snapshot", func(t *testing.T) {
+		snapshot := PgXminSnapshot{Xmin: 4294967396, Xmax: 4294967400, Xip: []uint64{4294967396, 4294967398}}
+
+		predicate := snapshot.ChangedRowsPredicate(PgXminSnapshot{Xmin: 4294968000, Xmax: 4294968005})
+
+		expected := "xmin::text::bigint >= 100 AND xmin::text::bigint < 709 AND NOT txid_visible_in_snapshot(4294967296 + xmin::text::bigint, '4294967396:4294967400:4294967396,4294967398'::txid_snapshot)"
+		if predicate != expected {
+			t.Errorf("Expected %s, got %s", expected, predicate)
+		}
+	})
+}
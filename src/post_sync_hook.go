@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	POST_SYNC_HOOK_TIMEOUT           = 5 * time.Minute
+	POST_SYNC_HOOK_MAX_OUTPUT_LENGTH = 1024 // characters of the response body or command output to include in errors
+)
+
+// JSON summary of a sync run passed to post-sync hooks: the sync manifest with its totals
+type PostSyncSummary struct {
+	*SyncManifest
+	DurationMs int64 `json:"durationMs"`
+	RowCount   int64 `json:"rowCount"`
+}
+
+func NewPostSyncSummary(manifest *SyncManifest) PostSyncSummary {
+	return PostSyncSummary{
+		SyncManifest: manifest,
+		DurationMs:   manifest.FinishedAt.Sub(manifest.StartedAt).Milliseconds(),
+		RowCount:     manifest.RowCount(),
+	}
+}
+
+// Sends the summary to the webhook and runs the command. Both are attempted, so that a failing webhook doesn't skip the command
+func RunPostSyncHooks(ctx context.Context, config *Config, manifest *SyncManifest) error {
+	data, err := json.Marshal(NewPostSyncSummary(manifest))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, POST_SYNC_HOOK_TIMEOUT)
+	defer cancel()
+
+	var errs []error
+	if config.PostSyncWebhook != "" {
+		err = callPostSyncWebhook(ctx, config.PostSyncWebhook, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("post-sync webhook failed: %w", err))
+		} else {
+			LogComponentDebug(config, LOG_COMPONENT_SYNCER, "Sent the sync summary to the post-sync webhook")
+		}
+	}
+	if config.PostSyncCommand != "" {
+		output, err := runPostSyncCommand(ctx, config.PostSyncCommand, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("post-sync command failed: %w", err))
+		} else {
+			LogComponentDebug(config, LOG_COMPONENT_SYNCER, "Ran the post-sync command:", output)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func callPostSyncWebhook(ctx context.Context, webhookUrl string, data []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, POST_SYNC_HOOK_MAX_OUTPUT_LENGTH))
+		return fmt.Errorf("unexpected status %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Runs the command with "sh -c", so that it can use pipes and environment variables
+func runPostSyncCommand(ctx context.Context, command string, data []byte) (output string, err error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+
+	combinedOutput, err := cmd.CombinedOutput()
+	output = strings.TrimSpace(string(combinedOutput))
+	if len(output) > POST_SYNC_HOOK_MAX_OUTPUT_LENGTH {
+		output = output[:POST_SYNC_HOOK_MAX_OUTPUT_LENGTH] + "..."
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, output)
+	}
+	return output, nil
+}
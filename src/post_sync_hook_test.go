@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostSyncHooks(t *testing.T) {
+	newSyncManifest := func() *SyncManifest {
+		manifest := NewSyncManifest()
+		manifest.StartedAt = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		manifest.FinishedAt = manifest.StartedAt.Add(1500 * time.Millisecond)
+		manifest.AddTable(SyncManifestTable{Schema: "public", Table: "users", Status: SYNC_MANIFEST_TABLE_STATUS_SYNCED, RowCount: 100, BytesWritten: 2048})
+		manifest.AddTable(SyncManifestTable{Schema: "public", Table: "events", Status: SYNC_MANIFEST_TABLE_STATUS_SKIPPED, RowCount: 5})
+		return manifest
+	}
+
+	assertSummary := func(t *testing.T, data []byte, manifest *SyncManifest) {
+		var summary struct {
+			RunId      string              `json:"runId"`
+			DurationMs int64               `json:"durationMs"`
+			RowCount   int64               `json:"rowCount"`
+			Tables     []SyncManifestTable `json:"tables"`
+		}
+		err := json.Unmarshal(data, &summary)
+		if err != nil {
+			t.Fatalf("Expected a JSON summary, got %s", string(data))
+		}
+		if summary.RunId != manifest.RunId {
+			t.Errorf("Expected runId to be %s, got %s", manifest.RunId, summary.RunId)
+		}
+		if summary.DurationMs != 1500 {
+			t.Errorf("Expected durationMs to be 1500, got %d", summary.DurationMs)
+		}
+		if summary.RowCount != 105 {
+			t.Errorf("Expected rowCount to be 105, got %d", summary.RowCount)
+		}
+		if len(summary.Tables) != 2 || summary.Tables[0].Table != "users" || summary.Tables[0].RowCount != 100 {
+			t.Errorf("Expected the synced tables in the summary, got %v", summary.Tables)
+		}
+	}
+
+	t.Run("posts the run summary to the webhook", func(t *testing.T) {
+		var body []byte
+		var contentType string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			contentType = r.Header.Get("Content-Type")
+		}))
+		defer server.Close()
+		config := loadTestConfig()
+		config.PostSyncWebhook = server.URL
+		manifest := newSyncManifest()
+
+		err := RunPostSyncHooks(context.Background(), config, manifest)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if contentType != "application/json" {
+			t.Errorf("Expected Content-Type to be application/json, got %s", contentType)
+		}
+		assertSummary(t, body, manifest)
+	})
+
+	t.Run("runs the command with the run summary on stdin", func(t *testing.T) {
+		summaryPath := filepath.Join(t.TempDir(), "summary.json")
+		config := loadTestConfig()
+		config.PostSyncCommand = "cat > " + summaryPath
+		manifest := newSyncManifest()
+
+		err := RunPostSyncHooks(context.Background(), config, manifest)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		data, err := os.ReadFile(summaryPath)
+		if err != nil {
+			t.Fatalf("Expected the command to write the summary, got %v", err)
+		}
+		assertSummary(t, data, manifest)
+	})
+
+	t.Run("returns errors of both hooks after running each of them", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "orchestrator unavailable", http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		config := loadTestConfig()
+		config.PostSyncWebhook = server.URL
+		config.PostSyncCommand = "echo 'dbt failed' && exit 3"
+
+		err := RunPostSyncHooks(context.Background(), config, newSyncManifest())
+
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+		for _, expected := range []string{"post-sync webhook failed: unexpected status 503 Service Unavailable: orchestrator unavailable", "post-sync command failed: exit status 3: dbt failed"} {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error to contain %s, got %v", expected, err)
+			}
+		}
+	})
+
+	t.Run("logs hook errors without failing the sync by default", func(t *testing.T) {
+		config := loadTestConfig()
+		config.PostSyncCommand = "exit 1"
+		syncer := &Syncer{config: config, syncManifest: newSyncManifest()}
+
+		syncer.runPostSyncHooks(context.Background())
+	})
+
+	t.Run("fails the sync on hook errors with FailOnHookError", func(t *testing.T) {
+		config := loadTestConfig()
+		config.PostSyncCommand = "exit 1"
+		config.FailOnHookError = true
+		syncer := &Syncer{config: config, syncManifest: newSyncManifest()}
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic when the post-sync command fails")
+			}
+		}()
+
+		syncer.runPostSyncHooks(context.Background())
+	})
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
+	"io"
+	"math"
 	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
 )
 
@@ -13,22 +23,180 @@ const (
 	PG_TX_STATUS_IDLE = 'I'
 
 	SYSTEM_AUTH_USER = "bemidb"
+
+	PG_SESSION_STATE_ACTIVE = "active"
+	PG_SESSION_STATE_IDLE   = "idle"
 )
 
+// Returned by the startup when the connection was opened only to cancel a query running on another connection
+var errCancelRequest = errors.New("cancel request")
+
 type Postgres struct {
-	backend *pgproto3.Backend
-	conn    *net.Conn
-	config  *Config
+	backend         *pgproto3.Backend
+	conn            *net.Conn
+	config          *Config
+	sessionRegistry *PgSessionRegistry
+
+	// Sent to the client in BackendKeyData to identify the connection in CancelRequest
+	processId uint32
+	secretKey uint32
+
+	cancelQueryMutex sync.Mutex
+	cancelQuery      context.CancelFunc
+
+	sessionMutex sync.Mutex
+	session      PgSession
+
+	// Used only by the goroutine handling the connection
+	settings *PgSessionSettings
+}
+
+func NewPostgres(config *Config, conn *net.Conn, sessionRegistry *PgSessionRegistry) *Postgres {
+	postgres := &Postgres{
+		conn:            conn,
+		backend:         pgproto3.NewBackend(*conn, *conn),
+		config:          config,
+		sessionRegistry: sessionRegistry,
+		session:         PgSession{BackendStart: time.Now()},
+		settings:        NewPgSessionSettings(),
+	}
+
+	if host, port, err := net.SplitHostPort((*conn).RemoteAddr().String()); err == nil {
+		postgres.session.ClientAddr = host
+		postgres.session.ClientPort, _ = strconv.Atoi(port)
+	}
+
+	return postgres
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Snapshot of a client connection exposed via pg_stat_activity
+type PgSession struct {
+	ProcessId       uint32
+	Database        string
+	User            string
+	ApplicationName string
+	ClientAddr      string
+	ClientPort      int
+	BackendStart    time.Time
+	QueryStart      time.Time
+	StateChange     time.Time
+	State           string
+	Query           string
+}
+
+const (
+	PG_SETTING_AS_OF      = "bemidb.as_of"
+	PG_SETTING_NESSIE_REF = "bemidb.nessie_ref"
+)
+
+// Session settings changed with SET that BemiDB applies to queries and their results itself
+type PgSessionSettings struct {
+	TimeZone  *time.Location
+	AsOf      *time.Time // optional, reads Iceberg tables as they were at this time
+	NessieRef string     // optional, reads Iceberg tables as they were committed to this Nessie branch, tag, or "branch@hash"
+}
+
+type pgSessionSettingsContextKey struct{}
+
+func NewPgSessionSettings() *PgSessionSettings {
+	return &PgSessionSettings{TimeZone: time.UTC}
+}
+
+func ContextWithPgSessionSettings(ctx context.Context, settings *PgSessionSettings) context.Context {
+	return context.WithValue(ctx, pgSessionSettingsContextKey{}, settings)
+}
+
+// Returns the default settings for queries that don't come from a client connection
+func PgSessionSettingsFromContext(ctx context.Context) *PgSessionSettings {
+	if settings, ok := ctx.Value(pgSessionSettingsContextKey{}).(*PgSessionSettings); ok && settings != nil {
+		return settings
+	}
+	return NewPgSessionSettings()
+}
+
+// Keeps track of active connections:
+// - Maps cancellation keys to connections, since CancelRequest messages are sent over a new connection
+// - Lists sessions for pg_stat_activity
+type PgSessionRegistry struct {
+	mutex               sync.Mutex
+	postgresByProcessId map[uint32]*Postgres
 }
 
-func NewPostgres(config *Config, conn *net.Conn) *Postgres {
-	return &Postgres{
-		conn:    conn,
-		backend: pgproto3.NewBackend(*conn, *conn),
-		config:  config,
+func NewPgSessionRegistry() *PgSessionRegistry {
+	return &PgSessionRegistry{postgresByProcessId: make(map[uint32]*Postgres)}
+}
+
+func (registry *PgSessionRegistry) Register(postgres *Postgres) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for {
+		// Process IDs are exposed as int4 in pg_stat_activity
+		postgres.processId = randomUint32() & math.MaxInt32
+		if _, ok := registry.postgresByProcessId[postgres.processId]; !ok && postgres.processId != 0 {
+			break
+		}
+	}
+	postgres.secretKey = randomUint32()
+	registry.postgresByProcessId[postgres.processId] = postgres
+
+	postgres.sessionMutex.Lock()
+	postgres.session.ProcessId = postgres.processId
+	postgres.sessionMutex.Unlock()
+}
+
+func (registry *PgSessionRegistry) Unregister(postgres *Postgres) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.postgresByProcessId[postgres.processId] == postgres {
+		delete(registry.postgresByProcessId, postgres.processId)
+	}
+}
+
+// Cancels the running query of the connection if the secret key matches
+func (registry *PgSessionRegistry) Cancel(processId uint32, secretKey uint32) bool {
+	registry.mutex.Lock()
+	postgres, ok := registry.postgresByProcessId[processId]
+	registry.mutex.Unlock()
+
+	if !ok || postgres.secretKey != secretKey {
+		return false
+	}
+
+	postgres.CancelQuery()
+	return true
+}
+
+// Returns sessions ordered by their backend start time
+func (registry *PgSessionRegistry) Sessions() []PgSession {
+	registry.mutex.Lock()
+	sessions := make([]PgSession, 0, len(registry.postgresByProcessId))
+	for _, postgres := range registry.postgresByProcessId {
+		sessions = append(sessions, postgres.Session())
 	}
+	registry.mutex.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].BackendStart.Equal(sessions[j].BackendStart) {
+			return sessions[i].ProcessId < sessions[j].ProcessId
+		}
+		return sessions[i].BackendStart.Before(sessions[j].BackendStart)
+	})
+	return sessions
+}
+
+func randomUint32() uint32 {
+	var bytes [4]byte
+	_, err := rand.Read(bytes[:])
+	PanicIfError(err)
+	return binary.BigEndian.Uint32(bytes[:])
 }
 
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
 func NewTcpListener(config *Config) net.Listener {
 	parsedIp := net.ParseIP(config.Host)
 	if parsedIp == nil {
@@ -57,8 +225,11 @@ func AcceptConnection(listener net.Listener) net.Conn {
 
 func (postgres *Postgres) Run(queryHandler *QueryHandler) {
 	err := postgres.handleStartup()
+	if errors.Is(err, errCancelRequest) {
+		return // Terminate connection, the client doesn't expect a response
+	}
 	if err != nil {
-		LogError(postgres.config, "Error handling startup:", err)
+		LogComponentError(postgres.config, LOG_COMPONENT_QUERY, "Error handling startup:", err)
 		return // Terminate connection
 	}
 
@@ -70,46 +241,187 @@ func (postgres *Postgres) Run(queryHandler *QueryHandler) {
 
 		switch message := message.(type) {
 		case *pgproto3.Query:
-			postgres.handleSimpleQuery(queryHandler, message)
+			err = postgres.handleSimpleQuery(queryHandler, message)
+			if err != nil {
+				return // Terminate connection
+			}
 		case *pgproto3.Parse:
 			err = postgres.handleExtendedQuery(queryHandler, message)
 			if err != nil {
 				return // Terminate connection
 			}
 		case *pgproto3.Terminate:
-			LogDebug(postgres.config, "Client terminated connection")
+			LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Client terminated connection")
 			return
 		default:
-			LogError(postgres.config, "Received message other than Query from client:", message)
+			LogComponentError(postgres.config, LOG_COMPONENT_QUERY, "Received message other than Query from client:", message)
 			return // Terminate connection
 		}
 	}
 }
 
 func (postgres *Postgres) Close() error {
+	postgres.sessionRegistry.Unregister(postgres)
 	return (*postgres.conn).Close()
 }
 
-func (postgres *Postgres) handleSimpleQuery(queryHandler *QueryHandler, queryMessage *pgproto3.Query) {
-	LogDebug(postgres.config, "Received query:", queryMessage.String)
-	messages, err := queryHandler.HandleQuery(queryMessage.String)
+func (postgres *Postgres) Session() PgSession {
+	postgres.sessionMutex.Lock()
+	defer postgres.sessionMutex.Unlock()
+
+	return postgres.session
+}
+
+func (postgres *Postgres) CancelQuery() {
+	postgres.cancelQueryMutex.Lock()
+	defer postgres.cancelQueryMutex.Unlock()
+
+	if postgres.cancelQuery != nil {
+		LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Canceling query")
+		postgres.cancelQuery()
+	}
+}
+
+// Returns a context that is canceled by CancelRequest until the returned function is called
+func (postgres *Postgres) startQuery(query string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ContextWithPgSessionSettings(context.Background(), postgres.settings))
+
+	postgres.cancelQueryMutex.Lock()
+	postgres.cancelQuery = cancel
+	postgres.cancelQueryMutex.Unlock()
+
+	now := time.Now()
+	postgres.sessionMutex.Lock()
+	postgres.session.Query = query
+	postgres.session.QueryStart = now
+	postgres.session.State = PG_SESSION_STATE_ACTIVE
+	postgres.session.StateChange = now
+	postgres.sessionMutex.Unlock()
+
+	return ctx, func() {
+		postgres.cancelQueryMutex.Lock()
+		postgres.cancelQuery = nil
+		postgres.cancelQueryMutex.Unlock()
+		cancel()
+
+		postgres.sessionMutex.Lock()
+		postgres.session.State = PG_SESSION_STATE_IDLE
+		postgres.session.StateChange = time.Now()
+		postgres.sessionMutex.Unlock()
+	}
+}
+
+func (postgres *Postgres) handleSimpleQuery(queryHandler *QueryHandler, queryMessage *pgproto3.Query) error {
+	LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Received query:", queryMessage.String)
+	ctx, finishQuery := postgres.startQuery(queryMessage.String)
+	defer finishQuery()
+
+	copyStatement, err := ParsePgCopyFromStdin(queryMessage.String)
 	if err != nil {
-		postgres.writeError(err.Error())
-		return
+		postgres.writeQueryError(err, err.Error())
+		return nil
+	}
+	if copyStatement != nil {
+		return postgres.handleCopyIn(ctx, queryHandler, copyStatement)
+	}
+
+	err = queryHandler.StreamQuery(ctx, queryMessage.String, func(messages []pgproto3.Message) error {
+		postgres.writeMessages(messages...)
+		return nil
+	})
+	if err != nil {
+		postgres.writeQueryError(err, err.Error())
+		return nil
+	}
+	postgres.writeMessages(&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE})
+	return nil
+}
+
+// Streams CopyData messages to the query handler until CopyDone or CopyFail. Messages are consumed until the end of
+// the COPY even if the handler failed, since the client keeps sending data until it receives the error
+func (postgres *Postgres) handleCopyIn(ctx context.Context, queryHandler *QueryHandler, copyStatement *PgCopyStatement) error {
+	pgSchemaColumns, err := queryHandler.HandleCopyFromStdinColumns(copyStatement)
+	if err != nil {
+		postgres.writeQueryError(err, err.Error())
+		return nil
+	}
+
+	postgres.writeMessages(&pgproto3.CopyInResponse{
+		OverallFormat:     0, // Text
+		ColumnFormatCodes: make([]uint16, len(copyStatement.ColumnNames)),
+	})
+
+	pipeReader, pipeWriter := io.Pipe()
+	type copyResult struct {
+		rowCount int64
+		err      error
+	}
+	copyResultChannel := make(chan copyResult, 1)
+	go func() {
+		rowCount, err := queryHandler.HandleCopyFromStdin(ctx, copyStatement, pgSchemaColumns, pipeReader)
+		pipeReader.CloseWithError(errors.New("COPY finished")) // Unblock writes if the handler stopped reading early
+		copyResultChannel <- copyResult{rowCount: rowCount, err: err}
+	}()
+
+	for {
+		message, err := postgres.backend.Receive()
+		if err != nil {
+			pipeWriter.CloseWithError(err)
+			<-copyResultChannel
+			return err
+		}
+
+		switch message := message.(type) {
+		case *pgproto3.CopyData:
+			pipeWriter.Write(message.Data) // Errors are returned by the handler
+		case *pgproto3.CopyDone:
+			pipeWriter.Close()
+			result := <-copyResultChannel
+			if result.err != nil {
+				postgres.writeQueryError(result.err, result.err.Error())
+				return nil
+			}
+			postgres.writeMessages(
+				&pgproto3.CommandComplete{CommandTag: []byte("COPY " + strconv.FormatInt(result.rowCount, 10))},
+				&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
+			)
+			return nil
+		case *pgproto3.CopyFail:
+			LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Client aborted COPY:", message.Message)
+			pipeWriter.CloseWithError(pgCopyFailError(message.Message))
+			result := <-copyResultChannel
+			postgres.writeQueryError(result.err, result.err.Error())
+			return nil
+		case *pgproto3.Flush, *pgproto3.Sync:
+			// Ignored during COPY like in PostgreSQL
+		default:
+			pipeWriter.CloseWithError(errors.New("unexpected message during COPY"))
+			<-copyResultChannel
+			LogComponentError(postgres.config, LOG_COMPONENT_QUERY, "Received message other than CopyData, CopyDone, or CopyFail during COPY:", message)
+			return errors.New("unexpected message during COPY")
+		}
 	}
-	messages = append(messages, &pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE})
-	postgres.writeMessages(messages...)
 }
 
 func (postgres *Postgres) handleExtendedQuery(queryHandler *QueryHandler, parseMessage *pgproto3.Parse) error {
-	LogDebug(postgres.config, "Parsing query", parseMessage.Query)
-	messages, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+	LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Parsing query", parseMessage.Query)
+	messages, preparedStatement, err := queryHandler.HandleParseQuery(ContextWithPgSessionSettings(context.Background(), postgres.settings), parseMessage)
 	if err != nil {
-		postgres.writeError("Failed to parse query")
+		postgres.writeQueryError(err, "Failed to parse query")
 		return nil
 	}
 	postgres.writeMessages(messages...)
 
+	// Rows are queried on Describe and read on Execute, so the context lasts until Sync.
+	// Rows of a portal suspended by the row limit of Execute are closed on Sync
+	ctx, finishQuery := postgres.startQuery(parseMessage.Query)
+	defer finishQuery()
+	defer func() {
+		if preparedStatement != nil {
+			preparedStatement.CloseRows()
+		}
+	}()
+
 	for {
 		message, err := postgres.backend.Receive()
 		if err != nil {
@@ -118,7 +430,7 @@ func (postgres *Postgres) handleExtendedQuery(queryHandler *QueryHandler, parseM
 
 		switch message := message.(type) {
 		case *pgproto3.Bind:
-			LogDebug(postgres.config, "Binding query", message.PreparedStatement)
+			LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Binding query", message.PreparedStatement)
 			messages, preparedStatement, err = queryHandler.HandleBindQuery(message, preparedStatement)
 			if err != nil {
 				postgres.writeError("Failed to bind query")
@@ -126,24 +438,26 @@ func (postgres *Postgres) handleExtendedQuery(queryHandler *QueryHandler, parseM
 			}
 			postgres.writeMessages(messages...)
 		case *pgproto3.Describe:
-			LogDebug(postgres.config, "Describing query", message.Name, "("+string(message.ObjectType)+")")
+			LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Describing query", message.Name, "("+string(message.ObjectType)+")")
 			var messages []pgproto3.Message
-			messages, preparedStatement, err = queryHandler.HandleDescribeQuery(message, preparedStatement)
+			messages, preparedStatement, err = queryHandler.HandleDescribeQuery(ctx, message, preparedStatement)
 			if err != nil {
-				postgres.writeError("Failed to describe query")
+				postgres.writeQueryError(err, "Failed to describe query")
 				continue
 			}
 			postgres.writeMessages(messages...)
 		case *pgproto3.Execute:
-			LogDebug(postgres.config, "Executing query", message.Portal)
-			messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+			LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Executing query", message.Portal)
+			err := queryHandler.StreamExecuteQuery(ctx, message, preparedStatement, func(messages []pgproto3.Message) error {
+				postgres.writeMessages(messages...)
+				return nil
+			})
 			if err != nil {
-				postgres.writeError("Failed to execute query")
+				postgres.writeQueryError(err, "Failed to execute query")
 				continue
 			}
-			postgres.writeMessages(messages...)
 		case *pgproto3.Sync:
-			LogDebug(postgres.config, "Syncing query")
+			LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "Syncing query")
 			postgres.writeMessages(
 				&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
 			)
@@ -170,6 +484,20 @@ func (postgres *Postgres) writeError(message string) {
 	)
 }
 
+// Keeps the SQLSTATE code of PostgreSQL errors such as query_canceled, otherwise writes the fallback message
+func (postgres *Postgres) writeQueryError(err error, fallbackMessage string) {
+	var pgError *pgconn.PgError
+	if !errors.As(err, &pgError) {
+		postgres.writeError(fallbackMessage)
+		return
+	}
+
+	postgres.writeMessages(
+		&pgproto3.ErrorResponse{Severity: pgError.Severity, Code: pgError.Code, Message: pgError.Message, Detail: pgError.Detail, Hint: pgError.Hint, Where: pgError.Where},
+		&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
+	)
+}
+
 func (postgres *Postgres) handleStartup() error {
 	startupMessage, err := postgres.backend.ReceiveStartupMessage()
 	if err != nil {
@@ -179,7 +507,7 @@ func (postgres *Postgres) handleStartup() error {
 	switch startupMessage := startupMessage.(type) {
 	case *pgproto3.StartupMessage:
 		params := startupMessage.Parameters
-		LogDebug(postgres.config, "BemiDB: startup message", params)
+		LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "BemiDB: startup message", params)
 
 		if params["database"] != postgres.config.Database {
 			postgres.writeError("database " + params["database"] + " does not exist")
@@ -191,20 +519,33 @@ func (postgres *Postgres) handleStartup() error {
 			return errors.New("role does not exist")
 		}
 
+		postgres.sessionMutex.Lock()
+		postgres.session.Database = params["database"]
+		postgres.session.User = params["user"]
+		postgres.session.ApplicationName = params["application_name"]
+		postgres.session.State = PG_SESSION_STATE_IDLE
+		postgres.session.StateChange = time.Now()
+		postgres.sessionMutex.Unlock()
+
+		postgres.sessionRegistry.Register(postgres)
 		postgres.writeMessages(
 			&pgproto3.AuthenticationOk{},
 			&pgproto3.ParameterStatus{Name: "client_encoding", Value: PG_ENCODING},
 			&pgproto3.ParameterStatus{Name: "server_version", Value: PG_VERSION},
+			&pgproto3.BackendKeyData{ProcessID: postgres.processId, SecretKey: postgres.secretKey},
 			&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
 		)
 		return nil
+	case *pgproto3.CancelRequest:
+		canceled := postgres.sessionRegistry.Cancel(startupMessage.ProcessID, startupMessage.SecretKey)
+		LogComponentDebug(postgres.config, LOG_COMPONENT_QUERY, "BemiDB: cancel request for process", startupMessage.ProcessID, "canceled:", canceled)
+		return errCancelRequest
 	case *pgproto3.SSLRequest:
 		_, err = (*postgres.conn).Write([]byte("N"))
 		if err != nil {
 			return err
 		}
-		postgres.handleStartup()
-		return nil
+		return postgres.handleStartup()
 	default:
 		return errors.New("unknown startup message")
 	}
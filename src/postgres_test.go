@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+func TestPgSessionRegistry(t *testing.T) {
+	config := loadTestConfig()
+
+	t.Run("cancels the running query of the connection with a matching secret key", func(t *testing.T) {
+		registry := NewPgSessionRegistry()
+		postgres := &Postgres{config: config, sessionRegistry: registry}
+		registry.Register(postgres)
+		ctx, finishQuery := postgres.startQuery("SELECT 1")
+		defer finishQuery()
+
+		canceled := registry.Cancel(postgres.processId, postgres.secretKey)
+
+		if !canceled || ctx.Err() == nil {
+			t.Error("Expected the query to be canceled")
+		}
+	})
+
+	t.Run("doesn't cancel the query with a wrong secret key", func(t *testing.T) {
+		registry := NewPgSessionRegistry()
+		postgres := &Postgres{config: config, sessionRegistry: registry}
+		registry.Register(postgres)
+		ctx, finishQuery := postgres.startQuery("SELECT 1")
+		defer finishQuery()
+
+		canceled := registry.Cancel(postgres.processId, postgres.secretKey+1)
+
+		if canceled || ctx.Err() != nil {
+			t.Error("Expected the query not to be canceled")
+		}
+	})
+
+	t.Run("doesn't cancel queries of unregistered connections", func(t *testing.T) {
+		registry := NewPgSessionRegistry()
+		postgres := &Postgres{config: config, sessionRegistry: registry}
+		registry.Register(postgres)
+		registry.Unregister(postgres)
+		ctx, finishQuery := postgres.startQuery("SELECT 1")
+		defer finishQuery()
+
+		canceled := registry.Cancel(postgres.processId, postgres.secretKey)
+
+		if canceled || ctx.Err() != nil {
+			t.Error("Expected the query not to be canceled")
+		}
+	})
+
+	t.Run("handles a CancelRequest sent over a new connection", func(t *testing.T) {
+		registry := NewPgSessionRegistry()
+		runningPostgres := &Postgres{config: config, sessionRegistry: registry}
+		registry.Register(runningPostgres)
+		ctx, finishQuery := runningPostgres.startQuery("SELECT 1")
+		defer finishQuery()
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		postgres := NewPostgres(config, &serverConn, registry)
+		defer postgres.Close()
+		go func() {
+			frontend := pgproto3.NewFrontend(clientConn, clientConn)
+			frontend.Send(&pgproto3.CancelRequest{ProcessID: runningPostgres.processId, SecretKey: runningPostgres.secretKey})
+			_ = frontend.Flush()
+		}()
+
+		err := postgres.handleStartup()
+
+		if !errors.Is(err, errCancelRequest) {
+			t.Errorf("Expected a cancel request error, got %v", err)
+		}
+		if ctx.Err() == nil {
+			t.Error("Expected the query to be canceled")
+		}
+	})
+
+	t.Run("lists registered sessions with their current query", func(t *testing.T) {
+		registry := NewPgSessionRegistry()
+		postgres := &Postgres{config: config, sessionRegistry: registry}
+		postgres.session.BackendStart = time.Now()
+		registry.Register(postgres)
+		_, finishQuery := postgres.startQuery("SELECT 1")
+
+		sessions := registry.Sessions()
+
+		if len(sessions) != 1 || sessions[0].ProcessId != postgres.processId {
+			t.Fatalf("Expected the registered session, got %v", sessions)
+		}
+		if sessions[0].State != PG_SESSION_STATE_ACTIVE || sessions[0].Query != "SELECT 1" || sessions[0].QueryStart.IsZero() {
+			t.Errorf("Expected an active session running the query, got %v", sessions[0])
+		}
+
+		finishQuery()
+		sessions = registry.Sessions()
+
+		if sessions[0].State != PG_SESSION_STATE_IDLE || sessions[0].Query != "SELECT 1" {
+			t.Errorf("Expected an idle session keeping the last query, got %v", sessions[0])
+		}
+
+		registry.Unregister(postgres)
+
+		if len(registry.Sessions()) != 0 {
+			t.Errorf("Expected no sessions after unregistering, got %v", registry.Sessions())
+		}
+	})
+
+	t.Run("records the client address of new connections", func(t *testing.T) {
+		listener, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		clientConn, err := net.Dial("tcp4", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer clientConn.Close()
+		serverConn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		postgres := NewPostgres(config, &serverConn, NewPgSessionRegistry())
+		defer postgres.Close()
+		session := postgres.Session()
+
+		if session.ClientAddr != "127.0.0.1" || session.ClientPort != clientConn.LocalAddr().(*net.TCPAddr).Port {
+			t.Errorf("Expected the client address, got %s:%d", session.ClientAddr, session.ClientPort)
+		}
+		if session.BackendStart.IsZero() {
+			t.Error("Expected the backend start time to be set")
+		}
+	})
+}
+
+func TestPostgresCopyIn(t *testing.T) {
+	config := loadTestConfig()
+	schemaTable := IcebergSchemaTable{Schema: "test_copy", Table: "users"}
+	pgSchemaColumns := []PgSchemaColumn{
+		{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog"},
+		{ColumnName: "name", DataType: "text", UdtName: "text", IsNullable: "YES", OrdinalPosition: "2", Namespace: "pg_catalog"},
+	}
+	queryHandler := &QueryHandler{config: config, icebergReader: NewIcebergReader(config)}
+
+	writeTable := func() {
+		loaded := false
+		NewIcebergWriter(config).Write(context.Background(), schemaTable, pgSchemaColumns, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return [][]string{{"1", "Alice"}}
+		})
+	}
+
+	// Runs the query on a new connection, sends the messages after CopyInResponse, and returns the messages that follow
+	copyIn := func(t *testing.T, query string, messages ...pgproto3.FrontendMessage) (copyInResponse pgproto3.BackendMessage, responses []pgproto3.BackendMessage) {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		postgres := NewPostgres(config, &serverConn, NewPgSessionRegistry())
+		defer postgres.Close()
+		go postgres.handleSimpleQuery(queryHandler, &pgproto3.Query{String: query})
+
+		frontend := pgproto3.NewFrontend(clientConn, clientConn)
+		copyInResponse, err := frontend.Receive()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, ok := copyInResponse.(*pgproto3.CopyInResponse); !ok {
+			return copyInResponse, nil
+		}
+
+		for _, message := range messages {
+			frontend.Send(message)
+		}
+		if err := frontend.Flush(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for {
+			response, err := frontend.Receive()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			switch response := response.(type) {
+			case *pgproto3.CommandComplete:
+				responses = append(responses, &pgproto3.CommandComplete{CommandTag: append([]byte{}, response.CommandTag...)})
+			case *pgproto3.ErrorResponse:
+				errorResponse := *response
+				responses = append(responses, &errorResponse)
+			case *pgproto3.ReadyForQuery:
+				return copyInResponse, append(responses, &pgproto3.ReadyForQuery{TxStatus: response.TxStatus})
+			}
+		}
+	}
+
+	// Data files are read in the order of their random names
+	tableRows := func(t *testing.T) [][]interface{} {
+		rows, err := queryHandler.icebergReader.TableColumnValues(schemaTable, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0].(int32) < rows[j][0].(int32) })
+		return rows
+	}
+
+	t.Run("appends rows sent with COPY FROM STDIN", func(t *testing.T) {
+		writeTable()
+		defer NewIcebergWriter(config).DeleteSchema(schemaTable.Schema)
+
+		copyInResponse, responses := copyIn(t, "COPY test_copy.users FROM STDIN WITH (FORMAT csv)",
+			&pgproto3.CopyData{Data: []byte("2,Bob\n3,")},
+			&pgproto3.CopyData{Data: []byte("\n")},
+			&pgproto3.CopyDone{},
+		)
+
+		if columnCount := len(copyInResponse.(*pgproto3.CopyInResponse).ColumnFormatCodes); columnCount != 2 {
+			t.Errorf("Expected 2 columns in CopyInResponse, got %d", columnCount)
+		}
+		expectedResponses := []pgproto3.BackendMessage{
+			&pgproto3.CommandComplete{CommandTag: []byte("COPY 2")},
+			&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
+		}
+		if !reflect.DeepEqual(responses, expectedResponses) {
+			t.Errorf("Expected %v, got %v", expectedResponses, responses)
+		}
+		expectedRows := [][]interface{}{{int32(1), "Alice"}, {int32(2), "Bob"}, {int32(3), nil}}
+		if rows := tableRows(t); !reflect.DeepEqual(rows, expectedRows) {
+			t.Errorf("Expected %v, got %v", expectedRows, rows)
+		}
+	})
+
+	t.Run("fills the columns that are not listed with NULL", func(t *testing.T) {
+		writeTable()
+		defer NewIcebergWriter(config).DeleteSchema(schemaTable.Schema)
+
+		_, responses := copyIn(t, "COPY test_copy.users (id) FROM STDIN", &pgproto3.CopyData{Data: []byte("2\n")}, &pgproto3.CopyDone{})
+
+		if tag := responses[0].(*pgproto3.CommandComplete).CommandTag; string(tag) != "COPY 1" {
+			t.Errorf("Expected COPY 1, got %s", tag)
+		}
+		expectedRows := [][]interface{}{{int32(1), "Alice"}, {int32(2), nil}}
+		if rows := tableRows(t); !reflect.DeepEqual(rows, expectedRows) {
+			t.Errorf("Expected %v, got %v", expectedRows, rows)
+		}
+	})
+
+	t.Run("doesn't append any rows if a row is invalid", func(t *testing.T) {
+		writeTable()
+		defer NewIcebergWriter(config).DeleteSchema(schemaTable.Schema)
+
+		for data, expectedCode := range map[string]string{
+			"2\tBob\nthree\tCarol\n": PG_INVALID_TEXT_REPRESENTATION_CODE,
+			"2\tBob\n\\N\tCarol\n":   PG_NOT_NULL_VIOLATION_CODE,
+			"2\tBob\n3\n":            PG_BAD_COPY_FILE_FORMAT_CODE,
+			"2\tBob\tBobby\n":        PG_BAD_COPY_FILE_FORMAT_CODE,
+			"2\tBob\\000\n":          PG_CHARACTER_NOT_IN_REPERTOIRE_CODE,
+		} {
+			_, responses := copyIn(t, "COPY test_copy.users FROM STDIN", &pgproto3.CopyData{Data: []byte(data)}, &pgproto3.CopyDone{})
+
+			errorResponse, ok := responses[0].(*pgproto3.ErrorResponse)
+			if !ok || errorResponse.Code != expectedCode {
+				t.Errorf("Expected an error with code %s for %q, got %v", expectedCode, data, responses)
+			}
+		}
+		expectedRows := [][]interface{}{{int32(1), "Alice"}}
+		if rows := tableRows(t); !reflect.DeepEqual(rows, expectedRows) {
+			t.Errorf("Expected %v, got %v", expectedRows, rows)
+		}
+	})
+
+	t.Run("doesn't append any rows if the client aborts the COPY", func(t *testing.T) {
+		writeTable()
+		defer NewIcebergWriter(config).DeleteSchema(schemaTable.Schema)
+
+		_, responses := copyIn(t, "COPY test_copy.users FROM STDIN", &pgproto3.CopyData{Data: []byte("2\tBob\n")}, &pgproto3.CopyFail{Message: "canceled by user"})
+
+		errorResponse, ok := responses[0].(*pgproto3.ErrorResponse)
+		if !ok || errorResponse.Code != PG_QUERY_CANCELED_CODE || errorResponse.Message != "COPY from stdin failed: canceled by user" {
+			t.Errorf("Expected a COPY failed error, got %v", responses)
+		}
+		expectedRows := [][]interface{}{{int32(1), "Alice"}}
+		if rows := tableRows(t); !reflect.DeepEqual(rows, expectedRows) {
+			t.Errorf("Expected %v, got %v", expectedRows, rows)
+		}
+	})
+
+	t.Run("returns an error before the COPY starts for an unknown table or column", func(t *testing.T) {
+		writeTable()
+		defer NewIcebergWriter(config).DeleteSchema(schemaTable.Schema)
+
+		for query, expectedCode := range map[string]string{
+			"COPY test_copy.unknown FROM STDIN":        PG_UNDEFINED_TABLE_CODE,
+			"COPY test_copy.users (email) FROM STDIN":  PG_UNDEFINED_COLUMN_CODE,
+			"COPY test_copy.users (id, id) FROM STDIN": PG_DUPLICATE_COLUMN_CODE,
+			"COPY test_copy.users FROM STDIN (FREEZE)": PG_FEATURE_NOT_SUPPORTED_CODE,
+		} {
+			response, _ := copyIn(t, query)
+
+			errorResponse, ok := response.(*pgproto3.ErrorResponse)
+			if !ok || errorResponse.Code != expectedCode {
+				t.Errorf("Expected an error with code %s for %s, got %v", expectedCode, query, response)
+			}
+		}
+	})
+}
@@ -1,17 +1,22 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/binary"
-	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/jackc/pgx/v5/pgtype"
 	duckDb "github.com/marcboeker/go-duckdb"
@@ -21,6 +26,14 @@ import (
 const (
 	FALLBACK_SQL_QUERY  = "SELECT 1"
 	INSPECT_SQL_COMMENT = " --INSPECT"
+
+	EXPLAIN_COLUMN_NAME = "QUERY PLAN"
+
+	QUERY_RESULT_BATCH_SIZE = 1000 // DataRow messages sent to the client at once
+
+	PG_QUERY_CANCELED_CODE            = "57014"
+	PG_INVALID_PARAMETER_VALUE_CODE   = "22023"
+	PG_READ_ONLY_SQL_TRANSACTION_CODE = "25006"
 )
 
 type QueryHandler struct {
@@ -41,6 +54,19 @@ type PreparedStatement struct {
 	Variables     []interface{}
 	Portal        string
 	Rows          *sql.Rows
+	CancelRows    context.CancelFunc // releases the query context of Rows
+	IsSuspended   bool               // Execute reached its row limit, the next Execute continues reading Rows
+}
+
+// Closes the rows queried on Describe or Execute and releases their query context
+func (preparedStatement *PreparedStatement) CloseRows() {
+	if preparedStatement.Rows != nil {
+		preparedStatement.Rows.Close()
+	}
+	if preparedStatement.CancelRows != nil {
+		preparedStatement.CancelRows()
+	}
+	preparedStatement.IsSuspended = false
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -61,11 +87,82 @@ func (nullDecimal *NullDecimal) Scan(value interface{}) error {
 	return nil
 }
 
+// Formats decimals exactly (without going through float64) and without trailing fractional zeros
 func (nullDecimal NullDecimal) String() string {
-	if nullDecimal.Present {
-		return fmt.Sprintf("%v", nullDecimal.Value.Float64())
+	if !nullDecimal.Present {
+		return ""
 	}
-	return ""
+
+	scale := int(nullDecimal.Value.Scale)
+	denominator := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	text := new(big.Rat).SetFrac(nullDecimal.Value.Value, denominator).FloatString(scale)
+	if scale > 0 {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	return text
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type NullInterval struct {
+	Present bool
+	Value   duckDb.Interval
+}
+
+func (nullInterval *NullInterval) Scan(value interface{}) error {
+	if value == nil {
+		nullInterval.Present = false
+		return nil
+	}
+
+	nullInterval.Present = true
+	nullInterval.Value = value.(duckDb.Interval)
+	return nil
+}
+
+// Formats the interval as PostgreSQL does with the default "postgres" IntervalStyle, e.g. "-1 years -2 mons +3 days -04:05:06.5"
+func (nullInterval NullInterval) String() string {
+	if !nullInterval.Present {
+		return ""
+	}
+
+	var parts []string
+	isBefore := false
+	appendPart := func(value int64, unit string) {
+		if value == 0 {
+			return
+		}
+		sign := ""
+		if isBefore && value > 0 {
+			sign = "+"
+		}
+		if value != 1 {
+			unit += "s"
+		}
+		parts = append(parts, sign+strconv.FormatInt(value, 10)+" "+unit)
+		isBefore = value < 0
+	}
+	appendPart(int64(nullInterval.Value.Months/12), "year")
+	appendPart(int64(nullInterval.Value.Months%12), "mon")
+	appendPart(int64(nullInterval.Value.Days), "day")
+
+	micros := nullInterval.Value.Micros
+	if len(parts) == 0 || micros != 0 {
+		sign := ""
+		if micros < 0 {
+			sign = "-"
+			micros = -micros
+		} else if isBefore {
+			sign = "+"
+		}
+		clock := fmt.Sprintf("%s%02d:%02d:%02d", sign, micros/3_600_000_000, micros/60_000_000%60, micros/1_000_000%60)
+		if fraction := micros % 1_000_000; fraction != 0 {
+			clock += strings.TrimRight(fmt.Sprintf(".%06d", fraction), "0")
+		}
+		parts = append(parts, clock)
+	}
+
+	return strings.Join(parts, " ")
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -145,9 +242,62 @@ func (nullBigInt NullBigInt) String() string {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////
 
-type NullArray struct {
+// BLOB values are returned in the bytea hex format, e.g. "\x0102"
+type NullBytea struct {
 	Present bool
-	Value   []interface{}
+	Value   []byte
+}
+
+func (nullBytea *NullBytea) Scan(value interface{}) error {
+	if value == nil {
+		nullBytea.Present = false
+		return nil
+	}
+
+	nullBytea.Present = true
+	nullBytea.Value = value.([]byte)
+	return nil
+}
+
+func (nullBytea NullBytea) String() string {
+	if nullBytea.Present {
+		return `\x` + hex.EncodeToString(nullBytea.Value)
+	}
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type NullUuid struct {
+	Present bool
+	Value   []byte
+}
+
+func (nullUuid *NullUuid) Scan(value interface{}) error {
+	if value == nil {
+		nullUuid.Present = false
+		return nil
+	}
+
+	nullUuid.Present = true
+	nullUuid.Value = value.([]byte)
+	return nil
+}
+
+func (nullUuid NullUuid) String() string {
+	if nullUuid.Present {
+		return uuid.UUID(nullUuid.Value).String()
+	}
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type NullArray struct {
+	Present  bool
+	Value    []interface{}
+	TypeName string
+	TimeZone *time.Location // for timestamptz elements
 }
 
 func (nullArray *NullArray) Scan(value interface{}) error {
@@ -161,100 +311,198 @@ func (nullArray *NullArray) Scan(value interface{}) error {
 	return nil
 }
 
+// Formats the array as a PostgreSQL array literal, e.g. {1,NULL,"a b"}
 func (nullArray NullArray) String() string {
-	if nullArray.Present {
-		var stringVals []string
-		for _, v := range nullArray.Value {
-			switch v.(type) {
-			case []uint8:
-				stringVals = append(stringVals, fmt.Sprintf("%s", v))
-			default:
-				stringVals = append(stringVals, fmt.Sprintf("%v", v))
-			}
+	if !nullArray.Present {
+		return ""
+	}
+
+	elements := make([]string, len(nullArray.Value))
+	for i, value := range nullArray.Value {
+		if value == nil {
+			elements[i] = "NULL"
+		} else {
+			elements[i] = quotePgArrayElement(nullArray.elementString(value))
 		}
-		buffer := &bytes.Buffer{}
-		csvWriter := csv.NewWriter(buffer)
-		err := csvWriter.Write(stringVals)
-		if err != nil {
-			return ""
+	}
+	return "{" + strings.Join(elements, ",") + "}"
+}
+
+// Formats elements the same way as scalar values of the element type
+func (nullArray NullArray) elementString(value interface{}) string {
+	switch v := value.(type) {
+	case []uint8:
+		switch nullArray.TypeName {
+		case "BLOB[]":
+			return NullBytea{Present: true, Value: v}.String()
+		case "UUID[]":
+			return NullUuid{Present: true, Value: v}.String()
+		default:
+			return string(v)
+		}
+	case float32:
+		return FloatToPgString(float64(v))
+	case float64:
+		return FloatToPgString(v)
+	case duckDb.Decimal:
+		return NullDecimal{Present: true, Value: v}.String()
+	case time.Time:
+		switch nullArray.TypeName {
+		case "DATE[]":
+			return TimeToPgDateString(v, "")
+		case "TIME[]":
+			return v.Format("15:04:05.999999")
+		case "TIMESTAMP[]":
+			return TimeToPgDateString(v, " 15:04:05.999999")
+		case "TIMESTAMPTZ[]":
+			timeZone := nullArray.TimeZone
+			if timeZone == nil {
+				timeZone = time.UTC
+			}
+			return TimeToPgTimestamptzOutputString(v, timeZone)
 		}
-		csvWriter.Flush()
-		return "{" + strings.TrimRight(buffer.String(), "\n") + "}"
 	}
-	return ""
+	return fmt.Sprintf("%v", value)
+}
+
+// Quotes elements like PostgreSQL does: empty elements, elements with special characters or whitespace, and "NULL" strings.
+// Backslashes and double quotes are escaped with a backslash, which also applies to unquoted elements, e.g. {\\x0102}
+func quotePgArrayElement(element string) string {
+	escapedElement := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(element)
+	if element == "" || strings.EqualFold(element, "NULL") || strings.ContainsAny(element, "{},\" \t\n\r\v\f") {
+		return `"` + escapedElement + `"`
+	}
+	return escapedElement
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////
 
-func NewQueryHandler(config *Config, duckdb *Duckdb, icebergReader *IcebergReader) *QueryHandler {
+func NewQueryHandler(config *Config, duckdb *Duckdb, icebergReader *IcebergReader, sessionRegistry *PgSessionRegistry) *QueryHandler {
 	queryHandler := &QueryHandler{
 		duckdb:        duckdb,
 		icebergReader: icebergReader,
-		queryRemapper: NewQueryRemapper(config, icebergReader, duckdb),
+		queryRemapper: NewQueryRemapper(config, icebergReader, duckdb, sessionRegistry),
 		config:        config,
 	}
 
 	queryHandler.createSchemas()
+	// A reopened DuckDB database starts empty
+	duckdb.OnReconnect(func() {
+		queryHandler.createSchemas()
+		queryHandler.queryRemapper.remapperTable.resetIcebergSchemaTables()
+	})
 
 	return queryHandler
 }
 
-func (queryHandler *QueryHandler) HandleQuery(originalQuery string) ([]pgproto3.Message, error) {
-	queryStatements, originalQueryStatements, err := queryHandler.parseAndRemapQuery(originalQuery)
+func (queryHandler *QueryHandler) HandleQuery(ctx context.Context, originalQuery string) (messages []pgproto3.Message, err error) {
+	err = queryHandler.StreamQuery(ctx, originalQuery, func(batchMessages []pgproto3.Message) error {
+		messages = append(messages, batchMessages...)
+		return nil
+	})
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't map query:", originalQuery+"\n"+err.Error())
 		return nil, err
 	}
+	return messages, nil
+}
+
+// Sends the messages of each query statement as its rows are read, so that large results aren't held in memory.
+// If a statement fails, the messages of the previous statements have already been sent
+func (queryHandler *QueryHandler) StreamQuery(ctx context.Context, originalQuery string, sendMessages func([]pgproto3.Message) error) (err error) {
+	ctx, span := StartSpan(ctx, "QueryHandler.HandleQuery", queryTextSpanAttribute(originalQuery))
+	returnedRowCount := 0
+	defer func() { EndQuerySpan(span, returnedRowCount, err) }()
+
+	ctx, cancel := queryHandler.queryContext(ctx)
+	defer cancel()
+
+	queryStatements, originalQueryStatements, err := queryHandler.parseAndRemapQuery(ctx, originalQuery)
+	if err != nil {
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't map query:", originalQuery+"\n"+err.Error())
+		return err
+	}
 	if len(queryStatements) == 0 {
-		return []pgproto3.Message{&pgproto3.EmptyQueryResponse{}}, nil
+		return sendMessages([]pgproto3.Message{&pgproto3.EmptyQueryResponse{}})
 	}
 
-	var queriesMessages []pgproto3.Message
+	settings := PgSessionSettingsFromContext(ctx)
 
 	for i, queryStatement := range queryStatements {
-		rows, err := queryHandler.duckdb.QueryContext(context.Background(), queryStatement)
+		timeZone, err := parsePgSetTimeZone(originalQueryStatements[i])
+		if err != nil {
+			return err
+		}
+		asOf, isAsOfSet, err := parsePgSetAsOf(originalQueryStatements[i], settings.TimeZone)
+		if err != nil {
+			return err
+		}
+		nessieRef, isNessieRefSet, err := parsePgSetNessieRef(originalQueryStatements[i])
+		if err != nil {
+			return err
+		}
+		err = waitPgSleep(ctx, originalQueryStatements[i])
+		if err != nil {
+			return err
+		}
+
+		rows, err := queryHandler.duckdb.QueryContext(ctx, queryStatement)
 		if err != nil {
+			if isQueryCanceled(ctx, err) {
+				LogComponentWarn(queryHandler.config, LOG_COMPONENT_QUERY, "Canceled query:", queryStatement)
+				return queryCanceledError(ctx, err)
+			}
 			errorMessage := err.Error()
 			if errorMessage == "Binder Error: UNNEST requires a single list as input" {
 				// https://github.com/duckdb/duckdb/issues/11693
-				LogWarn(queryHandler.config, "Couldn't handle query via DuckDB:", queryStatement+"\n"+err.Error())
-				queriesMsgs, err := queryHandler.HandleQuery(FALLBACK_SQL_QUERY) // self-recursion
+				LogComponentWarn(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't handle query via DuckDB:", queryStatement+"\n"+err.Error())
+				err := queryHandler.StreamQuery(ctx, FALLBACK_SQL_QUERY, sendMessages) // self-recursion
 				if err != nil {
-					return nil, err
+					return err
 				}
-				queriesMessages = append(queriesMessages, queriesMsgs...)
 				continue
 			} else {
-				LogError(queryHandler.config, "Couldn't handle query via DuckDB:", queryStatement+"\n"+err.Error())
-				return nil, err
+				LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't handle query via DuckDB:", queryStatement+"\n"+err.Error())
+				return duckdbPgError(err)
 			}
 		}
 		defer rows.Close()
 
-		var queryMessages []pgproto3.Message
 		descriptionMessages, err := queryHandler.rowsToDescriptionMessages(rows, queryStatement)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		queryMessages = append(queryMessages, descriptionMessages...)
-		dataMessages, err := queryHandler.rowsToDataMessages(rows, originalQueryStatements[i])
+		err = sendMessages(descriptionMessages)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		statementRowCount, _, err := queryHandler.streamDataMessages(rows, originalQueryStatements[i], settings.TimeZone, 0, sendMessages)
+		returnedRowCount += statementRowCount
+		if err != nil {
+			if isQueryCanceled(ctx, err) {
+				LogComponentWarn(queryHandler.config, LOG_COMPONENT_QUERY, "Canceled query:", queryStatement)
+				return queryCanceledError(ctx, err)
+			}
+			return err
+		}
+		if timeZone != nil {
+			settings.TimeZone = timeZone
+		}
+		if isAsOfSet {
+			settings.AsOf = asOf
+		}
+		if isNessieRefSet {
+			settings.NessieRef = nessieRef
 		}
-		queryMessages = append(queryMessages, dataMessages...)
-
-		queriesMessages = append(queriesMessages, queryMessages...)
 	}
 
-	return queriesMessages, nil
+	return nil
 }
 
-func (queryHandler *QueryHandler) HandleParseQuery(message *pgproto3.Parse) ([]pgproto3.Message, *PreparedStatement, error) {
-	ctx := context.Background()
+func (queryHandler *QueryHandler) HandleParseQuery(ctx context.Context, message *pgproto3.Parse) ([]pgproto3.Message, *PreparedStatement, error) {
 	originalQuery := string(message.Query)
-	queryStatements, _, err := queryHandler.parseAndRemapQuery(originalQuery)
+	queryStatements, _, err := queryHandler.parseAndRemapQuery(ctx, originalQuery)
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't map query:", originalQuery+"\n"+err.Error())
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't map query:", originalQuery+"\n"+err.Error())
 		return nil, nil, err
 	}
 	if len(queryStatements) > 1 {
@@ -275,8 +523,8 @@ func (queryHandler *QueryHandler) HandleParseQuery(message *pgproto3.Parse) ([]p
 	statement, err := queryHandler.duckdb.PrepareContext(ctx, query)
 	preparedStatement.Statement = statement
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't prepare query via DuckDB:", query+"\n"+err.Error())
-		return nil, nil, err
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't prepare query via DuckDB:", query+"\n"+err.Error())
+		return nil, nil, duckdbPgError(err)
 	}
 
 	return []pgproto3.Message{&pgproto3.ParseComplete{}}, preparedStatement, nil
@@ -284,7 +532,7 @@ func (queryHandler *QueryHandler) HandleParseQuery(message *pgproto3.Parse) ([]p
 
 func (queryHandler *QueryHandler) HandleBindQuery(message *pgproto3.Bind, preparedStatement *PreparedStatement) ([]pgproto3.Message, *PreparedStatement, error) {
 	if message.PreparedStatement != preparedStatement.Name {
-		LogError(queryHandler.config, "Prepared statement mismatch:", message.PreparedStatement, "instead of", preparedStatement.Name)
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Prepared statement mismatch:", message.PreparedStatement, "instead of", preparedStatement.Name)
 		return nil, nil, errors.New("prepared statement mismatch")
 	}
 
@@ -312,7 +560,7 @@ func (queryHandler *QueryHandler) HandleBindQuery(message *pgproto3.Bind, prepar
 		}
 	}
 
-	LogDebug(queryHandler.config, "Bound variables:", variables)
+	LogComponentDebug(queryHandler.config, LOG_COMPONENT_QUERY, "Bound variables:", variables)
 	preparedStatement.Variables = variables
 	preparedStatement.Portal = message.DestinationPortal
 
@@ -321,16 +569,16 @@ func (queryHandler *QueryHandler) HandleBindQuery(message *pgproto3.Bind, prepar
 	return messages, preparedStatement, nil
 }
 
-func (queryHandler *QueryHandler) HandleDescribeQuery(message *pgproto3.Describe, preparedStatement *PreparedStatement) ([]pgproto3.Message, *PreparedStatement, error) {
+func (queryHandler *QueryHandler) HandleDescribeQuery(ctx context.Context, message *pgproto3.Describe, preparedStatement *PreparedStatement) ([]pgproto3.Message, *PreparedStatement, error) {
 	switch message.ObjectType {
 	case 'S': // Statement
 		if message.Name != preparedStatement.Name {
-			LogError(queryHandler.config, "Statement mismatch:", message.Name, "instead of", preparedStatement.Name)
+			LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Statement mismatch:", message.Name, "instead of", preparedStatement.Name)
 			return nil, nil, errors.New("statement mismatch")
 		}
 	case 'P': // Portal
 		if message.Name != preparedStatement.Portal {
-			LogError(queryHandler.config, "Portal mismatch:", message.Name, "instead of", preparedStatement.Portal)
+			LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Portal mismatch:", message.Name, "instead of", preparedStatement.Portal)
 			return nil, nil, errors.New("portal mismatch")
 		}
 	}
@@ -343,12 +591,19 @@ func (queryHandler *QueryHandler) HandleDescribeQuery(message *pgproto3.Describe
 		return []pgproto3.Message{&pgproto3.NoData{}}, preparedStatement, nil
 	}
 
-	rows, err := preparedStatement.Statement.QueryContext(context.Background(), preparedStatement.Variables...)
+	// The rows are read on Execute, which releases the query context
+	queryCtx, cancel := queryHandler.queryContext(ctx)
+	rows, err := queryHandler.queryPreparedStatement(queryCtx, preparedStatement)
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
-		return nil, nil, err
+		cancel()
+		if isQueryCanceled(queryCtx, err) {
+			return nil, nil, queryCanceledError(queryCtx, err)
+		}
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
+		return nil, nil, duckdbPgError(err)
 	}
 	preparedStatement.Rows = rows
+	preparedStatement.CancelRows = cancel
 
 	messages, err := queryHandler.rowsToDescriptionMessages(preparedStatement.Rows, preparedStatement.Query)
 	if err != nil {
@@ -357,28 +612,281 @@ func (queryHandler *QueryHandler) HandleDescribeQuery(message *pgproto3.Describe
 	return messages, preparedStatement, nil
 }
 
-func (queryHandler *QueryHandler) HandleExecuteQuery(message *pgproto3.Execute, preparedStatement *PreparedStatement) ([]pgproto3.Message, error) {
+func (queryHandler *QueryHandler) HandleExecuteQuery(ctx context.Context, message *pgproto3.Execute, preparedStatement *PreparedStatement) (messages []pgproto3.Message, err error) {
+	err = queryHandler.StreamExecuteQuery(ctx, message, preparedStatement, func(batchMessages []pgproto3.Message) error {
+		messages = append(messages, batchMessages...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Sends the rows in batches as they are read. With the row limit of Execute, stops with PortalSuspended after reaching it
+// and keeps the rows open, so that the next Execute of the portal continues from the next row
+func (queryHandler *QueryHandler) StreamExecuteQuery(ctx context.Context, message *pgproto3.Execute, preparedStatement *PreparedStatement, sendMessages func([]pgproto3.Message) error) (err error) {
+	ctx, span := StartSpan(ctx, "QueryHandler.HandleExecuteQuery", queryTextSpanAttribute(preparedStatement.OriginalQuery))
+	returnedRowCount := 0
+	defer func() { EndQuerySpan(span, returnedRowCount, err) }()
+
 	if message.Portal != preparedStatement.Portal {
-		LogError(queryHandler.config, "Portal mismatch:", message.Portal, "instead of", preparedStatement.Portal)
-		return nil, errors.New("portal mismatch")
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Portal mismatch:", message.Portal, "instead of", preparedStatement.Portal)
+		return errors.New("portal mismatch")
 	}
 
 	if preparedStatement.Query == "" {
-		return []pgproto3.Message{&pgproto3.EmptyQueryResponse{}}, nil
+		return sendMessages([]pgproto3.Message{&pgproto3.EmptyQueryResponse{}})
+	}
+
+	settings := PgSessionSettingsFromContext(ctx)
+	timeZone, err := parsePgSetTimeZone(preparedStatement.OriginalQuery)
+	if err != nil {
+		return err
+	}
+	asOf, isAsOfSet, err := parsePgSetAsOf(preparedStatement.OriginalQuery, settings.TimeZone)
+	if err != nil {
+		return err
+	}
+	nessieRef, isNessieRefSet, err := parsePgSetNessieRef(preparedStatement.OriginalQuery)
+	if err != nil {
+		return err
+	}
+
+	if !preparedStatement.IsSuspended {
+		sleepCtx, cancelSleep := queryHandler.queryContext(ctx)
+		err = waitPgSleep(sleepCtx, preparedStatement.OriginalQuery)
+		cancelSleep()
+		if err != nil {
+			return err
+		}
 	}
 
 	if preparedStatement.Rows == nil { // If Describe step didn't have Bind step before
-		rows, err := preparedStatement.Statement.QueryContext(context.Background(), preparedStatement.Variables...)
+		queryCtx, cancel := queryHandler.queryContext(ctx)
+		rows, err := queryHandler.queryPreparedStatement(queryCtx, preparedStatement)
 		if err != nil {
-			LogError(queryHandler.config, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
-			return nil, err
+			cancel()
+			if isQueryCanceled(queryCtx, err) {
+				return queryCanceledError(queryCtx, err)
+			}
+			LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
+			return duckdbPgError(err)
 		}
 		preparedStatement.Rows = rows
+		preparedStatement.CancelRows = cancel
 	}
 
-	defer preparedStatement.Rows.Close()
+	returnedRowCount, preparedStatement.IsSuspended, err = queryHandler.streamDataMessages(preparedStatement.Rows, preparedStatement.OriginalQuery, settings.TimeZone, message.MaxRows, sendMessages)
+	if err != nil || !preparedStatement.IsSuspended {
+		preparedStatement.CloseRows()
+	}
+	if err != nil && isQueryCanceled(ctx, err) {
+		return queryCanceledError(ctx, err)
+	}
+	if err == nil && timeZone != nil {
+		settings.TimeZone = timeZone
+	}
+	if err == nil && isAsOfSet {
+		settings.AsOf = asOf
+	}
+	if err == nil && isNessieRefSet {
+		settings.NessieRef = nessieRef
+	}
+	return err
+}
 
-	return queryHandler.rowsToDataMessages(preparedStatement.Rows, preparedStatement.OriginalQuery)
+// Returns the columns of the table loaded with COPY ... FROM STDIN before the client starts sending data.
+// Columns are the ones recorded on sync, and the statement lists all of them if it doesn't list any
+func (queryHandler *QueryHandler) HandleCopyFromStdinColumns(copyStatement *PgCopyStatement) ([]PgSchemaColumn, error) {
+	if queryHandler.config.ReadOnly {
+		return nil, readOnlyError("COPY FROM")
+	}
+
+	icebergSchemaTables, err := queryHandler.icebergReader.SchemaTables()
+	if err != nil {
+		return nil, err
+	}
+	if !icebergSchemaTables.Contains(copyStatement.SchemaTable) {
+		return nil, &pgconn.PgError{Severity: "ERROR", Code: PG_UNDEFINED_TABLE_CODE, Message: `relation "` + copyStatement.SchemaTable.Table + `" does not exist`}
+	}
+
+	properties, err := queryHandler.icebergReader.TableProperties(copyStatement.SchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	pgSchemaColumnsJson, ok := properties[ICEBERG_PROPERTY_PG_SCHEMA_COLUMNS]
+	if !ok {
+		return nil, pgCopyNotSupportedError(`COPY to table "` + copyStatement.SchemaTable.Table + `" requires syncing it again with this version of BemiDB`)
+	}
+	icebergSchemaFields, err := queryHandler.icebergReader.SchemaFields(copyStatement.SchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(icebergSchemaFields, IsTextUuidIcebergField) {
+		return nil, pgCopyNotSupportedError(`COPY to table "` + copyStatement.SchemaTable.Table + `" requires syncing it again with this version of BemiDB`)
+	}
+	var pgSchemaColumns []PgSchemaColumn
+	err = json.Unmarshal([]byte(pgSchemaColumnsJson), &pgSchemaColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(copyStatement.ColumnNames) == 0 {
+		for _, pgSchemaColumn := range pgSchemaColumns {
+			copyStatement.ColumnNames = append(copyStatement.ColumnNames, pgSchemaColumn.ColumnName)
+		}
+		return pgSchemaColumns, nil
+	}
+
+	columnNames := make(Set[string])
+	for _, columnName := range copyStatement.ColumnNames {
+		if columnNames.Contains(columnName) {
+			return nil, &pgconn.PgError{Severity: "ERROR", Code: PG_DUPLICATE_COLUMN_CODE, Message: `column "` + columnName + `" specified more than once`}
+		}
+		if !slices.ContainsFunc(pgSchemaColumns, func(pgSchemaColumn PgSchemaColumn) bool { return pgSchemaColumn.ColumnName == columnName }) {
+			return nil, &pgconn.PgError{Severity: "ERROR", Code: PG_UNDEFINED_COLUMN_CODE, Message: `column "` + columnName + `" of relation "` + copyStatement.SchemaTable.Table + `" does not exist`}
+		}
+		columnNames.Add(columnName)
+	}
+	return pgSchemaColumns, nil
+}
+
+// Appends the rows sent with COPY ... FROM STDIN to the Iceberg table as new data files.
+// Values are checked before writing, so an invalid row fails the whole COPY with its line number and nothing is committed
+func (queryHandler *QueryHandler) HandleCopyFromStdin(ctx context.Context, copyStatement *PgCopyStatement, pgSchemaColumns []PgSchemaColumn, reader io.Reader) (rowCount int64, err error) {
+	ctx, cancel := queryHandler.queryContext(ctx)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	columnIndexes := make([]int, len(copyStatement.ColumnNames))
+	for i, columnName := range copyStatement.ColumnNames {
+		columnIndexes[i] = slices.IndexFunc(pgSchemaColumns, func(pgSchemaColumn PgSchemaColumn) bool { return pgSchemaColumn.ColumnName == columnName })
+	}
+
+	copyReader := NewPgCopyReader(reader, copyStatement)
+	parquetFiles, err := NewIcebergWriter(queryHandler.config).Append(ctx, copyStatement.SchemaTable, pgSchemaColumns, func() ([][]string, error) {
+		var rows [][]string
+		for len(rows) < PG_COPY_BATCH_SIZE {
+			if ctx.Err() != nil {
+				return nil, queryCanceledError(ctx, ctx.Err())
+			}
+
+			values, err := copyReader.ReadRow()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			row, err := pgCopyRow(copyStatement, pgSchemaColumns, columnIndexes, values, copyReader.LineNumber)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, parquetFile := range parquetFiles {
+		rowCount += parquetFile.RecordCount
+	}
+	return rowCount, nil
+}
+
+// Places the copied values at the positions of their columns and fills the other columns with NULL.
+// Each value is formatted like it will be written to report invalid values instead of failing to write the Parquet file
+func pgCopyRow(copyStatement *PgCopyStatement, pgSchemaColumns []PgSchemaColumn, columnIndexes []int, values []string, lineNumber int) ([]string, error) {
+	if len(values) > len(columnIndexes) {
+		return nil, pgCopyFormatError(lineNumber, "extra data after last expected column")
+	}
+	if len(values) < len(columnIndexes) {
+		return nil, pgCopyFormatError(lineNumber, `missing data for column "`+copyStatement.ColumnNames[len(values)]+`"`)
+	}
+
+	row := make([]string, len(pgSchemaColumns))
+	for i := range row {
+		row[i] = PG_NULL_STRING
+	}
+	where := fmt.Sprintf("COPY %s, line %d", copyStatement.SchemaTable.Table, lineNumber)
+	for i, value := range values {
+		// Rejected like in Postgres, also keeps unescaped values from matching PG_NULL_STRING
+		if value != PG_NULL_STRING && strings.IndexByte(value, 0) != -1 {
+			return nil, &pgconn.PgError{Severity: "ERROR", Code: PG_CHARACTER_NOT_IN_REPERTOIRE_CODE, Message: `invalid byte sequence for encoding "UTF8": 0x00`, Where: where}
+		}
+		row[columnIndexes[i]] = value
+	}
+
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		if row[i] == PG_NULL_STRING {
+			if pgSchemaColumn.IsNullable != PG_TRUE {
+				return nil, &pgconn.PgError{Severity: "ERROR", Code: PG_NOT_NULL_VIOLATION_CODE, Message: `null value in column "` + pgSchemaColumn.ColumnName + `" of relation "` + copyStatement.SchemaTable.Table + `" violates not-null constraint`, Where: where}
+			}
+			continue
+		}
+
+		err := formatPgCopyValue(&pgSchemaColumn, row[i])
+		if err != nil {
+			return nil, &pgconn.PgError{Severity: "ERROR", Code: PG_INVALID_TEXT_REPRESENTATION_CODE, Message: `invalid input for column "` + pgSchemaColumn.ColumnName + `": ` + err.Error(), Where: where}
+		}
+	}
+	return row, nil
+}
+
+func formatPgCopyValue(pgSchemaColumn *PgSchemaColumn, value string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	pgSchemaColumn.FormatParquetValue(value)
+	return nil
+}
+
+// Applies the query timeout, if configured
+func (queryHandler *QueryHandler) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryHandler.config.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, queryHandler.config.QueryTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func isQueryCanceled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func queryCanceledError(ctx context.Context, err error) error {
+	message := "canceling statement due to user request"
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		message = "canceling statement due to statement timeout"
+	}
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_QUERY_CANCELED_CODE, Message: message}
+}
+
+// A statement prepared on a DuckDB database that broke is prepared again, which reopens the database if needed
+func (queryHandler *QueryHandler) queryPreparedStatement(ctx context.Context, preparedStatement *PreparedStatement) (*sql.Rows, error) {
+	rows, err := preparedStatement.Statement.QueryContext(ctx, preparedStatement.Variables...)
+	if !IsDuckdbConnectionBroken(err) || ctx.Err() != nil {
+		return rows, err
+	}
+
+	statement, err := queryHandler.duckdb.PrepareContext(ctx, preparedStatement.Query)
+	if err != nil {
+		return nil, err
+	}
+	preparedStatement.Statement.Close()
+	preparedStatement.Statement = statement
+	return statement.QueryContext(ctx, preparedStatement.Variables...)
 }
 
 func (queryHandler *QueryHandler) createSchemas() {
@@ -389,8 +897,8 @@ func (queryHandler *QueryHandler) createSchemas() {
 	for _, schema := range schemas {
 		_, err := queryHandler.duckdb.ExecContext(
 			ctx,
-			"CREATE SCHEMA IF NOT EXISTS \"$schema\"",
-			map[string]string{"schema": schema},
+			"CREATE SCHEMA IF NOT EXISTS "+QuoteIdentifier(schema),
+			nil,
 		)
 		PanicIfError(err)
 	}
@@ -399,12 +907,22 @@ func (queryHandler *QueryHandler) createSchemas() {
 func (queryHandler *QueryHandler) rowsToDescriptionMessages(rows *sql.Rows, query string) ([]pgproto3.Message, error) {
 	cols, err := rows.ColumnTypes()
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't get column types", query+"\n"+err.Error())
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't get column types", query+"\n"+err.Error())
 		return nil, err
 	}
 
 	var messages []pgproto3.Message
 
+	if isExplainQuery(query) {
+		rowDescription := &pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{
+			Name:         []byte(EXPLAIN_COLUMN_NAME),
+			DataTypeOID:  pgtype.TextOID,
+			DataTypeSize: -1,
+			TypeModifier: -1,
+		}}}
+		return append(messages, rowDescription), nil
+	}
+
 	rowDescription := queryHandler.generateRowDescription(cols)
 	if rowDescription != nil {
 		messages = append(messages, rowDescription)
@@ -413,21 +931,49 @@ func (queryHandler *QueryHandler) rowsToDescriptionMessages(rows *sql.Rows, quer
 	return messages, nil
 }
 
-func (queryHandler *QueryHandler) rowsToDataMessages(rows *sql.Rows, originalQueryStatement string) ([]pgproto3.Message, error) {
+// Sends DataRow messages in batches of QUERY_RESULT_BATCH_SIZE rows as they are read, followed by CommandComplete.
+// With a positive maxRows, stops after reading that many rows and sends PortalSuspended instead.
+// timestamptz values are returned in the session time zone like in PostgreSQL
+func (queryHandler *QueryHandler) streamDataMessages(rows *sql.Rows, originalQueryStatement string, timeZone *time.Location, maxRows uint32, sendMessages func([]pgproto3.Message) error) (returnedRowCount int, suspended bool, err error) {
 	cols, err := rows.ColumnTypes()
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't get column types", originalQueryStatement+"\n"+err.Error())
-		return nil, err
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't get column types", originalQueryStatement+"\n"+err.Error())
+		return 0, false, err
 	}
 
-	var messages []pgproto3.Message
-	for rows.Next() {
-		dataRow, err := queryHandler.generateDataRow(rows, cols)
+	if isExplainQuery(originalQueryStatement) {
+		messages, err := queryHandler.explainRowsToDataMessages(rows, originalQueryStatement)
 		if err != nil {
-			LogError(queryHandler.config, "Couldn't get data row", originalQueryStatement+"\n"+err.Error())
-			return nil, err
+			return 0, false, err
+		}
+		return len(messages) - 1, false, sendMessages(messages)
+	}
+
+	messages := make([]pgproto3.Message, 0, QUERY_RESULT_BATCH_SIZE)
+	for (maxRows == 0 || returnedRowCount < int(maxRows)) && rows.Next() {
+		dataRow, err := queryHandler.generateDataRow(rows, cols, timeZone)
+		if err != nil {
+			LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't get data row", originalQueryStatement+"\n"+err.Error())
+			return returnedRowCount, false, err
 		}
 		messages = append(messages, dataRow)
+		returnedRowCount++
+
+		if len(messages) == QUERY_RESULT_BATCH_SIZE {
+			err = sendMessages(messages)
+			if err != nil {
+				return returnedRowCount, false, err
+			}
+			messages = messages[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't get data row", originalQueryStatement+"\n"+err.Error())
+		return returnedRowCount, false, duckdbPgError(err)
+	}
+
+	if maxRows > 0 && returnedRowCount == int(maxRows) {
+		return returnedRowCount, true, sendMessages(append(messages, &pgproto3.PortalSuspended{}))
 	}
 
 	commandTag := FALLBACK_SQL_QUERY
@@ -440,19 +986,328 @@ func (queryHandler *QueryHandler) rowsToDataMessages(rows *sql.Rows, originalQue
 		commandTag = "DISCARD ALL"
 	}
 
-	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte(commandTag)})
+	return returnedRowCount, false, sendMessages(append(messages, &pgproto3.CommandComplete{CommandTag: []byte(commandTag)}))
+}
+
+// DuckDB returns (explain_key, explain_value) rows with multi-line plans, PostgreSQL returns a single "QUERY PLAN" column with a row per line
+func (queryHandler *QueryHandler) explainRowsToDataMessages(rows *sql.Rows, originalQueryStatement string) ([]pgproto3.Message, error) {
+	var messages []pgproto3.Message
+	for rows.Next() {
+		var explainKey, explainValue string
+		err := rows.Scan(&explainKey, &explainValue)
+		if err != nil {
+			LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't get explain row", originalQueryStatement+"\n"+err.Error())
+			return nil, err
+		}
+
+		for _, line := range strings.Split(strings.TrimRight(explainValue, "\n"), "\n") {
+			messages = append(messages, &pgproto3.DataRow{Values: [][]byte{[]byte(line)}})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Couldn't get explain row", originalQueryStatement+"\n"+err.Error())
+		return nil, duckdbPgError(err)
+	}
+
+	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte("EXPLAIN")})
 	return messages, nil
 }
 
-func (queryHandler *QueryHandler) parseAndRemapQuery(query string) ([]string, []string, error) {
+// DuckDB doesn't have pg_sleep(), which is remapped to an empty value, so the query waits for the total duration
+// of pg_sleep(seconds) calls with constant arguments in the SELECT list. The wait is canceled like a running query
+func waitPgSleep(ctx context.Context, query string) error {
+	duration := parsePgSleepDuration(query)
+	if duration <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return queryCanceledError(ctx, ctx.Err())
+	}
+}
+
+func parsePgSleepDuration(query string) time.Duration {
+	if !strings.Contains(strings.ToLower(query), PG_FUNCTION_PG_SLEEP) {
+		return 0
+	}
+
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil || len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetSelectStmt() == nil {
+		return 0
+	}
+
+	var seconds float64
+	for _, targetNode := range queryTree.Stmts[0].Stmt.GetSelectStmt().TargetList {
+		functionCall := targetNode.GetResTarget().Val.GetFuncCall()
+		if functionCall == nil || len(functionCall.Args) != 1 || functionCall.Args[0].GetAConst() == nil {
+			continue
+		}
+		functionName := functionCall.Funcname[len(functionCall.Funcname)-1].GetString_().Sval
+		if functionName != PG_FUNCTION_PG_SLEEP || (len(functionCall.Funcname) > 1 && functionCall.Funcname[0].GetString_().Sval != PG_SCHEMA_PG_CATALOG) {
+			continue
+		}
+
+		aConst := functionCall.Args[0].GetAConst()
+		switch {
+		case aConst.GetIval() != nil:
+			seconds += float64(aConst.GetIval().Ival)
+		case aConst.GetFval() != nil:
+			value, err := strconv.ParseFloat(aConst.GetFval().Fval, 64)
+			if err == nil {
+				seconds += value
+			}
+		case aConst.GetSval() != nil:
+			value, err := strconv.ParseFloat(strings.TrimSpace(aConst.GetSval().Sval), 64)
+			if err == nil {
+				seconds += value
+			}
+		}
+	}
+	return time.Duration(max(seconds, 0) * float64(time.Second))
+}
+
+// Returns the time zone set with "SET timezone ...", "SET TIME ZONE ...", or "RESET timezone", nil for other queries
+func parsePgSetTimeZone(query string) (*time.Location, error) {
+	upperQuery := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(upperQuery, "SET ") && !strings.HasPrefix(upperQuery, "RESET ") {
+		return nil, nil
+	}
+
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return nil, nil
+	}
+	setStatement := queryTree.Stmts[0].Stmt.GetVariableSetStmt()
+	if setStatement == nil {
+		return nil, nil
+	}
+
+	switch {
+	case setStatement.Kind == pgQuery.VariableSetKind_VAR_RESET_ALL:
+		return time.UTC, nil
+	case strings.ToLower(setStatement.Name) != "timezone":
+		return nil, nil
+	case setStatement.Kind == pgQuery.VariableSetKind_VAR_SET_DEFAULT || setStatement.Kind == pgQuery.VariableSetKind_VAR_RESET:
+		return time.UTC, nil
+	case setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE || len(setStatement.Args) != 1 || setStatement.Args[0].GetAConst() == nil:
+		return nil, nil
+	}
+
+	aConst := setStatement.Args[0].GetAConst()
+	switch {
+	case aConst.GetSval() != nil:
+		return loadPgTimeZone(aConst.GetSval().Sval)
+	case aConst.GetIval() != nil:
+		// Like in PostgreSQL, a number is an offset in hours east of UTC
+		return time.FixedZone("", int(aConst.GetIval().Ival)*3600), nil
+	case aConst.GetFval() != nil:
+		hours, err := strconv.ParseFloat(aConst.GetFval().Fval, 64)
+		if err != nil {
+			return nil, invalidPgTimeZoneError(aConst.GetFval().Fval)
+		}
+		return time.FixedZone("", int(hours*3600)), nil
+	}
+	return nil, nil
+}
+
+func loadPgTimeZone(name string) (*time.Location, error) {
+	if strings.EqualFold(name, "UTC") || strings.EqualFold(name, "GMT") {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, invalidPgTimeZoneError(name)
+	}
+	return location, nil
+}
+
+func invalidPgTimeZoneError(value string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_INVALID_PARAMETER_VALUE_CODE, Message: `invalid value for parameter "TimeZone": "` + value + `"`}
+}
+
+// Returns the time set with "SET bemidb.as_of ...", nil for "RESET bemidb.as_of" and "RESET ALL", and whether the query changes it
+func parsePgSetAsOf(query string, timeZone *time.Location) (asOf *time.Time, isSet bool, err error) {
+	upperQuery := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(upperQuery, "SET ") && !strings.HasPrefix(upperQuery, "RESET ") {
+		return nil, false, nil
+	}
+
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil || len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetVariableSetStmt() == nil {
+		return nil, false, nil
+	}
+	return pgSetAsOf(queryTree.Stmts[0].Stmt.GetVariableSetStmt(), timeZone)
+}
+
+// Times without a UTC offset are in the session time zone like timestamptz values in PostgreSQL
+func pgSetAsOf(setStatement *pgQuery.VariableSetStmt, timeZone *time.Location) (asOf *time.Time, isSet bool, err error) {
+	switch {
+	case setStatement.Kind == pgQuery.VariableSetKind_VAR_RESET_ALL:
+		return nil, true, nil
+	case strings.ToLower(setStatement.Name) != PG_SETTING_AS_OF:
+		return nil, false, nil
+	case setStatement.Kind == pgQuery.VariableSetKind_VAR_SET_DEFAULT || setStatement.Kind == pgQuery.VariableSetKind_VAR_RESET:
+		return nil, true, nil
+	case setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE || len(setStatement.Args) != 1:
+		return nil, false, nil
+	case setStatement.Args[0].GetAConst().GetSval() == nil:
+		aConst := setStatement.Args[0].GetAConst()
+		switch {
+		case aConst.GetIval() != nil:
+			return nil, false, invalidPgAsOfError(IntToString(int(aConst.GetIval().Ival)))
+		case aConst.GetFval() != nil:
+			return nil, false, invalidPgAsOfError(aConst.GetFval().Fval)
+		}
+		return nil, false, invalidPgAsOfError("")
+	}
+
+	value := setStatement.Args[0].GetAConst().GetSval().Sval
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z07"} {
+		parsedTime, err := time.Parse(layout, value)
+		if err == nil {
+			return &parsedTime, true, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		parsedTime, err := time.ParseInLocation(layout, value, timeZone)
+		if err == nil {
+			return &parsedTime, true, nil
+		}
+	}
+	return nil, false, invalidPgAsOfError(value)
+}
+
+func invalidPgAsOfError(value string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_INVALID_PARAMETER_VALUE_CODE, Message: `invalid value for parameter "` + PG_SETTING_AS_OF + `": "` + value + `"`}
+}
+
+// Returns the reference set with "SET bemidb.nessie_ref ...", "" for "RESET bemidb.nessie_ref" and "RESET ALL", and whether the query changes it
+func parsePgSetNessieRef(query string) (nessieRef string, isSet bool, err error) {
+	upperQuery := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(upperQuery, "SET ") && !strings.HasPrefix(upperQuery, "RESET ") {
+		return "", false, nil
+	}
+
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil || len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetVariableSetStmt() == nil {
+		return "", false, nil
+	}
+	return pgSetNessieRef(queryTree.Stmts[0].Stmt.GetVariableSetStmt())
+}
+
+// Accepts branch and tag names, optionally with a commit hash after "@", e.g., SET bemidb.nessie_ref = 'main@2e1cfa82'
+func pgSetNessieRef(setStatement *pgQuery.VariableSetStmt) (nessieRef string, isSet bool, err error) {
+	switch {
+	case setStatement.Kind == pgQuery.VariableSetKind_VAR_RESET_ALL:
+		return "", true, nil
+	case strings.ToLower(setStatement.Name) != PG_SETTING_NESSIE_REF:
+		return "", false, nil
+	case setStatement.Kind == pgQuery.VariableSetKind_VAR_SET_DEFAULT || setStatement.Kind == pgQuery.VariableSetKind_VAR_RESET:
+		return "", true, nil
+	case setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE || len(setStatement.Args) != 1:
+		return "", false, nil
+	case setStatement.Args[0].GetAConst().GetSval() == nil:
+		return "", false, invalidPgNessieRefError("")
+	}
+
+	value := setStatement.Args[0].GetAConst().GetSval().Sval
+	if value == "" || strings.HasPrefix(value, "@") || strings.ContainsAny(value, " \t\n") {
+		return "", false, invalidPgNessieRefError(value)
+	}
+	return value, true, nil
+}
+
+func invalidPgNessieRefError(value string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_INVALID_PARAMETER_VALUE_CODE, Message: `invalid value for parameter "` + PG_SETTING_NESSIE_REF + `": "` + value + `"`}
+}
+
+func isExplainQuery(query string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "EXPLAIN")
+}
+
+// Allows reading statements and statements that only change session settings: SELECT and EXPLAIN SELECT without
+// data-modifying CTEs or INTO, SHOW, SET, RESET, and DISCARD
+func readOnlyStatementError(node *pgQuery.Node) error {
+	switch {
+	case node == nil:
+		return nil
+	case node.GetSelectStmt() != nil:
+		return readOnlySelectStatementError(node.GetSelectStmt())
+	case node.GetExplainStmt() != nil:
+		return readOnlyStatementError(node.GetExplainStmt().Query)
+	case node.GetVariableShowStmt() != nil, node.GetVariableSetStmt() != nil, node.GetDiscardStmt() != nil:
+		return nil
+	case node.GetInsertStmt() != nil:
+		return readOnlyError("INSERT")
+	case node.GetUpdateStmt() != nil:
+		return readOnlyError("UPDATE")
+	case node.GetDeleteStmt() != nil:
+		return readOnlyError("DELETE")
+	case node.GetMergeStmt() != nil:
+		return readOnlyError("MERGE")
+	}
+
+	command := "this statement"
+	statement, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: node}}})
+	if err == nil && statement != "" {
+		command = strings.Fields(statement)[0]
+	}
+	return readOnlyError(command)
+}
+
+func readOnlySelectStatementError(selectStatement *pgQuery.SelectStmt) error {
+	if selectStatement.IntoClause != nil {
+		return readOnlyError("SELECT INTO")
+	}
+	if selectStatement.WithClause != nil {
+		for _, cte := range selectStatement.WithClause.Ctes {
+			err := readOnlyStatementError(cte.GetCommonTableExpr().Ctequery)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if selectStatement.Larg != nil {
+		err := readOnlySelectStatementError(selectStatement.Larg)
+		if err != nil {
+			return err
+		}
+	}
+	if selectStatement.Rarg != nil {
+		return readOnlySelectStatementError(selectStatement.Rarg)
+	}
+	return nil
+}
+
+func readOnlyError(command string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: PG_READ_ONLY_SQL_TRANSACTION_CODE, Message: "cannot execute " + command + " in read-only mode"}
+}
+
+func (queryHandler *QueryHandler) parseAndRemapQuery(ctx context.Context, query string) ([]string, []string, error) {
 	queryTree, err := pgQuery.Parse(query)
 	if err != nil {
-		LogError(queryHandler.config, "Error parsing query:", query+"\n"+err.Error())
+		LogComponentError(queryHandler.config, LOG_COMPONENT_QUERY, "Error parsing query:", query+"\n"+err.Error())
 		return nil, nil, err
 	}
 
 	if strings.HasSuffix(query, INSPECT_SQL_COMMENT) {
-		LogDebug(queryHandler.config, queryTree.Stmts)
+		LogComponentDebug(queryHandler.config, LOG_COMPONENT_QUERY, queryTree.Stmts)
+	}
+
+	if queryHandler.config.ReadOnly {
+		for _, stmt := range queryTree.Stmts {
+			err := readOnlyStatementError(stmt.Stmt)
+			if err != nil {
+				LogComponentWarn(queryHandler.config, LOG_COMPONENT_QUERY, "Rejected query in read-only mode:", query)
+				return nil, nil, err
+			}
+		}
 	}
 
 	var originalQueryStatements []string
@@ -464,7 +1319,7 @@ func (queryHandler *QueryHandler) parseAndRemapQuery(query string) ([]string, []
 		originalQueryStatements = append(originalQueryStatements, originalQueryStatement)
 	}
 
-	remappedStatements, err := queryHandler.queryRemapper.RemapStatements(queryTree.Stmts)
+	remappedStatements, err := queryHandler.queryRemapper.RemapStatements(queryTree.Stmts, PgSessionSettingsFromContext(ctx))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -563,10 +1418,20 @@ func (queryHandler *QueryHandler) columnTypeOid(col *sql.ColumnType) uint32 {
 		return pgtype.TimestampOID
 	case "TIMESTAMP[]":
 		return pgtype.TimestampArrayOID
-	case "BLOB":
+	case "TIMESTAMPTZ":
+		return pgtype.TimestamptzOID
+	case "TIMESTAMPTZ[]":
+		return pgtype.TimestamptzArrayOID
+	case "INTERVAL":
+		return pgtype.IntervalOID
+	case "UUID":
 		return pgtype.UUIDOID
-	case "BLOB[]":
+	case "UUID[]":
 		return pgtype.UUIDArrayOID
+	case "BLOB":
+		return pgtype.ByteaOID
+	case "BLOB[]":
+		return pgtype.ByteaArrayOID
 	default:
 		if strings.HasPrefix(col.DatabaseTypeName(), "DECIMAL") {
 			if strings.HasSuffix(col.DatabaseTypeName(), "[]") {
@@ -595,7 +1460,7 @@ func isSystemTableOidColumn(colName string) bool {
 	return oidColumns[colName]
 }
 
-func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.ColumnType) (*pgproto3.DataRow, error) {
+func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.ColumnType, timeZone *time.Location) (*pgproto3.DataRow, error) {
 	valuePtrs := make([]interface{}, len(cols))
 	for i, col := range cols {
 		switch col.ScanType().String() {
@@ -617,9 +1482,21 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 		case "float64", "float32":
 			var value sql.NullFloat64
 			valuePtrs[i] = &value
-		case "string", "[]uint8": // []uint8 is for uuid
+		case "string":
 			var value sql.NullString
 			valuePtrs[i] = &value
+		case "[]uint8":
+			switch col.DatabaseTypeName() {
+			case "BLOB":
+				var value NullBytea
+				valuePtrs[i] = &value
+			case "UUID":
+				var value NullUuid
+				valuePtrs[i] = &value
+			default:
+				var value sql.NullString
+				valuePtrs[i] = &value
+			}
 		case "bool":
 			var value sql.NullBool
 			valuePtrs[i] = &value
@@ -632,8 +1509,11 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 		case "duckdb.Decimal":
 			var value NullDecimal
 			valuePtrs[i] = &value
+		case "duckdb.Interval":
+			var value NullInterval
+			valuePtrs[i] = &value
 		case "[]interface {}":
-			var value NullArray
+			value := NullArray{TypeName: col.DatabaseTypeName(), TimeZone: timeZone}
 			valuePtrs[i] = &value
 		default:
 			panic("Unsupported queried type: " + col.ScanType().String())
@@ -680,7 +1560,7 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 			}
 		case *sql.NullFloat64:
 			if value.Valid {
-				values = append(values, []byte(fmt.Sprintf("%v", value.Float64)))
+				values = append(values, []byte(FloatToPgString(value.Float64)))
 			} else {
 				values = append(values, nil)
 			}
@@ -700,11 +1580,13 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 			if value.Valid {
 				switch cols[i].DatabaseTypeName() {
 				case "DATE":
-					values = append(values, []byte(value.Time.Format("2006-01-02")))
+					values = append(values, []byte(TimeToPgDateString(value.Time, "")))
 				case "TIME":
 					values = append(values, []byte(value.Time.Format("15:04:05.999999")))
 				case "TIMESTAMP":
-					values = append(values, []byte(value.Time.Format("2006-01-02 15:04:05.999999")))
+					values = append(values, []byte(TimeToPgDateString(value.Time, " 15:04:05.999999")))
+				case "TIMESTAMPTZ":
+					values = append(values, []byte(TimeToPgTimestamptzOutputString(value.Time, timeZone)))
 				default:
 					panic("Unsupported type: " + cols[i].DatabaseTypeName())
 				}
@@ -723,6 +1605,24 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 			} else {
 				values = append(values, nil)
 			}
+		case *NullInterval:
+			if value.Present {
+				values = append(values, []byte(value.String()))
+			} else {
+				values = append(values, nil)
+			}
+		case *NullBytea:
+			if value.Present {
+				values = append(values, []byte(value.String()))
+			} else {
+				values = append(values, nil)
+			}
+		case *NullUuid:
+			if value.Present {
+				values = append(values, []byte(value.String()))
+			} else {
+				values = append(values, nil)
+			}
 		case *NullArray:
 			if value.Present {
 				values = append(values, []byte(value.String()))
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/jackc/pgx/v5/pgtype"
+	duckDb "github.com/marcboeker/go-duckdb"
 )
 
 func TestHandleQuery(t *testing.T) {
@@ -72,6 +81,21 @@ func TestHandleQuery(t *testing.T) {
 			"types":       {Uint32ToString(pgtype.TextOID)},
 			"values":      {"0"},
 		},
+		"SELECT current_database()": {
+			"description": {"current_database"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {"bemidb"},
+		},
+		"SELECT current_schema()": {
+			"description": {"current_schema"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {"public"},
+		},
+		"SELECT pg_sleep(0.01)": {
+			"description": {"pg_sleep"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {""},
+		},
 		"SELECT * from pg_is_in_recovery()": {
 			"description": {"pg_is_in_recovery"},
 			"types":       {Uint32ToString(pgtype.BoolOID)},
@@ -253,6 +277,11 @@ func TestHandleQuery(t *testing.T) {
 			"description": {"indnullsnotdistinct"},
 			"types":       {Uint32ToString(pgtype.BoolOID)},
 		},
+		"SELECT conname, contype, conkey FROM pg_constraint WHERE conrelid = '\"public\".\"test_table\"'::regclass": {
+			"description": {"conname", "contype", "conkey"},
+			"types":       {Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.Int8ArrayOID)},
+			"values":      {},
+		},
 
 		// Information schema
 		"SELECT * FROM information_schema.tables WHERE table_schema = 'public'": {
@@ -517,23 +546,23 @@ func TestHandleQuery(t *testing.T) {
 		},
 		"SELECT timestamptz_column FROM public.test_table WHERE bool_column = TRUE": {
 			"description": {"timestamptz_column"},
-			"types":       {Uint32ToString(pgtype.TimestampOID)},
-			"values":      {"2024-01-01 17:00:00.123456"},
+			"types":       {Uint32ToString(pgtype.TimestamptzOID)},
+			"values":      {"2024-01-01 17:00:00.123456+00"},
 		},
 		"SELECT timestamptz_column FROM public.test_table WHERE bool_column = FALSE": {
 			"description": {"timestamptz_column"},
-			"types":       {Uint32ToString(pgtype.TimestampOID)},
-			"values":      {"2024-01-01 07:00:00.000123"},
+			"types":       {Uint32ToString(pgtype.TimestamptzOID)},
+			"values":      {"2024-01-01 07:00:00.000123+00"},
 		},
 		"SELECT timestamptz_ms_column FROM public.test_table WHERE bool_column = TRUE": {
 			"description": {"timestamptz_ms_column"},
-			"types":       {Uint32ToString(pgtype.TimestampOID)},
-			"values":      {"2024-01-01 17:00:00.123"},
+			"types":       {Uint32ToString(pgtype.TimestamptzOID)},
+			"values":      {"2024-01-01 17:00:00.123+00"},
 		},
 		"SELECT timestamptz_ms_column FROM public.test_table WHERE bool_column = FALSE": {
 			"description": {"timestamptz_ms_column"},
-			"types":       {Uint32ToString(pgtype.TimestampOID)},
-			"values":      {"2024-01-01 07:00:00.12"},
+			"types":       {Uint32ToString(pgtype.TimestamptzOID)},
+			"values":      {"2024-01-01 07:00:00.12+00"},
 		},
 		"SELECT uuid_column FROM public.test_table WHERE uuid_column = '58a7c845-af77-44b2-8664-7ca613d92f04'": {
 			"description": {"uuid_column"},
@@ -547,14 +576,19 @@ func TestHandleQuery(t *testing.T) {
 		},
 		"SELECT bytea_column FROM public.test_table WHERE bytea_column IS NOT NULL": {
 			"description": {"bytea_column"},
-			"types":       {Uint32ToString(pgtype.TextOID)},
+			"types":       {Uint32ToString(pgtype.ByteaOID)},
 			"values":      {"\\x1234"},
 		},
 		"SELECT bytea_column FROM public.test_table WHERE bytea_column IS NULL": {
 			"description": {"bytea_column"},
-			"types":       {Uint32ToString(pgtype.TextOID)},
+			"types":       {Uint32ToString(pgtype.ByteaOID)},
 			"values":      {""},
 		},
+		"SELECT octet_length(bytea_column) AS octet_length FROM public.test_table WHERE bytea_column IS NOT NULL": {
+			"description": {"octet_length"},
+			"types":       {Uint32ToString(pgtype.Int8OID)},
+			"values":      {"2"},
+		},
 		"SELECT interval_column FROM public.test_table WHERE interval_column IS NOT NULL": {
 			"description": {"interval_column"},
 			"types":       {Uint32ToString(pgtype.TextOID)},
@@ -575,6 +609,16 @@ func TestHandleQuery(t *testing.T) {
 			"types":       {Uint32ToString(pgtype.TextOID)},
 			"values":      {""},
 		},
+		"SELECT json_column->>'key' AS key FROM public.test_table WHERE json_column IS NOT NULL": {
+			"description": {"key"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {"value"},
+		},
+		"SELECT json_extract_path_text(jsonb_column, 'key') AS key FROM public.test_table WHERE jsonb_column->>'key' IS NOT NULL": {
+			"description": {"key"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {"value"},
+		},
 		"SELECT jsonb_column FROM public.test_table WHERE bool_column = TRUE": {
 			"description": {"jsonb_column"},
 			"types":       {Uint32ToString(pgtype.TextOID)},
@@ -640,6 +684,16 @@ func TestHandleQuery(t *testing.T) {
 			"types":       {Uint32ToString(pgtype.TextOID)},
 			"values":      {""},
 		},
+		"SELECT inet_column FROM public.test_table WHERE inet_column = '192.168.0.1/32'::inet": {
+			"description": {"inet_column"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {"192.168.0.1"},
+		},
+		"SELECT inet_column FROM public.test_table WHERE inet_column::inet = CAST('192.168.0.1' AS inet)": {
+			"description": {"inet_column"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {"192.168.0.1"},
+		},
 		"SELECT array_text_column FROM public.test_table WHERE array_text_column IS NOT NULL": {
 			"description": {"array_text_column"},
 			"types":       {Uint32ToString(pgtype.TextArrayOID)},
@@ -697,6 +751,16 @@ func TestHandleQuery(t *testing.T) {
 			"types":       {Uint32ToString(pgtype.Int8OID)},
 			"values":      {"40"},
 		},
+		"SELECT atttypmod FROM pg_attribute WHERE attrelid = '\"public\".\"test_table\"'::regclass AND attname = 'bpchar_column'": {
+			"description": {"atttypmod"},
+			"types":       {Uint32ToString(pgtype.Int4OID)},
+			"values":      {"14"},
+		},
+		"SELECT atttypmod FROM pg_attribute WHERE attrelid = '\"public\".\"test_table\"'::regclass AND attname = 'text_column'": {
+			"description": {"atttypmod"},
+			"types":       {Uint32ToString(pgtype.Int4OID)},
+			"values":      {"-1"},
+		},
 		"SELECT objoid, classoid, objsubid, description FROM pg_description WHERE classoid = 'pg_class'::regclass": {
 			"description": {"objoid", "classoid", "objsubid", "description"},
 			"types":       {Uint32ToString(pgtype.OIDOID), Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.Int4OID), Uint32ToString(pgtype.TextOID)},
@@ -946,7 +1010,7 @@ func TestHandleQuery(t *testing.T) {
 		t.Run(query, func(t *testing.T) {
 			queryHandler := initQueryHandler()
 
-			messages, err := queryHandler.HandleQuery(query)
+			messages, err := queryHandler.HandleQuery(context.Background(), query)
 
 			testNoError(t, err)
 			testRowDescription(t, messages[0], responses["description"], responses["types"])
@@ -971,7 +1035,7 @@ func TestHandleQuery(t *testing.T) {
 	t.Run("Returns an error if a table does not exist", func(t *testing.T) {
 		queryHandler := initQueryHandler()
 
-		_, err := queryHandler.HandleQuery("SELECT * FROM non_existent_table")
+		_, err := queryHandler.HandleQuery(context.Background(), "SELECT * FROM non_existent_table")
 
 		if err == nil {
 			t.Errorf("Expected an error, got nil")
@@ -983,15 +1047,22 @@ func TestHandleQuery(t *testing.T) {
 			"LINE 1: SELECT * FROM non_existent_table",
 			"                      ^",
 		}, "\n")
-		if err.Error() != expectedErrorMessage {
-			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err.Error())
+		var pgError *pgconn.PgError
+		if !errors.As(err, &pgError) || pgError.Code != "42P01" || pgError.Message != `relation "non_existent_table" does not exist` {
+			t.Errorf("Expected an undefined_table error, got %v", err)
+		}
+		if pgError.Detail != expectedErrorMessage {
+			t.Errorf("Expected the detail to be '"+expectedErrorMessage+"', got %v", pgError.Detail)
+		}
+		if pgError.Hint != `Did you mean "test_table"?` {
+			t.Errorf("Expected the hint to be 'Did you mean \"test_table\"?', got %v", pgError.Hint)
 		}
 	})
 
 	t.Run("Returns a result without a row description for SET queries", func(t *testing.T) {
 		queryHandler := initQueryHandler()
 
-		messages, err := queryHandler.HandleQuery("SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
+		messages, err := queryHandler.HandleQuery(context.Background(), "SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1002,9 +1073,9 @@ func TestHandleQuery(t *testing.T) {
 
 	t.Run("Allows setting and querying timezone", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		queryHandler.HandleQuery("SET timezone = 'UTC'")
+		queryHandler.HandleQuery(context.Background(), "SET timezone = 'UTC'")
 
-		messages, err := queryHandler.HandleQuery("SHOW timezone")
+		messages, err := queryHandler.HandleQuery(context.Background(), "SHOW timezone")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1017,16 +1088,237 @@ func TestHandleQuery(t *testing.T) {
 		testCommandCompleteTag(t, messages[2], "SHOW")
 	})
 
+	t.Run("Keeps the timezone after DuckDB is reopened", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.HandleQuery(context.Background(), "SET timezone = 'America/New_York'")
+		queryHandler.duckdb.db.Close()
+
+		messages, err := queryHandler.HandleQuery(context.Background(), "SHOW timezone")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[1], []string{"America/New_York"})
+	})
+
+	t.Run("Returns timestamptz values in the session time zone", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		ctx := ContextWithPgSessionSettings(context.Background(), NewPgSessionSettings())
+		_, err := queryHandler.HandleQuery(ctx, "SET TIME ZONE 'America/New_York'")
+		testNoError(t, err)
+
+		messages, err := queryHandler.HandleQuery(ctx, "SELECT timestamptz_column FROM public.test_table WHERE bool_column = TRUE")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"timestamptz_column"}, []string{Uint32ToString(pgtype.TimestamptzOID)})
+		testDataRowValues(t, messages[1], []string{"2024-01-01 12:00:00.123456-05"})
+	})
+
+	t.Run("Returns an error for an invalid time zone", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		ctx := ContextWithPgSessionSettings(context.Background(), NewPgSessionSettings())
+
+		_, err := queryHandler.HandleQuery(ctx, "SET timezone = 'Mars/Olympus_Mons'")
+
+		var pgError *pgconn.PgError
+		if !errors.As(err, &pgError) || pgError.Code != "22023" || pgError.Message != `invalid value for parameter "TimeZone": "Mars/Olympus_Mons"` {
+			t.Errorf("Expected an invalid_parameter_value error, got %v", err)
+		}
+		if PgSessionSettingsFromContext(ctx).TimeZone != time.UTC {
+			t.Errorf("Expected the session time zone to stay UTC, got %v", PgSessionSettingsFromContext(ctx).TimeZone)
+		}
+	})
+
+	t.Run("Reads Iceberg tables as of the time set with bemidb.as_of", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		ctx := ContextWithPgSessionSettings(context.Background(), NewPgSessionSettings())
+		_, err := queryHandler.HandleQuery(ctx, "SET bemidb.as_of = '"+time.Now().Format(time.RFC3339Nano)+"'")
+		testNoError(t, err)
+		if PgSessionSettingsFromContext(ctx).AsOf == nil {
+			t.Fatalf("Expected the session to have the as_of time set")
+		}
+
+		queryStatements, _, err := queryHandler.parseAndRemapQuery(ctx, "SELECT bool_column FROM public.test_table")
+
+		testNoError(t, err)
+		if !strings.Contains(queryStatements[0], "snapshot_from_id = ") {
+			t.Errorf("Expected the table to be read from a snapshot, got %s", queryStatements[0])
+		}
+
+		_, err = queryHandler.HandleQuery(ctx, "RESET bemidb.as_of")
+		testNoError(t, err)
+		queryStatements, _, err = queryHandler.parseAndRemapQuery(ctx, "SELECT bool_column FROM public.test_table")
+		testNoError(t, err)
+		if strings.Contains(queryStatements[0], "snapshot_from_id") {
+			t.Errorf("Expected the table to be read from the current snapshot, got %s", queryStatements[0])
+		}
+	})
+
+	t.Run("Returns an error for a bemidb.as_of time before the table existed", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		ctx := ContextWithPgSessionSettings(context.Background(), NewPgSessionSettings())
+
+		_, err := queryHandler.HandleQuery(ctx, "SET bemidb.as_of = '2000-01-01T00:00:00Z'; SELECT bool_column FROM public.test_table")
+
+		var pgError *pgconn.PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_UNDEFINED_TABLE_CODE || pgError.Message != `relation "test_table" has no snapshot as of 2000-01-01T00:00:00Z` {
+			t.Errorf("Expected an undefined_table error, got %v", err)
+		}
+		if !strings.HasPrefix(pgError.Detail, "The history of the table starts at ") || pgError.Hint == "" {
+			t.Errorf("Expected the error to point to the start of the table history, got %q and %q", pgError.Detail, pgError.Hint)
+		}
+	})
+
 	t.Run("Handles an empty query", func(t *testing.T) {
 		queryHandler := initQueryHandler()
 
-		messages, err := queryHandler.HandleQuery("-- ping")
+		messages, err := queryHandler.HandleQuery(context.Background(), "-- ping")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
 			&pgproto3.EmptyQueryResponse{},
 		})
 	})
+
+	t.Run("Returns a query_canceled error when the query times out", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.QueryTimeout = 10 * time.Millisecond
+		defer func() { queryHandler.config.QueryTimeout = 0 }()
+
+		_, err := queryHandler.HandleQuery(context.Background(), "SELECT COUNT(*) FROM range(10000000000) a, range(10) b")
+
+		testQueryCanceledError(t, err, "canceling statement due to statement timeout")
+	})
+
+	t.Run("Returns a query_canceled error when the query is canceled", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		_, err := queryHandler.HandleQuery(ctx, "SELECT COUNT(*) FROM range(10000000000) a, range(10) b")
+
+		testQueryCanceledError(t, err, "canceling statement due to user request")
+	})
+
+	t.Run("Returns active sessions from pg_stat_activity", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		sessionRegistry := queryHandler.queryRemapper.remapperTable.sessionRegistry
+		postgres := &Postgres{config: queryHandler.config, sessionRegistry: sessionRegistry}
+		postgres.session.Database = "bemidb"
+		postgres.session.User = "bemidb"
+		postgres.session.ClientAddr = "127.0.0.1"
+		postgres.session.ClientPort = 54321
+		postgres.session.BackendStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		sessionRegistry.Register(postgres)
+		defer sessionRegistry.Unregister(postgres)
+		query := "SELECT pid, datname, usename, host(client_addr), client_port, backend_start, state, query FROM pg_stat_activity"
+		_, finishQuery := postgres.startQuery(query)
+		defer finishQuery()
+
+		messages, err := queryHandler.HandleQuery(context.Background(), query)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[1], []string{
+			Uint32ToString(postgres.processId), "bemidb", "bemidb", "127.0.0.1", "54321", "2024-01-01 00:00:00", "active", query,
+		})
+	})
+
+	t.Run("Returns a query plan for EXPLAIN queries", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := queryHandler.HandleQuery(context.Background(), "EXPLAIN SELECT id FROM public.test_table")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"QUERY PLAN"}, []string{Uint32ToString(pgtype.TextOID)})
+		testCommandCompleteTag(t, messages[len(messages)-1], "EXPLAIN")
+		plan := explainPlan(t, messages)
+		if !strings.Contains(plan, "ICEBERG_SCAN") && !strings.Contains(plan, "PARQUET_SCAN") && !strings.Contains(plan, "READ_PARQUET") {
+			t.Errorf("Expected the plan to scan the Iceberg table, got %v", plan)
+		}
+	})
+
+	t.Run("Executes EXPLAIN ANALYZE queries and returns timings", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := queryHandler.HandleQuery(context.Background(), "EXPLAIN (ANALYZE, FORMAT JSON) SELECT id FROM public.test_table")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"QUERY PLAN"}, []string{Uint32ToString(pgtype.TextOID)})
+		testCommandCompleteTag(t, messages[len(messages)-1], "EXPLAIN")
+		plan := explainPlan(t, messages)
+		if !strings.Contains(plan, "Total Time") {
+			t.Errorf("Expected the plan to contain timings, got %v", plan)
+		}
+	})
+
+	t.Run("Allows reading queries in read-only mode", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.ReadOnly = true
+		defer func() { queryHandler.config.ReadOnly = false }()
+
+		for _, query := range []string{
+			"/* dashboard */ -- refresh\nSELECT id FROM public.test_table WHERE id = 1",
+			"WITH ids AS (SELECT id FROM public.test_table) SELECT id FROM ids WHERE id = 1",
+			"EXPLAIN SELECT id FROM public.test_table",
+			"SHOW timezone",
+			"SET timezone = 'UTC'",
+		} {
+			t.Run(query, func(t *testing.T) {
+				_, err := queryHandler.HandleQuery(context.Background(), query)
+
+				testNoError(t, err)
+			})
+		}
+	})
+
+	t.Run("Rejects writing queries in read-only mode", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.ReadOnly = true
+		defer func() { queryHandler.config.ReadOnly = false }()
+
+		for query, expectedMessage := range map[string]string{
+			"INSERT INTO public.test_table (id) VALUES (3)":                                       "cannot execute INSERT in read-only mode",
+			"/* cleanup */ DELETE FROM public.test_table":                                         "cannot execute DELETE in read-only mode",
+			"WITH ids AS (SELECT id FROM public.test_table) DELETE FROM public.test_table":        "cannot execute DELETE in read-only mode",
+			"WITH deleted AS (DELETE FROM public.test_table RETURNING id) SELECT id FROM deleted": "cannot execute DELETE in read-only mode",
+			"EXPLAIN ANALYZE UPDATE public.test_table SET id = 3":                                 "cannot execute UPDATE in read-only mode",
+			"SELECT id INTO copied_table FROM public.test_table":                                  "cannot execute SELECT INTO in read-only mode",
+			"CREATE TABLE new_table (id int)":                                                     "cannot execute CREATE in read-only mode",
+			"SELECT 1; DROP TABLE public.test_table":                                              "cannot execute DROP in read-only mode",
+		} {
+			t.Run(query, func(t *testing.T) {
+				_, err := queryHandler.HandleQuery(context.Background(), query)
+
+				var pgError *pgconn.PgError
+				if !errors.As(err, &pgError) || pgError.Code != "25006" || pgError.Message != expectedMessage {
+					t.Errorf("Expected a read_only_sql_transaction error '%s', got %v", expectedMessage, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Rejects COPY FROM STDIN in read-only mode", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.ReadOnly = true
+		defer func() { queryHandler.config.ReadOnly = false }()
+		copyStatement, err := ParsePgCopyFromStdin("COPY public.test_table (id) FROM STDIN")
+		testNoError(t, err)
+
+		_, err = queryHandler.HandleCopyFromStdinColumns(copyStatement)
+
+		var pgError *pgconn.PgError
+		if !errors.As(err, &pgError) || pgError.Code != "25006" || pgError.Message != "cannot execute COPY FROM in read-only mode" {
+			t.Errorf("Expected a read_only_sql_transaction error, got %v", err)
+		}
+	})
 }
 
 func TestHandleParseQuery(t *testing.T) {
@@ -1035,7 +1327,7 @@ func TestHandleParseQuery(t *testing.T) {
 		queryHandler := initQueryHandler()
 		message := &pgproto3.Parse{Query: query}
 
-		messages, preparedStatement, err := queryHandler.HandleParseQuery(message)
+		messages, preparedStatement, err := queryHandler.HandleParseQuery(context.Background(), message)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1057,7 +1349,7 @@ func TestHandleBindQuery(t *testing.T) {
 		queryHandler := initQueryHandler()
 		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
 		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		_, preparedStatement, err := queryHandler.HandleParseQuery(context.Background(), parseMessage)
 		testNoError(t, err)
 
 		bindMessage := &pgproto3.Bind{
@@ -1082,7 +1374,7 @@ func TestHandleBindQuery(t *testing.T) {
 		queryHandler := initQueryHandler()
 		query := "SELECT c.oid FROM pg_catalog.pg_class c WHERE c.relnamespace = $1"
 		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		_, preparedStatement, err := queryHandler.HandleParseQuery(context.Background(), parseMessage)
 		testNoError(t, err)
 
 		paramValue := int64(2200)
@@ -1113,12 +1405,12 @@ func TestHandleDescribeQuery(t *testing.T) {
 		queryHandler := initQueryHandler()
 		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
 		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(context.Background(), parseMessage)
 		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
 		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
 		message := &pgproto3.Describe{ObjectType: 'P'}
 
-		messages, preparedStatement, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		messages, preparedStatement, err := queryHandler.HandleDescribeQuery(context.Background(), message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1133,12 +1425,12 @@ func TestHandleDescribeQuery(t *testing.T) {
 	t.Run("Handles DESCRIBE extended query step if query is empty", func(t *testing.T) {
 		queryHandler := initQueryHandler()
 		parseMessage := &pgproto3.Parse{Query: ""}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(context.Background(), parseMessage)
 		bindMessage := &pgproto3.Bind{}
 		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
 		message := &pgproto3.Describe{ObjectType: 'P'}
 
-		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		messages, _, err := queryHandler.HandleDescribeQuery(context.Background(), message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1150,10 +1442,10 @@ func TestHandleDescribeQuery(t *testing.T) {
 		queryHandler := initQueryHandler()
 		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
 		parseMessage := &pgproto3.Parse{Query: query, ParameterOIDs: []uint32{pgtype.TextOID}}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(context.Background(), parseMessage)
 		message := &pgproto3.Describe{ObjectType: 'S'}
 
-		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		messages, _, err := queryHandler.HandleDescribeQuery(context.Background(), message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1167,14 +1459,14 @@ func TestHandleExecuteQuery(t *testing.T) {
 		queryHandler := initQueryHandler()
 		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
 		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(context.Background(), parseMessage)
 		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
 		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
 		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
-		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
+		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(context.Background(), describeMessage, preparedStatement)
 		message := &pgproto3.Execute{}
 
-		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+		messages, err := queryHandler.HandleExecuteQuery(context.Background(), message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1184,17 +1476,70 @@ func TestHandleExecuteQuery(t *testing.T) {
 		testDataRowValues(t, messages[0], []string{"bemidb", "bemidb-encrypted"})
 	})
 
+	t.Run("Prepares the statement again after DuckDB is reopened", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(context.Background(), parseMessage)
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		queryHandler.duckdb.db.Close()
+		message := &pgproto3.Execute{}
+
+		messages, err := queryHandler.HandleExecuteQuery(context.Background(), message, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[0], []string{"bemidb", "bemidb-encrypted"})
+	})
+
+	t.Run("Suspends the portal at the row limit of EXECUTE and continues from the next row", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		parseMessage := &pgproto3.Parse{Query: "SELECT i FROM range(5) t(i)"}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(context.Background(), parseMessage)
+		bindMessage := &pgproto3.Bind{}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
+		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(context.Background(), describeMessage, preparedStatement)
+		message := &pgproto3.Execute{MaxRows: 3}
+
+		firstMessages, err := queryHandler.HandleExecuteQuery(context.Background(), message, preparedStatement)
+		testNoError(t, err)
+		secondMessages, err := queryHandler.HandleExecuteQuery(context.Background(), message, preparedStatement)
+		testNoError(t, err)
+
+		testMessageTypes(t, firstMessages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.PortalSuspended{},
+		})
+		testDataRowValues(t, firstMessages[0], []string{"0"})
+		testMessageTypes(t, secondMessages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, secondMessages[0], []string{"3"})
+		if preparedStatement.IsSuspended {
+			t.Errorf("Expected the portal not to be suspended after reading all rows")
+		}
+	})
+
 	t.Run("Handles EXECUTE extended query step if query is empty", func(t *testing.T) {
 		queryHandler := initQueryHandler()
 		parseMessage := &pgproto3.Parse{Query: ""}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(context.Background(), parseMessage)
 		bindMessage := &pgproto3.Bind{}
 		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
 		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
-		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
+		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(context.Background(), describeMessage, preparedStatement)
 		message := &pgproto3.Execute{}
 
-		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+		messages, err := queryHandler.HandleExecuteQuery(context.Background(), message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1203,6 +1548,66 @@ func TestHandleExecuteQuery(t *testing.T) {
 	})
 }
 
+func TestStreamQuery(t *testing.T) {
+	t.Run("streams a million-row result in batches without holding it in memory", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		runtime.GC()
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		initialHeapAlloc := memStats.HeapAlloc
+		var maxHeapAllocGrowth uint64
+		rowCount := 0
+		batchCount := 0
+
+		err := queryHandler.StreamQuery(context.Background(), "SELECT i, 'row ' || i::VARCHAR FROM range(1000000) t(i)", func(messages []pgproto3.Message) error {
+			for _, message := range messages {
+				if _, ok := message.(*pgproto3.DataRow); ok {
+					rowCount++
+				}
+			}
+			if len(messages) > QUERY_RESULT_BATCH_SIZE+1 {
+				t.Errorf("Expected at most %d messages per batch, got %d", QUERY_RESULT_BATCH_SIZE+1, len(messages))
+			}
+			batchCount++
+			if batchCount%100 == 0 {
+				runtime.GC()
+				runtime.ReadMemStats(&memStats)
+				if memStats.HeapAlloc > initialHeapAlloc {
+					maxHeapAllocGrowth = max(maxHeapAllocGrowth, memStats.HeapAlloc-initialHeapAlloc)
+				}
+			}
+			return nil
+		})
+
+		testNoError(t, err)
+		if rowCount != 1000000 {
+			t.Errorf("Expected 1000000 rows, got %d", rowCount)
+		}
+		if maxHeapAllocGrowth > 32*1024*1024 {
+			t.Errorf("Expected the heap to grow by less than 32 MB, got %d bytes", maxHeapAllocGrowth)
+		}
+	})
+
+	t.Run("sends the results of previous statements before an error", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		var messages []pgproto3.Message
+
+		err := queryHandler.StreamQuery(context.Background(), "SELECT 1; SELECT * FROM non_existent_table", func(batchMessages []pgproto3.Message) error {
+			messages = append(messages, batchMessages...)
+			return nil
+		})
+
+		if err == nil {
+			t.Errorf("Expected an error for the second statement")
+		}
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+	})
+}
+
 func TestHandleMultipleQueries(t *testing.T) {
 	t.Run("Handles multiple SET statements", func(t *testing.T) {
 		query := `SET client_encoding TO 'UTF8';
@@ -1210,7 +1615,7 @@ SET client_min_messages TO 'warning';
 SET standard_conforming_strings = on;`
 		queryHandler := initQueryHandler()
 
-		messages, err := queryHandler.HandleQuery(query)
+		messages, err := queryHandler.HandleQuery(context.Background(), query)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1228,7 +1633,7 @@ SET standard_conforming_strings = on;`
 SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
 		queryHandler := initQueryHandler()
 
-		messages, err := queryHandler.HandleQuery(query)
+		messages, err := queryHandler.HandleQuery(context.Background(), query)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1247,7 +1652,7 @@ SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
 SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
 		queryHandler := initQueryHandler()
 
-		messages, err := queryHandler.HandleQuery(query)
+		messages, err := queryHandler.HandleQuery(context.Background(), query)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1270,7 +1675,7 @@ SELECT * FROM non_existent_table;
 SET standard_conforming_strings = on;`
 		queryHandler := initQueryHandler()
 
-		_, err := queryHandler.HandleQuery(query)
+		_, err := queryHandler.HandleQuery(context.Background(), query)
 
 		if err == nil {
 			t.Error("Expected an error for non-existent table, got nil")
@@ -1283,11 +1688,396 @@ SET standard_conforming_strings = on;`
 	})
 }
 
+func TestHandleConcurrentQueries(t *testing.T) {
+	t.Run("Reads either all previous or all new rows while the table is rewritten", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_concurrent_queries", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+		pgSchemaColumns := []PgSchemaColumn{
+			{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog"},
+		}
+		writeRows := func(rowCount int) {
+			loaded := false
+			icebergWriter.Write(context.Background(), schemaTable, pgSchemaColumns, func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				rows := make([][]string, rowCount)
+				for i := range rows {
+					rows[i] = []string{IntToString(i + 1)}
+				}
+				return rows
+			})
+		}
+		writeRows(10)
+		queryHandler := initQueryHandler()
+
+		done := make(chan struct{})
+		var writers sync.WaitGroup
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for i := 0; i < 50; i++ {
+				writeRows(10 * (2 - i%2))
+			}
+			close(done)
+		}()
+		defer writers.Wait() // before the schema is deleted
+
+		var readers sync.WaitGroup
+		for reader := 0; reader < 4; reader++ {
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for reading := true; reading; {
+					select {
+					case <-done:
+						reading = false
+					default:
+					}
+
+					messages, err := queryHandler.HandleQuery(context.Background(), "SELECT COUNT(*) AS count FROM test_concurrent_queries.test_table")
+					if err != nil {
+						t.Errorf("Expected no error, got %v", err)
+						return
+					}
+					count := string(messages[1].(*pgproto3.DataRow).Values[0])
+					if count != "10" && count != "20" {
+						t.Errorf("Expected 10 or 20 rows, got %s", count)
+						return
+					}
+				}
+			}()
+		}
+		readers.Wait()
+	})
+}
+
+func TestNullInterval(t *testing.T) {
+	t.Run("formats intervals like PostgreSQL", func(t *testing.T) {
+		for expected, interval := range map[string]duckDb.Interval{
+			"00:00:00":                             {},
+			"1 year 2 mons 3 days 04:05:06.5":      {Months: 14, Days: 3, Micros: 14706500000},
+			"-1 years -2 mons +3 days -04:05:06.5": {Months: -14, Days: 3, Micros: -14706500000},
+			"1 mon":                                {Months: 1},
+			"-1 days +100:00:00.000001":            {Days: -1, Micros: 360000000001},
+		} {
+			nullInterval := NullInterval{Present: true, Value: interval}
+
+			if nullInterval.String() != expected {
+				t.Errorf("Expected %v to be formatted as %s, got %s", interval, expected, nullInterval.String())
+			}
+		}
+	})
+}
+
+func TestNullBytea(t *testing.T) {
+	t.Run("formats bytes in the bytea hex format", func(t *testing.T) {
+		for expected, value := range map[string][]byte{
+			"\\x":       {},
+			"\\x00ff10": {0x00, 0xff, 0x10},
+		} {
+			nullBytea := NullBytea{Present: true, Value: value}
+
+			if nullBytea.String() != expected {
+				t.Errorf("Expected %v to be formatted as %s, got %s", value, expected, nullBytea.String())
+			}
+		}
+	})
+
+	t.Run("formats arrays of bytes and uuids", func(t *testing.T) {
+		byteaArray := NullArray{Present: true, TypeName: "BLOB[]", Value: []interface{}{[]uint8{0x01, 0x02}, []uint8{}}}
+		uuidArray := NullArray{Present: true, TypeName: "UUID[]", Value: []interface{}{[]uint8{0x58, 0xa7, 0xc8, 0x45, 0xaf, 0x77, 0x44, 0xb2, 0x86, 0x64, 0x7c, 0xa6, 0x13, 0xd9, 0x2f, 0x04}}}
+
+		if byteaArray.String() != "{\\\\x0102,\\\\x}" {
+			t.Errorf("Expected bytea array to be formatted with escaped backslashes, got %s", byteaArray.String())
+		}
+		if uuidArray.String() != "{58a7c845-af77-44b2-8664-7ca613d92f04}" {
+			t.Errorf("Expected uuid array to be formatted as strings, got %s", uuidArray.String())
+		}
+	})
+}
+
+func TestNullDecimal(t *testing.T) {
+	t.Run("formats decimals exactly without trailing zeros", func(t *testing.T) {
+		for expected, value := range map[string]duckDb.Decimal{
+			"12345.67":                               {Width: 38, Scale: 18, Value: mustParseBigInt("12345670000000000000000")},
+			"-12345":                                 {Width: 10, Scale: 2, Value: big.NewInt(-1234500)},
+			"0":                                      {Width: 10, Scale: 2, Value: big.NewInt(0)},
+			"12345678901234567890123456789012345678": {Width: 38, Scale: 0, Value: mustParseBigInt("12345678901234567890123456789012345678")},
+			"0.000000000000000001":                   {Width: 38, Scale: 18, Value: big.NewInt(1)},
+		} {
+			nullDecimal := NullDecimal{Present: true, Value: value}
+
+			if nullDecimal.String() != expected {
+				t.Errorf("Expected %v to be formatted as %s, got %s", value, expected, nullDecimal.String())
+			}
+		}
+	})
+}
+
+func TestNullArray(t *testing.T) {
+	t.Run("formats arrays like PostgreSQL", func(t *testing.T) {
+		newYork, _ := time.LoadLocation("America/New_York")
+
+		for expected, nullArray := range map[string]NullArray{
+			"{1,NULL,3}":                                    {Present: true, TypeName: "INTEGER[]", Value: []interface{}{int32(1), nil, int32(3)}},
+			`{"NULL",NULL,"","a b","c,d","e\"f"}`:           {Present: true, TypeName: "VARCHAR[]", Value: []interface{}{"NULL", nil, "", "a b", "c,d", `e"f`}},
+			"{1.5,NULL,-2.25}":                              {Present: true, TypeName: "DECIMAL(10,2)[]", Value: []interface{}{duckDb.Decimal{Width: 10, Scale: 2, Value: big.NewInt(150)}, nil, duckDb.Decimal{Width: 10, Scale: 2, Value: big.NewInt(-225)}}},
+			"{NaN,Infinity,1.5}":                            {Present: true, TypeName: "DOUBLE[]", Value: []interface{}{math.NaN(), math.Inf(1), 1.5}},
+			`{"2024-01-01 07:00:00.123456-05"}`:             {Present: true, TypeName: "TIMESTAMPTZ[]", TimeZone: newYork, Value: []interface{}{time.Date(2024, 1, 1, 12, 0, 0, 123456000, time.UTC)}},
+			`{"2024-01-01 12:00:00","2024-01-02 00:00:00"}`: {Present: true, TypeName: "TIMESTAMP[]", Value: []interface{}{time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}},
+			"{}": {Present: true, TypeName: "INTEGER[]", Value: []interface{}{}},
+			"":   {Present: false, TypeName: "INTEGER[]"},
+		} {
+			if nullArray.String() != expected {
+				t.Errorf("Expected %v to be formatted as %s, got %s", nullArray.Value, expected, nullArray.String())
+			}
+		}
+	})
+}
+
+func TestTimeToPgDateString(t *testing.T) {
+	t.Run("formats BC and large years like PostgreSQL", func(t *testing.T) {
+		for expected, value := range map[string]time.Time{
+			"2024-01-01 12:00:00.5":        time.Date(2024, 1, 1, 12, 0, 0, 500000000, time.UTC),
+			"0044-03-15 12:00:00 BC":       time.Date(-43, 3, 15, 12, 0, 0, 0, time.UTC),
+			"0001-01-01 00:00:00 BC":       time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC),
+			"294247-01-10 04:00:54.775806": time.UnixMicro(PARQUET_MAX_TIMESTAMP_MICROS).UTC(),
+			"290309-12-22 00:00:00 BC":     time.UnixMicro(PARQUET_MIN_TIMESTAMP_MICROS).UTC(),
+		} {
+			if formatted := TimeToPgDateString(value, " 15:04:05.999999"); formatted != expected {
+				t.Errorf("Expected %v to be formatted as %s, got %s", value, expected, formatted)
+			}
+		}
+		if formatted := TimeToPgDateString(time.Date(-43, 3, 15, 0, 0, 0, 0, time.UTC), ""); formatted != "0044-03-15 BC" {
+			t.Errorf("Expected a BC date to be formatted as 0044-03-15 BC, got %s", formatted)
+		}
+	})
+}
+
+func TestFloatToPgString(t *testing.T) {
+	t.Run("formats NaN and infinities like PostgreSQL", func(t *testing.T) {
+		for expected, value := range map[string]float64{
+			"NaN":       math.NaN(),
+			"Infinity":  math.Inf(1),
+			"-Infinity": math.Inf(-1),
+			"3.14":      3.14,
+			"-2.5":      -2.5,
+		} {
+			if formatted := FloatToPgString(value); formatted != expected {
+				t.Errorf("Expected %v to be formatted as %s, got %s", value, expected, formatted)
+			}
+		}
+	})
+}
+
+func TestTimeToPgTimestamptzOutputString(t *testing.T) {
+	t.Run("formats instants in the time zone like PostgreSQL", func(t *testing.T) {
+		newYork, _ := time.LoadLocation("America/New_York")
+		instant := time.Date(2024, 1, 1, 12, 0, 0, 123456000, time.UTC)
+
+		for expected, location := range map[string]*time.Location{
+			"2024-01-01 12:00:00.123456+00":       time.UTC,
+			"2024-01-01 07:00:00.123456-05":       newYork,
+			"2024-01-01 17:30:00.123456+05:30":    time.FixedZone("", 5*3600+30*60),
+			"2024-01-01 07:03:57.123456-04:56:03": time.FixedZone("", -(4*3600 + 56*60 + 3)),
+		} {
+			if formatted := TimeToPgTimestamptzOutputString(instant, location); formatted != expected {
+				t.Errorf("Expected %v in %v to be formatted as %s, got %s", instant, location, expected, formatted)
+			}
+		}
+		if formatted := TimeToPgTimestamptzOutputString(time.Date(-43, 3, 15, 12, 0, 0, 0, time.UTC), time.UTC); formatted != "0044-03-15 12:00:00+00 BC" {
+			t.Errorf("Expected a BC timestamp to be formatted as 0044-03-15 12:00:00+00 BC, got %s", formatted)
+		}
+	})
+}
+
+func TestParsePgSetTimeZone(t *testing.T) {
+	t.Run("parses time zones set like in PostgreSQL", func(t *testing.T) {
+		for query, expectedOffset := range map[string]int{
+			"SET timezone = 'UTC'":                       0,
+			"SET TIME ZONE 'Asia/Kolkata'":               5*3600 + 30*60,
+			"SET SESSION timezone TO 'America/New_York'": -5 * 3600,
+			"SET TIME ZONE -7":                           -7 * 3600,
+			"SET TIME ZONE 5.5":                          5*3600 + 30*60,
+			"SET TIME ZONE DEFAULT":                      0,
+			"RESET timezone":                             0,
+			"RESET ALL":                                  0,
+		} {
+			location, err := parsePgSetTimeZone(query)
+			if err != nil || location == nil {
+				t.Fatalf("Expected %s to set a time zone, got %v %v", query, location, err)
+			}
+			if _, offset := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).In(location).Zone(); offset != expectedOffset {
+				t.Errorf("Expected %s to set the offset %d, got %d", query, expectedOffset, offset)
+			}
+		}
+	})
+
+	t.Run("ignores other queries", func(t *testing.T) {
+		for _, query := range []string{"SELECT 1", "SET application_name = 'psql'", "SHOW timezone"} {
+			location, err := parsePgSetTimeZone(query)
+			if err != nil || location != nil {
+				t.Errorf("Expected %s to be ignored, got %v %v", query, location, err)
+			}
+		}
+	})
+}
+
+func TestParsePgSetAsOf(t *testing.T) {
+	t.Run("parses times set like timestamptz values", func(t *testing.T) {
+		timeZone, err := time.LoadLocation("America/New_York")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		for query, expectedAsOf := range map[string]time.Time{
+			"SET bemidb.as_of = '2024-05-01T00:00:00Z'":        time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			"SET bemidb.as_of TO '2024-05-01T12:30:00+02:00'":  time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+			"SET bemidb.as_of = '2024-05-01 12:30:00.5+02'":    time.Date(2024, 5, 1, 10, 30, 0, 500000000, time.UTC),
+			"SET SESSION bemidb.as_of = '2024-05-01 12:30:00'": time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC),
+			"SET bemidb.as_of = '2024-05-01'":                  time.Date(2024, 5, 1, 4, 0, 0, 0, time.UTC),
+		} {
+			asOf, isSet, err := parsePgSetAsOf(query, timeZone)
+			if err != nil || !isSet || asOf == nil {
+				t.Fatalf("Expected %s to set the time, got %v %v %v", query, asOf, isSet, err)
+			}
+			if !asOf.Equal(expectedAsOf) {
+				t.Errorf("Expected %s to set %v, got %v", query, expectedAsOf, asOf)
+			}
+		}
+	})
+
+	t.Run("resets the time", func(t *testing.T) {
+		for _, query := range []string{"SET bemidb.as_of = DEFAULT", "RESET bemidb.as_of", "RESET ALL"} {
+			asOf, isSet, err := parsePgSetAsOf(query, time.UTC)
+			if err != nil || !isSet || asOf != nil {
+				t.Errorf("Expected %s to reset the time, got %v %v %v", query, asOf, isSet, err)
+			}
+		}
+	})
+
+	t.Run("ignores other queries", func(t *testing.T) {
+		for _, query := range []string{"SELECT 1", "SET timezone = 'UTC'", "SHOW bemidb.as_of"} {
+			asOf, isSet, err := parsePgSetAsOf(query, time.UTC)
+			if err != nil || isSet || asOf != nil {
+				t.Errorf("Expected %s to be ignored, got %v %v %v", query, asOf, isSet, err)
+			}
+		}
+	})
+
+	t.Run("returns an error for invalid times", func(t *testing.T) {
+		for _, query := range []string{"SET bemidb.as_of = 'yesterday'", "SET bemidb.as_of = 20240501"} {
+			_, _, err := parsePgSetAsOf(query, time.UTC)
+
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) || pgErr.Code != PG_INVALID_PARAMETER_VALUE_CODE {
+				t.Errorf("Expected %s to return an invalid parameter value error, got %v", query, err)
+			}
+		}
+	})
+}
+
+func TestParsePgSetNessieRef(t *testing.T) {
+	t.Run("parses references", func(t *testing.T) {
+		for query, expectedNessieRef := range map[string]string{
+			"SET bemidb.nessie_ref = 'main'":          "main",
+			"SET bemidb.nessie_ref TO release":        "release",
+			"SET bemidb.nessie_ref = 'main@2e1cfa82'": "main@2e1cfa82",
+		} {
+			nessieRef, isSet, err := parsePgSetNessieRef(query)
+			if err != nil || !isSet || nessieRef != expectedNessieRef {
+				t.Errorf("Expected %s to set %s, got %s %v %v", query, expectedNessieRef, nessieRef, isSet, err)
+			}
+		}
+	})
+
+	t.Run("resets the reference", func(t *testing.T) {
+		for _, query := range []string{"SET bemidb.nessie_ref = DEFAULT", "RESET bemidb.nessie_ref", "RESET ALL"} {
+			nessieRef, isSet, err := parsePgSetNessieRef(query)
+			if err != nil || !isSet || nessieRef != "" {
+				t.Errorf("Expected %s to reset the reference, got %s %v %v", query, nessieRef, isSet, err)
+			}
+		}
+	})
+
+	t.Run("ignores other queries", func(t *testing.T) {
+		for _, query := range []string{"SELECT 1", "SET bemidb.as_of = '2024-05-01'", "SHOW bemidb.nessie_ref"} {
+			nessieRef, isSet, err := parsePgSetNessieRef(query)
+			if err != nil || isSet || nessieRef != "" {
+				t.Errorf("Expected %s to be ignored, got %s %v %v", query, nessieRef, isSet, err)
+			}
+		}
+	})
+
+	t.Run("returns an error for invalid references", func(t *testing.T) {
+		for _, query := range []string{"SET bemidb.nessie_ref = ''", "SET bemidb.nessie_ref = '@2e1cfa82'", "SET bemidb.nessie_ref = 1"} {
+			_, _, err := parsePgSetNessieRef(query)
+
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) || pgErr.Code != PG_INVALID_PARAMETER_VALUE_CODE {
+				t.Errorf("Expected %s to return an invalid parameter value error, got %v", query, err)
+			}
+		}
+	})
+}
+
+func TestParsePgSleepDuration(t *testing.T) {
+	t.Run("sums pg_sleep calls in the SELECT list", func(t *testing.T) {
+		for query, expectedDuration := range map[string]time.Duration{
+			"SELECT pg_sleep(1)":                     time.Second,
+			"select PG_SLEEP(0.25)":                  250 * time.Millisecond,
+			"SELECT pg_catalog.pg_sleep('0.5')":      500 * time.Millisecond,
+			"SELECT pg_sleep(0.1), 1, pg_sleep(0.2)": 300 * time.Millisecond,
+			"SELECT pg_sleep(-1)":                    0,
+			"SELECT 'pg_sleep'":                      0,
+			"SELECT pg_sleep(id) FROM users":         0,
+			"SELECT 1; SELECT pg_sleep(1)":           0,
+			"SELECT custom.pg_sleep(1)":              0,
+			"SELECT 1":                               0,
+		} {
+			if duration := parsePgSleepDuration(query); duration != expectedDuration {
+				t.Errorf("Expected %s to sleep for %v, got %v", query, expectedDuration, duration)
+			}
+		}
+	})
+
+	t.Run("cancels the sleep with the query context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := waitPgSleep(ctx, "SELECT pg_sleep(10)")
+
+		testQueryCanceledError(t, err, "canceling statement due to statement timeout")
+	})
+}
+
+func mustParseBigInt(value string) *big.Int {
+	bigInt, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		panic("Invalid integer: " + value)
+	}
+	return bigInt
+}
+
 func initQueryHandler() *QueryHandler {
 	config := loadTestConfig()
 	duckdb := NewDuckdb(config)
 	icebergReader := NewIcebergReader(config)
-	return NewQueryHandler(config, duckdb, icebergReader)
+	return NewQueryHandler(config, duckdb, icebergReader, NewPgSessionRegistry())
+}
+
+func testQueryCanceledError(t *testing.T, err error, expectedMessage string) {
+	var pgError *pgconn.PgError
+	if !errors.As(err, &pgError) {
+		t.Fatalf("Expected a PostgreSQL error, got %v", err)
+	}
+	if pgError.Code != "57014" || pgError.Message != expectedMessage {
+		t.Errorf("Expected query_canceled error with message %s, got %s %s", expectedMessage, pgError.Code, pgError.Message)
+	}
 }
 
 func testNoError(t *testing.T, err error) {
@@ -1349,6 +2139,18 @@ func testCommandCompleteTag(t *testing.T, message pgproto3.Message, expectedTag
 	}
 }
 
+func explainPlan(t *testing.T, messages []pgproto3.Message) string {
+	var lines []string
+	for _, message := range messages[1 : len(messages)-1] {
+		dataRow, ok := message.(*pgproto3.DataRow)
+		if !ok || len(dataRow.Values) != 1 {
+			t.Fatalf("Expected a single-column data row, got %v", message)
+		}
+		lines = append(lines, string(dataRow.Values[0]))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func Uint32ToString(i uint32) string {
 	return strconv.FormatUint(uint64(i), 10)
 }
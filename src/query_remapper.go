@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"strings"
+	"sync"
 
 	pgQuery "github.com/pganalyze/pg_query_go/v5"
 )
@@ -20,6 +21,8 @@ var KNOWN_SET_STATEMENTS = NewSet([]string{
 	"application_name",            // SET application_name = 'psql'
 	"datestyle",                   // SET datestyle TO 'ISO'
 	"session characteristics",     // SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ COMMITTED
+	PG_SETTING_AS_OF,              // SET bemidb.as_of = '2024-05-01T00:00:00Z' (applied to Iceberg table scans)
+	PG_SETTING_NESSIE_REF,         // SET bemidb.nessie_ref = 'main' (applied to Iceberg table scans)
 })
 
 var FALLBACK_QUERY_TREE, _ = pgQuery.Parse(FALLBACK_SQL_QUERY)
@@ -35,12 +38,13 @@ type QueryRemapper struct {
 	icebergReader    *IcebergReader
 	duckdb           *Duckdb
 	config           *Config
+	mutex            sync.Mutex // the remapped tables depend on the session's bemidb.as_of and bemidb.nessie_ref
 }
 
-func NewQueryRemapper(config *Config, icebergReader *IcebergReader, duckdb *Duckdb) *QueryRemapper {
+func NewQueryRemapper(config *Config, icebergReader *IcebergReader, duckdb *Duckdb, sessionRegistry *PgSessionRegistry) *QueryRemapper {
 	return &QueryRemapper{
 		parserTypeCast:   NewParserTypeCast(config),
-		remapperTable:    NewQueryRemapperTable(config, icebergReader, duckdb),
+		remapperTable:    NewQueryRemapperTable(config, icebergReader, duckdb, sessionRegistry),
 		remapperTypeCast: NewQueryRemapperTypeCast(config),
 		remapperWhere:    NewQueryRemapperWhere(config),
 		remapperSelect:   NewQueryRemapperSelect(config),
@@ -51,14 +55,21 @@ func NewQueryRemapper(config *Config, icebergReader *IcebergReader, duckdb *Duck
 	}
 }
 
-func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([]*pgQuery.RawStmt, error) {
+func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt, settings *PgSessionSettings) ([]*pgQuery.RawStmt, error) {
 	// Empty query
 	if len(statements) == 0 {
 		return statements, nil
 	}
 
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+	remapper.remapperTable.asOf = settings.AsOf
+	remapper.remapperTable.nessieRef = settings.NessieRef
+	remapper.remapperTable.snapshotErr = nil
+	remapper.remapperTable.metadataPaths = make(map[IcebergSchemaTable]string)
+
 	for i, stmt := range statements {
-		LogTrace(remapper.config, "Remapping statement #"+IntToString(i+1))
+		LogComponentTrace(remapper.config, LOG_COMPONENT_QUERY, "Remapping statement #"+IntToString(i+1))
 
 		node := stmt.Stmt
 
@@ -75,6 +86,21 @@ func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([
 
 		// SET
 		case node.GetVariableSetStmt() != nil:
+			// SET bemidb.as_of and bemidb.nessie_ref apply to the following statements of the same query
+			asOf, isAsOfSet, err := pgSetAsOf(node.GetVariableSetStmt(), settings.TimeZone)
+			if err != nil {
+				return nil, err
+			}
+			if isAsOfSet {
+				remapper.remapperTable.asOf = asOf
+			}
+			nessieRef, isNessieRefSet, err := pgSetNessieRef(node.GetVariableSetStmt())
+			if err != nil {
+				return nil, err
+			}
+			if isNessieRefSet {
+				remapper.remapperTable.nessieRef = nessieRef
+			}
 			statements[i] = remapper.remapSetStatement(stmt)
 
 		// DISCARD ALL
@@ -85,11 +111,26 @@ func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([
 		case node.GetVariableShowStmt() != nil:
 			statements[i] = remapper.remapperShow.RemapShowStatement(stmt)
 
+		// EXPLAIN [ANALYZE] SELECT
+		case node.GetExplainStmt() != nil:
+			explainStatement := node.GetExplainStmt()
+			if explainStatement.Query.GetSelectStmt() == nil {
+				return nil, errors.New("unsupported EXPLAIN query type")
+			}
+			remappedSelect := remapper.remapSelectStatement(explainStatement.Query.GetSelectStmt(), 1)
+			explainStatement.Query = &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: remappedSelect}}
+			explainStatement.Options = remapper.remapExplainOptions(explainStatement.Options)
+			statements[i] = stmt
+
 		// Unsupported query
 		default:
-			LogDebug(remapper.config, "Query tree:", stmt, node)
+			LogComponentDebug(remapper.config, LOG_COMPONENT_QUERY, "Query tree:", stmt, node)
 			return nil, errors.New("unsupported query type")
 		}
+
+		if remapper.remapperTable.snapshotErr != nil {
+			return nil, remapper.remapperTable.snapshotErr
+		}
 	}
 
 	return statements, nil
@@ -106,12 +147,25 @@ func (remapper *QueryRemapper) remapSetStatement(stmt *pgQuery.RawStmt) *pgQuery
 	}
 
 	if !KNOWN_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name)) {
-		LogWarn(remapper.config, "Unknown SET ", setStatement.Name, ":", setStatement)
+		LogComponentWarn(remapper.config, LOG_COMPONENT_QUERY, "Unknown SET ", setStatement.Name, ":", setStatement)
 	}
 
 	return FALLBACK_SET_QUERY_TREE.Stmts[0]
 }
 
+// EXPLAIN (ANALYZE, VERBOSE, FORMAT JSON, ...) -> EXPLAIN (ANALYZE)
+func (remapper *QueryRemapper) remapExplainOptions(options []*pgQuery.Node) []*pgQuery.Node {
+	var remappedOptions []*pgQuery.Node
+	for _, option := range options {
+		if option.GetDefElem() != nil && option.GetDefElem().Defname == "analyze" {
+			remappedOptions = append(remappedOptions, option)
+		} else {
+			LogComponentDebug(remapper.config, LOG_COMPONENT_QUERY, "Ignoring unsupported EXPLAIN option:", option)
+		}
+	}
+	return remappedOptions
+}
+
 func (remapper *QueryRemapper) remapSelectStatement(selectStatement *pgQuery.SelectStmt, indentLevel int) *pgQuery.SelectStmt {
 	// UNION
 	if selectStatement.FromClause == nil && selectStatement.Larg != nil && selectStatement.Rarg != nil {
@@ -152,7 +206,7 @@ func (remapper *QueryRemapper) remapSelectStatement(selectStatement *pgQuery.Sel
 				remapper.traceTreeTraversal("WHERE statements", indentLevel)
 				// FROM [TABLE]
 				remapper.traceTreeTraversal("FROM table", indentLevel)
-				selectStatement.FromClause[i] = remapper.remapperTable.RemapTable(fromNode)
+				selectStatement.FromClause[i] = remapper.remapperTable.RemapTable(fromNode, selectStatement.WhereClause)
 				qSchemaTable := remapper.remapperTable.NodeToQuerySchemaTable(fromNode)
 				selectStatement = remapper.remapperTable.RemapWhereClauseForTable(qSchemaTable, selectStatement)
 			} else if fromNode.GetRangeSubselect() != nil {
@@ -358,7 +412,7 @@ func (remapper *QueryRemapper) remapJoinExpressions(selectStatement *pgQuery.Sel
 		selectStatement = remapper.remapperTable.RemapWhereClauseForTable(qSchemaTable, selectStatement)
 		// TABLE
 		remapper.traceTreeTraversal("TABLE left", indentLevel+1)
-		leftJoinNode = remapper.remapperTable.RemapTable(leftJoinNode)
+		leftJoinNode = remapper.remapperTable.RemapTable(leftJoinNode, selectStatement.WhereClause)
 	} else if leftJoinNode.GetRangeSubselect() != nil {
 		leftSelectStatement := leftJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
 		remapper.remapSelectStatement(leftSelectStatement, indentLevel+1) // parent-recursion
@@ -376,7 +430,7 @@ func (remapper *QueryRemapper) remapJoinExpressions(selectStatement *pgQuery.Sel
 		selectStatement = remapper.remapperTable.RemapWhereClauseForTable(qSchemaTable, selectStatement)
 		// TABLE
 		remapper.traceTreeTraversal("TABLE right", indentLevel+1)
-		rightJoinNode = remapper.remapperTable.RemapTable(rightJoinNode)
+		rightJoinNode = remapper.remapperTable.RemapTable(rightJoinNode, selectStatement.WhereClause)
 	} else if rightJoinNode.GetRangeSubselect() != nil {
 		rightSelectStatement := rightJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
 		remapper.remapSelectStatement(rightSelectStatement, indentLevel+1) // parent-recursion
@@ -495,5 +549,5 @@ func (remapper *QueryRemapper) remapSelect(selectStatement *pgQuery.SelectStmt,
 }
 
 func (remapper *QueryRemapper) traceTreeTraversal(label string, indentLevel int) {
-	LogTrace(remapper.config, strings.Repeat(">", indentLevel), label)
+	LogComponentTrace(remapper.config, LOG_COMPONENT_QUERY, strings.Repeat(">", indentLevel), label)
 }
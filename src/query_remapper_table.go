@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	pgQuery "github.com/pganalyze/pg_query_go/v5"
 )
 
@@ -14,19 +17,28 @@ type QueryRemapperTable struct {
 	parserWhere         *ParserWhere
 	parserFunction      *ParserFunction
 	icebergSchemaTables Set[IcebergSchemaTable]
+	icebergTableFields  map[IcebergSchemaTable][]IcebergTableField
 	icebergReader       *IcebergReader
 	duckdb              *Duckdb
+	sessionRegistry     *PgSessionRegistry
 	config              *Config
+	asOf                *time.Time                    // set with SET bemidb.as_of, nil to read the current snapshots
+	nessieRef           string                        // set with SET bemidb.nessie_ref, empty to read the latest written tables
+	snapshotErr         error                         // set if a table can't be read as of that time, at that reference, or with its equality deletes resolved
+	metadataPaths       map[IcebergSchemaTable]string // resolved once per query, so that all references to a table read the same metadata version
 }
 
-func NewQueryRemapperTable(config *Config, icebergReader *IcebergReader, duckdb *Duckdb) *QueryRemapperTable {
+func NewQueryRemapperTable(config *Config, icebergReader *IcebergReader, duckdb *Duckdb, sessionRegistry *PgSessionRegistry) *QueryRemapperTable {
 	remapper := &QueryRemapperTable{
-		parserTable:    NewParserTable(config),
-		parserWhere:    NewParserWhere(config),
-		parserFunction: NewParserFunction(config),
-		icebergReader:  icebergReader,
-		duckdb:         duckdb,
-		config:         config,
+		parserTable:        NewParserTable(config),
+		parserWhere:        NewParserWhere(config),
+		parserFunction:     NewParserFunction(config),
+		icebergTableFields: make(map[IcebergSchemaTable][]IcebergTableField),
+		metadataPaths:      make(map[IcebergSchemaTable]string),
+		icebergReader:      icebergReader,
+		duckdb:             duckdb,
+		sessionRegistry:    sessionRegistry,
+		config:             config,
 	}
 	remapper.reloadIceberSchemaTables()
 	return remapper
@@ -36,8 +48,8 @@ func (remapper *QueryRemapperTable) NodeToQuerySchemaTable(node *pgQuery.Node) Q
 	return remapper.parserTable.NodeToQuerySchemaTable(node)
 }
 
-// FROM / JOIN [TABLE]
-func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node {
+// FROM / JOIN [TABLE] with the WHERE clause of the SELECT statement, which prunes partitions of Iceberg tables
+func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node, whereClause *pgQuery.Node) *pgQuery.Node {
 	parser := remapper.parserTable
 	qSchemaTable := parser.NodeToQuerySchemaTable(node)
 
@@ -79,6 +91,16 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 		case PG_TABLE_PG_INDEX:
 			return parser.MakePgIndexNode(qSchemaTable)
 
+		// pg_constraint -> returns (SELECT ..., constraint_name AS conname, ..., [1-based column numbers] AS conkey, ... FROM duckdb_constraints() WHERE constraint_type <> 'NOT NULL')
+		case PG_TABLE_PG_CONSTRAINT:
+			remapper.reloadIceberSchemaTables()
+			return parser.MakePgConstraintNode(qSchemaTable)
+
+		// pg_attribute -> returns (SELECT ..., [char(n) and varchar(n) lengths] AS atttypmod, ... FROM pg_attribute)
+		case PG_TABLE_PG_ATTRIBUTE:
+			remapper.reloadIceberSchemaTables()
+			return parser.MakePgAttributeNode(node, qSchemaTable, remapper.icebergTableFields)
+
 		// pg_catalog.pg_inherits -> return empty table
 		case PG_TABLE_PG_INHERITS:
 			return parser.MakeEmptyTableNode(PG_TABLE_PG_INHERITS, PG_INHERITS_DEFINITION, qSchemaTable.Alias)
@@ -103,9 +125,9 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 		case PG_TABLE_PG_AUTH_MEMBERS:
 			return parser.MakeEmptyTableNode(PG_TABLE_PG_AUTH_MEMBERS, PG_AUTH_MEMBERS_DEFINITION, qSchemaTable.Alias)
 
-		// pg_stat_activity -> return empty table
+		// pg_stat_activity -> return active BemiDB sessions
 		case PG_TABLE_PG_STAT_ACTIVITY:
-			return parser.MakeEmptyTableNode(PG_TABLE_PG_STAT_ACTIVITY, PG_STAT_ACTIVITY_DEFINITION, qSchemaTable.Alias)
+			return parser.MakePgStatActivityNode(remapper.sessionRegistry.Sessions(), qSchemaTable.Alias)
 
 		// pg_views -> return empty table
 		case PG_TABLE_PG_VIEWS:
@@ -146,7 +168,7 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 		}
 	}
 
-	// iceberg.table -> FROM iceberg_scan('iceberg/schema/table/metadata/v1.metadata.json', skip_schema_inference = true)
+	// iceberg.table -> FROM iceberg_scan('iceberg/schema/table/metadata/vN.metadata.json', skip_schema_inference = true) with the version in version-hint.text
 	if qSchemaTable.Schema == "" {
 		qSchemaTable.Schema = PG_SCHEMA_PUBLIC
 	}
@@ -157,8 +179,110 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 			return node // Let it return "Catalog Error: Table with name _ does not exist!"
 		}
 	}
-	icebergPath := remapper.icebergReader.MetadataFilePath(schemaTable)
-	return parser.MakeIcebergTableNode(icebergPath, qSchemaTable)
+	var metadataPath string
+	var err error
+	tableFields := remapper.icebergTableFields[schemaTable]
+	if remapper.nessieRef != "" {
+		// SET bemidb.nessie_ref = ... -> FROM iceberg_scan('iceberg/schema/table/metadata/nessie-N.metadata.json', ...) with the metadata committed to the reference
+		metadataPath, tableFields, err = remapper.nessieMetadata(schemaTable, qSchemaTable)
+	} else {
+		metadataPath, err = remapper.currentMetadataPath(schemaTable)
+	}
+	if err != nil {
+		remapper.snapshotErr = err
+		return node
+	}
+	if remapper.asOf == nil {
+		metadataPath, err = remapper.icebergReader.ReconciledMetadataFilePath(schemaTable, metadataPath, 0)
+		if err != nil {
+			remapper.snapshotErr = err
+			return node
+		}
+		icebergPath := remapper.prunedIcebergPath(schemaTable, qSchemaTable, metadataPath, 0, whereClause)
+		return parser.MakeIcebergTableNode(icebergPath, qSchemaTable, tableFields, 0)
+	}
+
+	// SET bemidb.as_of = ... -> FROM iceberg_scan(..., snapshot_from_id = N) with the snapshot that was current at that time
+	snapshot, err := remapper.icebergReader.SnapshotAsOf(schemaTable, metadataPath, *remapper.asOf)
+	if err == nil && snapshot == nil {
+		err = remapper.noSnapshotAsOfError(schemaTable, qSchemaTable)
+	}
+	if err == nil {
+		metadataPath, err = remapper.icebergReader.ReconciledMetadataFilePath(schemaTable, metadataPath, snapshot.Id)
+	}
+	if err != nil {
+		remapper.snapshotErr = err
+		return node
+	}
+	icebergPath := remapper.prunedIcebergPath(schemaTable, qSchemaTable, metadataPath, snapshot.Id, whereClause)
+	return parser.MakeIcebergTableNode(icebergPath, qSchemaTable, snapshot.TableFields, snapshot.Id)
+}
+
+// Returns the metadata path that the version hint pointed to when the table was first referenced in the query, even if a sync has committed a newer version since.
+// The path is resolved again if its metadata file has been deleted in the meantime
+func (remapper *QueryRemapperTable) currentMetadataPath(schemaTable IcebergSchemaTable) (metadataPath string, err error) {
+	if metadataPath, ok := remapper.metadataPaths[schemaTable]; ok {
+		if remapper.icebergReader.MetadataFileExists(metadataPath) {
+			return metadataPath, nil
+		}
+		LogComponentWarn(remapper.config, LOG_COMPONENT_QUERY, "Resolving the metadata file of", schemaTable.String(), "again after", metadataPath, "was deleted during the query")
+	}
+
+	metadataPath, err = remapper.icebergReader.MetadataFilePath(schemaTable)
+	if err != nil {
+		return "", err
+	}
+	remapper.metadataPaths[schemaTable] = metadataPath
+	return metadataPath, nil
+}
+
+// Returns the metadata path and the current fields of the table as it was committed to the Nessie reference
+func (remapper *QueryRemapperTable) nessieMetadata(schemaTable IcebergSchemaTable, qSchemaTable QuerySchemaTable) (metadataPath string, tableFields []IcebergTableField, err error) {
+	metadataPath, err = remapper.icebergReader.NessieMetadataFilePath(schemaTable, remapper.nessieRef)
+	if err == nil && metadataPath == "" {
+		err = &pgconn.PgError{
+			Severity: "ERROR",
+			Code:     PG_UNDEFINED_TABLE_CODE,
+			Message:  `relation "` + qSchemaTable.Table + `" does not exist at Nessie reference "` + remapper.nessieRef + `"`,
+			Hint:     "RESET bemidb.nessie_ref to read the latest synced table.",
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	tableFields, err = remapper.icebergReader.MetadataTableFields(metadataPath)
+	if err != nil {
+		return "", nil, err
+	}
+	return metadataPath, tableFields, nil
+}
+
+// Points to the earliest time that the table can be read as of if the requested time predates its history
+func (remapper *QueryRemapperTable) noSnapshotAsOfError(schemaTable IcebergSchemaTable, qSchemaTable QuerySchemaTable) error {
+	pgError := &pgconn.PgError{Severity: "ERROR", Code: PG_UNDEFINED_TABLE_CODE, Message: `relation "` + qSchemaTable.Table + `" has no snapshot as of ` + remapper.asOf.Format(time.RFC3339)}
+
+	historyStart, err := remapper.icebergReader.HistoryStart(schemaTable)
+	if err != nil {
+		return err
+	}
+	if historyStart != nil && remapper.asOf.Before(*historyStart) {
+		pgError.Detail = "The history of the table starts at " + historyStart.Format(time.RFC3339Nano) + "."
+		pgError.Hint = "Set bemidb.as_of to a later time or RESET bemidb.as_of to read the current snapshot."
+	}
+	return pgError
+}
+
+// Returns the metadata path of the table snapshot with only the data files that can match the WHERE clause by their partitions and
+// column bounds. Falls back to scanning all data files if they can't be pruned
+func (remapper *QueryRemapperTable) prunedIcebergPath(schemaTable IcebergSchemaTable, qSchemaTable QuerySchemaTable, metadataPath string, snapshotId int64, whereClause *pgQuery.Node) string {
+	predicates := remapper.parserWhere.ColumnPredicates(whereClause, qSchemaTable)
+	icebergPath, err := remapper.icebergReader.PrunedMetadataFilePath(schemaTable, metadataPath, snapshotId, predicates)
+	if err != nil {
+		LogComponentWarn(remapper.config, LOG_COMPONENT_QUERY, "Couldn't prune data files of "+schemaTable.String()+":", err)
+		return metadataPath
+	}
+	return icebergPath
 }
 
 // FROM [PG_FUNCTION()]
@@ -233,13 +357,17 @@ func (remapper *QueryRemapperTable) reloadIceberSchemaTables() {
 		if !remapper.icebergSchemaTables.Contains(icebergSchemaTable) {
 			icebergTableFields, err := remapper.icebergReader.TableFields(icebergSchemaTable)
 			PanicIfError(err)
+			remapper.icebergTableFields[icebergSchemaTable] = icebergTableFields
 
 			var sqlColumns []string
 			for _, icebergTableField := range icebergTableFields {
 				sqlColumns = append(sqlColumns, icebergTableField.ToSql())
 			}
+			properties, err := remapper.icebergReader.TableProperties(icebergSchemaTable)
+			PanicIfError(err)
+			sqlColumns = append(sqlColumns, icebergTableKeyConstraintsSql(icebergTableFields, properties)...)
 
-			_, err = remapper.duckdb.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+icebergSchemaTable.Schema, nil)
+			_, err = remapper.duckdb.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+QuoteIdentifier(icebergSchemaTable.Schema), nil)
 			PanicIfError(err)
 			_, err = remapper.duckdb.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+icebergSchemaTable.String()+" ("+strings.Join(sqlColumns, ", ")+")", nil)
 			PanicIfError(err)
@@ -249,12 +377,56 @@ func (remapper *QueryRemapperTable) reloadIceberSchemaTables() {
 		if !newIcebergSchemaTables.Contains(icebergSchemaTable) {
 			_, err = remapper.duckdb.ExecContext(ctx, "DROP TABLE IF EXISTS "+icebergSchemaTable.String(), nil)
 			PanicIfError(err)
+			delete(remapper.icebergTableFields, icebergSchemaTable)
 		}
 	}
 
 	remapper.icebergSchemaTables = newIcebergSchemaTables
 }
 
+// Tables are created again on the next reload, e.g., after DuckDB is reopened
+func (remapper *QueryRemapperTable) resetIcebergSchemaTables() {
+	remapper.icebergSchemaTables = NewSet([]IcebergSchemaTable{})
+	remapper.icebergTableFields = make(map[IcebergSchemaTable][]IcebergTableField)
+}
+
+// PRIMARY KEY and UNIQUE constraints recorded in the table properties, so that they're reported by pg_constraint and information_schema.
+// Keys with columns that are missing or are lists are skipped
+func icebergTableKeyConstraintsSql(icebergTableFields []IcebergTableField, properties map[string]string) []string {
+	primaryKeyColumnNames, uniqueKeyColumnNames := icebergTableKeyColumnNames(properties)
+
+	keyColumnsSql := func(keyColumnNames []string) string {
+		var quotedColumnNames []string
+		for _, keyColumnName := range keyColumnNames {
+			index := slices.IndexFunc(icebergTableFields, func(field IcebergTableField) bool { return field.Name == keyColumnName })
+			if index == -1 || icebergTableFields[index].IsList {
+				return ""
+			}
+			quotedColumnNames = append(quotedColumnNames, QuoteIdentifier(keyColumnName))
+		}
+		return "(" + strings.Join(quotedColumnNames, ", ") + ")"
+	}
+
+	var constraintsSql []string
+	if len(primaryKeyColumnNames) > 0 {
+		if columnsSql := keyColumnsSql(primaryKeyColumnNames); columnsSql != "" {
+			constraintsSql = append(constraintsSql, "PRIMARY KEY "+columnsSql)
+		}
+	}
+
+	keyNames := make([]string, 0, len(uniqueKeyColumnNames))
+	for keyName := range uniqueKeyColumnNames {
+		keyNames = append(keyNames, keyName)
+	}
+	slices.Sort(keyNames)
+	for _, keyName := range keyNames {
+		if columnsSql := keyColumnsSql(uniqueKeyColumnNames[keyName]); columnsSql != "" {
+			constraintsSql = append(constraintsSql, "UNIQUE "+columnsSql)
+		}
+	}
+	return constraintsSql
+}
+
 // System pg_* tables
 func (remapper *QueryRemapperTable) isTableFromPgCatalog(qSchemaTable QuerySchemaTable) bool {
 	return qSchemaTable.Schema == PG_SCHEMA_PG_CATALOG ||
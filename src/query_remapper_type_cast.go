@@ -38,6 +38,12 @@ func (remapper *QueryRemapperTypeCast) RemapTypeCast(node *pgQuery.Node) *pgQuer
 	case "regclass":
 		// 'schema.table'::regclass -> SELECT c.oid FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = 'schema' AND c.relname = 'table'
 		return remapper.parserTypeCast.MakeSubselectOidBySchemaTableArg(typeCast.Arg)
+	case "inet", "cidr", "macaddr", "macaddr8":
+		// '192.168.0.1/32'::inet -> '192.168.0.1'::text, since network values are synced as text in the canonical form
+		if typeCast.Arg.GetAConst() != nil && typeCast.Arg.GetAConst().GetSval() != nil {
+			return remapper.parserTypeCast.MakeCaseTypeCastNode(pgQuery.MakeAConstStrNode(CanonicalPgNetworkText(typeName, remapper.parserTypeCast.ArgStringValue(typeCast)), 0), "text")
+		}
+		return remapper.parserTypeCast.MakeCaseTypeCastNode(typeCast.Arg, "text")
 	case "oid":
 		// 'schema.table'::regclass::oid -> SELECT c.oid FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = 'schema' AND c.relname = 'table'
 		nestedNode := typeCast.Arg
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	ICEBERG_EVOLUTION_POLICY_STRICT   = "strict"
+	ICEBERG_EVOLUTION_POLICY_ADDITIVE = "additive"
+	ICEBERG_EVOLUTION_POLICY_FULL     = "full"
+)
+
+var ICEBERG_EVOLUTION_POLICIES = []string{
+	ICEBERG_EVOLUTION_POLICY_STRICT,
+	ICEBERG_EVOLUTION_POLICY_ADDITIVE,
+	ICEBERG_EVOLUTION_POLICY_FULL,
+}
+
+type SchemaChange struct {
+	Kind        string // "add", "drop", "rename", "change"
+	ColumnName  string
+	Details     string
+	CurrentType string // for "change", Iceberg type of the existing column
+	NewType     string // for "change", Iceberg type of the PostgreSQL column
+}
+
+func (change SchemaChange) String() string {
+	if change.Details == "" {
+		return change.Kind + " column " + change.ColumnName
+	}
+	return change.Kind + " column " + change.ColumnName + " (" + change.Details + ")"
+}
+
+// Compares the existing Iceberg schema to the new one by column names.
+// A column is considered renamed if it keeps its field ID and type while the old name disappears
+func DiffIcebergSchemaFields(currentFields []IcebergSchemaField, newFields []IcebergSchemaField) []SchemaChange {
+	currentFieldsByName := make(map[string]IcebergSchemaField)
+	for _, field := range currentFields {
+		currentFieldsByName[field.Name] = field
+	}
+	newFieldsByName := make(map[string]IcebergSchemaField)
+	for _, field := range newFields {
+		newFieldsByName[field.Name] = field
+	}
+
+	var changes []SchemaChange
+	renamedFieldNames := make(Set[string])
+	for _, newField := range newFields {
+		currentField, ok := currentFieldsByName[newField.Name]
+		if ok {
+			if icebergFieldSignature(currentField) != icebergFieldSignature(newField) {
+				changes = append(changes, SchemaChange{
+					Kind:        "change",
+					ColumnName:  newField.Name,
+					Details:     icebergFieldSignature(currentField) + " -> " + icebergFieldSignature(newField),
+					CurrentType: icebergFieldTypeString(currentField),
+					NewType:     icebergFieldTypeString(newField),
+				})
+			}
+			continue
+		}
+
+		renamed := false
+		for _, currentField := range currentFields {
+			_, stillExists := newFieldsByName[currentField.Name]
+			if !stillExists && currentField.Id == newField.Id && icebergFieldTypeString(currentField) == icebergFieldTypeString(newField) {
+				changes = append(changes, SchemaChange{Kind: "rename", ColumnName: currentField.Name, Details: "to " + newField.Name})
+				renamedFieldNames.Add(currentField.Name)
+				renamed = true
+				break
+			}
+		}
+		if !renamed {
+			changes = append(changes, SchemaChange{Kind: "add", ColumnName: newField.Name})
+		}
+	}
+
+	for _, currentField := range currentFields {
+		if _, ok := newFieldsByName[currentField.Name]; !ok && !renamedFieldNames.Contains(currentField.Name) {
+			changes = append(changes, SchemaChange{Kind: "drop", ColumnName: currentField.Name})
+		}
+	}
+
+	return changes
+}
+
+// Returns an error if the policy doesn't allow some of the schema changes:
+// - strict: no changes
+// - additive: only new columns
+// - full: any changes, including dropped, renamed, and changed columns
+func CheckSchemaEvolution(policy string, changes []SchemaChange) error {
+	var disallowedChanges []string
+	for _, change := range changes {
+		switch policy {
+		case ICEBERG_EVOLUTION_POLICY_STRICT:
+			disallowedChanges = append(disallowedChanges, change.String())
+		case ICEBERG_EVOLUTION_POLICY_ADDITIVE:
+			if change.Kind != "add" {
+				disallowedChanges = append(disallowedChanges, change.String())
+			}
+		}
+	}
+
+	if len(disallowedChanges) > 0 {
+		return fmt.Errorf("schema evolution policy %s doesn't allow: %s", policy, strings.Join(disallowedChanges, ", "))
+	}
+	return nil
+}
+
+func schemaChangeStrings(changes []SchemaChange) []string {
+	var changeStrings []string
+	for _, change := range changes {
+		changeStrings = append(changeStrings, change.String())
+	}
+	return changeStrings
+}
+
+// Returns a schema drift error for the first column whose type changed in a way that can't be widened,
+// since reading its existing values as the new type would fail or coerce them
+func CheckSchemaTypeChanges(changes []SchemaChange) error {
+	for _, change := range changes {
+		if change.Kind == "change" && !isIcebergTypePromotion(change.CurrentType, change.NewType) {
+			return fmt.Errorf("schema drift: column %s changed its type from %s to %s, which can't be widened. Sync it with --force-rewrite-on-type-change to rewrite the table", change.ColumnName, change.CurrentType, change.NewType)
+		}
+	}
+	return nil
+}
+
+// Returns an error if rows with the new PostgreSQL columns can't be appended to the table without rewriting its data files.
+// Fields are matched by their IDs, so that existing data files are read with the new schema:
+// - added columns must be optional and have IDs that were never assigned, old files read them as NULL
+// - dropped columns are removed from the schema, old files keep their values
+// - renamed columns keep their IDs, a column name can't move to another ID
+// - types can only be widened (int -> long, float -> double, decimal with a higher precision) and made optional
+// - primary keys and the way values are converted can't change
+func CheckAppendableIcebergSchema(currentFields []IcebergSchemaField, currentProperties map[string]string, lastColumnId int, newPgSchemaColumns []PgSchemaColumn) error {
+	var currentPgSchemaColumns []PgSchemaColumn
+	if err := json.Unmarshal([]byte(currentProperties[ICEBERG_PROPERTY_PG_SCHEMA_COLUMNS]), &currentPgSchemaColumns); err != nil {
+		return fmt.Errorf("PostgreSQL columns of the last sync are unknown")
+	}
+	newProperties := icebergTableProperties(newPgSchemaColumns)
+	if currentProperties[ICEBERG_PROPERTY_PRIMARY_KEY] != newProperties[ICEBERG_PROPERTY_PRIMARY_KEY] {
+		return fmt.Errorf("primary key changed")
+	}
+
+	currentFieldsById := make(map[int]IcebergSchemaField)
+	currentFieldIdsByName := make(map[string]int)
+	for _, field := range currentFields {
+		currentFieldsById[field.Id] = field
+		currentFieldIdsByName[field.Name] = field.Id
+	}
+	currentPgSchemaColumnsByPosition := make(map[string]PgSchemaColumn)
+	for _, pgSchemaColumn := range currentPgSchemaColumns {
+		currentPgSchemaColumnsByPosition[pgSchemaColumn.OrdinalPosition] = pgSchemaColumn
+	}
+
+	for _, newPgSchemaColumn := range newPgSchemaColumns {
+		newField := newPgSchemaColumn.ToIcebergSchemaFieldMap()
+		if currentFieldId, ok := currentFieldIdsByName[newField.Name]; ok && currentFieldId != newField.Id {
+			return fmt.Errorf("column %s changed its field ID from %d to %d", newField.Name, currentFieldId, newField.Id)
+		}
+
+		currentField, ok := currentFieldsById[newField.Id]
+		if !ok {
+			if newField.Id <= lastColumnId {
+				return fmt.Errorf("column %s reuses field ID %d", newField.Name, newField.Id)
+			}
+			if newField.Required {
+				return fmt.Errorf("added column %s is required", newField.Name)
+			}
+			continue
+		}
+
+		if !isIcebergTypePromotion(icebergFieldTypeString(currentField), icebergFieldTypeString(newField)) {
+			return fmt.Errorf("column %s changed its type from %s to %s", newField.Name, icebergFieldTypeString(currentField), icebergFieldTypeString(newField))
+		}
+		if newField.Required && !currentField.Required {
+			return fmt.Errorf("column %s became required", newField.Name)
+		}
+		if icebergFieldDocWithoutLength(currentField.Doc) != icebergFieldDocWithoutLength(newField.Doc) || pgSchemaColumnConversion(currentPgSchemaColumnsByPosition[newPgSchemaColumn.OrdinalPosition]) != pgSchemaColumnConversion(newPgSchemaColumn) {
+			return fmt.Errorf("values of column %s are converted differently", newField.Name)
+		}
+	}
+
+	return nil
+}
+
+// Returns true if the types are the same or values of the current type can be read as the new one
+func isIcebergTypePromotion(currentType string, newType string) bool {
+	if currentType == newType || currentType == "int" && newType == "long" || currentType == "float" && newType == "double" {
+		return true
+	}
+
+	var currentPrecision, currentScale, newPrecision, newScale int
+	if _, err := fmt.Sscanf(currentType, "decimal(%d, %d)", &currentPrecision, &currentScale); err != nil {
+		return false
+	}
+	if _, err := fmt.Sscanf(newType, "decimal(%d, %d)", &newPrecision, &newScale); err != nil {
+		return false
+	}
+	return newScale == currentScale && newPrecision > currentPrecision
+}
+
+// Character length limits don't change how values are stored
+func icebergFieldDocWithoutLength(doc string) string {
+	var attributes []string
+	for _, attribute := range strings.Split(doc, ";") {
+		if !strings.HasPrefix(attribute, ICEBERG_FIELD_DOC_LENGTH_PREFIX) {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return strings.Join(attributes, ";")
+}
+
+// Sync settings of a column that determine how its values are converted
+type pgSchemaColumnConversionSettings struct {
+	IsComposite             bool
+	GeometryFormat          string
+	Srid                    string
+	TsvectorFormat          string
+	IntervalFormat          string
+	BitFormat               string
+	NumericFormat           string
+	InfiniteTimestampFormat string
+	IsLargeObject           bool
+	KeepsCharPadding        bool
+	XmlXpath                string
+	TypeOverride            string
+}
+
+func pgSchemaColumnConversion(pgSchemaColumn PgSchemaColumn) pgSchemaColumnConversionSettings {
+	return pgSchemaColumnConversionSettings{
+		IsComposite:             pgSchemaColumn.IsComposite,
+		GeometryFormat:          pgSchemaColumn.GeometryFormat,
+		Srid:                    pgSchemaColumn.Srid,
+		TsvectorFormat:          pgSchemaColumn.TsvectorFormat,
+		IntervalFormat:          pgSchemaColumn.IntervalFormat,
+		BitFormat:               pgSchemaColumn.BitFormat,
+		NumericFormat:           pgSchemaColumn.NumericFormat,
+		InfiniteTimestampFormat: pgSchemaColumn.InfiniteTimestampFormat,
+		IsLargeObject:           pgSchemaColumn.IsLargeObject,
+		KeepsCharPadding:        pgSchemaColumn.KeepsCharPadding,
+		XmlXpath:                pgSchemaColumn.XmlXpath,
+		TypeOverride:            pgSchemaColumn.TypeOverride,
+	}
+}
+
+func icebergFieldTypeString(field IcebergSchemaField) string {
+	if typeString, ok := field.Type.(string); ok {
+		return typeString
+	}
+
+	typeJson, err := json.Marshal(field.Type)
+	PanicIfError(err)
+	return string(typeJson)
+}
+
+func icebergFieldSignature(field IcebergSchemaField) string {
+	signature := icebergFieldTypeString(field)
+	if IsTextUuidIcebergField(field) {
+		signature += " as text"
+	}
+	if field.Required {
+		signature += " required"
+	}
+	return signature
+}
+
+// UUIDs synced before they were stored as 16 bytes are strings, so their data files can't be mixed with new ones
+func IsTextUuidIcebergField(field IcebergSchemaField) bool {
+	typeString := icebergFieldTypeString(field)
+	isUuid := typeString == "uuid" || strings.Contains(typeString, `"element":"uuid"`)
+	return isUuid && !strings.HasPrefix(field.Doc, ICEBERG_FIELD_DOC_UUID_BINARY)
+}
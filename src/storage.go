@@ -1,6 +1,17 @@
 package main
 
-var STORAGE_TYPES = []string{STORAGE_TYPE_LOCAL, STORAGE_TYPE_S3}
+import (
+	"strings"
+	"time"
+)
+
+var STORAGE_TYPES = []string{STORAGE_TYPE_LOCAL, STORAGE_TYPE_S3, STORAGE_TYPE_AZURE}
+
+const (
+	ICEBERG_CONTENT_DATA             = 0
+	ICEBERG_CONTENT_POSITION_DELETES = 1
+	ICEBERG_CONTENT_EQUALITY_DELETES = 2
+)
 
 type ParquetFileStats struct {
 	ColumnSizes     map[int]int64
@@ -12,17 +23,34 @@ type ParquetFileStats struct {
 }
 
 type ParquetFile struct {
-	Uuid        string
-	Path        string
-	Size        int64
-	RecordCount int64
-	Stats       ParquetFileStats
+	Uuid             string
+	Path             string
+	Size             int64
+	RecordCount      int64
+	Stats            ParquetFileStats
+	Content          int         // ICEBERG_CONTENT_DATA, ICEBERG_CONTENT_POSITION_DELETES, or ICEBERG_CONTENT_EQUALITY_DELETES
+	PartitionValue   interface{} // for partitioned tables, the transformed value of the partition column (nil for NULL)
+	SequenceNumber   int64       // data sequence number of committed files, 0 for new files that get the one of the snapshot adding them
+	EqualityFieldIds []int       // for equality delete files, the field IDs of the columns that deleted rows are matched by
+}
+
+type IcebergTableFile struct {
+	Path         string
+	Size         int64
+	LastModified time.Time
 }
 
 type ManifestFile struct {
-	SnapshotId int64
-	Path       string
-	Size       int64
+	SnapshotId         int64
+	SequenceNumber     int64
+	MinSequenceNumber  int64 // lowest data sequence number of the files in the manifest
+	Path               string
+	Size               int64
+	Content            int // 0: DATA, 1: DELETES, which are position and equality delete files
+	FileCount          int
+	RecordCount        int64
+	PartitionSpecId    int
+	PartitionSummaries []IcebergPartitionFieldSummary
 }
 
 type ManifestListFile struct {
@@ -30,16 +58,30 @@ type ManifestListFile struct {
 }
 
 type MetadataFile struct {
-	Version int64
-	Path    string
+	Version      int64
+	Path         string
+	ExpiredPaths []string // previous metadata files dropped from the metadata log, left to vacuum since queries may still read them
 }
 
 type Storage interface {
 	// Read
 	IcebergSchemas() (icebergSchemas []string, err error)
 	IcebergSchemaTables() (icebersSchemaTables Set[IcebergSchemaTable], err error)
-	IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) (path string)
+	IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) (path string, err error)
 	IcebergTableFields(icebergSchemaTable IcebergSchemaTable) (icebergTableFields []IcebergTableField, err error)
+	IcebergSchemaFields(icebergSchemaTable IcebergSchemaTable) (icebergSchemaFields []IcebergSchemaField, err error)
+	IcebergTableProperties(icebergSchemaTable IcebergSchemaTable) (properties map[string]string, err error)
+	// Data and delete files are listed after the current metadata file is read, so the files of a snapshot committed in between are ignored instead of partially read
+	IcebergDataFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error)
+	IcebergDeleteFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error)
+	ReadParquetColumns(schemaTable IcebergSchemaTable, columnNames []string) (rows [][]interface{}, err error)
+	ReadParquetFileColumns(parquetFile ParquetFile, columnNames []string) (rows [][]interface{}, err error)
+	// Reads a Parquet file by its location in manifests, e.g., of a file listed by another snapshot than the current one
+	ReadParquetLocationColumns(location string, columnNames []string) (rows [][]interface{}, err error)
+	ParquetFileLocation(parquetFile ParquetFile) (location string)
+	IcebergTableFiles(icebergSchemaTable IcebergSchemaTable) (icebergTableFiles []IcebergTableFile, err error)
+	IcebergStorageFiles() (icebergStorageFiles map[IcebergSchemaTable][]IcebergTableFile, err error)
+	ReadIcebergTableFile(path string) (content []byte, err error)
 
 	// Write
 	DeleteSchema(schema string) (err error)
@@ -47,10 +89,25 @@ type Storage interface {
 	CreateDataDir(schemaTable IcebergSchemaTable) (dataDirPath string)
 	CreateMetadataDir(schemaTable IcebergSchemaTable) (metadataDirPath string)
 	CreateParquet(dataDirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (parquetFile ParquetFile, err error)
-	CreateManifest(metadataDirPath string, parquetFile ParquetFile) (manifestFile ManifestFile, err error)
-	CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile) (manifestListFile ManifestListFile, err error)
-	CreateMetadata(metadataDirPath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error)
+	// Commits are based on this version, see CreateMetadata
+	CurrentMetadataVersion(metadataDirPath string) (version int64, err error)
+	ResolvePartitionSpec(metadataDirPath string, partitionFields []IcebergPartitionField) (partitionSpec IcebergPartitionSpec, err error)
+	// Returns the sequence number of the snapshot committed on top of the base version, which new data and delete files are written with.
+	// Fails with errConcurrentModification if the current metadata file isn't the base version anymore
+	NextSequenceNumber(metadataDirPath string, baseVersion int64) (sequenceNumber int64, err error)
+	CreateManifest(metadataDirPath string, snapshotId int64, sequenceNumber int64, partitionSpec IcebergPartitionSpec, parquetFiles []ParquetFile) (manifestFile ManifestFile, err error)
+	CreateManifestList(metadataDirPath string, parquetFiles []ParquetFile, manifestFiles []ManifestFile) (manifestListFile ManifestListFile, err error)
+	// Creates the next metadata file only if it doesn't exist yet and the current one is still the base version (0 for new tables).
+	// Otherwise, fails with errConcurrentModification, so that concurrent writers never overwrite each other's snapshots
+	CreateMetadata(metadataDirPath string, baseVersion int64, icebergSchemaFields []IcebergSchemaField, partitionSpec IcebergPartitionSpec, properties map[string]string, parquetFiles []ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error)
+	// Creates the next metadata file of the table with metadata derived from the base version, e.g., with expired snapshots, and
+	// updates the version hint. Fails with errConcurrentModification like CreateMetadata instead of rewriting the base version
+	CreateNextMetadata(icebergSchemaTable IcebergSchemaTable, baseVersion int64, metadataContent []byte) (metadataFile MetadataFile, err error)
 	CreateVersionHint(metadataDirPath string, metadataFile MetadataFile) (err error)
+	MergeParquet(dataDirPath string, parquetFiles []ParquetFile) (parquetFile ParquetFile, err error)
+	DeleteParquet(parquetFile ParquetFile) (err error)
+	WriteIcebergTableFile(path string, content []byte) (err error)
+	DeleteIcebergTableFile(path string) (err error)
 }
 
 func NewStorage(config *Config) Storage {
@@ -59,7 +116,20 @@ func NewStorage(config *Config) Storage {
 		return NewLocalStorage(config)
 	case STORAGE_TYPE_S3:
 		return NewS3Storage(config)
+	case STORAGE_TYPE_AZURE:
+		return NewAzureStorage(config)
 	}
 
 	return nil
 }
+
+// Returns the table of a file whose path relative to the storage path is "schema/table/data/..." or "schema/table/metadata/...".
+// Other files, such as sync manifests, don't belong to any table
+func icebergStorageFileSchemaTable(relativePath string) (IcebergSchemaTable, bool) {
+	pathParts := strings.Split(relativePath, "/")
+	if len(pathParts) < 4 || (pathParts[2] != "data" && pathParts[2] != "metadata") {
+		return IcebergSchemaTable{}, false
+	}
+
+	return IcebergSchemaTable{Schema: pathParts[0], Table: pathParts[1]}, true
+}
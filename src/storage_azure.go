@@ -0,0 +1,736 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/google/uuid"
+	parquetAzblob "github.com/xitongsys/parquet-go-source/azblob"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+type StorageAzure struct {
+	containerClient *container.Client
+	config          *Config
+	storageBase     *StorageBase
+}
+
+func NewAzureStorage(config *Config) *StorageAzure {
+	containerUrl := strings.TrimSuffix(config.Azure.Endpoint, "/") + "/" + config.Azure.Container
+
+	var containerClient *container.Client
+	var err error
+	switch {
+	case config.Azure.AccountKey != "":
+		sharedKeyCredential, credentialErr := azblob.NewSharedKeyCredential(config.Azure.AccountName, config.Azure.AccountKey)
+		PanicIfError(credentialErr)
+		containerClient, err = container.NewClientWithSharedKeyCredential(containerUrl, sharedKeyCredential, nil)
+	case config.Azure.SasToken != "":
+		containerClient, err = container.NewClientWithNoCredential(containerUrl+"?"+strings.TrimPrefix(config.Azure.SasToken, "?"), nil)
+	default:
+		managedIdentityOptions := &azidentity.ManagedIdentityCredentialOptions{}
+		if config.Azure.ManagedIdentityClientId != "" {
+			managedIdentityOptions.ID = azidentity.ClientID(config.Azure.ManagedIdentityClientId)
+		}
+		managedIdentityCredential, credentialErr := azidentity.NewManagedIdentityCredential(managedIdentityOptions)
+		PanicIfError(credentialErr)
+		containerClient, err = container.NewClient(containerUrl, managedIdentityCredential, nil)
+	}
+	PanicIfError(err)
+
+	return &StorageAzure{
+		containerClient: containerClient,
+		config:          config,
+		storageBase:     &StorageBase{config: config},
+	}
+}
+
+// Read ----------------------------------------------------------------------------------------------------------------
+
+func (storage *StorageAzure) IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) (path string, err error) {
+	metadataFile, _, err := storage.storageBase.ReadCurrentMetadataFile(storage.fullContainerPath()+storage.tablePrefix(icebergSchemaTable, true)+"metadata", storage.readIcebergTableFileIfExists)
+	return metadataFile.Path, err
+}
+
+func (storage *StorageAzure) IcebergSchemas() (icebergSchemas []string, err error) {
+	icebergSchemas, err = storage.nestedDirectoryPrefixes(storage.storagePrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	for i, schema := range icebergSchemas {
+		schemaParts := strings.Split(schema, "/")
+		icebergSchemas[i] = schemaParts[len(schemaParts)-2]
+	}
+
+	return icebergSchemas, nil
+}
+
+func (storage *StorageAzure) IcebergSchemaTables() (Set[IcebergSchemaTable], error) {
+	icebergSchemaTables := make(Set[IcebergSchemaTable])
+	icebergSchemas, err := storage.IcebergSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, icebergSchema := range icebergSchemas {
+		tables, err := storage.nestedDirectoryPrefixes(storage.storagePrefix() + icebergSchema + "/")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tablePrefix := range tables {
+			tableParts := strings.Split(tablePrefix, "/")
+			table := tableParts[len(tableParts)-2]
+
+			icebergSchemaTables.Add(IcebergSchemaTable{Schema: icebergSchema, Table: table})
+		}
+	}
+
+	return icebergSchemaTables, nil
+}
+
+func (storage *StorageAzure) IcebergTableFields(icebergSchemaTable IcebergSchemaTable) ([]IcebergTableField, error) {
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	metadataContent, err := storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ParseIcebergTableFields(metadataContent)
+}
+
+func (storage *StorageAzure) IcebergSchemaFields(icebergSchemaTable IcebergSchemaTable) ([]IcebergSchemaField, error) {
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	metadataContent, err := storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ParseIcebergSchemaFields(metadataContent)
+}
+
+func (storage *StorageAzure) IcebergTableProperties(icebergSchemaTable IcebergSchemaTable) (map[string]string, error) {
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	metadataContent, err := storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ParseIcebergTableProperties(metadataContent)
+}
+
+func (storage *StorageAzure) IcebergDataFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error) {
+	return storage.icebergParquetFiles(icebergSchemaTable, ICEBERG_CONTENT_DATA)
+}
+
+func (storage *StorageAzure) IcebergDeleteFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error) {
+	return storage.icebergParquetFiles(icebergSchemaTable, ICEBERG_CONTENT_POSITION_DELETES)
+}
+
+// Rows deleted by position delete files and equality delete files are skipped
+func (storage *StorageAzure) ReadParquetColumns(schemaTable IcebergSchemaTable, columnNames []string) (rows [][]interface{}, err error) {
+	_, metadataContent, err := storage.storageBase.ReadCurrentMetadataFile(storage.fullContainerPath()+storage.tablePrefix(schemaTable)+"metadata", storage.readIcebergTableFileIfExists)
+	if err != nil || metadataContent == nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ReadCurrentSnapshotColumns(metadataContent, storage.ReadIcebergTableFile, storage.ReadParquetLocationColumns, columnNames)
+}
+
+func (storage *StorageAzure) ReadParquetFileColumns(parquetFile ParquetFile, columnNames []string) (rows [][]interface{}, err error) {
+	fileReader, err := storage.parquetFileReader(parquetFile.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ReadParquetColumns(fileReader, columnNames)
+}
+
+func (storage *StorageAzure) ReadParquetLocationColumns(location string, columnNames []string) (rows [][]interface{}, err error) {
+	return storage.ReadParquetFileColumns(ParquetFile{Path: strings.TrimPrefix(location, storage.fullContainerPath())}, columnNames)
+}
+
+func (storage *StorageAzure) ParquetFileLocation(parquetFile ParquetFile) string {
+	return storage.fullContainerPath() + parquetFile.Path
+}
+
+func (storage *StorageAzure) IcebergTableFiles(icebergSchemaTable IcebergSchemaTable) (icebergTableFiles []IcebergTableFile, err error) {
+	icebergTableFiles, err = storage.listBlobs(storage.tablePrefix(icebergSchemaTable, true))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range icebergTableFiles {
+		icebergTableFiles[i].Path = storage.fullContainerPath() + icebergTableFiles[i].Path
+	}
+
+	return icebergTableFiles, nil
+}
+
+// Lists all blobs under the storage path grouped by the table they belong to
+func (storage *StorageAzure) IcebergStorageFiles() (icebergStorageFiles map[IcebergSchemaTable][]IcebergTableFile, err error) {
+	icebergStorageFiles = make(map[IcebergSchemaTable][]IcebergTableFile)
+	icebergTableFiles, err := storage.listBlobs(storage.storagePrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, icebergTableFile := range icebergTableFiles {
+		schemaTable, ok := icebergStorageFileSchemaTable(strings.TrimPrefix(icebergTableFile.Path, storage.storagePrefix()))
+		if !ok {
+			continue
+		}
+
+		icebergTableFile.Path = storage.fullContainerPath() + icebergTableFile.Path
+		icebergStorageFiles[schemaTable] = append(icebergStorageFiles[schemaTable], icebergTableFile)
+	}
+
+	return icebergStorageFiles, nil
+}
+
+func (storage *StorageAzure) ReadIcebergTableFile(path string) (content []byte, err error) {
+	blobClient := storage.containerClient.NewBlobClient(strings.TrimPrefix(path, storage.fullContainerPath()))
+	downloadResponse, err := blobClient.DownloadStream(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer downloadResponse.Body.Close()
+
+	return io.ReadAll(downloadResponse.Body)
+}
+
+func (storage *StorageAzure) currentSnapshotFilePaths(metadataDirPath string) (dataFilePaths Set[string], deleteFilePaths Set[string], manifestEntries map[string]IcebergManifestEntry, err error) {
+	_, metadataContent, err := storage.storageBase.ReadCurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil || metadataContent == nil {
+		return NewSet([]string{}), NewSet([]string{}), map[string]IcebergManifestEntry{}, err
+	}
+
+	return storage.storageBase.CurrentSnapshotFilePaths(metadataContent, storage.ReadIcebergTableFile)
+}
+
+// Returns the data files or the delete files of the current snapshot, depending on the content
+func (storage *StorageAzure) icebergParquetFiles(icebergSchemaTable IcebergSchemaTable, content int) (parquetFiles []ParquetFile, err error) {
+	dataFilePaths, deleteFilePaths, manifestEntries, err := storage.currentSnapshotFilePaths(storage.fullContainerPath() + storage.tablePrefix(icebergSchemaTable, true) + "metadata")
+	if err != nil {
+		return nil, err
+	}
+	contentFilePaths := dataFilePaths
+	if content == ICEBERG_CONTENT_POSITION_DELETES {
+		contentFilePaths = deleteFilePaths
+	}
+
+	icebergTableFiles, err := storage.listBlobs(storage.tablePrefix(icebergSchemaTable, true) + "data/")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, icebergTableFile := range icebergTableFiles {
+		if !strings.HasSuffix(icebergTableFile.Path, ".parquet") || !contentFilePaths.Contains(storage.fullContainerPath()+icebergTableFile.Path) {
+			continue
+		}
+
+		parquetFile, err := storage.readParquetFile(icebergTableFile.Path, icebergTableFile.Size)
+		if err != nil {
+			return nil, err
+		}
+		manifestEntry := manifestEntries[storage.fullContainerPath()+icebergTableFile.Path]
+		parquetFile.Content = manifestEntry.Content
+		parquetFile.PartitionValue = manifestEntry.PartitionValue
+		parquetFile.SequenceNumber = manifestEntry.SequenceNumber
+		parquetFile.EqualityFieldIds = manifestEntry.EqualityFieldIds
+		parquetFiles = append(parquetFiles, parquetFile)
+	}
+
+	return parquetFiles, nil
+}
+
+// Returns nil content if the blob doesn't exist
+func (storage *StorageAzure) readIcebergTableFileIfExists(path string) (content []byte, err error) {
+	content, err = storage.ReadIcebergTableFile(path)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// Write ---------------------------------------------------------------------------------------------------------------
+
+func (storage *StorageAzure) DeleteSchema(schema string) (err error) {
+	return storage.deleteNestedBlobs(storage.storagePrefix() + schema + "/")
+}
+
+func (storage *StorageAzure) DeleteSchemaTable(schemaTable IcebergSchemaTable) (err error) {
+	return storage.deleteNestedBlobs(storage.tablePrefix(schemaTable))
+}
+
+func (storage *StorageAzure) CreateDataDir(schemaTable IcebergSchemaTable) (dataDirPath string) {
+	return storage.tablePrefix(schemaTable) + "data"
+}
+
+func (storage *StorageAzure) CreateMetadataDir(schemaTable IcebergSchemaTable) (metadataDirPath string) {
+	return storage.tablePrefix(schemaTable) + "metadata"
+}
+
+func (storage *StorageAzure) CreateParquet(dataDirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (parquetFile ParquetFile, err error) {
+	uuid := uuid.New().String()
+	fileName := fmt.Sprintf("00000-0-%s.parquet", uuid)
+	blobName := dataDirPath + "/" + fileName
+
+	fileWriter, err := storage.parquetFileWriter(blobName)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	recordCount, err := storage.storageBase.WriteParquetFile(fileWriter, pgSchemaColumns, loadRows)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet file with", recordCount, "record(s) created at:", blobName)
+
+	fileSize, err := storage.blobSize(blobName)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	fileReader, err := storage.parquetFileReader(blobName)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+	parquetStats, err := storage.storageBase.ReadParquetStats(fileReader)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	return ParquetFile{
+		Uuid:        uuid,
+		Path:        blobName,
+		Size:        fileSize,
+		RecordCount: recordCount,
+		Stats:       parquetStats,
+	}, nil
+}
+
+func (storage *StorageAzure) CurrentMetadataVersion(metadataDirPath string) (version int64, err error) {
+	return storage.storageBase.CurrentMetadataVersion(metadataDirPath, storage.readIcebergTableFileIfExists)
+}
+
+func (storage *StorageAzure) NextSequenceNumber(metadataDirPath string, baseVersion int64) (sequenceNumber int64, err error) {
+	return storage.storageBase.NextSequenceNumber(metadataDirPath, baseVersion, storage.readIcebergTableFileIfExists)
+}
+
+func (storage *StorageAzure) ResolvePartitionSpec(metadataDirPath string, partitionFields []IcebergPartitionField) (partitionSpec IcebergPartitionSpec, err error) {
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return IcebergPartitionSpec{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return IcebergPartitionSpec{}, err
+	}
+
+	return storage.storageBase.ResolvePartitionSpec(partitionFields, previousMetadataContent)
+}
+
+func (storage *StorageAzure) CreateManifest(metadataDirPath string, snapshotId int64, sequenceNumber int64, partitionSpec IcebergPartitionSpec, parquetFiles []ParquetFile) (manifestFile ManifestFile, err error) {
+	fileName := fmt.Sprintf("%s-m0.avro", uuid.New().String())
+	filePath := metadataDirPath + "/" + fileName
+
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer DeleteTemporaryFile(tempFile)
+
+	manifestFile, err = storage.storageBase.WriteManifestFile(storage.fullContainerPath(), tempFile.Name(), snapshotId, sequenceNumber, partitionSpec, parquetFiles)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+
+	err = storage.uploadFile(filePath, tempFile)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Manifest file created at:", filePath)
+
+	manifestFile.Path = filePath
+	return manifestFile, nil
+}
+
+func (storage *StorageAzure) CreateManifestList(metadataDirPath string, parquetFiles []ParquetFile, manifestFiles []ManifestFile) (manifestListFile ManifestListFile, err error) {
+	fileName := fmt.Sprintf("snap-%d-0-%s.avro", manifestFiles[0].SnapshotId, parquetFiles[0].Uuid)
+	filePath := metadataDirPath + "/" + fileName
+
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
+	if err != nil {
+		return ManifestListFile{}, err
+	}
+	defer DeleteTemporaryFile(tempFile)
+
+	err = storage.storageBase.WriteManifestListFile(storage.fullContainerPath(), tempFile.Name(), manifestFiles)
+	if err != nil {
+		return ManifestListFile{}, err
+	}
+
+	err = storage.uploadFile(filePath, tempFile)
+	if err != nil {
+		return ManifestListFile{}, err
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Manifest list file created at:", filePath)
+
+	return ManifestListFile{Path: filePath}, nil
+}
+
+func (storage *StorageAzure) CreateMetadata(metadataDirPath string, baseVersion int64, icebergSchemaFields []IcebergSchemaField, partitionSpec IcebergPartitionSpec, properties map[string]string, parquetFiles []ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	defer DeleteTemporaryFile(tempFile)
+
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	err = storage.storageBase.CheckBaseMetadataVersion(metadataDirPath, baseVersion, previousMetadataFile, previousMetadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	metadataFile = storage.storageBase.NextMetadataFile(metadataDirPath, previousMetadataFile, previousMetadataContent)
+
+	metadataFile.ExpiredPaths, err = storage.storageBase.WriteMetadataFile(storage.fullContainerPath(), tempFile.Name(), icebergSchemaFields, partitionSpec, properties, parquetFiles, manifestFile, manifestListFile, previousMetadataFile.Path, previousMetadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+
+	// The new metadata file is uploaded before the version hint is updated, so readers never see a missing file.
+	// The conditional upload fails if another writer has created the same version in the meantime
+	anyETag := azcore.ETagAny
+	_, err = storage.containerClient.NewBlockBlobClient(metadataFile.Path).UploadFile(context.Background(), tempFile, &blockblob.UploadFileOptions{
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &anyETag}},
+	})
+	if bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+		return MetadataFile{}, storage.storageBase.ExistingMetadataFileError(metadataFile)
+	}
+	if err != nil {
+		return MetadataFile{}, fmt.Errorf("failed to upload file: %v", err)
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Metadata file created at:", metadataFile.Path)
+
+	return metadataFile, nil
+}
+
+func (storage *StorageAzure) CreateNextMetadata(icebergSchemaTable IcebergSchemaTable, baseVersion int64, metadataContent []byte) (metadataFile MetadataFile, err error) {
+	metadataDirPath := storage.tablePrefix(icebergSchemaTable, true) + "metadata"
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	err = storage.storageBase.CheckBaseMetadataVersion(metadataDirPath, baseVersion, previousMetadataFile, previousMetadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	metadataFile = storage.storageBase.NextMetadataFile(metadataDirPath, previousMetadataFile, previousMetadataContent)
+
+	nextMetadataContent, expiredPaths, err := storage.storageBase.NextMetadataContent(storage.fullContainerPath()+previousMetadataFile.Path, previousMetadataContent, metadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	metadataFile.ExpiredPaths = expiredPaths
+
+	// Like in CreateMetadata, the conditional upload fails if another writer has created the same version in the meantime
+	anyETag := azcore.ETagAny
+	_, err = storage.containerClient.NewBlockBlobClient(metadataFile.Path).UploadBuffer(context.Background(), nextMetadataContent, &blockblob.UploadBufferOptions{
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &anyETag}},
+	})
+	if bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+		return MetadataFile{}, storage.storageBase.ExistingMetadataFileError(metadataFile)
+	}
+	if err != nil {
+		return MetadataFile{}, fmt.Errorf("failed to upload file: %v", err)
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Metadata file created at:", metadataFile.Path)
+
+	return metadataFile, storage.CreateVersionHint(metadataDirPath, metadataFile)
+}
+
+func (storage *StorageAzure) CreateVersionHint(metadataDirPath string, metadataFile MetadataFile) (err error) {
+	filePath := metadataDirPath + "/" + VERSION_HINT_FILE_NAME
+
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
+	if err != nil {
+		return err
+	}
+	defer DeleteTemporaryFile(tempFile)
+
+	err = storage.storageBase.WriteVersionHintFile(tempFile.Name(), metadataFile)
+	if err != nil {
+		return err
+	}
+
+	err = storage.uploadFile(filePath, tempFile)
+	if err != nil {
+		return err
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Version hint file created at:", filePath)
+
+	return nil
+}
+
+func (storage *StorageAzure) MergeParquet(dataDirPath string, parquetFiles []ParquetFile) (parquetFile ParquetFile, err error) {
+	uuid := uuid.New().String()
+	fileName := fmt.Sprintf("00000-0-%s.parquet", uuid)
+	blobName := dataDirPath + "/" + fileName
+
+	var fileReaders []source.ParquetFile
+	for _, parquetFile := range parquetFiles {
+		fileReader, err := storage.parquetFileReader(parquetFile.Path)
+		if err != nil {
+			return ParquetFile{}, err
+		}
+		fileReaders = append(fileReaders, fileReader)
+	}
+
+	fileWriter, err := storage.parquetFileWriter(blobName)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	recordCount, err := storage.storageBase.MergeParquetFiles(fileReaders, fileWriter)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet file with", recordCount, "record(s) merged from", len(parquetFiles), "file(s) at:", blobName)
+
+	fileSize, err := storage.blobSize(blobName)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	return storage.readParquetFile(blobName, fileSize)
+}
+
+func (storage *StorageAzure) DeleteParquet(parquetFile ParquetFile) (err error) {
+	return storage.deleteBlob(parquetFile.Path)
+}
+
+func (storage *StorageAzure) WriteIcebergTableFile(path string, content []byte) (err error) {
+	blockBlobClient := storage.containerClient.NewBlockBlobClient(strings.TrimPrefix(path, storage.fullContainerPath()))
+	_, err = blockBlobClient.UploadBuffer(context.Background(), content, nil)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageAzure) DeleteIcebergTableFile(path string) (err error) {
+	return storage.deleteBlob(strings.TrimPrefix(path, storage.fullContainerPath()))
+}
+
+func (storage *StorageAzure) readParquetFile(blobName string, fileSize int64) (parquetFile ParquetFile, err error) {
+	fileReader, err := storage.parquetFileReader(blobName)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+	recordCount, err := storage.storageBase.ReadParquetRecordCount(fileReader)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	fileReader, err = storage.parquetFileReader(blobName)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+	parquetStats, err := storage.storageBase.ReadParquetStats(fileReader)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	fileName := blobName[strings.LastIndex(blobName, "/")+1:]
+	return ParquetFile{
+		Uuid:        strings.TrimSuffix(strings.TrimPrefix(fileName, "00000-0-"), ".parquet"),
+		Path:        blobName,
+		Size:        fileSize,
+		RecordCount: recordCount,
+		Stats:       parquetStats,
+	}, nil
+}
+
+func (storage *StorageAzure) parquetFileReader(blobName string) (source.ParquetFile, error) {
+	blockBlobClient := storage.containerClient.NewBlockBlobClient(blobName)
+	fileReader, err := parquetAzblob.NewAzBlobFileReaderWithClient(context.Background(), blockBlobClient.URL(), blockBlobClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+	}
+	return fileReader, nil
+}
+
+func (storage *StorageAzure) parquetFileWriter(blobName string) (source.ParquetFile, error) {
+	blockBlobClient := storage.containerClient.NewBlockBlobClient(blobName)
+	fileWriter, err := parquetAzblob.NewAzBlobFileWriterWithClient(context.Background(), blockBlobClient.URL(), blockBlobClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Parquet file for writing: %v", err)
+	}
+	return fileWriter, nil
+}
+
+func (storage *StorageAzure) blobSize(blobName string) (int64, error) {
+	propertiesResponse, err := storage.containerClient.NewBlobClient(blobName).GetProperties(context.Background(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Parquet file info: %v", err)
+	}
+	return *propertiesResponse.ContentLength, nil
+}
+
+func (storage *StorageAzure) uploadFile(filePath string, file *os.File) (err error) {
+	_, err = storage.containerClient.NewBlockBlobClient(filePath).UploadFile(context.Background(), file, nil)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageAzure) deleteBlob(blobName string) (err error) {
+	_, err = storage.containerClient.NewBlobClient(blobName).Delete(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageAzure) tablePrefix(schemaTable IcebergSchemaTable, isIcebergSchemaTable ...bool) string {
+	if len(isIcebergSchemaTable) > 0 && isIcebergSchemaTable[0] {
+		return storage.storagePrefix() + schemaTable.Schema + "/" + schemaTable.Table + "/"
+	}
+
+	return storage.storagePrefix() + storage.config.Pg.SchemaPrefix + schemaTable.Schema + "/" + schemaTable.Table + "/"
+}
+
+func (storage *StorageAzure) storagePrefix() string {
+	if storage.config.Azure.PathPrefix == "" {
+		return ""
+	}
+	return storage.config.Azure.PathPrefix + "/"
+}
+
+func (storage *StorageAzure) fullContainerPath() string {
+	return "az://" + storage.config.Azure.Container + "/"
+}
+
+func (storage *StorageAzure) nestedDirectoryPrefixes(prefix string) (dirs []string, err error) {
+	pager := storage.containerClient.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
+		Prefix: &prefix,
+	})
+
+	for pager.More() {
+		listResponse, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs: %v", err)
+		}
+
+		for _, blobPrefix := range listResponse.Segment.BlobPrefixes {
+			dirs = append(dirs, *blobPrefix.Name)
+		}
+	}
+
+	return dirs, nil
+}
+
+func (storage *StorageAzure) listBlobs(prefix string) (icebergTableFiles []IcebergTableFile, err error) {
+	pager := storage.containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix: &prefix,
+	})
+
+	for pager.More() {
+		listResponse, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs: %v", err)
+		}
+
+		for _, blobItem := range listResponse.Segment.BlobItems {
+			icebergTableFile := IcebergTableFile{Path: *blobItem.Name}
+			if blobItem.Properties.ContentLength != nil {
+				icebergTableFile.Size = *blobItem.Properties.ContentLength
+			}
+			if blobItem.Properties.LastModified != nil {
+				icebergTableFile.LastModified = *blobItem.Properties.LastModified
+			}
+			icebergTableFiles = append(icebergTableFiles, icebergTableFile)
+		}
+	}
+
+	return icebergTableFiles, nil
+}
+
+func (storage *StorageAzure) deleteNestedBlobs(prefix string) (err error) {
+	icebergTableFiles, err := storage.listBlobs(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, icebergTableFile := range icebergTableFiles {
+		LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Blob to delete:", icebergTableFile.Path)
+		err = storage.deleteBlob(icebergTableFile.Path)
+		if err != nil {
+			return err
+		}
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Deleted", len(icebergTableFiles), "blob(s).")
+
+	return nil
+}
+
+// Parses "az://container/prefix" and "abfss://container@account.dfs.core.windows.net/prefix" storage paths
+func ParseAzureStoragePath(storagePath string) (containerName string, accountName string, pathPrefix string, err error) {
+	parsedUrl, err := url.Parse(storagePath)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	switch parsedUrl.Scheme {
+	case "az":
+		containerName = parsedUrl.Host
+	case "abfss":
+		containerName = parsedUrl.User.Username()
+		accountName, _, _ = strings.Cut(parsedUrl.Hostname(), ".")
+	default:
+		return "", "", "", fmt.Errorf("unsupported scheme %q, expected az:// or abfss://", parsedUrl.Scheme)
+	}
+
+	if containerName == "" {
+		return "", "", "", fmt.Errorf("missing container name")
+	}
+
+	return containerName, accountName, strings.Trim(parsedUrl.Path, "/"), nil
+}
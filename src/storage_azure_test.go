@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+const (
+	AZURITE_ACCOUNT_NAME = "devstoreaccount1"
+	AZURITE_ACCOUNT_KEY  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+func TestParseAzureStoragePath(t *testing.T) {
+	t.Run("parses az:// paths", func(t *testing.T) {
+		container, accountName, pathPrefix, err := ParseAzureStoragePath("az://my-container/path/to/iceberg/")
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if container != "my-container" || accountName != "" || pathPrefix != "path/to/iceberg" {
+			t.Errorf("Expected my-container, empty account and path/to/iceberg, got %s, %s, %s", container, accountName, pathPrefix)
+		}
+	})
+
+	t.Run("parses abfss:// paths", func(t *testing.T) {
+		container, accountName, pathPrefix, err := ParseAzureStoragePath("abfss://my-container@myaccount.dfs.core.windows.net/iceberg")
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if container != "my-container" || accountName != "myaccount" || pathPrefix != "iceberg" {
+			t.Errorf("Expected my-container, myaccount and iceberg, got %s, %s, %s", container, accountName, pathPrefix)
+		}
+	})
+
+	t.Run("returns an error for other paths", func(t *testing.T) {
+		for _, storagePath := range []string{"iceberg", "s3://bucket/iceberg", "abfss://myaccount.dfs.core.windows.net/iceberg"} {
+			_, _, _, err := ParseAzureStoragePath(storagePath)
+
+			if err == nil {
+				t.Errorf("Expected an error for %s, got nil", storagePath)
+			}
+		}
+	})
+}
+
+// Runs against Azurite if its Blob service endpoint is set, e.g. AZURITE_BLOB_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1
+func TestAzureStorage(t *testing.T) {
+	azuriteBlobEndpoint := os.Getenv("AZURITE_BLOB_ENDPOINT")
+	if azuriteBlobEndpoint == "" {
+		t.Skip("AZURITE_BLOB_ENDPOINT is not set")
+	}
+
+	t.Run("writes, reads and deletes Iceberg tables", func(t *testing.T) {
+		config := loadTestConfig()
+		config.StorageType = STORAGE_TYPE_AZURE
+		config.StoragePath = "az://bemidb-test/iceberg"
+		config.Azure = AzureConfig{
+			AccountName: AZURITE_ACCOUNT_NAME,
+			AccountKey:  AZURITE_ACCOUNT_KEY,
+			Endpoint:    azuriteBlobEndpoint,
+			Container:   "bemidb-test",
+			PathPrefix:  "iceberg",
+		}
+		storage := NewAzureStorage(config)
+		_, err := storage.containerClient.Create(context.Background(), nil)
+		if err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		icebergWriter := &IcebergWriter{config: config, storage: storage}
+		schemaTable := IcebergSchemaTable{Schema: "test_azure", Table: "test_table"}
+
+		loaded := false
+		icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return PUBLIC_TEST_TABLE_LOADED_ROWS
+		})
+
+		icebergSchemaTables, err := storage.IcebergSchemaTables()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !icebergSchemaTables.Contains(schemaTable) {
+			t.Errorf("Expected %s to be listed, got %v", schemaTable.String(), icebergSchemaTables)
+		}
+
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS[0].ColumnName})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(rows) != len(PUBLIC_TEST_TABLE_LOADED_ROWS) {
+			t.Errorf("Expected %d rows, got %d", len(PUBLIC_TEST_TABLE_LOADED_ROWS), len(rows))
+		}
+
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		PanicIfError(err)
+		metadataContent, err := storage.ReadIcebergTableFile(metadataPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		icebergSchemaFields, err := storage.storageBase.ParseIcebergSchemaFields(metadataContent)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(icebergSchemaFields) != len(PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS) {
+			t.Errorf("Expected %d fields, got %d", len(PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS), len(icebergSchemaFields))
+		}
+
+		err = storage.DeleteSchema(schemaTable.Schema)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		icebergTableFiles, err := storage.IcebergTableFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(icebergTableFiles) != 0 {
+			t.Errorf("Expected all files to be deleted, got %v", icebergTableFiles)
+		}
+		_, err = storage.ReadIcebergTableFile(metadataPath)
+		if err == nil || !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			t.Errorf("Expected a BlobNotFound error, got %v", err)
+		}
+	})
+}
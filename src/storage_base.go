@@ -2,38 +2,68 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/google/uuid"
 	"github.com/linkedin/goavro"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/layout"
+	"github.com/xitongsys/parquet-go/marshal"
 	"github.com/xitongsys/parquet-go/parquet"
 	"github.com/xitongsys/parquet-go/reader"
 	"github.com/xitongsys/parquet-go/schema"
 	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
 	"github.com/xitongsys/parquet-go/writer"
 )
 
 const (
-	PARQUET_PARALLEL_NUMBER  = 4
-	PARQUET_ROW_GROUP_SIZE   = 64 * 1024 * 1024 // 64 MB
-	PARQUET_COMPRESSION_TYPE = parquet.CompressionCodec_ZSTD
+	PARQUET_PARALLEL_NUMBER = 4
 
-	VERSION_HINT_FILE_NAME = "version-hint.text"
+	PARQUET_MAGIC_NUMBER = "PAR1"
+
+	VERSION_HINT_FILE_NAME         = "version-hint.text"
+	ICEBERG_METADATA_FILE_PREFIX   = "v"
+	ICEBERG_METADATA_FILE_SUFFIX   = ".metadata.json"
+	ICEBERG_FIRST_METADATA_VERSION = 1
+	ICEBERG_METADATA_READ_ATTEMPTS = 5
+
+	ICEBERG_PROPERTY_ENUM_LABELS_PREFIX = "bemidb.enum-labels."
+	ICEBERG_PROPERTY_PG_SCHEMA_COLUMNS  = "bemidb.pg-schema-columns"
+	ICEBERG_PROPERTY_PRIMARY_KEY        = "bemidb.primary-key"
+	ICEBERG_PROPERTY_UNIQUE_KEYS        = "bemidb.unique-keys"
+	ICEBERG_PROPERTY_NAME_MAPPING       = "schema.name-mapping.default"
 )
 
+var errParquetSchemaMismatch = errors.New("failed to merge Parquet files with different schemas")
+
+// Another writer committed a snapshot of the table after the version that a commit is based on
+var errConcurrentModification = errors.New("concurrent modification")
+
 type MetadataJson struct {
-	Schemas []struct {
-		Fields []struct {
+	CurrentSchemaId int `json:"current-schema-id"`
+	Schemas         []struct {
+		SchemaId int `json:"schema-id"`
+		Fields   []struct {
 			ID       int         `json:"id"`
 			Name     string      `json:"name"`
 			Type     interface{} `json:"type"`
 			Required bool        `json:"required"`
+			Doc      string      `json:"doc"`
 		} `json:"fields"`
 	} `json:"schemas"`
 }
@@ -42,19 +72,35 @@ type StorageBase struct {
 	config *Config
 }
 
+// A previous version of a table that can be read with time travel
+type IcebergSnapshot struct {
+	Id          int64
+	TableFields []IcebergTableField // of the schema that the snapshot was written with
+}
+
 func (storage *StorageBase) ParseIcebergTableFields(metadataContent []byte) ([]IcebergTableField, error) {
+	return ParseIcebergTableFields(metadataContent)
+}
+
+// Returns the fields of the current schema
+func ParseIcebergTableFields(metadataContent []byte) ([]IcebergTableField, error) {
 	var metadataJson MetadataJson
 	err := json.Unmarshal(metadataContent, &metadataJson)
 	if err != nil {
 		return nil, err
 	}
 
+	return parseIcebergSchemaTableFields(metadataJson, metadataJson.CurrentSchemaId), nil
+}
+
+func parseIcebergSchemaTableFields(metadataJson MetadataJson, schemaId int) []IcebergTableField {
 	var icebergTableFields []IcebergTableField
 	for _, schema := range metadataJson.Schemas {
-		if schema.Fields != nil {
+		if schema.SchemaId == schemaId && schema.Fields != nil {
 			for _, field := range schema.Fields {
 				icebergTableField := IcebergTableField{
 					Name: field.Name,
+					Doc:  field.Doc,
 				}
 
 				if reflect.TypeOf(field.Type).Kind() == reflect.String {
@@ -72,7 +118,138 @@ func (storage *StorageBase) ParseIcebergTableFields(metadataContent []byte) ([]I
 		}
 	}
 
-	return icebergTableFields, nil
+	return icebergTableFields
+}
+
+// Returns the highest field ID ever assigned in the table, which new fields must not reuse.
+// Field IDs of all schemas are considered since tables written before tracking it have a placeholder last-column-id
+func ParseIcebergLastColumnId(metadataContent []byte) (int, error) {
+	history, err := parseIcebergMetadataHistory(metadataContent)
+	if err != nil {
+		return 0, err
+	}
+	return history.lastColumnId()
+}
+
+type icebergSnapshotLog struct {
+	Snapshots []struct {
+		SnapshotId json.Number `json:"snapshot-id"`
+		SchemaId   *int        `json:"schema-id"`
+	} `json:"snapshots"`
+	SnapshotLog []struct {
+		SnapshotId  json.Number `json:"snapshot-id"`
+		TimestampMs int64       `json:"timestamp-ms"`
+	} `json:"snapshot-log"`
+	MetadataLog []struct {
+		MetadataFile string `json:"metadata-file"`
+	} `json:"metadata-log"`
+}
+
+func parseIcebergSnapshotLog(metadataContent []byte) (snapshotLog icebergSnapshotLog, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	if err := decoder.Decode(&snapshotLog); err != nil {
+		return snapshotLog, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	return snapshotLog, nil
+}
+
+// Returns the snapshot that was current at the given time according to the snapshot log,
+// nil if the table didn't exist yet or the snapshot has already expired
+func ParseIcebergSnapshotAsOf(metadataContent []byte, asOf time.Time) (*IcebergSnapshot, error) {
+	var metadataJson MetadataJson
+	err := json.Unmarshal(metadataContent, &metadataJson)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotLog, err := parseIcebergSnapshotLog(metadataContent)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshotId json.Number
+	for _, logEntry := range snapshotLog.SnapshotLog {
+		if logEntry.TimestampMs <= asOf.UnixMilli() {
+			snapshotId = logEntry.SnapshotId
+		}
+	}
+	if snapshotId == "" {
+		return nil, nil
+	}
+
+	for _, snapshot := range snapshotLog.Snapshots {
+		if snapshot.SnapshotId != snapshotId {
+			continue
+		}
+
+		id, err := snapshotId.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot ID: %v", err)
+		}
+		schemaId := metadataJson.CurrentSchemaId
+		if snapshot.SchemaId != nil {
+			schemaId = *snapshot.SchemaId
+		}
+		return &IcebergSnapshot{Id: id, TableFields: parseIcebergSchemaTableFields(metadataJson, schemaId)}, nil
+	}
+	return nil, nil
+}
+
+// Returns the earliest time that the table can be read as of, when the oldest snapshot that hasn't expired became current.
+// nil if the table has no snapshots
+func ParseIcebergHistoryStart(metadataContent []byte) (*time.Time, error) {
+	snapshotLog, err := parseIcebergSnapshotLog(metadataContent)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotIds := make(Set[json.Number])
+	for _, snapshot := range snapshotLog.Snapshots {
+		snapshotIds.Add(snapshot.SnapshotId)
+	}
+	for _, logEntry := range snapshotLog.SnapshotLog {
+		if snapshotIds.Contains(logEntry.SnapshotId) {
+			historyStart := time.UnixMilli(logEntry.TimestampMs).UTC()
+			return &historyStart, nil
+		}
+	}
+	return nil, nil
+}
+
+func (storage *StorageBase) ParseIcebergSchemaFields(metadataContent []byte) ([]IcebergSchemaField, error) {
+	var metadataJson struct {
+		CurrentSchemaId int `json:"current-schema-id"`
+		Schemas         []struct {
+			SchemaId int                  `json:"schema-id"`
+			Fields   []IcebergSchemaField `json:"fields"`
+		} `json:"schemas"`
+	}
+	err := json.Unmarshal(metadataContent, &metadataJson)
+	if err != nil {
+		return nil, err
+	}
+
+	var icebergSchemaFields []IcebergSchemaField
+	for _, schema := range metadataJson.Schemas {
+		if schema.SchemaId == metadataJson.CurrentSchemaId {
+			icebergSchemaFields = append(icebergSchemaFields, schema.Fields...)
+		}
+	}
+
+	return icebergSchemaFields, nil
+}
+
+func (storage *StorageBase) ParseIcebergTableProperties(metadataContent []byte) (map[string]string, error) {
+	var metadataJson struct {
+		Properties map[string]string `json:"properties"`
+	}
+	err := json.Unmarshal(metadataContent, &metadataJson)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadataJson.Properties, nil
 }
 
 func (storage *StorageBase) WriteParquetFile(fileWriter source.ParquetFile, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (recordCount int64, err error) {
@@ -84,26 +261,34 @@ func (storage *StorageBase) WriteParquetFile(fileWriter source.ParquetFile, pgSc
 	}
 	for _, pgSchemaColumn := range pgSchemaColumns {
 		fieldMap := pgSchemaColumn.ToParquetSchemaFieldMap()
+		setParquetDictionaryEncoding(storage.config, pgSchemaColumn, fieldMap)
 		schemaMap["Fields"] = append(schemaMap["Fields"].([]map[string]interface{}), fieldMap)
 	}
 	schemaJson, err := json.Marshal(schemaMap)
 	PanicIfError(err)
 
-	LogDebug(storage.config, "Parquet schema:", string(schemaJson))
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet schema:", string(schemaJson))
 	parquetWriter, err := writer.NewJSONWriter(string(schemaJson), fileWriter, PARQUET_PARALLEL_NUMBER)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create Parquet writer: %v", err)
 	}
 
-	parquetWriter.RowGroupSize = PARQUET_ROW_GROUP_SIZE
-	parquetWriter.CompressionType = PARQUET_COMPRESSION_TYPE
+	renameParquetSchemaFields(parquetWriter.SchemaHandler, pgSchemaColumns)
+
+	parquetWriter.RowGroupSize = storage.config.Iceberg.RowGroupSize
+	parquetWriter.CompressionType = parquetCompressionCodec(storage.config)
+	parquetWriter.MarshalFunc = marshalParquetJsonRows
 
+	nullInfinityCounts := make(map[string]int)
 	rows := loadRows()
 	for len(rows) > 0 {
 		for _, row := range rows {
 			rowMap := make(map[string]interface{})
 			for i, rowValue := range row {
 				rowMap[pgSchemaColumns[i].ColumnName] = pgSchemaColumns[i].FormatParquetValue(rowValue)
+				if pgSchemaColumns[i].IsInfinitySyncedAsNull(rowValue) {
+					nullInfinityCounts[pgSchemaColumns[i].ColumnName]++
+				}
 			}
 			rowJson, err := json.Marshal(rowMap)
 			PanicIfError(err)
@@ -112,12 +297,29 @@ func (storage *StorageBase) WriteParquetFile(fileWriter source.ParquetFile, pgSc
 				return 0, fmt.Errorf("Write error: %v", err)
 			}
 			recordCount++
+
+			if rowGroupRows := storage.config.Iceberg.RowGroupRows; rowGroupRows > 0 && recordCount%int64(rowGroupRows) == 0 {
+				if err = parquetWriter.Flush(true); err != nil {
+					return 0, fmt.Errorf("failed to flush Parquet row group: %v", err)
+				}
+			}
 		}
 
+		// Leave the remaining rows for the next file once the written and buffered pages reach the target file size
+		if targetFileSize := storage.config.Iceberg.TargetFileSizeBytes; targetFileSize > 0 && parquetWriter.Offset+parquetWriter.Size >= targetFileSize {
+			LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet file reached the target file size of", targetFileSize, "bytes")
+			break
+		}
 		rows = loadRows()
 	}
 
-	LogDebug(storage.config, "Stopping Parquet writer...")
+	for _, pgSchemaColumn := range pgSchemaColumns {
+		if count := nullInfinityCounts[pgSchemaColumn.ColumnName]; count > 0 {
+			LogComponentWarn(storage.config, LOG_COMPONENT_ICEBERG, fmt.Sprintf("Synced %d infinite value(s) of column %s as NULL", count, pgSchemaColumn.ColumnName))
+		}
+	}
+
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Stopping Parquet writer...")
 	if err := parquetWriter.WriteStop(); err != nil {
 		return 0, fmt.Errorf("failed to stop Parquet writer: %v", err)
 	}
@@ -144,6 +346,13 @@ func (storage *StorageBase) ReadParquetStats(fileReader source.ParquetFile) (par
 	}
 
 	fieldIDMap := storage.buildFieldIDMap(pr.SchemaHandler)
+	boundSchemaElements := storage.buildBoundSchemaElements(pr.SchemaHandler)
+
+	// Bounds of row groups are merged as typed values, since Parquet statistics are little-endian for numbers and don't sort as bytes
+	boundTypes := make(map[int]string)
+	lowerValues := make(map[int]interface{})
+	upperValues := make(map[int]interface{})
+	unboundedFieldIDs := make(Set[int])
 
 	for _, rowGroup := range pr.Footer.RowGroups {
 		if rowGroup.FileOffset != nil {
@@ -161,306 +370,1270 @@ func (storage *StorageBase) ReadParquetStats(fileReader source.ParquetFile) (par
 			parquetStats.ColumnSizes[fieldID] += columnMetaData.TotalCompressedSize
 			parquetStats.ValueCounts[fieldID] += int64(columnMetaData.NumValues)
 
-			if columnMetaData.Statistics != nil {
-				if columnMetaData.Statistics.NullCount != nil {
-					parquetStats.NullValueCounts[fieldID] += *columnMetaData.Statistics.NullCount
-				}
-
-				minValue := columnMetaData.Statistics.Min
-				maxValue := columnMetaData.Statistics.Max
+			statistics := columnMetaData.Statistics
+			if statistics != nil && statistics.NullCount != nil {
+				parquetStats.NullValueCounts[fieldID] += *statistics.NullCount
+			}
 
-				if parquetStats.LowerBounds[fieldID] == nil || bytes.Compare(parquetStats.LowerBounds[fieldID], minValue) > 0 {
-					parquetStats.LowerBounds[fieldID] = minValue
-				}
-				if parquetStats.UpperBounds[fieldID] == nil || bytes.Compare(parquetStats.UpperBounds[fieldID], maxValue) < 0 {
-					parquetStats.UpperBounds[fieldID] = maxValue
+			schemaElement, ok := boundSchemaElements[columnName]
+			if !ok {
+				continue
+			}
+			boundTypes[fieldID] = parquetColumnBoundType(schemaElement)
+			if statistics == nil || statistics.Min == nil || statistics.Max == nil {
+				// Column chunks with only NULL values have no min and max values
+				if statistics == nil || statistics.NullCount == nil || *statistics.NullCount != columnMetaData.NumValues {
+					unboundedFieldIDs.Add(fieldID)
 				}
+				continue
+			}
+
+			minValue := parquetStatisticBoundValue(schemaElement, statistics.Min)
+			maxValue := parquetStatisticBoundValue(schemaElement, statistics.Max)
+			if minValue == nil || maxValue == nil {
+				unboundedFieldIDs.Add(fieldID)
+				continue
+			}
+			if comparison, ok := compareIcebergBoundValues(minValue, lowerValues[fieldID]); !ok || comparison < 0 {
+				lowerValues[fieldID] = minValue
+			}
+			if comparison, ok := compareIcebergBoundValues(maxValue, upperValues[fieldID]); !ok || comparison > 0 {
+				upperValues[fieldID] = maxValue
 			}
 		}
 	}
 
-	// Todo: convert lower/upper bytes to BigEndianBytes?
+	for fieldID, lowerValue := range lowerValues {
+		if unboundedFieldIDs.Contains(fieldID) {
+			continue
+		}
+		lowerBound, upperBound := icebergColumnBounds(boundTypes[fieldID], lowerValue, upperValues[fieldID])
+		if lowerBound != nil {
+			parquetStats.LowerBounds[fieldID] = lowerBound
+		}
+		if upperBound != nil {
+			parquetStats.UpperBounds[fieldID] = upperBound
+		}
+	}
 
 	return parquetStats, nil
 }
 
-func (storage *StorageBase) WriteManifestFile(fileSystemPrefix string, filePath string, parquetFile ParquetFile) (manifestFile ManifestFile, err error) {
-	snapshotId := time.Now().UnixNano()
-	codec, err := goavro.NewCodec(MANIFEST_SCHEMA)
-	if err != nil {
-		return ManifestFile{}, fmt.Errorf("failed to create Avro codec: %v", err)
+// JSON rows contain binary values as base64 strings (see json.Marshal for []byte), which are decoded back into bytes
+func marshalParquetJsonRows(rows []interface{}, schemaHandler *schema.SchemaHandler) (*map[string]*layout.Table, error) {
+	var jsonRows []map[string]interface{}
+	listColumnElements := parquetListColumnElements(schemaHandler)
+	if len(listColumnElements) > 0 {
+		var err error
+		jsonRows, err = unmarshalParquetJsonRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		rows, err = replaceParquetNullListElements(rows, jsonRows, listColumnElements)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	columnSizesArr := []interface{}{}
-	for fieldID, size := range parquetFile.Stats.ColumnSizes {
-		columnSizesArr = append(columnSizesArr, map[string]interface{}{
-			"key":   fieldID,
-			"value": size,
-		})
+	tables, err := marshal.MarshalJSON(rows, schemaHandler)
+	if err != nil {
+		return nil, err
 	}
 
-	valueCountsArr := []interface{}{}
-	for fieldID, count := range parquetFile.Stats.ValueCounts {
-		valueCountsArr = append(valueCountsArr, map[string]interface{}{
-			"key":   fieldID,
-			"value": count,
-		})
-	}
+	for _, table := range *tables {
+		if columnName := parquetListColumnName(table, schemaHandler); columnName != "" {
+			err = encodeParquetListValues(table, columnName, jsonRows)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	nullValueCountsArr := []interface{}{}
-	for fieldID, count := range parquetFile.Stats.NullValueCounts {
-		nullValueCountsArr = append(nullValueCountsArr, map[string]interface{}{
-			"key":   fieldID,
-			"value": count,
-		})
-	}
+		if isParquetDecimalSchemaElement(table.Schema) && table.MaxRepetitionLevel == 0 {
+			if jsonRows == nil {
+				jsonRows, err = unmarshalParquetJsonRows(rows)
+				if err != nil {
+					return nil, err
+				}
+			}
+			err = encodeParquetDecimalValues(table, jsonRows)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-	lowerBoundsArr := []interface{}{}
-	for fieldID, value := range parquetFile.Stats.LowerBounds {
-		lowerBoundsArr = append(lowerBoundsArr, map[string]interface{}{
-			"key":   fieldID,
-			"value": value,
-		})
+		if !isParquetBinarySchemaElement(table.Schema) && !isParquetUuidSchemaElement(table.Schema) {
+			continue
+		}
+		for i, value := range table.Values {
+			if encodedValue, ok := value.(string); ok {
+				decodedValue, err := base64.StdEncoding.DecodeString(encodedValue)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode binary value: %v", err)
+				}
+				table.Values[i] = string(decodedValue)
+			}
+		}
 	}
 
-	upperBoundsArr := []interface{}{}
-	for fieldID, value := range parquetFile.Stats.UpperBounds {
-		upperBoundsArr = append(upperBoundsArr, map[string]interface{}{
-			"key":   fieldID,
-			"value": value,
-		})
-	}
+	return tables, nil
+}
 
-	dataFile := map[string]interface{}{
-		"content":     0, // 0: DATA, 1: POSITION DELETES, 2: EQUALITY DELETES
-		"file_path":   fileSystemPrefix + parquetFile.Path,
-		"file_format": "PARQUET",
-		// TODO: figure out "partition": ...
-		"record_count":       parquetFile.RecordCount,
-		"file_size_in_bytes": parquetFile.Size,
-		"column_sizes": map[string]interface{}{
-			"array": columnSizesArr,
-		},
-		"value_counts": map[string]interface{}{
-			"array": valueCountsArr,
-		},
-		"null_value_counts": map[string]interface{}{
-			"array": nullValueCountsArr,
-		},
-		"nan_value_counts": map[string]interface{}{
-			"array": []interface{}{},
-		},
-		"lower_bounds": map[string]interface{}{
-			"array": lowerBoundsArr,
-		},
-		"upper_bounds": map[string]interface{}{
-			"array": upperBoundsArr,
-		},
-		"key_metadata": nil,
-		"split_offsets": map[string]interface{}{
-			"array": parquetFile.Stats.SplitOffsets,
-		},
-		"equality_ids":  nil,
-		"sort_order_id": nil,
+func unmarshalParquetJsonRows(rows []interface{}) ([]map[string]interface{}, error) {
+	jsonRows := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		var err error
+		switch typedRow := row.(type) {
+		case string:
+			err = json.Unmarshal([]byte(typedRow), &jsonRows[i])
+		case []byte:
+			err = json.Unmarshal(typedRow, &jsonRows[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal row: %v", err)
+		}
 	}
+	return jsonRows, nil
+}
 
-	manifestEntry := map[string]interface{}{
-		"status":               1, // 0: EXISTING 1: ADDED 2: DELETED
-		"snapshot_id":          map[string]interface{}{"long": snapshotId},
-		"sequence_number":      nil,
-		"file_sequence_number": nil,
-		"data_file":            dataFile,
+// Replaces the placeholder names of columns that can't be named in schema tags, the footer is written with these names
+func renameParquetSchemaFields(schemaHandler *schema.SchemaHandler, pgSchemaColumns []PgSchemaColumn) {
+	columnNamesByInName := make(map[string]string)
+	for _, pgSchemaColumn := range pgSchemaColumns {
+		columnNamesByInName[common.StringToVariableName(pgSchemaColumn.ColumnName)] = pgSchemaColumn.ColumnName
 	}
 
-	avroFile, err := os.Create(filePath)
-	if err != nil {
-		return ManifestFile{}, fmt.Errorf("failed to create manifest file: %v", err)
+	for i, info := range schemaHandler.Infos {
+		if len(common.StrToPath(schemaHandler.IndexMap[int32(i)])) != 2 {
+			continue
+		}
+		if columnName, ok := columnNamesByInName[info.InName]; ok {
+			info.ExName = columnName
+		}
 	}
-	defer avroFile.Close()
+	schemaHandler.CreateInExMap()
+}
 
-	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{
-		W:      avroFile,
-		Codec:  codec,
-		Schema: MANIFEST_SCHEMA,
-	})
-	if err != nil {
-		return ManifestFile{}, fmt.Errorf("failed to create Avro OCF writer: %v", err)
-	}
+// parquet-go converts decimal strings through 64-bit floats, which loses digits beyond ~19 significant ones.
+// Top-level decimal columns have a value per row, re-encode them from the original plain decimal strings instead
+func encodeParquetDecimalValues(table *layout.Table, jsonRows []map[string]interface{}) error {
+	precision := int(table.Schema.GetPrecision())
+	scale := int(table.Schema.GetScale())
+	length := int(table.Schema.GetTypeLength())
 
-	err = ocfWriter.Append([]interface{}{manifestEntry})
-	if err != nil {
-		return ManifestFile{}, fmt.Errorf("failed to write to manifest file: %v", err)
+	for i, jsonRow := range jsonRows {
+		decimalValue, ok := jsonRow[table.Info.ExName].(string)
+		if !ok {
+			continue
+		}
+		unscaledValue, err := unscaledDecimalValue(decimalValue, precision, scale)
+		if err != nil {
+			return fmt.Errorf("failed to encode decimal value: %v", err)
+		}
+		table.Values[i] = types.StrIntToBinary(unscaledValue.String(), "BigEndian", length, true)
 	}
+	return nil
+}
 
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return ManifestFile{}, fmt.Errorf("failed to get manifest file info: %v", err)
+// Top-level LIST columns by their JSON names, with the schema elements of their elements
+func parquetListColumnElements(schemaHandler *schema.SchemaHandler) map[string]*parquet.SchemaElement {
+	listColumnElements := make(map[string]*parquet.SchemaElement)
+	for i, schemaElement := range schemaHandler.SchemaElements {
+		path := common.StrToPath(schemaHandler.IndexMap[int32(i)])
+		if len(path) != 2 || schemaElement.GetConvertedType() != parquet.ConvertedType_LIST {
+			continue
+		}
+		if elementIndex, ok := schemaHandler.MapIndex[common.PathToStr(append(path, "List", "Element"))]; ok {
+			listColumnElements[schemaHandler.Infos[i].ExName] = schemaHandler.SchemaElements[elementIndex]
+		}
 	}
-	fileSize := fileInfo.Size()
-
-	return ManifestFile{
-		SnapshotId: snapshotId,
-		Path:       filePath,
-		Size:       fileSize,
-	}, nil
+	return listColumnElements
 }
 
-func (storage *StorageBase) WriteManifestListFile(fileSystemPrefix string, filePath string, parquetFile ParquetFile, manifestFile ManifestFile) (err error) {
-	codec, err := goavro.NewCodec(MANIFEST_LIST_SCHEMA)
-	if err != nil {
-		return fmt.Errorf("failed to create Avro codec for manifest list: %v", err)
+// Returns the JSON name of the LIST column that the table stores the elements of, or "" for other tables
+func parquetListColumnName(table *layout.Table, schemaHandler *schema.SchemaHandler) string {
+	if len(table.Path) != 4 || table.MaxRepetitionLevel == 0 {
+		return ""
 	}
-
-	manifestListRecord := map[string]interface{}{
-		"added_files_count":    1,
-		"added_rows_count":     parquetFile.RecordCount,
-		"added_snapshot_id":    manifestFile.SnapshotId,
-		"content":              0,
-		"deleted_files_count":  0,
-		"deleted_rows_count":   0,
-		"existing_files_count": 0,
-		"existing_rows_count":  0,
-		"key_metadata":         nil,
-		"manifest_length":      manifestFile.Size,
-		"manifest_path":        fileSystemPrefix + manifestFile.Path,
-		"min_sequence_number":  1,
-		"partition_spec_id":    0,
-		"partitions":           map[string]interface{}{"array": []string{}},
-		"sequence_number":      1,
+	index, ok := schemaHandler.MapIndex[common.PathToStr(table.Path[:2])]
+	if !ok || schemaHandler.SchemaElements[index].GetConvertedType() != parquet.ConvertedType_LIST {
+		return ""
 	}
+	return schemaHandler.Infos[index].ExName
+}
 
-	avroFile, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create manifest list file: %v", err)
-	}
-	defer avroFile.Close()
+// parquet-go can't marshal NULL list elements, so rows with them are marshaled with placeholders that can be
+// converted to the element type. The placeholders are replaced with NULL values by encodeParquetListValues
+func replaceParquetNullListElements(rows []interface{}, jsonRows []map[string]interface{}, listColumnElements map[string]*parquet.SchemaElement) ([]interface{}, error) {
+	var replacedRows []interface{}
+	for i, jsonRow := range jsonRows {
+		var replacedRow map[string]interface{}
+		for columnName, elementSchemaElement := range listColumnElements {
+			elements, _ := jsonRow[columnName].([]interface{})
+			if !slices.Contains(elements, nil) {
+				continue
+			}
 
-	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{
-		W:      avroFile,
-		Codec:  codec,
-		Schema: MANIFEST_LIST_SCHEMA,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create OCF writer for manifest list: %v", err)
+			placeholder := "0"
+			if elementSchemaElement.GetType() == parquet.Type_BOOLEAN {
+				placeholder = "false"
+			}
+			replacedElements := make([]interface{}, len(elements))
+			for j, element := range elements {
+				if element == nil {
+					replacedElements[j] = placeholder
+				} else {
+					replacedElements[j] = element
+				}
+			}
+			if replacedRow == nil {
+				replacedRow = maps.Clone(jsonRow)
+			}
+			replacedRow[columnName] = replacedElements
+		}
+		if replacedRow == nil {
+			continue
+		}
+
+		rowJson, err := json.Marshal(replacedRow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal row: %v", err)
+		}
+		if replacedRows == nil {
+			replacedRows = slices.Clone(rows)
+		}
+		replacedRows[i] = string(rowJson)
 	}
 
-	err = ocfWriter.Append([]interface{}{manifestListRecord})
-	if err != nil {
-		return fmt.Errorf("failed to write manifest list record: %v", err)
+	if replacedRows == nil {
+		return rows, nil
 	}
+	return replacedRows, nil
+}
+
+// Each row has a value per list element, or a single value without an element for NULL and empty lists.
+// NULL elements are only defined up to the list level, and decimal elements are re-encoded exactly like top-level decimals
+func encodeParquetListValues(table *layout.Table, columnName string, jsonRows []map[string]interface{}) error {
+	isDecimal := isParquetDecimalSchemaElement(table.Schema)
+	precision := int(table.Schema.GetPrecision())
+	scale := int(table.Schema.GetScale())
+	length := int(table.Schema.GetTypeLength())
+
+	i := 0
+	for _, jsonRow := range jsonRows {
+		elements, _ := jsonRow[columnName].([]interface{})
+		if len(elements) == 0 {
+			i++
+			continue
+		}
 
+		for _, element := range elements {
+			if i >= len(table.Values) {
+				return fmt.Errorf("failed to encode list values of column %s", columnName)
+			}
+			if element == nil {
+				table.Values[i] = nil
+				table.DefinitionLevels[i]--
+			} else if decimalValue, ok := element.(string); ok && isDecimal {
+				unscaledValue, err := unscaledDecimalValue(decimalValue, precision, scale)
+				if err != nil {
+					return fmt.Errorf("failed to encode decimal value: %v", err)
+				}
+				table.Values[i] = types.StrIntToBinary(unscaledValue.String(), "BigEndian", length, true)
+			}
+			i++
+		}
+	}
 	return nil
 }
 
-func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (err error) {
-	tableUuid := uuid.New().String()
-	lastColumnID := 3
-	currentTimestampMs := time.Now().UnixNano() / int64(time.Millisecond)
+func isParquetDecimalSchemaElement(schemaElement *parquet.SchemaElement) bool {
+	return schemaElement.GetType() == parquet.Type_FIXED_LEN_BYTE_ARRAY && schemaElement.GetConvertedType() == parquet.ConvertedType_DECIMAL
+}
 
-	icebergSchemaFields := make([]interface{}, len(pgSchemaColumns))
-	for i, pgSchemaColumn := range pgSchemaColumns {
-		icebergSchemaFields[i] = pgSchemaColumn.ToIcebergSchemaFieldMap()
-	}
+// Only bytea values are stored as BYTE_ARRAY without a converted type, other BYTE_ARRAY values are UTF8 strings
+func isParquetBinarySchemaElement(schemaElement *parquet.SchemaElement) bool {
+	return schemaElement.GetType() == parquet.Type_BYTE_ARRAY && schemaElement.ConvertedType == nil
+}
 
-	metadata := map[string]interface{}{
-		"format-version":       2,
-		"table-uuid":           tableUuid,
-		"location":             fileSystemPrefix + filePath,
-		"last-sequence-number": 1,
-		"last-updated-ms":      currentTimestampMs,
-		"last-column-id":       lastColumnID,
-		"schemas": []interface{}{
-			map[string]interface{}{
-				"type":                 "struct",
-				"schema-id":            0,
-				"fields":               icebergSchemaFields,
-				"identifier-field-ids": []interface{}{},
-			},
-		},
-		"current-schema-id": 0,
-		"partition-specs": []interface{}{
-			map[string]interface{}{
-				"spec-id": 0,
-				"fields":  []interface{}{},
-			},
-		},
-		"default-spec-id":       0,
-		"default-sort-order-id": 0,
-		"last-partition-id":     999, // Assuming no partitions; set to a placeholder
-		"properties":            map[string]string{},
-		"current-snapshot-id":   manifestFile.SnapshotId,
-		"refs": map[string]interface{}{
-			"main": map[string]interface{}{
-				"snapshot-id": manifestFile.SnapshotId,
-				"type":        "branch",
-			},
-		},
-		"snapshots": []interface{}{
-			map[string]interface{}{
-				"schema-id":       0,
-				"snapshot-id":     manifestFile.SnapshotId,
-				"sequence-number": 1,
-				"timestamp-ms":    currentTimestampMs,
-				"manifest-list":   fileSystemPrefix + manifestListFile.Path,
-				"summary": map[string]interface{}{
-					"added-data-files":       "1",
-					"added-files-size":       strconv.FormatInt(parquetFile.Size, 10),
-					"added-records":          strconv.FormatInt(parquetFile.RecordCount, 10),
-					"operation":              "append",
-					"total-data-files":       "1",
-					"total-delete-files":     "0",
-					"total-equality-deletes": "0",
-					"total-files-size":       strconv.FormatInt(parquetFile.Size, 10),
-					"total-position-deletes": "0",
-					"total-records":          strconv.FormatInt(parquetFile.RecordCount, 10),
-				},
-			},
-		},
-		"snapshot-log": []interface{}{
-			map[string]interface{}{
-				"snapshot-id":  manifestFile.SnapshotId,
-				"timestamp-ms": currentTimestampMs,
-			},
-		},
-		"metadata-log": []interface{}{},
-		"sort-orders": []interface{}{
-			map[string]interface{}{
-				"order-id": 0,
-				"fields":   []interface{}{},
-			},
-		},
-	}
+// UUIDs are stored as 16 bytes, which are marshaled to JSON like binary values
+func isParquetUuidSchemaElement(schemaElement *parquet.SchemaElement) bool {
+	return schemaElement.GetType() == parquet.Type_FIXED_LEN_BYTE_ARRAY && schemaElement.LogicalType != nil && schemaElement.LogicalType.IsSetUUID()
+}
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create metadata file: %v", err)
-	}
-	defer file.Close()
+func (storage *StorageBase) ReadParquetRecordCount(fileReader source.ParquetFile) (recordCount int64, err error) {
+	defer fileReader.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	err = encoder.Encode(metadata)
-	if err != nil {
-		return fmt.Errorf("failed to write metadata to file: %v", err)
+	pr := reader.ParquetReader{PFile: fileReader}
+	if err := pr.ReadFooter(); err != nil {
+		return 0, fmt.Errorf("failed to read Parquet footer: %v", err)
 	}
 
-	return nil
+	return pr.Footer.NumRows, nil
 }
 
-func (storage *StorageBase) WriteVersionHintFile(filePath string, metadataFile MetadataFile) (err error) {
-	versionHintFile, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create version hint file: %v", err)
+// Concatenates row groups from multiple Parquet files with the same schema without decoding their pages
+func (storage *StorageBase) MergeParquetFiles(fileReaders []source.ParquetFile, fileWriter source.ParquetFile) (recordCount int64, err error) {
+	defer fileWriter.Close()
+	for _, fileReader := range fileReaders {
+		defer fileReader.Close()
 	}
-	defer versionHintFile.Close()
 
-	_, err = versionHintFile.WriteString(fmt.Sprintf("%d", metadataFile.Version))
-	if err != nil {
-		return fmt.Errorf("failed to write to version hint file: %v", err)
+	if _, err := fileWriter.Write([]byte(PARQUET_MAGIC_NUMBER)); err != nil {
+		return 0, fmt.Errorf("failed to write Parquet header: %v", err)
 	}
+	offset := int64(len(PARQUET_MAGIC_NUMBER))
 
-	return nil
-}
+	var footer *parquet.FileMetaData
+	for _, fileReader := range fileReaders {
+		pr := reader.ParquetReader{PFile: fileReader}
+		if err := pr.ReadFooter(); err != nil {
+			return 0, fmt.Errorf("failed to read Parquet footer: %v", err)
+		}
+
+		if footer == nil {
+			footer = parquet.NewFileMetaData()
+			footer.Version = pr.Footer.Version
+			footer.Schema = pr.Footer.Schema
+			footer.CreatedBy = pr.Footer.CreatedBy
+		} else if !reflect.DeepEqual(footer.Schema, pr.Footer.Schema) {
+			return 0, errParquetSchemaMismatch
+		}
+
+		for _, rowGroup := range pr.Footer.RowGroups {
+			rowGroupOffset := offset
+
+			for _, columnChunk := range rowGroup.Columns {
+				columnMetaData := columnChunk.MetaData
+				chunkOffset := columnMetaData.DataPageOffset
+				if columnMetaData.DictionaryPageOffset != nil && *columnMetaData.DictionaryPageOffset < chunkOffset {
+					chunkOffset = *columnMetaData.DictionaryPageOffset
+				}
+
+				if _, err := fileReader.Seek(chunkOffset, io.SeekStart); err != nil {
+					return 0, fmt.Errorf("failed to seek Parquet column chunk: %v", err)
+				}
+				if _, err := io.CopyN(fileWriter, fileReader, columnMetaData.TotalCompressedSize); err != nil {
+					return 0, fmt.Errorf("failed to copy Parquet column chunk: %v", err)
+				}
+
+				delta := offset - chunkOffset
+				columnChunk.FileOffset = offset
+				columnMetaData.DataPageOffset += delta
+				if columnMetaData.DictionaryPageOffset != nil {
+					dictionaryPageOffset := *columnMetaData.DictionaryPageOffset + delta
+					columnMetaData.DictionaryPageOffset = &dictionaryPageOffset
+				}
+				if columnMetaData.IndexPageOffset != nil {
+					indexPageOffset := *columnMetaData.IndexPageOffset + delta
+					columnMetaData.IndexPageOffset = &indexPageOffset
+				}
+
+				// Page indexes and bloom filters are stored outside of column chunks and are not copied
+				columnMetaData.BloomFilterOffset = nil
+				columnChunk.ColumnIndexOffset = nil
+				columnChunk.ColumnIndexLength = nil
+				columnChunk.OffsetIndexOffset = nil
+				columnChunk.OffsetIndexLength = nil
+
+				offset += columnMetaData.TotalCompressedSize
+			}
+
+			rowGroup.FileOffset = &rowGroupOffset
+			footer.RowGroups = append(footer.RowGroups, rowGroup)
+			footer.NumRows += rowGroup.NumRows
+		}
+	}
+
+	if footer == nil {
+		return 0, fmt.Errorf("no Parquet files to merge")
+	}
+
+	serializer := thrift.NewTSerializer()
+	serializer.Protocol = thrift.NewTCompactProtocolFactoryConf(nil).GetProtocol(serializer.Transport)
+	footerBytes, err := serializer.Write(context.Background(), footer)
+	if err != nil {
+		return 0, fmt.Errorf("failed to serialize Parquet footer: %v", err)
+	}
+
+	footerSizeBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footerSizeBytes, uint32(len(footerBytes)))
+	for _, data := range [][]byte{footerBytes, footerSizeBytes, []byte(PARQUET_MAGIC_NUMBER)} {
+		if _, err := fileWriter.Write(data); err != nil {
+			return 0, fmt.Errorf("failed to write Parquet footer: %v", err)
+		}
+	}
+
+	return footer.NumRows, nil
+}
+
+func (storage *StorageBase) ReadParquetColumns(fileReader source.ParquetFile, columnNames []string) (rows [][]interface{}, err error) {
+	defer fileReader.Close()
+
+	pr, err := reader.NewParquetColumnReader(fileReader, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Parquet reader: %v", err)
+	}
+	defer pr.ReadStop()
+
+	rowCount := pr.GetNumRows()
+	rows = make([][]interface{}, rowCount)
+	for i := range rows {
+		rows[i] = make([]interface{}, len(columnNames))
+	}
+
+	for columnIndex, columnName := range columnNames {
+		columnPath := pr.SchemaHandler.GetRootExName() + common.PAR_GO_PATH_DELIMITER + columnName
+		if _, err := pr.SchemaHandler.ConvertToInPathStr(columnPath); err != nil {
+			// Column was added after the file had been written, keep NULL values
+			continue
+		}
+
+		values, _, _, err := pr.ReadColumnByPath(columnPath, rowCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Parquet column %s: %v", columnName, err)
+		}
+		if int64(len(values)) != rowCount {
+			return nil, fmt.Errorf("failed to read Parquet column %s: expected %d values, got %d", columnName, rowCount, len(values))
+		}
+
+		for rowIndex, value := range values {
+			rows[rowIndex][columnIndex] = value
+		}
+	}
+
+	return rows, nil
+}
+
+// Data files and delete files are written to separate manifests, so all files must be data files or delete files.
+// Files are written with their data sequence number, so that committed files keep theirs when they're listed by the next snapshot,
+// and new files get the sequence number of the snapshot adding them
+func (storage *StorageBase) WriteManifestFile(fileSystemPrefix string, filePath string, snapshotId int64, sequenceNumber int64, partitionSpec IcebergPartitionSpec, parquetFiles []ParquetFile) (manifestFile ManifestFile, err error) {
+	manifestSchema, err := icebergManifestSchema(partitionSpec)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to build manifest schema: %v", err)
+	}
+	codec, err := goavro.NewCodec(manifestSchema)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to create Avro codec: %v", err)
+	}
+
+	manifestEntries := []interface{}{}
+	minSequenceNumber := sequenceNumber
+	for _, parquetFile := range parquetFiles {
+		fileSequenceNumber := sequenceNumber
+		if parquetFile.SequenceNumber > 0 {
+			fileSequenceNumber = parquetFile.SequenceNumber
+		}
+		minSequenceNumber = min(minSequenceNumber, fileSequenceNumber)
+
+		columnSizesArr := []interface{}{}
+		for fieldID, size := range parquetFile.Stats.ColumnSizes {
+			columnSizesArr = append(columnSizesArr, map[string]interface{}{
+				"key":   fieldID,
+				"value": size,
+			})
+		}
+
+		valueCountsArr := []interface{}{}
+		for fieldID, count := range parquetFile.Stats.ValueCounts {
+			valueCountsArr = append(valueCountsArr, map[string]interface{}{
+				"key":   fieldID,
+				"value": count,
+			})
+		}
+
+		nullValueCountsArr := []interface{}{}
+		for fieldID, count := range parquetFile.Stats.NullValueCounts {
+			nullValueCountsArr = append(nullValueCountsArr, map[string]interface{}{
+				"key":   fieldID,
+				"value": count,
+			})
+		}
+
+		lowerBoundsArr := []interface{}{}
+		for fieldID, value := range parquetFile.Stats.LowerBounds {
+			lowerBoundsArr = append(lowerBoundsArr, map[string]interface{}{
+				"key":   fieldID,
+				"value": value,
+			})
+		}
+
+		upperBoundsArr := []interface{}{}
+		for fieldID, value := range parquetFile.Stats.UpperBounds {
+			upperBoundsArr = append(upperBoundsArr, map[string]interface{}{
+				"key":   fieldID,
+				"value": value,
+			})
+		}
+
+		dataFile := map[string]interface{}{
+			"content":            parquetFile.Content, // 0: DATA, 1: POSITION DELETES, 2: EQUALITY DELETES
+			"file_path":          fileSystemPrefix + parquetFile.Path,
+			"file_format":        "PARQUET",
+			"record_count":       parquetFile.RecordCount,
+			"file_size_in_bytes": parquetFile.Size,
+			"column_sizes": map[string]interface{}{
+				"array": columnSizesArr,
+			},
+			"value_counts": map[string]interface{}{
+				"array": valueCountsArr,
+			},
+			"null_value_counts": map[string]interface{}{
+				"array": nullValueCountsArr,
+			},
+			"nan_value_counts": map[string]interface{}{
+				"array": []interface{}{},
+			},
+			"lower_bounds": map[string]interface{}{
+				"array": lowerBoundsArr,
+			},
+			"upper_bounds": map[string]interface{}{
+				"array": upperBoundsArr,
+			},
+			"key_metadata": nil,
+			"split_offsets": map[string]interface{}{
+				"array": parquetFile.Stats.SplitOffsets,
+			},
+			"equality_ids":  nil,
+			"sort_order_id": nil,
+		}
+		if len(parquetFile.EqualityFieldIds) > 0 {
+			equalityIdsArr := []interface{}{}
+			for _, fieldId := range parquetFile.EqualityFieldIds {
+				equalityIdsArr = append(equalityIdsArr, int64(fieldId))
+			}
+			dataFile["equality_ids"] = map[string]interface{}{"array": equalityIdsArr}
+		}
+		if len(partitionSpec.Fields) > 0 {
+			dataFile["partition"] = icebergPartitionAvroRecord(partitionSpec, parquetFile.PartitionValue)
+		}
+
+		manifestEntry := map[string]interface{}{
+			"status":               1, // 0: EXISTING 1: ADDED 2: DELETED
+			"snapshot_id":          map[string]interface{}{"long": snapshotId},
+			"sequence_number":      map[string]interface{}{"long": fileSequenceNumber},
+			"file_sequence_number": map[string]interface{}{"long": fileSequenceNumber},
+			"data_file":            dataFile,
+		}
+		manifestEntries = append(manifestEntries, manifestEntry)
+	}
+
+	avroFile, err := os.Create(filePath)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to create manifest file: %v", err)
+	}
+	defer avroFile.Close()
+
+	partitionSpecFieldsJson, err := json.Marshal(partitionSpec.Fields)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to encode partition spec: %v", err)
+	}
+	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:      avroFile,
+		Codec:  codec,
+		Schema: manifestSchema,
+		MetaData: map[string][]byte{
+			"partition-spec":    partitionSpecFieldsJson,
+			"partition-spec-id": []byte(strconv.Itoa(partitionSpec.SpecId)),
+		},
+	})
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to create Avro OCF writer: %v", err)
+	}
+
+	err = ocfWriter.Append(manifestEntries)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to write to manifest file: %v", err)
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to get manifest file info: %v", err)
+	}
+	fileSize := fileInfo.Size()
+
+	content := ICEBERG_CONTENT_DATA
+	if len(parquetFiles) > 0 && parquetFiles[0].Content != ICEBERG_CONTENT_DATA {
+		content = ICEBERG_CONTENT_POSITION_DELETES // manifests of position and equality delete files have the same content
+	}
+	recordCount, _ := storage.parquetFilesTotals(parquetFiles)
+	return ManifestFile{
+		SnapshotId:         snapshotId,
+		SequenceNumber:     sequenceNumber,
+		MinSequenceNumber:  minSequenceNumber,
+		Path:               filePath,
+		Size:               fileSize,
+		Content:            content,
+		FileCount:          len(parquetFiles),
+		RecordCount:        recordCount,
+		PartitionSpecId:    partitionSpec.SpecId,
+		PartitionSummaries: icebergPartitionFieldSummaries(partitionSpec, parquetFiles),
+	}, nil
+}
+
+func (storage *StorageBase) WriteManifestListFile(fileSystemPrefix string, filePath string, manifestFiles []ManifestFile) (err error) {
+	codec, err := goavro.NewCodec(MANIFEST_LIST_SCHEMA)
+	if err != nil {
+		return fmt.Errorf("failed to create Avro codec for manifest list: %v", err)
+	}
+
+	var manifestListRecords []interface{}
+	for _, manifestFile := range manifestFiles {
+		partitions := []interface{}{}
+		for _, summary := range manifestFile.PartitionSummaries {
+			partition := map[string]interface{}{"contains_null": summary.ContainsNull, "contains_nan": nil, "lower_bound": nil, "upper_bound": nil}
+			if summary.LowerBound != nil {
+				partition["lower_bound"] = map[string]interface{}{"bytes": summary.LowerBound}
+				partition["upper_bound"] = map[string]interface{}{"bytes": summary.UpperBound}
+			}
+			partitions = append(partitions, partition)
+		}
+		manifestListRecords = append(manifestListRecords, map[string]interface{}{
+			"added_files_count":    manifestFile.FileCount,
+			"added_rows_count":     manifestFile.RecordCount,
+			"added_snapshot_id":    manifestFile.SnapshotId,
+			"content":              manifestFile.Content, // 0: DATA, 1: DELETES
+			"deleted_files_count":  0,
+			"deleted_rows_count":   0,
+			"existing_files_count": 0,
+			"existing_rows_count":  0,
+			"key_metadata":         nil,
+			"manifest_length":      manifestFile.Size,
+			"manifest_path":        fileSystemPrefix + manifestFile.Path,
+			"min_sequence_number":  manifestFile.MinSequenceNumber,
+			"partition_spec_id":    manifestFile.PartitionSpecId,
+			"partitions":           map[string]interface{}{"array": partitions},
+			"sequence_number":      manifestFile.SequenceNumber,
+		})
+	}
+
+	avroFile, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest list file: %v", err)
+	}
+	defer avroFile.Close()
+
+	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:      avroFile,
+		Codec:  codec,
+		Schema: MANIFEST_LIST_SCHEMA,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create OCF writer for manifest list: %v", err)
+	}
+
+	err = ocfWriter.Append(manifestListRecords)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest list record: %v", err)
+	}
+
+	return nil
+}
+
+// Iceberg identifier fields must be required primitive fields other than floats, so the primary key is only recorded
+// as the identifier fields if all of its columns qualify. Otherwise, it's only available in the table properties.
+// Tables without a primary key are identified by their first unique key (by name) with qualifying columns
+func icebergIdentifierFieldIds(icebergSchemaFields []IcebergSchemaField, properties map[string]string) []int {
+	primaryKeyColumnNames, uniqueKeyColumnNames := icebergTableKeyColumnNames(properties)
+	if len(primaryKeyColumnNames) > 0 {
+		return icebergKeyFieldIds(icebergSchemaFields, primaryKeyColumnNames)
+	}
+
+	keyNames := make([]string, 0, len(uniqueKeyColumnNames))
+	for keyName := range uniqueKeyColumnNames {
+		keyNames = append(keyNames, keyName)
+	}
+	slices.Sort(keyNames)
+	for _, keyName := range keyNames {
+		if identifierFieldIds := icebergKeyFieldIds(icebergSchemaFields, uniqueKeyColumnNames[keyName]); len(identifierFieldIds) > 0 {
+			return identifierFieldIds
+		}
+	}
+	return []int{}
+}
+
+// Returns the primary key column names and the unique key column names by key name recorded in the table properties
+func icebergTableKeyColumnNames(properties map[string]string) (primaryKeyColumnNames []string, uniqueKeyColumnNames map[string][]string) {
+	if primaryKeyJson, ok := properties[ICEBERG_PROPERTY_PRIMARY_KEY]; ok {
+		err := json.Unmarshal([]byte(primaryKeyJson), &primaryKeyColumnNames)
+		PanicIfError(err)
+	}
+	if uniqueKeysJson, ok := properties[ICEBERG_PROPERTY_UNIQUE_KEYS]; ok {
+		err := json.Unmarshal([]byte(uniqueKeysJson), &uniqueKeyColumnNames)
+		PanicIfError(err)
+	}
+	return primaryKeyColumnNames, uniqueKeyColumnNames
+}
+
+// Returns no field IDs if any of the key columns doesn't qualify as an identifier field
+func icebergKeyFieldIds(icebergSchemaFields []IcebergSchemaField, keyColumnNames []string) []int {
+	identifierFieldIds := []int{}
+	for _, keyColumnName := range keyColumnNames {
+		index := slices.IndexFunc(icebergSchemaFields, func(field IcebergSchemaField) bool { return field.Name == keyColumnName })
+		if index == -1 {
+			return []int{}
+		}
+		field := icebergSchemaFields[index]
+		fieldType, isPrimitive := field.Type.(string)
+		if !field.Required || !isPrimitive || fieldType == "float" || fieldType == "double" {
+			return []int{}
+		}
+		identifierFieldIds = append(identifierFieldIds, field.Id)
+	}
+	return identifierFieldIds
+}
+
+// Snapshots and schemas of the previous metadata of a table, which new snapshots are committed on top of
+type icebergMetadataHistory struct {
+	TableUuid          string                   `json:"table-uuid"`
+	LastSequenceNumber int64                    `json:"last-sequence-number"`
+	CurrentSnapshotId  *int64                   `json:"current-snapshot-id"`
+	CurrentSchemaId    int                      `json:"current-schema-id"`
+	LastColumnId       int                      `json:"last-column-id"`
+	Schemas            []map[string]interface{} `json:"schemas"`
+	Snapshots          []map[string]interface{} `json:"snapshots"`
+	SnapshotLog        []map[string]interface{} `json:"snapshot-log"`
+	PartitionSpecs     []IcebergPartitionSpec   `json:"partition-specs"`
+	LastPartitionId    int                      `json:"last-partition-id"`
+	LastUpdatedMs      int64                    `json:"last-updated-ms"`
+	MetadataLog        []map[string]interface{} `json:"metadata-log"`
+}
+
+// Returns the metadata log with the previous metadata file, keeping the previous files of the most recent metadata versions
+// (0 to keep all), and the previous files dropped from the log
+func (history *icebergMetadataHistory) metadataLog(previousMetadataLocation string, hasPreviousMetadata bool, keepMetadataVersions int) (metadataLog []map[string]interface{}, expiredMetadataPaths []string) {
+	metadataLog = slices.Clone(history.MetadataLog)
+	if metadataLog == nil {
+		metadataLog = []map[string]interface{}{}
+	}
+	if hasPreviousMetadata {
+		metadataLog = append(metadataLog, map[string]interface{}{
+			"metadata-file": previousMetadataLocation,
+			"timestamp-ms":  history.LastUpdatedMs,
+		})
+	}
+
+	if keepMetadataVersions > 0 && len(metadataLog) > keepMetadataVersions-1 {
+		for _, entry := range metadataLog[:len(metadataLog)-(keepMetadataVersions-1)] {
+			if metadataPath, ok := entry["metadata-file"].(string); ok {
+				expiredMetadataPaths = append(expiredMetadataPaths, metadataPath)
+			}
+		}
+		metadataLog = metadataLog[len(metadataLog)-(keepMetadataVersions-1):]
+	}
+	return metadataLog, expiredMetadataPaths
+}
+
+func parseIcebergMetadataHistory(metadataContent []byte) (history icebergMetadataHistory, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	if err := decoder.Decode(&history); err != nil {
+		return icebergMetadataHistory{}, fmt.Errorf("failed to parse previous metadata: %v", err)
+	}
+	return history, nil
+}
+
+// Returns the ID of the schema in the history, adding it as a new schema if it differs from the current one
+func (history *icebergMetadataHistory) addSchema(schema map[string]interface{}) (schemaId int, err error) {
+	if len(history.Schemas) == 0 {
+		schema["schema-id"] = 0
+		history.Schemas = []map[string]interface{}{schema}
+		return 0, nil
+	}
+
+	schema["schema-id"] = history.CurrentSchemaId
+	schemaJson, err := normalizedJson(schema)
+	if err != nil {
+		return 0, err
+	}
+	for _, previousSchema := range history.Schemas {
+		previousSchemaJson, err := normalizedJson(previousSchema)
+		if err != nil {
+			return 0, err
+		}
+		if previousSchemaJson == schemaJson {
+			return history.CurrentSchemaId, nil
+		}
+	}
+
+	for _, previousSchema := range history.Schemas {
+		previousSchemaId, err := previousSchema["schema-id"].(json.Number).Int64()
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse schema ID: %v", err)
+		}
+		schemaId = max(schemaId, int(previousSchemaId)+1)
+	}
+	schema["schema-id"] = schemaId
+	history.Schemas = append(history.Schemas, schema)
+	return schemaId, nil
+}
+
+// Returns the spec with the partition fields, reusing the IDs of an equal spec in the history. Otherwise, the spec gets
+// an unused spec ID and new field IDs, so that manifests written with previous specs can still be read
+func (history *icebergMetadataHistory) partitionSpec(partitionFields []IcebergPartitionField) IcebergPartitionSpec {
+	fields := append([]IcebergPartitionField{}, partitionFields...)
+	specId := 0
+	lastPartitionId := history.lastPartitionId()
+	for _, spec := range history.PartitionSpecs {
+		if isSameIcebergPartitionFields(spec.Fields, fields) {
+			for i := range fields {
+				fields[i].FieldId = spec.Fields[i].FieldId
+			}
+			return IcebergPartitionSpec{SpecId: spec.SpecId, Fields: fields}
+		}
+		specId = max(specId, spec.SpecId+1)
+	}
+
+	for i := range fields {
+		lastPartitionId++
+		fields[i].FieldId = lastPartitionId
+	}
+	return IcebergPartitionSpec{SpecId: specId, Fields: fields}
+}
+
+func (history *icebergMetadataHistory) addPartitionSpec(partitionSpec IcebergPartitionSpec) {
+	if !slices.ContainsFunc(history.PartitionSpecs, func(spec IcebergPartitionSpec) bool { return spec.SpecId == partitionSpec.SpecId }) {
+		history.PartitionSpecs = append(history.PartitionSpecs, partitionSpec)
+	}
+}
+
+func (history *icebergMetadataHistory) lastPartitionId() int {
+	lastPartitionId := max(history.LastPartitionId, ICEBERG_PARTITION_FIELD_ID_START-1)
+	for _, spec := range history.PartitionSpecs {
+		for _, field := range spec.Fields {
+			lastPartitionId = max(lastPartitionId, field.FieldId)
+		}
+	}
+	return lastPartitionId
+}
+
+// Returns the fields of each schema in the history, old schemas first
+func (history *icebergMetadataHistory) schemasFields() (schemasFields [][]IcebergSchemaField, err error) {
+	schemasJson, err := json.Marshal(history.Schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas []struct {
+		Fields []IcebergSchemaField `json:"fields"`
+	}
+	if err := json.Unmarshal(schemasJson, &schemas); err != nil {
+		return nil, fmt.Errorf("failed to parse schema fields: %v", err)
+	}
+	for _, schema := range schemas {
+		schemasFields = append(schemasFields, schema.Fields)
+	}
+	return schemasFields, nil
+}
+
+func (history *icebergMetadataHistory) lastColumnId() (lastColumnId int, err error) {
+	schemasFields, err := history.schemasFields()
+	if err != nil {
+		return 0, err
+	}
+
+	lastColumnId = history.LastColumnId
+	for _, fields := range schemasFields {
+		for _, field := range fields {
+			lastColumnId = max(lastColumnId, field.Id)
+		}
+	}
+	return lastColumnId, nil
+}
+
+// Returns the Iceberg name mapping of the current fields with their previous names in older schemas, so that renamed
+// columns keep their history. Nil if no field has been renamed
+func (history *icebergMetadataHistory) nameMapping(icebergSchemaFields []IcebergSchemaField) (nameMappingJson []byte, err error) {
+	schemasFields, err := history.schemasFields()
+	if err != nil {
+		return nil, err
+	}
+
+	type nameMappingField struct {
+		FieldId int      `json:"field-id"`
+		Names   []string `json:"names"`
+	}
+	var nameMapping []nameMappingField
+	renamed := false
+	for _, field := range icebergSchemaFields {
+		names := []string{field.Name}
+		for i := len(schemasFields) - 1; i >= 0; i-- {
+			for _, previousField := range schemasFields[i] {
+				if previousField.Id == field.Id && !slices.Contains(names, previousField.Name) {
+					names = append(names, previousField.Name)
+					renamed = true
+				}
+			}
+		}
+		nameMapping = append(nameMapping, nameMappingField{FieldId: field.Id, Names: names})
+	}
+	if !renamed {
+		return nil, nil
+	}
+
+	return json.Marshal(nameMapping)
+}
+
+// Encodes the value with sorted object keys, so that structs and maps decoded from them can be compared
+func normalizedJson(value interface{}) (string, error) {
+	valueJson, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(valueJson))
+	decoder.UseNumber()
+	var decodedValue interface{}
+	if err := decoder.Decode(&decodedValue); err != nil {
+		return "", err
+	}
+
+	valueJson, err = json.Marshal(decodedValue)
+	if err != nil {
+		return "", err
+	}
+	return string(valueJson), nil
+}
+
+// Returns the partition spec of the next snapshot of the table with the previous metadata (nil for new tables)
+func (storage *StorageBase) ResolvePartitionSpec(partitionFields []IcebergPartitionField, previousMetadataContent []byte) (partitionSpec IcebergPartitionSpec, err error) {
+	history := icebergMetadataHistory{}
+	if previousMetadataContent != nil {
+		history, err = parseIcebergMetadataHistory(previousMetadataContent)
+		if err != nil {
+			return IcebergPartitionSpec{}, err
+		}
+	}
+	return history.partitionSpec(partitionFields), nil
+}
+
+// Name of the numbered metadata file of the version in the metadata directory, as expected by Hadoop catalogs
+func IcebergMetadataFileName(version int64) string {
+	return ICEBERG_METADATA_FILE_PREFIX + strconv.FormatInt(version, 10) + ICEBERG_METADATA_FILE_SUFFIX
+}
+
+// Returns false for metadata files that aren't numbered, e.g., the copies committed to Nessie
+func IcebergMetadataFileVersion(metadataPath string) (version int64, ok bool) {
+	fileName := metadataPath[strings.LastIndex(metadataPath, "/")+1:]
+	if !strings.HasPrefix(fileName, ICEBERG_METADATA_FILE_PREFIX) || !strings.HasSuffix(fileName, ICEBERG_METADATA_FILE_SUFFIX) {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(fileName, ICEBERG_METADATA_FILE_PREFIX), ICEBERG_METADATA_FILE_SUFFIX), 10, 64)
+	if err != nil || version < ICEBERG_FIRST_METADATA_VERSION {
+		return 0, false
+	}
+	return version, true
+}
+
+// Returns the metadata file that the version hint in the metadata directory points to, or a later version that was committed
+// without updating the version hint (yet), e.g., by a writer that crashed in between. Without a version hint (e.g., for
+// new tables), it's the first version, which may not exist yet
+func (storage *StorageBase) CurrentMetadataFile(metadataDirPath string, readFileIfExists func(path string) ([]byte, error)) (metadataFile MetadataFile, err error) {
+	versionHintPath := metadataDirPath + "/" + VERSION_HINT_FILE_NAME
+	versionHintContent, err := readFileIfExists(versionHintPath)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+
+	version := int64(ICEBERG_FIRST_METADATA_VERSION)
+	if versionHintContent != nil {
+		version, err = strconv.ParseInt(strings.TrimSpace(string(versionHintContent)), 10, 64)
+		if err != nil || version < ICEBERG_FIRST_METADATA_VERSION {
+			return MetadataFile{}, fmt.Errorf("invalid version hint %q in %s", string(versionHintContent), versionHintPath)
+		}
+	}
+
+	for {
+		nextMetadataContent, err := readFileIfExists(metadataDirPath + "/" + IcebergMetadataFileName(version+1))
+		if err != nil {
+			return MetadataFile{}, err
+		}
+		if nextMetadataContent == nil {
+			break
+		}
+		version++
+	}
+
+	return MetadataFile{Version: version, Path: metadataDirPath + "/" + IcebergMetadataFileName(version)}, nil
+}
+
+// Returns the current metadata file with its content, or nil content if the table doesn't exist (yet). A metadata file that
+// disappears after it was resolved, e.g., deleted by a concurrent commit, is resolved again through the version hint instead
+// of being read as an empty table
+func (storage *StorageBase) ReadCurrentMetadataFile(metadataDirPath string, readFileIfExists func(path string) ([]byte, error)) (metadataFile MetadataFile, metadataContent []byte, err error) {
+	for attempt := 1; attempt <= ICEBERG_METADATA_READ_ATTEMPTS; attempt++ {
+		metadataFile, err = storage.CurrentMetadataFile(metadataDirPath, readFileIfExists)
+		if err != nil {
+			return MetadataFile{}, nil, err
+		}
+		metadataContent, err = readFileIfExists(metadataFile.Path)
+		if err != nil || metadataContent != nil {
+			return metadataFile, metadataContent, err
+		}
+
+		versionHintContent, err := readFileIfExists(metadataDirPath + "/" + VERSION_HINT_FILE_NAME)
+		if err != nil {
+			return MetadataFile{}, nil, err
+		}
+		if versionHintContent == nil && metadataFile.Version == ICEBERG_FIRST_METADATA_VERSION {
+			return metadataFile, nil, nil
+		}
+		LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Resolving the current metadata file again after", metadataFile.Path, "disappeared")
+	}
+	return MetadataFile{}, nil, fmt.Errorf("failed to read the current metadata file in %s: %s disappeared %d times after it was resolved", metadataDirPath, metadataFile.Path, ICEBERG_METADATA_READ_ATTEMPTS)
+}
+
+// Returns the version of the current metadata file that writers base their snapshots on, or 0 if the table doesn't exist yet
+func (storage *StorageBase) CurrentMetadataVersion(metadataDirPath string, readFileIfExists func(path string) ([]byte, error)) (version int64, err error) {
+	metadataFile, err := storage.CurrentMetadataFile(metadataDirPath, readFileIfExists)
+	if err != nil {
+		return 0, err
+	}
+	metadataContent, err := readFileIfExists(metadataFile.Path)
+	if err != nil || metadataContent == nil {
+		return 0, err
+	}
+	return metadataFile.Version, nil
+}
+
+// Returns the sequence number that follows the last one of the base version, or 1 for new tables
+func (storage *StorageBase) NextSequenceNumber(metadataDirPath string, baseVersion int64, readFileIfExists func(path string) ([]byte, error)) (sequenceNumber int64, err error) {
+	metadataFile, metadataContent, err := storage.ReadCurrentMetadataFile(metadataDirPath, readFileIfExists)
+	if err != nil {
+		return 0, err
+	}
+	err = storage.CheckBaseMetadataVersion(metadataDirPath, baseVersion, metadataFile, metadataContent)
+	if err != nil || metadataContent == nil {
+		return 1, err
+	}
+
+	history, err := parseIcebergMetadataHistory(metadataContent)
+	if err != nil {
+		return 0, err
+	}
+	return history.LastSequenceNumber + 1, nil
+}
+
+// Fails with a concurrent modification error if the current metadata file isn't the base version of the commit anymore
+func (storage *StorageBase) CheckBaseMetadataVersion(metadataDirPath string, baseVersion int64, currentMetadataFile MetadataFile, currentMetadataContent []byte) error {
+	currentVersion := int64(0)
+	if currentMetadataContent != nil {
+		currentVersion = currentMetadataFile.Version
+	}
+	if currentVersion != baseVersion {
+		return fmt.Errorf("%w of %s: the current metadata version is %d instead of %d that the snapshot is based on", errConcurrentModification, metadataDirPath, currentVersion, baseVersion)
+	}
+	return nil
+}
+
+// Returned when the next metadata file is created by another writer between checking the base version and creating it
+func (storage *StorageBase) ExistingMetadataFileError(metadataFile MetadataFile) error {
+	return fmt.Errorf("%w: %s was created by another writer", errConcurrentModification, metadataFile.Path)
+}
+
+// Returns the metadata file that follows the current one, or the first version if the current one doesn't exist
+func (storage *StorageBase) NextMetadataFile(metadataDirPath string, currentMetadataFile MetadataFile, currentMetadataContent []byte) MetadataFile {
+	version := int64(ICEBERG_FIRST_METADATA_VERSION)
+	if currentMetadataContent != nil {
+		version = currentMetadataFile.Version + 1
+	}
+	return MetadataFile{Version: version, Path: metadataDirPath + "/" + IcebergMetadataFileName(version)}
+}
+
+// Commits a new snapshot with the data files. If the table has previous metadata, the snapshot is added on top of its
+// snapshots with the current one as the parent, so that previous versions of the table can still be read until they expire.
+// The previous metadata file is added to the metadata log, and returns the previous metadata files dropped from the log
+// beyond the kept metadata versions, which can be deleted once readers are pointed to the new metadata file
+func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath string, icebergSchemaFields []IcebergSchemaField, partitionSpec IcebergPartitionSpec, properties map[string]string, parquetFiles []ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile, previousMetadataPath string, previousMetadataContent []byte) (expiredMetadataPaths []string, err error) {
+	history := icebergMetadataHistory{TableUuid: uuid.New().String()}
+	if previousMetadataContent != nil {
+		history, err = parseIcebergMetadataHistory(previousMetadataContent)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metadataLog, expiredMetadataPaths := history.metadataLog(fileSystemPrefix+previousMetadataPath, previousMetadataContent != nil, storage.config.Iceberg.KeepMetadataVersions)
+
+	currentTimestampMs := time.Now().UnixNano() / int64(time.Millisecond)
+	var dataFiles, positionDeleteFiles, equalityDeleteFiles []ParquetFile
+	for _, parquetFile := range parquetFiles {
+		switch parquetFile.Content {
+		case ICEBERG_CONTENT_POSITION_DELETES:
+			positionDeleteFiles = append(positionDeleteFiles, parquetFile)
+		case ICEBERG_CONTENT_EQUALITY_DELETES:
+			equalityDeleteFiles = append(equalityDeleteFiles, parquetFile)
+		default:
+			dataFiles = append(dataFiles, parquetFile)
+		}
+	}
+	recordCount, dataSize := storage.parquetFilesTotals(dataFiles)
+	positionDeleteCount, positionDeleteSize := storage.parquetFilesTotals(positionDeleteFiles)
+	equalityDeleteCount, equalityDeleteSize := storage.parquetFilesTotals(equalityDeleteFiles)
+	deleteSize := positionDeleteSize + equalityDeleteSize
+	properties = maps.Clone(properties)
+	if properties == nil {
+		properties = map[string]string{}
+	}
+
+	schemaId, err := history.addSchema(map[string]interface{}{
+		"type":                 "struct",
+		"fields":               icebergSchemaFields,
+		"identifier-field-ids": icebergIdentifierFieldIds(icebergSchemaFields, properties),
+	})
+	if err != nil {
+		return nil, err
+	}
+	lastColumnId, err := history.lastColumnId()
+	if err != nil {
+		return nil, err
+	}
+	nameMappingJson, err := history.nameMapping(icebergSchemaFields)
+	if err != nil {
+		return nil, err
+	}
+	delete(properties, ICEBERG_PROPERTY_NAME_MAPPING)
+	if nameMappingJson != nil {
+		properties[ICEBERG_PROPERTY_NAME_MAPPING] = string(nameMappingJson)
+	}
+	setParquetCompressionProperties(storage.config, properties)
+
+	history.addPartitionSpec(partitionSpec)
+
+	sequenceNumber := history.LastSequenceNumber + 1
+	operation := "append"
+	snapshot := map[string]interface{}{
+		"schema-id":       schemaId,
+		"snapshot-id":     manifestFile.SnapshotId,
+		"sequence-number": sequenceNumber,
+		"timestamp-ms":    currentTimestampMs,
+		"manifest-list":   fileSystemPrefix + manifestListFile.Path,
+	}
+	if history.CurrentSnapshotId != nil {
+		// Each snapshot lists all data files of the table, which replace the data files of its parent
+		operation = "overwrite"
+		snapshot["parent-snapshot-id"] = *history.CurrentSnapshotId
+	}
+	snapshot["summary"] = map[string]interface{}{
+		"added-data-files":       strconv.Itoa(len(dataFiles)),
+		"added-files-size":       strconv.FormatInt(dataSize+deleteSize, 10),
+		"added-records":          strconv.FormatInt(recordCount, 10),
+		"operation":              operation,
+		"total-data-files":       strconv.Itoa(len(dataFiles)),
+		"total-delete-files":     strconv.Itoa(len(positionDeleteFiles) + len(equalityDeleteFiles)),
+		"total-equality-deletes": strconv.FormatInt(equalityDeleteCount, 10),
+		"total-files-size":       strconv.FormatInt(dataSize+deleteSize, 10),
+		"total-position-deletes": strconv.FormatInt(positionDeleteCount, 10),
+		"total-records":          strconv.FormatInt(recordCount, 10),
+
+		ICEBERG_SNAPSHOT_SUMMARY_TYPED_BOUNDS: "true",
+	}
+
+	metadata := map[string]interface{}{
+		"format-version":        2,
+		"table-uuid":            history.TableUuid,
+		"location":              fileSystemPrefix + filePath,
+		"last-sequence-number":  sequenceNumber,
+		"last-updated-ms":       currentTimestampMs,
+		"last-column-id":        lastColumnId,
+		"schemas":               history.Schemas,
+		"current-schema-id":     schemaId,
+		"partition-specs":       history.PartitionSpecs,
+		"default-spec-id":       partitionSpec.SpecId,
+		"default-sort-order-id": 0,
+		"last-partition-id":     history.lastPartitionId(),
+		"properties":            properties,
+		"current-snapshot-id":   manifestFile.SnapshotId,
+		"refs": map[string]interface{}{
+			"main": map[string]interface{}{
+				"snapshot-id": manifestFile.SnapshotId,
+				"type":        "branch",
+			},
+		},
+		"snapshots": append(history.Snapshots, snapshot),
+		"snapshot-log": append(history.SnapshotLog, map[string]interface{}{
+			"snapshot-id":  manifestFile.SnapshotId,
+			"timestamp-ms": currentTimestampMs,
+		}),
+		"metadata-log": metadataLog,
+		"sort-orders": []interface{}{
+			map[string]interface{}{
+				"order-id": 0,
+				"fields":   []interface{}{},
+			},
+		},
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata file: %v", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write metadata to file: %v", err)
+	}
+
+	return expiredMetadataPaths, nil
+}
+
+// Returns the content of the metadata file that follows the previous one with metadata derived from it, e.g., with expired snapshots.
+// Like WriteMetadataFile, the previous metadata file is added to the metadata log, and returns the previous metadata files dropped
+// from the log beyond the kept metadata versions
+func (storage *StorageBase) NextMetadataContent(previousMetadataLocation string, previousMetadataContent []byte, metadataContent []byte) (nextMetadataContent []byte, expiredMetadataPaths []string, err error) {
+	previousHistory, err := parseIcebergMetadataHistory(previousMetadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	history, err := parseIcebergMetadataHistory(metadataContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	history.LastUpdatedMs = previousHistory.LastUpdatedMs
+	metadataLog, expiredMetadataPaths := history.metadataLog(previousMetadataLocation, true, storage.config.Iceberg.KeepMetadataVersions)
+
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	var metadata map[string]interface{}
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	metadata["metadata-log"] = metadataLog
+	metadata["last-updated-ms"] = time.Now().UnixMilli()
+
+	nextMetadataContent, err = json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialize metadata: %v", err)
+	}
+
+	return append(nextMetadataContent, '\n'), expiredMetadataPaths, nil
+}
+
+func (storage *StorageBase) WriteVersionHintFile(filePath string, metadataFile MetadataFile) (err error) {
+	versionHintFile, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create version hint file: %v", err)
+	}
+	defer versionHintFile.Close()
+
+	_, err = versionHintFile.WriteString(fmt.Sprintf("%d", metadataFile.Version))
+	if err != nil {
+		return fmt.Errorf("failed to write to version hint file: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageBase) parquetFilesTotals(parquetFiles []ParquetFile) (recordCount int64, size int64) {
+	for _, parquetFile := range parquetFiles {
+		recordCount += parquetFile.RecordCount
+		size += parquetFile.Size
+	}
+	return recordCount, size
+}
 
 func (storage *StorageBase) buildFieldIDMap(schemaHandler *schema.SchemaHandler) map[string]int {
 	fieldIDMap := make(map[string]int)
@@ -471,3 +1644,357 @@ func (storage *StorageBase) buildFieldIDMap(schemaHandler *schema.SchemaHandler)
 	}
 	return fieldIDMap
 }
+
+// Returns the schema elements of the columns that have lower and upper bounds in manifests by name
+func (storage *StorageBase) buildBoundSchemaElements(schemaHandler *schema.SchemaHandler) map[string]*parquet.SchemaElement {
+	boundSchemaElements := make(map[string]*parquet.SchemaElement)
+	for _, schema := range schemaHandler.SchemaElements {
+		if schema.FieldID != nil && parquetColumnBoundType(schema) != "" {
+			boundSchemaElements[schema.Name] = schema
+		}
+	}
+	return boundSchemaElements
+}
+
+// Manifest fields of a data or delete file that aren't stored in the file itself
+type IcebergManifestEntry struct {
+	Content          int
+	PartitionValue   interface{}
+	SequenceNumber   int64
+	EqualityFieldIds []int
+}
+
+// Returns the paths of the data files and delete files referenced by the current snapshot with their manifest entries by path.
+// Files that are not committed yet or only belong to previous snapshots are kept in the data directory until they are
+// vacuumed, so listing it is not enough
+func (storage *StorageBase) CurrentSnapshotFilePaths(metadataContent []byte, readFile func(path string) ([]byte, error)) (dataFilePaths Set[string], deleteFilePaths Set[string], manifestEntries map[string]IcebergManifestEntry, err error) {
+	dataFilePaths = NewSet([]string{})
+	deleteFilePaths = NewSet([]string{})
+	manifestEntries = make(map[string]IcebergManifestEntry)
+
+	manifestListPath, err := parseCurrentSnapshotManifestListPath(metadataContent)
+	if err != nil || manifestListPath == "" {
+		return dataFilePaths, deleteFilePaths, manifestEntries, err
+	}
+
+	manifestListContent, err := readFile(manifestListPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	manifestListRecords, err := readAvroRecords(manifestListContent)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read manifest list: %v", err)
+	}
+
+	for _, manifestListRecord := range manifestListRecords {
+		manifestContent, err := readFile(manifestListRecord["manifest_path"].(string))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		manifestDataFilePaths, manifestDeleteFilePaths, entries, err := parseManifestFiles(manifestContent, manifestListRecord["sequence_number"].(int64))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		maps.Copy(manifestEntries, entries)
+		for _, dataFilePath := range manifestDataFilePaths {
+			dataFilePaths.Add(dataFilePath)
+		}
+		for _, deleteFilePath := range manifestDeleteFilePaths {
+			deleteFilePaths.Add(deleteFilePath)
+		}
+	}
+
+	return dataFilePaths, deleteFilePaths, manifestEntries, nil
+}
+
+// Position delete files list the rows deleted from data files by their location and row position.
+// The columns have the field IDs reserved by the Iceberg spec
+var POSITION_DELETE_PG_SCHEMA_COLUMNS = []PgSchemaColumn{
+	{ColumnName: "file_path", DataType: "text", UdtName: "text", IsNullable: "NO", OrdinalPosition: "2147483546", Namespace: PG_SCHEMA_PG_CATALOG},
+	{ColumnName: "pos", DataType: "bigint", UdtName: "int8", IsNullable: "NO", OrdinalPosition: "2147483545", NumericPrecision: "64", Namespace: PG_SCHEMA_PG_CATALOG},
+}
+
+// Adds the positions read from a position delete file to the deleted positions by data file location
+func addPositionDeletes(deletedPositions map[string]Set[int64], positionDeleteRows [][]interface{}) {
+	for _, row := range positionDeleteRows {
+		location, pos := row[0].(string), row[1].(int64)
+		if deletedPositions[location] == nil {
+			deletedPositions[location] = make(Set[int64])
+		}
+		deletedPositions[location].Add(pos)
+	}
+}
+
+func withoutDeletedRows(rows [][]interface{}, deletedPositions Set[int64]) [][]interface{} {
+	if len(deletedPositions) == 0 {
+		return rows
+	}
+
+	var remainingRows [][]interface{}
+	for pos, row := range rows {
+		if !deletedPositions.Contains(int64(pos)) {
+			remainingRows = append(remainingRows, row)
+		}
+	}
+	return remainingRows
+}
+
+// Returns the deleted row positions by data file location of the position delete files and the equality delete files
+func icebergDeletedPositions(dataFiles []ParquetFile, deleteFiles []ParquetFile, icebergSchemaFields []IcebergSchemaField, location func(ParquetFile) string, readFileColumns func(ParquetFile, []string) ([][]interface{}, error)) (deletedPositions map[string]Set[int64], err error) {
+	deletedPositions = make(map[string]Set[int64])
+	var equalityDeleteFiles []ParquetFile
+	for _, deleteFile := range deleteFiles {
+		if deleteFile.Content == ICEBERG_CONTENT_EQUALITY_DELETES {
+			equalityDeleteFiles = append(equalityDeleteFiles, deleteFile)
+			continue
+		}
+		positionDeleteRows, err := readFileColumns(deleteFile, []string{"file_path", "pos"})
+		if err != nil {
+			return nil, err
+		}
+		addPositionDeletes(deletedPositions, positionDeleteRows)
+	}
+	if len(equalityDeleteFiles) == 0 {
+		return deletedPositions, nil
+	}
+
+	resolvedDeleteRows, err := resolveEqualityDeletes(dataFiles, equalityDeleteFiles, icebergSchemaFields, location, readFileColumns)
+	if err != nil {
+		return nil, err
+	}
+	for _, positionDeleteRows := range resolvedDeleteRows {
+		for _, row := range positionDeleteRows {
+			pos, err := StringToInt(row[1])
+			if err != nil {
+				return nil, err
+			}
+			addPositionDeletes(deletedPositions, [][]interface{}{{row[0], int64(pos)}})
+		}
+	}
+	return deletedPositions, nil
+}
+
+// Equality delete files list the key values of deleted rows, which apply to the rows of data files with a lower data sequence number,
+// so that rows added with the same key by the snapshot of the delete file or a later one are kept. BemiDB writes them only for
+// unpartitioned tables, so they apply to all data files. Returns the rows deleted by each equality delete file as position delete rows
+// with the location and position, sorted by them as required by the Iceberg spec
+func resolveEqualityDeletes(dataFiles []ParquetFile, equalityDeleteFiles []ParquetFile, icebergSchemaFields []IcebergSchemaField, location func(ParquetFile) string, readFileColumns func(ParquetFile, []string) ([][]interface{}, error)) (positionDeleteRows [][][]string, err error) {
+	fieldColumnNames := make(map[int]string)
+	for _, icebergSchemaField := range icebergSchemaFields {
+		fieldColumnNames[icebergSchemaField.Id] = icebergSchemaField.Name
+	}
+
+	deleteColumnNames := make([][]string, len(equalityDeleteFiles))
+	deletedKeys := make([]Set[string], len(equalityDeleteFiles))
+	for i, equalityDeleteFile := range equalityDeleteFiles {
+		for _, fieldId := range equalityDeleteFile.EqualityFieldIds {
+			columnName, ok := fieldColumnNames[fieldId]
+			if !ok {
+				return nil, fmt.Errorf("equality field %d of delete file %s not found in the schema", fieldId, location(equalityDeleteFile))
+			}
+			deleteColumnNames[i] = append(deleteColumnNames[i], columnName)
+		}
+
+		rows, err := readFileColumns(equalityDeleteFile, deleteColumnNames[i])
+		if err != nil {
+			return nil, err
+		}
+		deletedKeys[i] = make(Set[string])
+		for _, row := range rows {
+			if key, ok := icebergEqualityDeleteKey(row); ok {
+				deletedKeys[i].Add(key)
+			}
+		}
+	}
+
+	dataFiles = slices.Clone(dataFiles)
+	slices.SortFunc(dataFiles, func(a, b ParquetFile) int {
+		return strings.Compare(location(a), location(b))
+	})
+	positionDeleteRows = make([][][]string, len(equalityDeleteFiles))
+	for _, dataFile := range dataFiles {
+		// Data files are read once for the columns of all equality delete files keyed on the same columns
+		rowsByColumnNames := make(map[string][][]interface{})
+		for i, equalityDeleteFile := range equalityDeleteFiles {
+			if equalityDeleteFile.SequenceNumber <= dataFile.SequenceNumber {
+				continue
+			}
+			columnNamesKey := strings.Join(deleteColumnNames[i], DELETE_TRACKER_KEY_SEPARATOR)
+			rows, ok := rowsByColumnNames[columnNamesKey]
+			if !ok {
+				rows, err = readFileColumns(dataFile, deleteColumnNames[i])
+				if err != nil {
+					return nil, err
+				}
+				rowsByColumnNames[columnNamesKey] = rows
+			}
+
+			for pos, row := range rows {
+				if key, ok := icebergEqualityDeleteKey(row); ok && deletedKeys[i].Contains(key) {
+					positionDeleteRows[i] = append(positionDeleteRows[i], []string{location(dataFile), IntToString(pos)})
+				}
+			}
+		}
+	}
+	return positionDeleteRows, nil
+}
+
+// Returns the key of the values of equality delete columns read from Parquet, or false if any of them is NULL, since BemiDB keys
+// equality deletes on the primary key. Values of the same column are read as the same type from data files and delete files
+func icebergEqualityDeleteKey(values []interface{}) (string, bool) {
+	var keyValues []string
+	for _, value := range values {
+		if value == nil {
+			return "", false
+		}
+		keyValues = append(keyValues, fmt.Sprintf("%v", value))
+	}
+	return strings.Join(keyValues, DELETE_TRACKER_KEY_SEPARATOR), true
+}
+
+// Reads the columns of the data files of the current snapshot by location, skipping rows deleted by position delete files and equality
+// delete files. Data files are read in the order of their locations
+func (storage *StorageBase) ReadCurrentSnapshotColumns(metadataContent []byte, readFile func(path string) ([]byte, error), readFileColumns func(location string, columnNames []string) ([][]interface{}, error), columnNames []string) (rows [][]interface{}, err error) {
+	dataFilePaths, deleteFilePaths, manifestEntries, err := storage.CurrentSnapshotFilePaths(metadataContent, readFile)
+	if err != nil {
+		return nil, err
+	}
+	icebergSchemaFields, err := storage.ParseIcebergSchemaFields(metadataContent)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotFiles := func(filePaths Set[string]) (parquetFiles []ParquetFile) {
+		for _, filePath := range filePaths.Values() {
+			manifestEntry := manifestEntries[filePath]
+			parquetFiles = append(parquetFiles, ParquetFile{Path: filePath, Content: manifestEntry.Content, SequenceNumber: manifestEntry.SequenceNumber, EqualityFieldIds: manifestEntry.EqualityFieldIds})
+		}
+		return parquetFiles
+	}
+	location := func(parquetFile ParquetFile) string { return parquetFile.Path }
+	readParquetFileColumns := func(parquetFile ParquetFile, columnNames []string) ([][]interface{}, error) {
+		return readFileColumns(parquetFile.Path, columnNames)
+	}
+
+	deletedPositions, err := icebergDeletedPositions(snapshotFiles(dataFilePaths), snapshotFiles(deleteFilePaths), icebergSchemaFields, location, readParquetFileColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	sortedDataFilePaths := dataFilePaths.Values()
+	slices.Sort(sortedDataFilePaths)
+	for _, dataFilePath := range sortedDataFilePaths {
+		fileRows, err := readFileColumns(dataFilePath, columnNames)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, withoutDeletedRows(fileRows, deletedPositions[dataFilePath])...)
+	}
+	return rows, nil
+}
+
+func parseCurrentSnapshotManifestListPath(metadataContent []byte) (manifestListPath string, err error) {
+	var metadata struct {
+		CurrentSnapshotId *json.Number `json:"current-snapshot-id"`
+		Snapshots         []struct {
+			SnapshotId   json.Number `json:"snapshot-id"`
+			ManifestList string      `json:"manifest-list"`
+		} `json:"snapshots"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(metadataContent))
+	decoder.UseNumber() // Snapshot IDs don't fit into float64
+	if err := decoder.Decode(&metadata); err != nil {
+		return "", fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	if metadata.CurrentSnapshotId == nil {
+		return "", nil
+	}
+
+	for _, snapshot := range metadata.Snapshots {
+		if snapshot.SnapshotId == *metadata.CurrentSnapshotId {
+			return snapshot.ManifestList, nil
+		}
+	}
+	return "", fmt.Errorf("current snapshot %s not found in metadata", *metadata.CurrentSnapshotId)
+}
+
+func parseManifestListManifestPaths(manifestListContent []byte) (manifestPaths []string, err error) {
+	records, err := readAvroRecords(manifestListContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest list: %v", err)
+	}
+
+	for _, record := range records {
+		manifestPaths = append(manifestPaths, record["manifest_path"].(string))
+	}
+
+	return manifestPaths, nil
+}
+
+// Data files removed from the table (status 2) are not referenced anymore
+func parseManifestDataFilePaths(manifestContent []byte) (dataFilePaths []string, err error) {
+	dataFilePaths, _, err = parseManifestFilePaths(manifestContent)
+	return dataFilePaths, err
+}
+
+func parseManifestFilePaths(manifestContent []byte) (dataFilePaths []string, deleteFilePaths []string, err error) {
+	dataFilePaths, deleteFilePaths, _, err = parseManifestFiles(manifestContent, 0)
+	return dataFilePaths, deleteFilePaths, err
+}
+
+// Returns the paths of the data files and delete files of the manifest with their manifest entries by path.
+// Files written without a data sequence number inherit the one of the manifest, like all files written before they got one
+func parseManifestFiles(manifestContent []byte, manifestSequenceNumber int64) (dataFilePaths []string, deleteFilePaths []string, manifestEntries map[string]IcebergManifestEntry, err error) {
+	records, err := readAvroRecords(manifestContent)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+
+	manifestEntries = make(map[string]IcebergManifestEntry)
+	for _, record := range records {
+		if record["status"] == int32(2) {
+			continue
+		}
+		dataFile := record["data_file"].(map[string]interface{})
+		filePath := dataFile["file_path"].(string)
+		manifestEntry := IcebergManifestEntry{
+			Content:        int(dataFile["content"].(int32)),
+			PartitionValue: icebergPartitionAvroValue(dataFile["partition"]),
+			SequenceNumber: manifestSequenceNumber,
+		}
+		if sequenceNumber, ok := record["sequence_number"].(map[string]interface{}); ok {
+			manifestEntry.SequenceNumber = sequenceNumber["long"].(int64)
+		}
+		if equalityIds, ok := dataFile["equality_ids"].(map[string]interface{}); ok {
+			for _, equalityId := range equalityIds["array"].([]interface{}) {
+				manifestEntry.EqualityFieldIds = append(manifestEntry.EqualityFieldIds, int(equalityId.(int64)))
+			}
+		}
+		manifestEntries[filePath] = manifestEntry
+
+		if manifestEntry.Content == ICEBERG_CONTENT_DATA {
+			dataFilePaths = append(dataFilePaths, filePath)
+		} else {
+			deleteFilePaths = append(deleteFilePaths, filePath)
+		}
+	}
+
+	return dataFilePaths, deleteFilePaths, manifestEntries, nil
+}
+
+func readAvroRecords(content []byte) (records []map[string]interface{}, err error) {
+	ocfReader, err := goavro.NewOCFReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	for ocfReader.Scan() {
+		datum, err := ocfReader.Read()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, datum.(map[string]interface{}))
+	}
+
+	return records, ocfReader.Err()
+}
@@ -5,9 +5,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/source"
 )
 
 type StorageLocal struct {
@@ -21,8 +23,9 @@ func NewLocalStorage(config *Config) *StorageLocal {
 
 // Read ----------------------------------------------------------------------------------------------------------------
 
-func (storage *StorageLocal) IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) string {
-	return storage.tablePath(icebergSchemaTable, true) + "/metadata/v1.metadata.json"
+func (storage *StorageLocal) IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) (path string, err error) {
+	metadataFile, _, err := storage.storageBase.ReadCurrentMetadataFile(storage.tablePath(icebergSchemaTable, true)+"/metadata", storage.readIcebergTableFileIfExists)
+	return metadataFile.Path, err
 }
 
 func (storage *StorageLocal) IcebergSchemas() (icebergSchemas []string, err error) {
@@ -59,7 +62,10 @@ func (storage *StorageLocal) IcebergSchemaTables() (Set[IcebergSchemaTable], err
 }
 
 func (storage *StorageLocal) IcebergTableFields(icebergSchemaTable IcebergSchemaTable) ([]IcebergTableField, error) {
-	metadataPath := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
 	metadataFile, err := os.Open(metadataPath)
 	if err != nil {
 		return nil, err
@@ -74,6 +80,187 @@ func (storage *StorageLocal) IcebergTableFields(icebergSchemaTable IcebergSchema
 	return storage.storageBase.ParseIcebergTableFields(metadataContent)
 }
 
+func (storage *StorageLocal) IcebergSchemaFields(icebergSchemaTable IcebergSchemaTable) ([]IcebergSchemaField, error) {
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	metadataContent, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ParseIcebergSchemaFields(metadataContent)
+}
+
+func (storage *StorageLocal) IcebergTableProperties(icebergSchemaTable IcebergSchemaTable) (map[string]string, error) {
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	metadataContent, err := storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ParseIcebergTableProperties(metadataContent)
+}
+
+func (storage *StorageLocal) IcebergDataFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error) {
+	return storage.icebergParquetFiles(icebergSchemaTable, ICEBERG_CONTENT_DATA)
+}
+
+func (storage *StorageLocal) IcebergDeleteFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error) {
+	return storage.icebergParquetFiles(icebergSchemaTable, ICEBERG_CONTENT_POSITION_DELETES)
+}
+
+// Rows deleted by position delete files and equality delete files are skipped
+func (storage *StorageLocal) ReadParquetColumns(schemaTable IcebergSchemaTable, columnNames []string) (rows [][]interface{}, err error) {
+	_, metadataContent, err := storage.storageBase.ReadCurrentMetadataFile(storage.tablePath(schemaTable)+"/metadata", storage.readIcebergTableFileIfExists)
+	if err != nil || metadataContent == nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ReadCurrentSnapshotColumns(metadataContent, storage.ReadIcebergTableFile, storage.ReadParquetLocationColumns, columnNames)
+}
+
+func (storage *StorageLocal) ReadParquetFileColumns(parquetFile ParquetFile, columnNames []string) (rows [][]interface{}, err error) {
+	fileReader, err := local.NewLocalFileReader(parquetFile.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+	}
+
+	return storage.storageBase.ReadParquetColumns(fileReader, columnNames)
+}
+
+func (storage *StorageLocal) ReadParquetLocationColumns(location string, columnNames []string) (rows [][]interface{}, err error) {
+	return storage.ReadParquetFileColumns(ParquetFile{Path: strings.TrimPrefix(location, storage.fileSystemPrefix())}, columnNames)
+}
+
+func (storage *StorageLocal) ParquetFileLocation(parquetFile ParquetFile) string {
+	return storage.fileSystemPrefix() + parquetFile.Path
+}
+
+func (storage *StorageLocal) IcebergTableFiles(icebergSchemaTable IcebergSchemaTable) (icebergTableFiles []IcebergTableFile, err error) {
+	err = filepath.WalkDir(storage.tablePath(icebergSchemaTable, true), func(path string, dirEntry os.DirEntry, err error) error {
+		if err != nil || dirEntry.IsDir() {
+			return err
+		}
+
+		fileInfo, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+
+		icebergTableFiles = append(icebergTableFiles, IcebergTableFile{
+			Path:         path,
+			Size:         fileInfo.Size(),
+			LastModified: fileInfo.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list table files: %v", err)
+	}
+
+	return icebergTableFiles, nil
+}
+
+// Lists all files under the storage path grouped by the table they belong to
+func (storage *StorageLocal) IcebergStorageFiles() (icebergStorageFiles map[IcebergSchemaTable][]IcebergTableFile, err error) {
+	icebergStorageFiles = make(map[IcebergSchemaTable][]IcebergTableFile)
+	storagePath := storage.absoluteIcebergPath()
+	err = filepath.WalkDir(storagePath, func(path string, dirEntry os.DirEntry, err error) error {
+		if err != nil || dirEntry.IsDir() {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(storagePath, path)
+		if err != nil {
+			return err
+		}
+		schemaTable, ok := icebergStorageFileSchemaTable(filepath.ToSlash(relativePath))
+		if !ok {
+			return nil
+		}
+
+		fileInfo, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+
+		icebergStorageFiles[schemaTable] = append(icebergStorageFiles[schemaTable], IcebergTableFile{
+			Path:         path,
+			Size:         fileInfo.Size(),
+			LastModified: fileInfo.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage files: %v", err)
+	}
+
+	return icebergStorageFiles, nil
+}
+
+func (storage *StorageLocal) ReadIcebergTableFile(path string) (content []byte, err error) {
+	return os.ReadFile(path)
+}
+
+func (storage *StorageLocal) currentSnapshotFilePaths(metadataDirPath string) (dataFilePaths Set[string], deleteFilePaths Set[string], manifestEntries map[string]IcebergManifestEntry, err error) {
+	_, metadataContent, err := storage.storageBase.ReadCurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil || metadataContent == nil {
+		return NewSet([]string{}), NewSet([]string{}), map[string]IcebergManifestEntry{}, err
+	}
+
+	return storage.storageBase.CurrentSnapshotFilePaths(metadataContent, storage.ReadIcebergTableFile)
+}
+
+// Returns the data files or the delete files of the current snapshot, depending on the content
+func (storage *StorageLocal) icebergParquetFiles(icebergSchemaTable IcebergSchemaTable, content int) (parquetFiles []ParquetFile, err error) {
+	dataFilePaths, deleteFilePaths, manifestEntries, err := storage.currentSnapshotFilePaths(storage.tablePath(icebergSchemaTable, true) + "/metadata")
+	if err != nil {
+		return nil, err
+	}
+
+	filePaths, err := filepath.Glob(filepath.Join(storage.tablePath(icebergSchemaTable, true), "data", "*.parquet"))
+	if err != nil {
+		return nil, err
+	}
+	contentFilePaths := dataFilePaths
+	if content == ICEBERG_CONTENT_POSITION_DELETES {
+		contentFilePaths = deleteFilePaths
+	}
+
+	for _, filePath := range filePaths {
+		if !contentFilePaths.Contains(filePath) {
+			continue
+		}
+
+		parquetFile, err := storage.readParquetFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		manifestEntry := manifestEntries[filePath]
+		parquetFile.Content = manifestEntry.Content
+		parquetFile.PartitionValue = manifestEntry.PartitionValue
+		parquetFile.SequenceNumber = manifestEntry.SequenceNumber
+		parquetFile.EqualityFieldIds = manifestEntry.EqualityFieldIds
+		parquetFiles = append(parquetFiles, parquetFile)
+	}
+
+	return parquetFiles, nil
+}
+
+// Returns nil content if the file doesn't exist
+func (storage *StorageLocal) readIcebergTableFileIfExists(path string) (content []byte, err error) {
+	content, err = storage.ReadIcebergTableFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
 func (storage *StorageLocal) absoluteIcebergPath(relativePaths ...string) string {
 	execPath, err := os.Getwd()
 	PanicIfError(err)
@@ -137,7 +324,7 @@ func (storage *StorageLocal) CreateParquet(dataDirPath string, pgSchemaColumns [
 	if err != nil {
 		return ParquetFile{}, err
 	}
-	LogDebug(storage.config, "Parquet file with", recordCount, "record(s) created at:", filePath)
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet file with", recordCount, "record(s) created at:", filePath)
 
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -163,58 +350,230 @@ func (storage *StorageLocal) CreateParquet(dataDirPath string, pgSchemaColumns [
 	}, nil
 }
 
-func (storage *StorageLocal) CreateManifest(metadataDirPath string, parquetFile ParquetFile) (manifestFile ManifestFile, err error) {
-	fileName := fmt.Sprintf("%s-m0.avro", parquetFile.Uuid)
+func (storage *StorageLocal) CurrentMetadataVersion(metadataDirPath string) (version int64, err error) {
+	return storage.storageBase.CurrentMetadataVersion(metadataDirPath, storage.readIcebergTableFileIfExists)
+}
+
+func (storage *StorageLocal) NextSequenceNumber(metadataDirPath string, baseVersion int64) (sequenceNumber int64, err error) {
+	return storage.storageBase.NextSequenceNumber(metadataDirPath, baseVersion, storage.readIcebergTableFileIfExists)
+}
+
+func (storage *StorageLocal) ResolvePartitionSpec(metadataDirPath string, partitionFields []IcebergPartitionField) (partitionSpec IcebergPartitionSpec, err error) {
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return IcebergPartitionSpec{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return IcebergPartitionSpec{}, err
+	}
+
+	return storage.storageBase.ResolvePartitionSpec(partitionFields, previousMetadataContent)
+}
+
+func (storage *StorageLocal) CreateManifest(metadataDirPath string, snapshotId int64, sequenceNumber int64, partitionSpec IcebergPartitionSpec, parquetFiles []ParquetFile) (manifestFile ManifestFile, err error) {
+	fileName := fmt.Sprintf("%s-m0.avro", uuid.New().String())
 	filePath := filepath.Join(metadataDirPath, fileName)
 
-	manifestFile, err = storage.storageBase.WriteManifestFile(storage.fileSystemPrefix(), filePath, parquetFile)
+	manifestFile, err = storage.storageBase.WriteManifestFile(storage.fileSystemPrefix(), filePath, snapshotId, sequenceNumber, partitionSpec, parquetFiles)
 	if err != nil {
 		return ManifestFile{}, err
 	}
-	LogDebug(storage.config, "Manifest file created at:", filePath)
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Manifest file created at:", filePath)
 
 	return manifestFile, nil
 }
 
-func (storage *StorageLocal) CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile) (manifestListFile ManifestListFile, err error) {
-	fileName := fmt.Sprintf("snap-%d-0-%s.avro", manifestFile.SnapshotId, parquetFile.Uuid)
+func (storage *StorageLocal) CreateManifestList(metadataDirPath string, parquetFiles []ParquetFile, manifestFiles []ManifestFile) (manifestListFile ManifestListFile, err error) {
+	fileName := fmt.Sprintf("snap-%d-0-%s.avro", manifestFiles[0].SnapshotId, parquetFiles[0].Uuid)
 	filePath := filepath.Join(metadataDirPath, fileName)
 
-	err = storage.storageBase.WriteManifestListFile(storage.fileSystemPrefix(), filePath, parquetFile, manifestFile)
+	err = storage.storageBase.WriteManifestListFile(storage.fileSystemPrefix(), filePath, manifestFiles)
 	if err != nil {
 		return ManifestListFile{}, err
 	}
-	LogDebug(storage.config, "Manifest list file created at:", filePath)
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Manifest list file created at:", filePath)
 
 	return ManifestListFile{Path: filePath}, nil
 }
 
-func (storage *StorageLocal) CreateMetadata(metadataDirPath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
-	version := int64(1)
-	fileName := fmt.Sprintf("v%d.metadata.json", version)
-	filePath := filepath.Join(metadataDirPath, fileName)
+func (storage *StorageLocal) CreateMetadata(metadataDirPath string, baseVersion int64, icebergSchemaFields []IcebergSchemaField, partitionSpec IcebergPartitionSpec, properties map[string]string, parquetFiles []ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	err = storage.storageBase.CheckBaseMetadataVersion(metadataDirPath, baseVersion, previousMetadataFile, previousMetadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	metadataFile = storage.storageBase.NextMetadataFile(metadataDirPath, previousMetadataFile, previousMetadataContent)
+
+	tempFilePath := metadataFile.Path + ".tmp-" + uuid.New().String()
+	defer os.Remove(tempFilePath)
+	metadataFile.ExpiredPaths, err = storage.storageBase.WriteMetadataFile(storage.fileSystemPrefix(), tempFilePath, icebergSchemaFields, partitionSpec, properties, parquetFiles, manifestFile, manifestListFile, previousMetadataFile.Path, previousMetadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+
+	// Unlike a rename, linking the written file fails if another writer has created the same version in the meantime
+	err = os.Link(tempFilePath, metadataFile.Path)
+	if os.IsExist(err) {
+		return MetadataFile{}, storage.storageBase.ExistingMetadataFileError(metadataFile)
+	}
+	if err != nil {
+		return MetadataFile{}, fmt.Errorf("failed to create metadata file: %v", err)
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Metadata file created at:", metadataFile.Path)
+
+	return metadataFile, nil
+}
+
+func (storage *StorageLocal) CreateNextMetadata(icebergSchemaTable IcebergSchemaTable, baseVersion int64, metadataContent []byte) (metadataFile MetadataFile, err error) {
+	metadataDirPath := storage.tablePath(icebergSchemaTable, true) + "/metadata"
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	err = storage.storageBase.CheckBaseMetadataVersion(metadataDirPath, baseVersion, previousMetadataFile, previousMetadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	metadataFile = storage.storageBase.NextMetadataFile(metadataDirPath, previousMetadataFile, previousMetadataContent)
 
-	err = storage.storageBase.WriteMetadataFile(storage.fileSystemPrefix(), filePath, pgSchemaColumns, parquetFile, manifestFile, manifestListFile)
+	nextMetadataContent, expiredPaths, err := storage.storageBase.NextMetadataContent(storage.fileSystemPrefix()+previousMetadataFile.Path, previousMetadataContent, metadataContent)
 	if err != nil {
 		return MetadataFile{}, err
 	}
-	LogDebug(storage.config, "Metadata file created at:", filePath)
+	metadataFile.ExpiredPaths = expiredPaths
 
-	return MetadataFile{Version: version, Path: filePath}, nil
+	tempFilePath := metadataFile.Path + ".tmp-" + uuid.New().String()
+	defer os.Remove(tempFilePath)
+	err = os.WriteFile(tempFilePath, nextMetadataContent, 0644)
+	if err != nil {
+		return MetadataFile{}, fmt.Errorf("failed to write metadata file: %v", err)
+	}
+
+	// Like in CreateMetadata, linking fails if another writer has created the same version in the meantime
+	err = os.Link(tempFilePath, metadataFile.Path)
+	if os.IsExist(err) {
+		return MetadataFile{}, storage.storageBase.ExistingMetadataFileError(metadataFile)
+	}
+	if err != nil {
+		return MetadataFile{}, fmt.Errorf("failed to create metadata file: %v", err)
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Metadata file created at:", metadataFile.Path)
+
+	return metadataFile, storage.CreateVersionHint(metadataDirPath, metadataFile)
 }
 
 func (storage *StorageLocal) CreateVersionHint(metadataDirPath string, metadataFile MetadataFile) (err error) {
 	filePath := filepath.Join(metadataDirPath, VERSION_HINT_FILE_NAME)
+	tempFilePath := filePath + ".tmp"
 
-	err = storage.storageBase.WriteVersionHintFile(filePath, metadataFile)
+	err = storage.storageBase.WriteVersionHintFile(tempFilePath, metadataFile)
 	if err != nil {
 		return err
 	}
-	LogDebug(storage.config, "Version hint file created at:", filePath)
+
+	// Readers see either the previous or the new version, both metadata files exist
+	err = os.Rename(tempFilePath, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace version hint file: %v", err)
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Version hint file created at:", filePath)
 
 	return nil
 }
 
+func (storage *StorageLocal) MergeParquet(dataDirPath string, parquetFiles []ParquetFile) (parquetFile ParquetFile, err error) {
+	uuid := uuid.New().String()
+	fileName := fmt.Sprintf("00000-0-%s.parquet", uuid)
+	filePath := filepath.Join(dataDirPath, fileName)
+
+	var fileReaders []source.ParquetFile
+	for _, parquetFile := range parquetFiles {
+		fileReader, err := local.NewLocalFileReader(parquetFile.Path)
+		if err != nil {
+			return ParquetFile{}, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+		}
+		fileReaders = append(fileReaders, fileReader)
+	}
+
+	fileWriter, err := local.NewLocalFileWriter(filePath)
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to open Parquet file for writing: %v", err)
+	}
+
+	recordCount, err := storage.storageBase.MergeParquetFiles(fileReaders, fileWriter)
+	if err != nil {
+		os.Remove(filePath)
+		return ParquetFile{}, err
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet file with", recordCount, "record(s) merged from", len(parquetFiles), "file(s) at:", filePath)
+
+	return storage.readParquetFile(filePath)
+}
+
+func (storage *StorageLocal) DeleteParquet(parquetFile ParquetFile) (err error) {
+	return os.Remove(parquetFile.Path)
+}
+
+// Replaces the file atomically, so readers never see a partially written file
+func (storage *StorageLocal) WriteIcebergTableFile(path string, content []byte) (err error) {
+	tempPath := path + ".tmp"
+	err = os.WriteFile(tempPath, content, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+func (storage *StorageLocal) DeleteIcebergTableFile(path string) (err error) {
+	return os.Remove(path)
+}
+
+func (storage *StorageLocal) readParquetFile(filePath string) (parquetFile ParquetFile, err error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to get Parquet file info: %v", err)
+	}
+
+	fileReader, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+	}
+	recordCount, err := storage.storageBase.ReadParquetRecordCount(fileReader)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	fileReader, err = local.NewLocalFileReader(filePath)
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+	}
+	parquetStats, err := storage.storageBase.ReadParquetStats(fileReader)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	return ParquetFile{
+		Uuid:        strings.TrimSuffix(strings.TrimPrefix(fileInfo.Name(), "00000-0-"), ".parquet"),
+		Path:        filePath,
+		Size:        fileInfo.Size(),
+		RecordCount: recordCount,
+		Stats:       parquetStats,
+	}, nil
+}
+
 func (storage *StorageLocal) tablePath(schemaTable IcebergSchemaTable, isIcebergSchemaTable ...bool) string {
 	if len(isIcebergSchemaTable) > 0 && isIcebergSchemaTable[0] {
 		return storage.absoluteIcebergPath(schemaTable.Schema, schemaTable.Table)
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsHttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
@@ -15,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/google/uuid"
 	"github.com/xitongsys/parquet-go-source/s3v2"
+	"github.com/xitongsys/parquet-go/source"
 )
 
 type StorageS3 struct {
@@ -52,8 +58,9 @@ func NewS3Storage(config *Config) *StorageS3 {
 
 // Read ----------------------------------------------------------------------------------------------------------------
 
-func (storage *StorageS3) IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) string {
-	return storage.fullBucketPath() + storage.tablePrefix(icebergSchemaTable, true) + "metadata/v1.metadata.json"
+func (storage *StorageS3) IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) (path string, err error) {
+	metadataFile, _, err := storage.storageBase.ReadCurrentMetadataFile(storage.fullBucketPath()+storage.tablePrefix(icebergSchemaTable, true)+"metadata", storage.readIcebergTableFileIfExists)
+	return metadataFile.Path, err
 }
 
 func (storage *StorageS3) IcebergSchemas() (icebergSchemas []string, err error) {
@@ -96,12 +103,15 @@ func (storage *StorageS3) IcebergSchemaTables() (Set[IcebergSchemaTable], error)
 }
 
 func (storage *StorageS3) IcebergTableFields(icebergSchemaTable IcebergSchemaTable) ([]IcebergTableField, error) {
-	metadataPath := storage.tablePrefix(icebergSchemaTable, true) + "metadata/v1.metadata.json"
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
 
 	ctx := context.Background()
 	getObjectResponse, err := storage.s3Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(storage.config.Aws.S3Bucket),
-		Key:    aws.String(metadataPath),
+		Key:    aws.String(strings.TrimPrefix(metadataPath, storage.fullBucketPath())),
 	})
 	if err != nil {
 		return nil, err
@@ -115,6 +125,205 @@ func (storage *StorageS3) IcebergTableFields(icebergSchemaTable IcebergSchemaTab
 	return storage.storageBase.ParseIcebergTableFields(metadataContent)
 }
 
+func (storage *StorageS3) IcebergSchemaFields(icebergSchemaTable IcebergSchemaTable) ([]IcebergSchemaField, error) {
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	getObjectResponse, err := storage.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(strings.TrimPrefix(metadataPath, storage.fullBucketPath())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metadataContent, err := io.ReadAll(getObjectResponse.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ParseIcebergSchemaFields(metadataContent)
+}
+
+func (storage *StorageS3) IcebergTableProperties(icebergSchemaTable IcebergSchemaTable) (map[string]string, error) {
+	metadataPath, err := storage.IcebergMetadataFilePath(icebergSchemaTable)
+	if err != nil {
+		return nil, err
+	}
+	metadataContent, err := storage.ReadIcebergTableFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ParseIcebergTableProperties(metadataContent)
+}
+
+func (storage *StorageS3) IcebergDataFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error) {
+	return storage.icebergParquetFiles(icebergSchemaTable, ICEBERG_CONTENT_DATA)
+}
+
+func (storage *StorageS3) IcebergDeleteFiles(icebergSchemaTable IcebergSchemaTable) (parquetFiles []ParquetFile, err error) {
+	return storage.icebergParquetFiles(icebergSchemaTable, ICEBERG_CONTENT_POSITION_DELETES)
+}
+
+// Rows deleted by position delete files and equality delete files are skipped
+func (storage *StorageS3) ReadParquetColumns(schemaTable IcebergSchemaTable, columnNames []string) (rows [][]interface{}, err error) {
+	_, metadataContent, err := storage.storageBase.ReadCurrentMetadataFile(storage.fullBucketPath()+storage.tablePrefix(schemaTable)+"metadata", storage.readIcebergTableFileIfExists)
+	if err != nil || metadataContent == nil {
+		return nil, err
+	}
+
+	return storage.storageBase.ReadCurrentSnapshotColumns(metadataContent, storage.ReadIcebergTableFile, storage.ReadParquetLocationColumns, columnNames)
+}
+
+func (storage *StorageS3) ReadParquetFileColumns(parquetFile ParquetFile, columnNames []string) (rows [][]interface{}, err error) {
+	fileReader, err := s3v2.NewS3FileReaderWithClient(context.Background(), storage.s3Client, storage.config.Aws.S3Bucket, parquetFile.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+	}
+
+	return storage.storageBase.ReadParquetColumns(fileReader, columnNames)
+}
+
+func (storage *StorageS3) ReadParquetLocationColumns(location string, columnNames []string) (rows [][]interface{}, err error) {
+	return storage.ReadParquetFileColumns(ParquetFile{Path: strings.TrimPrefix(location, storage.fullBucketPath())}, columnNames)
+}
+
+func (storage *StorageS3) ParquetFileLocation(parquetFile ParquetFile) string {
+	return storage.fullBucketPath() + parquetFile.Path
+}
+
+func (storage *StorageS3) IcebergTableFiles(icebergSchemaTable IcebergSchemaTable) (icebergTableFiles []IcebergTableFile, err error) {
+	ctx := context.Background()
+	paginator := s3.NewListObjectsV2Paginator(storage.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Prefix: aws.String(storage.tablePrefix(icebergSchemaTable, true)),
+	})
+
+	for paginator.HasMorePages() {
+		listResponse, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %v", err)
+		}
+
+		for _, obj := range listResponse.Contents {
+			icebergTableFiles = append(icebergTableFiles, IcebergTableFile{
+				Path:         storage.fullBucketPath() + *obj.Key,
+				Size:         *obj.Size,
+				LastModified: *obj.LastModified,
+			})
+		}
+	}
+
+	return icebergTableFiles, nil
+}
+
+// Lists all objects under the storage path grouped by the table they belong to
+func (storage *StorageS3) IcebergStorageFiles() (icebergStorageFiles map[IcebergSchemaTable][]IcebergTableFile, err error) {
+	icebergStorageFiles = make(map[IcebergSchemaTable][]IcebergTableFile)
+	storagePrefix := storage.config.StoragePath + "/"
+	ctx := context.Background()
+	paginator := s3.NewListObjectsV2Paginator(storage.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Prefix: aws.String(storagePrefix),
+	})
+
+	for paginator.HasMorePages() {
+		listResponse, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %v", err)
+		}
+
+		for _, obj := range listResponse.Contents {
+			schemaTable, ok := icebergStorageFileSchemaTable(strings.TrimPrefix(*obj.Key, storagePrefix))
+			if !ok {
+				continue
+			}
+
+			icebergStorageFiles[schemaTable] = append(icebergStorageFiles[schemaTable], IcebergTableFile{
+				Path:         storage.fullBucketPath() + *obj.Key,
+				Size:         *obj.Size,
+				LastModified: *obj.LastModified,
+			})
+		}
+	}
+
+	return icebergStorageFiles, nil
+}
+
+func (storage *StorageS3) ReadIcebergTableFile(path string) (content []byte, err error) {
+	getObjectResponse, err := storage.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(strings.TrimPrefix(path, storage.fullBucketPath())),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer getObjectResponse.Body.Close()
+
+	return io.ReadAll(getObjectResponse.Body)
+}
+
+func (storage *StorageS3) currentSnapshotFilePaths(metadataDirPath string) (dataFilePaths Set[string], deleteFilePaths Set[string], manifestEntries map[string]IcebergManifestEntry, err error) {
+	_, metadataContent, err := storage.storageBase.ReadCurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil || metadataContent == nil {
+		return NewSet([]string{}), NewSet([]string{}), map[string]IcebergManifestEntry{}, err
+	}
+
+	return storage.storageBase.CurrentSnapshotFilePaths(metadataContent, storage.ReadIcebergTableFile)
+}
+
+// Returns the data files or the delete files of the current snapshot, depending on the content
+func (storage *StorageS3) icebergParquetFiles(icebergSchemaTable IcebergSchemaTable, content int) (parquetFiles []ParquetFile, err error) {
+	ctx := context.Background()
+	dataFilePaths, deleteFilePaths, manifestEntries, err := storage.currentSnapshotFilePaths(storage.fullBucketPath() + storage.tablePrefix(icebergSchemaTable, true) + "metadata")
+	if err != nil {
+		return nil, err
+	}
+	contentFilePaths := dataFilePaths
+	if content == ICEBERG_CONTENT_POSITION_DELETES {
+		contentFilePaths = deleteFilePaths
+	}
+
+	// The data directory keeps the files of previous snapshots as well, so the files are read from the snapshot instead of a listing
+	for _, contentFilePath := range storage.sortedFilePaths(contentFilePaths) {
+		fileKey := strings.TrimPrefix(contentFilePath, storage.fullBucketPath())
+		headObjectResponse, err := storage.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(storage.config.Aws.S3Bucket),
+			Key:    aws.String(fileKey),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Parquet file info: %v", err)
+		}
+
+		parquetFile, err := storage.readParquetFile(fileKey, *headObjectResponse.ContentLength)
+		if err != nil {
+			return nil, err
+		}
+		manifestEntry := manifestEntries[contentFilePath]
+		parquetFile.Content = manifestEntry.Content
+		parquetFile.PartitionValue = manifestEntry.PartitionValue
+		parquetFile.SequenceNumber = manifestEntry.SequenceNumber
+		parquetFile.EqualityFieldIds = manifestEntry.EqualityFieldIds
+		parquetFiles = append(parquetFiles, parquetFile)
+	}
+
+	return parquetFiles, nil
+}
+
+// Returns nil content if the object doesn't exist
+func (storage *StorageS3) readIcebergTableFileIfExists(path string) (content []byte, err error) {
+	content, err = storage.ReadIcebergTableFile(path)
+	var noSuchKeyErr *types.NoSuchKey
+	if errors.As(err, &noSuchKeyErr) {
+		return nil, nil
+	}
+	return content, err
+}
+
 // Write ---------------------------------------------------------------------------------------------------------------
 
 func (storage *StorageS3) DeleteSchema(schema string) (err error) {
@@ -151,7 +360,7 @@ func (storage *StorageS3) CreateParquet(dataDirPath string, pgSchemaColumns []Pg
 	if err != nil {
 		return ParquetFile{}, err
 	}
-	LogDebug(storage.config, "Parquet file with", recordCount, "record(s) created at:", fileKey)
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet file with", recordCount, "record(s) created at:", fileKey)
 
 	headObjectResponse, err := storage.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(storage.config.Aws.S3Bucket),
@@ -180,17 +389,38 @@ func (storage *StorageS3) CreateParquet(dataDirPath string, pgSchemaColumns []Pg
 	}, nil
 }
 
-func (storage *StorageS3) CreateManifest(metadataDirPath string, parquetFile ParquetFile) (manifestFile ManifestFile, err error) {
-	fileName := fmt.Sprintf("%s-m0.avro", parquetFile.Uuid)
+func (storage *StorageS3) CurrentMetadataVersion(metadataDirPath string) (version int64, err error) {
+	return storage.storageBase.CurrentMetadataVersion(metadataDirPath, storage.readIcebergTableFileIfExists)
+}
+
+func (storage *StorageS3) NextSequenceNumber(metadataDirPath string, baseVersion int64) (sequenceNumber int64, err error) {
+	return storage.storageBase.NextSequenceNumber(metadataDirPath, baseVersion, storage.readIcebergTableFileIfExists)
+}
+
+func (storage *StorageS3) ResolvePartitionSpec(metadataDirPath string, partitionFields []IcebergPartitionField) (partitionSpec IcebergPartitionSpec, err error) {
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return IcebergPartitionSpec{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return IcebergPartitionSpec{}, err
+	}
+
+	return storage.storageBase.ResolvePartitionSpec(partitionFields, previousMetadataContent)
+}
+
+func (storage *StorageS3) CreateManifest(metadataDirPath string, snapshotId int64, sequenceNumber int64, partitionSpec IcebergPartitionSpec, parquetFiles []ParquetFile) (manifestFile ManifestFile, err error) {
+	fileName := fmt.Sprintf("%s-m0.avro", uuid.New().String())
 	filePath := metadataDirPath + "/" + fileName
 
-	tempFile, err := CreateTemporaryFile("manifest")
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
 	if err != nil {
 		return ManifestFile{}, err
 	}
 	defer DeleteTemporaryFile(tempFile)
 
-	manifestFile, err = storage.storageBase.WriteManifestFile(storage.fullBucketPath(), tempFile.Name(), parquetFile)
+	manifestFile, err = storage.storageBase.WriteManifestFile(storage.fullBucketPath(), tempFile.Name(), snapshotId, sequenceNumber, partitionSpec, parquetFiles)
 	if err != nil {
 		return ManifestFile{}, err
 	}
@@ -199,23 +429,23 @@ func (storage *StorageS3) CreateManifest(metadataDirPath string, parquetFile Par
 	if err != nil {
 		return ManifestFile{}, err
 	}
-	LogDebug(storage.config, "Manifest file created at:", filePath)
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Manifest file created at:", filePath)
 
 	manifestFile.Path = filePath
 	return manifestFile, nil
 }
 
-func (storage *StorageS3) CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile) (manifestListFile ManifestListFile, err error) {
-	fileName := fmt.Sprintf("snap-%d-0-%s.avro", manifestFile.SnapshotId, parquetFile.Uuid)
+func (storage *StorageS3) CreateManifestList(metadataDirPath string, parquetFiles []ParquetFile, manifestFiles []ManifestFile) (manifestListFile ManifestListFile, err error) {
+	fileName := fmt.Sprintf("snap-%d-0-%s.avro", manifestFiles[0].SnapshotId, parquetFiles[0].Uuid)
 	filePath := metadataDirPath + "/" + fileName
 
-	tempFile, err := CreateTemporaryFile("manifest")
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
 	if err != nil {
 		return ManifestListFile{}, err
 	}
 	defer DeleteTemporaryFile(tempFile)
 
-	err = storage.storageBase.WriteManifestListFile(storage.fullBucketPath(), tempFile.Name(), parquetFile, manifestFile)
+	err = storage.storageBase.WriteManifestListFile(storage.fullBucketPath(), tempFile.Name(), manifestFiles)
 	if err != nil {
 		return ManifestListFile{}, err
 	}
@@ -224,40 +454,102 @@ func (storage *StorageS3) CreateManifestList(metadataDirPath string, parquetFile
 	if err != nil {
 		return ManifestListFile{}, err
 	}
-	LogDebug(storage.config, "Manifest list file created at:", filePath)
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Manifest list file created at:", filePath)
 
 	return ManifestListFile{Path: filePath}, nil
 }
 
-func (storage *StorageS3) CreateMetadata(metadataDirPath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
-	version := int64(1)
-	fileName := fmt.Sprintf("v%d.metadata.json", version)
-	filePath := metadataDirPath + "/" + fileName
-
-	tempFile, err := CreateTemporaryFile("manifest")
+func (storage *StorageS3) CreateMetadata(metadataDirPath string, baseVersion int64, icebergSchemaFields []IcebergSchemaField, partitionSpec IcebergPartitionSpec, properties map[string]string, parquetFiles []ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
 	if err != nil {
 		return MetadataFile{}, err
 	}
 	defer DeleteTemporaryFile(tempFile)
 
-	err = storage.storageBase.WriteMetadataFile(storage.fullBucketPath(), tempFile.Name(), pgSchemaColumns, parquetFile, manifestFile, manifestListFile)
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	err = storage.storageBase.CheckBaseMetadataVersion(metadataDirPath, baseVersion, previousMetadataFile, previousMetadataContent)
 	if err != nil {
 		return MetadataFile{}, err
 	}
+	metadataFile = storage.storageBase.NextMetadataFile(metadataDirPath, previousMetadataFile, previousMetadataContent)
 
-	err = storage.uploadFile(filePath, tempFile)
+	metadataFile.ExpiredPaths, err = storage.storageBase.WriteMetadataFile(storage.fullBucketPath(), tempFile.Name(), icebergSchemaFields, partitionSpec, properties, parquetFiles, manifestFile, manifestListFile, previousMetadataFile.Path, previousMetadataContent)
 	if err != nil {
 		return MetadataFile{}, err
 	}
-	LogDebug(storage.config, "Metadata file created at:", filePath)
 
-	return MetadataFile{Version: version, Path: filePath}, nil
+	// The new metadata file is uploaded before the version hint is updated, so readers never see a missing file.
+	// The conditional put fails if another writer has created the same version in the meantime
+	_, err = storage.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(storage.config.Aws.S3Bucket),
+		Key:         aws.String(metadataFile.Path),
+		Body:        tempFile,
+		IfNoneMatch: aws.String("*"),
+	})
+	var responseErr *awsHttp.ResponseError
+	if errors.As(err, &responseErr) && (responseErr.HTTPStatusCode() == http.StatusPreconditionFailed || responseErr.HTTPStatusCode() == http.StatusConflict) {
+		return MetadataFile{}, storage.storageBase.ExistingMetadataFileError(metadataFile)
+	}
+	if err != nil {
+		return MetadataFile{}, fmt.Errorf("failed to upload file: %v", err)
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Metadata file created at:", metadataFile.Path)
+
+	return metadataFile, nil
+}
+
+func (storage *StorageS3) CreateNextMetadata(icebergSchemaTable IcebergSchemaTable, baseVersion int64, metadataContent []byte) (metadataFile MetadataFile, err error) {
+	metadataDirPath := storage.tablePrefix(icebergSchemaTable, true) + "metadata"
+	previousMetadataFile, err := storage.storageBase.CurrentMetadataFile(metadataDirPath, storage.readIcebergTableFileIfExists)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	previousMetadataContent, err := storage.readIcebergTableFileIfExists(previousMetadataFile.Path)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	err = storage.storageBase.CheckBaseMetadataVersion(metadataDirPath, baseVersion, previousMetadataFile, previousMetadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	metadataFile = storage.storageBase.NextMetadataFile(metadataDirPath, previousMetadataFile, previousMetadataContent)
+
+	nextMetadataContent, expiredPaths, err := storage.storageBase.NextMetadataContent(storage.fullBucketPath()+previousMetadataFile.Path, previousMetadataContent, metadataContent)
+	if err != nil {
+		return MetadataFile{}, err
+	}
+	metadataFile.ExpiredPaths = expiredPaths
+
+	// Like in CreateMetadata, the conditional put fails if another writer has created the same version in the meantime
+	_, err = storage.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(storage.config.Aws.S3Bucket),
+		Key:         aws.String(metadataFile.Path),
+		Body:        bytes.NewReader(nextMetadataContent),
+		IfNoneMatch: aws.String("*"),
+	})
+	var responseErr *awsHttp.ResponseError
+	if errors.As(err, &responseErr) && (responseErr.HTTPStatusCode() == http.StatusPreconditionFailed || responseErr.HTTPStatusCode() == http.StatusConflict) {
+		return MetadataFile{}, storage.storageBase.ExistingMetadataFileError(metadataFile)
+	}
+	if err != nil {
+		return MetadataFile{}, fmt.Errorf("failed to upload file: %v", err)
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Metadata file created at:", metadataFile.Path)
+
+	return metadataFile, storage.CreateVersionHint(metadataDirPath, metadataFile)
 }
 
 func (storage *StorageS3) CreateVersionHint(metadataDirPath string, metadataFile MetadataFile) (err error) {
 	filePath := metadataDirPath + "/" + VERSION_HINT_FILE_NAME
 
-	tempFile, err := CreateTemporaryFile("manifest")
+	tempFile, err := CreateTemporaryFile(storage.config, "manifest")
 	if err != nil {
 		return err
 	}
@@ -272,11 +564,116 @@ func (storage *StorageS3) CreateVersionHint(metadataDirPath string, metadataFile
 	if err != nil {
 		return err
 	}
-	LogDebug(storage.config, "Version hint file created at:", filePath)
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Version hint file created at:", filePath)
+
+	return nil
+}
+
+func (storage *StorageS3) MergeParquet(dataDirPath string, parquetFiles []ParquetFile) (parquetFile ParquetFile, err error) {
+	ctx := context.Background()
+	uuid := uuid.New().String()
+	fileName := fmt.Sprintf("00000-0-%s.parquet", uuid)
+	fileKey := dataDirPath + "/" + fileName
+
+	var fileReaders []source.ParquetFile
+	for _, parquetFile := range parquetFiles {
+		fileReader, err := s3v2.NewS3FileReaderWithClient(ctx, storage.s3Client, storage.config.Aws.S3Bucket, parquetFile.Path)
+		if err != nil {
+			return ParquetFile{}, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+		}
+		fileReaders = append(fileReaders, fileReader)
+	}
+
+	fileWriter, err := s3v2.NewS3FileWriterWithClient(ctx, storage.s3Client, storage.config.Aws.S3Bucket, fileKey, nil)
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to open Parquet file for writing: %v", err)
+	}
+
+	recordCount, err := storage.storageBase.MergeParquetFiles(fileReaders, fileWriter)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+	LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Parquet file with", recordCount, "record(s) merged from", len(parquetFiles), "file(s) at:", fileKey)
+
+	headObjectResponse, err := storage.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(fileKey),
+	})
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to get Parquet file info: %v", err)
+	}
+
+	return storage.readParquetFile(fileKey, *headObjectResponse.ContentLength)
+}
+
+func (storage *StorageS3) DeleteParquet(parquetFile ParquetFile) (err error) {
+	_, err = storage.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(parquetFile.Path),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %v", err)
+	}
 
 	return nil
 }
 
+func (storage *StorageS3) WriteIcebergTableFile(path string, content []byte) (err error) {
+	_, err = storage.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(strings.TrimPrefix(path, storage.fullBucketPath())),
+		Body:   bytes.NewReader(content),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageS3) DeleteIcebergTableFile(path string) (err error) {
+	_, err = storage.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(strings.TrimPrefix(path, storage.fullBucketPath())),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageS3) readParquetFile(fileKey string, fileSize int64) (parquetFile ParquetFile, err error) {
+	ctx := context.Background()
+
+	fileReader, err := s3v2.NewS3FileReaderWithClient(ctx, storage.s3Client, storage.config.Aws.S3Bucket, fileKey)
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+	}
+	recordCount, err := storage.storageBase.ReadParquetRecordCount(fileReader)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	fileReader, err = s3v2.NewS3FileReaderWithClient(ctx, storage.s3Client, storage.config.Aws.S3Bucket, fileKey)
+	if err != nil {
+		return ParquetFile{}, fmt.Errorf("failed to open Parquet file for reading: %v", err)
+	}
+	parquetStats, err := storage.storageBase.ReadParquetStats(fileReader)
+	if err != nil {
+		return ParquetFile{}, err
+	}
+
+	fileName := fileKey[strings.LastIndex(fileKey, "/")+1:]
+	return ParquetFile{
+		Uuid:        strings.TrimSuffix(strings.TrimPrefix(fileName, "00000-0-"), ".parquet"),
+		Path:        fileKey,
+		Size:        fileSize,
+		RecordCount: recordCount,
+		Stats:       parquetStats,
+	}, nil
+}
+
 func (storage *StorageS3) uploadFile(filePath string, file *os.File) (err error) {
 	uploader := manager.NewUploader(storage.s3Client)
 
@@ -300,23 +697,34 @@ func (storage *StorageS3) tablePrefix(schemaTable IcebergSchemaTable, isIcebergS
 	return storage.config.StoragePath + "/" + storage.config.Pg.SchemaPrefix + schemaTable.Schema + "/" + schemaTable.Table + "/"
 }
 
+// Files are returned in the order of their keys, like in a listing
+func (storage *StorageS3) sortedFilePaths(filePaths Set[string]) []string {
+	sortedFilePaths := filePaths.Values()
+	slices.Sort(sortedFilePaths)
+	return sortedFilePaths
+}
+
 func (storage *StorageS3) fullBucketPath() string {
 	return "s3://" + storage.config.Aws.S3Bucket + "/"
 }
 
 func (storage *StorageS3) nestedDirectoryPrefixes(prefix string) (dirs []string, err error) {
 	ctx := context.Background()
-	listResponse, err := storage.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+	paginator := s3.NewListObjectsV2Paginator(storage.s3Client, &s3.ListObjectsV2Input{
 		Bucket:    aws.String(storage.config.Aws.S3Bucket),
 		Prefix:    aws.String(prefix),
 		Delimiter: aws.String("/"),
 	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list objects: %v", err)
-	}
 
-	for _, prefix := range listResponse.CommonPrefixes {
-		dirs = append(dirs, *prefix.Prefix)
+	for paginator.HasMorePages() {
+		listResponse, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %v", err)
+		}
+
+		for _, prefix := range listResponse.CommonPrefixes {
+			dirs = append(dirs, *prefix.Prefix)
+		}
 	}
 
 	return dirs, nil
@@ -324,22 +732,28 @@ func (storage *StorageS3) nestedDirectoryPrefixes(prefix string) (dirs []string,
 
 func (storage *StorageS3) deleteNestedObjects(prefix string) (err error) {
 	ctx := context.Background()
-
-	listResponse, err := storage.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+	paginator := s3.NewListObjectsV2Paginator(storage.s3Client, &s3.ListObjectsV2Input{
 		Bucket: aws.String(storage.config.Aws.S3Bucket),
 		Prefix: aws.String(prefix),
 	})
-	if err != nil {
-		return fmt.Errorf("failed to list objects: %v", err)
-	}
 
-	var objectsToDelete []types.ObjectIdentifier
-	for _, obj := range listResponse.Contents {
-		LogDebug(storage.config, "Object to delete:", *obj.Key)
-		objectsToDelete = append(objectsToDelete, types.ObjectIdentifier{Key: obj.Key})
-	}
+	// A page has at most 1000 objects, which is also the limit of a DeleteObjects request
+	deletedCount := 0
+	for paginator.HasMorePages() {
+		listResponse, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %v", err)
+		}
+
+		var objectsToDelete []types.ObjectIdentifier
+		for _, obj := range listResponse.Contents {
+			LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Object to delete:", *obj.Key)
+			objectsToDelete = append(objectsToDelete, types.ObjectIdentifier{Key: obj.Key})
+		}
+		if len(objectsToDelete) == 0 {
+			continue
+		}
 
-	if len(objectsToDelete) > 0 {
 		_, err = storage.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
 			Bucket: aws.String(storage.config.Aws.S3Bucket),
 			Delete: &types.Delete{
@@ -350,9 +764,13 @@ func (storage *StorageS3) deleteNestedObjects(prefix string) (err error) {
 		if err != nil {
 			return fmt.Errorf("failed to delete objects: %v", err)
 		}
-		LogDebug(storage.config, "Deleted", len(objectsToDelete), "object(s).")
+		deletedCount += len(objectsToDelete)
+	}
+
+	if deletedCount > 0 {
+		LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "Deleted", deletedCount, "object(s).")
 	} else {
-		LogDebug(storage.config, "No objects to delete.")
+		LogComponentDebug(storage.config, LOG_COMPONENT_ICEBERG, "No objects to delete.")
 	}
 
 	return nil
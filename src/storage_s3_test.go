@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const S3_TEST_BUCKET = "bemidb-test"
+
+func TestS3Storage(t *testing.T) {
+	schemaTable := IcebergSchemaTable{Schema: "test_s3", Table: "events"}
+	pgSchemaColumns := []PgSchemaColumn{
+		{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", NumericPrecision: "32", Namespace: "pg_catalog"},
+	}
+	newS3Storage := func(t *testing.T) (*Config, *StorageS3, *fakeS3Server) {
+		s3Server := &fakeS3Server{objects: make(map[string]fakeS3Object)}
+		httpServer := httptest.NewServer(s3Server)
+		t.Cleanup(httpServer.Close)
+
+		config := loadTestConfig()
+		config.StorageType = STORAGE_TYPE_S3
+		config.StoragePath = "iceberg"
+		config.Aws = AwsConfig{Region: "us-east-1", S3Bucket: S3_TEST_BUCKET, AccessKeyId: "test", SecretAccessKey: "test"}
+		storage := NewS3Storage(config)
+		storage.s3Client = s3.New(s3.Options{
+			Region:       config.Aws.Region,
+			BaseEndpoint: aws.String(httpServer.URL),
+			UsePathStyle: true,
+			Credentials:  credentials.NewStaticCredentialsProvider(config.Aws.AccessKeyId, config.Aws.SecretAccessKey, ""),
+		})
+		return config, storage, s3Server
+	}
+
+	t.Run("reads the files of the current snapshot when the data directory has more than one page of objects", func(t *testing.T) {
+		config, storage, s3Server := newS3Storage(t)
+		icebergWriter := NewIcebergWriter(config)
+		icebergWriter.storage = storage
+		// Files of previous snapshots, listed before the files of the current snapshot
+		for i := 0; i < 1500; i++ {
+			s3Server.objects[fmt.Sprintf("iceberg/test_s3/events/data/0-previous-%04d.parquet", i)] = fakeS3Object{content: []byte("PAR1"), lastModified: time.Now()}
+		}
+		loaded := false
+		icebergWriter.Write(context.Background(), schemaTable, pgSchemaColumns, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return [][]string{{"1"}, {"2"}}
+		})
+
+		dataFiles, err := storage.IcebergDataFiles(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(dataFiles) != 1 || dataFiles[0].RecordCount != 2 || dataFiles[0].Size == 0 {
+			t.Errorf("Expected the data file of the current snapshot, got %v", dataFiles)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{"id"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := [][]interface{}{{int32(1)}, {int32(2)}}
+		if !reflect.DeepEqual(rows, expected) {
+			t.Errorf("Expected rows %v, got %v", expected, rows)
+		}
+	})
+
+	t.Run("deletes tables with more than one page of objects", func(t *testing.T) {
+		_, storage, s3Server := newS3Storage(t)
+		for i := 0; i < 1500; i++ {
+			s3Server.objects[fmt.Sprintf("iceberg/test_s3/events/data/%04d.parquet", i)] = fakeS3Object{content: []byte("PAR1"), lastModified: time.Now()}
+		}
+		s3Server.objects["iceberg/test_s3/users/data/0000.parquet"] = fakeS3Object{content: []byte("PAR1"), lastModified: time.Now()}
+
+		err := storage.DeleteSchemaTable(schemaTable)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(s3Server.objects) != 1 {
+			t.Errorf("Expected only the object of the other table to be kept, got %d object(s)", len(s3Server.objects))
+		}
+	})
+}
+
+type fakeS3Object struct {
+	content      []byte
+	lastModified time.Time
+}
+
+// Serves the S3 operations used by the storage from memory with path-style requests. Listings return at most 1000 keys per page
+type fakeS3Server struct {
+	mutex   sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+type fakeS3ListBucketResult struct {
+	XMLName               xml.Name             `xml:"ListBucketResult"`
+	Name                  string               `xml:"Name"`
+	Prefix                string               `xml:"Prefix"`
+	KeyCount              int                  `xml:"KeyCount"`
+	MaxKeys               int                  `xml:"MaxKeys"`
+	IsTruncated           bool                 `xml:"IsTruncated"`
+	NextContinuationToken string               `xml:"NextContinuationToken,omitempty"`
+	Contents              []fakeS3ListObject   `xml:"Contents"`
+	CommonPrefixes        []fakeS3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type fakeS3ListObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	Size         int    `xml:"Size"`
+}
+
+type fakeS3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type fakeS3Delete struct {
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+func (s3Server *fakeS3Server) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	s3Server.mutex.Lock()
+	defer s3Server.mutex.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(request.URL.Path, "/"+S3_TEST_BUCKET), "/")
+	query := request.URL.Query()
+	switch {
+	case key == "" && request.Method == http.MethodGet && query.Get("list-type") == "2":
+		s3Server.listObjects(response, query.Get("prefix"), query.Get("delimiter"), query.Get("continuation-token"))
+	case key == "" && request.Method == http.MethodPost && query.Has("delete"):
+		var deleteRequest fakeS3Delete
+		if err := xml.NewDecoder(request.Body).Decode(&deleteRequest); err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, object := range deleteRequest.Objects {
+			delete(s3Server.objects, object.Key)
+		}
+		fmt.Fprint(response, "<DeleteResult></DeleteResult>")
+	case request.Method == http.MethodPut:
+		if _, exists := s3Server.objects[key]; exists && request.Header.Get("If-None-Match") == "*" {
+			s3Server.writeError(response, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		content, err := io.ReadAll(request.Body)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s3Server.objects[key] = fakeS3Object{content: content, lastModified: time.Now()}
+	case request.Method == http.MethodDelete:
+		delete(s3Server.objects, key)
+		response.WriteHeader(http.StatusNoContent)
+	case request.Method == http.MethodGet || request.Method == http.MethodHead:
+		object, exists := s3Server.objects[key]
+		if !exists {
+			s3Server.writeError(response, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		response.Header().Set("Last-Modified", object.lastModified.UTC().Format(http.TimeFormat))
+		response.Header().Set("ETag", `"`+strconv.Itoa(len(object.content))+`"`)
+		content, status := object.content, http.StatusOK
+		if byteRange := request.Header.Get("Range"); byteRange != "" {
+			start, end := fakeS3ByteRange(byteRange, len(content))
+			response.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(content)))
+			content, status = content[start:end], http.StatusPartialContent
+		}
+		response.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		response.WriteHeader(status)
+		if request.Method == http.MethodGet {
+			response.Write(content)
+		}
+	default:
+		http.Error(response, "unexpected request", http.StatusNotImplemented)
+	}
+}
+
+func (s3Server *fakeS3Server) listObjects(response http.ResponseWriter, prefix string, delimiter string, continuationToken string) {
+	var keys []string
+	for key := range s3Server.objects {
+		if strings.HasPrefix(key, prefix) && key > continuationToken {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	result := fakeS3ListBucketResult{Name: S3_TEST_BUCKET, Prefix: prefix, MaxKeys: 1000}
+	// The continuation token is the last key of the page, including the keys grouped into its last common prefix
+	lastKey := ""
+	for _, key := range keys {
+		commonPrefix := ""
+		if delimiter != "" && strings.Contains(strings.TrimPrefix(key, prefix), delimiter) {
+			commonPrefix = prefix + strings.SplitAfter(strings.TrimPrefix(key, prefix), delimiter)[0]
+			if len(result.CommonPrefixes) > 0 && result.CommonPrefixes[len(result.CommonPrefixes)-1].Prefix == commonPrefix {
+				lastKey = key
+				continue
+			}
+		}
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = lastKey
+			break
+		}
+
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, fakeS3CommonPrefix{Prefix: commonPrefix})
+		} else {
+			object := s3Server.objects[key]
+			result.Contents = append(result.Contents, fakeS3ListObject{Key: key, LastModified: object.lastModified.UTC().Format("2006-01-02T15:04:05.000Z"), Size: len(object.content)})
+		}
+		result.KeyCount++
+		lastKey = key
+	}
+
+	response.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(response).Encode(result)
+}
+
+func (s3Server *fakeS3Server) writeError(response http.ResponseWriter, status int, code string) {
+	response.Header().Set("Content-Type", "application/xml")
+	response.WriteHeader(status)
+	fmt.Fprintf(response, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// Returns the start and the exclusive end of a "bytes=start-end", "bytes=start-", or "bytes=-suffix" range
+func fakeS3ByteRange(byteRange string, size int) (start int, end int) {
+	startText, endText, _ := strings.Cut(strings.TrimPrefix(byteRange, "bytes="), "-")
+	if startText == "" {
+		suffix, _ := strconv.Atoi(endText)
+		return max(size-suffix, 0), size
+	}
+
+	start, _ = strconv.Atoi(startText)
+	end = size
+	if endText != "" {
+		end, _ = strconv.Atoi(endText)
+		end = min(end+1, size)
+	}
+	return start, end
+}
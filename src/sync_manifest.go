@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SYNC_MANIFESTS_DIR_NAME = "manifests"
+
+	SYNC_MANIFEST_TABLE_STATUS_SYNCED  = "synced"
+	SYNC_MANIFEST_TABLE_STATUS_SKIPPED = "skipped"
+	SYNC_MANIFEST_TABLE_STATUS_FAILED  = "failed"
+)
+
+// Audit record of a single sync run, written to StoragePath/manifests/ when the run finishes
+type SyncManifest struct {
+	RunId      string              `json:"runId"`
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+	Tables     []SyncManifestTable `json:"tables"`
+	Error      string              `json:"error,omitempty"`
+}
+
+type SyncManifestTable struct {
+	Schema       string `json:"schema"`
+	Table        string `json:"table"`
+	Status       string `json:"status"`
+	RowCount     int64  `json:"rowCount"`
+	Checksum     string `json:"checksum,omitempty"`
+	BytesWritten int64  `json:"bytesWritten"`
+	Error        string `json:"error,omitempty"`
+
+	MissingLargeObjects   int64 `json:"missingLargeObjects,omitempty"`   // synced as NULL
+	OversizedLargeObjects int64 `json:"oversizedLargeObjects,omitempty"` // synced as NULL
+	OversizedRows         int64 `json:"oversizedRows,omitempty"`         // skipped
+
+	SchemaChanges []string `json:"schemaChanges,omitempty"` // compared to the existing Iceberg table, e.g. "add column email"
+}
+
+func NewSyncManifest() *SyncManifest {
+	return &SyncManifest{RunId: uuid.New().String(), StartedAt: time.Now().UTC(), Tables: []SyncManifestTable{}}
+}
+
+func (manifest *SyncManifest) AddTable(table SyncManifestTable) {
+	manifest.Tables = append(manifest.Tables, table)
+}
+
+func (manifest *SyncManifest) RowCount() (rowCount int64) {
+	for _, table := range manifest.Tables {
+		rowCount += table.RowCount
+	}
+	return rowCount
+}
+
+func (manifest *SyncManifest) BytesWritten() (bytesWritten int64) {
+	for _, table := range manifest.Tables {
+		bytesWritten += table.BytesWritten
+	}
+	return bytesWritten
+}
+
+func (manifest *SyncManifest) SkippedLargeObjectCount() (count int64) {
+	for _, table := range manifest.Tables {
+		count += table.MissingLargeObjects + table.OversizedLargeObjects
+	}
+	return count
+}
+
+func (manifest *SyncManifest) SkippedRowCount() (count int64) {
+	for _, table := range manifest.Tables {
+		count += table.OversizedRows
+	}
+	return count
+}
+
+func (manifest *SyncManifest) TableCount(status string) (count int) {
+	for _, table := range manifest.Tables {
+		if table.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Formats the manifest as a single line for the history command, e.g.
+// "2024-01-01T12:00:00Z  [RUN_ID]  1.5s  OK  2 synced, 1 skipped, 0 failed tables  100 rows  2048 bytes"
+func (manifest *SyncManifest) String() string {
+	status := "OK"
+	if manifest.Error != "" {
+		status = "ERROR: " + manifest.Error
+	} else if manifest.TableCount(SYNC_MANIFEST_TABLE_STATUS_FAILED) > 0 {
+		status = "PARTIAL"
+	}
+
+	parts := []string{
+		manifest.StartedAt.Format(time.RFC3339),
+		manifest.RunId,
+		manifest.FinishedAt.Sub(manifest.StartedAt).Round(time.Millisecond).String(),
+		status,
+		fmt.Sprintf(
+			"%d synced, %d skipped, %d failed tables",
+			manifest.TableCount(SYNC_MANIFEST_TABLE_STATUS_SYNCED),
+			manifest.TableCount(SYNC_MANIFEST_TABLE_STATUS_SKIPPED),
+			manifest.TableCount(SYNC_MANIFEST_TABLE_STATUS_FAILED),
+		),
+		fmt.Sprintf("%d rows", manifest.RowCount()),
+		fmt.Sprintf("%d bytes", manifest.BytesWritten()),
+	}
+	if skippedLargeObjectCount := manifest.SkippedLargeObjectCount(); skippedLargeObjectCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped large objects", skippedLargeObjectCount))
+	}
+	if skippedRowCount := manifest.SkippedRowCount(); skippedRowCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped oversized rows", skippedRowCount))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// Totals of a sync run logged when it finishes
+type SyncSummary struct {
+	SyncedTableCount  int
+	SkippedTableCount int // without changes since the last sync
+	FailedTableCount  int
+	RowCount          int64 // of the synced tables
+	BytesWritten      int64
+	Duration          time.Duration
+}
+
+func NewSyncSummary(manifest *SyncManifest) SyncSummary {
+	summary := SyncSummary{
+		SyncedTableCount:  manifest.TableCount(SYNC_MANIFEST_TABLE_STATUS_SYNCED),
+		SkippedTableCount: manifest.TableCount(SYNC_MANIFEST_TABLE_STATUS_SKIPPED),
+		FailedTableCount:  manifest.TableCount(SYNC_MANIFEST_TABLE_STATUS_FAILED),
+		BytesWritten:      manifest.BytesWritten(),
+		Duration:          manifest.FinishedAt.Sub(manifest.StartedAt),
+	}
+	// Skipped tables keep the row count of their previous sync
+	for _, table := range manifest.Tables {
+		if table.Status == SYNC_MANIFEST_TABLE_STATUS_SYNCED {
+			summary.RowCount += table.RowCount
+		}
+	}
+	return summary
+}
+
+// Formats the summary as a single line, e.g.
+// "Synced 2 tables (1 skipped with no changes, 0 failed): 100 rows, 2.0 MB written in 1.5s"
+func (summary SyncSummary) String() string {
+	return fmt.Sprintf(
+		"Synced %d tables (%d skipped with no changes, %d failed): %d rows, %s written in %s",
+		summary.SyncedTableCount,
+		summary.SkippedTableCount,
+		summary.FailedTableCount,
+		summary.RowCount,
+		formatByteSize(summary.BytesWritten),
+		summary.Duration.Round(time.Millisecond).String(),
+	)
+}
+
+func formatByteSize(bytes int64) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	units := []string{"KB", "MB", "GB", "TB"}
+	size := float64(bytes) / 1024
+	unitIndex := 0
+	for size >= 1024 && unitIndex < len(units)-1 {
+		size /= 1024
+		unitIndex++
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unitIndex])
+}
+
+// Writes the manifest to a temporary file and renames it, so readers never see a partially written manifest.
+// File names start with the start time, so sorting them by name sorts the runs chronologically
+func WriteSyncManifest(config *Config, manifest *SyncManifest) (manifestPath string, err error) {
+	manifestsDir := filepath.Join(config.StoragePath, SYNC_MANIFESTS_DIR_NAME)
+	err = os.MkdirAll(manifestsDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	tempFile, err := os.CreateTemp(manifestsDir, ".sync-*.json.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+
+	manifestPath = filepath.Join(manifestsDir, manifest.StartedAt.UTC().Format("20060102T150405.000000Z")+"-"+manifest.RunId+".json")
+	err = os.Rename(tempFile.Name(), manifestPath)
+	if err != nil {
+		return "", err
+	}
+	return manifestPath, nil
+}
+
+// Returns up to "limit" most recent manifests, newest first
+func ReadSyncManifests(config *Config, limit int) ([]SyncManifest, error) {
+	manifestPaths, err := filepath.Glob(filepath.Join(config.StoragePath, SYNC_MANIFESTS_DIR_NAME, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(manifestPaths)))
+	if len(manifestPaths) > limit {
+		manifestPaths = manifestPaths[:limit]
+	}
+
+	manifests := []SyncManifest{}
+	for _, manifestPath := range manifestPaths {
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+
+		var manifest SyncManifest
+		err = json.Unmarshal(data, &manifest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sync manifest %s: %w", manifestPath, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
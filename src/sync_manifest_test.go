@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncManifests(t *testing.T) {
+	newSyncManifest := func(startedAt time.Time) *SyncManifest {
+		manifest := NewSyncManifest()
+		manifest.StartedAt = startedAt
+		manifest.FinishedAt = startedAt.Add(1500 * time.Millisecond)
+		manifest.AddTable(SyncManifestTable{Schema: "public", Table: "users", Status: SYNC_MANIFEST_TABLE_STATUS_SYNCED, RowCount: 100, Checksum: "100:12345", BytesWritten: 2048})
+		manifest.AddTable(SyncManifestTable{Schema: "public", Table: "events", Status: SYNC_MANIFEST_TABLE_STATUS_SKIPPED, RowCount: 5, Checksum: "5:678"})
+		manifest.AddTable(SyncManifestTable{Schema: "public", Table: "remote", Status: SYNC_MANIFEST_TABLE_STATUS_FAILED, Error: "connection refused"})
+		return manifest
+	}
+
+	t.Run("writes manifests atomically and reads the most recent ones first", func(t *testing.T) {
+		config := loadTestConfig()
+		config.StoragePath = t.TempDir()
+		startedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		var manifests []*SyncManifest
+		for i := 0; i < 3; i++ {
+			manifest := newSyncManifest(startedAt.Add(time.Duration(i) * time.Hour))
+			manifestPath, err := WriteSyncManifest(config, manifest)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if filepath.Dir(manifestPath) != filepath.Join(config.StoragePath, SYNC_MANIFESTS_DIR_NAME) || !strings.HasSuffix(manifestPath, manifest.RunId+".json") {
+				t.Errorf("Unexpected manifest path %s", manifestPath)
+			}
+			manifests = append(manifests, manifest)
+		}
+
+		entries, err := os.ReadDir(filepath.Join(config.StoragePath, SYNC_MANIFESTS_DIR_NAME))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(entries) != 3 {
+			t.Errorf("Expected only 3 manifest files without temporary files, got %v", entries)
+		}
+
+		readManifests, err := ReadSyncManifests(config, 2)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(readManifests) != 2 {
+			t.Fatalf("Expected 2 manifests, got %d", len(readManifests))
+		}
+		if !reflect.DeepEqual(readManifests[0], *manifests[2]) || !reflect.DeepEqual(readManifests[1], *manifests[1]) {
+			t.Errorf("Expected the most recent manifests %v, got %v", []*SyncManifest{manifests[2], manifests[1]}, readManifests)
+		}
+	})
+
+	t.Run("reads no manifests if none were written", func(t *testing.T) {
+		config := loadTestConfig()
+		config.StoragePath = t.TempDir()
+
+		manifests, err := ReadSyncManifests(config, 10)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(manifests) != 0 {
+			t.Errorf("Expected no manifests, got %v", manifests)
+		}
+	})
+
+	t.Run("formats a run as a single line", func(t *testing.T) {
+		manifest := newSyncManifest(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+		expected := "2024-01-01T12:00:00Z  " + manifest.RunId + "  1.5s  PARTIAL  1 synced, 1 skipped, 1 failed tables  105 rows  2048 bytes"
+		if manifest.String() != expected {
+			t.Errorf("Expected %s, got %s", expected, manifest.String())
+		}
+
+		manifest.Tables[0].OversizedLargeObjects = 2
+		manifest.Tables[0].MissingLargeObjects = 1
+		if !strings.HasSuffix(manifest.String(), "  2048 bytes  3 skipped large objects") {
+			t.Errorf("Expected skipped large objects to be included, got %s", manifest.String())
+		}
+
+		manifest.Tables[0].OversizedRows = 4
+		if !strings.HasSuffix(manifest.String(), "  3 skipped large objects  4 skipped oversized rows") {
+			t.Errorf("Expected skipped oversized rows to be included, got %s", manifest.String())
+		}
+
+		manifest.Error = "connection reset"
+		if !strings.Contains(manifest.String(), "  ERROR: connection reset  ") {
+			t.Errorf("Expected the run error to be included, got %s", manifest.String())
+		}
+	})
+
+	t.Run("summarizes a run", func(t *testing.T) {
+		manifest := newSyncManifest(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		manifest.Tables[0].BytesWritten = 3 * 1024 * 1024 / 2
+
+		summary := NewSyncSummary(manifest)
+
+		expectedSummary := SyncSummary{SyncedTableCount: 1, SkippedTableCount: 1, FailedTableCount: 1, RowCount: 100, BytesWritten: 3 * 1024 * 1024 / 2, Duration: 1500 * time.Millisecond}
+		if summary != expectedSummary {
+			t.Errorf("Expected %+v, got %+v", expectedSummary, summary)
+		}
+		expected := "Synced 1 tables (1 skipped with no changes, 1 failed): 100 rows, 1.5 MB written in 1.5s"
+		if summary.String() != expected {
+			t.Errorf("Expected %s, got %s", expected, summary.String())
+		}
+	})
+
+	t.Run("formats byte sizes", func(t *testing.T) {
+		for bytes, expected := range map[int64]string{0: "0 B", 1023: "1023 B", 2048: "2.0 KB", 5 * 1024 * 1024 * 1024: "5.0 GB", 2048 * 1024 * 1024 * 1024 * 1024: "2048.0 TB"} {
+			if formatByteSize(bytes) != expected {
+				t.Errorf("Expected %s for %d bytes, got %s", expected, bytes, formatByteSize(bytes))
+			}
+		}
+	})
+
+	t.Run("records a failed run before re-raising the panic", func(t *testing.T) {
+		config := loadTestConfig()
+		config.StoragePath = t.TempDir()
+		syncer := NewSyncer(&Config{StoragePath: config.StoragePath, LogLevel: LOG_LEVEL_ERROR, Pg: PgConfig{DatabaseUrl: "postgres://localhost:5432/db"}})
+		syncer.syncManifest = NewSyncManifest()
+
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != "connection reset" {
+					t.Errorf("Expected the panic to be re-raised, got %v", recovered)
+				}
+			}()
+			defer syncer.writeSyncManifest()
+			syncer.addSyncManifestTable(PgSchemaTable{Schema: "public", Table: "users"}, SyncManifestTable{Status: SYNC_MANIFEST_TABLE_STATUS_SYNCED, RowCount: 1})
+			panic("connection reset")
+		}()
+
+		manifests, err := ReadSyncManifests(config, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(manifests) != 1 || manifests[0].Error != "connection reset" || len(manifests[0].Tables) != 1 || manifests[0].Tables[0].Table != "users" {
+			t.Errorf("Expected the failed run to be recorded, got %v", manifests)
+		}
+		if manifests[0].FinishedAt.Before(manifests[0].StartedAt) {
+			t.Errorf("Expected the finish time to be set, got %v", manifests[0].FinishedAt)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	OTEL_TRACER_NAME      = "github.com/BemiHQ/BemiDB"
+	OTEL_TRACES_PATH      = "/v1/traces"
+	OTEL_SHUTDOWN_TIMEOUT = 5 * time.Second
+
+	OTEL_ATTRIBUTE_SCHEMA        = "bemidb.schema"
+	OTEL_ATTRIBUTE_TABLE         = "bemidb.table"
+	OTEL_ATTRIBUTE_ROW_COUNT     = "bemidb.row_count"
+	OTEL_ATTRIBUTE_FILE_COUNT    = "bemidb.file_count"
+	OTEL_ATTRIBUTE_QUERY_TEXT    = "db.query.text"
+	OTEL_ATTRIBUTE_RETURNED_ROWS = "db.response.returned_rows"
+)
+
+// Sets the global tracer provider to export spans via OTLP over HTTP if an endpoint is configured.
+// Otherwise, the default no-op tracer provider is kept, so that spans cost next to nothing.
+// Returns a function that flushes the remaining spans, which should be deferred until exiting
+func InitTracing(config *Config) (shutdown func()) {
+	if config.Otel.Endpoint == "" {
+		return func() {}
+	}
+
+	exporter, err := otlptracehttp.New(
+		context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(config.Otel.Endpoint, "/")+OTEL_TRACES_PATH),
+	)
+	PanicIfError(err)
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", config.Otel.ServiceName),
+			attribute.String("service.version", VERSION),
+		)),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), OTEL_SHUTDOWN_TIMEOUT)
+		defer cancel()
+
+		err := tracerProvider.Shutdown(ctx)
+		if err != nil {
+			LogWarn(config, "Couldn't export traces:", err)
+		}
+	}
+}
+
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(OTEL_TRACER_NAME).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+func SetSpanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Ends the span with an error status if the error isn't nil
+func EndSpan(span trace.Span, err error) {
+	SetSpanError(span, err)
+	span.End()
+}
+
+// Must be deferred directly, so that a panic can be recorded on the span before it's re-raised
+func EndSpanOnPanic(span trace.Span) {
+	recovered := recover()
+	if recovered != nil {
+		EndSpan(span, fmt.Errorf("%v", recovered))
+		panic(recovered)
+	}
+	span.End()
+}
+
+func schemaTableSpanAttributes(schema string, table string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(OTEL_ATTRIBUTE_SCHEMA, schema),
+		attribute.String(OTEL_ATTRIBUTE_TABLE, table),
+	}
+}
+
+func queryTextSpanAttribute(query string) attribute.KeyValue {
+	return attribute.String(OTEL_ATTRIBUTE_QUERY_TEXT, query)
+}
+
+// Ends the span of a query with the number of returned rows
+func EndQuerySpan(span trace.Span, returnedRowCount int, err error) {
+	span.SetAttributes(attribute.Int(OTEL_ATTRIBUTE_RETURNED_ROWS, returnedRowCount))
+	EndSpan(span, err)
+}
+
+func rowCountSpanAttribute(rowCount int64) attribute.KeyValue {
+	return attribute.Int64(OTEL_ATTRIBUTE_ROW_COUNT, rowCount)
+}
+
+func parquetFilesSpanAttributes(parquetFiles []ParquetFile) []attribute.KeyValue {
+	var rowCount int64
+	for _, parquetFile := range parquetFiles {
+		rowCount += parquetFile.RecordCount
+	}
+	return []attribute.KeyValue{
+		rowCountSpanAttribute(rowCount),
+		attribute.Int(OTEL_ATTRIBUTE_FILE_COUNT, len(parquetFiles)),
+	}
+}
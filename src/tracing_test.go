@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recordSpans := func(t *testing.T) *tracetest.SpanRecorder {
+		spanRecorder := tracetest.NewSpanRecorder()
+		previousTracerProvider := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		t.Cleanup(func() { otel.SetTracerProvider(previousTracerProvider) })
+		return spanRecorder
+	}
+
+	spanAttribute := func(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+		for _, keyValue := range span.Attributes() {
+			if string(keyValue.Key) == key {
+				return keyValue.Value
+			}
+		}
+		return attribute.Value{}
+	}
+
+	t.Run("doesn't change the no-op tracer provider without an endpoint", func(t *testing.T) {
+		tracerProvider := otel.GetTracerProvider()
+
+		shutdown := InitTracing(&Config{Otel: OtelConfig{ServiceName: DEFAULT_OTEL_SERVICE_NAME}})
+		shutdown()
+
+		if otel.GetTracerProvider() != tracerProvider {
+			t.Errorf("Expected the tracer provider to be unchanged, got %T", otel.GetTracerProvider())
+		}
+	})
+
+	t.Run("creates a span with the schema, table, and row count of written Iceberg tables", func(t *testing.T) {
+		spanRecorder := recordSpans(t)
+		config := loadTestConfig()
+		config.StoragePath = t.TempDir()
+		schemaTable := IcebergSchemaTable{Schema: "Test Schema", Table: "Order Items"}
+
+		ctx, parentSpan := StartSpan(context.Background(), "test")
+		i := 0
+		NewIcebergWriter(config).Write(ctx, schemaTable, TEST_SCHEMA_SIMPLE_TABLE_PG_SCHEMA_COLUMNS, func() [][]string {
+			if i > 0 {
+				return [][]string{}
+			}
+			i++
+			return [][]string{{"1"}, {"2"}}
+		})
+		parentSpan.End()
+
+		spans := spanRecorder.Ended()
+		if len(spans) != 2 || spans[0].Name() != "IcebergWriter.Write" {
+			t.Fatalf("Expected an IcebergWriter.Write span and its parent, got %v", spans)
+		}
+		if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+			t.Errorf("Expected the span to be a child of the parent span")
+		}
+		if spanAttribute(spans[0], OTEL_ATTRIBUTE_SCHEMA).AsString() != "Test Schema" || spanAttribute(spans[0], OTEL_ATTRIBUTE_TABLE).AsString() != "Order Items" {
+			t.Errorf("Expected schema and table attributes, got %v", spans[0].Attributes())
+		}
+		if spanAttribute(spans[0], OTEL_ATTRIBUTE_ROW_COUNT).AsInt64() != 2 || spanAttribute(spans[0], OTEL_ATTRIBUTE_FILE_COUNT).AsInt64() != 1 {
+			t.Errorf("Expected 2 rows in 1 file, got %v", spans[0].Attributes())
+		}
+	})
+
+	t.Run("records a panic on the span before re-raising it", func(t *testing.T) {
+		spanRecorder := recordSpans(t)
+
+		func() {
+			defer func() {
+				if r := recover(); r != "connection reset" {
+					t.Errorf("Expected the panic to be re-raised, got %v", r)
+				}
+			}()
+
+			_, span := StartSpan(context.Background(), "test")
+			defer EndSpanOnPanic(span)
+			panic("connection reset")
+		}()
+
+		spans := spanRecorder.Ended()
+		if len(spans) != 1 || spans[0].Status().Code != codes.Error || spans[0].Status().Description != "connection reset" {
+			t.Errorf("Expected an ended span with the panic as error status, got %v", spans)
+		}
+	})
+}
@@ -6,10 +6,14 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 	"unicode"
 
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -23,8 +27,10 @@ func PanicIfError(err error, message ...string) {
 	}
 }
 
-func CreateTemporaryFile(prefix string) (file *os.File, err error) {
-	tempFile, err := os.CreateTemp("", prefix)
+// Creates a file in the configured temp directory, or in the OS temp directory if it isn't set.
+// File names get a random suffix, so that concurrent exports with the same prefix don't collide
+func CreateTemporaryFile(config *Config, prefix string) (file *os.File, err error) {
+	tempFile, err := os.CreateTemp(config.TempDir, prefix+"-*")
 	PanicIfError(err)
 
 	return tempFile, nil
@@ -42,6 +48,60 @@ func StringToInt(s string) (int, error) {
 	return strconv.Atoi(s)
 }
 
+// Formats time as a PostgreSQL timestamptz value with microsecond precision
+func TimeToPgTimestamptzString(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999-07:00")
+}
+
+// Formats time as a PostgreSQL date (followed by the clock layout) with BC years, e.g. "0044-03-15 BC"
+func TimeToPgDateString(t time.Time, clockLayout string) string {
+	year := t.Year()
+	suffix := ""
+	if year <= 0 {
+		year = 1 - year
+		suffix = PG_BC_SUFFIX
+	}
+	return fmt.Sprintf("%04d", year) + t.Format("-01-02"+clockLayout) + suffix
+}
+
+// Formats a float like PostgreSQL does for NaN and infinities, e.g. "Infinity" instead of "+Inf"
+// Formats time as a PostgreSQL timestamptz output value in the time zone, e.g. "2024-01-01 07:00:00.123456-05" or "0044-03-15 12:00:00+00 BC"
+func TimeToPgTimestamptzOutputString(t time.Time, location *time.Location) string {
+	t = t.In(location)
+	_, offset := t.Zone()
+
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	zone := fmt.Sprintf("%s%02d", sign, offset/3600)
+	if offset%3600 != 0 {
+		zone += fmt.Sprintf(":%02d", offset%3600/60)
+		if offset%60 != 0 {
+			zone += fmt.Sprintf(":%02d", offset%60)
+		}
+	}
+
+	dateTime := TimeToPgDateString(t, " 15:04:05.999999")
+	if strings.HasSuffix(dateTime, PG_BC_SUFFIX) {
+		return strings.TrimSuffix(dateTime, PG_BC_SUFFIX) + zone + PG_BC_SUFFIX
+	}
+	return dateTime + zone
+}
+
+func FloatToPgString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return fmt.Sprintf("%v", f)
+}
+
 func StringToScramSha256(password string) string {
 	saltLength := 16
 	digestLength := 32
@@ -69,13 +129,79 @@ func StringToScramSha256(password string) string {
 	)
 }
 
-func StringContainsUpper(str string) bool {
-	for _, char := range str {
-		if unicode.IsUpper(char) {
-			return true
+// Quotes an identifier for PostgreSQL and DuckDB queries, e.g., `Order "Items"` -> `"Order ""Items"""`
+func QuoteIdentifier(identifier string) string {
+	return pgx.Identifier{identifier}.Sanitize()
+}
+
+// Splits a possibly qualified name into identifiers, e.g., `"Test Schema".Users` -> ["Test Schema", "users"].
+// Like in PostgreSQL, quoted identifiers keep their case and unquoted ones are folded to lower case
+func ParseQualifiedIdentifier(name string) []string {
+	var identifiers []string
+	var identifier strings.Builder
+	inQuotes := false
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		switch {
+		case char == '"' && inQuotes && i+1 < len(name) && name[i+1] == '"':
+			identifier.WriteByte('"')
+			i++
+		case char == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+			identifier.WriteByte(char)
+		case char == '.':
+			identifiers = append(identifiers, identifier.String())
+			identifier.Reset()
+		case char == ' ':
+			continue
+		case char >= 'A' && char <= 'Z':
+			identifier.WriteByte(char + 'a' - 'A')
+		default:
+			identifier.WriteByte(char)
+		}
+	}
+	return append(identifiers, identifier.String())
+}
+
+// Escapes a name to be used as a single file or directory name. Only lower-case letters, digits, "_", and "-" are kept,
+// other bytes are escaped as "%XX", so that different names can't collide, even on case-insensitive file systems.
+// Examples: "users" -> "users", "Order Items" -> "%4Frder%20%49tems", "../x" -> "%2E%2E%2Fx"
+func EscapePathSegment(name string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '_' || char == '-' {
+			escaped.WriteByte(char)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", char)
 		}
 	}
-	return false
+	return escaped.String()
+}
+
+// Examples: "createdAt" -> "created_at", "HTTPStatus" -> "http_status", "Order ID" -> "order_id"
+func StringToSnakeCase(str string) string {
+	runes := []rune(str)
+	var builder strings.Builder
+
+	for i, char := range runes {
+		if unicode.IsSpace(char) || char == '-' || char == '.' {
+			builder.WriteRune('_')
+			continue
+		}
+
+		if unicode.IsUpper(char) && i > 0 {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				builder.WriteRune('_')
+			}
+		}
+		builder.WriteRune(unicode.ToLower(char))
+	}
+
+	return builder.String()
 }
 
 func StringToSha256Hash(input string) string {
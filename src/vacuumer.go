@@ -0,0 +1,154 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+type Vacuumer struct {
+	config        *Config
+	icebergReader *IcebergReader
+	icebergWriter *IcebergWriter
+}
+
+func NewVacuumer(config *Config) *Vacuumer {
+	// Iceberg schema names already include the schema prefix
+	icebergConfig := *config
+	icebergConfig.Pg.SchemaPrefix = ""
+
+	return &Vacuumer{
+		config:        config,
+		icebergReader: NewIcebergReader(&icebergConfig),
+		icebergWriter: NewIcebergWriter(&icebergConfig),
+	}
+}
+
+func (vacuumer *Vacuumer) VacuumIcebergTables(dryRun bool) {
+	icebergSchemaTables, err := vacuumer.icebergReader.SchemaTables()
+	PanicIfError(err)
+
+	for _, icebergSchemaTable := range icebergSchemaTables.Values() {
+		if !vacuumer.shouldVacuumTable(icebergSchemaTable) {
+			continue
+		}
+
+		LogComponentInfo(vacuumer.config, LOG_COMPONENT_ICEBERG, "Vacuuming", icebergSchemaTable.String()+"...")
+		expiredSnapshotIds, orphanFiles, err := vacuumer.icebergWriter.Vacuum(icebergSchemaTable, vacuumer.config.Iceberg.SnapshotRetention, dryRun)
+		if err != nil {
+			// Don't delete anything if references can't be fully resolved
+			LogComponentError(vacuumer.config, LOG_COMPONENT_ICEBERG, "Failed to vacuum", icebergSchemaTable.String()+":", err)
+			continue
+		}
+
+		action := "Expired"
+		if dryRun {
+			action = "Would expire"
+		}
+		for _, snapshotId := range expiredSnapshotIds {
+			LogComponentInfo(vacuumer.config, LOG_COMPONENT_ICEBERG, action, "snapshot", snapshotId, "in", icebergSchemaTable.String())
+		}
+
+		action = "Deleted"
+		if dryRun {
+			action = "Would delete"
+		}
+		for _, orphanFile := range orphanFiles {
+			LogComponentInfo(vacuumer.config, LOG_COMPONENT_ICEBERG, action, "unreferenced file", orphanFile.Path, "("+IntToString(int(orphanFile.Size)), "bytes)")
+		}
+	}
+}
+
+func (vacuumer *Vacuumer) ExpireIcebergSnapshots(dryRun bool) {
+	if vacuumer.config.Iceberg.KeepSnapshots == 0 && vacuumer.config.Iceberg.KeepDuration == 0 {
+		panic("Missing snapshot retention. Set --iceberg-keep-snapshots or --iceberg-keep-duration")
+	}
+
+	icebergSchemaTables, err := vacuumer.icebergReader.SchemaTables()
+	PanicIfError(err)
+
+	for _, icebergSchemaTable := range icebergSchemaTables.Values() {
+		if !vacuumer.shouldVacuumTable(icebergSchemaTable) {
+			continue
+		}
+
+		LogComponentDebug(vacuumer.config, LOG_COMPONENT_ICEBERG, "Expiring snapshots of", icebergSchemaTable.String()+"...")
+		expiredSnapshotIds, expiredFiles, err := vacuumer.icebergWriter.ExpireSnapshots(icebergSchemaTable, vacuumer.config.Iceberg.KeepSnapshots, vacuumer.config.Iceberg.KeepDuration, dryRun)
+		if err != nil {
+			LogComponentError(vacuumer.config, LOG_COMPONENT_ICEBERG, "Failed to expire snapshots of", icebergSchemaTable.String()+":", err)
+			continue
+		}
+
+		action := "Expired"
+		if dryRun {
+			action = "Would expire"
+		}
+		for _, snapshotId := range expiredSnapshotIds {
+			LogComponentInfo(vacuumer.config, LOG_COMPONENT_ICEBERG, action, "snapshot", snapshotId, "in", icebergSchemaTable.String())
+		}
+
+		action = "Deleted"
+		if dryRun {
+			action = "Would delete"
+		}
+		for _, expiredFile := range expiredFiles {
+			LogComponentInfo(vacuumer.config, LOG_COMPONENT_ICEBERG, action, "expired file", expiredFile.Path, "("+IntToString(int(expiredFile.Size)), "bytes)")
+		}
+	}
+}
+
+// Deletes files in the table directories of the storage path that no snapshot references, e.g., left by crashed syncs.
+// Files modified within olderThan are kept since they may belong to in-progress writes
+func (vacuumer *Vacuumer) CleanupOrphanFiles(olderThan time.Duration, dryRun bool) {
+	if olderThan < 0 {
+		panic("Invalid --older-than duration " + olderThan.String() + ". Must be non-negative")
+	}
+
+	icebergStorageFiles, err := vacuumer.icebergWriter.storage.IcebergStorageFiles()
+	PanicIfError(err)
+
+	icebergSchemaTables := make([]IcebergSchemaTable, 0, len(icebergStorageFiles))
+	for icebergSchemaTable := range icebergStorageFiles {
+		icebergSchemaTables = append(icebergSchemaTables, icebergSchemaTable)
+	}
+	slices.SortFunc(icebergSchemaTables, func(a, b IcebergSchemaTable) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	action := "Deleted"
+	if dryRun {
+		action = "Would delete"
+	}
+	orphanFileCount, orphanFileBytes := 0, int64(0)
+	for _, icebergSchemaTable := range icebergSchemaTables {
+		if !vacuumer.shouldVacuumTable(icebergSchemaTable) {
+			continue
+		}
+
+		LogComponentDebug(vacuumer.config, LOG_COMPONENT_ICEBERG, "Cleaning up orphan files of", icebergSchemaTable.String()+"...")
+		orphanFiles, err := vacuumer.icebergWriter.DeleteOrphanFiles(icebergSchemaTable, icebergStorageFiles[icebergSchemaTable], time.Now().Add(-olderThan), dryRun)
+		if err != nil {
+			// Don't delete anything if references can't be fully resolved
+			LogComponentError(vacuumer.config, LOG_COMPONENT_ICEBERG, "Failed to clean up orphan files of", icebergSchemaTable.String()+":", err)
+			continue
+		}
+
+		for _, orphanFile := range orphanFiles {
+			LogComponentInfo(vacuumer.config, LOG_COMPONENT_ICEBERG, action, "orphan file", orphanFile.Path, "("+IntToString(int(orphanFile.Size)), "bytes)")
+			orphanFileCount++
+			orphanFileBytes += orphanFile.Size
+		}
+	}
+
+	LogComponentInfo(vacuumer.config, LOG_COMPONENT_ICEBERG, action, orphanFileCount, "orphan file(s)", "("+IntToString(int(orphanFileBytes)), "bytes)")
+}
+
+// Include/exclude filters use PostgreSQL schema names without the schema prefix
+func (vacuumer *Vacuumer) shouldVacuumTable(icebergSchemaTable IcebergSchemaTable) bool {
+	if !strings.HasPrefix(icebergSchemaTable.Schema, vacuumer.config.Pg.SchemaPrefix) {
+		return false
+	}
+
+	schema := strings.TrimPrefix(icebergSchemaTable.Schema, vacuumer.config.Pg.SchemaPrefix)
+	return matchesPgTableFilters(vacuumer.config, schema, icebergSchemaTable.Table)
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVacuum(t *testing.T) {
+	t.Run("deletes only old unreferenced files", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_vacuum", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		loadRowsOnce := func() func() [][]string {
+			loaded := false
+			return func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				return PUBLIC_TEST_TABLE_LOADED_ROWS
+			}
+		}
+		icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		dataDirPath := storage.CreateDataDir(schemaTable)
+		oldOrphanFile, err := storage.CreateParquet(dataDirPath, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		newOrphanFile, err := storage.CreateParquet(dataDirPath, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		oldTime := time.Now().Add(-48 * time.Hour)
+		for _, icebergTableFile := range tableFiles(t, storage, schemaTable) {
+			if icebergTableFile.Path != newOrphanFile.Path {
+				err = os.Chtimes(icebergTableFile.Path, oldTime, oldTime)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+		}
+		filesCount := len(tableFiles(t, storage, schemaTable))
+
+		_, orphanFiles, err := icebergWriter.Vacuum(schemaTable, 24*time.Hour, true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(orphanFiles) != 1 || orphanFiles[0].Path != oldOrphanFile.Path {
+			t.Errorf("Expected only the old orphan file to be listed, got %v", orphanFiles)
+		}
+		if len(tableFiles(t, storage, schemaTable)) != filesCount {
+			t.Errorf("Expected no files to be deleted in dry-run mode")
+		}
+
+		_, orphanFiles, err = icebergWriter.Vacuum(schemaTable, 24*time.Hour, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(orphanFiles) != 1 || orphanFiles[0].Path != oldOrphanFile.Path {
+			t.Errorf("Expected only the old orphan file to be deleted, got %v", orphanFiles)
+		}
+		if len(tableFiles(t, storage, schemaTable)) != filesCount-1 {
+			t.Errorf("Expected the old orphan file to be deleted")
+		}
+		if _, err := os.Stat(oldOrphanFile.Path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", oldOrphanFile.Path)
+		}
+	})
+
+	t.Run("commits the expired snapshots as the next metadata version on top of a concurrent commit", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_vacuum_race", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		writeRows := func(rows [][]string) []ParquetFile {
+			loaded := false
+			return icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS[:1], func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				return rows
+			})
+		}
+		previousParquetFiles := slices.Concat(writeRows([][]string{{"1"}}), writeRows([][]string{{"2"}}))
+		baseMetadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		baseMetadataContent, err := storage.ReadIcebergTableFile(baseMetadataPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		vacuumingWriter := &IcebergWriter{config: config, storage: &racingStorage{Storage: storage, race: func() {
+			writeRows([][]string{{"3"}})
+		}}}
+		expiredSnapshotIds, _, err := vacuumingWriter.Vacuum(schemaTable, 0, false)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expiredSnapshotIds) != 2 {
+			t.Errorf("Expected the snapshots before the concurrent commit to be expired, got %v", expiredSnapshotIds)
+		}
+		content, err := storage.ReadIcebergTableFile(baseMetadataPath)
+		if err != nil || !slices.Equal(content, baseMetadataContent) {
+			t.Errorf("Expected the base metadata file to be left unchanged, got %v", err)
+		}
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if filepath.Base(metadataPath) != "v4.metadata.json" {
+			t.Errorf("Expected the vacuum to be committed as v4.metadata.json, got %s", metadataPath)
+		}
+		for _, previousParquetFile := range previousParquetFiles {
+			if _, err := os.Stat(previousParquetFile.Path); !os.IsNotExist(err) {
+				t.Errorf("Expected the data file %s of an expired snapshot to be deleted, got %v", previousParquetFile.Path, err)
+			}
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS[0].ColumnName})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[3]" {
+			t.Errorf("Expected the rows of the concurrent commit, got %s", formatRows(rows))
+		}
+	})
+}
+
+func TestCleanupOrphanFiles(t *testing.T) {
+	t.Run("deletes only old files in table directories that no snapshot references", func(t *testing.T) {
+		config := loadTestConfig()
+		config.Pg.IncludeSchemas = NewSet([]string{"test_cleanup_orphans"})
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_cleanup_orphans", Table: "test_table"}
+		incompleteSchemaTable := IcebergSchemaTable{Schema: "test_cleanup_orphans", Table: "test_incomplete_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		loadRowsOnce := func() func() [][]string {
+			loaded := false
+			return func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				return PUBLIC_TEST_TABLE_LOADED_ROWS
+			}
+		}
+		icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		oldOrphanFile, err := storage.CreateParquet(storage.CreateDataDir(schemaTable), PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		newOrphanFile, err := storage.CreateParquet(storage.CreateDataDir(schemaTable), PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		incompleteTableFile, err := storage.CreateParquet(storage.CreateDataDir(incompleteSchemaTable), PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// Files outside of table directories, such as sync manifests, are never deleted
+		nonTableFilePath := storage.absoluteIcebergPath(schemaTable.Schema, "manifest.json")
+		err = os.WriteFile(nonTableFilePath, []byte("{}"), 0644)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		oldTime := time.Now().Add(-48 * time.Hour)
+		for _, icebergTableFile := range slices.Concat(tableFiles(t, storage, schemaTable), tableFiles(t, storage, incompleteSchemaTable)) {
+			if icebergTableFile.Path != newOrphanFile.Path {
+				err = os.Chtimes(icebergTableFile.Path, oldTime, oldTime)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+		}
+		err = os.Chtimes(nonTableFilePath, oldTime, oldTime)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		filesCount := len(tableFiles(t, storage, schemaTable))
+
+		icebergStorageFiles, err := storage.IcebergStorageFiles()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIcebergTableFilePaths(t, icebergStorageFiles[schemaTable], icebergTableFilePaths(tableFiles(t, storage, schemaTable)))
+		assertIcebergTableFilePaths(t, icebergStorageFiles[incompleteSchemaTable], NewSet([]string{incompleteTableFile.Path}))
+
+		orphanFiles, err := icebergWriter.DeleteOrphanFiles(schemaTable, icebergStorageFiles[schemaTable], time.Now().Add(-24*time.Hour), true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIcebergTableFilePaths(t, orphanFiles, NewSet([]string{oldOrphanFile.Path}))
+		orphanFiles, err = icebergWriter.DeleteOrphanFiles(schemaTable, icebergStorageFiles[schemaTable], time.Now(), true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIcebergTableFilePaths(t, orphanFiles, NewSet([]string{oldOrphanFile.Path, newOrphanFile.Path}))
+
+		vacuumer := NewVacuumer(config)
+		vacuumer.CleanupOrphanFiles(24*time.Hour, true)
+		if len(tableFiles(t, storage, schemaTable)) != filesCount || len(tableFiles(t, storage, incompleteSchemaTable)) != 1 {
+			t.Errorf("Expected no files to be deleted in dry-run mode")
+		}
+
+		vacuumer.CleanupOrphanFiles(24*time.Hour, false)
+		if len(tableFiles(t, storage, schemaTable)) != filesCount-1 {
+			t.Errorf("Expected only the old orphan file to be deleted")
+		}
+		for _, path := range []string{oldOrphanFile.Path, incompleteTableFile.Path} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be deleted", path)
+			}
+		}
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		PanicIfError(err)
+		for _, path := range []string{newOrphanFile.Path, nonTableFilePath, metadataPath} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("Expected %s to be kept, got %v", path, err)
+			}
+		}
+	})
+
+	t.Run("keeps the metadata copies of retained snapshots committed to Nessie", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_cleanup_nessie_orphans", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		loaded := false
+		icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return PUBLIC_TEST_TABLE_LOADED_ROWS
+		})
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		PanicIfError(err)
+		metadataContent, err := storage.ReadIcebergTableFile(metadataPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		nessieTable, err := (&NessieCatalog{}).parseNessieTable(metadataContent)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		retainedCopyPath := NessieMetadataFilePath(metadataPath, IntToString(int(nessieTable.SnapshotId)))
+		expiredCopyPath := NessieMetadataFilePath(metadataPath, "1")
+		for _, path := range []string{retainedCopyPath, expiredCopyPath} {
+			err = os.WriteFile(path, metadataContent, 0644)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		orphanFiles, err := icebergWriter.DeleteOrphanFiles(schemaTable, tableFiles(t, storage, schemaTable), time.Now().Add(time.Hour), true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIcebergTableFilePaths(t, orphanFiles, NewSet([]string{expiredCopyPath}))
+	})
+
+	t.Run("panics on a negative duration", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != "Invalid --older-than duration -1h0m0s. Must be non-negative" {
+				t.Errorf("Expected a panic about the negative duration, got %v", r)
+			}
+		}()
+
+		NewVacuumer(loadTestConfig()).CleanupOrphanFiles(-time.Hour, true)
+	})
+}
+
+func TestExpireSnapshots(t *testing.T) {
+	t.Run("expires the oldest snapshot and deletes only the files that no retained snapshot references", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_expire_snapshots", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		loadRowsOnce := func() func() [][]string {
+			loaded := false
+			return func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				return PUBLIC_TEST_TABLE_LOADED_ROWS
+			}
+		}
+		newTableFilePaths := func(previousPaths Set[string]) Set[string] {
+			paths := NewSet([]string{})
+			for _, icebergTableFile := range tableFiles(t, storage, schemaTable) {
+				// Each snapshot writes the next metadata file and rewrites the version hint, which never expire with snapshots
+				_, isMetadataFile := IcebergMetadataFileVersion(icebergTableFile.Path)
+				if !previousPaths.Contains(icebergTableFile.Path) && !isMetadataFile && filepath.Base(icebergTableFile.Path) != VERSION_HINT_FILE_NAME {
+					paths.Add(icebergTableFile.Path)
+				}
+			}
+			return paths
+		}
+
+		icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		firstSnapshotPaths := newTableFilePaths(NewSet([]string{}))
+		loadAppendedRows := loadRowsOnce()
+		_, err := icebergWriter.Append(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, func() ([][]string, error) {
+			return loadAppendedRows(), nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		secondSnapshotPaths := newTableFilePaths(firstSnapshotPaths)
+		icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS, loadRowsOnce())
+		filesCount := len(tableFiles(t, storage, schemaTable))
+
+		// The data file of the first snapshot is still referenced by the appended second snapshot
+		expectedExpiredPaths := NewSet([]string{})
+		for _, path := range firstSnapshotPaths.Values() {
+			if strings.HasSuffix(path, ".avro") {
+				expectedExpiredPaths.Add(path)
+			}
+		}
+
+		expiredSnapshotIds, expiredFiles, err := icebergWriter.ExpireSnapshots(schemaTable, 2, 0, true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expiredSnapshotIds) != 1 {
+			t.Errorf("Expected the oldest snapshot to be expired, got %v", expiredSnapshotIds)
+		}
+		assertIcebergTableFilePaths(t, expiredFiles, expectedExpiredPaths)
+		if len(tableFiles(t, storage, schemaTable)) != filesCount {
+			t.Errorf("Expected no files to be deleted in dry-run mode")
+		}
+
+		_, expiredFiles, err = icebergWriter.ExpireSnapshots(schemaTable, 2, 0, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIcebergTableFilePaths(t, expiredFiles, expectedExpiredPaths)
+		// The expiry is committed as the next metadata file
+		if len(tableFiles(t, storage, schemaTable)) != filesCount-len(expectedExpiredPaths)+1 {
+			t.Errorf("Expected only the unshared files of the oldest snapshot to be deleted")
+		}
+
+		expiredSnapshotIds, expiredFiles, err = icebergWriter.ExpireSnapshots(schemaTable, 2, 0, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expiredSnapshotIds) != 0 || len(expiredFiles) != 0 {
+			t.Errorf("Expected no more snapshots to be expired, got %v and %v", expiredSnapshotIds, expiredFiles)
+		}
+
+		_, expiredFiles, err = icebergWriter.ExpireSnapshots(schemaTable, 3, time.Hour, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expiredFiles) != 0 {
+			t.Errorf("Expected recent snapshots to be kept, got %v", expiredFiles)
+		}
+
+		_, expiredFiles, err = icebergWriter.ExpireSnapshots(schemaTable, 1, 0, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// The data file of the first snapshot is no longer referenced after expiring the second one
+		expectedExpiredPaths = NewSet([]string{})
+		for _, path := range append(firstSnapshotPaths.Values(), secondSnapshotPaths.Values()...) {
+			if !strings.HasSuffix(path, ".avro") || secondSnapshotPaths.Contains(path) {
+				expectedExpiredPaths.Add(path)
+			}
+		}
+		assertIcebergTableFilePaths(t, expiredFiles, expectedExpiredPaths)
+
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS[0].ColumnName})
+		if err != nil {
+			t.Fatalf("Expected the current snapshot to be readable, got %v", err)
+		}
+		if len(rows) != len(PUBLIC_TEST_TABLE_LOADED_ROWS) {
+			t.Errorf("Expected %d rows in the current snapshot, got %d", len(PUBLIC_TEST_TABLE_LOADED_ROWS), len(rows))
+		}
+	})
+
+	t.Run("commits the expiry as the next metadata version on top of a concurrent commit", func(t *testing.T) {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		storage := NewLocalStorage(config)
+		schemaTable := IcebergSchemaTable{Schema: "test_expire_snapshots_race", Table: "test_table"}
+		defer icebergWriter.DeleteSchema(schemaTable.Schema)
+
+		writeRows := func(rows [][]string) {
+			loaded := false
+			icebergWriter.Write(context.Background(), schemaTable, PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS[:1], func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				return rows
+			})
+		}
+		writeRows([][]string{{"1"}})
+		writeRows([][]string{{"2"}})
+		baseMetadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		baseMetadataContent, err := storage.ReadIcebergTableFile(baseMetadataPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expiringWriter := &IcebergWriter{config: config, storage: &racingStorage{Storage: storage, race: func() {
+			writeRows([][]string{{"3"}})
+		}}}
+		expiredSnapshotIds, _, err := expiringWriter.ExpireSnapshots(schemaTable, 1, 0, false)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expiredSnapshotIds) != 2 {
+			t.Errorf("Expected the snapshots before the concurrent commit to be expired, got %v", expiredSnapshotIds)
+		}
+		content, err := storage.ReadIcebergTableFile(baseMetadataPath)
+		if err != nil || !slices.Equal(content, baseMetadataContent) {
+			t.Errorf("Expected the base metadata file to be left unchanged, got %v", err)
+		}
+		metadataPath, err := storage.IcebergMetadataFilePath(schemaTable)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if filepath.Base(metadataPath) != "v4.metadata.json" {
+			t.Errorf("Expected the expiry to be committed as v4.metadata.json, got %s", metadataPath)
+		}
+		rows, err := storage.ReadParquetColumns(schemaTable, []string{PUBLIC_TEST_TABLE_PG_SCHEMA_COLUMNS[0].ColumnName})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if formatRows(rows) != "[3]" {
+			t.Errorf("Expected the rows of the concurrent commit, got %s", formatRows(rows))
+		}
+	})
+}
+
+func TestExpireMetadataSnapshots(t *testing.T) {
+	icebergWriter := &IcebergWriter{config: &Config{}}
+	now := time.Now()
+	metadataContent := []byte(`{
+		"current-snapshot-id": 1730000000000000003,
+		"refs": {"main": {"snapshot-id": 1730000000000000003, "type": "branch"}},
+		"snapshots": [
+			{"snapshot-id": 1730000000000000001, "timestamp-ms": ` + IntToString(int(now.Add(-72*time.Hour).UnixMilli())) + `, "manifest-list": "snap-1.avro"},
+			{"snapshot-id": 1730000000000000002, "timestamp-ms": ` + IntToString(int(now.Add(-time.Hour).UnixMilli())) + `, "manifest-list": "snap-2.avro"},
+			{"snapshot-id": 1730000000000000003, "timestamp-ms": ` + IntToString(int(now.Add(-96*time.Hour).UnixMilli())) + `, "manifest-list": "snap-3.avro"}
+		],
+		"snapshot-log": [
+			{"snapshot-id": 1730000000000000001, "timestamp-ms": 1},
+			{"snapshot-id": 1730000000000000002, "timestamp-ms": 2},
+			{"snapshot-id": 1730000000000000003, "timestamp-ms": 3}
+		]
+	}`)
+
+	t.Run("expires old snapshots except the current one", func(t *testing.T) {
+		newMetadataContent, expiredSnapshotIds, err := icebergWriter.expireMetadataSnapshots(metadataContent, now.Add(-24*time.Hour), 0)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expiredSnapshotIds) != 1 || expiredSnapshotIds[0] != "1730000000000000001" {
+			t.Errorf("Expected snapshot 1730000000000000001 to be expired, got %v", expiredSnapshotIds)
+		}
+
+		manifestListPaths, err := icebergWriter.parseMetadataManifestListPaths(newMetadataContent)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(manifestListPaths) != 2 || manifestListPaths[0] != "snap-2.avro" || manifestListPaths[1] != "snap-3.avro" {
+			t.Errorf("Expected remaining manifest lists to be snap-2.avro and snap-3.avro, got %v", manifestListPaths)
+		}
+
+		var metadata struct {
+			CurrentSnapshotId int64 `json:"current-snapshot-id"`
+			SnapshotLog       []struct {
+				SnapshotId int64 `json:"snapshot-id"`
+			} `json:"snapshot-log"`
+		}
+		err = json.Unmarshal(newMetadataContent, &metadata)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if metadata.CurrentSnapshotId != 1730000000000000003 {
+			t.Errorf("Expected current snapshot ID to be preserved, got %d", metadata.CurrentSnapshotId)
+		}
+		if len(metadata.SnapshotLog) != 2 {
+			t.Errorf("Expected expired snapshot to be removed from the snapshot log, got %v", metadata.SnapshotLog)
+		}
+	})
+
+	t.Run("keeps the most recent snapshots", func(t *testing.T) {
+		for _, testCase := range []struct {
+			expireBefore        time.Time
+			keepSnapshots       int
+			expectedSnapshotIds []string
+		}{
+			{time.Time{}, 1, []string{"1730000000000000001"}},
+			{time.Time{}, 2, nil},
+			{now.Add(-80 * time.Hour), 1, nil},
+			{now.Add(-24 * time.Hour), 1, []string{"1730000000000000001"}},
+		} {
+			_, expiredSnapshotIds, err := icebergWriter.expireMetadataSnapshots(metadataContent, testCase.expireBefore, testCase.keepSnapshots)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(expiredSnapshotIds, testCase.expectedSnapshotIds) {
+				t.Errorf("Expected snapshots %v to be expired when keeping %d snapshots, got %v", testCase.expectedSnapshotIds, testCase.keepSnapshots, expiredSnapshotIds)
+			}
+		}
+	})
+
+	t.Run("keeps metadata unchanged when no snapshots are expired", func(t *testing.T) {
+		newMetadataContent, expiredSnapshotIds, err := icebergWriter.expireMetadataSnapshots(metadataContent, now.Add(-168*time.Hour), 0)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expiredSnapshotIds) != 0 || string(newMetadataContent) != string(metadataContent) {
+			t.Errorf("Expected no snapshots to be expired, got %v", expiredSnapshotIds)
+		}
+	})
+}
+
+func assertIcebergTableFilePaths(t *testing.T, icebergTableFiles []IcebergTableFile, expectedPaths Set[string]) {
+	paths := icebergTableFilePaths(icebergTableFiles)
+	if len(icebergTableFiles) != len(expectedPaths) || !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Expected files %v, got %v", expectedPaths.Values(), paths.Values())
+	}
+}
+
+func icebergTableFilePaths(icebergTableFiles []IcebergTableFile) Set[string] {
+	paths := NewSet([]string{})
+	for _, icebergTableFile := range icebergTableFiles {
+		paths.Add(icebergTableFile.Path)
+	}
+	return paths
+}
+
+func tableFiles(t *testing.T, storage *StorageLocal, schemaTable IcebergSchemaTable) []IcebergTableFile {
+	icebergTableFiles, err := storage.IcebergTableFiles(schemaTable)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return icebergTableFiles
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	TABLE_VALIDATION_STATUS_MATCHED  = "MATCHED"
+	TABLE_VALIDATION_STATUS_DIVERGED = "DIVERGED"
+	TABLE_VALIDATION_STATUS_MISSING  = "MISSING"
+	TABLE_VALIDATION_STATUS_SKIPPED  = "SKIPPED"
+	TABLE_VALIDATION_STATUS_FAILED   = "FAILED"
+
+	// Values are prefixed so that NULL, the empty string, and the separator can't be confused with each other
+	VALIDATION_VALUE_PREFIX = "v"
+	VALIDATION_NULL_VALUE   = "n"
+)
+
+type TableValidation struct {
+	Schema               string
+	Table                string
+	Status               string
+	PgRowCount           int64
+	IcebergRowCount      int64
+	PgChecksum           string
+	IcebergChecksum      string
+	UncheckedColumnNames []string // synced columns whose values aren't compared, e.g. floats, arrays, or binary values
+	Error                string   // for failed and skipped tables
+}
+
+func (validation TableValidation) Diverges() bool {
+	return validation.Status != TABLE_VALIDATION_STATUS_MATCHED && validation.Status != TABLE_VALIDATION_STATUS_SKIPPED
+}
+
+// Pairs the expressions that format a synced value the same way in PostgreSQL and in DuckDB
+type ValidationColumn struct {
+	PgExpression      string
+	IcebergExpression string
+}
+
+// Compares each synced table with its Iceberg table by the row count and an order-independent checksum.
+// The PostgreSQL checksum used to detect changes hashes the text of whole rows with hashtext(), which DuckDB can't compute,
+// so both sides sum the first 60 bits of the MD5 hash of each row built from values formatted as they are synced
+type Validator struct {
+	config        *Config
+	syncer        *Syncer
+	icebergReader *IcebergReader
+	duckdb        *Duckdb
+}
+
+func NewValidator(config *Config) *Validator {
+	return &Validator{
+		config:        config,
+		syncer:        NewSyncer(config),
+		icebergReader: NewIcebergReader(config),
+		duckdb:        NewDuckdb(config),
+	}
+}
+
+// Validates only the given tables if --tables is set
+func (validator *Validator) ValidateIcebergTables(options *SyncOptions) []TableValidation {
+	defer validator.duckdb.Close()
+
+	databaseUrl := validator.syncer.urlEncodePassword(validator.config.Pg.DatabaseUrl)
+	if validator.config.Pg.IncludeDatabases == nil && validator.config.Pg.ExcludeDatabases == nil {
+		return validator.validatePgDatabase(validator.syncer, databaseUrl, options)
+	}
+
+	// Databases are synced into schemas prefixed with the database name
+	var validations []TableValidation
+	for _, database := range validator.syncer.filterPgDatabases(validator.syncer.listPgDatabases(databaseUrl)) {
+		databaseConfig := *validator.config
+		databaseConfig.Pg.DatabaseUrl = validator.syncer.pgDatabaseUrl(databaseUrl, database)
+		databaseConfig.Pg.SchemaPrefix = validator.config.Pg.SchemaPrefix + database + "_"
+
+		validations = append(validations, validator.validatePgDatabase(NewSyncer(&databaseConfig), databaseConfig.Pg.DatabaseUrl, options)...)
+	}
+	return validations
+}
+
+// Reads all tables from a single snapshot, like the sync
+func (validator *Validator) validatePgDatabase(syncer *Syncer, databaseUrl string, options *SyncOptions) []TableValidation {
+	ctx := context.Background()
+	conn, err := syncer.connectPg(ctx, databaseUrl)
+	PanicIfError(err)
+	defer conn.Close(ctx)
+
+	err = syncer.beginPgTransaction(ctx, conn)
+	PanicIfError(err)
+
+	err = syncer.setPgSyncSettings(ctx, conn)
+	PanicIfError(err)
+
+	icebergSchemaTables, err := validator.icebergReader.SchemaTables()
+	PanicIfError(err)
+
+	var validations []TableValidation
+	for _, pgSchemaTable := range syncer.listPgSchemaTablesToSync(conn, options) {
+		LogComponentInfo(validator.config, LOG_COMPONENT_SYNCER, "Validating "+pgSchemaTable.String()+"...")
+		validation := validator.validatePgTable(ctx, syncer, conn, pgSchemaTable, icebergSchemaTables)
+		validation.Schema = pgSchemaTable.Schema
+		validation.Table = pgSchemaTable.Table
+		validations = append(validations, validation)
+	}
+	return validations
+}
+
+func (validator *Validator) validatePgTable(ctx context.Context, syncer *Syncer, conn *pgx.Conn, pgSchemaTable PgSchemaTable, icebergSchemaTables Set[IcebergSchemaTable]) TableValidation {
+	// Changed rows are appended, so the Iceberg table keeps previous versions of updated rows
+	if syncer.syncsPgTableIncrementallyByXmin(pgSchemaTable) {
+		return TableValidation{Status: TABLE_VALIDATION_STATUS_SKIPPED, Error: "synced incrementally with xmin"}
+	}
+
+	icebergSchemaTable := syncer.icebergSchemaTable(pgSchemaTable)
+	icebergSchemaTable.Schema = syncer.config.Pg.SchemaPrefix + icebergSchemaTable.Schema
+	if !icebergSchemaTables.Contains(icebergSchemaTable) {
+		return TableValidation{Status: TABLE_VALIDATION_STATUS_MISSING}
+	}
+
+	properties, err := validator.icebergReader.TableProperties(icebergSchemaTable)
+	PanicIfError(err)
+	pgSchemaColumnsJson, ok := properties[ICEBERG_PROPERTY_PG_SCHEMA_COLUMNS]
+	if !ok {
+		return TableValidation{Status: TABLE_VALIDATION_STATUS_SKIPPED, Error: "synced with a previous version of BemiDB"}
+	}
+	var icebergPgSchemaColumns []PgSchemaColumn
+	err = json.Unmarshal([]byte(pgSchemaColumnsJson), &icebergPgSchemaColumns)
+	PanicIfError(err)
+
+	pgSchemaColumnsByName := make(map[string]PgSchemaColumn)
+	for _, pgSchemaColumn := range syncer.pgTableSchemaColumns(conn, pgSchemaTable) {
+		pgSchemaColumnsByName[syncer.foldPgColumnName(pgSchemaColumn.ColumnName)] = pgSchemaColumn
+	}
+	validationColumns, uncheckedColumnNames, tracksDeletes := matchValidationColumns(icebergPgSchemaColumns, pgSchemaColumnsByName)
+	validation := TableValidation{UncheckedColumnNames: uncheckedColumnNames}
+
+	predicate := syncer.config.Pg.TableFilters[pgSchemaTable.Schema+"."+pgSchemaTable.Table]
+	err = conn.QueryRow(ctx, pgTableChecksumQuery(pgSchemaTable, validationColumns, predicate)).Scan(&validation.PgRowCount, &validation.PgChecksum)
+	PanicIfError(err)
+
+	metadataPath, err := validator.icebergReader.MetadataFilePath(icebergSchemaTable)
+	if err == nil {
+		source := "iceberg_scan('" + strings.ReplaceAll(metadataPath, "'", "''") + "', skip_schema_inference = true)"
+		validation.IcebergRowCount, validation.IcebergChecksum, err = validator.icebergTableChecksum(ctx, source, validationColumns, tracksDeletes)
+	}
+	if err != nil {
+		LogComponentError(validator.config, LOG_COMPONENT_SYNCER, "Couldn't read Iceberg table "+icebergSchemaTable.String()+":", err)
+		validation.Status = TABLE_VALIDATION_STATUS_FAILED
+		validation.Error = err.Error()
+		return validation
+	}
+
+	validation.Status = TABLE_VALIDATION_STATUS_MATCHED
+	if validation.PgRowCount != validation.IcebergRowCount || validation.PgChecksum != validation.IcebergChecksum {
+		validation.Status = TABLE_VALIDATION_STATUS_DIVERGED
+	}
+	return validation
+}
+
+func (validator *Validator) icebergTableChecksum(ctx context.Context, source string, validationColumns []ValidationColumn, tracksDeletes bool) (rowCount int64, checksum string, err error) {
+	rows, err := validator.duckdb.QueryContext(ctx, icebergTableChecksumQuery(source, validationColumns, tracksDeletes))
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, "", rows.Err()
+	}
+	err = rows.Scan(&rowCount, &checksum)
+	return rowCount, checksum, err
+}
+
+// Matches the synced columns recorded in the Iceberg table with the current PostgreSQL ones.
+// Columns that were converted when synced (e.g. money or large objects), added by BemiDB, or changed since the sync aren't compared.
+// The "_deleted_at" column of tracked deletes isn't compared either, rows with it set are deleted in PostgreSQL
+func matchValidationColumns(icebergPgSchemaColumns []PgSchemaColumn, pgSchemaColumnsByName map[string]PgSchemaColumn) (validationColumns []ValidationColumn, uncheckedColumnNames []string, tracksDeletes bool) {
+	for _, icebergPgSchemaColumn := range icebergPgSchemaColumns {
+		pgSchemaColumn, ok := pgSchemaColumnsByName[icebergPgSchemaColumn.ColumnName]
+		if !ok && icebergPgSchemaColumn.ColumnName == DELETED_AT_COLUMN_NAME {
+			tracksDeletes = true
+			continue
+		}
+
+		if ok && pgSchemaColumn.UdtName == icebergPgSchemaColumn.UdtName && pgSchemaColumn.DataType == icebergPgSchemaColumn.DataType {
+			validationColumn, ok := icebergPgSchemaColumn.validationColumn(QuoteIdentifier(pgSchemaColumn.ColumnName))
+			if ok {
+				validationColumns = append(validationColumns, validationColumn)
+				continue
+			}
+		}
+		uncheckedColumnNames = append(uncheckedColumnNames, icebergPgSchemaColumn.ColumnName)
+	}
+	return validationColumns, uncheckedColumnNames, tracksDeletes
+}
+
+// Returns the expressions that format synced values as text, e.g. dates as days since the epoch and timestamps as epoch
+// microseconds (or milliseconds) with infinite values clamped or NULL, like they are stored in Parquet.
+// Values that are rounded when read (floats), aren't text in DuckDB (arrays, binary values), or are converted on export
+// (e.g. intervals, geometries, or tsvectors) can't be compared
+func (pgSchemaColumn *PgSchemaColumn) validationColumn(quotedPgColumnName string) (validationColumn ValidationColumn, ok bool) {
+	quotedColumnName := QuoteIdentifier(pgSchemaColumn.ColumnName)
+	icebergTextExpression := "CAST(" + quotedColumnName + " AS VARCHAR)"
+
+	if pgSchemaColumn.IsComposite {
+		return ValidationColumn{PgExpression: "to_jsonb(" + quotedPgColumnName + ")::text", IcebergExpression: icebergTextExpression}, true
+	}
+	if pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY || pgSchemaColumn.IsGeometry() || pgSchemaColumn.IsLargeObject {
+		return ValidationColumn{}, false
+	}
+	if pgSchemaColumn.IsEnum() || pgSchemaColumn.isOidAlias() {
+		return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+	}
+	// Overridden types are synced as their text output or converted on export
+	if pgSchemaColumn.TypeOverride != "" {
+		if pgSchemaColumn.UdtName == "text" {
+			return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+		}
+		return ValidationColumn{}, false
+	}
+
+	switch pgSchemaColumn.UdtName {
+	case "int2", "int4", "int8", "oid", "xid", "xid8", "uuid",
+		"varchar", "char", "text", "json", "jsonb", "tsquery", "pg_snapshot",
+		"point", "line", "lseg", "box", "path", "polygon", "circle",
+		"cidr", "inet", "macaddr", "macaddr8":
+		return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+	case "xml":
+		if pgSchemaColumn.XmlXpath != "" {
+			return ValidationColumn{PgExpression: pgXmlXpathExpression(quotedPgColumnName, pgSchemaColumn.XmlXpath), IcebergExpression: icebergTextExpression}, true
+		}
+		return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+	case "bit", "varbit":
+		if pgSchemaColumn.BitFormat == PG_BIT_FORMAT_BINARY {
+			return ValidationColumn{}, false
+		}
+		return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+	case "interval":
+		if pgSchemaColumn.IntervalFormat != PG_INTERVAL_FORMAT_TEXT {
+			return ValidationColumn{}, false
+		}
+		return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+	case "bpchar":
+		// Casting to text removes the padding
+		if !pgSchemaColumn.KeepsCharPadding {
+			return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+		}
+		if pgSchemaColumn.CharacterMaximumLength == "" || pgSchemaColumn.CharacterMaximumLength == "0" {
+			return ValidationColumn{}, false
+		}
+		return ValidationColumn{PgExpression: "rpad(" + quotedPgColumnName + "::text, " + pgSchemaColumn.CharacterMaximumLength + ")", IcebergExpression: icebergTextExpression}, true
+	case "numeric":
+		switch pgSchemaColumn.NumericFormat {
+		case PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE:
+			return ValidationColumn{}, false
+		case PG_UNCONSTRAINED_NUMERIC_FORMAT_STRING:
+			return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+		}
+		// Decimals are formatted with all digits of the scale
+		_, scale := pgSchemaColumn.decimalPrecisionAndScale()
+		return ValidationColumn{PgExpression: "round(" + quotedPgColumnName + ", " + IntToString(scale) + ")::text", IcebergExpression: icebergTextExpression}, true
+	case "bool":
+		return ValidationColumn{
+			PgExpression:      "CASE WHEN " + quotedPgColumnName + " THEN 't' WHEN NOT " + quotedPgColumnName + " THEN 'f' END",
+			IcebergExpression: "CASE WHEN " + quotedColumnName + " THEN 't' WHEN NOT " + quotedColumnName + " THEN 'f' END",
+		}, true
+	case "date":
+		return ValidationColumn{
+			PgExpression:      pgSchemaColumn.pgInfiniteValidationExpression(quotedPgColumnName, "("+quotedPgColumnName+" - DATE '1970-01-01')::text", PARQUET_MAX_DATE_DAYS, PARQUET_MIN_DATE_DAYS),
+			IcebergExpression: "CAST(" + quotedColumnName + " - DATE '1970-01-01' AS VARCHAR)",
+		}, true
+	case "timestamp", "timestamptz":
+		// Parquet timestamps are truncated to milliseconds unless the column has a higher precision
+		if pgSchemaColumn.hasMicrosecondPrecision() {
+			return ValidationColumn{
+				PgExpression:      pgSchemaColumn.pgInfiniteValidationExpression(quotedPgColumnName, "(EXTRACT(EPOCH FROM "+quotedPgColumnName+") * 1000000)::bigint::text", PARQUET_MAX_TIMESTAMP_MICROS, PARQUET_MIN_TIMESTAMP_MICROS),
+				IcebergExpression: "CAST(epoch_us(" + quotedColumnName + ") AS VARCHAR)",
+			}, true
+		}
+		return ValidationColumn{
+			PgExpression:      pgSchemaColumn.pgInfiniteValidationExpression(quotedPgColumnName, "trunc(EXTRACT(EPOCH FROM "+quotedPgColumnName+") * 1000)::bigint::text", PARQUET_MAX_TIMESTAMP_MICROS/1000, PARQUET_MIN_TIMESTAMP_MICROS/1000),
+			IcebergExpression: "CAST(epoch_ms(" + quotedColumnName + ") AS VARCHAR)",
+		}, true
+	}
+
+	// User-defined types, e.g. citext, are synced as their text output
+	if pgSchemaColumn.Namespace != PG_SCHEMA_PG_CATALOG {
+		return ValidationColumn{PgExpression: quotedPgColumnName + "::text", IcebergExpression: icebergTextExpression}, true
+	}
+	return ValidationColumn{}, false
+}
+
+func (pgSchemaColumn *PgSchemaColumn) pgInfiniteValidationExpression(quotedPgColumnName string, finiteExpression string, maxValue int64, minValue int64) string {
+	maxText, minText := "'"+fmt.Sprint(maxValue)+"'", "'"+fmt.Sprint(minValue)+"'"
+	if pgSchemaColumn.IsInfinitySyncedAsNull(PG_INFINITY) {
+		maxText, minText = "NULL", "NULL"
+	}
+	return "CASE WHEN " + quotedPgColumnName + " = 'infinity' THEN " + maxText + " WHEN " + quotedPgColumnName + " = '-infinity' THEN " + minText + " ELSE " + finiteExpression + " END"
+}
+
+// Returns the row count and the sum of row hashes as text, which is 0 for empty tables
+func pgTableChecksumQuery(pgSchemaTable PgSchemaTable, validationColumns []ValidationColumn, predicate string) string {
+	pgExpressions := make([]string, len(validationColumns))
+	for i, validationColumn := range validationColumns {
+		pgExpressions[i] = validationColumn.PgExpression
+	}
+
+	rowHash := "('x' || substr(md5(" + validationRowText(pgExpressions) + "), 1, 15))::bit(60)::bigint"
+	query := "SELECT COUNT(*), COALESCE(SUM(" + rowHash + "), 0)::text FROM " + pgSchemaTable.String()
+	if predicate != "" {
+		query += " WHERE (" + predicate + ")"
+	}
+	return query
+}
+
+func icebergTableChecksumQuery(source string, validationColumns []ValidationColumn, tracksDeletes bool) string {
+	icebergExpressions := make([]string, len(validationColumns))
+	for i, validationColumn := range validationColumns {
+		icebergExpressions[i] = validationColumn.IcebergExpression
+	}
+
+	rowHash := "CAST('0x' || substr(md5(" + validationRowText(icebergExpressions) + "), 1, 15) AS BIGINT)"
+	query := "SELECT COUNT(*), CAST(COALESCE(SUM(" + rowHash + "), 0) AS VARCHAR) FROM " + source
+	if tracksDeletes {
+		query += " WHERE " + QuoteIdentifier(DELETED_AT_COLUMN_NAME) + " IS NULL"
+	}
+	return query
+}
+
+// Builds the same text of a row in PostgreSQL and in DuckDB, with values separated by the ASCII unit separator
+func validationRowText(expressions []string) string {
+	if len(expressions) == 0 {
+		return "''"
+	}
+
+	values := make([]string, len(expressions))
+	for i, expression := range expressions {
+		values[i] = "COALESCE('" + VALIDATION_VALUE_PREFIX + "' || " + expression + ", '" + VALIDATION_NULL_VALUE + "')"
+	}
+	return "concat_ws(chr(31), " + strings.Join(values, ", ") + ")"
+}
+
+func PrintTableValidations(writer io.Writer, validations []TableValidation) {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "TABLE\tSTATUS\tPG ROWS\tICEBERG ROWS\tPG CHECKSUM\tICEBERG CHECKSUM\tNOTE")
+
+	divergedCount := 0
+	for _, validation := range validations {
+		if validation.Diverges() {
+			divergedCount++
+		}
+
+		note := validation.Error
+		if note == "" && len(validation.UncheckedColumnNames) > 0 {
+			note = "unchecked columns: " + strings.Join(validation.UncheckedColumnNames, ", ")
+		}
+		fmt.Fprintf(
+			tabWriter,
+			"%s.%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			validation.Schema,
+			validation.Table,
+			validation.Status,
+			validation.PgRowCount,
+			validation.IcebergRowCount,
+			validation.PgChecksum,
+			validation.IcebergChecksum,
+			note,
+		)
+	}
+	tabWriter.Flush()
+
+	fmt.Fprintf(writer, "%d tables validated, %d diverged\n", len(validations), divergedCount)
+}
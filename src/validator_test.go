@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	// Computes the checksum like PostgreSQL does from the row texts
+	expectedChecksum := func(rowTexts []string) string {
+		sum := new(big.Int)
+		for _, rowText := range rowTexts {
+			hash := md5.Sum([]byte(rowText))
+			rowHash, err := strconv.ParseInt(hex.EncodeToString(hash[:])[:15], 16, 64)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			sum.Add(sum, big.NewInt(rowHash))
+		}
+		return sum.String()
+	}
+
+	writeIcebergTable := func(t *testing.T, schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, rows [][]string) string {
+		config := loadTestConfig()
+		icebergWriter := NewIcebergWriter(config)
+		t.Cleanup(func() { icebergWriter.DeleteSchema(schemaTable.Schema) })
+		loaded := false
+		icebergWriter.Write(context.Background(), schemaTable, pgSchemaColumns, func() [][]string {
+			if loaded {
+				return [][]string{}
+			}
+			loaded = true
+			return rows
+		})
+		return "read_parquet('" + filepath.Join(config.StoragePath, schemaTable.Schema, schemaTable.Table, "data", "*.parquet") + "')"
+	}
+
+	newTestValidator := func(t *testing.T) *Validator {
+		db, err := sql.Open("duckdb", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return &Validator{config: loadTestConfig(), duckdb: &Duckdb{db: db, config: loadTestConfig()}}
+	}
+
+	t.Run("formats synced values with comparable expressions in PostgreSQL and DuckDB", func(t *testing.T) {
+		for _, testCase := range []struct {
+			pgSchemaColumn            PgSchemaColumn
+			expectedPgExpression      string
+			expectedIcebergExpression string
+		}{
+			{
+				PgSchemaColumn{ColumnName: "user_id", DataType: "integer", UdtName: "int4", Namespace: PG_SCHEMA_PG_CATALOG},
+				`"userId"::text`,
+				`CAST("user_id" AS VARCHAR)`,
+			},
+			{
+				PgSchemaColumn{ColumnName: "active", DataType: "boolean", UdtName: "bool", Namespace: PG_SCHEMA_PG_CATALOG},
+				`CASE WHEN "userId" THEN 't' WHEN NOT "userId" THEN 'f' END`,
+				`CASE WHEN "active" THEN 't' WHEN NOT "active" THEN 'f' END`,
+			},
+			{
+				PgSchemaColumn{ColumnName: "amount", DataType: "numeric", UdtName: "numeric", NumericPrecision: "10", NumericScale: "2", Namespace: PG_SCHEMA_PG_CATALOG},
+				`round("userId", 2)::text`,
+				`CAST("amount" AS VARCHAR)`,
+			},
+			{
+				PgSchemaColumn{ColumnName: "code", DataType: "character", UdtName: "bpchar", CharacterMaximumLength: "5", KeepsCharPadding: true, Namespace: PG_SCHEMA_PG_CATALOG},
+				`rpad("userId"::text, 5)`,
+				`CAST("code" AS VARCHAR)`,
+			},
+			{
+				PgSchemaColumn{ColumnName: "birthday", DataType: "date", UdtName: "date", IsNullable: PG_TRUE, InfiniteTimestampFormat: PG_INFINITE_TIMESTAMP_FORMAT_NULL, Namespace: PG_SCHEMA_PG_CATALOG},
+				`CASE WHEN "userId" = 'infinity' THEN NULL WHEN "userId" = '-infinity' THEN NULL ELSE ("userId" - DATE '1970-01-01')::text END`,
+				`CAST("birthday" - DATE '1970-01-01' AS VARCHAR)`,
+			},
+			{
+				PgSchemaColumn{ColumnName: "created_at", DataType: "timestamp with time zone", UdtName: "timestamptz", DatetimePrecision: "3", InfiniteTimestampFormat: PG_INFINITE_TIMESTAMP_FORMAT_CLAMP, Namespace: PG_SCHEMA_PG_CATALOG},
+				`CASE WHEN "userId" = 'infinity' THEN '9223372036854775' WHEN "userId" = '-infinity' THEN '-9223372022400000' ELSE trunc(EXTRACT(EPOCH FROM "userId") * 1000)::bigint::text END`,
+				`CAST(epoch_ms("created_at") AS VARCHAR)`,
+			},
+			{
+				PgSchemaColumn{ColumnName: "email", DataType: "USER-DEFINED", UdtName: "citext", Namespace: "public"},
+				`"userId"::text`,
+				`CAST("email" AS VARCHAR)`,
+			},
+			{
+				PgSchemaColumn{ColumnName: "order_id", DataType: "xml", UdtName: "xml", XmlXpath: "/order/@id", Namespace: PG_SCHEMA_PG_CATALOG},
+				`(xpath('/order/@id', "userId"))[1]::text`,
+				`CAST("order_id" AS VARCHAR)`,
+			},
+		} {
+			validationColumn, ok := testCase.pgSchemaColumn.validationColumn(`"userId"`)
+
+			if !ok {
+				t.Fatalf("Expected %s to be compared", testCase.pgSchemaColumn.UdtName)
+			}
+			if validationColumn.PgExpression != testCase.expectedPgExpression {
+				t.Errorf("Expected %s to have the PostgreSQL expression %s, got %s", testCase.pgSchemaColumn.UdtName, testCase.expectedPgExpression, validationColumn.PgExpression)
+			}
+			if validationColumn.IcebergExpression != testCase.expectedIcebergExpression {
+				t.Errorf("Expected %s to have the DuckDB expression %s, got %s", testCase.pgSchemaColumn.UdtName, testCase.expectedIcebergExpression, validationColumn.IcebergExpression)
+			}
+		}
+	})
+
+	t.Run("doesn't compare floats, arrays, binary values, and converted values", func(t *testing.T) {
+		for _, pgSchemaColumn := range []PgSchemaColumn{
+			{ColumnName: "score", DataType: "double precision", UdtName: "float8", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "tags", DataType: PG_DATA_TYPE_ARRAY, UdtName: "_text", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "avatar", DataType: "bytea", UdtName: "bytea", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "duration", DataType: "interval", UdtName: "interval", IntervalFormat: PG_INTERVAL_FORMAT_MICROSECONDS, Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "total", DataType: "numeric", UdtName: "numeric", NumericFormat: PG_UNCONSTRAINED_NUMERIC_FORMAT_DOUBLE, Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "attributes", DataType: "jsonb", UdtName: "jsonb", TypeOverride: "hstore", Namespace: PG_SCHEMA_PG_CATALOG},
+		} {
+			_, ok := pgSchemaColumn.validationColumn(QuoteIdentifier(pgSchemaColumn.ColumnName))
+
+			if ok {
+				t.Errorf("Expected %s not to be compared", pgSchemaColumn.UdtName)
+			}
+		}
+	})
+
+	t.Run("matches synced columns with the current PostgreSQL columns by their folded names", func(t *testing.T) {
+		icebergPgSchemaColumns := []PgSchemaColumn{
+			{ColumnName: "user_id", DataType: "integer", UdtName: "int4", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "price", DataType: "numeric", UdtName: "numeric", NumericPrecision: "38", NumericScale: "2", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "name", DataType: "text", UdtName: "text", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "client_ip_family", DataType: "integer", UdtName: "int4", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: DELETED_AT_COLUMN_NAME, DataType: "timestamp with time zone", UdtName: "timestamptz", DatetimePrecision: "6", Namespace: PG_SCHEMA_PG_CATALOG},
+		}
+		pgSchemaColumnsByName := map[string]PgSchemaColumn{
+			"user_id": {ColumnName: "userId", DataType: "integer", UdtName: "int4", Namespace: PG_SCHEMA_PG_CATALOG},
+			"price":   {ColumnName: "price", DataType: "money", UdtName: "money", Namespace: PG_SCHEMA_PG_CATALOG},
+			"name":    {ColumnName: "name", DataType: "character varying", UdtName: "varchar", Namespace: PG_SCHEMA_PG_CATALOG},
+		}
+
+		validationColumns, uncheckedColumnNames, tracksDeletes := matchValidationColumns(icebergPgSchemaColumns, pgSchemaColumnsByName)
+
+		expectedValidationColumns := []ValidationColumn{{PgExpression: `"userId"::text`, IcebergExpression: `CAST("user_id" AS VARCHAR)`}}
+		if !reflect.DeepEqual(validationColumns, expectedValidationColumns) {
+			t.Errorf("Expected %v, got %v", expectedValidationColumns, validationColumns)
+		}
+		expectedUncheckedColumnNames := []string{"price", "name", "client_ip_family"}
+		if !reflect.DeepEqual(uncheckedColumnNames, expectedUncheckedColumnNames) {
+			t.Errorf("Expected %v, got %v", expectedUncheckedColumnNames, uncheckedColumnNames)
+		}
+		if !tracksDeletes {
+			t.Errorf("Expected deletes to be tracked")
+		}
+	})
+
+	t.Run("checksums PostgreSQL rows with the row filter", func(t *testing.T) {
+		validationColumns := []ValidationColumn{{PgExpression: `"id"::text`}, {PgExpression: `"name"::text`}}
+
+		query := pgTableChecksumQuery(PgSchemaTable{Schema: "public", Table: "users"}, validationColumns, "active")
+
+		expectedQuery := `SELECT COUNT(*), COALESCE(SUM(('x' || substr(md5(concat_ws(chr(31), COALESCE('v' || "id"::text, 'n'), COALESCE('v' || "name"::text, 'n'))), 1, 15))::bit(60)::bigint), 0)::text FROM "public"."users" WHERE (active)`
+		if query != expectedQuery {
+			t.Errorf("Expected %s, got %s", expectedQuery, query)
+		}
+	})
+
+	t.Run("checksums Iceberg rows like PostgreSQL regardless of their order and without deleted rows", func(t *testing.T) {
+		pgSchemaColumns := []PgSchemaColumn{
+			{ColumnName: "id", DataType: "integer", UdtName: "int4", IsNullable: "NO", OrdinalPosition: "1", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "name", DataType: "text", UdtName: "text", IsNullable: PG_TRUE, OrdinalPosition: "2", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "amount", DataType: "numeric", UdtName: "numeric", IsNullable: PG_TRUE, OrdinalPosition: "3", NumericPrecision: "10", NumericScale: "2", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "active", DataType: "boolean", UdtName: "bool", IsNullable: PG_TRUE, OrdinalPosition: "4", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "birthday", DataType: "date", UdtName: "date", IsNullable: PG_TRUE, OrdinalPosition: "5", InfiniteTimestampFormat: PG_INFINITE_TIMESTAMP_FORMAT_CLAMP, Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "created_at", DataType: "timestamp with time zone", UdtName: "timestamptz", IsNullable: PG_TRUE, OrdinalPosition: "6", DatetimePrecision: "6", InfiniteTimestampFormat: PG_INFINITE_TIMESTAMP_FORMAT_CLAMP, Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: "external_id", DataType: "uuid", UdtName: "uuid", IsNullable: PG_TRUE, OrdinalPosition: "7", Namespace: PG_SCHEMA_PG_CATALOG},
+			{ColumnName: DELETED_AT_COLUMN_NAME, DataType: "timestamp with time zone", UdtName: "timestamptz", IsNullable: PG_TRUE, OrdinalPosition: "8", DatetimePrecision: "6", Namespace: PG_SCHEMA_PG_CATALOG},
+		}
+		rows := [][]string{
+			{"1", "Alice", "1.5", "t", "2024-01-02", "2024-01-02 03:04:05.123456+00", "A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11", PG_NULL_STRING},
+			{"2", "", "-0.1", "f", "infinity", "-infinity", PG_NULL_STRING, PG_NULL_STRING},
+			{"3", PG_NULL_STRING, PG_NULL_STRING, PG_NULL_STRING, PG_NULL_STRING, PG_NULL_STRING, PG_NULL_STRING, PG_NULL_STRING},
+			{"4", "Deleted", "0", "t", "1970-01-01", "1970-01-01 00:00:00+00", PG_NULL_STRING, "2024-02-01 00:00:00+00"},
+		}
+		reversedRows := [][]string{rows[3], rows[2], rows[1], rows[0]}
+		pgSchemaColumnsByName := make(map[string]PgSchemaColumn)
+		for _, pgSchemaColumn := range pgSchemaColumns[:7] {
+			pgSchemaColumnsByName[pgSchemaColumn.ColumnName] = pgSchemaColumn
+		}
+		validationColumns, uncheckedColumnNames, tracksDeletes := matchValidationColumns(pgSchemaColumns, pgSchemaColumnsByName)
+		if len(uncheckedColumnNames) > 0 || !tracksDeletes {
+			t.Fatalf("Expected all columns to be compared with tracked deletes, got %v %v", uncheckedColumnNames, tracksDeletes)
+		}
+		validator := newTestValidator(t)
+
+		source := writeIcebergTable(t, IcebergSchemaTable{Schema: "test_validator", Table: "users"}, pgSchemaColumns, rows)
+		rowCount, checksum, err := validator.icebergTableChecksum(context.Background(), source, validationColumns, tracksDeletes)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		reversedSource := writeIcebergTable(t, IcebergSchemaTable{Schema: "test_validator", Table: "reversed_users"}, pgSchemaColumns, reversedRows)
+		_, reversedChecksum, err := validator.icebergTableChecksum(context.Background(), reversedSource, validationColumns, tracksDeletes)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		separator := string(rune(31))
+		expectedRowTexts := []string{
+			strings.Join([]string{"v1", "vAlice", "v1.50", "vt", "v19724", "v1704164645123456", "va0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"}, separator),
+			strings.Join([]string{"v2", "v", "v-0.10", "vf", "v2147483646", "v-9223372022400000000", "n"}, separator),
+			strings.Join([]string{"v3", "n", "n", "n", "n", "n", "n"}, separator),
+		}
+		if rowCount != 3 {
+			t.Errorf("Expected 3 rows, got %d", rowCount)
+		}
+		if checksum != expectedChecksum(expectedRowTexts) {
+			t.Errorf("Expected the checksum %s, got %s", expectedChecksum(expectedRowTexts), checksum)
+		}
+		if reversedChecksum != checksum {
+			t.Errorf("Expected the checksum of reversed rows to be %s, got %s", checksum, reversedChecksum)
+		}
+	})
+
+	t.Run("returns a zero checksum for empty tables", func(t *testing.T) {
+		validator := newTestValidator(t)
+
+		rowCount, checksum, err := validator.icebergTableChecksum(context.Background(), "(SELECT 1 AS id WHERE FALSE)", []ValidationColumn{{IcebergExpression: `CAST("id" AS VARCHAR)`}}, false)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if rowCount != 0 || checksum != "0" {
+			t.Errorf("Expected 0 rows with the checksum 0, got %d %s", rowCount, checksum)
+		}
+	})
+
+	t.Run("prints a summary with diverged tables", func(t *testing.T) {
+		validations := []TableValidation{
+			{Schema: "public", Table: "users", Status: TABLE_VALIDATION_STATUS_MATCHED, PgRowCount: 2, IcebergRowCount: 2, PgChecksum: "123", IcebergChecksum: "123", UncheckedColumnNames: []string{"score", "tags"}},
+			{Schema: "public", Table: "orders", Status: TABLE_VALIDATION_STATUS_DIVERGED, PgRowCount: 3, IcebergRowCount: 2, PgChecksum: "456", IcebergChecksum: "400"},
+			{Schema: "public", Table: "events", Status: TABLE_VALIDATION_STATUS_SKIPPED, Error: "synced incrementally with xmin"},
+		}
+		var output bytes.Buffer
+
+		PrintTableValidations(&output, validations)
+
+		expectedOutput := "TABLE          STATUS    PG ROWS  ICEBERG ROWS  PG CHECKSUM  ICEBERG CHECKSUM  NOTE\n" +
+			"public.users   MATCHED   2        2             123          123               unchecked columns: score, tags\n" +
+			"public.orders  DIVERGED  3        2             456          400               \n" +
+			"public.events  SKIPPED   0        0                                            synced incrementally with xmin\n" +
+			"3 tables validated, 1 diverged\n"
+		if output.String() != expectedOutput {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expectedOutput, output.String())
+		}
+	})
+}